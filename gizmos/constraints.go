@@ -0,0 +1,180 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	constraints
+	Abstract:	Path constraints which a reservation may supply to limit the paths that are
+				acceptable: a maximum number of hops (switch to switch links), a maximum
+				latency (the sum of the links' latencies, microseconds), switches to avoid and
+				shared risk link groups (SRLG, or failure domain tags assigned to links in the
+				static topology) to avoid. Links marked as administratively excluded in the
+				topology are never used, constrained or not.
+
+				Constraints are written as space separated key=value tokens, the same form that
+				is accepted on a reservation request and saved in the checkpoint:
+					maxhops=3 maxlatency=2ms avoid=sw1,sw2 avoidsrlg=conduit-a
+
+	Date:		19 Oct 2026
+*/
+
+package gizmos
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Path_constraints struct {
+	Max_hops	int					// max switch to switch links; 0 == no limit
+	Max_latency	int64				// max sum of link latency (microseconds); 0 == no limit
+	Avoid_sw	[]string			// switches that the path must not pass through
+	Avoid_srlg	[]string			// links tagged with any of these groups are not used
+}
+
+/*
+	Convert a latency value to microseconds. A trailing us, ms or s gives the unit;
+	microseconds are assumed if there is none.
+*/
+func latency2us( s string ) ( int64, error ) {
+	mult := int64( 1 )
+	switch {
+		case strings.HasSuffix( s, "us" ):
+			s = s[:len( s ) - 2]
+		case strings.HasSuffix( s, "ms" ):
+			s = s[:len( s ) - 2]
+			mult = 1000
+		case strings.HasSuffix( s, "s" ):
+			s = s[:len( s ) - 1]
+			mult = 1000000
+	}
+
+	v, err := strconv.ParseInt( s, 10, 64 )
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf( "invalid latency: %s", s )
+	}
+	return v * mult, nil
+}
+
+/*
+	Parse the constraints from a string of key=value tokens (see the abstract). An empty
+	string results in a nil pointer which is treated as no constraints.
+*/
+func Mk_path_constraints( spec string ) ( pc *Path_constraints, err error ) {
+	toks := strings.Fields( spec )
+	if len( toks ) == 0 {
+		return nil, nil
+	}
+
+	pc = &Path_constraints{ }
+	for _, tok := range toks {
+		kv := strings.SplitN( tok, "=", 2 )
+		if len( kv ) != 2 || kv[1] == "" {
+			return nil, fmt.Errorf( "invalid path constraint: %s", tok )
+		}
+
+		switch strings.ToLower( kv[0] ) {
+			case "maxhops":
+				pc.Max_hops, err = strconv.Atoi( kv[1] )
+				if err != nil || pc.Max_hops < 0 {
+					return nil, fmt.Errorf( "invalid maxhops: %s", kv[1] )
+				}
+
+			case "maxlatency":
+				if pc.Max_latency, err = latency2us( kv[1] ); err != nil {
+					return nil, err
+				}
+
+			case "avoid":
+				pc.Avoid_sw = append( pc.Avoid_sw, strings.Split( kv[1], "," )... )
+
+			case "avoidsrlg":
+				pc.Avoid_srlg = append( pc.Avoid_srlg, strings.Split( kv[1], "," )... )
+
+			default:
+				return nil, fmt.Errorf( "unknown path constraint: %s", kv[0] )
+		}
+	}
+
+	return pc, nil
+}
+
+/*
+	Returns true if there are no constraints.
+*/
+func ( pc *Path_constraints ) Is_empty( ) ( bool ) {
+	return pc == nil || (pc.Max_hops == 0 && pc.Max_latency == 0 && len( pc.Avoid_sw ) == 0 && len( pc.Avoid_srlg ) == 0)
+}
+
+/*
+	Returns the constraints in the form that Mk_path_constraints accepts.
+*/
+func ( pc *Path_constraints ) String( ) ( string ) {
+	if pc.Is_empty() {
+		return ""
+	}
+
+	toks := make( []string, 0, 4 )
+	if pc.Max_hops > 0 {
+		toks = append( toks, fmt.Sprintf( "maxhops=%d", pc.Max_hops ) )
+	}
+	if pc.Max_latency > 0 {
+		toks = append( toks, fmt.Sprintf( "maxlatency=%dus", pc.Max_latency ) )
+	}
+	if len( pc.Avoid_sw ) > 0 {
+		toks = append( toks, "avoid=" + strings.Join( pc.Avoid_sw, "," ) )
+	}
+	if len( pc.Avoid_srlg ) > 0 {
+		toks = append( toks, "avoidsrlg=" + strings.Join( pc.Avoid_srlg, "," ) )
+	}
+	return strings.Join( toks, " " )
+}
+
+/*
+	Returns true if the switch is one that must be avoided.
+*/
+func ( pc *Path_constraints ) Avoids_switch( sw *Switch ) ( bool ) {
+	if pc == nil || sw == nil {
+		return false
+	}
+
+	for _, a := range pc.Avoid_sw {
+		if a == *sw.id {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	Returns the name of the first shared risk group which the link belongs to and which must
+	be avoided; the empty string if the link is acceptable.
+*/
+func ( pc *Path_constraints ) Avoids_link( l *Link ) ( string ) {
+	if pc == nil || l == nil {
+		return ""
+	}
+
+	for _, a := range pc.Avoid_srlg {
+		if l.In_srlg( a ) {
+			return a
+		}
+	}
+	return ""
+}
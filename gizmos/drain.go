@@ -0,0 +1,199 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	drain
+	Abstract:	A maintenance window (drain) which removes a percentage of the usable capacity
+				of a link, of every link attached to a switch, or of every link attached to a
+				physical host, for a period of time. The network manager applies the drain to
+				the obligations of the links it covers so that path finding does not select
+				them for reservations which need the capacity during the window; 100% takes the
+				target out of service.
+
+				The target of a link drain is the pair of switches (sw1,sw2) and covers the
+				link in both directions. Physical hosts are nodes in the graph, so a host drain
+				covers the same links as a switch drain of the host; the kind is kept so that
+				the request is reported as it was given.
+
+				Drains are saved in the checkpoint as a single record:
+					mwin: <id> <kind> <target> <commence> <conclude> <pct>
+
+	Date:		19 Oct 2026
+*/
+
+package gizmos
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+)
+
+const (
+	DRAIN_LINK		string = "link"
+	DRAIN_SWITCH	string = "switch"
+	DRAIN_HOST		string = "host"
+)
+
+type Drain struct {
+	id			string
+	kind		string			// link, switch or host
+	target		string			// sw1,sw2 for a link; the switch or host name otherwise
+	commence	int64
+	conclude	int64
+	pct			int				// percentage of capacity removed during the window
+}
+
+/*
+	Constructor. The window must end in the future and the percentage must be between
+	1 and 100. A link target must name two switches separated with a comma.
+*/
+func Mk_drain( id string, kind string, target string, commence int64, conclude int64, pct int ) ( d *Drain, err error ) {
+	if id == "" || strings.ContainsAny( id, " \t" ) {
+		return nil, fmt.Errorf( "drain id must be supplied and may not contain blanks" )
+	}
+	if target == "" || strings.ContainsAny( target, " \t" ) {
+		return nil, fmt.Errorf( "drain target must be supplied and may not contain blanks" )
+	}
+
+	switch kind {
+		case DRAIN_LINK:
+			if sw := strings.Split( target, "," ); len( sw ) != 2 || sw[0] == "" || sw[1] == "" {
+				return nil, fmt.Errorf( "link drain target must be sw1,sw2: %s", target )
+			}
+
+		case DRAIN_SWITCH, DRAIN_HOST:
+
+		default:
+			return nil, fmt.Errorf( "drain kind must be link, switch or host: %s", kind )
+	}
+
+	if pct < 1 || pct > 100 {
+		return nil, fmt.Errorf( "drain percentage must be between 1 and 100: %d", pct )
+	}
+	if conclude <= time.Now().Unix() || conclude < commence {
+		return nil, fmt.Errorf( "drain window must end in the future and after it starts: %d-%d", commence, conclude )
+	}
+
+	return &Drain{ id: id, kind: kind, target: target, commence: commence, conclude: conclude, pct: pct }, nil
+}
+
+/*
+	Build a drain from a checkpoint record generated by To_chkpt().
+*/
+func Chkpt2drain( rec string ) ( *Drain, error ) {
+	toks := strings.Fields( rec )
+	if len( toks ) != 7 || toks[0] != "mwin:" {
+		return nil, fmt.Errorf( "drain checkpoint record is not valid: %s", rec )
+	}
+
+	return Mk_drain( toks[1], toks[2], toks[3], clike.Atoll( toks[4] ), clike.Atoll( toks[5] ), clike.Atoi( toks[6] ) )
+}
+
+func (d *Drain) Get_id( ) ( string ) {
+	return d.id
+}
+
+func (d *Drain) Get_kind( ) ( string ) {
+	return d.kind
+}
+
+func (d *Drain) Get_target( ) ( string ) {
+	return d.target
+}
+
+func (d *Drain) Get_window( ) ( int64, int64 ) {
+	return d.commence, d.conclude
+}
+
+func (d *Drain) Get_pct( ) ( int ) {
+	return d.pct
+}
+
+/*
+	Returns true if the window has passed.
+*/
+func (d *Drain) Is_expired( ) ( bool ) {
+	return d == nil || d.conclude < time.Now().Unix()
+}
+
+/*
+	Returns true if the drain's window overlaps the commence/conclude window.
+*/
+func (d *Drain) Overlaps( commence int64, conclude int64 ) ( bool ) {
+	return d != nil && commence <= d.conclude && conclude >= d.commence
+}
+
+/*
+	Returns true if the drain covers a link between the two switches (either direction).
+	Switch names of the form host@interface are compared using just the host.
+*/
+func (d *Drain) Covers_link( sw1 string, sw2 string ) ( bool ) {
+	if d == nil {
+		return false
+	}
+
+	sw1 = strings.SplitN( sw1, "@", 2 )[0]
+	sw2 = strings.SplitN( sw2, "@", 2 )[0]
+	if d.kind == DRAIN_LINK {
+		sw := strings.Split( d.target, "," )
+		return (sw[0] == sw1 && sw[1] == sw2) || (sw[0] == sw2 && sw[1] == sw1)
+	}
+
+	return d.target == sw1 || d.target == sw2
+}
+
+/*
+	Returns true if the drain covers the switch (all of its links); never true for link drains.
+*/
+func (d *Drain) Covers_switch( sw string ) ( bool ) {
+	return d != nil && d.kind != DRAIN_LINK && d.target == strings.SplitN( sw, "@", 2 )[0]
+}
+
+func (d *Drain) String( ) ( string ) {
+	if d == nil {
+		return ""
+	}
+	return fmt.Sprintf( "drain %s: %s %s %d%% from %d to %d", d.id, d.kind, d.target, d.pct, d.commence, d.conclude )
+}
+
+func (d *Drain) To_chkpt( ) ( string ) {
+	return fmt.Sprintf( "mwin: %s %s %s %d %d %d", d.id, d.kind, d.target, d.commence, d.conclude, d.pct )
+}
+
+func (d *Drain) To_json( ) ( string ) {
+	if d == nil {
+		return "{ }"
+	}
+
+	state := "pending"
+	now := time.Now().Unix()
+	switch {
+		case d.conclude < now:
+			state = "done"
+
+		case d.commence <= now:
+			state = "active"
+	}
+
+	return fmt.Sprintf( `{ "id": %q, "kind": %q, "target": %q, "commence": %d, "conclude": %d, "pct": %d, "state": %q }`,
+		d.id, d.kind, d.target, d.commence, d.conclude, d.pct, state )
+}
@@ -29,6 +29,9 @@
 				05 May 2014 : Added function to build a FL_host_json from raw data rather
 					than from json response data (supports running w/o floodlight).
 				29 Jul 2014 : Mlag support
+				19 Oct 2026 : Added SK_ie_flowmod_del.
+				19 Oct 2026 : Link latency, cost, srlg and exclusion attributes (static topology).
+				19 Oct 2026 : Per-link headroom (rich topology file).
 ------------------------------------------------------------------------------------------------
 */
 
@@ -129,6 +132,12 @@ type FL_link_json struct {
 	Capacity int64
 
 	Mlag	*string		// extension for q-lite (floodlight did NOT return this)
+
+	Latency		int64		// extensions for the static topology; latency in microseconds
+	Cost		int			// path computation cost; 0 is treated as 1
+	Srlg		[]string	// shared risk link groups (failure domains)
+	Excluded	bool		// administratively excluded from path finding
+	Headroom	*int		// percentage of capacity held back; nil == configured link_headroom
 }
 
 // -----------------------------------------------------------------------------------------
@@ -412,3 +421,41 @@ func SK_ie_flowmod(  flhost *string, srchost string, desthost string, expiry int
 
 	return
 }
+
+/*
+	Sends an ingress/egress flow-mod delete request to skoogi; the flow-mod added with the same
+	host pair, switch and port is removed.
+	/wm/skapi/txt"?action=iefmdel&srchost=<host>&desthost=<host>&swid=<switch>&port=<port>"
+*/
+func SK_ie_flowmod_del(  flhost *string, srchost string, desthost string, swid string, port int ) ( err error ) {
+	var (
+		uri	string
+		body	*bytes.Buffer
+		resp	*http.Response
+	)
+
+	body = bytes.NewBufferString( "no-data" )			// skoogi doesn't accept data yet; all parms tacked onto the url
+
+	if strings.Index( swid, ":" ) > 0 {					// must remove colons if they are there
+		tokens := strings.Split( swid, ":" )
+		swid = strings.Join( tokens, "" )
+	}
+
+	uri = fmt.Sprintf( "%s/wm/skapi/txt?action=iefmdel&srchost=%s&desthost=%s&swid=%s&port=%d", *flhost, srchost, desthost, swid, port )
+
+	obj_sheep.Baa( 2, "sk_ie_flomod_del: sending ie delete to skoogi: %s", uri )
+	resp, err = http.Post( uri, "plain/text", body )
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	rbody, err := ioutil.ReadAll( resp.Body )
+	if err == nil {
+		obj_sheep.Baa( 2, "SK_ie_flomod_del: skoogi response: %s", rbody )
+	} else {
+		obj_sheep.Baa( 0, "SK_ie_flomod_del: ERR: skoogi request failed: %s", err )
+	}
+
+	return
+}
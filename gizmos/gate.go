@@ -202,6 +202,18 @@ func (g *Gate) Get_spq( qid *string, timestamp int64 ) ( *Spq ) {
 	return Mk_spq( "", 0, 0 )
 }
 
+/*
+	Return the switch/port string, as it appears in the queue list, of the gate queue whose
+	switch/port Get_spq returns.
+*/
+func (g *Gate) Get_qport( ) ( string ) {
+	if g == nil || g.gsw == nil {
+		return ""
+	}
+
+	return g.gsw.Get_link( 0 ).Get_forward_qport( )
+}
+
 
 // ------------------- link management -------------------------------------------------------------
 
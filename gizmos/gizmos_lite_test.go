@@ -25,21 +25,27 @@
 	Date:		28 April 2014
 	Author:		E. Scott Daniels
 
+	Mods:		19 Oct 2026 - Added rich topology file test.
+				19 Oct 2026 - Added drain test.
+				19 Oct 2026 - Added graph export test.
 */
 
 package gizmos_test
 
 import (
 	//"bufio"
-	//"encoding/json"
+	"encoding/json"
+	"encoding/xml"
 	//"flag"
 	"fmt"
-	//"io/ioutil"
+	"io"
+	"io/ioutil"
 	//"html"
 	//"net/http"
 	"os"
-	//"strings"
-	//"time"
+	"path/filepath"
+	"strings"
+	"time"
 	"testing"
 
 	"github.com/att/tegu/gizmos"
@@ -74,3 +80,211 @@ func TestLoadLinks( t *testing.T ) {			// must use bloody camel case to be recog
 
 	fmt.Fprintf( os.Stderr, "\n" )
 }
+
+/*
+	Write the json to a scratch file and read it as a topology.
+*/
+func read_topo( t *testing.T, json string ) ( *gizmos.Topology, error ) {
+	fname := filepath.Join( os.TempDir(), fmt.Sprintf( "tegu_topo_test_%d.json", os.Getpid() ) )
+	defer os.Remove( fname )
+
+	if err := ioutil.WriteFile( fname, []byte( json ), 0600 ); err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: unable to write scratch topology: %s\n", err )
+		t.Fail()
+		return nil, err
+	}
+
+	if ! gizmos.Is_topology( fname ) {
+		return nil, fmt.Errorf( "not recognised as a topology file" )
+	}
+	return gizmos.Read_topology( fname )
+}
+
+/*
+	A rich topology is validated and converted to floodlight links and hosts.
+*/
+func Test_topology( t *testing.T ) {
+	topo, err := read_topo( t, `{ "version": 1,
+		"switches": [ { "id": "sw1", "site": "east", "attrs": { "rack": "r1" } }, { "id": "sw2" } ],
+		"links": [ { "src": "sw1", "src_port": 1, "dst": "sw2", "dst_port": 2, "capacity": 4000, "headroom": 10, "mlag": "m1", "latency": 50, "srlg": [ "c1" ] } ],
+		"hosts": [ { "mac": "FA:16:3E:00:00:01", "ip4": "10.0.0.5", "switch": "sw2", "port": 9 } ] }` )
+	if err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: valid topology rejected: %s\n", err )
+		t.Fail()
+		return
+	}
+
+	links := topo.Fl_links()
+	if len( links ) != 1 || links[0].Direction != "bidirectional" || links[0].Capacity != 4000 || *links[0].Headroom != 10 || *links[0].Mlag != "m1" || links[0].Latency != 50 {
+		fmt.Fprintf( os.Stderr, "FAIL: links not converted as expected: %v\n", links )
+		t.Fail()
+	}
+	hosts := topo.Fl_hosts()
+	if len( hosts ) != 1 || hosts[0].Mac[0] != "fa:16:3e:00:00:01" || hosts[0].AttachmentPoint[0].SwitchDPID != "sw2" || hosts[0].AttachmentPoint[0].Port != 9 {
+		fmt.Fprintf( os.Stderr, "FAIL: hosts not converted as expected: %v\n", hosts )
+		t.Fail()
+	}
+
+	_, err = read_topo( t, `{ "version": 1, "switches": [ { "id": "sw1" }, { "id": "sw1" } ],
+		"links": [ { "src": "sw1", "dst": "sw9", "headroom": 120 }, { "src": "sw9", "dst": "sw1" } ],
+		"hosts": [ { "mac": "junk", "switch": "sw1", "port": -3 } ] }` )
+	if err == nil || ! strings.Contains( err.Error(), "7 problem(s)" ) {
+		fmt.Fprintf( os.Stderr, "FAIL: invalid topology not rejected as expected: %v\n", err )
+		t.Fail()
+	}
+
+	if _, err = read_topo( t, `{ "version": 1, "switches": [ ], "colour": "red" }` ); err == nil {
+		fmt.Fprintf( os.Stderr, "FAIL: unknown field accepted\n" )
+		t.Fail()
+	}
+	if _, err = read_topo( t, `[ { "Src-switch": "sw1" } ]` ); err == nil {
+		fmt.Fprintf( os.Stderr, "FAIL: legacy link list recognised as a topology\n" )
+		t.Fail()
+	}
+}
+
+/*
+	Parse lldpctl key/value output and ensure records survive the round trip to tegu.
+*/
+func Test_lldp( t *testing.T ) {
+	lines := []string {
+		"lldp.eth1.via=LLDP",
+		"lldp.eth1.chassis.mac=00:11:22:33:44:55",
+		"lldp.eth1.chassis.name=tor 1",
+		"lldp.eth1.port.ifname=Ethernet12",
+		"lldp.eth0.chassis.id=sw-a",
+		"lldp.eth0.port.id=7",
+		"lldp.eth2.port.ifname=Ethernet3",				// no chassis; must be dropped
+		"lldp.eth3.100.chassis.name=tor2",				// vlan interface; dots in the name
+		"lldp.eth3.100.port.ifname=Ethernet4",
+		"speed.eth1=10000",
+		"speed.eth3.100=1000",
+		"speed.eth0=-1",
+		"junk",
+	}
+
+	nbrs := gizmos.Lldp_parse( "h1", lines )
+	if len( nbrs ) != 3 || nbrs[0].String() != "h1 eth0 sw-a 7 0" || nbrs[1].String() != "h1 eth1 tor_1 Ethernet12 10000000000" ||
+		nbrs[2].String() != "h1 eth3.100 tor2 Ethernet4 1000000000" {
+		fmt.Fprintf( os.Stderr, "FAIL: lldp output not parsed as expected: %v\n", nbrs )
+		t.Fail()
+		return
+	}
+
+	nb, err := gizmos.Mk_lldp_neighbour( nbrs[1].String() )
+	if err != nil || *nb != *nbrs[1] {
+		fmt.Fprintf( os.Stderr, "FAIL: lldp record did not round trip: %v %v\n", nb, err )
+		t.Fail()
+	}
+	if _, err = gizmos.Mk_lldp_neighbour( "h1 eth0 sw-a 7" ); err == nil {
+		fmt.Fprintf( os.Stderr, "FAIL: short lldp record accepted\n" )
+		t.Fail()
+	}
+
+	l := nb.Fl_link()
+	if l.Src_switch != "tor_1" || l.Dst_switch != "h1@eth1" || l.Capacity != 10000000000 || l.Direction != "bidirectional" {
+		fmt.Fprintf( os.Stderr, "FAIL: lldp link not as expected: %v\n", l )
+		t.Fail()
+	}
+}
+
+func Test_drain( t *testing.T ) {
+	now := time.Now().Unix()
+
+	bad := [][]string {
+		{ "fan", "sw1", "pct" },						// bad kind
+		{ "link", "sw1", "link target without second switch" },
+		{ "switch", "sw1", "pct out of range" },
+		{ "switch", "sw1", "window passed" },
+	}
+	pcts := []int { 50, 50, 101, 50 }
+	for i, b := range bad {
+		conclude := now + 3600
+		if i == 3 {
+			conclude = now - 10
+		}
+		if _, err := gizmos.Mk_drain( "d1", b[0], b[1], now, conclude, pcts[i] ); err == nil {
+			fmt.Fprintf( os.Stderr, "FAIL: bad drain accepted: %s\n", b[2] )
+			t.Fail()
+		}
+	}
+
+	d, err := gizmos.Mk_drain( "d1", gizmos.DRAIN_LINK, "sw1,sw2", now, now + 3600, 50 )
+	if err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: valid drain rejected: %s\n", err )
+		t.Fail()
+		return
+	}
+	if ! d.Covers_link( "sw2", "sw1" ) || ! d.Covers_link( "sw1@eth0", "sw2" ) || d.Covers_link( "sw1", "sw3" ) || d.Covers_switch( "sw1" ) {
+		fmt.Fprintf( os.Stderr, "FAIL: link drain coverage not as expected\n" )
+		t.Fail()
+	}
+
+	d2, err := gizmos.Chkpt2drain( d.To_chkpt() )
+	if err != nil || *d2 != *d {
+		fmt.Fprintf( os.Stderr, "FAIL: drain did not round trip through checkpoint: %v %v\n", d2, err )
+		t.Fail()
+	}
+
+	d, _ = gizmos.Mk_drain( "d2", gizmos.DRAIN_HOST, "h1", now + 60, now + 3600, 100 )
+	if d == nil || ! d.Covers_switch( "h1" ) || ! d.Covers_link( "h1@eth1", "sw1" ) || d.Covers_link( "sw1", "sw2" ) {
+		fmt.Fprintf( os.Stderr, "FAIL: host drain coverage not as expected\n" )
+		t.Fail()
+	}
+	if d != nil && (! d.Overlaps( now, now + 120 ) || d.Overlaps( now, now + 30 )) {
+		fmt.Fprintf( os.Stderr, "FAIL: drain window overlap not as expected\n" )
+		t.Fail()
+	}
+}
+
+func Test_graph_export( t *testing.T ) {
+	g := gizmos.Mk_graph_export( 100 )
+	g.Add_node( "sw1", gizmos.GX_SWITCH, "dc1", map[string]string{ "role": "tor" } )
+	g.Add_node( "h1", gizmos.GX_HOST, "dc1", nil )
+	g.Add_edge( "h1@sw1", gizmos.GX_ATTACH, "h1", "sw1", 0, 0, "", false )
+	g.Add_edge( "sw1-sw2", gizmos.GX_LINK, "sw1", "sw2", 900, 1000, "m1", false )
+	g.Add_edge( "sw2-sw1", gizmos.GX_LINK, "sw2", "sw1", 100, 1000, "m1", false )
+	if n := g.Highlight( "res1", map[string]bool{ "sw1-sw2": true } ); n != 1 {
+		fmt.Fprintf( os.Stderr, "FAIL: expected 1 highlighted edge, got %d\n", n )
+		t.Fail()
+	}
+
+	jstr, err := g.Render( gizmos.GX_D3 )
+	var jif map[string]interface{}
+	if err != nil || json.Unmarshal( []byte( jstr ), &jif ) != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: d3 export is not valid json: %s %v\n", jstr, err )
+		t.Fail()
+	} else {
+		if nodes := jif["nodes"].( []interface{} ); len( nodes ) != 3 {				// sw2 added by the edge
+			fmt.Fprintf( os.Stderr, "FAIL: expected 3 nodes in d3 export, got %d\n", len( nodes ) )
+			t.Fail()
+		}
+		if !strings.Contains( jstr, `"util": 90` ) || !strings.Contains( jstr, `"links": [ "sw1-sw2", "sw2-sw1" ]` ) {
+			fmt.Fprintf( os.Stderr, "FAIL: d3 export missing utilisation or mlag group: %s\n", jstr )
+			t.Fail()
+		}
+	}
+
+	xstr, _ := g.Render( gizmos.GX_GRAPHML )
+	d := xml.NewDecoder( strings.NewReader( xstr ) )
+	for {
+		if _, err = d.Token(); err != nil {
+			break
+		}
+	}
+	if err != io.EOF {
+		fmt.Fprintf( os.Stderr, "FAIL: graphml export is not valid xml: %s\n", err )
+		t.Fail()
+	}
+
+	dstr, _ := g.Render( gizmos.GX_DOT )
+	if !strings.HasPrefix( dstr, "digraph" ) || !strings.Contains( dstr, `"sw1" -> "sw2" [id="sw1-sw2", kind=link, color=red` ) || !strings.Contains( dstr, "penwidth=3" ) {
+		fmt.Fprintf( os.Stderr, "FAIL: dot export not as expected: %s\n", dstr )
+		t.Fail()
+	}
+
+	if _, err = g.Render( "png" ); err == nil {
+		fmt.Fprintf( os.Stderr, "FAIL: unknown graph format accepted\n" )
+		t.Fail()
+	}
+}
@@ -25,6 +25,8 @@
 	Date:		10 June 2014
 	Author:		E. Scott Daniels
 
+	Mods:		19 Oct 2026 - Added split share test.
+				19 Oct 2026 - Added constraint parsing and constrained path tests.
 */
 
 package gizmos_test
@@ -38,8 +40,8 @@ import (
 	//"html"
 	//"net/http"
 	"os"
-	//"strings"
-	//"time"
+	"strings"
+	"time"
 	"testing"
 
 	"github.com/att/tegu/gizmos"
@@ -124,3 +126,142 @@ func TestNet( t *testing.T ) {			// must use bloody camel case to be recognised
 	fsw.All_paths_to( &last, 0, 0, 100, &usrname, 95 )
 }
 
+/*
+	Bandwidth split across paths is proportional to what each has available, and no share
+	exceeds what its path can carry.
+*/
+func Test_split_shares( t *testing.T ) {
+	shares, err := gizmos.Split_shares( 1000, []int64{ 300, 0, 1200 } )
+	if err != nil || shares[0] != 200 || shares[1] != 0 || shares[2] != 800 {
+		fmt.Fprintf( os.Stderr, "FAIL: shares not as expected: %v %v\n", shares, err )
+		t.Fail()
+	}
+
+	shares, err = gizmos.Split_shares( 1000, []int64{ 333, 333, 334 } )
+	if err != nil || shares[0] + shares[1] + shares[2] != 1000 || shares[0] > 333 || shares[1] > 333 {
+		fmt.Fprintf( os.Stderr, "FAIL: shares with remainder not as expected: %v %v\n", shares, err )
+		t.Fail()
+	}
+
+	if _, err = gizmos.Split_shares( 1000, []int64{ 400, 500 } ); err == nil {
+		fmt.Fprintf( os.Stderr, "FAIL: split larger than available accepted\n" )
+		t.Fail()
+	}
+}
+
+
+/*
+	Path constraints parse, and render back to the same form.
+*/
+func Test_path_constraints( t *testing.T ) {
+	pc, err := gizmos.Mk_path_constraints( "maxhops=3 maxlatency=2ms avoid=sw1,sw2 avoidsrlg=conduit-a" )
+	if err != nil || pc.Max_hops != 3 || pc.Max_latency != 2000 || len( pc.Avoid_sw ) != 2 || len( pc.Avoid_srlg ) != 1 {
+		fmt.Fprintf( os.Stderr, "FAIL: constraints not parsed as expected: %v %v\n", pc, err )
+		t.Fail()
+		return
+	}
+
+	if s := pc.String(); s != "maxhops=3 maxlatency=2000us avoid=sw1,sw2 avoidsrlg=conduit-a" {
+		fmt.Fprintf( os.Stderr, "FAIL: constraint string not as expected: %s\n", s )
+		t.Fail()
+	}
+
+	if pc, _ = gizmos.Mk_path_constraints( "" ); ! pc.Is_empty() {
+		fmt.Fprintf( os.Stderr, "FAIL: empty constraints not empty\n" )
+		t.Fail()
+	}
+	for _, bad := range []string{ "maxhops=x", "maxlatency=10ps", "colour=red", "avoid" } {
+		if _, err = gizmos.Mk_path_constraints( bad ); err == nil {
+			fmt.Fprintf( os.Stderr, "FAIL: bad constraint accepted: %s\n", bad )
+			t.Fail()
+		}
+	}
+}
+
+/*
+	Add links in both directions between two switches with the given attributes.
+*/
+func cp_link( s1 *gizmos.Switch, s2 *gizmos.Switch, cost int, latency int64, srlg ...string ) ( *gizmos.Link ) {
+	l := gizmos.Mk_link( s1.Get_id(), s2.Get_id(), 100000000, 95, nil )
+	l.Set_forward( s2 )
+	l.Set_backward( s1 )
+	l.Set_attrs( cost, latency, srlg, false )
+	s1.Add_link( l )
+
+	rl := gizmos.Mk_link( s2.Get_id(), s1.Get_id(), 100000000, 95, nil, l )
+	rl.Set_forward( s1 )
+	rl.Set_backward( s2 )
+	rl.Set_attrs( cost, latency, srlg, false )
+	s2.Add_link( rl )
+
+	return l
+}
+
+/*
+	Run the constrained search from a to the host on d, for the hour starting now, and return
+	the switches on the path (a first) or the error.
+*/
+func cp_search( a *gizmos.Switch, target string, spec string ) ( string, error ) {
+	pc, _ := gizmos.Mk_path_constraints( spec )
+	usr := "username"
+	now := time.Now().Unix()
+	tsw, _, err := a.Cpath_to( &target, now, now + 3600, 100, &usr, 95, pc )
+	if err != nil {
+		return "", err
+	}
+
+	path := ""
+	for sw := tsw; sw != nil; sw = sw.Prev {
+		path = *sw.Get_id() + " " + path
+	}
+	return strings.TrimSpace( path ), nil
+}
+
+/*
+	The lowest cost path is chosen unless it violates a constraint; when nothing satisfies the
+	constraints the error gives the reason.
+		a --- b --- d		cost 1, latency 5ms each; a-b in srlg conduit
+		a --- c --- e --- d	cost 1, latency 100us each
+*/
+func Test_constrained_path( t *testing.T ) {
+	sw := make( map[string]*gizmos.Switch )
+	for _, id := range []string{ "a", "b", "c", "d", "e" } {
+		name := id
+		sw[id] = gizmos.Mk_switch( &name )
+	}
+	ab := cp_link( sw["a"], sw["b"], 1, 5000, "conduit" )
+	cp_link( sw["b"], sw["d"], 1, 5000 )
+	cp_link( sw["a"], sw["c"], 1, 100 )
+	cp_link( sw["c"], sw["e"], 1, 100 )
+	cp_link( sw["e"], sw["d"], 1, 100 )
+
+	target := "10.0.0.9"
+	vm := "vm9"
+	sw["d"].Add_host( &target, &vm, 9 )
+
+	tests := []struct { spec string; expect string; reason string } {
+		{ "", "a b d", "" },
+		{ "maxlatency=1ms", "a c e d", "" },
+		{ "avoidsrlg=conduit", "a c e d", "" },
+		{ "avoid=b maxhops=3", "a c e d", "" },
+		{ "maxhops=2 maxlatency=1ms", "", "max hops" },
+		{ "avoid=c avoidsrlg=conduit", "", "avoided srlg" },
+	}
+	for _, tc := range tests {
+		path, err := cp_search( sw["a"], target, tc.spec )
+		if tc.reason == "" && (err != nil || path != tc.expect) {
+			fmt.Fprintf( os.Stderr, "FAIL: constraints %q: expected path %q got %q err=%v\n", tc.spec, tc.expect, path, err )
+			t.Fail()
+		}
+		if tc.reason != "" && (err == nil || ! strings.Contains( err.Error(), tc.reason )) {
+			fmt.Fprintf( os.Stderr, "FAIL: constraints %q: expected failure with %q got path %q err=%v\n", tc.spec, tc.reason, path, err )
+			t.Fail()
+		}
+	}
+
+	ab.Set_attrs( 1, 5000, []string{ "conduit" }, true )			// administratively excluded links are never used
+	if path, err := cp_search( sw["a"], target, "" ); err != nil || path != "a c e d" {
+		fmt.Fprintf( os.Stderr, "FAIL: excluded link used: %q err=%v\n", path, err )
+		t.Fail()
+	}
+}
@@ -0,0 +1,414 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	graph_export
+	Abstract:	A snapshot of the network graph which can be rendered in formats understood
+				by other tools: Graphviz DOT, GraphML, and a node/edge json list which is
+				easily consumed by D3 (force layouts and the like). Each link edge carries
+				the capacity allocated at the snapshot time and the link's maximum capacity
+				so that utilisation (heat) can be shown. Edges may be highlighted (e.g. the
+				paths of a reservation).
+
+				Nodes are switches and hosts; edges are links between switches (one per
+				direction), virtual links (between ports on the same switch) and the
+				attachment of hosts to switches. The network manager builds the snapshot;
+				nothing here references the live graph.
+
+	Date:		19 Oct 2026
+*/
+
+package gizmos
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	GX_DOT		string = "dot"
+	GX_GRAPHML	string = "graphml"
+	GX_D3		string = "d3"
+
+	GX_SWITCH	string = "switch"			// node kinds
+	GX_HOST		string = "host"
+
+	GX_LINK		string = "link"				// edge kinds
+	GX_VLINK	string = "vlink"
+	GX_ATTACH	string = "attach"
+)
+
+type gx_node struct {
+	id		string
+	kind	string
+	site	string
+	attrs	map[string]string
+}
+
+type gx_edge struct {
+	id			string
+	kind		string
+	src			string
+	dst			string
+	alloc		int64				// allocated at the snapshot time
+	max			int64				// max capacity
+	mlag		string
+	excluded	bool
+	hl			bool				// highlighted
+}
+
+type Graph_export struct {
+	ts		int64					// the time the allocations are taken from
+	hlname	string					// name of the highlighted reservation if any
+	nodes	map[string]*gx_node
+	edges	[]*gx_edge
+}
+
+/*
+	Returns true if the format is one which can be generated.
+*/
+func Is_graph_format( f string ) ( bool ) {
+	return f == GX_DOT || f == GX_GRAPHML || f == GX_D3
+}
+
+/*
+	Constructor. Ts is the timestamp that allocations added were taken from.
+*/
+func Mk_graph_export( ts int64 ) ( *Graph_export ) {
+	return &Graph_export{
+		ts:		ts,
+		nodes:	make( map[string]*gx_node ),
+		edges:	make( []*gx_edge, 0, 128 ),
+	}
+}
+
+/*
+	Add a node. If the node already exists, the site and attributes are updated
+	when supplied.
+*/
+func (g *Graph_export) Add_node( id string, kind string, site string, attrs map[string]string ) {
+	if nd := g.nodes[id]; nd != nil {
+		if site != "" {
+			nd.site = site
+		}
+		if attrs != nil {
+			nd.attrs = attrs
+		}
+		return
+	}
+
+	g.nodes[id] = &gx_node{ id: id, kind: kind, site: site, attrs: attrs }
+}
+
+/*
+	Add an edge. Nodes for the endpoints are created (as switches) if they don't exist.
+*/
+func (g *Graph_export) Add_edge( id string, kind string, src string, dst string, alloc int64, max int64, mlag string, excluded bool ) {
+	if g.nodes[src] == nil {
+		g.Add_node( src, GX_SWITCH, "", nil )
+	}
+	if g.nodes[dst] == nil {
+		g.Add_node( dst, GX_SWITCH, "", nil )
+	}
+
+	g.edges = append( g.edges, &gx_edge{ id: id, kind: kind, src: src, dst: dst, alloc: alloc, max: max, mlag: mlag, excluded: excluded } )
+}
+
+/*
+	Highlight the edges whose ids are in the map; name is the reservation (or other
+	thing) that the highlighting represents. Returns the number of edges highlighted.
+*/
+func (g *Graph_export) Highlight( name string, ids map[string]bool ) ( n int ) {
+	g.hlname = name
+	for _, e := range g.edges {
+		if ids[e.id] {
+			e.hl = true
+			n++
+		}
+	}
+
+	return
+}
+
+/*
+	Render in the given format.
+*/
+func (g *Graph_export) Render( format string ) ( string, error ) {
+	switch format {
+		case GX_DOT:
+			return g.To_dot(), nil
+
+		case GX_GRAPHML:
+			return g.To_graphml(), nil
+
+		case GX_D3:
+			return g.To_d3(), nil
+	}
+
+	return "", fmt.Errorf( "unknown graph format: %s; must be one of: dot, graphml, d3", format )
+}
+
+// ---------------------------------------------------------------------------------------
+
+/*
+	Percentage of the edge's capacity allocated.
+*/
+func (e *gx_edge) util( ) ( int ) {
+	if e.max <= 0 {
+		return 0
+	}
+	return int( (e.alloc * 100) / e.max )
+}
+
+/*
+	Heat colour for the edge.
+*/
+func (e *gx_edge) colour( ) ( string ) {
+	switch {
+		case e.kind == GX_ATTACH:
+			return "grey"
+
+		case e.excluded:
+			return "lightgrey"
+
+		case e.util() >= 80:
+			return "red"
+
+		case e.util() >= 50:
+			return "orange"
+	}
+
+	return "green"
+}
+
+/*
+	Returns the node ids sorted so that output is stable.
+*/
+func (g *Graph_export) node_ids( ) ( ids []string ) {
+	ids = make( []string, 0, len( g.nodes ) )
+	for id := range g.nodes {
+		ids = append( ids, id )
+	}
+	sort.Strings( ids )
+	return
+}
+
+/*
+	Returns the mlag groups and the ids of their member links, sorted by name.
+*/
+func (g *Graph_export) mlags( ) ( names []string, members map[string][]string ) {
+	members = make( map[string][]string )
+	for _, e := range g.edges {
+		if e.mlag != "" {
+			members[e.mlag] = append( members[e.mlag], e.id )
+		}
+	}
+
+	names = make( []string, 0, len( members ) )
+	for name := range members {
+		names = append( names, name )
+	}
+	sort.Strings( names )
+	return
+}
+
+/*
+	Escape a string for xml.
+*/
+func xml_esc( s string ) ( string ) {
+	return strings.NewReplacer( "&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&apos;" ).Replace( s )
+}
+
+/*
+	Graphviz DOT. Nodes are grouped into a cluster per site; mlag groups are noted as an
+	edge label. Edge colour gives the heat, and highlighted edges are drawn bold and blue.
+*/
+func (g *Graph_export) To_dot( ) ( string ) {
+	sb := []string{ fmt.Sprintf( "digraph tegu {\n\tlabel=%q;\n\tnode [shape=box];", fmt.Sprintf( "tegu network at %d", g.ts ) ) }
+
+	sites := make( map[string][]string )
+	for _, id := range g.node_ids() {
+		nd := g.nodes[id]
+		shape := "box"
+		if nd.kind == GX_HOST {
+			shape = "ellipse"
+		}
+		line := fmt.Sprintf( "%q [shape=%s", id, shape )
+		if nd.site != "" {
+			line += fmt.Sprintf( ", site=%q", nd.site )
+		}
+		akeys := make( []string, 0, len( nd.attrs ) )
+		for k := range nd.attrs {
+			akeys = append( akeys, k )
+		}
+		sort.Strings( akeys )
+		for _, k := range akeys {
+			line += fmt.Sprintf( ", %q=%q", k, nd.attrs[k] )
+		}
+		line += "];"
+
+		sites[nd.site] = append( sites[nd.site], line )
+	}
+
+	snames := make( []string, 0, len( sites ) )
+	for s := range sites {
+		snames = append( snames, s )
+	}
+	sort.Strings( snames )
+	for i, s := range snames {
+		if s == "" {
+			for _, l := range sites[s] {
+				sb = append( sb, "\t" + l )
+			}
+		} else {
+			sb = append( sb, fmt.Sprintf( "\tsubgraph cluster_%d {\n\t\tlabel=%q;", i, s ) )
+			for _, l := range sites[s] {
+				sb = append( sb, "\t\t" + l )
+			}
+			sb = append( sb, "\t}" )
+		}
+	}
+
+	for _, e := range g.edges {
+		line := fmt.Sprintf( "\t%q -> %q [id=%q, kind=%s, color=%s", e.src, e.dst, e.id, e.kind, e.colour() )
+		if e.kind != GX_ATTACH {
+			line += fmt.Sprintf( ", alloc=%d, max=%d, label=\"%d%%\"", e.alloc, e.max, e.util() )
+		}
+		if e.mlag != "" {
+			line += fmt.Sprintf( ", mlag=%q", e.mlag )
+		}
+		if e.excluded {
+			line += ", style=dashed"
+		}
+		if e.hl {
+			line += ", penwidth=3, fontcolor=blue, color=blue"
+		}
+		sb = append( sb, line + "];" )
+	}
+
+	sb = append( sb, "}\n" )
+	return strings.Join( sb, "\n" )
+}
+
+/*
+	GraphML. Node and edge data use keys declared in the header; mlag groups are given
+	as edge data.
+*/
+func (g *Graph_export) To_graphml( ) ( string ) {
+	sb := []string{
+		`<?xml version="1.0" encoding="UTF-8"?>`,
+		`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">`,
+		`<key id="kind" for="all" attr.name="kind" attr.type="string"/>`,
+		`<key id="site" for="node" attr.name="site" attr.type="string"/>`,
+		`<key id="attrs" for="node" attr.name="attrs" attr.type="string"/>`,
+		`<key id="alloc" for="edge" attr.name="alloc" attr.type="long"/>`,
+		`<key id="max" for="edge" attr.name="max" attr.type="long"/>`,
+		`<key id="util" for="edge" attr.name="util" attr.type="int"/>`,
+		`<key id="mlag" for="edge" attr.name="mlag" attr.type="string"/>`,
+		`<key id="excluded" for="edge" attr.name="excluded" attr.type="boolean"/>`,
+		`<key id="highlight" for="edge" attr.name="highlight" attr.type="boolean"/>`,
+		fmt.Sprintf( `<graph id="tegu" edgedefault="directed" tegu.timestamp="%d">`, g.ts ),
+	}
+
+	for _, id := range g.node_ids() {
+		nd := g.nodes[id]
+		sb = append( sb, fmt.Sprintf( `<node id="%s"><data key="kind">%s</data>`, xml_esc( id ), nd.kind ) )
+		if nd.site != "" {
+			sb = append( sb, fmt.Sprintf( `<data key="site">%s</data>`, xml_esc( nd.site ) ) )
+		}
+		if len( nd.attrs ) > 0 {
+			akeys := make( []string, 0, len( nd.attrs ) )
+			for k := range nd.attrs {
+				akeys = append( akeys, k )
+			}
+			sort.Strings( akeys )
+			for i, k := range akeys {
+				akeys[i] = k + "=" + nd.attrs[k]
+			}
+			sb = append( sb, fmt.Sprintf( `<data key="attrs">%s</data>`, xml_esc( strings.Join( akeys, "," ) ) ) )
+		}
+		sb = append( sb, `</node>` )
+	}
+
+	for _, e := range g.edges {
+		sb = append( sb, fmt.Sprintf( `<edge id="%s" source="%s" target="%s"><data key="kind">%s</data>`, xml_esc( e.id ), xml_esc( e.src ), xml_esc( e.dst ), e.kind ) )
+		if e.kind != GX_ATTACH {
+			sb = append( sb, fmt.Sprintf( `<data key="alloc">%d</data><data key="max">%d</data><data key="util">%d</data>`, e.alloc, e.max, e.util() ) )
+		}
+		if e.mlag != "" {
+			sb = append( sb, fmt.Sprintf( `<data key="mlag">%s</data>`, xml_esc( e.mlag ) ) )
+		}
+		sb = append( sb, fmt.Sprintf( `<data key="excluded">%v</data><data key="highlight">%v</data></edge>`, e.excluded, e.hl ) )
+	}
+
+	sb = append( sb, `</graph>`, "</graphml>\n" )
+	return strings.Join( sb, "\n" )
+}
+
+/*
+	Json with a list of nodes and a list of edges (source/target are node ids), plus the
+	mlag groups and the highlighted reservation.
+*/
+func (g *Graph_export) To_d3( ) ( string ) {
+	jstr := fmt.Sprintf( `{ "timestamp": %d, "nodes": [ `, g.ts )
+	sep := ""
+	for _, id := range g.node_ids() {
+		nd := g.nodes[id]
+		jstr += fmt.Sprintf( `%s{ "id": %q, "kind": %q`, sep, id, nd.kind )
+		if nd.site != "" {
+			jstr += fmt.Sprintf( `, "site": %q`, nd.site )
+		}
+		if len( nd.attrs ) > 0 {
+			asep := ""
+			jstr += `, "attrs": { `
+			for k, v := range nd.attrs {
+				jstr += fmt.Sprintf( `%s%q: %q`, asep, k, v )
+				asep = ", "
+			}
+			jstr += " }"
+		}
+		jstr += " }"
+		sep = ", "
+	}
+
+	jstr += ` ], "links": [ `
+	sep = ""
+	for _, e := range g.edges {
+		jstr += fmt.Sprintf( `%s{ "id": %q, "kind": %q, "source": %q, "target": %q, "alloc": %d, "max": %d, "util": %d, "mlag": %q, "excluded": %v, "highlight": %v }`,
+			sep, e.id, e.kind, e.src, e.dst, e.alloc, e.max, e.util(), e.mlag, e.excluded, e.hl )
+		sep = ", "
+	}
+
+	jstr += ` ], "mlags": [ `
+	sep = ""
+	names, members := g.mlags()
+	for _, name := range names {
+		jstr += fmt.Sprintf( `%s{ "name": %q, "links": [ "%s" ] }`, sep, name, strings.Join( members[name], `", "` ) )
+		sep = ", "
+	}
+	jstr += " ]"
+
+	if g.hlname != "" {
+		jstr += fmt.Sprintf( `, "highlight": %q`, g.hlname )
+	}
+
+	jstr += " }"
+	return jstr
+}
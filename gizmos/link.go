@@ -58,6 +58,10 @@
 				05 Sep 2014 - Pick up late binding port info if port is <0 rather than 0.
 				19 Oct 2014 - Comment change
 				18 Jun 2015 - Added nil pointer check.
+				19 Oct 2026 - Added Set_queue_limits.
+				19 Oct 2026 - Added Get_available and link exclusion for finding split paths.
+				19 Oct 2026 - Added Get_forward_qport.
+				19 Oct 2026 - Added latency, srlg and administrative exclusion attributes.
 */
 
 package gizmos
@@ -88,6 +92,10 @@ type Link struct {
 	sw2			*string				// human name for backward switch
 	mlag		*string				// mlag group this link belongs to
 	allotment	*Obligation			// the obligation that exsists for the link (obligations are timesliced)
+	excluded	bool				// when set the link reports no capacity (split path finding)
+	admin_excl	bool				// administratively excluded (static topology); never used for a path
+	latency		int64				// latency of the link (microseconds)
+	srlg		[]string			// shared risk link groups (failure domains) the link belongs to
 
 	Cost		int					// the cost of traversing the link for shortest path computation
 }
@@ -329,6 +337,11 @@ func (l *Link) Has_capacity( commence int64, conclude int64, amt int64, usr *str
 	}
 
 	able = false
+	if l.excluded {
+		err = fmt.Errorf( "link %s is excluded", *l.id )
+		return
+	}
+
 	if usr_max < 101 {
 		if amt > (l.allotment.Get_max_capacity() * int64( usr_max ))/100 {
 			obj_sheep.Baa( 1, "no capacity on link %s: %d is more than user allowed pctg (%d%%) of link capacity %d", *l.id, amt, usr_max, l.allotment.Get_max_capacity()  )
@@ -351,6 +364,101 @@ func (l *Link) Has_capacity( commence int64, conclude int64, amt int64, usr *str
 	return
 }
 
+/*
+	Return the amount that could still be reserved on the link across the window, limited
+	by the user max (a percentage of the link capacity if less than 101, a hard value
+	otherwise).
+*/
+func (l *Link) Get_available( commence int64, conclude int64, usr_max int64 ) ( avail int64 ) {
+	if l == nil {
+		return 0
+	}
+
+	avail = l.allotment.Get_available( commence, conclude )
+	umax := usr_max
+	if usr_max < 101 {
+		umax = (l.allotment.Get_max_capacity() * usr_max)/100
+	}
+	if umax < avail {
+		avail = umax
+	}
+
+	return
+}
+
+/*
+	Set the link's exclusion state. An excluded link reports that it has no capacity and thus
+	is not followed by the path finding functions. Used to find paths that do not share links.
+*/
+func (l *Link) Set_excluded( state bool ) {
+	if l != nil {
+		l.excluded = state
+	}
+}
+
+/*
+	Returns true if the link is currently excluded (see Set_excluded).
+*/
+func (l *Link) Is_excluded( ) ( bool ) {
+	return l != nil && l.excluded
+}
+
+/*
+	Set the attributes which are supplied by the static topology: the cost used by the
+	shortest path computation (values less than 1 are set to 1), the latency (microseconds),
+	the list of shared risk groups that the link belongs to, and the administrative exclusion
+	state. An administratively excluded link is never selected for a path.
+*/
+func (l *Link) Set_attrs( cost int, latency int64, srlg []string, excl bool ) {
+	if l == nil {
+		return
+	}
+
+	if cost < 1 {
+		cost = 1
+	}
+	if latency < 0 {
+		latency = 0
+	}
+	l.Cost = cost
+	l.latency = latency
+	l.srlg = srlg
+	l.admin_excl = excl
+}
+
+/*
+	Returns the latency (microseconds) of the link.
+*/
+func (l *Link) Get_latency( ) ( int64 ) {
+	if l == nil {
+		return 0
+	}
+	return l.latency
+}
+
+/*
+	Returns true if the link is a member of the named shared risk group.
+*/
+func (l *Link) In_srlg( name string ) ( bool ) {
+	if l == nil {
+		return false
+	}
+
+	for _, g := range l.srlg {
+		if g == name {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	Returns true if the link has been administratively excluded.
+*/
+func (l *Link) Is_admin_excluded( ) ( bool ) {
+	return l != nil && l.admin_excl
+}
+
 /*
 	The new link capacity is set to the value passed in.
 	The capacity is the maximum bandwidth that the link can support. If the link's allotment is
@@ -438,11 +546,7 @@ func (l *Link) Set_forward_queue( qid *string, commence int64, conclude int64, a
 		return
 	}
 		
-	if l.port1 <= 0 && l.lbport != nil {
-		swdata = fmt.Sprintf( "%s/%s", *l.sw1, *l.lbport )			// if port is 0 then we'll return the latebinding port value
-	} else {
-		swdata = fmt.Sprintf( "%s/%d", *l.sw1, l.port1 )			// switch and port data that will be necessary to physically set the queue
-	}
+	swdata = l.Get_forward_qport( )									// switch and port data that will be necessary to physically set the queue
 
 	err, msg := l.allotment.Add_queue( qid, &swdata, amt, commence, conclude, usr )
 	if msg != nil {													// warning message that we must presernt
@@ -452,6 +556,22 @@ func (l *Link) Set_forward_queue( qid *string, commence int64, conclude int64, a
 	return
 }
 
+/*
+	Return the switch/port string that Set_forward_queue records for a queue on the link
+	(and so the string the queue list carries). The late binding port replaces the port when
+	the port is not known (0 or less).
+*/
+func (l *Link) Get_forward_qport( ) ( string ) {
+	if l == nil {
+		return ""
+	}
+
+	if l.port1 <= 0 && l.lbport != nil {
+		return fmt.Sprintf( "%s/%s", *l.sw1, *l.lbport )
+	}
+	return fmt.Sprintf( "%s/%d", *l.sw1, l.port1 )
+}
+
 /*
 	Create a new queue in our obilgation that sets the queue/port in the queue based on
 	sw2 sending data in a backwards direction (toward sw1 which is the backward switch).
@@ -473,6 +593,18 @@ func (l *Link) Set_backward_queue( qid *string, commence int64, conclude int64,
 	return err
 }
 
+/*
+	Adjust the headroom (ceiling above the guaranteed amount) and burst of a queue previously
+	set with Set_forward_queue or Set_backward_queue. Burst is left unchanged if negative.
+*/
+func (l *Link) Set_queue_limits( qid *string, commence int64, conclude int64, delta int64, burst int64 ) {
+	if l == nil || qid == nil {
+		return
+	}
+
+	l.allotment.Set_queue_limits( qid, commence, conclude, delta, burst )
+}
+
 /*
 	Add an amount to the indicated queue if the obligation has room for it.  True returned if the amount could
 	be aded, and was, false otherwise.
@@ -586,6 +718,11 @@ func (l *Link) To_json( ) ( s string ) {
 		mlag = *l.mlag
 	}
 
-	s = fmt.Sprintf( `{ "id": %q, "sw1": %q, "sw1port": %d, "sw2": %q,  "sw2port": %d, "allotment": %s, "mlag": %q }`, *l.id, *l.sw1, l.port1, *l.sw2,  l.port2, l.allotment.To_json(), mlag )
+	srlg := ""
+	if len( l.srlg ) > 0 {
+		srlg = fmt.Sprintf( `, "srlg": [ "%s" ]`, strings.Join( l.srlg, `", "` ) )
+	}
+
+	s = fmt.Sprintf( `{ "id": %q, "sw1": %q, "sw1port": %d, "sw2": %q,  "sw2port": %d, "allotment": %s, "mlag": %q, "cost": %d, "latency": %d, "excluded": %v%s }`, *l.id, *l.sw1, l.port1, *l.sw2,  l.port2, l.allotment.To_json(), mlag, l.Cost, l.latency, l.admin_excl, srlg )
 	return
 }
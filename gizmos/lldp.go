@@ -0,0 +1,186 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	lldp
+	Abstract:	Support for topology discovery using LLDP neighbour information collected by the
+				agent on each physical host. The agent runs lldpctl (key/value output) and reads
+				the speed of the local interfaces; Lldp_parse converts that output into a list of
+				neighbours which are passed back to tegu one per record:
+					<host> <interface> <neighbour-chassis> <neighbour-port> <speed-bps>
+
+				Each neighbour can be converted to a floodlight style link between the neighbour
+				(the ToR switch) and host@interface, so that the network graph can be built from,
+				or merged with, what was discovered.
+
+	Date:		19 Oct 2026
+*/
+
+package gizmos
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type Lldp_neighbour struct {
+	Host	string		// reporting host
+	Iface	string		// local interface the neighbour was seen on
+	Chassis	string		// neighbour system name (chassis id if the name isn't advertised)
+	Port	string		// neighbour's port (ifname, else id)
+	Speed	int64		// speed of the local interface (bits/sec); 0 if not known
+}
+
+/*
+	Tokens in the records are blank separated so blanks in names are replaced.
+*/
+func lldp_tok( s string ) ( string ) {
+	s = strings.TrimSpace( s )
+	if s == "" {
+		return "unknown"
+	}
+	return strings.Replace( s, " ", "_", -1 )
+}
+
+/*
+	Split the part of an lldpctl key following lldp. into the interface and the field. Interface
+	names may contain dots (e.g. vlan interfaces, eth0.100) so the interface is everything before
+	the chassis or port field; other fields are not used and an empty interface is returned.
+*/
+func lldp_key( key string ) ( iface string, field string ) {
+	i := -1
+	for _, f := range []string{ ".chassis.", ".port." } {
+		if j := strings.Index( key, f ); j > 0 && (i < 0 || j < i) {
+			i = j
+		}
+	}
+	if i < 0 {
+		return "", ""
+	}
+
+	return key[0:i], key[i+1:]
+}
+
+/*
+	Parse the output from `lldpctl -f keyvalue` (lines of the form lldp.<iface>.<field>=<value>)
+	along with lines of the form speed.<iface>=<mbps> (as read from /sys/class/net/<iface>/speed)
+	collected from the host. Only the chassis and port fields are used. Returns one neighbour per
+	interface on which a neighbour was seen, sorted by interface.
+*/
+func Lldp_parse( host string, lines []string ) ( nbrs []*Lldp_neighbour ) {
+	fields := make( map[string]map[string]string )
+	speeds := make( map[string]int64 )
+
+	for _, line := range lines {
+		kv := strings.SplitN( strings.TrimSpace( line ), "=", 2 )
+		if len( kv ) != 2 {
+			continue
+		}
+
+		switch {
+			case strings.HasPrefix( kv[0], "speed." ):
+				if mbps, err := strconv.ParseInt( strings.TrimSpace( kv[1] ), 10, 64 ); err == nil && mbps > 0 {
+					speeds[kv[0][6:]] = mbps * 1000000
+				}
+
+			case strings.HasPrefix( kv[0], "lldp." ):
+				if iface, field := lldp_key( kv[0][5:] ); iface != "" {
+					if fields[iface] == nil {
+						fields[iface] = make( map[string]string )
+					}
+					fields[iface][field] = kv[1]
+				}
+		}
+	}
+
+	ifaces := make( []string, 0, len( fields ) )
+	for iface := range fields {
+		ifaces = append( ifaces, iface )
+	}
+	sort.Strings( ifaces )
+
+	nbrs = make( []*Lldp_neighbour, 0, len( ifaces ) )
+	for _, iface := range ifaces {
+		f := fields[iface]
+		chassis := f["chassis.name"]
+		if chassis == "" {
+			chassis = f["chassis.id"]
+			if chassis == "" {
+				chassis = f["chassis.mac"]
+			}
+		}
+		if chassis == "" {
+			continue							// nothing that identifies the neighbour
+		}
+
+		port := f["port.ifname"]
+		if port == "" {
+			port = f["port.id"]
+			if port == "" {
+				port = f["port.descr"]
+			}
+		}
+
+		nbrs = append( nbrs, &Lldp_neighbour{ Host: lldp_tok( host ), Iface: lldp_tok( iface ), Chassis: lldp_tok( chassis ), Port: lldp_tok( port ), Speed: speeds[iface] } )
+	}
+
+	return
+}
+
+/*
+	Build a neighbour from a record generated by String().
+*/
+func Mk_lldp_neighbour( rec string ) ( nb *Lldp_neighbour, err error ) {
+	toks := strings.Fields( rec )
+	if len( toks ) != 5 {
+		return nil, fmt.Errorf( "lldp record has %d tokens, expected 5: %s", len( toks ), rec )
+	}
+
+	speed, err := strconv.ParseInt( toks[4], 10, 64 )
+	if err != nil || speed < 0 {
+		return nil, fmt.Errorf( "lldp record has an invalid speed: %s", rec )
+	}
+
+	return &Lldp_neighbour{ Host: toks[0], Iface: toks[1], Chassis: toks[2], Port: toks[3], Speed: speed }, nil
+}
+
+func (nb *Lldp_neighbour) String( ) ( string ) {
+	if nb == nil {
+		return ""
+	}
+	return fmt.Sprintf( "%s %s %s %s %d", nb.Host, nb.Iface, nb.Chassis, nb.Port, nb.Speed )
+}
+
+/*
+	Returns the neighbour as a bidirectional floodlight style link between the neighbour and
+	host@interface. Ports are bound late.
+*/
+func (nb *Lldp_neighbour) Fl_link( ) ( FL_link_json ) {
+	return FL_link_json {
+		Src_switch:	nb.Chassis,
+		Src_port:	LATE_BIND_PORT,
+		Dst_switch:	nb.Host + "@" + nb.Iface,
+		Dst_port:	LATE_BIND_PORT,
+		Type:		"lldp",
+		Direction:	"bidirectional",
+		Capacity:	nb.Speed,
+	}
+}
@@ -0,0 +1,326 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	mbox_pool
+	Abstract:	A hop in a steering chain: one or more middleboxes which share the traffic.
+				A single middlebox is a pool of one. When there are several, the hop is
+				rendered as a select group whose buckets each set the destination to one
+				member; the balancing policy selects how the switch picks the bucket:
+					hash		- a hash of the addresses and protocol so a flow always uses
+								  the same member (members may still be weighted)
+					weighted	- the switch's default selection in proportion to the weights
+
+				Members reported as failed by the health check are left out of the group
+				(they remain in the pool and are put back when they recover). If every member
+				has failed, all are used as there is nowhere better to send the traffic.
+
+				Health is reported by the agent from the ovs interface table of the member's
+				host (see Mbox_health_parse).
+
+				Group ids are allocated by the reservation manager so that they are unique
+				among live reservations; the groups are deleted when the reservation expires.
+
+	Date:		19 Oct 2026
+*/
+
+package gizmos
+
+import (
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+)
+
+const (
+	MBP_HASH		int = 0
+	MBP_WEIGHTED	int = 1
+
+	MBP_MAX_WEIGHT	int = 1000			// ovs bucket weights are 16 bits; keep them sane
+	OF_GROUP_STEER	uint32 = 0x0e000000	// steering pool groups: this or'd with a 24 bit id (see Mbox_group_id)
+)
+
+type Mbox_pool struct {
+	id		*string					// name of the hop (member names joined with +)
+	policy	int						// MBP_ constant
+	members	[]*Mbox
+	weights	[]int
+	failed	[]bool					// set when the health check reports the member down
+}
+
+/*
+	Convert a policy name to the constant. An empty name is the default (hash).
+*/
+func Mbp_policy( name string ) ( int, error ) {
+	switch name {
+		case "", "hash":
+			return MBP_HASH, nil
+
+		case "weighted":
+			return MBP_WEIGHTED, nil
+	}
+
+	return MBP_HASH, fmt.Errorf( "unknown balancing policy: %s (expected hash or weighted)", name )
+}
+
+/*
+	Constructor; creates an empty pool.
+*/
+func Mk_mbox_pool( id *string, policy int ) ( *Mbox_pool ) {
+	return &Mbox_pool {
+		id:			id,
+		policy:		policy,
+		members:	make( []*Mbox, 0, 4 ),
+		weights:	make( []int, 0, 4 ),
+		failed:		make( []bool, 0, 4 ),
+	}
+}
+
+/*
+	Add a member with the given weight (values less than 1 are set to 1).
+*/
+func (mp *Mbox_pool) Add_member( mb *Mbox, weight int ) {
+	if mp == nil || mb == nil {
+		return
+	}
+
+	if weight < 1 {
+		weight = 1
+	}
+	if weight > MBP_MAX_WEIGHT {
+		weight = MBP_MAX_WEIGHT
+	}
+	mp.members = append( mp.members, mb )
+	mp.weights = append( mp.weights, weight )
+	mp.failed = append( mp.failed, false )
+}
+
+func (mp *Mbox_pool) Get_id( ) ( *string ) {
+	return mp.id
+}
+
+func (mp *Mbox_pool) Get_policy( ) ( int ) {
+	return mp.policy
+}
+
+/*
+	Return the number of members regardless of state.
+*/
+func (mp *Mbox_pool) Get_member_count( ) ( int ) {
+	if mp == nil {
+		return 0
+	}
+	return len( mp.members )
+}
+
+/*
+	Return the first member; used as the representative of the hop where only one box can be named.
+*/
+func (mp *Mbox_pool) Get_mbox( ) ( *Mbox ) {
+	if mp == nil || len( mp.members ) == 0 {
+		return nil
+	}
+	return mp.members[0]
+}
+
+/*
+	Return the members which are in service along with their weights. If all members have
+	failed then all are returned.
+*/
+func (mp *Mbox_pool) Get_members( ) ( mbl []*Mbox, wl []int ) {
+	if mp == nil {
+		return nil, nil
+	}
+
+	mbl = make( []*Mbox, 0, len( mp.members ) )
+	wl = make( []int, 0, len( mp.members ) )
+	for i, mb := range mp.members {
+		if ! mp.failed[i] {
+			mbl = append( mbl, mb )
+			wl = append( wl, mp.weights[i] )
+		}
+	}
+	if len( mbl ) == 0 {
+		mbl = append( mbl, mp.members... )
+		wl = append( wl, mp.weights... )
+	}
+
+	return mbl, wl
+}
+
+/*
+	Return the ids of the members which the health check reported as failed.
+*/
+func (mp *Mbox_pool) Get_failed( ) ( []string ) {
+	fl := make( []string, 0 )
+	if mp == nil {
+		return fl
+	}
+
+	for i, mb := range mp.members {
+		if mp.failed[i] {
+			fl = append( fl, *mb.Get_id() )
+		}
+	}
+	return fl
+}
+
+/*
+	Set the state of the member(s) with the mac address. Returns true if the state of any
+	member changed.
+*/
+func (mp *Mbox_pool) Set_state( mac string, up bool ) ( changed bool ) {
+	if mp == nil {
+		return false
+	}
+
+	for i, mb := range mp.members {
+		if mb.Get_mac() != nil && strings.EqualFold( *mb.Get_mac(), mac ) && mp.failed[i] == up {
+			mp.failed[i] = ! up
+			changed = true
+		}
+	}
+	return changed
+}
+
+/*
+	Return the members which the health check reported as failed (empty if all have failed
+	as they are all still used).
+*/
+func (mp *Mbox_pool) Get_failed_members( ) ( []*Mbox ) {
+	mbl := make( []*Mbox, 0 )
+	if mp == nil {
+		return mbl
+	}
+
+	for i, mb := range mp.members {
+		if mp.failed[i] {
+			mbl = append( mbl, mb )
+		}
+	}
+	if len( mbl ) == len( mp.members ) {
+		return mbl[:0]
+	}
+	return mbl
+}
+
+/*
+	Return true if there is more than one member (a select group is needed).
+*/
+func (mp *Mbox_pool) Is_pool( ) ( bool ) {
+	return mp != nil && len( mp.members ) > 1
+}
+
+/*
+	Return the preferred id of the group used for a hop of a steering reservation. The flow-mod
+	which sends to a hop differs by direction (the resubmit tables differ) so each gets its own
+	group. The id is a hash and may collide with that of another reservation; the reservation
+	manager checks and uses Mbox_group_next until it finds one that is free.
+*/
+func Mbox_group_id( rname string, forward bool, hop int ) ( uint32 ) {
+	return OF_GROUP_STEER | (crc32.ChecksumIEEE( []byte( fmt.Sprintf( "%s/%v/%d", rname, forward, hop ) ) ) & OF_GROUP_MASK)
+}
+
+/*
+	Return the steering group id which follows gid (wrapping within the steering range).
+*/
+func Mbox_group_next( gid uint32 ) ( uint32 ) {
+	return OF_GROUP_STEER | ((gid + 1) & OF_GROUP_MASK)
+}
+
+/*
+	Build the group parameter passed to send_ovs_fmod (-G) for the members in service:
+		group-id,policy,mac/weight[,mac/weight...]
+*/
+func (mp *Mbox_pool) Group_parm( gid uint32 ) ( string ) {
+	policy := "hash"
+	if mp.policy == MBP_WEIGHTED {
+		policy = "weighted"
+	}
+
+	mbl, wl := mp.Get_members()
+	s := fmt.Sprintf( "0x%x,%s", gid, policy )
+	for i, mb := range mbl {
+		s += fmt.Sprintf( ",%s/%d", *mb.Get_mac(), wl[i] )
+	}
+	return s
+}
+
+/*
+	Generate a json representation.
+*/
+func (mp *Mbox_pool) To_json( ) ( string ) {
+	policy := "hash"
+	if mp.policy == MBP_WEIGHTED {
+		policy = "weighted"
+	}
+
+	s := fmt.Sprintf( `{ "id": %q, "policy": %q, "members": [ `, *mp.id, policy )
+	sep := ""
+	for i, mb := range mp.members {
+		s += fmt.Sprintf( `%s{ "mbox": %s, "weight": %d, "up": %v }`, sep, *mb.To_json(), mp.weights[i], ! mp.failed[i] )
+		sep = ", "
+	}
+	return s + " ] }"
+}
+
+/*
+	Parse the output of
+		ovs-vsctl --format=csv --data=bare --no-headings --columns=external_ids,link_state,admin_state,ofport list interface
+	collected from host and report the state of each mac in the list. Returns records of the
+	form "host mac up|down". A mac which is not attached to an interface on the host is down,
+	as is one whose interface is not up or has no openflow port.
+*/
+func Mbox_health_parse( host string, macs []string, lines []string ) ( recs []string ) {
+	up := make( map[string]bool, len( macs ) )
+	for _, l := range lines {
+		toks := strings.Split( l, "," )					// external ids (may be quoted), link state, admin state, ofport
+		n := len( toks )
+		if n < 4 {
+			continue
+		}
+
+		ids := strings.Join( toks[0:n-3], "," )
+		j := strings.Index( ids, "attached-mac=" )
+		if j < 0 {
+			continue
+		}
+		f := strings.Fields( ids[j+13:] )
+		if len( f ) == 0 {									// attached-mac with no value
+			continue
+		}
+		mac := strings.ToLower( strings.Trim( f[0], `"` ) )
+		if mac == "" {
+			continue
+		}
+		ofport, err := strconv.Atoi( strings.TrimSpace( toks[n-1] ) )
+		up[mac] = strings.TrimSpace( toks[n-3] ) == "up" && strings.TrimSpace( toks[n-2] ) == "up" && err == nil && ofport > 0
+	}
+
+	recs = make( []string, 0, len( macs ) )
+	for _, mac := range macs {
+		state := "down"
+		if up[strings.ToLower( mac )] {
+			state = "up"
+		}
+		recs = append( recs, fmt.Sprintf( "%s %s %s", host, mac, state ) )
+	}
+	return recs
+}
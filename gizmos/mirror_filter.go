@@ -0,0 +1,362 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	mirror_filter
+	Abstract:	Packet filter for a mirror: the direction of the traffic (relative to the
+				mirrored port), the IP protocol, transport port ranges, source and destination
+				CIDRs, and a sampling ratio. A filtered mirror cannot be built with the OVS
+				mirror table and is always rendered as flow-mods by the agent; the filter
+				generates the OVS match fragments which the agent's tegu_add_mirror script
+				combines with the match for each mirrored port.
+
+				Direction is 'in' for traffic delivered to the port (toward the VM), 'out' for
+				traffic sent from the port, or 'both'.
+
+				Port ranges are converted to value/mask pairs, so a range may need several
+				matches (e.g. 80-90 needs 0x50/0xfff8, 0x58/0xfffe and 90).
+
+				Sampling sends 1 of every n flows to the output using an OVS select group
+				(bucket weights 1 and n-1); the group hashes flows, not packets, so sampling
+				is per flow.
+
+				The string form (checkpoint) is a blank separated list of key=value pairs:
+					dir=in proto=tcp sport=1024-2047 dport=80 src=10.0.0.0/8 dst=10.1.1.0/24 sample=10
+
+	Date:		19 Oct 2026
+*/
+
+package gizmos
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	MF_IN		string = "in"
+	MF_OUT		string = "out"
+	MF_BOTH		string = "both"
+
+	MF_MAX_SAMPLE	int = 65535			// bucket weights are 16 bits
+)
+
+type Mirror_filter struct {
+	dir		string				// in, out, both
+	proto	string				// tcp, udp, sctp, icmp, or an ip protocol number; "" is any
+	sport	string				// n or n-m
+	dport	string
+	src		string				// cidr
+	dst		string
+	sample	int					// mirror 1 of every sample flows; < 2 is all
+}
+
+/*
+	Parse a transport port range (n or n-m). Returns lo/hi.
+*/
+func parse_port_range( r string ) ( lo int, hi int, err error ) {
+	toks := strings.SplitN( r, "-", 2 )
+	lo, err = strconv.Atoi( toks[0] )
+	if err != nil {
+		return 0, 0, fmt.Errorf( "port range is not valid: %s", r )
+	}
+	hi = lo
+	if len( toks ) > 1 {
+		if hi, err = strconv.Atoi( toks[1] ); err != nil {
+			return 0, 0, fmt.Errorf( "port range is not valid: %s", r )
+		}
+	}
+	if lo < 0 || hi > 65535 || hi < lo {
+		return 0, 0, fmt.Errorf( "port range must be within 0-65535 and low must not exceed high: %s", r )
+	}
+
+	return lo, hi, nil
+}
+
+/*
+	Convert a port range to the list of OVS value/mask matches that cover exactly the range.
+	A single port is returned without a mask.
+*/
+func Port_range_masks( lo int, hi int ) ( masks []string ) {
+	masks = make( []string, 0, 4 )
+	for lo <= hi {
+		size := 1
+		for lo & (size * 2 - 1) == 0 && lo + size * 2 - 1 <= hi && size < 65536 {		// largest aligned block starting at lo within the range
+			size *= 2
+		}
+
+		if size == 1 {
+			masks = append( masks, fmt.Sprintf( "%d", lo ) )
+		} else {
+			masks = append( masks, fmt.Sprintf( "0x%04x/0x%04x", lo, 0xffff &^ (size - 1) ) )
+		}
+		lo += size
+	}
+
+	return
+}
+
+/*
+	Constructor. All values are validated; an empty direction is 'both' and a sample of 0 or 1
+	is all flows. Ports may only be given with tcp, udp or sctp, and the CIDRs must be of the
+	same family.
+*/
+func Mk_mirror_filter( dir string, proto string, sport string, dport string, src string, dst string, sample int ) ( f *Mirror_filter, err error ) {
+	switch dir {
+		case "":
+			dir = MF_BOTH
+
+		case MF_IN, MF_OUT, MF_BOTH:
+
+		default:
+			return nil, fmt.Errorf( "mirror filter direction must be in, out or both: %s", dir )
+	}
+
+	proto = strings.ToLower( proto )
+	switch proto {
+		case "", "tcp", "udp", "sctp", "icmp":
+
+		default:
+			if n, err := strconv.Atoi( proto ); err != nil || n < 0 || n > 255 {
+				return nil, fmt.Errorf( "mirror filter protocol must be tcp, udp, sctp, icmp or a number 0-255: %s", proto )
+			}
+	}
+
+	if sport != "" || dport != "" {
+		if proto != "tcp" && proto != "udp" && proto != "sctp" {
+			return nil, fmt.Errorf( "mirror filter ports may be given only with protocol tcp, udp or sctp" )
+		}
+		for _, r := range []string{ sport, dport } {
+			if r != "" {
+				if _, _, err = parse_port_range( r ); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	v6 := 0
+	for i, c := range []string{ src, dst } {
+		if c != "" {
+			ip, ipnet, err := net.ParseCIDR( c )
+			if err != nil {
+				return nil, fmt.Errorf( "mirror filter cidr is not valid: %s", c )
+			}
+			if ip.To4() == nil {
+				v6 |= i + 1
+			}
+			if i == 0 {
+				src = ipnet.String()
+			} else {
+				dst = ipnet.String()
+			}
+		}
+	}
+	if src != "" && dst != "" && v6 != 0 && v6 != 3 {
+		return nil, fmt.Errorf( "mirror filter source and destination cidrs must both be ipv4 or both be ipv6" )
+	}
+
+	if sample < 0 || sample > MF_MAX_SAMPLE {
+		return nil, fmt.Errorf( "mirror filter sample must be between 1 and %d: %d", MF_MAX_SAMPLE, sample )
+	}
+	if sample < 2 {
+		sample = 0
+	}
+
+	return &Mirror_filter{ dir: dir, proto: proto, sport: sport, dport: dport, src: src, dst: dst, sample: sample }, nil
+}
+
+/*
+	Build a filter from the string generated by String().
+*/
+func Str2mirror_filter( s string ) ( *Mirror_filter, error ) {
+	kv := make( map[string]string )
+	for _, tok := range strings.Fields( s ) {
+		pair := strings.SplitN( tok, "=", 2 )
+		if len( pair ) != 2 {
+			return nil, fmt.Errorf( "mirror filter token is not key=value: %s", tok )
+		}
+		kv[pair[0]] = pair[1]
+	}
+
+	sample := 0
+	if kv["sample"] != "" {
+		sample, _ = strconv.Atoi( kv["sample"] )
+	}
+	return Mk_mirror_filter( kv["dir"], kv["proto"], kv["sport"], kv["dport"], kv["src"], kv["dst"], sample )
+}
+
+func (f *Mirror_filter) Get_direction( ) ( string ) {
+	if f == nil {
+		return MF_BOTH
+	}
+	return f.dir
+}
+
+func (f *Mirror_filter) Get_sample( ) ( int ) {
+	if f == nil {
+		return 0
+	}
+	return f.sample
+}
+
+/*
+	Returns true if the cidrs are ipv6.
+*/
+func (f *Mirror_filter) is_v6( ) ( bool ) {
+	for _, c := range []string{ f.src, f.dst } {
+		if c != "" {
+			ip, _, _ := net.ParseCIDR( c )
+			return ip.To4() == nil
+		}
+	}
+	return false
+}
+
+/*
+	Generate the list of OVS match fragments for the filter. Each is a comma separated list
+	of match fields (e.g. tcp,nw_src=10.0.0.0/8,tp_dst=80) and any one of them matching
+	selects the packet. A single empty fragment is returned if the filter matches all
+	packets (direction and sampling only).
+*/
+func (f *Mirror_filter) Ovs_matches( ) ( []string ) {
+	if f == nil {
+		return []string{ "" }
+	}
+
+	v6 := f.is_v6()
+	base := make( []string, 0, 4 )
+	switch f.proto {
+		case "":
+			if f.src != "" || f.dst != "" {
+				if v6 {
+					base = append( base, "ipv6" )
+				} else {
+					base = append( base, "ip" )
+				}
+			}
+
+		case "tcp", "udp", "sctp", "icmp":
+			p := f.proto
+			if v6 {
+				p += "6"
+			}
+			base = append( base, p )
+
+		default:
+			if v6 {
+				base = append( base, "ipv6", "nw_proto=" + f.proto )
+			} else {
+				base = append( base, "ip", "nw_proto=" + f.proto )
+			}
+	}
+
+	sfield, dfield := "nw_src", "nw_dst"
+	if v6 {
+		sfield, dfield = "ipv6_src", "ipv6_dst"
+	}
+	if f.src != "" {
+		base = append( base, sfield + "=" + f.src )
+	}
+	if f.dst != "" {
+		base = append( base, dfield + "=" + f.dst )
+	}
+
+	sm := []string{ "" }
+	dm := []string{ "" }
+	if f.sport != "" {
+		lo, hi, _ := parse_port_range( f.sport )
+		sm = Port_range_masks( lo, hi )
+	}
+	if f.dport != "" {
+		lo, hi, _ := parse_port_range( f.dport )
+		dm = Port_range_masks( lo, hi )
+	}
+
+	matches := make( []string, 0, len( sm ) * len( dm ) )
+	for _, s := range sm {
+		for _, d := range dm {
+			m := append( []string{ }, base... )
+			if s != "" {
+				m = append( m, "tp_src=" + s )
+			}
+			if d != "" {
+				m = append( m, "tp_dst=" + d )
+			}
+			matches = append( matches, strings.Join( m, "," ) )
+		}
+	}
+
+	return matches
+}
+
+/*
+	Generate the command line flags for tegu_add_mirror:
+		-d<direction> [-s<sample>] [-m<match>[+<match>...]]
+*/
+func (f *Mirror_filter) To_args( ) ( string ) {
+	if f == nil {
+		return ""
+	}
+
+	args := "-d" + f.dir
+	if f.sample > 1 {
+		args += fmt.Sprintf( " -s%d", f.sample )
+	}
+	if m := strings.Join( f.Ovs_matches(), "+" ); m != "" {
+		args += " -m" + m
+	}
+
+	return args
+}
+
+/*
+	The string (checkpoint) form of the filter.
+*/
+func (f *Mirror_filter) String( ) ( string ) {
+	if f == nil {
+		return ""
+	}
+
+	s := "dir=" + f.dir
+	for _, kv := range [][]string{ { "proto", f.proto }, { "sport", f.sport }, { "dport", f.dport }, { "src", f.src }, { "dst", f.dst } } {
+		if kv[1] != "" {
+			s += " " + kv[0] + "=" + kv[1]
+		}
+	}
+	if f.sample > 1 {
+		s += fmt.Sprintf( " sample=%d", f.sample )
+	}
+
+	return s
+}
+
+/*
+	Json using the same names as the mirror API request.
+*/
+func (f *Mirror_filter) To_json( ) ( string ) {
+	if f == nil {
+		return "null"
+	}
+
+	return fmt.Sprintf( `{ "direction": %q, "protocol": %q, "src_port": %q, "dst_port": %q, "src_cidr": %q, "dst_cidr": %q, "sample": %d }`,
+		f.dir, f.proto, f.sport, f.dport, f.src, f.dst, f.sample )
+}
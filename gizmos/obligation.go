@@ -26,7 +26,7 @@
 				timestamps) and a maximum capacity. The obligation is subdivided
 				into time windows between the commence and conclude times with
 				each time winodw tracking an obligated capacity. By default, the
-				obligation spans from the epoch until well into the future (2025ish);
+				obligation spans from the epoch until well into the future (2036);
 				there is probably no reason for a user application to change this.
 
 				The obligation now supports the concept of queues associated with
@@ -58,6 +58,10 @@
 					empty. Some cleanup of commented lines.
 				22 Jun 2015 : Corrected cause of core dump when updating utilisation on mlag.
 				05 Jul 2016 : Changed the max date to 2026/01/01 00:00:00
+				19 Oct 2026 : Added Set_queue_limits (queue headroom and burst).
+				19 Oct 2026 : Added Get_available.
+				19 Oct 2026 : Changed the max date to 2036/01/01 00:00:00; the old one had passed and
+					obligations were pruned to nothing.
 */
 
 package gizmos
@@ -68,7 +72,7 @@ import (
 )
 
 const (
-	DEF_END_TS = 1767243600		// jan 1, 2026 -- it we're still being used then I'll be surprised!
+	DEF_END_TS = 2082758400		// jan 1, 2036 -- kept short of the 32 bit rollover in 2038
 )
 
 type Obligation struct {
@@ -282,6 +286,25 @@ func (ob *Obligation) Has_capacity( commence int64, conclude int64, amt int64, u
 	return					// assume that the last block in the list ends earlier than the conclusion passed in
 }
 
+/*
+	Returns the capacity that could still be obligated across the whole of the commence/conclude
+	window; the max capacity less the largest amount obligated by any overlapping timeslice.
+*/
+func (ob *Obligation) Get_available( commence int64, conclude int64 ) ( int64 ) {
+	var max int64 = 0
+
+	for ts := ob.tslist; ts != nil && ! ts.Is_after( conclude ); ts = ts.Next {
+		if ts.Overlaps( commence, conclude ) && ts.Amt > max {
+			max = ts.Amt
+		}
+	}
+
+	if max >= ob.Max_capacity {
+		return 0
+	}
+	return ob.Max_capacity - max
+}
+
 /*
 	Adds a queue to the obligation starting with the commence and ending with the conclude timestamps.
 	This function does NOT check to see if the obligaion can support the amount being added assuming that
@@ -334,6 +357,19 @@ func (ob *Obligation) Dec_queue( qid *string, amt int64, commence int64, conclud
 }
 
 
+/*
+	Adjust the headroom and burst of the queue in each timeslice within the window. The queue
+	must already have been added for the window (Add_queue splits slices at the window edges).
+	Headroom is not counted as utilisation, so capacity checks consider only the guarantee.
+*/
+func (ob *Obligation) Set_queue_limits( qid *string, commence int64, conclude int64, delta int64, burst int64 ) {
+	for ts := ob.tslist; ts != nil; ts = ts.Next {
+		if ! ts.Is_before( commence ) && ! ts.Is_after( conclude ) {
+			ts.Set_queue_limits( qid, delta, burst )
+		}
+	}
+}
+
 /*
 	run the timeslice list and prune away any leading blocks that are in the past
 */
@@ -0,0 +1,602 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	of_res
+	Abstract:	Builds the openflow flow-mods for reservations from the same parameter map
+				that is sent to the agent for the ql_bw_fmods, ql_bwow_fmods and ql_pass_fmods
+				scripts. The flows generated are the same as those the scripts generate via
+				send_ovs_fmod: same cookies, priorities, matches (metadata, macs, ip type,
+				external address, vlan, protocol/port) and actions (queue, dscp marking,
+				metadata set and a resubmit to table 0). Bandwidth flows set the reservation's
+				queue unless the parameters name a meter (meter queue policy) in which case
+				the outbound flow carries a meter instruction instead. When a bandwidth reservation is
+				split across paths the outbound flow sends to a select group whose buckets set
+				each path's queue and output on the path's port, weighted by the path's share.
+				The group's id is allocated by the reservation manager and passed in the parms.
+				Bucket ports must be OpenFlow ports of the reservation bridge (Of_bw_group_ports
+				checks them against the bridge's ports). Of_strict_deletes converts the flows
+				built for a reservation into strict deletes which remove only that reservation's
+				flows.
+
+	Date:		18 Oct 2026
+*/
+
+package gizmos
+
+import (
+	"fmt"
+	"hash/crc32"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	OF_COOKIE_BW	uint64 = 0xb0ff
+	OF_COOKIE_BWOW	uint64 = 0xf00d
+	OF_COOKIE_PT	uint64 = 0x0dad
+	OF_RES_BRIDGE	string = "br-int"
+	OF_MAX_HTO		int = 3600 * 18			// ovs hard timeout limit is about 18h12m; same cap as send_ovs_fmod
+	OF_GROUP_BW		uint32 = 0x0b000000		// split reservation groups: this or'd with a 24 bit id (see Of_bw_group_id)
+	OF_GROUP_MASK	uint32 = 0x00ffffff
+	OF_CAP_SPLIT	string = "split"		// capability reported for hosts on which split groups can be installed
+)
+
+/*
+	Convert the timeout parm to a hard timeout. 0 or less means no timeout.
+*/
+func of_hto( parms map[string]string ) ( uint16, error ) {
+	ts := parms["timeout"]
+	if ts == "" {
+		return 60, nil								// send_ovs_fmod default
+	}
+	t, err := strconv.Atoi( ts )
+	if err != nil {
+		return 0, fmt.Errorf( "bad timeout: %s", ts )
+	}
+	if t <= 0 {
+		return 0, nil
+	}
+	if t > OF_MAX_HTO {
+		t = OF_MAX_HTO
+	}
+	return uint16( t ), nil
+}
+
+/*
+	Parse proto:port (e.g. tcp:80) and set the protocol and either the source or dest
+	port in the match. Port 0 (or missing) matches only the protocol.
+*/
+func of_proto( m *Of_match, pp string, src bool ) ( error ) {
+	if pp == "" {
+		return nil
+	}
+
+	toks := strings.SplitN( pp, ":", 2 )
+	switch strings.ToLower( toks[0] ) {
+		case "tcp":	m.Ip_proto = 6
+		case "udp":	m.Ip_proto = 17
+		default:
+			p, err := strconv.Atoi( toks[0] )
+			if err != nil {
+				return fmt.Errorf( "unknown protocol: %s", pp )
+			}
+			m.Ip_proto = p
+	}
+
+	if len( toks ) > 1 && toks[1] != "" && toks[1] != "0" {
+		port, err := strconv.Atoi( toks[1] )				// port masks are not supported in 1.3
+		if err != nil || port < 0 || port > 65535 {
+			return fmt.Errorf( "bad or unsupported port: %s", pp )
+		}
+		if src {
+			m.Tp_src = port
+		} else {
+			m.Tp_dst = port
+		}
+	}
+
+	return nil
+}
+
+/*
+	Set the ip type in the match: -6 forced or the address family of the external address.
+*/
+func of_ip_type( m *Of_match, ipv6 bool, addr string ) {
+	m.Eth_type = 0x0800
+	if ipv6 {
+		m.Eth_type = 0x86dd
+	}
+	if addr != "" {
+		if ip := net.ParseIP( strings.Trim( addr, "[]" ) ); ip != nil && ip.To4() == nil {
+			m.Eth_type = 0x86dd
+		}
+	}
+}
+
+func of_vlan( m *Of_match, v string ) ( error ) {
+	if v == "" {
+		return nil
+	}
+	vid, err := strconv.Atoi( v )
+	if err != nil || vid < 0 || vid > 4095 {
+		return fmt.Errorf( "bad vlan match: %s", v )
+	}
+	m.Vlan_vid = vid
+	return nil
+}
+
+/*
+	Common metadata match (0x0/0x7 so that resubmitted packets are not matched again) and
+	the actions: optional dscp, set meta 0x01, resubmit to table 0.
+*/
+func of_res_flow( cookie uint64, pri int, hto uint16, m *Of_match, queue int, dscp int ) ( *Of_flow ) {
+	m.Has_meta = true
+	m.Metadata = 0
+	m.Meta_mask = 0x7
+
+	acts := make( []Of_action, 0, 4 )
+	if queue > 0 {
+		acts = append( acts, Of_act_set_queue( uint32( queue ) ) )
+	}
+	if dscp >= 0 {
+		acts = append( acts, Of_act_set_dscp( uint8( dscp ) ) )
+	}
+	acts = append( acts, Of_act_set_meta( 0x01 ), Of_act_resubmit( 0 ) )
+
+	return &Of_flow {
+		Command:		OFPFC_ADD,
+		Priority:		uint16( pri ),
+		Cookie:			cookie,
+		Hard_timeout:	hto,
+		Match:			m,
+		Insts:			[]Of_instruction{ Of_inst_apply( acts... ) },
+	}
+}
+
+/*
+	When the parms name a meter (meter queue policy) put the meter instruction in front of
+	the flow's instructions. Only outbound flows are metered; the queue they replace is on
+	the outward port.
+*/
+func of_add_meter( f *Of_flow, parms map[string]string ) ( error ) {
+	ms := parms["meter"]
+	if ms == "" {
+		return nil
+	}
+	id, err := strconv.Atoi( ms )
+	if err != nil || id <= 0 {
+		return fmt.Errorf( "bad meter: %s", ms )
+	}
+
+	f.Insts = append( []Of_instruction{ Of_inst_meter( uint32( id ) ) }, f.Insts... )
+	return nil
+}
+
+/*
+	Return the preferred id of the select group which splits the paths of the reservation that
+	start at the host with the mac (key). The id might be in use by another reservation; the
+	reservation manager checks and uses Of_bw_group_next until it finds one that is free. The
+	id allocated is passed to the agent in the group_id parm.
+*/
+func Of_bw_group_id( rname string, key string ) ( uint32 ) {
+	return OF_GROUP_BW | (crc32.ChecksumIEEE( []byte( rname + "/" + strings.ToLower( key ) ) ) & OF_GROUP_MASK)
+}
+
+/*
+	Return the split group id which follows gid, wrapping within the split group range.
+*/
+func Of_bw_group_next( gid uint32 ) ( uint32 ) {
+	return OF_GROUP_BW | ((gid + 1) & OF_GROUP_MASK)
+}
+
+/*
+	Return the split group id given in the parms (group_id). An error is returned if it is
+	missing or is not in the split group range.
+*/
+func Of_bw_parm_gid( parms map[string]string ) ( uint32, error ) {
+	v, err := strconv.ParseUint( parms["group_id"], 0, 32 )
+	if err != nil || uint32( v ) & ^OF_GROUP_MASK != OF_GROUP_BW {
+		return 0, fmt.Errorf( "bad or missing split group id: %q", parms["group_id"] )
+	}
+	return uint32( v ), nil
+}
+
+/*
+	Build the select group for a bandwidth reservation split across paths. The group parm is a
+	space separated list of port/queue/share, one for each path. Each bucket sets the queue and
+	outputs on the port; a bucket without a port (late binding) cannot steer its share onto the
+	path and is an error. Weights are the shares scaled to 1000 and the id is the group_id
+	parm. Nil is returned if the parms do not have a group.
+*/
+func Of_bw_group( parms map[string]string ) ( g *Of_group, err error ) {
+	gs := strings.Fields( parms["group"] )
+	if len( gs ) == 0 {
+		return nil, nil
+	}
+	gid, err := Of_bw_parm_gid( parms )
+	if err != nil {
+		return nil, err
+	}
+
+	ports := make( []int, len( gs ) )
+	queues := make( []int, len( gs ) )
+	shares := make( []int64, len( gs ) )
+	var total int64 = 0
+	for i, tok := range gs {
+		toks := strings.Split( tok, "/" )
+		if len( toks ) != 3 {
+			return nil, fmt.Errorf( "bad group bucket: %s", tok )
+		}
+		if ports[i], err = strconv.Atoi( toks[0] ); err == nil {
+			if queues[i], err = strconv.Atoi( toks[1] ); err == nil {
+				shares[i], err = strconv.ParseInt( toks[2], 10, 64 )
+			}
+		}
+		if err != nil || queues[i] < 0 || shares[i] <= 0 {
+			return nil, fmt.Errorf( "bad group bucket: %s", tok )
+		}
+		if ports[i] <= 0 {
+			return nil, fmt.Errorf( "group bucket has no port: %s", tok )
+		}
+		total += shares[i]
+	}
+
+	g = &Of_group{ Id: gid, Type: OFPGT_SELECT, Buckets: make( []*Of_bucket, len( gs ) ) }
+	for i := range gs {
+		w := (shares[i] * 1000) / total
+		if w < 1 {
+			w = 1
+		}
+
+		acts := []Of_action{ Of_act_set_queue( uint32( queues[i] ) ), Of_act_output( uint32( ports[i] ) ) }
+		g.Buckets[i] = &Of_bucket{ Weight: uint16( w ), Actions: acts }
+	}
+
+	return g, nil
+}
+
+/*
+	Check that the port of each bucket in a split group parm (port/queue/share ...) is the OpenFlow
+	port of an interface on the reservation bridge. The ports come from tegu's graph; a port that
+	the bridge does not have would send the path's share somewhere other than the path.
+*/
+func Of_bw_group_ports( group string, ports map[string]*Ovs_port ) ( error ) {
+	have := make( map[int]bool )
+	for _, p := range ports {
+		if p.Bridge == OF_RES_BRIDGE {
+			for _, of := range p.Ofports {
+				have[of] = true
+			}
+		}
+	}
+
+	for _, tok := range strings.Fields( group ) {
+		pt, err := strconv.Atoi( strings.SplitN( tok, "/", 2 )[0] )
+		if err != nil || ! have[pt] {
+			return fmt.Errorf( "group bucket port is not a port of %s: %s", OF_RES_BRIDGE, tok )
+		}
+	}
+
+	return nil
+}
+
+/*
+	Return the queue that bandwidth flows set (the script's -q option), or -1 if none. Queue
+	0 is the port's default queue and is not set. When the parms name a meter there are no
+	reservation queues (the meter replaces them) so none is set.
+*/
+func of_queue( parms map[string]string ) ( int, error ) {
+	qs := parms["queue"]
+	if qs == "" || parms["meter"] != "" {
+		return -1, nil
+	}
+	q, err := strconv.Atoi( qs )
+	if err != nil || q < 0 {
+		return -1, fmt.Errorf( "bad queue: %s", qs )
+	}
+	if q == 0 {
+		return -1, nil
+	}
+	return q, nil
+}
+
+/*
+	The dscp parm is the tos value (dscp << 2) as that is what the scripts expect.
+*/
+func of_dscp( parms map[string]string ) ( int, error ) {
+	ds := parms["dscp"]
+	if ds == "" {
+		return -1, nil
+	}
+	t, err := strconv.Atoi( ds )
+	if err != nil || t < 0 || t > 255 {
+		return -1, fmt.Errorf( "bad dscp: %s", ds )
+	}
+	return t >> 2, nil
+}
+
+/*
+	Build the inbound and outbound flow-mods for a bandwidth reservation (ql_bw_fmods).
+	The inbound flow is omitted when both endpoints are on the same switch.
+*/
+func Of_bw_flows( parms map[string]string ) ( flows []*Of_flow, err error ) {
+	lmac := parms["smac"]
+	rmac := parms["dmac"]
+	if lmac == "" || rmac == "" {
+		return nil, fmt.Errorf( "must have source and dest mac addresses to generate flow-mods" )
+	}
+
+	hto, err := of_hto( parms )
+	if err != nil {
+		return nil, err
+	}
+	odscp, err := of_dscp( parms )
+	if err != nil {
+		return nil, err
+	}
+	q, err := of_queue( parms )
+	if err != nil {
+		return nil, err
+	}
+	ipv6 := parms["ipv6"] == "true"
+	koe := parms["koe"] == "true"
+	one_switch := parms["oneswitch"] == "true"
+
+	pri_base := 0
+	if parms["sproto"] != "" || parms["dproto"] != "" {
+		pri_base = 5
+	}
+
+	exip := parms["extip"]
+	ex_local := parms["extdir"] != "-D"				// external address associated with the local (smac) endpoint unless -D
+
+	flows = make( []*Of_flow, 0, 2 )
+	if ! one_switch {
+		im := Mk_of_match()
+		im.Eth_dst = lmac
+		im.Eth_src = rmac
+		of_ip_type( im, ipv6, exip )
+		if exip != "" {
+			if ex_local {
+				im.Ip_dst = exip
+			} else {
+				im.Ip_src = exip
+			}
+		}
+		if err = of_proto( im, parms["sproto"], false ); err != nil {		// local proto is inbound dest
+			return nil, err
+		}
+		if err = of_proto( im, parms["dproto"], true ); err != nil {
+			return nil, err
+		}
+
+		idscp := 0											// inbound resets dscp unless keep on exit is set
+		if koe {
+			idscp = -1
+		}
+		flows = append( flows, of_res_flow( OF_COOKIE_BW, 450 + pri_base, hto, im, q, idscp ) )
+	} else {
+		if ! koe {
+			odscp = -1										// one switch and no keep; no need to mark
+		}
+	}
+
+	vp_base := 0
+	om := Mk_of_match()
+	if parms["vlan_match"] != "" {
+		vp_base = 5
+		if err = of_vlan( om, parms["vlan_match"] ); err != nil {
+			return nil, err
+		}
+	}
+	om.Eth_src = lmac
+	om.Eth_dst = rmac
+	of_ip_type( om, ipv6, exip )
+	if exip != "" {
+		if ex_local {
+			om.Ip_src = exip
+		} else {
+			om.Ip_dst = exip
+		}
+	}
+	if err = of_proto( om, parms["sproto"], true ); err != nil {
+		return nil, err
+	}
+	if err = of_proto( om, parms["dproto"], false ); err != nil {
+		return nil, err
+	}
+	of := of_res_flow( OF_COOKIE_BW, 400 + vp_base + pri_base, hto, om, q, odscp )
+	if parms["group"] != "" {									// split across paths: the group sets the queues and replaces the resubmit
+		gid, err := Of_bw_parm_gid( parms )
+		if err != nil {
+			return nil, err
+		}
+		acts := make( []Of_action, 0, 3 )
+		if odscp >= 0 {
+			acts = append( acts, Of_act_set_dscp( uint8( odscp ) ) )
+		}
+		acts = append( acts, Of_act_set_meta( 0x01 ), Of_act_group( gid ) )
+		of.Insts = []Of_instruction{ Of_inst_apply( acts... ) }
+	}
+	if err = of_add_meter( of, parms ); err != nil {
+		return nil, err
+	}
+	flows = append( flows, of )
+
+	return flows, nil
+}
+
+/*
+	Build the single outbound flow-mod for a oneway reservation (ql_bwow_fmods). The
+	dest mac is optional, but either it or the external address must be given.
+*/
+func Of_bwow_flows( parms map[string]string ) ( flows []*Of_flow, err error ) {
+	smac := parms["smac"]
+	if smac == "" {
+		return nil, fmt.Errorf( "must have source mac address to generate oneway flow-mods" )
+	}
+
+	exip := parms["extip"]
+	if exip == "any" {
+		exip = ""
+	} else {
+		if exip == "" && parms["dmac"] == "" {
+			return nil, fmt.Errorf( "must have dest mac or external address to generate oneway flow-mods" )
+		}
+	}
+
+	hto, err := of_hto( parms )
+	if err != nil {
+		return nil, err
+	}
+	dscp, err := of_dscp( parms )
+	if err != nil {
+		return nil, err
+	}
+	q, err := of_queue( parms )
+	if err != nil {
+		return nil, err
+	}
+
+	pri_base := 0
+	if parms["sproto"] != "" || parms["dproto"] != "" {
+		pri_base = 5
+	}
+
+	m := Mk_of_match()
+	if err = of_vlan( m, parms["vlan_match"] ); err != nil {
+		return nil, err
+	}
+	m.Eth_src = smac
+	m.Eth_dst = parms["dmac"]
+	of_ip_type( m, parms["ipv6"] == "true", exip )
+	m.Ip_dst = exip
+	if err = of_proto( m, parms["sproto"], true ); err != nil {
+		return nil, err
+	}
+	if err = of_proto( m, parms["dproto"], false ); err != nil {
+		return nil, err
+	}
+
+	f := of_res_flow( OF_COOKIE_BWOW, 400 + pri_base, hto, m, q, dscp )
+	if err = of_add_meter( f, parms ); err != nil {
+		return nil, err
+	}
+	return []*Of_flow{ f }, nil
+}
+
+/*
+	Split a passthrough address: [{tcp|udp}:][address][:port]. IPv6 addresses with a port
+	must be bracketed.
+*/
+func of_split_pap( pap string ) ( proto string, addr string, port string ) {
+	if strings.HasPrefix( pap, "tcp:" ) || strings.HasPrefix( pap, "udp:" ) {
+		proto = pap[0:3]
+		pap = pap[4:]
+	}
+
+	switch {
+		case strings.HasPrefix( pap, "[" ):
+			if i := strings.Index( pap, "]" ); i > 0 {
+				addr = pap[1:i]
+				port = strings.TrimPrefix( pap[i+1:], ":" )
+			}
+
+		case strings.Count( pap, ":" ) == 1:
+			toks := strings.SplitN( pap, ":", 2 )
+			addr = toks[0]
+			port = toks[1]
+
+		case strings.Count( pap, ":" ) > 1:
+			addr = pap
+
+		default:
+			if _, err := strconv.Atoi( pap ); err == nil && proto != "" {
+				port = pap
+			} else {
+				addr = pap
+			}
+	}
+
+	return proto, addr, port
+}
+
+/*
+	Build the passthrough flow-mod (ql_pass_fmods). Smac must be a mac address; endpoint
+	uuids must be converted (and the bridge determined) by the caller.
+*/
+func Of_pt_flows( parms map[string]string ) ( flows []*Of_flow, err error ) {
+	smac := parms["smac"]
+	if _, err = of_mac( smac ); err != nil {
+		return nil, fmt.Errorf( "passthrough source must be a mac address: %s", smac )
+	}
+
+	hto, err := of_hto( parms )
+	if err != nil {
+		return nil, err
+	}
+
+	proto, addr, port := of_split_pap( parms["sip"] )
+	if addr == "none" {
+		addr = ""
+	}
+
+	m := Mk_of_match()
+	m.Eth_src = smac
+	if addr != "" || proto != "" {
+		of_ip_type( m, false, addr )
+		m.Ip_src = addr
+	}
+	if proto != "" {
+		if err = of_proto( m, proto + ":" + port, true ); err != nil {
+			return nil, err
+		}
+	}
+
+	return []*Of_flow{ of_res_flow( OF_COOKIE_PT, 400, hto, m, -1, -1 ) }, nil
+}
+
+/*
+	Return a strict delete for each of the flows: same table, priority, cookie and match. Only
+	the flows generated from a reservation's parms are removed; flows of another reservation
+	between the same endpoints (different ports, protocol or vlan) do not match strictly and
+	are left in place.
+*/
+func Of_strict_deletes( flows []*Of_flow ) ( dels []*Of_flow ) {
+	dels = make( []*Of_flow, 0, len( flows ) )
+	for _, f := range flows {
+		dels = append( dels, &Of_flow{ Command: OFPFC_DELETE_STRICT, Table: f.Table, Priority: f.Priority, Cookie: f.Cookie, Cookie_mask: 0xffffffffffffffff, Match: f.Match } )
+	}
+
+	return dels
+}
+
+/*
+	Render the flow as the match given to ovs-ofctl --strict del-flows.
+*/
+func Of_strict_del_str( f *Of_flow ) ( string ) {
+	s := fmt.Sprintf( "table=%d,priority=%d,cookie=0x%x/-1", f.Table, f.Priority, f.Cookie )
+	if m := f.Match.String(); m != "" {
+		s += "," + m
+	}
+
+	return s
+}
@@ -0,0 +1,1311 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	openflow
+	Abstract:	A minimal OpenFlow 1.3 client used to program OVS bridges directly rather
+				than running ovs-ofctl. Supported are: flow-mod (add, delete) with an OXM
+				match, the instructions and actions that the reservation flow-mods need
+				(apply-actions, goto-table, write-metadata, output, set-queue, set-field,
+				push/pop vlan and the Nicira resubmit extension), barrier, echo handling,
+				flow stats (dump) and bundles (the ONF extension which OVS supports with
+				1.3) so that a group of flow-mods is installed atomically. Meters (used by the
+				meter queue policy) can be set, listed and their support queried, and flows
+				may carry a meter instruction. Select groups (used to spread a reservation split
+				across paths) can be set and deleted. Flows can be rendered in ovs-ofctl syntax
+				for display.
+
+				The target is given as unix:/path (e.g. /var/run/openvswitch/br-int.mgmt)
+				or tcp:host:port (the bridge must be listening via a ptcp: controller).
+
+	Date:		18 Oct 2026
+*/
+
+package gizmos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OFP_VERSION			uint8 = 0x04			// openflow 1.3
+
+	OFPT_HELLO			uint8 = 0
+	OFPT_ERROR			uint8 = 1
+	OFPT_ECHO_REQUEST	uint8 = 2
+	OFPT_ECHO_REPLY		uint8 = 3
+	OFPT_EXPERIMENTER	uint8 = 4
+	OFPT_FLOW_MOD		uint8 = 14
+	OFPT_GROUP_MOD		uint8 = 15
+	OFPT_MULTIPART_REQ	uint8 = 18
+	OFPT_MULTIPART_REP	uint8 = 19
+	OFPT_BARRIER_REQ	uint8 = 20
+	OFPT_BARRIER_REP	uint8 = 21
+	OFPT_METER_MOD		uint8 = 29
+
+	OFPFC_ADD			uint8 = 0
+	OFPFC_MODIFY		uint8 = 1
+	OFPFC_DELETE		uint8 = 3
+	OFPFC_DELETE_STRICT	uint8 = 4
+
+	OFPP_ANY			uint32 = 0xffffffff
+	OFPP_IN_PORT		uint32 = 0xfffffff8
+	OFPP_NORMAL			uint32 = 0xfffffffa
+	OFPG_ANY			uint32 = 0xffffffff
+	OFPTT_ALL			uint8 = 0xff
+
+	OFP_NO_BUFFER		uint32 = 0xffffffff
+	OFPMP_FLOW			uint16 = 1
+	OFPMP_METER_CONFIG	uint16 = 10
+	OFPMP_METER_FEATURES	uint16 = 11
+
+	OFPMC_ADD			uint16 = 0
+	OFPMC_MODIFY		uint16 = 1
+	OFPMC_DELETE		uint16 = 2
+	OFPM_ALL			uint32 = 0xffffffff
+
+	OFPGC_ADD			uint16 = 0
+	OFPGC_MODIFY		uint16 = 1
+	OFPGC_DELETE		uint16 = 2
+	OFPGT_ALL			uint8 = 0
+	OFPGT_SELECT		uint8 = 1
+	ofpmf_kbps			uint16 = 0x0001
+	ofpmf_burst			uint16 = 0x0004
+	OFPVID_PRESENT		uint16 = 0x1000
+
+	ofp_oxm_basic		uint16 = 0x8000
+	ofp_nx_vendor		uint32 = 0x00002320
+	ofp_onf_exp			uint32 = 0x4f4e4600
+	ofp_bundle_ctl		uint32 = 2300
+	ofp_bundle_add		uint32 = 2301
+
+	OF_TIMEOUT			time.Duration = 15 * time.Second
+)
+
+// oxm field ids
+const (
+	oxm_in_port		uint8 = 0
+	oxm_metadata	uint8 = 2
+	oxm_eth_dst		uint8 = 3
+	oxm_eth_src		uint8 = 4
+	oxm_eth_type	uint8 = 5
+	oxm_vlan_vid	uint8 = 6
+	oxm_ip_dscp		uint8 = 8
+	oxm_ip_proto	uint8 = 10
+	oxm_ipv4_src	uint8 = 11
+	oxm_ipv4_dst	uint8 = 12
+	oxm_tcp_src		uint8 = 13
+	oxm_tcp_dst		uint8 = 14
+	oxm_udp_src		uint8 = 15
+	oxm_udp_dst		uint8 = 16
+	oxm_ipv6_src	uint8 = 26
+	oxm_ipv6_dst	uint8 = 27
+)
+
+/*
+	Match criteria. Fields set to their 'any' value (see Mk_of_match) are wildcarded.
+	Prerequisites (eth type for IP fields, ip proto for ports) must be set by the caller.
+*/
+type Of_match struct {
+	In_port		uint32				// 0 == any
+	Eth_src		string				// "" == any
+	Eth_dst		string
+	Eth_type	uint16				// 0 == any
+	Vlan_vid	int					// -1 == any
+	Ip_dscp		int					// -1 == any (dscp value, not tos)
+	Ip_proto	int					// -1 == any
+	Ip_src		string				// v4 or v6 address; "" == any
+	Ip_dst		string
+	Tp_src		int					// -1 == any; tcp or udp based on Ip_proto
+	Tp_dst		int
+	Has_meta	bool
+	Metadata	uint64
+	Meta_mask	uint64
+}
+
+/*
+	An action or instruction in wire format.
+*/
+type Of_action []byte
+type Of_instruction []byte
+
+/*
+	A flow-mod.
+*/
+type Of_flow struct {
+	Command			uint8
+	Table			uint8
+	Priority		uint16
+	Cookie			uint64
+	Cookie_mask		uint64			// used on delete
+	Idle_timeout	uint16
+	Hard_timeout	uint16
+	Flags			uint16
+	Match			*Of_match
+	Insts			[]Of_instruction
+}
+
+/*
+	A flow returned by Dump_flows.
+*/
+type Of_flow_stats struct {
+	Table			uint8
+	Priority		uint16
+	Cookie			uint64
+	Idle_timeout	uint16
+	Hard_timeout	uint16
+	Duration		uint32
+	Packets			uint64
+	Bytes			uint64
+	Match			*Of_match
+	Insts			[]byte			// raw instructions
+}
+
+/*
+	A group and its buckets. For a select group the switch picks a bucket for each flow
+	(a hash of the packet's headers) in proportion to the bucket weights.
+*/
+type Of_bucket struct {
+	Weight			uint16
+	Actions			[]Of_action
+}
+
+type Of_group struct {
+	Id				uint32
+	Type			uint8
+	Buckets			[]*Of_bucket
+}
+
+type Of_conn struct {
+	conn	net.Conn
+	mu		sync.Mutex
+	xid		uint32
+	target	string
+	Timeout	time.Duration
+}
+
+func Mk_of_match( ) ( *Of_match ) {
+	return &Of_match{ Vlan_vid: -1, Ip_dscp: -1, Ip_proto: -1, Tp_src: -1, Tp_dst: -1 }
+}
+
+// ---------------- encoding --------------------------------------------------------------
+
+func oxm_hdr( field uint8, has_mask bool, length int ) ( []byte ) {
+	b := make( []byte, 4 )
+	binary.BigEndian.PutUint16( b, ofp_oxm_basic )
+	b[2] = field << 1
+	if has_mask {
+		b[2] |= 1
+	}
+	b[3] = uint8( length )
+	return b
+}
+
+func oxm_u8( field uint8, v uint8 ) ( []byte ) {
+	return append( oxm_hdr( field, false, 1 ), v )
+}
+
+func oxm_u16( field uint8, v uint16 ) ( []byte ) {
+	b := make( []byte, 2 )
+	binary.BigEndian.PutUint16( b, v )
+	return append( oxm_hdr( field, false, 2 ), b... )
+}
+
+func oxm_u32( field uint8, v uint32 ) ( []byte ) {
+	b := make( []byte, 4 )
+	binary.BigEndian.PutUint32( b, v )
+	return append( oxm_hdr( field, false, 4 ), b... )
+}
+
+func oxm_bytes( field uint8, v []byte ) ( []byte ) {
+	return append( oxm_hdr( field, false, len( v ) ), v... )
+}
+
+/*
+	Convert a mac string (with or without colons) to bytes.
+*/
+func of_mac( s string ) ( []byte, error ) {
+	hs := strings.Replace( s, ":", "", -1 )
+	if len( hs ) != 12 {
+		return nil, fmt.Errorf( "bad mac address: %s", s )
+	}
+	b := make( []byte, 6 )
+	for i := 0; i < 6; i++ {
+		var v uint8
+		if _, err := fmt.Sscanf( hs[i*2:i*2+2], "%02x", &v ); err != nil {
+			return nil, fmt.Errorf( "bad mac address: %s", s )
+		}
+		b[i] = v
+	}
+	return b, nil
+}
+
+func pad8( n int ) ( int ) {
+	return (n + 7) / 8 * 8
+}
+
+/*
+	Encode the match (ofp_match with OXM fields, padded to a multiple of 8).
+*/
+func ( m *Of_match ) encode( ) ( []byte, error ) {
+	oxm := &bytes.Buffer{ }
+
+	if m != nil {
+		if m.In_port != 0 {
+			oxm.Write( oxm_u32( oxm_in_port, m.In_port ) )
+		}
+		if m.Has_meta {
+			b := make( []byte, 16 )
+			binary.BigEndian.PutUint64( b, m.Metadata )
+			binary.BigEndian.PutUint64( b[8:], m.Meta_mask )
+			oxm.Write( append( oxm_hdr( oxm_metadata, true, 16 ), b... ) )
+		}
+		if m.Eth_dst != "" {
+			mac, err := of_mac( m.Eth_dst )
+			if err != nil {
+				return nil, err
+			}
+			oxm.Write( oxm_bytes( oxm_eth_dst, mac ) )
+		}
+		if m.Eth_src != "" {
+			mac, err := of_mac( m.Eth_src )
+			if err != nil {
+				return nil, err
+			}
+			oxm.Write( oxm_bytes( oxm_eth_src, mac ) )
+		}
+		if m.Eth_type != 0 {
+			oxm.Write( oxm_u16( oxm_eth_type, m.Eth_type ) )
+		}
+		if m.Vlan_vid >= 0 {
+			oxm.Write( oxm_u16( oxm_vlan_vid, uint16( m.Vlan_vid ) | OFPVID_PRESENT ) )
+		}
+		if m.Ip_dscp >= 0 {
+			oxm.Write( oxm_u8( oxm_ip_dscp, uint8( m.Ip_dscp ) ) )
+		}
+		if m.Ip_proto >= 0 {
+			oxm.Write( oxm_u8( oxm_ip_proto, uint8( m.Ip_proto ) ) )
+		}
+		for i, a := range []string{ m.Ip_src, m.Ip_dst } {
+			if a == "" {
+				continue
+			}
+			ip := net.ParseIP( strings.Trim( a, "[]" ) )
+			if ip == nil {
+				return nil, fmt.Errorf( "bad ip address: %s", a )
+			}
+			if ip4 := ip.To4(); ip4 != nil {
+				oxm.Write( oxm_bytes( oxm_ipv4_src + uint8( i ), ip4 ) )
+			} else {
+				oxm.Write( oxm_bytes( oxm_ipv6_src + uint8( i ), ip.To16() ) )
+			}
+		}
+		if m.Tp_src >= 0 || m.Tp_dst >= 0 {
+			base := oxm_tcp_src
+			if m.Ip_proto == 17 {
+				base = oxm_udp_src
+			} else {
+				if m.Ip_proto != 6 {
+					return nil, fmt.Errorf( "transport port match requires tcp or udp protocol" )
+				}
+			}
+			if m.Tp_src >= 0 {
+				oxm.Write( oxm_u16( base, uint16( m.Tp_src ) ) )
+			}
+			if m.Tp_dst >= 0 {
+				oxm.Write( oxm_u16( base + 1, uint16( m.Tp_dst ) ) )
+			}
+		}
+	}
+
+	mlen := 4 + oxm.Len( )
+	b := make( []byte, pad8( mlen ) )
+	binary.BigEndian.PutUint16( b, 1 )						// OFPMT_OXM
+	binary.BigEndian.PutUint16( b[2:], uint16( mlen ) )
+	copy( b[4:], oxm.Bytes() )
+	return b, nil
+}
+
+/*
+	Decode an ofp_match; returns the match and the number of bytes consumed (with padding).
+	Fields we do not know are skipped.
+*/
+func of_decode_match( b []byte ) ( m *Of_match, used int, err error ) {
+	if len( b ) < 4 {
+		return nil, 0, fmt.Errorf( "short match" )
+	}
+	mlen := int( binary.BigEndian.Uint16( b[2:] ) )
+	if mlen < 4 || len( b ) < mlen {
+		return nil, 0, fmt.Errorf( "bad match length: %d", mlen )
+	}
+
+	m = Mk_of_match( )
+	src_dst := func( v []byte, dst bool ) {
+		if dst {
+			m.Ip_dst = net.IP( v ).String()
+		} else {
+			m.Ip_src = net.IP( v ).String()
+		}
+	}
+
+	for i := 4; i + 4 <= mlen; {
+		field := b[i+2] >> 1
+		has_mask := b[i+2] & 1 == 1
+		flen := int( b[i+3] )
+		if i + 4 + flen > mlen {
+			return nil, 0, fmt.Errorf( "bad oxm length" )
+		}
+		v := b[i+4:i+4+flen]
+
+		if binary.BigEndian.Uint16( b[i:] ) == ofp_oxm_basic {
+			switch field {
+				case oxm_in_port:	m.In_port = binary.BigEndian.Uint32( v )
+				case oxm_metadata:
+					m.Has_meta = true
+					m.Metadata = binary.BigEndian.Uint64( v )
+					m.Meta_mask = 0xffffffffffffffff
+					if has_mask {
+						m.Meta_mask = binary.BigEndian.Uint64( v[8:] )
+					}
+				case oxm_eth_dst:	m.Eth_dst = net.HardwareAddr( v[0:6] ).String()
+				case oxm_eth_src:	m.Eth_src = net.HardwareAddr( v[0:6] ).String()
+				case oxm_eth_type:	m.Eth_type = binary.BigEndian.Uint16( v )
+				case oxm_vlan_vid:	m.Vlan_vid = int( binary.BigEndian.Uint16( v ) &^ OFPVID_PRESENT )
+				case oxm_ip_dscp:	m.Ip_dscp = int( v[0] )
+				case oxm_ip_proto:	m.Ip_proto = int( v[0] )
+				case oxm_ipv4_src, oxm_ipv6_src:	src_dst( v[0:flen], false )
+				case oxm_ipv4_dst, oxm_ipv6_dst:	src_dst( v[0:flen], true )
+				case oxm_tcp_src, oxm_udp_src:	m.Tp_src = int( binary.BigEndian.Uint16( v ) )
+				case oxm_tcp_dst, oxm_udp_dst:	m.Tp_dst = int( binary.BigEndian.Uint16( v ) )
+			}
+		}
+		i += 4 + flen
+	}
+
+	return m, pad8( mlen ), nil
+}
+
+// ---------------- actions and instructions -----------------------------------------------
+
+func of_tl( t uint16, length int ) ( []byte ) {
+	b := make( []byte, length )
+	binary.BigEndian.PutUint16( b, t )
+	binary.BigEndian.PutUint16( b[2:], uint16( length ) )
+	return b
+}
+
+func Of_act_output( port uint32 ) ( Of_action ) {
+	b := of_tl( 0, 16 )
+	binary.BigEndian.PutUint32( b[4:], port )
+	binary.BigEndian.PutUint16( b[8:], 0xffff )				// max_len: send whole packet if to controller
+	return b
+}
+
+func Of_act_set_queue( q uint32 ) ( Of_action ) {
+	b := of_tl( 21, 8 )
+	binary.BigEndian.PutUint32( b[4:], q )
+	return b
+}
+
+func Of_act_group( id uint32 ) ( Of_action ) {
+	b := of_tl( 22, 8 )
+	binary.BigEndian.PutUint32( b[4:], id )
+	return b
+}
+
+func Of_act_push_vlan( ) ( Of_action ) {
+	b := of_tl( 17, 8 )
+	binary.BigEndian.PutUint16( b[4:], 0x8100 )
+	return b
+}
+
+func Of_act_pop_vlan( ) ( Of_action ) {
+	return of_tl( 18, 8 )
+}
+
+func of_set_field( oxm []byte ) ( Of_action ) {
+	b := of_tl( 25, pad8( 4 + len( oxm ) ) )
+	copy( b[4:], oxm )
+	return b
+}
+
+/*
+	Set the DSCP value (not the TOS value; i.e. 46 not 184).
+*/
+func Of_act_set_dscp( dscp uint8 ) ( Of_action ) {
+	return of_set_field( oxm_u8( oxm_ip_dscp, dscp ) )
+}
+
+/*
+	Set the metadata 'in line' so that it is seen by a following resubmit (OVS extension to 1.3).
+*/
+func Of_act_set_meta( v uint64 ) ( Of_action ) {
+	b := make( []byte, 8 )
+	binary.BigEndian.PutUint64( b, v )
+	return of_set_field( oxm_bytes( oxm_metadata, b ) )
+}
+
+func Of_act_set_vlan( vid uint16 ) ( Of_action ) {
+	return of_set_field( oxm_u16( oxm_vlan_vid, vid | OFPVID_PRESENT ) )
+}
+
+func Of_act_set_eth_dst( mac string ) ( Of_action, error ) {
+	b, err := of_mac( mac )
+	if err != nil {
+		return nil, err
+	}
+	return of_set_field( oxm_bytes( oxm_eth_dst, b ) ), nil
+}
+
+/*
+	Nicira resubmit to table (resubmit(,table)) using the in port.
+*/
+func Of_act_resubmit( table uint8 ) ( Of_action ) {
+	b := of_tl( 0xffff, 16 )
+	binary.BigEndian.PutUint32( b[4:], ofp_nx_vendor )
+	binary.BigEndian.PutUint16( b[8:], 14 )					// NXAST_RESUBMIT_TABLE
+	binary.BigEndian.PutUint16( b[10:], 0xfff8 )			// OFPP_IN_PORT (1.0 numbering)
+	b[12] = table
+	return b
+}
+
+func Of_inst_apply( acts ...Of_action ) ( Of_instruction ) {
+	n := 8
+	for _, a := range acts {
+		n += len( a )
+	}
+	b := of_tl( 4, n )
+	i := 8
+	for _, a := range acts {
+		copy( b[i:], a )
+		i += len( a )
+	}
+	return b
+}
+
+func Of_inst_goto( table uint8 ) ( Of_instruction ) {
+	b := of_tl( 1, 8 )
+	b[4] = table
+	return b
+}
+
+func Of_inst_write_meta( v uint64, mask uint64 ) ( Of_instruction ) {
+	b := of_tl( 2, 24 )
+	binary.BigEndian.PutUint64( b[8:], v )
+	binary.BigEndian.PutUint64( b[16:], mask )
+	return b
+}
+
+/*
+	Meter instruction; must precede the other instructions of the flow.
+*/
+func Of_inst_meter( id uint32 ) ( Of_instruction ) {
+	b := of_tl( 6, 8 )
+	binary.BigEndian.PutUint32( b[4:], id )
+	return b
+}
+
+// ---------------- rendering --------------------------------------------------------------
+
+/*
+	Render the match in ovs-ofctl syntax (wildcarded fields omitted).
+*/
+func ( m *Of_match ) String( ) ( string ) {
+	if m == nil {
+		return ""
+	}
+
+	f := make( []string, 0, 12 )
+	if m.In_port != 0 {
+		f = append( f, fmt.Sprintf( "in_port=%d", m.In_port ) )
+	}
+	if m.Eth_src != "" {
+		f = append( f, "dl_src=" + m.Eth_src )
+	}
+	if m.Eth_dst != "" {
+		f = append( f, "dl_dst=" + m.Eth_dst )
+	}
+	if m.Eth_type != 0 {
+		f = append( f, fmt.Sprintf( "dl_type=0x%04x", m.Eth_type ) )
+	}
+	if m.Vlan_vid >= 0 {
+		f = append( f, fmt.Sprintf( "dl_vlan=%d", m.Vlan_vid ) )
+	}
+	if m.Ip_dscp >= 0 {
+		f = append( f, fmt.Sprintf( "ip_dscp=%d", m.Ip_dscp ) )
+	}
+	if m.Ip_proto >= 0 {
+		f = append( f, fmt.Sprintf( "nw_proto=%d", m.Ip_proto ) )
+	}
+	if m.Ip_src != "" {
+		f = append( f, "nw_src=" + m.Ip_src )
+	}
+	if m.Ip_dst != "" {
+		f = append( f, "nw_dst=" + m.Ip_dst )
+	}
+	if m.Tp_src >= 0 {
+		f = append( f, fmt.Sprintf( "tp_src=%d", m.Tp_src ) )
+	}
+	if m.Tp_dst >= 0 {
+		f = append( f, fmt.Sprintf( "tp_dst=%d", m.Tp_dst ) )
+	}
+	if m.Has_meta {
+		f = append( f, fmt.Sprintf( "metadata=0x%x/0x%x", m.Metadata, m.Meta_mask ) )
+	}
+
+	return strings.Join( f, "," )
+}
+
+/*
+	Render a set-field oxm as value->field.
+*/
+func of_oxm_str( oxm []byte ) ( string ) {
+	if len( oxm ) < 4 || len( oxm ) < 4 + int( oxm[3] ) {
+		return "?"
+	}
+	v := oxm[4:4+int( oxm[3] )]
+
+	switch oxm[2] >> 1 {
+		case oxm_ip_dscp:	return fmt.Sprintf( "%d->ip_dscp", v[0] )
+		case oxm_metadata:	return fmt.Sprintf( "0x%x->metadata", binary.BigEndian.Uint64( v ) )
+		case oxm_vlan_vid:	return fmt.Sprintf( "%d->vlan_vid", binary.BigEndian.Uint16( v ) &^ OFPVID_PRESENT )
+		case oxm_eth_dst:	return fmt.Sprintf( "%s->eth_dst", net.HardwareAddr( v[0:6] ) )
+	}
+
+	return fmt.Sprintf( "0x%x->field%d", v, oxm[2] >> 1 )
+}
+
+/*
+	Render an action list (the body of an apply-actions instruction) in ovs-ofctl syntax.
+	Only the actions that this package builds are known; others are shown by type.
+*/
+func of_actions_str( b []byte ) ( string ) {
+	a := make( []string, 0, 4 )
+	for i := 0; i + 4 <= len( b ); {
+		atype := binary.BigEndian.Uint16( b[i:] )
+		alen := int( binary.BigEndian.Uint16( b[i+2:] ) )
+		if alen < 8 || i + alen > len( b ) {
+			a = append( a, "?" )
+			break
+		}
+		act := b[i:i+alen]
+
+		switch atype {
+			case 0:
+				switch port := binary.BigEndian.Uint32( act[4:] ); port {
+					case OFPP_NORMAL:	a = append( a, "NORMAL" )
+					case OFPP_IN_PORT:	a = append( a, "IN_PORT" )
+					default:			a = append( a, fmt.Sprintf( "output:%d", port ) )
+				}
+			case 17:	a = append( a, fmt.Sprintf( "push_vlan:0x%04x", binary.BigEndian.Uint16( act[4:] ) ) )
+			case 18:	a = append( a, "pop_vlan" )
+			case 21:	a = append( a, fmt.Sprintf( "set_queue:%d", binary.BigEndian.Uint32( act[4:] ) ) )
+			case 22:	a = append( a, fmt.Sprintf( "group:%d", binary.BigEndian.Uint32( act[4:] ) ) )
+			case 25:	a = append( a, "set_field:" + of_oxm_str( act[4:] ) )
+			case 0xffff:
+				if alen >= 16 && binary.BigEndian.Uint32( act[4:] ) == ofp_nx_vendor && binary.BigEndian.Uint16( act[8:] ) == 14 {
+					a = append( a, fmt.Sprintf( "resubmit(,%d)", act[12] ) )
+				} else {
+					a = append( a, "experimenter" )
+				}
+			default:
+				a = append( a, fmt.Sprintf( "action%d", atype ) )
+		}
+		i += alen
+	}
+
+	return strings.Join( a, "," )
+}
+
+/*
+	Render the flow in a form close to that of ovs-ofctl dump-flows:
+		table=n, priority=n, cookie=0x.., hard_timeout=n, match actions=...
+*/
+func ( f *Of_flow ) String( ) ( string ) {
+	if f == nil {
+		return ""
+	}
+
+	acts := make( []string, 0, 2 )
+	for _, inst := range f.Insts {
+		if len( inst ) < 8 {
+			continue
+		}
+		switch binary.BigEndian.Uint16( inst ) {
+			case 1:	acts = append( acts, fmt.Sprintf( "goto_table:%d", inst[4] ) )
+			case 2:
+				if len( inst ) >= 24 {
+					acts = append( acts, fmt.Sprintf( "write_metadata:0x%x/0x%x", binary.BigEndian.Uint64( inst[8:] ), binary.BigEndian.Uint64( inst[16:] ) ) )
+				}
+			case 4:	acts = append( acts, of_actions_str( inst[8:] ) )
+			case 6:	acts = append( acts, fmt.Sprintf( "meter:%d", binary.BigEndian.Uint32( inst[4:] ) ) )
+		}
+	}
+	if len( acts ) == 0 {
+		acts = append( acts, "drop" )
+	}
+
+	return fmt.Sprintf( "table=%d, priority=%d, cookie=0x%x, hard_timeout=%d, %s actions=%s",
+		f.Table, f.Priority, f.Cookie, f.Hard_timeout, f.Match, strings.Join( acts, "," ) )
+}
+
+/*
+	Returns true if the raw instructions (e.g. from flow stats) are the same as the flow's.
+*/
+func ( f *Of_flow ) Same_insts( raw []byte ) ( bool ) {
+	if f == nil {
+		return false
+	}
+
+	b := make( []byte, 0, len( raw ) )
+	for _, inst := range f.Insts {
+		b = append( b, inst... )
+	}
+	return bytes.Equal( b, raw )
+}
+
+// ---------------- messages --------------------------------------------------------------
+
+func of_msg( mtype uint8, xid uint32, body []byte ) ( []byte ) {
+	b := make( []byte, 8 + len( body ) )
+	b[0] = OFP_VERSION
+	b[1] = mtype
+	binary.BigEndian.PutUint16( b[2:], uint16( len( b ) ) )
+	binary.BigEndian.PutUint32( b[4:], xid )
+	copy( b[8:], body )
+	return b
+}
+
+/*
+	Encode the flow as a complete flow-mod message.
+*/
+func ( f *Of_flow ) Encode( xid uint32 ) ( []byte, error ) {
+	match, err := f.Match.encode( )
+	if err != nil {
+		return nil, err
+	}
+
+	body := make( []byte, 40 )
+	binary.BigEndian.PutUint64( body, f.Cookie )
+	binary.BigEndian.PutUint64( body[8:], f.Cookie_mask )
+	body[16] = f.Table
+	body[17] = f.Command
+	binary.BigEndian.PutUint16( body[18:], f.Idle_timeout )
+	binary.BigEndian.PutUint16( body[20:], f.Hard_timeout )
+	binary.BigEndian.PutUint16( body[22:], f.Priority )
+	binary.BigEndian.PutUint32( body[24:], OFP_NO_BUFFER )
+	binary.BigEndian.PutUint32( body[28:], OFPP_ANY )
+	binary.BigEndian.PutUint32( body[32:], OFPG_ANY )
+	binary.BigEndian.PutUint16( body[36:], f.Flags )
+
+	body = append( body, match... )
+	for _, inst := range f.Insts {
+		body = append( body, inst... )
+	}
+
+	return of_msg( OFPT_FLOW_MOD, xid, body ), nil
+}
+
+/*
+	Encode a meter-mod for the meter: a single drop band at the rate (kbit/s) with the burst
+	(kbit) if one is given. Only the id is used for a delete.
+*/
+func ( m *Of_meter ) Encode( xid uint32, cmd uint16 ) ( []byte ) {
+	flags := ofpmf_kbps
+	if m.Burst > 0 {
+		flags |= ofpmf_burst
+	}
+
+	blen := 8
+	if cmd != OFPMC_DELETE {
+		blen += 16
+	}
+	body := make( []byte, blen )
+	binary.BigEndian.PutUint16( body, cmd )
+	binary.BigEndian.PutUint16( body[2:], flags )
+	binary.BigEndian.PutUint32( body[4:], m.Id )
+	if cmd != OFPMC_DELETE {
+		binary.BigEndian.PutUint16( body[8:], 1 )				// OFPMBT_DROP
+		binary.BigEndian.PutUint16( body[10:], 16 )
+		binary.BigEndian.PutUint32( body[12:], m.Rate )
+		binary.BigEndian.PutUint32( body[16:], m.Burst )
+	}
+
+	return of_msg( OFPT_METER_MOD, xid, body )
+}
+
+/*
+	Render the group in ovs-ofctl add-group syntax.
+*/
+func ( g *Of_group ) String( ) ( string ) {
+	if g == nil {
+		return ""
+	}
+
+	t := "all"
+	if g.Type == OFPGT_SELECT {
+		t = "select"
+	}
+	s := fmt.Sprintf( "group_id=%d, type=%s", g.Id, t )
+	for _, bk := range g.Buckets {
+		s += fmt.Sprintf( ", bucket=weight:%d,", bk.Weight )
+		for _, a := range bk.Actions {
+			s += of_actions_str( a ) + ","
+		}
+		s = strings.TrimRight( s, "," )
+	}
+	return s
+}
+
+/*
+	Encode a group-mod for the group. Only the id is used for a delete.
+*/
+func ( g *Of_group ) Encode( xid uint32, cmd uint16 ) ( []byte ) {
+	body := make( []byte, 8 )
+	binary.BigEndian.PutUint16( body, cmd )
+	body[2] = g.Type
+	binary.BigEndian.PutUint32( body[4:], g.Id )
+
+	if cmd != OFPGC_DELETE {
+		for _, bk := range g.Buckets {
+			blen := 16
+			for _, a := range bk.Actions {
+				blen += len( a )
+			}
+			b := make( []byte, 16, blen )
+			binary.BigEndian.PutUint16( b, uint16( blen ) )
+			binary.BigEndian.PutUint16( b[2:], bk.Weight )
+			binary.BigEndian.PutUint32( b[4:], OFPP_ANY )			// watch port/group are used only by fast-failover groups
+			binary.BigEndian.PutUint32( b[8:], OFPG_ANY )
+			for _, a := range bk.Actions {
+				b = append( b, a... )
+			}
+			body = append( body, b... )
+		}
+	}
+
+	return of_msg( OFPT_GROUP_MOD, xid, body )
+}
+
+// ---------------- connection ------------------------------------------------------------
+
+/*
+	Connect to the bridge and exchange hellos.
+*/
+func Mk_ofconn( target string ) ( oc *Of_conn, err error ) {
+	toks := strings.SplitN( target, ":", 2 )
+	if len( toks ) != 2 || toks[1] == "" {
+		return nil, fmt.Errorf( "openflow: bad target: %s (expected unix:path or tcp:host:port)", target )
+	}
+	if toks[0] != "unix" && toks[0] != "tcp" {
+		return nil, fmt.Errorf( "openflow: unsupported target type: %s", toks[0] )
+	}
+
+	conn, err := net.DialTimeout( toks[0], toks[1], OF_TIMEOUT )
+	if err != nil {
+		return nil, fmt.Errorf( "openflow: unable to connect to %s: %s", target, err )
+	}
+
+	oc, err = Mk_ofconn_conn( conn )
+	if oc != nil {
+		oc.target = target
+	}
+	return oc, err
+}
+
+/*
+	Use an open connection (e.g. one end of net.Pipe()); sends our hello and waits for the
+	peer's hello, failing if the peer does not speak 1.3.
+*/
+func Mk_ofconn_conn( conn net.Conn ) ( oc *Of_conn, err error ) {
+	oc = &Of_conn{ conn: conn, target: conn.RemoteAddr().String(), Timeout: OF_TIMEOUT }
+
+	conn.SetDeadline( time.Now().Add( oc.Timeout ) )
+	defer conn.SetDeadline( time.Time{} )
+
+	errch := make( chan error, 1 )
+	go func( ) {
+		_, werr := conn.Write( of_msg( OFPT_HELLO, oc.next_xid(), nil ) )
+		errch <- werr
+	}( )
+
+	mtype, ver, _, _, err := oc.read_msg( )
+	if err == nil {
+		err = <- errch
+	}
+	if err != nil {
+		conn.Close( )
+		return nil, fmt.Errorf( "openflow: %s: hello failed: %s", oc.target, err )
+	}
+	if mtype != OFPT_HELLO || ver < OFP_VERSION {
+		conn.Close( )
+		return nil, fmt.Errorf( "openflow: %s: peer does not support openflow 1.3 (version %d type %d)", oc.target, ver, mtype )
+	}
+
+	return oc, nil
+}
+
+func ( oc *Of_conn ) Close( ) {
+	if oc != nil && oc.conn != nil {
+		oc.conn.Close( )
+	}
+}
+
+func ( oc *Of_conn ) next_xid( ) ( uint32 ) {
+	oc.xid++
+	return oc.xid
+}
+
+/*
+	Read one message. Returns type, version, xid and body.
+*/
+func ( oc *Of_conn ) read_msg( ) ( mtype uint8, ver uint8, xid uint32, body []byte, err error ) {
+	hdr := make( []byte, 8 )
+	if _, err = io.ReadFull( oc.conn, hdr ); err != nil {
+		return
+	}
+
+	mlen := int( binary.BigEndian.Uint16( hdr[2:] ) )
+	if mlen < 8 {
+		err = fmt.Errorf( "bad message length: %d", mlen )
+		return
+	}
+	body = make( []byte, mlen - 8 )
+	if _, err = io.ReadFull( oc.conn, body ); err != nil {
+		return
+	}
+
+	return hdr[1], hdr[0], binary.BigEndian.Uint32( hdr[4:] ), body, nil
+}
+
+/*
+	Send the messages then read until the reply of type rtype with the last xid arrives.
+	Errors for any of the xids are collected. Multipart reply bodies (for the final xid) are
+	returned. Echo requests are answered while waiting.
+*/
+func ( oc *Of_conn ) exchange( msgs [][]byte, xids []uint32, rtype uint8 ) ( replies [][]byte, err error ) {
+	oc.conn.SetDeadline( time.Now().Add( oc.Timeout ) )
+	defer oc.conn.SetDeadline( time.Time{} )
+
+	werr := make( chan error, 1 )
+	go func( ) {										// write from a goroutine so a peer which replies as it reads cannot block us
+		for _, m := range msgs {
+			if _, err := oc.conn.Write( m ); err != nil {
+				werr <- err
+				return
+			}
+		}
+		werr <- nil
+	}( )
+
+	want := make( map[uint32]int )
+	for i, x := range xids {
+		want[x] = i
+	}
+	last := xids[len( xids ) - 1]
+
+	errs := make( []string, 0 )
+	for {
+		mtype, _, xid, body, rerr := oc.read_msg( )
+		if rerr != nil {
+			return nil, fmt.Errorf( "openflow: %s: read failed: %s", oc.target, rerr )
+		}
+
+		switch mtype {
+			case OFPT_ECHO_REQUEST:
+				oc.conn.Write( of_msg( OFPT_ECHO_REPLY, xid, body ) )
+
+			case OFPT_ERROR:
+				if idx, ok := want[xid]; ok {
+					etype, ecode := uint16( 0 ), uint16( 0 )
+					if len( body ) >= 4 {
+						etype = binary.BigEndian.Uint16( body )
+						ecode = binary.BigEndian.Uint16( body[2:] )
+					}
+					errs = append( errs, fmt.Sprintf( "message %d rejected: %s", idx, of_err_str( etype, ecode ) ) )
+					if xid == last {
+						<- werr
+						return nil, fmt.Errorf( "openflow: %s: %s", oc.target, strings.Join( errs, "; " ) )
+					}
+				}
+
+			default:
+				if xid != last || mtype != rtype {
+					continue
+				}
+
+				if mtype == OFPT_MULTIPART_REP {
+					replies = append( replies, body )
+					if len( body ) >= 4 && binary.BigEndian.Uint16( body[2:] ) & 1 == 1 {		// OFPMPF_REPLY_MORE
+						continue
+					}
+				} else {
+					replies = append( replies, body )
+				}
+
+				if e := <- werr; e != nil {
+					return nil, fmt.Errorf( "openflow: %s: write failed: %s", oc.target, e )
+				}
+				if len( errs ) > 0 {
+					return replies, fmt.Errorf( "openflow: %s: %s", oc.target, strings.Join( errs, "; " ) )
+				}
+				return replies, nil
+		}
+	}
+}
+
+/*
+	Return a readable error for the error type/code pairs most likely to be seen.
+*/
+func of_err_str( etype uint16, ecode uint16 ) ( string ) {
+	names := map[uint16]string{ 1: "bad request", 2: "bad action", 3: "bad instruction", 4: "bad match", 5: "flow-mod failed", 6: "group-mod failed", 12: "meter-mod failed", 17: "bundle failed" }
+	n := names[etype]
+	if n == "" {
+		n = "error"
+	}
+	return fmt.Sprintf( "%s (type=%d code=%d)", n, etype, ecode )
+}
+
+/*
+	Send the flow-mods followed by a barrier and wait for the barrier reply. Flow-mods are
+	applied individually; if some fail the others remain.
+*/
+func ( oc *Of_conn ) Add_flows( flows ...*Of_flow ) ( error ) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	msgs := make( [][]byte, 0, len( flows ) + 1 )
+	xids := make( []uint32, 0, len( flows ) + 1 )
+	for _, f := range flows {
+		x := oc.next_xid()
+		m, err := f.Encode( x )
+		if err != nil {
+			return fmt.Errorf( "openflow: unable to encode flow-mod: %s", err )
+		}
+		msgs = append( msgs, m )
+		xids = append( xids, x )
+	}
+
+	x := oc.next_xid()
+	msgs = append( msgs, of_msg( OFPT_BARRIER_REQ, x, nil ) )
+	xids = append( xids, x )
+
+	_, err := oc.exchange( msgs, xids, OFPT_BARRIER_REP )
+	return err
+}
+
+/*
+	Delete all flows in the table (OFPTT_ALL for every table) which match the cookie/mask and
+	which are at least as specific as the match (nil matches all flows).
+*/
+func ( oc *Of_conn ) Delete_flows( table uint8, cookie uint64, mask uint64, m *Of_match ) ( error ) {
+	return oc.Add_flows( &Of_flow{ Command: OFPFC_DELETE, Table: table, Cookie: cookie, Cookie_mask: mask, Match: m } )
+}
+
+func of_bundle_ctl( xid uint32, id uint32, ctype uint16 ) ( []byte ) {
+	b := make( []byte, 16 )
+	binary.BigEndian.PutUint32( b, ofp_onf_exp )
+	binary.BigEndian.PutUint32( b[4:], ofp_bundle_ctl )
+	binary.BigEndian.PutUint32( b[8:], id )
+	binary.BigEndian.PutUint16( b[12:], ctype )
+	binary.BigEndian.PutUint16( b[14:], 3 )					// atomic | ordered
+	return of_msg( OFPT_EXPERIMENTER, xid, b )
+}
+
+/*
+	Install the flows as a single bundle: either all are installed or none are. The
+	bundle is discarded if anything fails before the commit.
+*/
+func ( oc *Of_conn ) Bundle( flows ...*Of_flow ) ( err error ) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	id := oc.next_xid()									// any unique id will do
+
+	x := oc.next_xid()
+	if _, err = oc.exchange( [][]byte{ of_bundle_ctl( x, id, 0 ) }, []uint32{ x }, OFPT_EXPERIMENTER ); err != nil {		// open
+		return fmt.Errorf( "openflow: bundle open: %s", err )
+	}
+
+	msgs := make( [][]byte, 0, len( flows ) + 1 )
+	xids := make( []uint32, 0, len( flows ) + 1 )
+	for _, f := range flows {
+		x = oc.next_xid()
+		fm, eerr := f.Encode( x )
+		if eerr != nil {
+			err = fmt.Errorf( "openflow: unable to encode flow-mod: %s", eerr )
+			break
+		}
+
+		b := make( []byte, 16 )
+		binary.BigEndian.PutUint32( b, ofp_onf_exp )
+		binary.BigEndian.PutUint32( b[4:], ofp_bundle_add )
+		binary.BigEndian.PutUint32( b[8:], id )
+		binary.BigEndian.PutUint16( b[14:], 3 )
+		msgs = append( msgs, of_msg( OFPT_EXPERIMENTER, x, append( b, fm... ) ) )
+		xids = append( xids, x )
+	}
+
+	if err == nil {
+		x = oc.next_xid()
+		msgs = append( msgs, of_msg( OFPT_BARRIER_REQ, x, nil ) )
+		xids = append( xids, x )
+		_, err = oc.exchange( msgs, xids, OFPT_BARRIER_REP )		// adds are validated as they are added
+	}
+
+	if err != nil {
+		x = oc.next_xid()
+		oc.exchange( [][]byte{ of_bundle_ctl( x, id, 6 ) }, []uint32{ x }, OFPT_EXPERIMENTER )		// discard; nothing was installed
+		return err
+	}
+
+	x = oc.next_xid()
+	if _, err = oc.exchange( [][]byte{ of_bundle_ctl( x, id, 4 ) }, []uint32{ x }, OFPT_EXPERIMENTER ); err != nil {		// commit
+		return fmt.Errorf( "openflow: bundle commit: %s", err )
+	}
+
+	return nil
+}
+
+/*
+	Return the flows in the table (OFPTT_ALL for all tables) which match cookie/mask
+	(mask of 0 returns all flows).
+*/
+func ( oc *Of_conn ) Dump_flows( table uint8, cookie uint64, mask uint64 ) ( flows []*Of_flow_stats, err error ) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	match, _ := Mk_of_match().encode()
+	body := make( []byte, 40 )
+	binary.BigEndian.PutUint16( body, OFPMP_FLOW )
+	body[8] = table
+	binary.BigEndian.PutUint32( body[12:], OFPP_ANY )
+	binary.BigEndian.PutUint32( body[16:], OFPG_ANY )
+	binary.BigEndian.PutUint64( body[24:], cookie )
+	binary.BigEndian.PutUint64( body[32:], mask )
+	body = append( body, match... )
+
+	x := oc.next_xid()
+	replies, err := oc.exchange( [][]byte{ of_msg( OFPT_MULTIPART_REQ, x, body ) }, []uint32{ x }, OFPT_MULTIPART_REP )
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range replies {
+		for i := 8; i + 48 <= len( r ); {
+			elen := int( binary.BigEndian.Uint16( r[i:] ) )
+			if elen < 48 || i + elen > len( r ) {
+				return flows, fmt.Errorf( "openflow: %s: bad flow stats length: %d", oc.target, elen )
+			}
+			e := r[i:i+elen]
+
+			fs := &Of_flow_stats {
+				Table:			e[2],
+				Duration:		binary.BigEndian.Uint32( e[4:] ),
+				Priority:		binary.BigEndian.Uint16( e[12:] ),
+				Idle_timeout:	binary.BigEndian.Uint16( e[14:] ),
+				Hard_timeout:	binary.BigEndian.Uint16( e[16:] ),
+				Cookie:			binary.BigEndian.Uint64( e[24:] ),
+				Packets:		binary.BigEndian.Uint64( e[32:] ),
+				Bytes:			binary.BigEndian.Uint64( e[40:] ),
+			}
+			m, used, merr := of_decode_match( e[48:] )
+			if merr != nil {
+				return flows, fmt.Errorf( "openflow: %s: flow stats: %s", oc.target, merr )
+			}
+			fs.Match = m
+			fs.Insts = e[48+used:]
+
+			flows = append( flows, fs )
+			i += elen
+		}
+	}
+
+	return flows, nil
+}
+
+/*
+	Send a multipart request of the type with the body and return the reply bodies with
+	the multipart header removed.
+*/
+func ( oc *Of_conn ) multipart( mptype uint16, body []byte ) ( replies [][]byte, err error ) {
+	req := make( []byte, 8 )
+	binary.BigEndian.PutUint16( req, mptype )
+	req = append( req, body... )
+
+	x := oc.next_xid()
+	mp, err := oc.exchange( [][]byte{ of_msg( OFPT_MULTIPART_REQ, x, req ) }, []uint32{ x }, OFPT_MULTIPART_REP )
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range mp {
+		if len( r ) >= 8 {
+			replies = append( replies, r[8:] )
+		}
+	}
+
+	return replies, nil
+}
+
+/*
+	Return the maximum number of meters the bridge supports; 0 means meters are not
+	supported (e.g. an older kernel datapath).
+*/
+func ( oc *Of_conn ) Meter_features( ) ( max uint32, err error ) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	replies, err := oc.multipart( OFPMP_METER_FEATURES, nil )
+	if err != nil {
+		return 0, err
+	}
+	for _, r := range replies {
+		if len( r ) >= 4 {
+			max = binary.BigEndian.Uint32( r )
+		}
+	}
+
+	return max, nil
+}
+
+/*
+	Return the meters configured on the bridge (the first drop band of each).
+*/
+func ( oc *Of_conn ) Dump_meters( ) ( meters []*Of_meter, err error ) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	body := make( []byte, 8 )
+	binary.BigEndian.PutUint32( body, OFPM_ALL )
+	replies, err := oc.multipart( OFPMP_METER_CONFIG, body )
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range replies {
+		for i := 0; i + 8 <= len( r ); {
+			elen := int( binary.BigEndian.Uint16( r[i:] ) )
+			if elen < 8 || i + elen > len( r ) {
+				return meters, fmt.Errorf( "openflow: %s: bad meter config length: %d", oc.target, elen )
+			}
+			e := r[i:i+elen]
+
+			m := &Of_meter{ Id: binary.BigEndian.Uint32( e[4:] ) }
+			if elen >= 24 {
+				m.Rate = binary.BigEndian.Uint32( e[12:] )
+				m.Burst = binary.BigEndian.Uint32( e[16:] )
+			}
+			meters = append( meters, m )
+			i += elen
+		}
+	}
+
+	return meters, nil
+}
+
+/*
+	Make the bridge's meters match the list: existing meters are modified, new ones added
+	and meters not in the list whose id is not more than prune_max are deleted (flows using
+	a deleted meter are removed by the switch); 0 prunes nothing, which leaves meters that
+	something else manages alone. A barrier follows the meter-mods.
+*/
+func ( oc *Of_conn ) Set_meters( meters []*Of_meter, prune_max uint32 ) ( error ) {
+	cur, err := oc.Dump_meters( )
+	if err != nil {
+		return err
+	}
+
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	have := make( map[uint32]bool )
+	for _, m := range cur {
+		have[m.Id] = true
+	}
+	want := make( map[uint32]bool )
+
+	msgs := make( [][]byte, 0, len( meters ) + 1 )
+	xids := make( []uint32, 0, len( meters ) + 1 )
+	for _, m := range meters {
+		cmd := OFPMC_ADD
+		if have[m.Id] {
+			cmd = OFPMC_MODIFY
+		}
+		want[m.Id] = true
+		x := oc.next_xid()
+		msgs = append( msgs, m.Encode( x, cmd ) )
+		xids = append( xids, x )
+	}
+	if prune_max > 0 {
+		for _, m := range cur {
+			if ! want[m.Id] && m.Id <= prune_max {
+				x := oc.next_xid()
+				msgs = append( msgs, m.Encode( x, OFPMC_DELETE ) )
+				xids = append( xids, x )
+			}
+		}
+	}
+
+	x := oc.next_xid()
+	msgs = append( msgs, of_msg( OFPT_BARRIER_REQ, x, nil ) )
+	xids = append( xids, x )
+
+	_, err = oc.exchange( msgs, xids, OFPT_BARRIER_REP )
+	return err
+}
+
+/*
+	Send a single group-mod followed by a barrier.
+*/
+func ( oc *Of_conn ) group_mod( g *Of_group, cmd uint16 ) ( error ) {
+	oc.mu.Lock()
+	defer oc.mu.Unlock()
+
+	x := oc.next_xid()
+	bx := oc.next_xid()
+	_, err := oc.exchange( [][]byte{ g.Encode( x, cmd ), of_msg( OFPT_BARRIER_REQ, bx, nil ) }, []uint32{ x, bx }, OFPT_BARRIER_REP )
+	return err
+}
+
+/*
+	Add the group, or replace its buckets if it already exists. Flows referencing the group
+	are not affected by a modify.
+*/
+func ( oc *Of_conn ) Set_group( g *Of_group ) ( err error ) {
+	err = oc.group_mod( g, OFPGC_ADD )
+	if err != nil && strings.Contains( err.Error(), of_err_str( 6, 0 ) ) {		// OFPGMFC_GROUP_EXISTS
+		err = oc.group_mod( g, OFPGC_MODIFY )
+	}
+	return err
+}
+
+/*
+	Delete the group. The switch also removes flows which reference it. Deleting a group that
+	does not exist is not an error.
+*/
+func ( oc *Of_conn ) Delete_group( id uint32 ) ( error ) {
+	return oc.group_mod( &Of_group{ Id: id }, OFPGC_DELETE )
+}
@@ -0,0 +1,438 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	openflow_test
+	Abstract:	Tests for the openflow client and reservation flow builders using an
+				in-process fake switch (one end of a net.Pipe). The fake keeps the flows
+				added (directly or via a committed bundle) and returns them on a flow
+				stats request; a strict delete removes the flows it matches exactly. A
+				flow-mod with a priority of 666 is rejected.
+	Date:		18 Oct 2026
+*/
+
+package gizmos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+)
+
+type fake_switch struct {
+	flows	[][]byte					// flow-mod bodies installed
+	pending	[][]byte					// flow-mods in the open bundle
+	commits	int
+}
+
+func ( f *fake_switch ) serve( conn net.Conn ) {
+	out := make( chan []byte, 64 )
+	go func( ) {
+		for m := range out {
+			conn.Write( m )
+		}
+	}( )
+	defer close( out )
+
+	oc := &Of_conn{ conn: conn }
+	out <- of_msg( OFPT_HELLO, 0, nil )
+
+	for {
+		mtype, _, xid, body, err := oc.read_msg( )
+		if err != nil {
+			return
+		}
+
+		out <- of_msg( OFPT_ECHO_REQUEST, 99, nil )		// should be answered and otherwise ignored
+
+		switch mtype {
+			case OFPT_FLOW_MOD:
+				switch {
+					case f.reject( body ):
+						out <- of_msg( OFPT_ERROR, xid, []byte{ 0, 5, 0, 1 } )
+
+					case body[17] == OFPFC_DELETE_STRICT:
+						f.del_strict( body )
+
+					default:
+						f.flows = append( f.flows, body )
+				}
+
+			case OFPT_BARRIER_REQ:
+				out <- of_msg( OFPT_BARRIER_REP, xid, nil )
+
+			case OFPT_EXPERIMENTER:
+				switch binary.BigEndian.Uint32( body[4:] ) {
+					case ofp_bundle_ctl:
+						ctype := binary.BigEndian.Uint16( body[12:] )
+						switch ctype {
+							case 0:	f.pending = nil
+							case 4:
+								f.flows = append( f.flows, f.pending... )
+								f.pending = nil
+								f.commits++
+							case 6:	f.pending = nil
+						}
+						reply := append( []byte{ }, body... )
+						binary.BigEndian.PutUint16( reply[12:], ctype + 1 )
+						out <- of_msg( OFPT_EXPERIMENTER, xid, reply )
+
+					case ofp_bundle_add:
+						fm := body[24:]									// skip bundle header and the embedded message header
+						if f.reject( fm ) {
+							out <- of_msg( OFPT_ERROR, xid, []byte{ 0, 5, 0, 1 } )
+						} else {
+							f.pending = append( f.pending, fm )
+						}
+				}
+
+			case OFPT_MULTIPART_REQ:
+				for i, fm := range f.flows {
+					match, used, _ := of_decode_match( fm[40:] )
+					_ = match
+					e := make( []byte, 48 )
+					binary.BigEndian.PutUint16( e, uint16( 48 + len( fm ) - 40 ) )
+					e[2] = fm[16]
+					copy( e[12:], fm[22:24] )							// priority
+					copy( e[16:], fm[20:22] )							// hard timeout
+					copy( e[24:], fm[0:8] )								// cookie
+					e = append( e, fm[40:40+used]... )
+					e = append( e, fm[40+used:]... )
+
+					hdr := make( []byte, 8 )
+					binary.BigEndian.PutUint16( hdr, OFPMP_FLOW )
+					if i < len( f.flows ) - 1 {
+						hdr[3] = 1										// more to come
+					}
+					out <- of_msg( OFPT_MULTIPART_REP, xid, append( hdr, e... ) )
+				}
+		}
+	}
+}
+
+/*
+	Remove the flows with the same table, priority, cookie and match as the strict delete.
+*/
+func ( f *fake_switch ) del_strict( fm []byte ) {
+	_, used, _ := of_decode_match( fm[40:] )
+	key := string( fm[0:8] ) + string( fm[16:17] ) + string( fm[22:24] ) + string( fm[40:40+used] )
+
+	kept := f.flows[:0]
+	for _, ff := range f.flows {
+		_, fused, _ := of_decode_match( ff[40:] )
+		if string( ff[0:8] ) + string( ff[16:17] ) + string( ff[22:24] ) + string( ff[40:40+fused] ) != key {
+			kept = append( kept, ff )
+		}
+	}
+	f.flows = kept
+}
+
+func ( f *fake_switch ) reject( fm []byte ) ( bool ) {
+	return binary.BigEndian.Uint16( fm[22:] ) == 666
+}
+
+func mk_fake_switch( t *testing.T ) ( *fake_switch, *Of_conn ) {
+	f := &fake_switch{ }
+	c1, c2 := net.Pipe()
+	go f.serve( c2 )
+
+	oc, err := Mk_ofconn_conn( c1 )
+	if err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: connect: %s\n", err )
+		t.Fail()
+		return f, nil
+	}
+	return f, oc
+}
+
+func Test_of_match( t *testing.T ) {
+	m := Mk_of_match()
+	m.Eth_src = "fa:16:3e:00:00:01"
+	m.Eth_type = 0x0800
+	m.Vlan_vid = 42
+	m.Ip_proto = 6
+	m.Ip_dst = "10.1.2.3"
+	m.Tp_dst = 443
+	m.Has_meta = true
+	m.Meta_mask = 0x7
+
+	b, err := m.encode( )
+	if err != nil || len( b ) % 8 != 0 {
+		fmt.Fprintf( os.Stderr, "FAIL: encode: %v len=%d\n", err, len( b ) )
+		t.Fail()
+		return
+	}
+
+	d, used, err := of_decode_match( b )
+	if err != nil || used != len( b ) || d.Eth_src != m.Eth_src || d.Vlan_vid != 42 || d.Ip_dst != "10.1.2.3" ||
+		d.Tp_dst != 443 || d.Tp_src != -1 || d.Meta_mask != 0x7 || d.Eth_type != 0x0800 {
+		fmt.Fprintf( os.Stderr, "FAIL: decoded match differs: %+v err=%v\n", d, err )
+		t.Fail()
+	}
+
+	m.Ip_proto = 1
+	if _, err := m.encode( ); err == nil {
+		fmt.Fprintf( os.Stderr, "FAIL: port match without tcp/udp was accepted\n" )
+		t.Fail()
+	}
+}
+
+func Test_of_res_flows( t *testing.T ) {
+	parms := map[string]string {
+		"smac": "fa:16:3e:00:00:01", "dmac": "fa:16:3e:00:00:02", "extip": "", "extdir": "", "vlan_match": "",
+		"koe": "false", "sproto": "", "dproto": "tcp:80", "timeout": "90000", "dscp": "184", "oneswitch": "false", "ipv6": "false",
+	}
+
+	flows, err := Of_bw_flows( parms )
+	if err != nil || len( flows ) != 2 {
+		fmt.Fprintf( os.Stderr, "FAIL: bw flows: %d %v\n", len( flows ), err )
+		t.Fail()
+		return
+	}
+	in, out := flows[0], flows[1]
+	if in.Priority != 455 || out.Priority != 405 || in.Cookie != OF_COOKIE_BW || int( out.Hard_timeout ) != OF_MAX_HTO ||
+		in.Match.Tp_src != 80 || out.Match.Tp_dst != 80 || in.Match.Eth_dst != parms["smac"] {
+		fmt.Fprintf( os.Stderr, "FAIL: bw flows not as expected: in=%+v out=%+v\n", in, out )
+		t.Fail()
+	}
+
+	parms["queue"] = "3"
+	flows, _ = Of_bw_flows( parms )
+	if len( flows ) != 2 || ! of_has_action( flows[0], Of_act_set_queue( 3 ) ) || ! of_has_action( flows[1], Of_act_set_queue( 3 ) ) {
+		fmt.Fprintf( os.Stderr, "FAIL: bw flows do not set the queue\n" )
+		t.Fail()
+	}
+	parms["meter"] = "7"
+	flows, _ = Of_bw_flows( parms )
+	if len( flows ) != 2 || of_has_action( flows[1], Of_act_set_queue( 3 ) ) || ! strings.Contains( flows[1].String(), "meter:7" ) {
+		fmt.Fprintf( os.Stderr, "FAIL: metered bw flow not as expected: %s\n", flows[1] )
+		t.Fail()
+	}
+	delete( parms, "meter" )
+	if flows, _ = Of_bwow_flows( map[string]string{ "smac": "fa:16:3e:00:00:01", "dmac": "fa:16:3e:00:00:02", "queue": "5" } ); len( flows ) != 1 || ! of_has_action( flows[0], Of_act_set_queue( 5 ) ) {
+		fmt.Fprintf( os.Stderr, "FAIL: oneway flow does not set the queue\n" )
+		t.Fail()
+	}
+	delete( parms, "queue" )
+
+	parms["oneswitch"] = "true"
+	parms["vlan_match"] = "12"
+	if flows, _ = Of_bw_flows( parms ); len( flows ) != 1 || flows[0].Priority != 410 {
+		fmt.Fprintf( os.Stderr, "FAIL: one switch bw flows not as expected: %d\n", len( flows ) )
+		t.Fail()
+	}
+
+	if _, err = Of_bwow_flows( map[string]string{ "smac": "fa:16:3e:00:00:01" } ); err == nil {
+		fmt.Fprintf( os.Stderr, "FAIL: oneway without dest accepted\n" )
+		t.Fail()
+	}
+
+	flows, err = Of_pt_flows( map[string]string{ "smac": "fa:16:3e:00:00:01", "sip": "udp:10.0.0.1:53", "timeout": "0" } )
+	if err != nil || flows[0].Hard_timeout != 0 || flows[0].Match.Ip_proto != 17 || flows[0].Match.Tp_src != 53 || flows[0].Match.Ip_src != "10.0.0.1" {
+		fmt.Fprintf( os.Stderr, "FAIL: passthru flow not as expected: %v\n", err )
+		t.Fail()
+	}
+}
+
+func Test_of_flow_string( t *testing.T ) {
+	flows, _ := Of_bw_flows( map[string]string{ "smac": "fa:16:3e:00:00:01", "dmac": "fa:16:3e:00:00:02", "dproto": "tcp:80", "timeout": "60", "dscp": "184" } )
+	if len( flows ) < 1 {
+		fmt.Fprintf( os.Stderr, "FAIL: no flows to render\n" )
+		t.Fail()
+		return
+	}
+
+	s := flows[0].String()
+	for _, want := range []string{ "priority=455", "cookie=0xb0ff", "hard_timeout=60", "dl_dst=fa:16:3e:00:00:01", "tp_src=80",
+			"metadata=0x0/0x7", "set_field:0->ip_dscp", "set_field:0x1->metadata", "resubmit(,0)" } {
+		if ! strings.Contains( s, want ) {
+			fmt.Fprintf( os.Stderr, "FAIL: rendered flow missing %s: %s\n", want, s )
+			t.Fail()
+		}
+	}
+}
+
+/*
+	Bundle installs all or nothing; dump returns what was installed.
+*/
+func Test_of_bundle( t *testing.T ) {
+	f, oc := mk_fake_switch( t )
+	if oc == nil {
+		return
+	}
+	defer oc.Close( )
+
+	flows, _ := Of_bw_flows( map[string]string{ "smac": "fa:16:3e:00:00:01", "dmac": "fa:16:3e:00:00:02", "extip": "10.1.1.1", "timeout": "60", "dscp": "184" } )
+	if err := oc.Bundle( flows... ); err != nil || f.commits != 1 || len( f.flows ) != 2 {
+		fmt.Fprintf( os.Stderr, "FAIL: bundle: err=%v commits=%d flows=%d\n", err, f.commits, len( f.flows ) )
+		t.Fail()
+		return
+	}
+
+	bad := *flows[0]
+	bad.Priority = 666
+	if err := oc.Bundle( flows[1], &bad ); err == nil || f.commits != 1 || len( f.flows ) != 2 {
+		fmt.Fprintf( os.Stderr, "FAIL: rejected bundle was applied: err=%v commits=%d flows=%d\n", err, f.commits, len( f.flows ) )
+		t.Fail()
+	}
+
+	if err := oc.Add_flows( &bad ); err == nil {
+		fmt.Fprintf( os.Stderr, "FAIL: rejected flow-mod did not return an error\n" )
+		t.Fail()
+	}
+
+	stats, err := oc.Dump_flows( OFPTT_ALL, OF_COOKIE_BW, 0xffff )
+	if err != nil || len( stats ) != 2 {
+		fmt.Fprintf( os.Stderr, "FAIL: dump: err=%v n=%d\n", err, len( stats ) )
+		t.Fail()
+		return
+	}
+	if stats[0].Cookie != OF_COOKIE_BW || stats[0].Priority != 450 || stats[0].Hard_timeout != 60 || stats[0].Match.Ip_dst != "10.1.1.1" ||
+		stats[1].Match.Ip_src != "10.1.1.1" || stats[1].Match.Eth_src != "fa:16:3e:00:00:01" {
+		fmt.Fprintf( os.Stderr, "FAIL: dumped flows not as expected: %+v %+v\n", stats[0], stats[1].Match )
+		t.Fail()
+	}
+	if ! flows[0].Same_insts( stats[0].Insts ) || flows[0].Same_insts( stats[1].Insts ) {
+		fmt.Fprintf( os.Stderr, "FAIL: dumped instructions did not compare as expected\n" )
+		t.Fail()
+	}
+}
+
+/*
+	Returns true if one of the flow's instructions carries the action.
+*/
+func of_has_action( f *Of_flow, a Of_action ) ( bool ) {
+	for _, inst := range f.Insts {
+		if bytes.Contains( inst, a ) {
+			return true
+		}
+	}
+	return false
+}
+
+
+func Test_of_strict_deletes( t *testing.T ) {
+	r1 := map[string]string{ "smac": "fa:16:3e:00:00:01", "dmac": "fa:16:3e:00:00:02", "dproto": "tcp:80", "timeout": "0" }
+	r2 := map[string]string{ "smac": "fa:16:3e:00:00:01", "dmac": "fa:16:3e:00:00:02", "dproto": "tcp:443", "timeout": "0" }
+	f1, _ := Of_bw_flows( r1 )
+	f2, _ := Of_bw_flows( r2 )
+
+	dels := Of_strict_deletes( f1 )
+	if len( dels ) != len( f1 ) || dels[0].Command != OFPFC_DELETE_STRICT || dels[0].Priority != f1[0].Priority || dels[0].Cookie_mask != 0xffffffffffffffff {
+		fmt.Fprintf( os.Stderr, "FAIL: strict deletes not as expected: %+v\n", dels[0] )
+		t.Fail()
+	}
+	if s := Of_strict_del_str( dels[1] ); ! strings.Contains( s, "priority=405," ) || ! strings.Contains( s, "tp_dst=80" ) || ! strings.Contains( s, fmt.Sprintf( "cookie=0x%x/-1", OF_COOKIE_BW ) ) {
+		fmt.Fprintf( os.Stderr, "FAIL: ovs-ofctl strict delete not as expected: %s\n", s )
+		t.Fail()
+	}
+
+	_, oc := mk_fake_switch( t )
+	if oc == nil {
+		return
+	}
+	defer oc.Close()
+
+	if err := oc.Add_flows( append( f1, f2... )... ); err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: add flows: %s\n", err )
+		t.FailNow()
+	}
+	if err := oc.Add_flows( dels... ); err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: strict delete: %s\n", err )
+		t.FailNow()
+	}
+
+	fl, err := oc.Dump_flows( OFPTT_ALL, OF_COOKIE_BW, 0xffffffffffffffff )
+	if err != nil || len( fl ) != 2 {
+		fmt.Fprintf( os.Stderr, "FAIL: expected the other reservation's two flows to remain, have %d: %v\n", len( fl ), err )
+		t.FailNow()
+	}
+	for _, fs := range fl {
+		if fs.Match.Tp_dst != 443 && fs.Match.Tp_src != 443 {
+			fmt.Fprintf( os.Stderr, "FAIL: flow of the deleted reservation remains: %s\n", fs.Match )
+			t.Fail()
+		}
+	}
+}
+
+/*
+	A split reservation's outbound flow sends to a weighted select group.
+*/
+func Test_of_split_group( t *testing.T ) {
+	parms := map[string]string{ "smac": "fa:16:3e:00:00:01", "dmac": "fa:16:3e:00:00:02", "timeout": "60", "dscp": "184", "group": "3/2/600000 5/4/200000", "group_id": "0xb000123" }
+
+	g, err := Of_bw_group( parms )
+	if err != nil || g == nil || g.Id != OF_GROUP_BW | 0x123 || len( g.Buckets ) != 2 || g.Buckets[0].Weight != 750 || g.Buckets[1].Weight != 250 {
+		fmt.Fprintf( os.Stderr, "FAIL: group not as expected: %v %s\n", err, g )
+		t.Fail()
+		return
+	}
+	if s := g.String(); ! strings.Contains( s, "type=select" ) || ! strings.Contains( s, "set_queue:2,output:3" ) || ! strings.Contains( s, "set_queue:4,output:5" ) {
+		fmt.Fprintf( os.Stderr, "FAIL: group string not as expected: %s\n", s )
+		t.Fail()
+	}
+	if b := g.Encode( 1, OFPGC_ADD ); len( b ) != 16 + 40 + 40 || b[1] != OFPT_GROUP_MOD {
+		fmt.Fprintf( os.Stderr, "FAIL: group-mod length not as expected: %d\n", len( b ) )
+		t.Fail()
+	}
+
+	flows, _ := Of_bw_flows( parms )
+	if len( flows ) != 2 {
+		fmt.Fprintf( os.Stderr, "FAIL: expected two bw flows, got %d\n", len( flows ) )
+		t.Fail()
+		return
+	}
+	if s := flows[1].String(); ! strings.Contains( s, fmt.Sprintf( "group:%d", g.Id ) ) || strings.Contains( s, "resubmit" ) {
+		fmt.Fprintf( os.Stderr, "FAIL: outbound flow does not send to the group: %s\n", s )
+		t.Fail()
+	}
+
+	if _, err = Of_bw_group( map[string]string{ "smac": "fa:16:3e:00:00:01", "dmac": "fa:16:3e:00:00:02", "group": "3/2", "group_id": "0xb000123" } ); err == nil {
+		fmt.Fprintf( os.Stderr, "FAIL: bad group bucket accepted\n" )
+		t.Fail()
+	}
+	if _, err = Of_bw_group( map[string]string{ "smac": "fa:16:3e:00:00:01", "dmac": "fa:16:3e:00:00:02", "group": "3/2/600000 -128/4/200000", "group_id": "0xb000123" } ); err == nil {
+		fmt.Fprintf( os.Stderr, "FAIL: late binding group bucket accepted\n" )
+		t.Fail()
+	}
+	for _, gid := range []string{ "", "0xe000123" } {						// missing, or not a split group id
+		if _, err = Of_bw_group( map[string]string{ "group": "3/2/600000 5/4/200000", "group_id": gid } ); err == nil {
+			fmt.Fprintf( os.Stderr, "FAIL: group with a bad id accepted: %q\n", gid )
+			t.Fail()
+		}
+	}
+
+	ports := map[string]*Ovs_port {
+		"qvo1": &Ovs_port{ Name: "qvo1", Bridge: OF_RES_BRIDGE, Ofports: []int{ 3 } },
+		"eth1": &Ovs_port{ Name: "eth1", Bridge: "br-eth1", Ofports: []int{ 5 } },
+	}
+	if err = Of_bw_group_ports( "3/2/600000", ports ); err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: bridge port rejected: %s\n", err )
+		t.Fail()
+	}
+	if err = Of_bw_group_ports( parms["group"], ports ); err == nil {
+		fmt.Fprintf( os.Stderr, "FAIL: port not on %s accepted\n", OF_RES_BRIDGE )
+		t.Fail()
+	}
+}
+
@@ -0,0 +1,487 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	ovs_qos
+	Abstract:	QoS and Queue management using the OVSDB client. This replaces what the
+				create_ovs_queues and purge_ovs_queues scripts do with ovs-vsctl: the QoS
+				and Queue rows for a set of ports are created, replaced or removed in a
+				single transaction, so a host is never left with half of a queue setup.
+
+				QoS rows created here are marked with external_ids:tegu=<owner> and only those
+				rows (and their queues) are ever replaced or purged by the same owner; QoS that
+				was set up by hand, or by something else, is left alone. Owners allow the
+				reservation queues and the intermediate bridge queues to be managed separately.
+
+				Ovs_parse_qdata() converts the queue strings that Tegu sends to agents
+				(switch/port,res-id,queue,min,max,priority[,burst[,meter]]) into a per port specification.
+				The QoS type, and how the queue settings are expressed, follows the queue
+				policy (qpolicy.go) when one is applied; otherwise HTB is used.
+
+	Date:		18 Oct 2026
+*/
+
+package gizmos
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	OVS_QOS_TYPE	string = "linux-htb"
+	OVS_MAX_RATE	int64 = 10000000000			// default max rate for a port's QoS (10G)
+	OVS_Q0_PRI		int = 1500					// priority of the generated best effort queue (larger is lower)
+
+	OVS_OWN_RES		string = "res"				// owner of reservation (endpoint) queues
+	OVS_OWN_IMED	string = "intermed"			// owner of intermediate bridge queues
+)
+
+/*
+	Settings for a single queue.
+*/
+type Ovs_queue struct {
+	Min		int64
+	Max		int64
+	Pri		int
+	Burst	int64								// 0 == ovs default
+	Meter	int									// meter id tegu allocated to the reservation; 0 == use the queue number
+}
+
+/*
+	QoS for a port: the overall max rate and the queues by queue number.
+*/
+type Ovs_qos struct {
+	Type		string							// QoS type; "" is OVS_QOS_TYPE
+	Max_rate	int64
+	Queues		map[int]*Ovs_queue
+}
+
+/*
+	What we know about a port from the database.
+*/
+type Ovs_port struct {
+	Name	string
+	Uuid	string
+	Bridge	string
+	Dpid	string								// bridge's datapath id (no colons, lower case)
+	Ofports	[]int								// openflow port number of each interface
+	Macs	[]string							// attached-mac and mac_in_use of each interface (no colons, lower case)
+	Qos		string								// uuid of the QoS row, "" if none
+}
+
+func Mk_ovs_qos( max_rate int64 ) ( *Ovs_qos ) {
+	if max_rate <= 0 {
+		max_rate = OVS_MAX_RATE
+	}
+	return &Ovs_qos{ Max_rate: max_rate, Queues: make( map[int]*Ovs_queue ) }
+}
+
+/*
+	Normalise a mac or dpid: colons removed and letters in lower case.
+*/
+func ovs_norm_id( s string ) ( string ) {
+	return strings.ToLower( strings.Replace( s, ":", "", -1 ) )
+}
+
+/*
+	Read the bridges, ports and interfaces and return the ports by name.
+*/
+func ( o *Ovsdb ) Ports( ) ( ports map[string]*Ovs_port, err error ) {
+	res, err := o.Transact( OVS_DB,
+		Ovs_select( "Bridge", nil, "name", "datapath_id", "ports" ),
+		Ovs_select( "Port", nil, "_uuid", "name", "interfaces", "qos" ),
+		Ovs_select( "Interface", nil, "_uuid", "ofport", "mac_in_use", "external_ids" ) )
+	if err != nil {
+		return nil, err
+	}
+
+	ifaces := make( map[string]map[string]interface{} )
+	for _, row := range res[2].Rows {
+		ifaces[Ovs_uuid_val( row["_uuid"] )] = row
+	}
+
+	ports = make( map[string]*Ovs_port )
+	by_uuid := make( map[string]*Ovs_port )
+	for _, row := range res[1].Rows {
+		p := &Ovs_port{ Uuid: Ovs_uuid_val( row["_uuid"] ) }
+		p.Name, _ = row["name"].( string )
+		for _, q := range Ovs_set_vals( row["qos"] ) {
+			p.Qos = Ovs_uuid_val( q )
+		}
+
+		for _, iv := range Ovs_set_vals( row["interfaces"] ) {
+			irow := ifaces[Ovs_uuid_val( iv )]
+			if irow == nil {
+				continue
+			}
+			for _, of := range Ovs_set_vals( irow["ofport"] ) {
+				if f, ok := of.( float64 ); ok {
+					p.Ofports = append( p.Ofports, int( f ) )
+				}
+			}
+			for _, m := range Ovs_set_vals( irow["mac_in_use"] ) {
+				if s, ok := m.( string ); ok && s != "" {
+					p.Macs = append( p.Macs, ovs_norm_id( s ) )
+				}
+			}
+			if m, ok := Ovs_map_vals( irow["external_ids"] )["attached-mac"].( string ); ok {
+				p.Macs = append( p.Macs, ovs_norm_id( m ) )
+			}
+		}
+
+		ports[p.Name] = p
+		by_uuid[p.Uuid] = p
+	}
+
+	for _, row := range res[0].Rows {
+		bname, _ := row["name"].( string )
+		dpid := ""
+		for _, d := range Ovs_set_vals( row["datapath_id"] ) {
+			dpid, _ = d.( string )
+		}
+		for _, pv := range Ovs_set_vals( row["ports"] ) {
+			if p := by_uuid[Ovs_uuid_val( pv )]; p != nil {
+				p.Bridge = bname
+				p.Dpid = ovs_norm_id( dpid )
+			}
+		}
+	}
+
+	return ports, nil
+}
+
+/*
+	Return all tegu created QoS rows (uuid to owner), and for those belonging to owner the
+	queue uuids that each references.
+*/
+func ( o *Ovsdb ) tegu_qos( owner string ) ( all map[string]string, qos map[string][]string, err error ) {
+	res, err := o.Transact( OVS_DB, Ovs_select( "QoS", nil, "_uuid", "queues", "external_ids" ) )
+	if err != nil {
+		return nil, nil, err
+	}
+
+	all = make( map[string]string )
+	qos = make( map[string][]string )
+	for _, row := range res[0].Rows {
+		own, ok := Ovs_map_vals( row["external_ids"] )["tegu"].( string )
+		if ! ok {
+			continue
+		}
+		all[Ovs_uuid_val( row["_uuid"] )] = own
+		if own != owner {
+			continue
+		}
+
+		qlist := make( []string, 0 )
+		for _, qv := range Ovs_map_vals( row["queues"] ) {
+			if u := Ovs_uuid_val( qv ); u != "" {
+				qlist = append( qlist, u )
+			}
+		}
+		qos[Ovs_uuid_val( row["_uuid"] )] = qlist
+	}
+
+	return all, qos, nil
+}
+
+/*
+	Build the operations which insert the queues and QoS for a port and point the port
+	at the new QoS.  Idx makes the named uuids unique within the transaction.
+*/
+func ovs_qos_ops( port string, spec *Ovs_qos, idx int, owner string ) ( ops []Ovs_op ) {
+	qtype := spec.Type
+	if qtype == "" {
+		qtype = OVS_QOS_TYPE
+	}
+	mech := QP_HTB
+	for m, t := range qp_qos_types {
+		if t == qtype {
+			mech = m
+		}
+	}
+
+	qmap := make( map[int]interface{} )
+	for qnum, q := range spec.Queues {
+		oc := Qp_queue_config( mech, q )
+
+		name := fmt.Sprintf( "tq%d_%d", idx, qnum )
+		ops = append( ops, Ovs_insert( "Queue", map[string]interface{} {
+				"other_config":	Ovs_smap( oc ),
+				"external_ids":	Ovs_smap( map[string]string{ "tegu": owner } ),
+			}, name ) )
+		qmap[qnum] = Ovs_named( name )
+	}
+
+	qname := fmt.Sprintf( "tqos%d", idx )
+	ops = append( ops, Ovs_insert( "QoS", map[string]interface{} {
+			"type":			qtype,
+			"other_config":	Ovs_smap( map[string]string{ "max-rate": strconv.FormatInt( spec.Max_rate, 10 ) } ),
+			"queues":		Ovs_imap( qmap ),
+			"external_ids":	Ovs_smap( map[string]string{ "tegu": owner } ),
+		}, qname ) )
+
+	ops = append( ops, Ovs_update( "Port", [][]interface{}{ Ovs_cond( "name", "==", port ) }, map[string]interface{}{ "qos": Ovs_named( qname ) } ) )
+	return ops
+}
+
+/*
+	Make the owner's QoS on the host match the specification: each port in the map gets
+	exactly the queues listed, and every other port with QoS from the same owner has it
+	removed. The owner's old QoS and Queue rows are deleted.  All of this is done in one
+	transaction which fails if any affected port's QoS was changed by someone else
+	after we read it.  An empty (or nil) map purges all of the owner's queues.
+*/
+func ( o *Ovsdb ) Set_qos( spec map[string]*Ovs_qos, owner string ) ( err error ) {
+	ports, err := o.Ports( )
+	if err != nil {
+		return err
+	}
+	all, tqos, err := o.tegu_qos( owner )
+	if err != nil {
+		return err
+	}
+
+	for name := range spec {
+		if ports[name] == nil {
+			return fmt.Errorf( "ovsdb: %s: port not found: %s", o.target, name )
+		}
+	}
+
+	ops := []Ovs_op{ Ovs_comment( "tegu: set qos" ) }
+	idx := 0
+	for name, p := range ports {
+		s := spec[name]
+		owned := p.Qos != "" && tqos[p.Qos] != nil
+
+		if s == nil && ! owned {
+			continue						// not ours and nothing to add
+		}
+		if s != nil && p.Qos != "" && ! owned {
+			if all[p.Qos] != "" {
+				return fmt.Errorf( "ovsdb: %s: port %s has tegu %s QoS; not replaced with %s QoS", o.target, name, all[p.Qos], owner )
+			}
+			return fmt.Errorf( "ovsdb: %s: port %s has QoS which was not created by tegu; not replaced", o.target, name )
+		}
+
+		cur := Ovs_set( )				// guard against a change since we read the port
+		if p.Qos != "" {
+			cur = Ovs_uuid( p.Qos )
+		}
+		ops = append( ops, Ovs_wait( "Port", [][]interface{}{ Ovs_cond( "_uuid", "==", Ovs_uuid( p.Uuid ) ) }, []string{ "qos" }, []map[string]interface{}{ { "qos": cur } } ) )
+
+		if s != nil {
+			ops = append( ops, ovs_qos_ops( name, s, idx, owner )... )
+			idx++
+		} else {
+			ops = append( ops, Ovs_update( "Port", [][]interface{}{ Ovs_cond( "_uuid", "==", Ovs_uuid( p.Uuid ) ) }, map[string]interface{}{ "qos": Ovs_set( ) } ) )
+		}
+	}
+
+	for quuid, qlist := range tqos {			// every old tegu qos/queue goes; those still needed were recreated above
+		ops = append( ops, Ovs_delete( "QoS", [][]interface{}{ Ovs_cond( "_uuid", "==", Ovs_uuid( quuid ) ) } ) )
+		for _, u := range qlist {
+			ops = append( ops, Ovs_delete( "Queue", [][]interface{}{ Ovs_cond( "_uuid", "==", Ovs_uuid( u ) ) } ) )
+		}
+	}
+
+	if len( ops ) == 1 {
+		return nil							// nothing to do
+	}
+
+	_, err = o.Transact( OVS_DB, ops... )
+	return err
+}
+
+/*
+	Return the number of QoS rows, and queues they reference, that were created for the owner.
+*/
+func ( o *Ovsdb ) Qos_count( owner string ) ( nqos int, nqueues int, err error ) {
+	_, qos, err := o.tegu_qos( owner )
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, ql := range qos {
+		nqueues += len( ql )
+	}
+	return len( qos ), nqueues, nil
+}
+
+/*
+	Remove all QoS and queues created for the owner.
+*/
+func ( o *Ovsdb ) Purge_qos( owner string ) ( error ) {
+	return o.Set_qos( nil, owner )
+}
+
+/*
+	Build the specification for intermediate bridge queues: a priority queue (1) and a best
+	effort queue (0) on every port of every bridge other than br-int and those in exclude.
+	The bridge's internal port is skipped. Rates are in bits per second.
+*/
+func Ovs_intermed_spec( ports map[string]*Ovs_port, exclude []string, min int64, max int64 ) ( spec map[string]*Ovs_qos ) {
+	spec = make( map[string]*Ovs_qos )
+
+	skip := map[string]bool{ "br-int": true }
+	for _, b := range exclude {
+		skip[b] = true
+	}
+
+	for name, p := range ports {
+		if p.Bridge == "" || skip[p.Bridge] || name == p.Bridge {
+			continue
+		}
+
+		s := Mk_ovs_qos( max )
+		s.Queues[1] = &Ovs_queue{ Min: min, Max: max, Pri: 200 }
+		s.Queues[0] = &Ovs_queue{ Min: min, Max: max, Pri: OVS_Q0_PRI }
+		spec[name] = s
+	}
+
+	return spec
+}
+
+/*
+	Parse the queue strings sent by Tegu into a per port QoS specification for the ports on
+	this host. Each string is switch/port,res-id,queue,min,max,priority with an optional
+	trailing burst (bits, may be empty) and meter id. The switch is either a
+	bridge's datapath id, or the host name (in which case br-int is implied); the port is an
+	openflow port number, a mac address (the VM's port) or -128 meaning all ports whose
+	name is in outward (e.g. qosirl0). Entries for switches not on this host are ignored;
+	malformed entries are returned as errors but do not stop processing.
+*/
+func Ovs_parse_qdata( qdata []string, host string, ports map[string]*Ovs_port, outward []string, max_rate int64 ) ( spec map[string]*Ovs_qos, errs []error ) {
+	spec = make( map[string]*Ovs_qos )
+	if i := strings.Index( host, "." ); i > 0 {
+		host = host[0:i]
+	}
+
+	is_outward := func( name string ) ( bool ) {
+		for _, o := range outward {
+			if o == name || (strings.HasSuffix( o, "*" ) && strings.HasPrefix( name, o[0:len(o)-1] )) {
+				return true
+			}
+		}
+		return false
+	}
+
+	add := func( p *Ovs_port, qnum int, q *Ovs_queue ) {
+		s := spec[p.Name]
+		if s == nil {
+			s = Mk_ovs_qos( max_rate )
+			spec[p.Name] = s
+		}
+		s.Queues[qnum] = q
+	}
+
+	for _, qd := range qdata {
+		toks := strings.Split( qd, "," )
+		if len( toks ) < 6 {
+			errs = append( errs, fmt.Errorf( "bad queue data (too few fields): %s", qd ) )
+			continue
+		}
+		sp := strings.SplitN( toks[0], "/", 2 )
+		if len( sp ) != 2 {
+			errs = append( errs, fmt.Errorf( "bad queue data (no switch/port): %s", qd ) )
+			continue
+		}
+
+		qnum, err1 := strconv.Atoi( toks[2] )
+		min, err2 := strconv.ParseInt( toks[3], 10, 64 )
+		max, err3 := strconv.ParseInt( toks[4], 10, 64 )
+		pri, err4 := strconv.Atoi( toks[5] )
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			errs = append( errs, fmt.Errorf( "bad queue data (non-numeric queue, rate or priority): %s", qd ) )
+			continue
+		}
+		q := &Ovs_queue{ Min: min, Max: max, Pri: pri }
+		if len( toks ) > 6 && toks[6] != "" {
+			if q.Burst, err1 = strconv.ParseInt( toks[6], 10, 64 ); err1 != nil {
+				errs = append( errs, fmt.Errorf( "bad queue data (non-numeric burst): %s", qd ) )
+				continue
+			}
+		}
+		if len( toks ) > 7 && toks[7] != "" {
+			if q.Meter, err1 = strconv.Atoi( toks[7] ); err1 != nil {
+				errs = append( errs, fmt.Errorf( "bad queue data (non-numeric meter): %s", qd ) )
+				continue
+			}
+		}
+
+		sw := sp[0]
+		if i := strings.Index( sw, "." ); i > 0 {
+			sw = sw[0:i]
+		}
+		by_host := sw == host
+		dpid := ovs_norm_id( sp[0] )
+		pt := sp[1]
+
+		for _, p := range ports {
+			if by_host {
+				if p.Bridge != "br-int" {
+					continue
+				}
+			} else {
+				if p.Dpid == "" || strings.TrimLeft( p.Dpid, "0" ) != strings.TrimLeft( dpid, "0" ) {		// tegu may drop leading zeros
+					continue
+				}
+			}
+
+			switch {
+				case pt == "-128":
+					if is_outward( p.Name ) {
+						add( p, qnum, q )
+					}
+
+				default:
+					if n, err := strconv.Atoi( pt ); err == nil {
+						for _, of := range p.Ofports {
+							if of == n {
+								add( p, qnum, q )
+							}
+						}
+					} else {
+						mac := ovs_norm_id( pt )
+						for _, m := range p.Macs {
+							if m == mac {
+								add( p, qnum, q )
+							}
+						}
+					}
+			}
+		}
+	}
+
+	for _, s := range spec {					// best effort queue 0 gets what is left if it was not given
+		if s.Queues[0] == nil {
+			rem := s.Max_rate
+			for _, q := range s.Queues {
+				rem -= q.Max
+			}
+			if rem < 0 {
+				rem = 0
+			}
+			s.Queues[0] = &Ovs_queue{ Min: rem, Max: s.Max_rate, Pri: OVS_Q0_PRI }
+		}
+	}
+
+	return spec, errs
+}
@@ -0,0 +1,412 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	ovsdb
+	Abstract:	A small OVSDB (RFC 7047) JSON-RPC client. Only what Tegu needs is provided:
+				list_dbs and transact (with helpers to build the operations and to pick apart
+				the OVSDB notation found in results).  Echo requests from the server are
+				answered and update notifications are ignored, so the connection can be
+				kept open for as long as the caller wishes.
+
+				The target is given in the same form that ovs-vsctl uses:  unix:/path or
+				tcp:host[:port]; port defaults to 6640.
+
+				Requests are synchronous; the client may be shared by several goroutines,
+				but only one request is outstanding at any time.
+
+	Date:		18 Oct 2026
+*/
+
+package gizmos
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OVSDB_PORT		string = "6640"
+	OVSDB_TIMEOUT	time.Duration = 30 * time.Second
+	OVS_DB			string = "Open_vSwitch"
+)
+
+/*
+	A single transact operation. Built with the Ovs_* functions below, but since it is just
+	a map the caller may add anything the RFC allows.
+*/
+type Ovs_op map[string]interface{}
+
+/*
+	Result of one operation in a transaction.
+*/
+type Ovs_result struct {
+	Uuid	[]interface{}				// insert: [ "uuid", "..." ]
+	Rows	[]map[string]interface{}	// select
+	Count	int							// update, mutate, delete
+	Error	string
+	Details	string
+}
+
+type Ovsdb struct {
+	conn	net.Conn
+	enc		*json.Encoder
+	dec		*json.Decoder
+	mu		sync.Mutex
+	nid		int
+	target	string
+	Timeout	time.Duration				// max time we wait for a response
+}
+
+/*
+	Message on the wire; used for requests, responses and notifications.
+*/
+type ovs_msg struct {
+	Method	string			`json:"method,omitempty"`
+	Params	json.RawMessage	`json:"params,omitempty"`
+	Result	json.RawMessage	`json:"result,omitempty"`
+	Error	interface{}		`json:"error"`
+	Id		interface{}		`json:"id"`
+}
+
+/*
+	Connect to the ovsdb-server described by target (unix:/path or tcp:host[:port]).
+*/
+func Mk_ovsdb( target string ) ( o *Ovsdb, err error ) {
+	var conn net.Conn
+
+	toks := strings.SplitN( target, ":", 2 )
+	if len( toks ) != 2 || toks[1] == "" {
+		return nil, fmt.Errorf( "ovsdb: bad target: %s (expected unix:path or tcp:host[:port])", target )
+	}
+
+	switch toks[0] {
+		case "unix":
+			conn, err = net.DialTimeout( "unix", toks[1], OVSDB_TIMEOUT )
+
+		case "tcp":
+			addr := toks[1]
+			if _, _, serr := net.SplitHostPort( addr ); serr != nil {
+				addr = net.JoinHostPort( addr, OVSDB_PORT )
+			}
+			conn, err = net.DialTimeout( "tcp", addr, OVSDB_TIMEOUT )
+
+		default:
+			return nil, fmt.Errorf( "ovsdb: unsupported target type: %s", toks[0] )
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf( "ovsdb: unable to connect to %s: %s", target, err )
+	}
+
+	o = Mk_ovsdb_conn( conn )
+	o.target = target
+	return o, nil
+}
+
+/*
+	Create a client using an already open connection (e.g. one end of a net.Pipe()).
+*/
+func Mk_ovsdb_conn( conn net.Conn ) ( *Ovsdb ) {
+	return &Ovsdb {
+		conn:		conn,
+		enc:		json.NewEncoder( conn ),
+		dec:		json.NewDecoder( conn ),
+		target:		conn.RemoteAddr().String(),
+		Timeout:	OVSDB_TIMEOUT,
+	}
+}
+
+func ( o *Ovsdb ) Close( ) {
+	if o != nil && o.conn != nil {
+		o.conn.Close( )
+	}
+}
+
+/*
+	Send a request and wait for its response, answering any echo requests which
+	arrive in the meantime. Returns the raw result.
+*/
+func ( o *Ovsdb ) call( method string, params []interface{} ) ( result json.RawMessage, err error ) {
+	if o == nil || o.conn == nil {
+		return nil, fmt.Errorf( "ovsdb: not connected" )
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.nid++
+	id := o.nid
+
+	o.conn.SetDeadline( time.Now().Add( o.Timeout ) )
+	defer o.conn.SetDeadline( time.Time{} )
+
+	if err = o.enc.Encode( map[string]interface{}{ "method": method, "params": params, "id": id } ); err != nil {
+		return nil, fmt.Errorf( "ovsdb: %s: send failed: %s", o.target, err )
+	}
+
+	for {
+		msg := &ovs_msg{ }
+		if err = o.dec.Decode( msg ); err != nil {
+			return nil, fmt.Errorf( "ovsdb: %s: %s: read failed: %s", o.target, method, err )
+		}
+
+		if msg.Method == "echo" {							// server keepalive; must reply with the same params
+			o.enc.Encode( map[string]interface{}{ "result": msg.Params, "error": nil, "id": msg.Id } )
+			continue
+		}
+		if msg.Method != "" {								// update or other notification; not interested
+			continue
+		}
+
+		if rid, ok := msg.Id.( float64 ); ! ok || int( rid ) != id {
+			continue										// stale response to an earlier (timed out) request
+		}
+
+		if msg.Error != nil {
+			return nil, fmt.Errorf( "ovsdb: %s: %s: %v", o.target, method, msg.Error )
+		}
+		return msg.Result, nil
+	}
+}
+
+/*
+	Return the list of databases that the server has.
+*/
+func ( o *Ovsdb ) List_dbs( ) ( dbs []string, err error ) {
+	result, err := o.call( "list_dbs", []interface{}{ } )
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal( result, &dbs )
+	return dbs, err
+}
+
+/*
+	Execute the operations as one transaction. The transaction either succeeds completely
+	or has no effect. On failure the error indicates which operation failed and why using
+	the error and details returned by the server.
+*/
+func ( o *Ovsdb ) Transact( db string, ops ...Ovs_op ) ( results []*Ovs_result, err error ) {
+	params := make( []interface{}, 0, len( ops ) + 1 )
+	params = append( params, db )
+	for _, op := range ops {
+		params = append( params, op )
+	}
+
+	raw, err := o.call( "transact", params )
+	if err != nil {
+		return nil, err
+	}
+
+	rlist := make( []*Ovs_result, 0, len( ops ) + 1 )
+	if err = json.Unmarshal( raw, &rlist ); err != nil {
+		return nil, fmt.Errorf( "ovsdb: %s: transact: unable to parse result: %s", o.target, err )
+	}
+
+	for i, r := range rlist {
+		if r == nil || r.Error == "" {
+			continue
+		}
+
+		if i < len( ops ) {
+			return rlist, fmt.Errorf( "ovsdb: %s: transact: operation %d (%v %v) failed: %s: %s", o.target, i, ops[i]["op"], ops[i]["table"], r.Error, r.Details )
+		}
+		return rlist, fmt.Errorf( "ovsdb: %s: transact failed: %s: %s", o.target, r.Error, r.Details )
+	}
+
+	if len( rlist ) < len( ops ) {
+		return rlist, fmt.Errorf( "ovsdb: %s: transact: expected %d results, received %d", o.target, len( ops ), len( rlist ) )
+	}
+
+	return rlist, nil
+}
+
+// ---------------- operation builders ----------------------------------------------------
+
+/*
+	Build a where clause condition.
+*/
+func Ovs_cond( column string, function string, value interface{} ) ( []interface{} ) {
+	return []interface{}{ column, function, value }
+}
+
+func Ovs_select( table string, where [][]interface{}, columns ...string ) ( Ovs_op ) {
+	op := Ovs_op{ "op": "select", "table": table, "where": ovs_where( where ) }
+	if len( columns ) > 0 {
+		op["columns"] = columns
+	}
+	return op
+}
+
+/*
+	Insert a row. If uuid_name is not empty the row can be referenced by later operations
+	in the same transaction using Ovs_named( uuid_name ).
+*/
+func Ovs_insert( table string, row map[string]interface{}, uuid_name string ) ( Ovs_op ) {
+	op := Ovs_op{ "op": "insert", "table": table, "row": row }
+	if uuid_name != "" {
+		op["uuid-name"] = uuid_name
+	}
+	return op
+}
+
+func Ovs_update( table string, where [][]interface{}, row map[string]interface{} ) ( Ovs_op ) {
+	return Ovs_op{ "op": "update", "table": table, "where": ovs_where( where ), "row": row }
+}
+
+func Ovs_delete( table string, where [][]interface{} ) ( Ovs_op ) {
+	return Ovs_op{ "op": "delete", "table": table, "where": ovs_where( where ) }
+}
+
+/*
+	Cause the transaction to fail, without waiting, unless the selected rows still have
+	the given column values.  Used to ensure that nothing changed between reading the
+	database and updating it.
+*/
+func Ovs_wait( table string, where [][]interface{}, columns []string, rows []map[string]interface{} ) ( Ovs_op ) {
+	return Ovs_op{ "op": "wait", "table": table, "where": ovs_where( where ), "columns": columns, "until": "==", "rows": rows, "timeout": 0 }
+}
+
+func Ovs_comment( text string ) ( Ovs_op ) {
+	return Ovs_op{ "op": "comment", "comment": text }
+}
+
+func ovs_where( where [][]interface{} ) ( [][]interface{} ) {
+	if where == nil {
+		return [][]interface{}{ }			// must be an empty array, not null
+	}
+	return where
+}
+
+// ---------------- notation -------------------------------------------------------------
+
+func Ovs_uuid( id string ) ( []interface{} ) {
+	return []interface{}{ "uuid", id }
+}
+
+func Ovs_named( name string ) ( []interface{} ) {
+	return []interface{}{ "named-uuid", name }
+}
+
+func Ovs_set( items ...interface{} ) ( []interface{} ) {
+	if items == nil {
+		items = []interface{}{ }
+	}
+	return []interface{}{ "set", items }
+}
+
+/*
+	Convert a string map to OVSDB map notation. Keys are sorted so that the result is
+	predictable.
+*/
+func Ovs_smap( m map[string]string ) ( []interface{} ) {
+	keys := make( []string, 0, len( m ) )
+	for k := range m {
+		keys = append( keys, k )
+	}
+	sort.Strings( keys )
+
+	pairs := make( []interface{}, 0, len( m ) )
+	for _, k := range keys {
+		pairs = append( pairs, []interface{}{ k, m[k] } )
+	}
+	return []interface{}{ "map", pairs }
+}
+
+/*
+	Convert an integer keyed map to OVSDB map notation (keys sorted).
+*/
+func Ovs_imap( m map[int]interface{} ) ( []interface{} ) {
+	keys := make( []int, 0, len( m ) )
+	for k := range m {
+		keys = append( keys, k )
+	}
+	sort.Ints( keys )
+
+	pairs := make( []interface{}, 0, len( m ) )
+	for _, k := range keys {
+		pairs = append( pairs, []interface{}{ k, m[k] } )
+	}
+	return []interface{}{ "map", pairs }
+}
+
+/*
+	Return the uuid string from a value in ["uuid", "..."] form, or "" if the value
+	is not a uuid.
+*/
+func Ovs_uuid_val( v interface{} ) ( string ) {
+	if a, ok := v.( []interface{} ); ok && len( a ) == 2 {
+		if t, ok := a[0].( string ); ok && t == "uuid" {
+			s, _ := a[1].( string )
+			return s
+		}
+	}
+
+	return ""
+}
+
+/*
+	Return the members of a value which may be a single atom or a ["set", [...]].
+*/
+func Ovs_set_vals( v interface{} ) ( []interface{} ) {
+	if a, ok := v.( []interface{} ); ok && len( a ) == 2 {
+		if t, ok := a[0].( string ); ok && t == "set" {
+			if members, ok := a[1].( []interface{} ); ok {
+				return members
+			}
+			return nil
+		}
+	}
+
+	if v == nil {
+		return nil
+	}
+	return []interface{}{ v }
+}
+
+/*
+	Return the pairs of a ["map", [[k,v]...]] value with keys converted to strings.
+*/
+func Ovs_map_vals( v interface{} ) ( m map[string]interface{} ) {
+	m = make( map[string]interface{} )
+
+	a, ok := v.( []interface{} )
+	if ! ok || len( a ) != 2 {
+		return m
+	}
+	if t, ok := a[0].( string ); ! ok || t != "map" {
+		return m
+	}
+
+	pairs, _ := a[1].( []interface{} )
+	for _, p := range pairs {
+		if kv, ok := p.( []interface{} ); ok && len( kv ) == 2 {
+			m[fmt.Sprintf( "%v", kv[0] )] = kv[1]
+		}
+	}
+
+	return m
+}
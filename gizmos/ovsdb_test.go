@@ -0,0 +1,285 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	ovsdb_test
+	Abstract:	Tests for the ovsdb client and qos functions using an in-process fake
+				ovsdb-server (one end of a net.Pipe). The fake answers selects from a
+				small canned database, sends an echo before each reply, and records
+				the operations of every other transaction.
+
+				To test against a real server set OVSDB_TARGET (e.g. unix:/var/run/openvswitch/db.sock);
+				only the read only list_dbs/Ports calls are made.
+	Date:		18 Oct 2026
+*/
+
+package gizmos
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"testing"
+)
+
+type fake_ovsdb struct {
+	tables	map[string][]map[string]interface{}
+	fail_op	int								// op index to fail on non-select transactions (-1 none)
+	txns	[][]map[string]interface{}		// non-select transactions received
+}
+
+/*
+	Serve requests on the connection until it is closed.
+*/
+func ( f *fake_ovsdb ) serve( conn net.Conn ) {
+	dec := json.NewDecoder( conn )
+	out := make( chan interface{}, 16 )			// pipe is unbuffered; write from another goroutine so echo replies do not block us
+	go func( ) {
+		enc := json.NewEncoder( conn )
+		for m := range out {
+			enc.Encode( m )
+		}
+	}( )
+	defer close( out )
+
+	for {
+		req := map[string]interface{}{ }
+		if err := dec.Decode( &req ); err != nil {
+			return
+		}
+		if req["method"] == nil {			// reply to our echo
+			continue
+		}
+
+		out <- map[string]interface{}{ "method": "echo", "params": []interface{}{ "ping" }, "id": "echo" }
+
+		params, _ := req["params"].( []interface{} )
+		switch req["method"] {
+			case "list_dbs":
+				out <- map[string]interface{}{ "result": []string{ OVS_DB }, "error": nil, "id": req["id"] }
+
+			case "transact":
+				results := make( []interface{}, 0 )
+				ops := make( []map[string]interface{}, 0 )
+				selects := true
+				for _, p := range params[1:] {
+					op := p.( map[string]interface{} )
+					ops = append( ops, op )
+					if op["op"] == "select" {
+						results = append( results, map[string]interface{}{ "rows": f.tables[op["table"].( string )] } )
+					} else {
+						selects = false
+						results = append( results, map[string]interface{}{ "count": 1 } )
+					}
+				}
+
+				if ! selects {
+					f.txns = append( f.txns, ops )
+					if f.fail_op >= 0 && f.fail_op < len( results ) {
+						results[f.fail_op] = map[string]interface{}{ "error": "constraint violation", "details": "port qos changed" }
+					}
+				}
+				out <- map[string]interface{}{ "result": results, "error": nil, "id": req["id"] }
+		}
+	}
+}
+
+/*
+	Build a fake with two bridges: br-int (host side) with a vm port and qosirl0, and
+	br-eth2 which has a port with qos that tegu did not create.
+*/
+func mk_fake_ovsdb( ) ( *fake_ovsdb, *Ovsdb ) {
+	u := func( s string ) ( []interface{} ) { return []interface{}{ "uuid", s } }
+
+	f := &fake_ovsdb{ fail_op: -1 }
+	f.tables = map[string][]map[string]interface{} {
+		"Bridge": {
+			{ "name": "br-int", "datapath_id": "0000fa163e000001", "ports": []interface{}{ "set", []interface{}{ u( "p1" ), u( "p2" ) } } },
+			{ "name": "br-eth2", "datapath_id": "0000fa163e000002", "ports": u( "p3" ) },
+		},
+		"Port": {
+			{ "_uuid": u( "p1" ), "name": "qosirl0", "interfaces": u( "i1" ), "qos": []interface{}{ "set", []interface{}{} } },
+			{ "_uuid": u( "p2" ), "name": "qvo1234", "interfaces": u( "i2" ), "qos": u( "q-old" ) },
+			{ "_uuid": u( "p3" ), "name": "eth2", "interfaces": u( "i3" ), "qos": u( "q-hand" ) },
+		},
+		"Interface": {
+			{ "_uuid": u( "i1" ), "ofport": 5, "mac_in_use": "aa:bb:cc:00:00:01", "external_ids": []interface{}{ "map", []interface{}{} } },
+			{ "_uuid": u( "i2" ), "ofport": 7, "mac_in_use": "fe:16:3e:00:00:02",
+				"external_ids": []interface{}{ "map", []interface{}{ []interface{}{ "attached-mac", "fa:16:3e:00:00:02" } } } },
+			{ "_uuid": u( "i3" ), "ofport": 1, "mac_in_use": "aa:bb:cc:00:00:03", "external_ids": []interface{}{ "map", []interface{}{} } },
+		},
+		"QoS": {
+			{ "_uuid": u( "q-old" ), "queues": []interface{}{ "map", []interface{}{ []interface{}{ 1, u( "qq1" ) } } },
+				"external_ids": []interface{}{ "map", []interface{}{ []interface{}{ "tegu", OVS_OWN_RES } } } },
+			{ "_uuid": u( "q-hand" ), "queues": []interface{}{ "map", []interface{}{} }, "external_ids": []interface{}{ "map", []interface{}{} } },
+		},
+	}
+
+	c1, c2 := net.Pipe()
+	go f.serve( c2 )
+	return f, Mk_ovsdb_conn( c1 )
+}
+
+/*
+	Count the operations of the given type/table in a transaction.
+*/
+func count_ops( ops []map[string]interface{}, op string, table string ) ( n int ) {
+	for _, o := range ops {
+		if o["op"] == op && (table == "" || o["table"] == table) {
+			n++
+		}
+	}
+	return n
+}
+
+func Test_ovsdb_ports( t *testing.T ) {
+	_, o := mk_fake_ovsdb( )
+	defer o.Close( )
+
+	dbs, err := o.List_dbs( )
+	if err != nil || len( dbs ) != 1 || dbs[0] != OVS_DB {
+		fmt.Fprintf( os.Stderr, "FAIL: list_dbs: %v %v\n", dbs, err )
+		t.Fail()
+	}
+
+	ports, err := o.Ports( )
+	if err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: ports: %s\n", err )
+		t.Fail()
+		return
+	}
+
+	p := ports["qvo1234"]
+	if p == nil || p.Bridge != "br-int" || p.Qos != "q-old" || len( p.Ofports ) != 1 || p.Ofports[0] != 7 || len( p.Macs ) != 2 {
+		fmt.Fprintf( os.Stderr, "FAIL: qvo1234 port not as expected: %+v\n", p )
+		t.Fail()
+	}
+	if p := ports["eth2"]; p == nil || p.Dpid != "0000fa163e000002" {
+		fmt.Fprintf( os.Stderr, "FAIL: eth2 port not as expected: %+v\n", p )
+		t.Fail()
+	}
+}
+
+/*
+	Queue data for the host's outward port and the VM (by mac) replaces the old tegu qos;
+	the hand built qos on eth2 is not touched.
+*/
+func Test_ovs_set_qos( t *testing.T ) {
+	f, o := mk_fake_ovsdb( )
+	defer o.Close( )
+
+	ports, _ := o.Ports( )
+	qdata := []string {
+		"host1/-128,res1,1,1000000,2000000,200",
+		"host1/fa163e000002,res1,2,1000000,1000000,200",
+		"fa:16:3e:00:00:09/3,res2,1,1,1,1",								// switch not on this host; ignored
+		"junk",
+	}
+	spec, errs := Ovs_parse_qdata( qdata, "host1.example.com", ports, []string{ "qosirl*" }, 0 )
+	if len( errs ) != 1 {
+		fmt.Fprintf( os.Stderr, "FAIL: expected 1 parse error, got %d\n", len( errs ) )
+		t.Fail()
+	}
+	if len( spec ) != 2 || spec["qosirl0"] == nil || spec["qvo1234"] == nil || spec["qosirl0"].Queues[0] == nil || spec["qosirl0"].Queues[0].Min != OVS_MAX_RATE - 2000000 {
+		fmt.Fprintf( os.Stderr, "FAIL: spec not as expected: %+v\n", spec )
+		t.Fail()
+		return
+	}
+
+	if err := o.Set_qos( spec, OVS_OWN_RES ); err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: set qos: %s\n", err )
+		t.Fail()
+		return
+	}
+
+	if len( f.txns ) != 1 {
+		fmt.Fprintf( os.Stderr, "FAIL: expected one transaction, got %d\n", len( f.txns ) )
+		t.Fail()
+		return
+	}
+	ops := f.txns[0]
+	if count_ops( ops, "insert", "Queue" ) != 4 || count_ops( ops, "insert", "QoS" ) != 2 || count_ops( ops, "wait", "Port" ) != 2 ||
+		count_ops( ops, "delete", "QoS" ) != 1 || count_ops( ops, "delete", "Queue" ) != 1 {
+		fmt.Fprintf( os.Stderr, "FAIL: transaction not as expected: %v\n", ops )
+		t.Fail()
+	}
+	for _, op := range ops {
+		if op["op"] == "delete" && strings.Contains( fmt.Sprintf( "%v", op["where"] ), "q-hand" ) {
+			fmt.Fprintf( os.Stderr, "FAIL: qos not created by tegu was deleted\n" )
+			t.Fail()
+		}
+	}
+
+	f.fail_op = 1										// failure reported on the first wait
+	err := o.Purge_qos( OVS_OWN_RES )
+	if err == nil || ! strings.Contains( err.Error(), "operation 1" ) || ! strings.Contains( err.Error(), "port qos changed" ) {
+		fmt.Fprintf( os.Stderr, "FAIL: expected precise error from failed purge, got: %v\n", err )
+		t.Fail()
+	}
+}
+
+/*
+	Queue data naming the switch by dpid selects the switch's ports only when the whole dpid
+	matches; leading zeros may be dropped, but a dpid that only ends the same does not match.
+*/
+func Test_ovs_qdata_dpid( t *testing.T ) {
+	_, o := mk_fake_ovsdb( )
+	defer o.Close( )
+
+	ports, _ := o.Ports( )
+	spec, errs := Ovs_parse_qdata( []string{ "fa:16:3e:00:00:02/1,res1,1,1000,2000,200" }, "host1", ports, nil, 0 )
+	if len( errs ) != 0 || spec["eth2"] == nil {
+		fmt.Fprintf( os.Stderr, "FAIL: queue for the switch's port (dpid without leading zeros) not set: %v %v\n", spec, errs )
+		t.Fail()
+	}
+
+	spec, _ = Ovs_parse_qdata( []string{ "3e:00:00:02/1,res1,1,1000,2000,200" }, "host1", ports, nil, 0 )
+	if len( spec ) != 0 {
+		fmt.Fprintf( os.Stderr, "FAIL: dpid which only ends the same selected a port: %v\n", spec )
+		t.Fail()
+	}
+}
+
+/*
+	Optional test against a real ovsdb-server.
+*/
+func Test_ovsdb_real( t *testing.T ) {
+	target := os.Getenv( "OVSDB_TARGET" )
+	if target == "" {
+		return
+	}
+
+	o, err := Mk_ovsdb( target )
+	if err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: %s\n", err )
+		t.Fail()
+		return
+	}
+	defer o.Close( )
+
+	ports, err := o.Ports( )
+	if err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: %s\n", err )
+		t.Fail()
+		return
+	}
+	fmt.Fprintf( os.Stderr, "%d ports found on %s\n", len( ports ), target )
+}
@@ -63,6 +63,12 @@
 				29 Oct 2014 - Added Get_nlinks() function.
 				12 Apr 2016 - Added ability to compare paths based on 'anchors' (dup refresh support).
 				12 May 2016 - Correct potential for segfault in has_anchors.
+				19 Oct 2026 - Added headroom (ceiling above the reserved amount) and burst for the
+					path's endpoint queues.
+				19 Oct 2026 - Added split indicator and available capacity to support dividing a
+					reservation across paths.
+				19 Oct 2026 - Added Get_ilink_qport().
+				19 Oct 2026 - Added Get_links().
 */
 
 package gizmos
@@ -91,11 +97,14 @@ type Path struct {
 	h1		*Host
 	h2		*Host
 	bw_amt	int64			// amount of bandwidth reserved along this path
+	headroom int64			// amount above bw_amt the endpoint queues may borrow (not reserved)
+	burst	int64			// burst size (bits) for the endpoint queues; 0 == switch default
 	endpts	[]*Link			// virtual links that represent the switch to vm endpoint 'link'
 	extip	*string			// external IP address to be added to the flow mod when needed
 	extflag	*string			// flag indicating whether external IP is source (-S) or dest (-D) needed by flow mod generator
 	is_reverse	bool		// set to indicate that the path was saved in reverse order
 	is_scramble bool		// if the path is not a true path, but a list of links involved in all possible paths between hosts
+	is_split	bool		// path carries a share of a reservation that is split across paths
 }
 
 // ---------------------------------------------------------------------------------------
@@ -159,6 +168,20 @@ func (p *Path) Set_bandwidth( bw int64 ) {
 	return
 }
 
+/*
+	Set the headroom (amount above the reserved bandwidth that traffic may use when capacity
+	is idle) and burst for the path. These are applied to the queues that Set_queue creates
+	for the endpoints; intermediate (priority) queues carry only the reserved amount.
+*/
+func (p *Path) Set_limits( headroom int64, burst int64 ) {
+	if headroom >= 0 {
+		p.headroom = headroom
+	}
+	if burst >= 0 {
+		p.burst = burst
+	}
+}
+
 /*
 	Causes the is_scramble indicator to be set to the value passed in.
 */
@@ -166,6 +189,38 @@ func (p *Path) Set_scramble( state bool ) {
 	p.is_scramble = state
 }
 
+/*
+	Mark the path as carrying a share of the reservation's bandwidth rather than all of it.
+*/
+func (p *Path) Set_split( state bool ) {
+	p.is_split = state
+}
+
+/*
+	Returns true if the path carries only a share of the reservation's bandwidth.
+*/
+func (p *Path) Is_split( ) ( bool ) {
+	return p.is_split
+}
+
+/*
+	Return the amount of bandwidth that could still be reserved along the path across the
+	window; the smallest amount available on any of its links.
+*/
+func (p *Path) Get_available( commence int64, conclude int64, usr_max int64 ) ( avail int64 ) {
+	avail = -1
+	for i := 0; i < p.lidx; i++ {
+		if a := p.links[i].Get_available( commence, conclude, usr_max ); avail < 0 || a < avail {
+			avail = a
+		}
+	}
+
+	if avail < 0 {
+		avail = 0
+	}
+	return
+}
+
 /*
 	Return the current amount of bandwidth reserved on the path
 */
@@ -180,6 +235,16 @@ func (p *Path) Get_nlinks( ) ( int ) {
 	return p.lidx
 }
 
+/*
+	Return the links in the path (endpoint links are not included).
+*/
+func (p *Path) Get_links( ) ( []*Link ) {
+	if p == nil {
+		return nil
+	}
+	return p.links[0:p.lidx]
+}
+
 /*
 	Returns the state of the scramble setting.
 */
@@ -407,9 +472,37 @@ func (p *Path) Set_queue( qid *string, commence int64, conclude int64, bw_amt in
 		if err != nil { return }
 	}
 
+	if p.headroom > 0 || p.burst > 0 {
+		p.set_queue_limits( qid, commence, conclude, bw_amt < 0 )
+	}
+
 	return
 }
 
+/*
+	Apply (or remove when undo is true) the path's headroom and burst to the specific queues
+	that Set_queue created: the ingress queue and the endpoint queue into h2.
+*/
+func (p *Path) set_queue_limits( qid *string, commence int64, conclude int64, undo bool ) {
+	delta := p.headroom
+	burst := p.burst
+	if undo {
+		delta = -delta
+		burst = -1				// leave burst; the queue drops off when its bandwidth reaches 0
+	}
+
+	if p.is_reverse {
+		p.links[p.lidx-1].Set_queue_limits( qid, commence, conclude, delta, burst )
+	} else {
+		p.links[0].Set_queue_limits( qid, commence, conclude, delta, burst )
+	}
+
+	if p.endpts[1] != nil {
+		eqid := "E1" + *qid;
+		p.endpts[1].Set_queue_limits( &eqid, commence, conclude, delta, burst )
+	}
+}
+
 /*
 	Return the usr name associated with the path.
 */
@@ -482,6 +575,22 @@ func (p *Path) Get_ilink_spq( qid *string, tstamp int64 ) ( spq *Spq ) {
 	return
 }
 
+/*
+	Return the switch/port string of the reservation queue on the first link in the path as it
+	appears in the queue list (see Link.Get_forward_qport).
+*/
+func (p *Path) Get_ilink_qport( ) ( string ) {
+	idx := 0
+	if p.is_reverse {
+		idx = p.lidx-1
+	}
+
+	if idx < 0 {
+		return ""
+	}
+	return p.links[idx].Get_forward_qport( )
+}
+
 /*
 	Return the backward link information (switch/port/queue-num) associated with the egress switch in
 	path. This is the port and queue number on the last switch in the path that is used to send data _back_
@@ -808,3 +917,53 @@ func (p *Path) To_json( ) (json string) {
 	json += fmt.Sprintf( "] }" )
 	return
 }
+
+/*
+	Divide amt across a set of paths in proportion to the capacity available on each (avail).
+	No share exceeds the amount available on its path; a path with nothing available gets a
+	zero share. An error is returned if the paths together cannot carry the amount.
+*/
+func Split_shares( amt int64, avail []int64 ) ( shares []int64, err error ) {
+	var total int64 = 0
+
+	for _, a := range avail {
+		if a > 0 {
+			total += a
+		}
+	}
+	if total < amt || amt <= 0 {
+		return nil, fmt.Errorf( "paths cannot carry %d: %d available", amt, total )
+	}
+
+	shares = make( []int64, len( avail ) )
+	rem := amt
+	for i, a := range avail {
+		if a > 0 {
+			shares[i] = int64( float64( amt ) * float64( a ) / float64( total ) )		// float as amt * a can overflow
+			if shares[i] > a {
+				shares[i] = a
+			}
+			rem -= shares[i]
+		}
+	}
+
+	for i := 0; rem > 0 && i < len( avail ); i++ {				// rounding leaves a few bits; give to whoever has room
+		if room := avail[i] - shares[i]; room > 0 {
+			if room > rem {
+				room = rem
+			}
+			shares[i] += room
+			rem -= room
+		}
+	}
+	for i := 0; rem < 0 && i < len( shares ); i++ {				// float rounding could overshoot; take back
+		take := -rem
+		if take > shares[i] {
+			take = shares[i]
+		}
+		shares[i] -= take
+		rem += take
+	}
+
+	return shares, nil
+}
@@ -38,6 +38,8 @@
 
 	Mods:		16 Aug 2015 - listed funcs provided by Pledge_base, and those that must be written per Pledge type
 				12 Apr 2016 - Support for duplicate refresh capability.
+				18 Oct 2026 - Added owner functions.
+				18 Oct 2026 - Added pending push functions.
 */
 
 package gizmos
@@ -56,20 +58,27 @@ type Pledge interface {
 	Concluded_recently( window int64 ) ( bool )
 	Commenced_recently( window int64 ) ( bool )
 	Get_id( ) ( *string )
+	Get_owner( ) ( *string, *string )
 	Get_window( ) ( int64, int64 )
 	Is_active( ) ( bool )
 	Is_active_soon( window int64 ) ( bool )
 	Is_expired( ) ( bool )
 	Is_extinct( window int64 ) ( bool )
+	Is_owned_by( project *string ) ( bool )
 	Is_pending( ) ( bool )
+	Is_push_pending( ) ( bool )
+	Is_push_stale( secs int64 ) ( bool )
 	Is_pushed( ) (bool)
 	Is_paused( ) ( bool )
 	Is_valid_cookie( c *string ) ( bool )
 	Pause( bool )
+	Push_ack( gen uint32, ok bool ) ( bool )
 	Reset_pushed( )
 	Resume( bool )
 	Same_anchors( *string, *string ) ( bool )
 	Set_expiry( expiry int64 )
+	Set_owner( user *string, project *string )
+	Set_push_pending( n int ) ( uint32 )
 	Set_pushed()
 
 	// The following must be implemented by each separate Pledge type
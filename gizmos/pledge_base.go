@@ -35,16 +35,29 @@
 	Author:		E. Scott Daniels / Robert Eby
 
 	Mods:		12 Apr 2016 - Duplicate refresh support.
+				18 Oct 2026 - Added owning user/project so that access can be scoped to a project.
+				18 Oct 2026 - Added pending push (acknowledgement) tracking.
+				19 Oct 2026 - Pending pushes have a generation so that late acks are ignored.
 */
 
 package gizmos
 
+import (
+	"fmt"
+	"time"
+)
+
 type Pledge_base struct {
 	id			*string			// name that the client can use to manage (modify/delete)
 	window		*pledge_window	// the window of time for which the pledge is active
 	pushed		bool			// set when pledge has been pushed into openflow or openvswitch
 	paused		bool			// set if reservation has been paused
 	usrkey		*string			// a 'cookie' supplied by the user to prevent any other user from modifying
+	owner		*string			// user (from the validated token) that created the pledge
+	project		*string			// project (tenant) ID of the creator; used to scope visibility and management
+	pend_acks	int				// number of flow-mod acknowledgements outstanding before the pledge is considered pushed
+	pend_ts		int64			// time the pending push was started
+	push_gen	uint32			// generation of the current push; acks for other generations are ignored
 }
 
 /*
@@ -69,6 +82,17 @@ func (p *Pledge_base) Commenced_recently( window int64 ) ( bool ) {
 	return p.window.commenced_recently( window )
 }
 
+/*
+	Returns the user and project that own the pledge. Either may be nil if the pledge
+	was created without a validated token (or loaded from an old checkpoint).
+*/
+func (p *Pledge_base) Get_owner( ) ( user *string, project *string ) {
+	if p == nil {
+		return nil, nil
+	}
+	return p.owner, p.project
+}
+
 /*
 	Returns a pointer to the ID string of the pledge.
 */
@@ -143,6 +167,28 @@ func (p *Pledge_base) Is_pending( ) ( bool ) {
 	return p.window.is_pending()
 }
 
+/*
+	Returns true if acknowledgements for a push are still outstanding.
+*/
+func (p *Pledge_base) Is_push_pending( ) ( bool ) {
+	if p == nil {
+		return false
+	}
+
+	return p.pend_acks > 0
+}
+
+/*
+	Returns true if a push has been pending for more than secs seconds.
+*/
+func (p *Pledge_base) Is_push_stale( secs int64 ) ( bool ) {
+	if p == nil || p.pend_acks <= 0 {
+		return false
+	}
+
+	return time.Now().Unix() - p.pend_ts > secs
+}
+
 /*
 	Returns true if the pushed flag has been set to true.
 */
@@ -174,6 +220,18 @@ func (p *Pledge_base) Is_valid_cookie( c *string ) ( bool ) {
 	return *c == *p.usrkey
 }
 
+/*
+	Returns true if the pledge belongs to the project passed in. A pledge without
+	an owning project is never owned by anybody (only admin or the super cookie can
+	manage it when access is project based).
+*/
+func (p *Pledge_base) Is_owned_by( project *string ) ( bool ) {
+	if p == nil || project == nil || p.project == nil || *p.project == "" {
+		return false
+	}
+	return *project == *p.project
+}
+
 // There is NOT a toggle pause on purpose; don't add one :)
 
 /*
@@ -184,6 +242,7 @@ func (p *Pledge_base) Pause( reset bool ) {
 		p.paused = true
 		if reset {
 			p.pushed = false;
+			p.pend_acks = 0
 		}
 	}
 }
@@ -196,6 +255,7 @@ func (p *Pledge_base) Resume( reset bool ) {
 		p.paused = false
 		if reset {
 			p.pushed = false;
+			p.pend_acks = 0
 		}
 	}
 }
@@ -207,15 +267,89 @@ func (p *Pledge_base) Set_expiry ( v int64 ) {
 	if p != nil {
 		p.window.set_expiry_to( v )
 		p.pushed = false		// force it to be resent to adjust times
+		p.pend_acks = 0
 	}
 }
 
+/*
+	Records the user and project that created the pledge. Nil pointers are
+	converted to empty strings so that checkpoint generation is safe.
+*/
+func (p *Pledge_base) Set_owner( user *string, project *string ) {
+	if p == nil {
+		return
+	}
+
+	if user == nil {
+		user = &empty_str
+	}
+	if project == nil {
+		project = &empty_str
+	}
+	p.owner = user
+	p.project = project
+}
+
+/*
+	Marks the pledge as pushed, but waiting on n acknowledgements. The pledge is not
+	marked pushed until all have been received (Push_ack). If n is <= 0 the pledge is
+	marked pushed immediately. Returns the generation of the push which must be given
+	with each acknowledgement.
+*/
+func (p *Pledge_base) Set_push_pending( n int ) ( gen uint32 ) {
+	if p == nil {
+		return 0
+	}
+
+	p.push_gen++
+	if p.push_gen == 0 {					// zero is never a valid generation
+		p.push_gen++
+	}
+
+	if n <= 0 {
+		p.Set_pushed()
+		return p.push_gen
+	}
+
+	p.pushed = false
+	p.pend_acks = n
+	p.pend_ts = time.Now().Unix()
+	return p.push_gen
+}
+
+/*
+	Records an acknowledgement for a pending push. When ok is false the pending state is
+	cleared and the pushed flag reset so that the pledge is pushed again. When the last
+	outstanding acknowledgement is received the pledge is marked pushed. Acks for any
+	generation other than the current push (a late response to an earlier push) are
+	ignored. Returns true if the pledge's state changed (pushed or reset).
+*/
+func (p *Pledge_base) Push_ack( gen uint32, ok bool ) ( bool ) {
+	if p == nil || p.pend_acks <= 0 || gen != p.push_gen {
+		return false
+	}
+
+	if ! ok {
+		p.Reset_pushed()
+		return true
+	}
+
+	p.pend_acks--
+	if p.pend_acks == 0 {
+		p.pushed = true
+		return true
+	}
+
+	return false
+}
+
 /*
 	Sets the pushed flag to true.
 */
 func (p *Pledge_base) Set_pushed( ) {
 	if p != nil {
 		p.pushed = true
+		p.pend_acks = 0
 	}
 }
 
@@ -225,6 +359,7 @@ func (p *Pledge_base) Set_pushed( ) {
 func (p *Pledge_base) Reset_pushed( ) {
 	if p != nil {
 		p.pushed = false
+		p.pend_acks = 0
 	}
 }
 
@@ -234,3 +369,20 @@ func (p *Pledge_base) Reset_pushed( ) {
 func (p *Pledge_base) Same_anchors( a1 *string, a2 *string ) (bool ) {
 	return false;
 }
+
+/*
+	Generates the owner related fields for inclusion in a checkpoint json string. The
+	string returned has a trailing comma and space so that it can be inserted before
+	other fields by the To_chkpt() functions.
+*/
+func (p *Pledge_base) owner2chkpt( ) ( string ) {
+	if p == nil || p.project == nil || *p.project == "" {
+		return ""
+	}
+
+	owner := ""
+	if p.owner != nil {
+		owner = *p.owner
+	}
+	return fmt.Sprintf( `"owner": %q, "project": %q, `, owner, *p.project )
+}
@@ -44,6 +44,12 @@
 				04 Feb 2016 - Added protocol to chkpt, and string functions.
 				11 Apr 2016 - Correct bad % on String() output.
 				12 Apr 2016 - Duplicate refresh support.
+				18 Oct 2026 - Save owner and project in checkpoint.
+				19 Oct 2026 - Added ceiling and burst; bandw_in/out are the guaranteed rates.
+				19 Oct 2026 - Added per-path shares and select groups for reservations split across paths.
+				19 Oct 2026 - Added path constraints.
+				19 Oct 2026 - Added degraded state (paths use lost links and could not be moved); it is
+					kept in the checkpoint.
 */
 
 package gizmos
@@ -64,12 +70,20 @@ type Pledge_bw struct {
 	tpport2		*string		// thee match h1/h2 respectively
 	vlan1		*string		// vlan id to match with h1 match criteria
 	vlan2		*string		// vlan id to match with h2
-	bandw_in	int64		// bandwidth to reserve inbound to host1
-	bandw_out	int64		// bandwidth to reserve outbound from host1
+	bandw_in	int64		// bandwidth to reserve inbound to host1 (guaranteed)
+	bandw_out	int64		// bandwidth to reserve outbound from host1 (guaranteed)
+	ceil_in		int64		// max rate inbound to host1 (may borrow idle capacity above bandw_in); 0 == bandw_in
+	ceil_out	int64		// max rate outbound from host1; 0 == bandw_out
+	burst		int64		// queue burst size (bits); 0 == switch default
 	dscp		int			// dscp value that should be propagated
 	dscp_koe	bool		// true if the dscp value should be kept when a packet exits the environment
 	qid			*string		// name that we'll assign to the queue which allows us to look up the pledge's queues
 	path_list	[]*Path		// list of paths that represent the bandwith and can be used to send flowmods etc.
+	shares_in	[]int64		// bandwidth carried by each inbound path when split across paths; nil if not split
+	shares_out	[]int64		// same for outbound paths
+	groups		map[string]uint32	// select group of each split direction, keyed by the mac of the path's first host (allocated by res_mgr)
+	constraints	*Path_constraints	// limits on acceptable paths (hops, latency, avoided switches/srlgs); nil if none
+	degraded	string		// reason the paths could not be moved off of lost links; empty if not degraded
 	match_v6	bool		// true if we should force flow-mods to match on IPv6
 }
 
@@ -87,11 +101,18 @@ type Json_pledge_bw struct {
 	Expiry		int64
 	Bandwin		int64
 	Bandwout	int64
+	Ceilin		int64
+	Ceilout		int64
+	Burst		int64
+	Constraints	string
+	Degraded	string
 	Dscp		int
 	Dscp_koe	bool
 	Id			*string
 	Qid			*string
 	Usrkey		*string
+	Owner		*string
+	Project		*string
 	Match_v6	bool
 	Ptype		int
 }
@@ -225,6 +246,190 @@ func (p *Pledge_bw) Get_bandw_in( ) ( int64 ) {
 	return p.bandw_in
 }
 
+/*
+	Set the ceiling (max) rates and the burst size. Only the guaranteed bandwidth is reserved;
+	traffic may use up to the ceiling when capacity is idle. A ceiling of 0 is the same as the
+	guarantee; a ceiling less than the guarantee is an error.
+*/
+func (p *Pledge_bw) Set_limits( ceil_in int64, ceil_out int64, burst int64 ) ( err error ) {
+	if p == nil {
+		return fmt.Errorf( "no pledge" )
+	}
+
+	if (ceil_in > 0 && ceil_in < p.bandw_in) || (ceil_out > 0 && ceil_out < p.bandw_out) {
+		return fmt.Errorf( "invalid ceiling; ceiling must not be less than the guaranteed bandwidth" )
+	}
+	if burst < 0 {
+		return fmt.Errorf( "invalid burst; must not be negative" )
+	}
+
+	p.ceil_in = ceil_in
+	p.ceil_out = ceil_out
+	p.burst = burst
+	return nil
+}
+
+/*
+	Returns the ceiling rates (inbound to and outbound from host1); the guarantee when no
+	ceiling was given.
+*/
+func (p *Pledge_bw) Get_ceiling( ) ( ceil_in int64, ceil_out int64 ) {
+	if p == nil {
+		return 0, 0
+	}
+
+	ceil_in = p.ceil_in
+	if ceil_in < p.bandw_in {
+		ceil_in = p.bandw_in
+	}
+	ceil_out = p.ceil_out
+	if ceil_out < p.bandw_out {
+		ceil_out = p.bandw_out
+	}
+	return
+}
+
+/*
+	Returns the burst size; 0 if not set.
+*/
+func (p *Pledge_bw) Get_burst( ) ( int64 ) {
+	if p == nil {
+		return 0
+	}
+
+	return p.burst
+}
+
+/*
+	Record the share of the bandwidth carried by each path when the reservation is split across
+	paths (inbound to and outbound from host1). A nil list indicates that the direction
+	is not split.
+*/
+func (p *Pledge_bw) Set_shares( in []int64, out []int64 ) {
+	if p != nil {
+		p.shares_in = in
+		p.shares_out = out
+	}
+}
+
+/*
+	Returns the per-path shares; nil for a direction that is not split.
+*/
+func (p *Pledge_bw) Get_shares( ) ( in []int64, out []int64 ) {
+	if p == nil {
+		return nil, nil
+	}
+
+	return p.shares_in, p.shares_out
+}
+
+/*
+	Set the select group used to split the paths which start at the host with the mac (key).
+	A gid of 0 removes it.
+*/
+func (p *Pledge_bw) Set_group( key string, gid uint32 ) {
+	if gid == 0 {
+		delete( p.groups, key )
+		return
+	}
+
+	if p.groups == nil {
+		p.groups = make( map[string]uint32 )
+	}
+	p.groups[key] = gid
+}
+
+/*
+	Return the select group for the paths starting at the host with the mac; 0 if none has been allocated.
+*/
+func (p *Pledge_bw) Get_group( key string ) ( uint32 ) {
+	return p.groups[key]
+}
+
+/*
+	Return all of the select groups allocated to the pledge.
+*/
+func (p *Pledge_bw) Get_groups( ) ( gl []uint32 ) {
+	gl = make( []uint32, 0, len( p.groups ) )
+	for _, gid := range p.groups {
+		gl = append( gl, gid )
+	}
+	return gl
+}
+
+/*
+	Render the shares as a json array.
+*/
+func shares2json( shares []int64 ) ( string ) {
+	s := "["
+	sep := " "
+	for _, v := range shares {
+		s += fmt.Sprintf( "%s%d", sep, v )
+		sep = ", "
+	}
+	return s + " ]"
+}
+
+/*
+	Set the constraints which paths for the reservation must satisfy. Nil clears them.
+*/
+func (p *Pledge_bw) Set_constraints( pc *Path_constraints ) {
+	if p != nil {
+		p.constraints = pc
+	}
+}
+
+/*
+	Returns the path constraints; nil if there are none.
+*/
+func (p *Pledge_bw) Get_constraints( ) ( *Path_constraints ) {
+	if p == nil {
+		return nil
+	}
+
+	return p.constraints
+}
+
+/*
+	Mark the pledge degraded (one or more of its paths use links that are no longer in the
+	network and no other path could be found) giving the reason. An empty reason clears it.
+*/
+func (p *Pledge_bw) Set_degraded( reason string ) {
+	if p != nil {
+		p.degraded = reason
+	}
+}
+
+/*
+	Returns the reason the pledge is degraded; empty if it isn't.
+*/
+func (p *Pledge_bw) Get_degraded( ) ( string ) {
+	if p == nil {
+		return ""
+	}
+
+	return p.degraded
+}
+
+/*
+	Returns true if any of the pledge's paths use a link whose id is in the map.
+*/
+func (p *Pledge_bw) Uses_links( ids map[string]bool ) ( bool ) {
+	if p == nil {
+		return false
+	}
+
+	for _, pth := range p.path_list {
+		for _, l := range pth.Get_links() {
+			if l != nil && ids[*l.Get_id()] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
 /*
 	Returns pointers to both host strings that comprise the pledge.
 */
@@ -311,6 +516,8 @@ func (p *Pledge_bw) Clone( name string ) ( *Pledge_bw ) {
 		Pledge_base:Pledge_base {
 			id:			&name,
 			usrkey:		p.usrkey,
+			owner:		p.owner,
+			project:	p.project,
 			pushed:		p.pushed,
 			paused:		p.paused,
 		},
@@ -320,9 +527,16 @@ func (p *Pledge_bw) Clone( name string ) ( *Pledge_bw ) {
 		tpport2: 	p.tpport2,
 		bandw_in:	p.bandw_in,
 		bandw_out:	p.bandw_out,
+		ceil_in:	p.ceil_in,
+		ceil_out:	p.ceil_out,
+		burst:		p.burst,
 		dscp:		p.dscp,
 		qid:		p.qid,
 		path_list:	p.path_list,
+		shares_in:	p.shares_in,
+		shares_out:	p.shares_out,
+		constraints: p.constraints,
+		degraded:	p.degraded,
 	}
 
 	newpbw.window = p.window.clone()
@@ -431,6 +645,16 @@ func (p *Pledge_bw) From_json( jstr *string ) ( err error ){
 	p.qid = jp.Qid
 	p.bandw_out = jp.Bandwout
 	p.bandw_in = jp.Bandwin
+	p.ceil_in = jp.Ceilin
+	p.ceil_out = jp.Ceilout
+	p.burst = jp.Burst
+	if p.constraints, err = Mk_path_constraints( jp.Constraints ); err != nil {
+		return
+	}
+	p.degraded = jp.Degraded
+	if jp.Project != nil {
+		p.Set_owner( jp.Owner, jp.Project )
+	}
 
 	p.protocol = jp.Protocol
 	if p.protocol == nil {					// we don't tolerate nil ptrs
@@ -582,8 +806,8 @@ func (p *Pledge_bw) String( ) ( s string ) {
 	v1, v2 := p.bw_vlan2string( )
 
 	//NEVER put the usrkey into the string!
-	s = fmt.Sprintf( "%s: togo=%ds %s h1=%s:%s%s h2=%s:%s%s id=%s qid=%s st=%d ex=%d bwi=%d bwo=%d push=%v dscp=%d ptype=bandwidth koe=%v proto=%s", state, diff, caption,
-		*p.host1, *p.tpport2, v1, *p.host2, *p.tpport2, v2, *p.id, *p.qid, commence, expiry, p.bandw_in, p.bandw_out, p.pushed, p.dscp, p.dscp_koe, *p.protocol )
+	s = fmt.Sprintf( "%s: togo=%ds %s h1=%s:%s%s h2=%s:%s%s id=%s qid=%s st=%d ex=%d bwi=%d bwo=%d ceili=%d ceilo=%d burst=%d push=%v dscp=%d ptype=bandwidth koe=%v proto=%s", state, diff, caption,
+		*p.host1, *p.tpport2, v1, *p.host2, *p.tpport2, v2, *p.id, *p.qid, commence, expiry, p.bandw_in, p.bandw_out, p.ceil_in, p.ceil_out, p.burst, p.pushed, p.dscp, p.dscp_koe, *p.protocol )
 	return
 }
 
@@ -604,8 +828,19 @@ func (p *Pledge_bw) To_json( ) ( json string ) {
 	state, _, diff := p.window.state_str()		// get state as a string
 	v1, v2 := p.bw_vlan2string( )
 
-	json = fmt.Sprintf( `{ "state": %q, "time": %d, "bandwin": %d, "bandwout": %d, "host1": "%s:%s%s", "host2": "%s:%s%s", "id": %q, "qid": %q, "dscp": %d, "dscp_koe": %v, "protocol": %q, "ptype": %d }`,
-				state, diff, p.bandw_in,  p.bandw_out, *p.host1, *p.tpport1, v1, *p.host2, *p.tpport2, v2, *p.id, *p.qid, p.dscp, p.dscp_koe, *p.protocol, PT_BANDWIDTH )
+	ceil_in, ceil_out := p.Get_ceiling()
+	split := ""
+	if p.shares_in != nil || p.shares_out != nil {			// only split reservations list the shares
+		split = fmt.Sprintf( `"sharesin": %s, "sharesout": %s, `, shares2json( p.shares_in ), shares2json( p.shares_out ) )
+	}
+	if ! p.constraints.Is_empty() {
+		split += fmt.Sprintf( `"constraints": %q, `, p.constraints )
+	}
+	if p.degraded != "" {
+		split += fmt.Sprintf( `"degraded": %q, `, p.degraded )
+	}
+	json = fmt.Sprintf( `{ "state": %q, "time": %d, "bandwin": %d, "bandwout": %d, "ceilin": %d, "ceilout": %d, "burst": %d, %s"host1": "%s:%s%s", "host2": "%s:%s%s", "id": %q, "qid": %q, "dscp": %d, "dscp_koe": %v, "protocol": %q, "ptype": %d }`,
+				state, diff, p.bandw_in,  p.bandw_out, ceil_in, ceil_out, p.burst, split, *p.host1, *p.tpport1, v1, *p.host2, *p.tpport2, v2, *p.id, *p.qid, p.dscp, p.dscp_koe, *p.protocol, PT_BANDWIDTH )
 
 	return
 }
@@ -636,8 +871,8 @@ func (p *Pledge_bw) To_chkpt( ) ( chkpt string ) {
 	commence, expiry := p.window.get_values()
 	v1, v2 := p.bw_vlan2string( )
 
-	chkpt = fmt.Sprintf( `{ "host1": "%s:%s%s", "host2": "%s:%s%s", "commence": %d, "expiry": %d, "bandwin": %d, "bandwout": %d, "id": %q, "qid": %q, "usrkey": %q, "dscp": %d, "dscp_koe": %v, "protocol": %q, "ptype": %d }`,
-			*p.host1, *p.tpport1, v1, *p.host2, *p.tpport2, v2, commence, expiry, p.bandw_in, p.bandw_out, *p.id, *p.qid, *p.usrkey, p.dscp, p.dscp_koe, *p.protocol, PT_BANDWIDTH )
+	chkpt = fmt.Sprintf( `{ "host1": "%s:%s%s", "host2": "%s:%s%s", "commence": %d, "expiry": %d, "bandwin": %d, "bandwout": %d, "ceilin": %d, "ceilout": %d, "burst": %d, "constraints": %q, "degraded": %q, "id": %q, "qid": %q, "usrkey": %q, "dscp": %d, "dscp_koe": %v, "protocol": %q, %s"ptype": %d }`,
+			*p.host1, *p.tpport1, v1, *p.host2, *p.tpport2, v2, commence, expiry, p.bandw_in, p.bandw_out, p.ceil_in, p.ceil_out, p.burst, p.constraints.String(), p.degraded, *p.id, *p.qid, *p.usrkey, p.dscp, p.dscp_koe, *p.protocol, p.owner2chkpt(), PT_BANDWIDTH )
 
 	return
 }
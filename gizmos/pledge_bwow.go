@@ -37,6 +37,7 @@
 				16 Aug 2015 : Move common code into Pledge_base
 				04 Feb 2016 : Add proto to chkpt and string output.
 				12 Apr 2016 : Correct bug in String() output.
+				18 Oct 2026 : Save owner and project in checkpoint.
 */
 
 package gizmos
@@ -82,6 +83,8 @@ type Json_pledge_bwow struct {
 	Id			*string
 	Qid			*string
 	Usrkey		*string
+	Owner		*string
+	Project		*string
 	Match_v6	bool
 	Ptype		int
 }
@@ -266,6 +269,8 @@ func (p *Pledge_bwow) Clone( name string ) ( *Pledge_bwow ) {
 		Pledge_base:Pledge_base {
 			id:			&name,
 			usrkey:		p.usrkey,
+			owner:		p.owner,
+			project:	p.project,
 			pushed:		p.pushed,
 			paused:		p.paused,
 		},
@@ -361,6 +366,9 @@ func (p *Pledge_bwow) From_json( jstr *string ) ( err error ){
 	p.usrkey = jp.Usrkey
 	p.qid = jp.Qid
 	p.bandw_out = jp.Bandwout
+	if jp.Project != nil {
+		p.Set_owner( jp.Owner, jp.Project )
+	}
 
 	p.protocol = jp.Protocol
 	if p.protocol == nil {					// we don't tolerate nil ptrs
@@ -534,8 +542,8 @@ func (p *Pledge_bwow) To_chkpt( ) ( chkpt string ) {
 	commence, expiry := p.window.get_values()
 	v1 := p.vlan2string( )
 
-	chkpt = fmt.Sprintf( `{ "src": "%s:%s%s", "dest": "%s:%s", "commence": %d, "expiry": %d, "bandwout": %d, "id": %q, "qid": %q, "usrkey": %q, "dscp": %d, "protocol": %q, "ptype": %d }`,
-			*p.src, *p.src_tpport, v1, *p.dest, *p.dest_tpport,  commence, expiry, p.bandw_out, *p.id, *p.qid, *p.usrkey, p.dscp, *p.protocol, PT_OWBANDWIDTH )
+	chkpt = fmt.Sprintf( `{ "src": "%s:%s%s", "dest": "%s:%s", "commence": %d, "expiry": %d, "bandwout": %d, "id": %q, "qid": %q, "usrkey": %q, "dscp": %d, "protocol": %q, %s"ptype": %d }`,
+			*p.src, *p.src_tpport, v1, *p.dest, *p.dest_tpport,  commence, expiry, p.bandw_out, *p.id, *p.qid, *p.usrkey, p.dscp, *p.protocol, p.owner2chkpt(), PT_OWBANDWIDTH )
 
 	return
 }
@@ -34,6 +34,12 @@
 				16 Nov 2015 - Add tenant_id, stdout, stderr to Pledge_mirror
 				24 Nov 2015 - Add options
 				25 Feb 2016 - Correct formatting issue in json output.
+				18 Oct 2026 - Save owner and project in checkpoint.
+				19 Oct 2026 - Added packet filter (direction, protocol, ports, cidrs, sampling).
+				19 Oct 2026 - Added tunnel type (gre, erspan2, erspan3, vxlan) and tunnel id for the output.
+				19 Oct 2026 - Added bandwidth (cap) for admission control and the gate or path(s) it is reserved on.
+				19 Oct 2026 - Added Get_ports, Set_ports and Get_vlan so ports can be added to or removed from a mirror.
+				19 Oct 2026 - Remember (and checkpoint) that the bandwidth was estimated so it follows port changes.
 */
 
 package gizmos
@@ -44,6 +50,13 @@ import (
 	"strings"
 )
 
+const (
+	MT_GRE		string = "gre"				// mirror output tunnel types
+	MT_ERSPAN2	string = "erspan2"			// ERSPAN type II
+	MT_ERSPAN3	string = "erspan3"			// ERSPAN type III
+	MT_VXLAN	string = "vxlan"
+)
+
 // needs rework to rename fields that make sense to mirroring
 type Pledge_mirror struct {
 				Pledge_base	// common fields
@@ -64,6 +77,13 @@ type Pledge_mirror struct {
 	match_v6	bool		// true if we should force flow-mods to match on IPv6
 	tenant_id	*string
 	options		*string
+	filter		*Mirror_filter	// nil if all traffic is mirrored
+	tunnel		string			// output tunnel type when output is an address (MT_ constants)
+	tunid		int				// erspan session id or vxlan vni (0 for gre)
+	bandw		int64			// bandwidth (bps) reserved for mirrored traffic; 0 if not accounted
+	bw_est		bool			// bandwidth was estimated from the ports (not given by the user)
+	gate		*Gate			// gate on the physical host when the output is outside of the graph
+	path_list	[]*Path			// path(s) to the output when it is a host in the graph
 
 	stdout		[]string	// stdout/err from last remote command -- not saved in checkpoints!
 	stderr		[]string
@@ -88,11 +108,17 @@ type Json_pledge struct {
 	Id			*string
 	Qid			*string
 	Usrkey		*string
+	Owner		*string
+	Project		*string
 	Ptype		int
 	//Mbox_list	[]*Mbox
 	Match_v6	bool
 	Tenant_id	*string
 	Options		*string
+	Filter		*string
+	Tunnel		string
+	Tunid		int
+	Bw_est		bool
 }
 
 // ---- private -------------------------------------------------------------------
@@ -149,6 +175,8 @@ func (p *Pledge_mirror) Clone( name string ) ( Pledge ) {
 		Pledge_base:Pledge_base{
 			id:			p.id,
 			usrkey:		p.usrkey,			// user "cookie"
+			owner:		p.owner,
+			project:	p.project,
 			pushed:		p.pushed,
 			paused:		p.paused,
 		},
@@ -163,6 +191,11 @@ func (p *Pledge_mirror) Clone( name string ) ( Pledge ) {
 		//path_list:	p.path_list,
 		tenant_id:	p.tenant_id,
 		options:	p.options,
+		filter:		p.filter,
+		tunnel:		p.tunnel,
+		tunid:		p.tunid,
+		bandw:		p.bandw,
+		bw_est:		p.bw_est,
 		stdout:		make([]string, 0),
 		stderr:		make([]string, 0),
 	}
@@ -208,7 +241,18 @@ func (p *Pledge_mirror) From_json( jstr *string ) ( err error ){
 	p.qid = jp.Qid
 	p.tenant_id = jp.Tenant_id
 	p.options = jp.Options
-	//p.bandw_out = jp.Bandwout
+	p.tunnel = jp.Tunnel
+	p.tunid = jp.Tunid
+	if jp.Filter != nil && *jp.Filter != "" {
+		if p.filter, err = Str2mirror_filter( *jp.Filter ); err != nil {
+			return
+		}
+	}
+	if jp.Project != nil {
+		p.Set_owner( jp.Owner, jp.Project )
+	}
+	p.bandw = jp.Bandwout
+	p.bw_est = jp.Bw_est
 	//p.bandw_in = jp.Bandwin
 
 	return
@@ -237,11 +281,26 @@ func (p *Pledge_mirror) Has_host( hname *string ) ( bool ) {
 }
 
 /*
-	must implement dummy for interface
+	Set the path list used when the mirror's bandwidth is reserved toward a host in the graph.
+*/
 func (p *Pledge_mirror) Set_path_list( pl []*Path ) {
-	return
+	p.path_list = pl
+}
+
+func (p *Pledge_mirror) Get_path_list( ) ( []*Path ) {
+	return p.path_list
 }
+
+/*
+	Associate the gate that the mirror's bandwidth is reserved on (output outside of the graph).
 */
+func (p *Pledge_mirror) Set_gate( g *Gate ) {
+	p.gate = g
+}
+
+func (p *Pledge_mirror) Get_gate( ) ( *Gate ) {
+	return p.gate
+}
 
 
 /*
@@ -262,6 +321,50 @@ func (p *Pledge_mirror) Get_proto( ) ( *string ) {
 }
 */
 
+/*
+	Returns the list of mirrored ports (the vlan list, which shares the field, is not included).
+*/
+func (p *Pledge_mirror) Get_ports( ) ( []string ) {
+	ports := make( []string, 0, 4 )
+	if p == nil || p.host1 == nil {
+		return ports
+	}
+
+	for _, v := range strings.Fields( *p.host1 ) {
+		if ! strings.HasPrefix( v, "vlan:" ) {
+			ports = append( ports, v )
+		}
+	}
+	return ports
+}
+
+/*
+	Returns the vlan list of the mirror or "" if all vlans are mirrored.
+*/
+func (p *Pledge_mirror) Get_vlan( ) ( string ) {
+	if p == nil || p.host1 == nil {
+		return ""
+	}
+
+	for _, v := range strings.Fields( *p.host1 ) {
+		if strings.HasPrefix( v, "vlan:" ) {
+			return v[5:]
+		}
+	}
+	return ""
+}
+
+/*
+	Replace the list of mirrored ports keeping the vlan list.
+*/
+func (p *Pledge_mirror) Set_ports( ports []string ) {
+	t := strings.Join( ports, " " )
+	if vlan := p.Get_vlan(); vlan != "" {
+		t += " vlan:" + vlan
+	}
+	p.host1 = &t
+}
+
 func (p *Pledge_mirror) Get_Tenant() *string {
 	return p.tenant_id
 }
@@ -279,6 +382,100 @@ func (p *Pledge_mirror) Get_Options() ( *string ) {
 	return p.options
 }
 
+/*
+	Set the packet filter; nil mirrors all traffic.
+*/
+func (p *Pledge_mirror) Set_filter( f *Mirror_filter ) {
+	p.filter = f
+}
+
+func (p *Pledge_mirror) Get_filter() ( *Mirror_filter ) {
+	return p.filter
+}
+
+/*
+	Set the bandwidth (bps) which is reserved for, and limits, the mirrored traffic.
+*/
+func (p *Pledge_mirror) Set_bandwidth( bw int64 ) {
+	if bw < 0 {
+		bw = 0
+	}
+	p.bandw = bw
+}
+
+func (p *Pledge_mirror) Get_bandwidth( ) ( int64 ) {
+	if p == nil {
+		return 0
+	}
+	return p.bandw
+}
+
+/*
+	Mark the bandwidth as estimated from the mirrored ports (true) or given by the user (false).
+	An estimated bandwidth is estimated again when ports are added or removed.
+*/
+func (p *Pledge_mirror) Set_bw_estimated( est bool ) {
+	p.bw_est = est
+}
+
+func (p *Pledge_mirror) Is_bw_estimated( ) ( bool ) {
+	return p != nil && p.bw_est
+}
+
+/*
+	Returns the largest tunnel id allowed for the tunnel type; 0 if the type doesn't use
+	an id (gre) and -1 if the type is not known.
+*/
+func Mirror_tunnel_max( ttype string ) ( int ) {
+	switch ttype {
+		case "", MT_GRE:
+			return 0
+
+		case MT_ERSPAN2, MT_ERSPAN3:
+			return 1023					// 10 bit session id
+
+		case MT_VXLAN:
+			return 16777215				// 24 bit vni
+	}
+
+	return -1
+}
+
+/*
+	Returns the name of the id space used by the tunnel type. Both ERSPAN types share
+	the session id space at a collector.
+*/
+func Mirror_tunnel_family( ttype string ) ( string ) {
+	if ttype == MT_ERSPAN2 || ttype == MT_ERSPAN3 {
+		return "erspan"
+	}
+	if ttype == "" {
+		return MT_GRE
+	}
+	return ttype
+}
+
+/*
+	Set the output tunnel type and id.
+*/
+func (p *Pledge_mirror) Set_tunnel( ttype string, id int ) {
+	if ttype == MT_GRE {
+		ttype = ""
+	}
+	p.tunnel = ttype
+	p.tunid = id
+}
+
+/*
+	Returns the output tunnel type (gre if not set) and id.
+*/
+func (p *Pledge_mirror) Get_tunnel() ( string, int ) {
+	if p.tunnel == "" {
+		return MT_GRE, 0
+	}
+	return p.tunnel, p.tunid
+}
+
 // --------- humanisation or export functions --------------------------------------------------------
 
 /*
@@ -294,8 +491,8 @@ func (p *Pledge_mirror) String( ) ( s string ) {
 	c, e := p.window.get_values( )
 
 	//NEVER put the usrkey into the string!
-	s = fmt.Sprintf( "%s: togo=%ds %s ports=%s output=%s id=%s st=%d ex=%d push=%v ptype=mirroring", state, diff, caption,
-		*p.host1, *p.host2, *p.id, c, e, p.pushed )
+	s = fmt.Sprintf( "%s: togo=%ds %s ports=%s output=%s id=%s st=%d ex=%d bw=%d push=%v ptype=mirroring", state, diff, caption,
+		*p.host1, *p.host2, *p.id, c, e, p.bandw, p.pushed )
 
 	return
 }
@@ -310,8 +507,9 @@ func (p *Pledge_mirror) To_json( ) ( json string ) {
 
 	state, _, diff := p.window.state_str( )
 
-	json = fmt.Sprintf( `{ "state": %q, "time": %d, "host1": "%s", "host2": "%s", "id": %q, "tenant_id": %q, "options": %q, "ptype": %d }`,
-		state, diff, *p.host1, *p.host2, *p.id, *p.tenant_id, *p.options, PT_MIRRORING )
+	ttype, tunid := p.Get_tunnel()
+	json = fmt.Sprintf( `{ "state": %q, "time": %d, "host1": "%s", "host2": "%s", "id": %q, "tenant_id": %q, "options": %q, "filter": %s, "tunnel": %q, "tunid": %d, "bandwidth": %d, "ptype": %d }`,
+		state, diff, *p.host1, *p.host2, *p.id, *p.tenant_id, *p.options, p.filter.To_json(), ttype, tunid, p.bandw, PT_MIRRORING )
 
 	return
 }
@@ -347,9 +545,23 @@ func (p *Pledge_mirror) To_chkpt( ) ( chkpt string ) {
 		tenant_id = *p.tenant_id
 	} 
 
+	filter := ""
+	if p.filter != nil {
+		filter = fmt.Sprintf( `"filter": %q, `, p.filter.String() )
+	}
+	if p.tunnel != "" {
+		filter += fmt.Sprintf( `"tunnel": %q, "tunid": %d, `, p.tunnel, p.tunid )
+	}
+	if p.bandw > 0 {
+		filter += fmt.Sprintf( `"bandwout": %d, `, p.bandw )
+		if p.bw_est {
+			filter += `"bw_est": true, `
+		}
+	}
+
 	chkpt = fmt.Sprintf(
-		`{ "host1": "%s", "host2": "%s", "commence": %d, "expiry": %d, "id": %q, "qid": %q, "usrkey": %q, "tenant_id": %q, "options": %q, "ptype": %d }`,
-		*p.host1, *p.host2, c, e, *p.id, *p.qid, *p.usrkey, tenant_id, options, PT_MIRRORING )
+		`{ "host1": "%s", "host2": "%s", "commence": %d, "expiry": %d, "id": %q, "qid": %q, "usrkey": %q, "tenant_id": %q, "options": %q, %s%s"ptype": %d }`,
+		*p.host1, *p.host2, c, e, *p.id, *p.qid, *p.usrkey, tenant_id, options, filter, p.owner2chkpt(), PT_MIRRORING )
 
 	return
 }
@@ -430,6 +642,8 @@ func (p *Pledge_mirror) Equals( p2 *Pledge ) ( bool ) {
 		if ! Strings_equal( p.host1, p2m.host1 ) { return false }
 		if ! Strings_equal( p.host2, p2m.host2 ) { return false }
 		if ! Strings_equal( p.qid, p2m.qid ) { return false }
+		if p.filter.String() != p2m.filter.String() { return false }
+		if p.tunnel != p2m.tunnel { return false }
 
 		if !p.window.overlaps( p2m.window ) {
 			return false;
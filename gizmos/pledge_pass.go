@@ -28,6 +28,7 @@
 	Author:		E. Scott Daniels
 
 	Mods:		12 Apr 2016 : Changes to support duplicate refresh.
+				18 Oct 2026 : Save owner and project in checkpoint.
 */
 
 package gizmos
@@ -62,6 +63,8 @@ type Json_pledge_pass struct {
 	Commence	int64
 	Expiry		int64
 	Usrkey		*string
+	Owner		*string
+	Project		*string
 	Id			*string
 	Ptype		int
 }
@@ -197,6 +200,8 @@ func (p *Pledge_pass) Clone( name string ) ( *Pledge_pass ) {
 		Pledge_base:Pledge_base {
 			id:			&name,
 			usrkey:		p.usrkey,
+			owner:		p.owner,
+			project:	p.project,
 			pushed:		p.pushed,
 			paused:		p.paused,
 		},
@@ -310,6 +315,9 @@ func (p *Pledge_pass) From_json( jstr *string ) ( err error ){
 	p.window, _ = mk_pledge_window( jp.Commence, jp.Expiry )
 	p.id = jp.Id
 	p.usrkey = jp.Usrkey
+	if jp.Project != nil {
+		p.Set_owner( jp.Owner, jp.Project )
+	}
 	p.protocol = jp.Protocol
 	if p.protocol == nil {					// we don't tolerate nil ptrs
 		p.protocol = &empty_str
@@ -454,7 +462,7 @@ func (p *Pledge_pass) To_chkpt( ) ( chkpt string ) {
 	commence, expiry := p.window.get_values()
 	v := p.vlan2string( )
 
-	chkpt = fmt.Sprintf( `{ "host": "%s:%s%s", "commence": %d, "expiry": %d, "id": %q, "usrkey": %q, "ptype": %d }`, *p.host, *p.tpport, v, commence, expiry, *p.id, *p.usrkey, PT_PASSTHRU )
+	chkpt = fmt.Sprintf( `{ "host": "%s:%s%s", "commence": %d, "expiry": %d, "id": %q, "usrkey": %q, %s"ptype": %d }`, *p.host, *p.tpport, v, commence, expiry, *p.id, *p.usrkey, p.owner2chkpt(), PT_PASSTHRU )
 
 	return
 }
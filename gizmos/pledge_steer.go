@@ -40,6 +40,9 @@
 				26 May 2015 - Broken out of pledge with conversion to interface
 				01 Jun 2015 - Added equal() support
 				16 Aug 2015 - Move common code into Pledge_base
+				18 Oct 2026 - Save owner and project in checkpoint.
+				19 Oct 2026 - Each hop is a middlebox pool (a single box is a pool of one).
+				19 Oct 2026 - Track the select groups allocated to the pools.
 */
 
 package gizmos
@@ -47,6 +50,7 @@ package gizmos
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 type Pledge_steer struct {
@@ -57,9 +61,11 @@ type Pledge_steer struct {
 	tpport1		*string		// transport port number or 0 if not defined
 	tpport2		*string		// thee match h1/h2 respectively
 
-	mbox_list	[]*Mbox		// list of middleboxes if the pledge is a steering pledge
+	mbox_list	[]*Mbox		// list of middleboxes if the pledge is a steering pledge (first member of each pool)
+	pools		[]*Mbox_pool	// the middlebox pool for each hop; parallel to mbox_list
 	mbidx		int			// insertion point into mblist
 	match_v6	bool		// true if we should force flow-mods to match on IPv6
+	groups		map[string]uint32	// select group for each pool hop and direction (allocated by res_mgr)
 }
 
 /*
@@ -76,6 +82,8 @@ type Json_stpledge struct {
 	Expiry		int64
 	Id			*string
 	Usrkey		*string
+	Owner		*string
+	Project		*string
 	Ptype		int
 	Mbox_list	[]*Mbox
 	Match_v6	bool
@@ -141,6 +149,8 @@ func (p *Pledge_steer) Clone( name string ) ( *Pledge_steer ) {
 		Pledge_base:Pledge_base{
 			id:			&name,
 			usrkey:		p.usrkey,
+			owner:		p.owner,
+			project:	p.project,
 			pushed:		p.pushed,
 			paused:		p.paused,
 		},
@@ -188,6 +198,9 @@ func (p *Pledge_steer) From_json( jstr *string ) ( err error ){
 	p.window, err = mk_pledge_window( jp.Commence, jp.Expiry )
 	p.id = jp.Id
 	p.usrkey = jp.Usrkey
+	if jp.Project != nil {
+		p.Set_owner( jp.Owner, jp.Project )
+	}
 
 	p.protocol = jp.Protocol
 	if p.protocol == nil {					// we don't tolerate nil ptrs
@@ -224,10 +237,23 @@ func (p *Pledge_steer) Get_mbidx( ) ( int ) {
 }
 
 /*
-	Add the middlebox reference to the pledge
+	Add the middlebox reference to the pledge as a hop by itself.
 */
 func (p *Pledge_steer) Add_mbox( mb *Mbox ) {
-	if p == nil {
+	if p == nil || mb == nil {
+		return
+	}
+
+	mp := Mk_mbox_pool( mb.Get_id(), MBP_HASH )
+	mp.Add_member( mb, 1 )
+	p.Add_mbox_pool( mp )
+}
+
+/*
+	Add a middlebox pool as the next hop.
+*/
+func (p *Pledge_steer) Add_mbox_pool( mp *Mbox_pool ) {
+	if p == nil || mp.Get_member_count() == 0 {
 		return
 	}
 
@@ -239,10 +265,85 @@ func (p *Pledge_steer) Add_mbox( mb *Mbox ) {
 		p.mbox_list = nmb
 	}
 	
-	p.mbox_list[p.mbidx] = mb
+	p.mbox_list[p.mbidx] = mp.Get_mbox()
+	p.pools = append( p.pools, mp )
 	p.mbidx++
 }
 
+/*
+	Return the pool for hop n, or nil if out of bounds.
+*/
+func (p *Pledge_steer) Get_mbox_pool( n int ) ( *Mbox_pool ) {
+	if n < 0 || n >= len( p.pools ) {
+		return nil
+	}
+
+	return p.pools[n]
+}
+
+/*
+	Set the state of pool members with the mac address. Single middleboxes are not changed as
+	there is nothing to shift their traffic to. Returns true if a member changed state.
+*/
+func (p *Pledge_steer) Set_mbox_state( mac string, up bool ) ( changed bool ) {
+	for _, mp := range p.pools {
+		if mp.Is_pool() && mp.Set_state( mac, up ) {
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+/*
+	Set the select group used to send to the pool at hop (counted in the direction of travel).
+	A gid of 0 removes it.
+*/
+func (p *Pledge_steer) Set_group( hop int, forward bool, gid uint32 ) {
+	key := fmt.Sprintf( "%d/%v", hop, forward )
+	if gid == 0 {
+		delete( p.groups, key )
+		return
+	}
+
+	if p.groups == nil {
+		p.groups = make( map[string]uint32 )
+	}
+	p.groups[key] = gid
+}
+
+/*
+	Return the select group for the pool at hop; 0 if none has been allocated.
+*/
+func (p *Pledge_steer) Get_group( hop int, forward bool ) ( uint32 ) {
+	return p.groups[fmt.Sprintf( "%d/%v", hop, forward )]
+}
+
+/*
+	Return all of the select groups allocated to the pledge.
+*/
+func (p *Pledge_steer) Get_groups( ) ( gl []uint32 ) {
+	gl = make( []uint32, 0, len( p.groups ) )
+	for _, gid := range p.groups {
+		gl = append( gl, gid )
+	}
+	return gl
+}
+
+/*
+	Return the middleboxes in pools which are of interest to the health check.
+*/
+func (p *Pledge_steer) Get_pool_members( ) ( mbl []*Mbox ) {
+	mbl = make( []*Mbox, 0 )
+	for _, mp := range p.pools {
+		if mp.Is_pool() {
+			mbl = append( mbl, mp.members... )
+		}
+	}
+
+	return mbl
+}
+
 /*
 	Add a protocol reference to the pledge (e.g. tcp:80 or udp:4444)
 */
@@ -321,11 +422,17 @@ func (p *Pledge_steer) To_json( ) ( json string ) {
 			state, diff, *p.host1, *p.tpport1, *p.host2, *p.tpport2, proto, *p.id, PT_STEERING )
 
 	sep := ""
+	failed := make( []string, 0 )
 	for i := 0; i < p.mbidx; i++ {
-		json += fmt.Sprintf( `%s%q`, sep, *p.mbox_list[i].Get_id() )
+		json += fmt.Sprintf( `%s%q`, sep, *p.pools[i].Get_id() )
+		failed = append( failed, p.pools[i].Get_failed()... )
 		sep = ","			
 	}
-	json += " ] }"
+	json += " ]"
+	if len( failed ) > 0 {
+		json += `, "mbox_failed": [ "` + strings.Join( failed, `", "` ) + `" ]`
+	}
+	json += " }"
 
 	return
 }
@@ -355,14 +462,20 @@ func (p *Pledge_steer) To_chkpt( ) ( chkpt string ) {
 	if p.protocol != nil {
 		proto = *p.protocol
 	}
-	chkpt = fmt.Sprintf( `{ "host1": "%s:%s", "host2": "%s:%s", "protocol": %q, "commence": %d, "expiry": %d, "id": %q, "usrkey": %q, "ptype": %d, "mbox_list": [ `,
-			*p.host1, *p.tpport1, *p.host2, *p.tpport2, proto, c, e, *p.id,  *p.usrkey, PT_STEERING )
+	chkpt = fmt.Sprintf( `{ "host1": "%s:%s", "host2": "%s:%s", "protocol": %q, "commence": %d, "expiry": %d, "id": %q, "usrkey": %q, %s"ptype": %d, "mbox_list": [ `,
+			*p.host1, *p.tpport1, *p.host2, *p.tpport2, proto, c, e, *p.id,  *p.usrkey, p.owner2chkpt(), PT_STEERING )
 
 	sep := ""
 	for i := 0; i < p.mbidx; i++ {
 		chkpt += fmt.Sprintf( `%s %s`, sep, *p.mbox_list[i].To_json() )
 		sep = ","			
 	}
+	chkpt += ` ], "mbox_pools": [ `
+	sep = ""
+	for i := 0; i < p.mbidx; i++ {
+		chkpt += sep + p.pools[i].To_json()
+		sep = ", "
+	}
 	chkpt += " ] }"
 
 	return
@@ -32,6 +32,7 @@ package gizmos
 import (
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -128,7 +129,7 @@ func Test_pw_excessive( t *testing.T ) {
 func Test_ob_validtime( t *testing.T ) {
 	fmt.Fprintf( os.Stderr, "\n------- valid obligattion tests ---------\n" );
 
-	if Valid_obtime( 1735707600-1 ) { 				// expect pass, time just under bounds
+	if Valid_obtime( DEF_END_TS-1 ) { 				// expect pass, time just under bounds
 		fmt.Fprintf( os.Stderr, "OK:     max-1 time returned valid\n" )
 	} else {
 		fmt.Fprintf( os.Stderr, "FAIL:   max-1 time didn't return valid\n" )
@@ -142,7 +143,7 @@ func Test_ob_validtime( t *testing.T ) {
 		t.Fail()
 	}
 
-	if Valid_obtime( 1735707600+1 ) {			// expect failure, time out of bounds
+	if Valid_obtime( DEF_END_TS+1 ) {			// expect failure, time out of bounds
 		fmt.Fprintf( os.Stderr, "FAIL:   max+1 time returned valid\n" )
 		t.Fail()
 	} else {
@@ -230,3 +231,484 @@ func Test_bw_equals( t *testing.T ) {
 	}
 	fmt.Fprintf( os.Stderr, "\n" )
 }
+
+/*
+	Ensure that the owner of a pledge survives a checkpoint/reload cycle and that
+	ownership checks only match the owning project. The pledge is built directly
+	so that the test doesn't depend on the obligation end of time.
+*/
+func Test_owner( t *testing.T ) {
+	h1 := "proj1/host1"
+	h2 := "proj1/host2"
+	port := "0"
+	id := "r-owner"
+	user := "fred"
+	proj := "proj1"
+	other := "proj2"
+
+	failures := 0
+	now := time.Now().Unix()
+
+	fmt.Fprintf( os.Stderr, "\n----------- pledge owner tests --------------\n" )
+	bp := &Pledge_bw {
+		Pledge_base: Pledge_base {
+			id: &id,
+			usrkey: &empty_str,
+			window: &pledge_window { commence: now + 300, expiry: now + 600 },
+		},
+		host1: &h1,
+		host2: &h2,
+		tpport1: &port,
+		tpport2: &port,
+		bandw_in: 10000,
+		bandw_out: 10000,
+		qid: &empty_str,
+		protocol: &empty_str,
+	}
+
+	if bp.Is_owned_by( &proj ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   pledge without owner reported as owned\n" )
+	}
+
+	bp.Set_owner( &user, &proj )
+	if ! bp.Is_owned_by( &proj ) || bp.Is_owned_by( &other ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   ownership check returned wrong result\n" )
+	}
+
+	cs := bp.To_chkpt()
+	gp, err := Json2pledge( &cs )
+	if err != nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   unable to reload pledge from checkpoint: %s\n", err )
+	} else {
+		u, p := (*gp).Get_owner()
+		if u == nil || p == nil || *u != user || *p != proj {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   owner not restored from checkpoint: %s\n", cs )
+		}
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all pledge owner tests passed\n" )
+	}
+}
+
+/*
+	Verify that a pending push is marked pushed only after all acks, is reset on a failure, and
+	ignores acks from an earlier push.
+*/
+func Test_push_pending( t *testing.T ) {
+	id := "r-pend"
+	failures := 0
+	now := time.Now().Unix()
+
+	fmt.Fprintf( os.Stderr, "\n----------- pending push tests --------------\n" )
+	bp := &Pledge_base {
+		id: &id,
+		usrkey: &empty_str,
+		window: &pledge_window { commence: now, expiry: now + 600 },
+	}
+
+	gen := bp.Set_push_pending( 2 )
+	if bp.Is_pushed() || ! bp.Is_push_pending() {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   pledge not pending after set\n" )
+	}
+
+	if bp.Push_ack( gen, true ) || bp.Is_pushed() {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   pledge marked pushed after first of two acks\n" )
+	}
+
+	if ! bp.Push_ack( gen, true ) || ! bp.Is_pushed() || bp.Is_push_pending() {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   pledge not marked pushed after last ack\n" )
+	}
+
+	gen = bp.Set_push_pending( 3 )
+	if ! bp.Push_ack( gen, false ) || bp.Is_pushed() || bp.Is_push_pending() {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   failed ack did not reset the pledge\n" )
+	}
+	if bp.Push_ack( gen, true ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   ack accepted when nothing was pending\n" )
+	}
+
+	old := bp.Set_push_pending( 1 )
+	gen = bp.Set_push_pending( 1 )					// pushed again before the first was acknowledged
+	if bp.Push_ack( old, true ) || bp.Is_pushed() {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   ack for an earlier push was counted\n" )
+	}
+	if ! bp.Push_ack( gen, true ) || ! bp.Is_pushed() {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   ack for the current push was not counted\n" )
+	}
+
+	bp.Set_push_pending( 1 )
+	if bp.Is_push_stale( 60 ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   new pending push reported as stale\n" )
+	}
+	bp.pend_ts -= 120
+	if ! bp.Is_push_stale( 60 ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   old pending push not reported as stale\n" )
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all pending push tests passed\n" )
+	}
+}
+
+/*
+	Verify that a ceiling and burst are kept with a bandwidth pledge and that queue strings
+	carry min=guarantee and max=ceiling once headroom is added to the queue.
+*/
+func Test_bw_limits( t *testing.T ) {
+	h1 := "proj1/host1"
+	h2 := "proj1/host2"
+	port := "0"
+	id := "r-limits"
+	sw1 := "sw1"
+	sw2 := "sw2"
+
+	failures := 0
+	now := time.Now().Unix()
+
+	fmt.Fprintf( os.Stderr, "\n----------- pledge ceiling/burst tests --------------\n" )
+	bp := &Pledge_bw {
+		Pledge_base: Pledge_base {
+			id: &id,
+			usrkey: &empty_str,
+			window: &pledge_window { commence: now + 300, expiry: now + 600 },
+		},
+		host1: &h1,
+		host2: &h2,
+		tpport1: &port,
+		tpport2: &port,
+		bandw_in: 10000,
+		bandw_out: 20000,
+		qid: &empty_str,
+		protocol: &empty_str,
+	}
+
+	if ci, co := bp.Get_ceiling(); ci != 10000 || co != 20000 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   ceiling without limits set is not the guarantee: %d %d\n", ci, co )
+	}
+
+	if bp.Set_limits( 5000, 0, 0 ) == nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   ceiling below the guarantee was accepted\n" )
+	}
+
+	bp.Set_limits( 50000, 0, 8000 )
+	cs := bp.To_chkpt()
+	gp, err := Json2pledge( &cs )
+	if err != nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   unable to reload pledge from checkpoint: %s\n", err )
+	} else {
+		rp := (*gp).( *Pledge_bw )
+		if ci, co := rp.Get_ceiling(); ci != 50000 || co != 20000 || rp.Get_burst() != 8000 {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   limits not restored from checkpoint: %s\n", cs )
+		}
+	}
+
+	l := Mk_link( &sw1, &sw2, 1000000, 0, nil )
+	qid := "r-limits"
+	l.Set_forward_queue( &qid, 1000, 2000, 10000, nil )
+	l.Set_queue_limits( &qid, 1000, 2000, 40000, 8000 )
+	if s := l.Queues2str( 1500 ); ! strings.Contains( s, ",10000,50000,200,8000" ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   queue string does not carry guarantee/ceiling/burst: %s\n", s )
+	}
+	if l.Get_allocation( 1500 ) != 10000 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   headroom was counted as allocation: %d\n", l.Get_allocation( 1500 ) )
+	}
+
+	l.Set_forward_queue( &qid, 1000, 2000, -10000, nil )
+	l.Set_queue_limits( &qid, 1000, 2000, -40000, -1 )
+	if s := l.Queues2str( 1500 ); s != "" {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   queue not removed: %s\n", s )
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all pledge ceiling/burst tests passed\n" )
+	}
+}
+
+/*
+	Verify mirror filter validation, the ovs matches generated and that the filter survives
+	a checkpoint.
+*/
+func Test_mirror_filter( t *testing.T ) {
+	failures := 0
+
+	fmt.Fprintf( os.Stderr, "\n----------- mirror filter tests --------------\n" )
+	bad := [][]string {
+		{ "sideways", "tcp", "", "80", "", "" },
+		{ "in", "gre", "", "", "", "" },
+		{ "in", "icmp", "", "80", "", "" },					// ports without tcp/udp/sctp
+		{ "in", "tcp", "", "90-80", "", "" },
+		{ "in", "", "", "", "10.0.0.0/8", "fd00::/8" },		// mixed families
+		{ "in", "", "", "", "10.0.0.0/33", "" },
+	}
+	for _, b := range bad {
+		if _, err := Mk_mirror_filter( b[0], b[1], b[2], b[3], b[4], b[5], 0 ); err == nil {
+			failures++
+			fmt.Fprintf( os.Stderr, "FAIL:   bad mirror filter accepted: %v\n", b )
+		}
+	}
+
+	if m := strings.Join( Port_range_masks( 80, 90 ), " " ); m != "0x0050/0xfff8 0x0058/0xfffe 90" {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   port range masks not as expected: %s\n", m )
+	}
+
+	f, err := Mk_mirror_filter( "in", "TCP", "", "80-81", "10.1.2.3/16", "", 10 )
+	if err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL:   valid mirror filter rejected: %s\n", err )
+		t.Fail()
+		return
+	}
+	if a := f.To_args(); a != "-din -s10 -mtcp,nw_src=10.1.0.0/16,tp_dst=0x0050/0xfffe" {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   mirror filter args not as expected: %s\n", a )
+	}
+
+	f6, _ := Mk_mirror_filter( "", "udp", "53", "", "", "fd00::/8", 0 )
+	if m := f6.Ovs_matches(); len( m ) != 1 || m[0] != "udp6,ipv6_dst=fd00::/8,tp_src=53" || f6.Get_direction() != MF_BOTH {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   ipv6 mirror filter matches not as expected: %v\n", m )
+	}
+
+	now := time.Now().Unix()
+	id := "mir-filter"
+	port := "fa:16:3e:00:00:01"
+	out := "10.9.9.9"
+	phost := "host1"
+	pm := &Pledge_mirror {
+		Pledge_base: Pledge_base {
+			id: &id,
+			usrkey: &empty_str,
+			window: &pledge_window { commence: now + 60, expiry: now + 600 },
+		},
+		host1: &port,
+		host2: &out,
+		qid: &phost,
+		tenant_id: &empty_str,
+		options: &empty_str,
+	}
+	pm.Set_filter( f )
+	cs := pm.To_chkpt()
+	rp, err := Json2pledge( &cs )
+	if err != nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   unable to reload mirror pledge from checkpoint: %s\n", err )
+	} else if rf := (*rp).( *Pledge_mirror ).Get_filter(); rf.String() != f.String() {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   mirror filter not restored from checkpoint: %s\n", cs )
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all mirror filter tests passed\n" )
+	}
+}
+
+/*
+	Verify the mirror tunnel id limits and that the tunnel survives a checkpoint.
+*/
+func Test_mirror_tunnel( t *testing.T ) {
+	failures := 0
+
+	fmt.Fprintf( os.Stderr, "\n----------- mirror tunnel tests --------------\n" )
+	if Mirror_tunnel_max( MT_GRE ) != 0 || Mirror_tunnel_max( MT_ERSPAN3 ) != 1023 || Mirror_tunnel_max( MT_VXLAN ) != 16777215 || Mirror_tunnel_max( "ipip" ) != -1 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   mirror tunnel id limits not as expected\n" )
+	}
+	if Mirror_tunnel_family( MT_ERSPAN2 ) != Mirror_tunnel_family( MT_ERSPAN3 ) || Mirror_tunnel_family( "" ) != MT_GRE {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   mirror tunnel families not as expected\n" )
+	}
+
+	now := time.Now().Unix()
+	id := "mir-tunnel"
+	port := "fa:16:3e:00:00:01"
+	out := "10.9.9.9"
+	phost := "host1"
+	pm := &Pledge_mirror {
+		Pledge_base: Pledge_base {
+			id: &id,
+			usrkey: &empty_str,
+			window: &pledge_window { commence: now + 60, expiry: now + 600 },
+		},
+		host1: &port,
+		host2: &out,
+		qid: &phost,
+		tenant_id: &empty_str,
+		options: &empty_str,
+	}
+	if tt, _ := pm.Get_tunnel(); tt != MT_GRE {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   default mirror tunnel is not gre: %s\n", tt )
+	}
+
+	pm.Set_tunnel( MT_VXLAN, 5001 )
+	pm.Set_bandwidth( 200000000 )
+	pm.Set_bw_estimated( true )
+	cs := pm.To_chkpt()
+	rp, err := Json2pledge( &cs )
+	if err != nil {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   unable to reload mirror pledge from checkpoint: %s\n", err )
+	} else if tt, tid := (*rp).( *Pledge_mirror ).Get_tunnel(); tt != MT_VXLAN || tid != 5001 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   mirror tunnel not restored from checkpoint: %s\n", cs )
+	} else if bw := (*rp).( *Pledge_mirror ).Get_bandwidth(); bw != 200000000 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   mirror bandwidth not restored from checkpoint: %d\n", bw )
+	} else if ! (*rp).( *Pledge_mirror ).Is_bw_estimated() {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   estimated mirror bandwidth not restored from checkpoint: %s\n", cs )
+	}
+	if pm.Clone( id ).( *Pledge_mirror ).Get_bandwidth() != pm.Get_bandwidth() {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   mirror bandwidth not cloned\n" )
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all mirror tunnel tests passed\n" )
+	}
+}
+
+func Test_mirror_ports( t *testing.T ) {
+	failures := 0
+
+	fmt.Fprintf( os.Stderr, "\n----------- mirror port tests --------------\n" )
+	ports := "fa:16:3e:00:00:01 fa:16:3e:00:00:02 vlan:10,20"
+	pm := &Pledge_mirror { host1: &ports }
+	if p := pm.Get_ports(); len( p ) != 2 || p[1] != "fa:16:3e:00:00:02" {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   mirror ports not as expected: %v\n", p )
+	}
+	if pm.Get_vlan() != "10,20" {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   mirror vlan not as expected: %s\n", pm.Get_vlan() )
+	}
+
+	pm.Set_ports( []string { "fa:16:3e:00:00:03" } )
+	if *pm.host1 != "fa:16:3e:00:00:03 vlan:10,20" {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   set ports did not keep the vlan: %s\n", *pm.host1 )
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all mirror port tests passed\n" )
+	}
+}
+
+func Test_mbox_pool( t *testing.T ) {
+	failures := 0
+
+	fmt.Fprintf( os.Stderr, "\n----------- middlebox pool tests --------------\n" )
+	ids := []string { "fw1", "fw2" }
+	macs := []string { "fa:16:3e:00:00:0a", "fa:16:3e:00:00:0b" }
+	sw := "host1"
+	pid := "fw1@3+fw2"
+	mp := Mk_mbox_pool( &pid, MBP_WEIGHTED )
+	mp.Add_member( Mk_mbox( &ids[0], &macs[0], &sw, 4 ), 3 )
+	mp.Add_member( Mk_mbox( &ids[1], &macs[1], &sw, 5 ), 0 )
+
+	if gp := mp.Group_parm( 0x0e000001 ); gp != "0xe000001,weighted,fa:16:3e:00:00:0a/3,fa:16:3e:00:00:0b/1" {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   pool group parm not as expected: %s\n", gp )
+	}
+
+	id := "st-pool"
+	ps := &Pledge_steer { Pledge_base: Pledge_base { id: &id } }
+	ps.Add_mbox_pool( mp )
+	ps.Add_mbox( Mk_mbox( &ids[0], &macs[0], &sw, 4 ) )			// a lone box is never taken out
+	if len( ps.Get_pool_members() ) != 2 || ps.Get_mbox_count() != 2 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   pool members not as expected: %d\n", len( ps.Get_pool_members() ) )
+	}
+
+	if ! ps.Set_mbox_state( "FA:16:3E:00:00:0A", false ) || ps.Set_mbox_state( macs[0], false ) {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   state change not reported once\n" )
+	}
+	if mbl, _ := mp.Get_members(); len( mbl ) != 1 || *mbl[0].Get_id() != "fw2" || len( ps.Get_mbox_pool( 0 ).Get_failed() ) != 1 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   failed member not removed from the pool: %v\n", mp.Get_failed() )
+	}
+	if fl := mp.Get_failed_members(); len( fl ) != 1 || *fl[0].Get_id() != "fw1" {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   failed members not as expected: %d\n", len( fl ) )
+	}
+
+	mp.Set_state( macs[1], false )									// all down: all are used
+	if mbl, _ := mp.Get_members(); len( mbl ) != 2 || len( mp.Get_failed_members() ) != 0 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   pool with all members down did not use them all\n" )
+	}
+
+	lines := []string {
+		`"attached-mac=fa:16:3e:00:00:0a iface-id=x iface-status=active",up,up,5`,
+		`attached-mac=fa:16:3e:00:00:0b,down,up,6`,
+		`"",up,up,1`,
+		`attached-mac=,up,up,7`,									// empty values must not panic
+		`"iface-id=y attached-mac=",up,up,8`,
+	}
+	recs := Mbox_health_parse( "host1", []string { macs[0], macs[1], "fa:16:3e:00:00:0c" }, lines )
+	if len( recs ) != 3 || recs[0] != "host1 fa:16:3e:00:00:0a up" || recs[1] != "host1 fa:16:3e:00:00:0b down" || recs[2] != "host1 fa:16:3e:00:00:0c down" {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   health records not as expected: %v\n", recs )
+	}
+
+	if Mbox_group_id( id, true, 0 ) == Mbox_group_id( id, false, 0 ) || Mbox_group_id( id, true, 0 ) & 0xff000000 != OF_GROUP_STEER {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   pool group ids not distinct\n" )
+	}
+	if Mbox_group_next( OF_GROUP_STEER | OF_GROUP_MASK ) != OF_GROUP_STEER || Mbox_group_next( 0x0e000001 ) != 0x0e000002 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   next pool group id not as expected: 0x%x\n", Mbox_group_next( OF_GROUP_STEER | OF_GROUP_MASK ) )
+	}
+
+	ps.Set_group( 0, true, 0x0e000001 )
+	ps.Set_group( 0, false, 0x0e000002 )
+	if ps.Get_group( 0, true ) != 0x0e000001 || ps.Get_group( 1, true ) != 0 || len( ps.Get_groups() ) != 2 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   pledge groups not as expected: %v\n", ps.Get_groups() )
+	}
+	ps.Set_group( 0, true, 0 )
+	if ps.Get_group( 0, true ) != 0 || len( ps.Get_groups() ) != 1 {
+		failures++
+		fmt.Fprintf( os.Stderr, "FAIL:   pledge group not released: %v\n", ps.Get_groups() )
+	}
+
+	if failures > 0 {
+		t.Fail()
+	} else {
+		fmt.Fprintf( os.Stderr, "OK:     all middlebox pool tests passed\n" )
+	}
+}
@@ -0,0 +1,307 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	qpolicy
+	Abstract:	Queue policy: the mechanism used to enforce reservation bandwidth on a bridge.
+				The mechanisms are:
+					htb   - linux-htb QoS (the default, and all that create_ovs_queues sets)
+					hfsc  - linux-hfsc QoS
+					noop  - linux-noop QoS; queues exist so that set_queue works, but OVS leaves
+							the qdisc alone (shaping, if any, is done by something else e.g. DPDK)
+					meter - openflow meters; one per reservation direction (the id tegu
+							allocates and sends with the queue data) with a drop band at the
+							max rate. The
+							reservation flow-mods reference the meter rather than relying on
+							a queue.
+
+				A policy is a default mechanism and optional per bridge overrides and is written
+				as a string, e.g. "htb br-rl:hfsc br-int:meter". Tegu sends the policy with the
+				queue data and the agent applies it; the translation of a queue's min, max,
+				priority and burst for each mechanism lives here so that both agree.
+
+	Date:		19 Oct 2026
+*/
+
+package gizmos
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	QP_HTB		string = "htb"
+	QP_HFSC		string = "hfsc"
+	QP_NOOP		string = "noop"
+	QP_METER	string = "meter"
+)
+
+const QP_METER_MAX uint32 = 4095			// largest meter id that tegu manages; meters above are left alone
+
+var qp_qos_types = map[string]string {
+	QP_HTB:		"linux-htb",
+	QP_HFSC:	"linux-hfsc",
+	QP_NOOP:	"linux-noop",
+}
+
+type Qpolicy struct {
+	Def			string					// mechanism for bridges not listed
+	Bridges		map[string]string		// mechanism by bridge name
+}
+
+/*
+	Returns true if the mechanism is one we know.
+*/
+func Qp_known( mech string ) ( bool ) {
+	return mech == QP_METER || qp_qos_types[mech] != ""
+}
+
+/*
+	Parse a policy string: space or comma separated tokens each either a mechanism (the
+	default) or bridge:mechanism. An empty string is htb for everything.
+*/
+func Mk_qpolicy( spec string ) ( qp *Qpolicy, err error ) {
+	qp = &Qpolicy{ Def: QP_HTB, Bridges: make( map[string]string ) }
+
+	for _, tok := range strings.Fields( strings.Replace( spec, ",", " ", -1 ) ) {
+		bridge := ""
+		mech := tok
+		if i := strings.LastIndex( tok, ":" ); i >= 0 {
+			bridge = tok[0:i]
+			mech = tok[i+1:]
+		}
+		mech = strings.ToLower( mech )
+
+		if ! Qp_known( mech ) {
+			return nil, fmt.Errorf( "unknown queue policy mechanism: %s", tok )
+		}
+		if bridge == "" {
+			qp.Def = mech
+		} else {
+			qp.Bridges[bridge] = mech
+		}
+	}
+
+	return qp, nil
+}
+
+/*
+	Return the mechanism for the bridge.
+*/
+func ( qp *Qpolicy ) For_bridge( bridge string ) ( string ) {
+	if qp == nil {
+		return QP_HTB
+	}
+	if m, ok := qp.Bridges[bridge]; ok {
+		return m
+	}
+	return qp.Def
+}
+
+/*
+	Return the policy as a string that Mk_qpolicy accepts; bridges are sorted so that the
+	same policy always produces the same string.
+*/
+func ( qp *Qpolicy ) String( ) ( string ) {
+	if qp == nil {
+		return QP_HTB
+	}
+
+	blist := make( []string, 0, len( qp.Bridges ) )
+	for b := range qp.Bridges {
+		blist = append( blist, b )
+	}
+	sort.Strings( blist )
+
+	s := qp.Def
+	for _, b := range blist {
+		s += " " + b + ":" + qp.Bridges[b]
+	}
+	return s
+}
+
+/*
+	Return the distinct mechanisms that the policy uses.
+*/
+func ( qp *Qpolicy ) Mechs( ) ( mlist []string ) {
+	seen := map[string]bool{ qp.For_bridge( "" ): true }
+	mlist = []string{ qp.For_bridge( "" ) }
+	if qp != nil {
+		for _, m := range qp.Bridges {
+			if ! seen[m] {
+				seen[m] = true
+				mlist = append( mlist, m )
+			}
+		}
+	}
+
+	sort.Strings( mlist )
+	return mlist
+}
+
+/*
+	Return a copy of the policy in which mechanisms that are not in the supported list are
+	replaced by htb, along with the list of those replaced. A nil supported list means
+	nothing is known and the policy is returned unchanged.
+*/
+func ( qp *Qpolicy ) Restrict( supported []string ) ( nqp *Qpolicy, dropped []string ) {
+	if qp == nil || supported == nil {
+		return qp, nil
+	}
+
+	ok := map[string]bool{ QP_HTB: true }
+	for _, m := range supported {
+		ok[m] = true
+	}
+
+	fix := func( m string ) ( string ) {
+		if ok[m] {
+			return m
+		}
+		dropped = append( dropped, m )
+		return QP_HTB
+	}
+
+	nqp = &Qpolicy{ Def: fix( qp.Def ), Bridges: make( map[string]string, len( qp.Bridges ) ) }
+	for b, m := range qp.Bridges {
+		nqp.Bridges[b] = fix( m )
+	}
+
+	return nqp, dropped
+}
+
+/*
+	Return the ovsdb QoS type for the mechanism; "" for meters which need no QoS.
+*/
+func Qp_qos_type( mech string ) ( string ) {
+	return qp_qos_types[mech]
+}
+
+/*
+	Translate a queue's settings into the Queue other_config for the mechanism. HTB takes
+	all of them; OVS' HFSC has only the min and max rates; noop ignores everything.
+*/
+func Qp_queue_config( mech string, q *Ovs_queue ) ( oc map[string]string ) {
+	oc = make( map[string]string )
+	if q == nil {
+		return oc
+	}
+
+	switch mech {
+		case QP_NOOP, QP_METER:
+			return oc
+
+		case QP_HFSC:
+			oc["min-rate"] = strconv.FormatInt( q.Min, 10 )
+			oc["max-rate"] = strconv.FormatInt( q.Max, 10 )
+
+		default:
+			oc["min-rate"] = strconv.FormatInt( q.Min, 10 )
+			oc["max-rate"] = strconv.FormatInt( q.Max, 10 )
+			oc["priority"] = strconv.Itoa( q.Pri )
+			if q.Burst > 0 {
+				oc["burst"] = strconv.FormatInt( q.Burst, 10 )
+			}
+	}
+
+	return oc
+}
+
+/*
+	An openflow meter with a single drop band. Rate is kbit/s and burst kbit (0 lets the
+	switch choose).
+*/
+type Of_meter struct {
+	Id		uint32
+	Rate	uint32
+	Burst	uint32
+}
+
+type of_meter_list []*Of_meter
+
+func ( ml of_meter_list ) Len( ) ( int ) { return len( ml ) }
+func ( ml of_meter_list ) Less( i, j int ) ( bool ) { return ml[i].Id < ml[j].Id }
+func ( ml of_meter_list ) Swap( i, j int ) { ml[i], ml[j] = ml[j], ml[i] }
+
+/*
+	Translate a queue into a meter. The meter id is the one tegu allocated to the reservation queue,
+	or the queue number if the queue data did not carry one (queue 0 is best effort and gets
+	no meter). A meter only polices so the queue's max rate is used; the min rate
+	and priority have no equivalent. Rates and burst are converted from bits to kbits.
+*/
+func Qp_meter( qnum int, q *Ovs_queue ) ( *Of_meter ) {
+	if q == nil || qnum <= 0 || q.Max <= 0 {
+		return nil
+	}
+
+	id := qnum
+	if q.Meter > 0 {
+		id = q.Meter
+	}
+	return &Of_meter{ Id: uint32( id ), Rate: uint32( (q.Max + 999) / 1000 ), Burst: uint32( (q.Burst + 999) / 1000 ) }
+}
+
+/*
+	Apply the policy to a per port QoS specification (Ovs_parse_qdata output). Ports on
+	bridges whose mechanism is a QoS type have the type set; ports on bridges that use
+	meters are removed from the specification and their queues returned as meters by
+	bridge. Meters are per bridge; a meter id seen on more than one port of a bridge (queue
+	numbers stand in for ids the queue data did not carry) gets the largest rate.
+*/
+func Qp_apply( qp *Qpolicy, spec map[string]*Ovs_qos, ports map[string]*Ovs_port ) ( meters map[string][]*Of_meter ) {
+	meters = make( map[string][]*Of_meter )
+	by_id := make( map[string]map[uint32]*Of_meter )
+
+	for name, s := range spec {
+		bridge := ""
+		if p := ports[name]; p != nil {
+			bridge = p.Bridge
+		}
+
+		mech := qp.For_bridge( bridge )
+		if mech != QP_METER {
+			s.Type = Qp_qos_type( mech )
+			continue
+		}
+
+		delete( spec, name )
+		if by_id[bridge] == nil {
+			by_id[bridge] = make( map[uint32]*Of_meter )
+		}
+		for qnum, q := range s.Queues {
+			if m := Qp_meter( qnum, q ); m != nil {
+				if cur := by_id[bridge][m.Id]; cur == nil || cur.Rate < m.Rate {
+					by_id[bridge][m.Id] = m
+				}
+			}
+		}
+	}
+
+	for b, ml := range by_id {
+		for _, m := range ml {
+			meters[b] = append( meters[b], m )
+		}
+		sort.Sort( of_meter_list( meters[b] ) )
+	}
+
+	return meters
+}
@@ -0,0 +1,141 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	qpolicy_test
+	Abstract:	Tests for queue policy parsing and the translation of queues into QoS
+				settings and meters.
+	Date:		19 Oct 2026
+*/
+
+package gizmos
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_qpolicy_parse( t *testing.T ) {
+	qp, err := Mk_qpolicy( "hfsc br-int:meter, br-rl:HTB" )
+	if err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: policy not parsed: %s\n", err )
+		t.Fail()
+		return
+	}
+
+	if qp.For_bridge( "br-int" ) != QP_METER || qp.For_bridge( "br-rl" ) != QP_HTB || qp.For_bridge( "br-ex" ) != QP_HFSC {
+		fmt.Fprintf( os.Stderr, "FAIL: policy mechanisms not as expected: %s\n", qp )
+		t.Fail()
+	}
+	if s := qp.String(); s != "hfsc br-int:meter br-rl:htb" {
+		fmt.Fprintf( os.Stderr, "FAIL: policy string not as expected: %s\n", s )
+		t.Fail()
+	}
+
+	nqp, dropped := qp.Restrict( []string{ "htb", "hfsc" } )
+	if nqp.For_bridge( "br-int" ) != QP_HTB || len( dropped ) != 1 || qp.For_bridge( "br-int" ) != QP_METER {
+		fmt.Fprintf( os.Stderr, "FAIL: restricted policy not as expected: %s dropped=%v\n", nqp, dropped )
+		t.Fail()
+	}
+
+	if _, err = Mk_qpolicy( "br-int:cbq" ); err == nil {
+		fmt.Fprintf( os.Stderr, "FAIL: unknown mechanism accepted\n" )
+		t.Fail()
+	}
+}
+
+func Test_qpolicy_apply( t *testing.T ) {
+	qp, _ := Mk_qpolicy( "hfsc br-int:meter" )
+	q := &Ovs_queue{ Min: 1000000, Max: 2000000, Pri: 200, Burst: 500000 }
+
+	if oc := Qp_queue_config( QP_HFSC, q ); oc["priority"] != "" || oc["burst"] != "" || oc["max-rate"] != "2000000" {
+		fmt.Fprintf( os.Stderr, "FAIL: hfsc queue config not as expected: %v\n", oc )
+		t.Fail()
+	}
+	if oc := Qp_queue_config( QP_HTB, q ); oc["priority"] != "200" || oc["burst"] != "500000" {
+		fmt.Fprintf( os.Stderr, "FAIL: htb queue config not as expected: %v\n", oc )
+		t.Fail()
+	}
+
+	spec := map[string]*Ovs_qos {
+		"qvo1": &Ovs_qos{ Queues: map[int]*Ovs_queue{ 0: q, 2: q, 3: &Ovs_queue{ Max: 5000 } } },
+		"qvo2": &Ovs_qos{ Queues: map[int]*Ovs_queue{ 2: &Ovs_queue{ Max: 9000000 } } },
+		"eth1": &Ovs_qos{ Queues: map[int]*Ovs_queue{ 2: q } },
+	}
+	ports := map[string]*Ovs_port {
+		"qvo1": &Ovs_port{ Name: "qvo1", Bridge: "br-int" },
+		"qvo2": &Ovs_port{ Name: "qvo2", Bridge: "br-int" },
+		"eth1": &Ovs_port{ Name: "eth1", Bridge: "br-eth1" },
+	}
+
+	meters := Qp_apply( qp, spec, ports )
+	if len( spec ) != 1 || spec["eth1"] == nil || spec["eth1"].Type != "linux-hfsc" {
+		fmt.Fprintf( os.Stderr, "FAIL: qos spec not as expected after apply: %d entries\n", len( spec ) )
+		t.Fail()
+	}
+
+	ml := meters["br-int"]
+	if len( ml ) != 2 || ml[0].Id != 2 || ml[0].Rate != 9000 || ml[1].Id != 3 || ml[1].Rate != 5 {
+		fmt.Fprintf( os.Stderr, "FAIL: meters not as expected: %d\n", len( ml ) )
+		t.Fail()
+		return
+	}
+
+	if b := ml[0].Encode( 1, OFPMC_ADD ); len( b ) != 32 {
+		fmt.Fprintf( os.Stderr, "FAIL: meter-mod length not as expected: %d\n", len( b ) )
+		t.Fail()
+	}
+
+	// two reservations that have the same queue number on different ports get their own meters
+	qports := map[string]*Ovs_port {
+		"qvo1": &Ovs_port{ Name: "qvo1", Bridge: "br-int", Ofports: []int{ 5 } },
+		"qvo2": &Ovs_port{ Name: "qvo2", Bridge: "br-int", Ofports: []int{ 6 } },
+	}
+	qdata := []string{ "host1/5,res1,2,1000000,1000000,200,,7", "host1/6,res2,2,4000000,4000000,200,,9" }
+	spec, errs := Ovs_parse_qdata( qdata, "host1", qports, nil, 0 )
+	if len( errs ) != 0 {
+		fmt.Fprintf( os.Stderr, "FAIL: unexpected parse errors: %v\n", errs )
+		t.Fail()
+	}
+	ml = Qp_apply( qp, spec, qports )["br-int"]
+	if len( ml ) != 2 || ml[0].Id != 7 || ml[0].Rate != 1000 || ml[1].Id != 9 || ml[1].Rate != 4000 {
+		fmt.Fprintf( os.Stderr, "FAIL: per reservation meters not as expected: %d\n", len( ml ) )
+		t.Fail()
+	}
+}
+
+func Test_qpolicy_meter_flow( t *testing.T ) {
+	flows, _ := Of_bw_flows( map[string]string{ "smac": "fa:16:3e:00:00:01", "dmac": "fa:16:3e:00:00:02", "timeout": "60", "meter": "4" } )
+	if len( flows ) != 2 {
+		fmt.Fprintf( os.Stderr, "FAIL: expected two bw flows, got %d\n", len( flows ) )
+		t.Fail()
+		return
+	}
+
+	if s := flows[1].String(); ! strings.Contains( s, "meter:4" ) {
+		fmt.Fprintf( os.Stderr, "FAIL: outbound flow does not reference the meter: %s\n", s )
+		t.Fail()
+	}
+	if s := flows[0].String(); strings.Contains( s, "meter:" ) {
+		fmt.Fprintf( os.Stderr, "FAIL: inbound flow references a meter: %s\n", s )
+		t.Fail()
+	}
+}
@@ -22,7 +22,11 @@
 
 	Mnemonic:	queue
 	Abstract:	Represents a queue, mapping it to a source host and
-				a specific bandwidth maximum.
+				a specific bandwidth maximum. The bandwidth is the guaranteed (min)
+				rate; headroom is the amount above that the queue may borrow when
+				capacity is idle (the max rate is bandwidth+headroom) and burst is the
+				burst size (bits) given to the switch. Only bandwidth counts against
+				link capacity.
 
 	Date:		06 February 2014
 	Author:		E. Scott Daniels
@@ -30,6 +34,7 @@
 	Mods:		07 Jul 2014 - Added To_str_pos() function to generate strings
 					only if the bandwidth for the queue is greater than zero.
 				18 Jun 2015 - Ensure bandwidth amount doesn't go negative.
+				19 Oct 2026 - Added headroom (ceiling above the guaranteed rate) and burst.
 */
 
 package gizmos
@@ -52,6 +57,8 @@ import (
 type Queue struct {
 	Id			*string			// the id of the queue; likely a host/VM name, mac, or ip or vm1-vm2 pair
 	bandwidth	int64			// bandwidth associated with the queue
+	headroom	int64			// amount above bandwidth that the queue may use (max == bandwidth + headroom)
+	burst		int64			// burst size (bits); 0 leaves it to the switch
 	pri			int				// priority given to ovs when setting queues	
 	qnum		int				// the queue number (we cannot depend on ordering)
 	exref		*string			// switch/port (other info?) that queue setting function will need
@@ -81,6 +88,8 @@ func (q *Queue) Clone( ) ( cq *Queue ) {
 
 	cq = &Queue {
 		bandwidth: q.bandwidth,
+		headroom: q.headroom,
+		burst:	q.burst,
 		Id:	&cid,
 		qnum: q.qnum,
 		pri:	q.pri,
@@ -133,6 +142,28 @@ func (q *Queue) Set_bandwidth(  b int64 ) {
 	}
 }
 
+/*
+	Increase (or decrease if negative) the amount above the guaranteed bandwidth that the
+	queue may use.
+*/
+func (q *Queue) Inc_headroom( amt int64 ) {
+	if q != nil {
+		q.headroom += amt
+		if q.headroom < 0 {
+			q.headroom = 0
+		}
+	}
+}
+
+/*
+	Set the burst size (bits) for the queue.
+*/
+func (q *Queue) Set_burst( b int64 ) {
+	if q != nil && b >= 0 {
+		q.burst = b
+	}
+}
+
 /*
 	Adjust the priority of the queue to  the value passed in.
 	Priority values should be between 1 and 1024 with the larger
@@ -172,9 +203,9 @@ func (q *Queue) Get_eref( ) ( *string ) {
 
 /*
 	Genrate a string that can be given on a queue setting command line.
-	Format is:  <external-reference>,<id>,<queuenumber>,<bandwidth-min>,<bandwidth-max>,<priority>
-	For the moment, both min/max bandwidth are the same, but we'll allow for them to be different
-	in future.
+	Format is:  <external-reference>,<id>,<queuenumber>,<bandwidth-min>,<bandwidth-max>,<priority>[,<burst>]
+	The min is the guaranteed bandwidth and max is the ceiling (the same as min unless the queue was
+	given headroom). Burst is added only when set.
 */
 func ( q *Queue ) To_str( ) ( string ) {
 
@@ -182,7 +213,10 @@ func ( q *Queue ) To_str( ) ( string ) {
 		return ""
 	}
 
-	st := fmt.Sprintf( "%s,%s,%d,%d,%d,%d", *q.exref, *q.Id, q.qnum, q.bandwidth, q.bandwidth, q.pri );
+	st := fmt.Sprintf( "%s,%s,%d,%d,%d,%d", *q.exref, *q.Id, q.qnum, q.bandwidth, q.bandwidth + q.headroom, q.pri );
+	if q.burst > 0 {
+		st += fmt.Sprintf( ",%d", q.burst )
+	}
 	return st
 }
 
@@ -195,20 +229,19 @@ func ( q *Queue ) To_str_pos( ) ( string ) {
 		return ""
 	}
 
-	st := fmt.Sprintf( "%s,%s,%d,%d,%d,%d", *q.exref, *q.Id, q.qnum, q.bandwidth, q.bandwidth, q.pri );
-	return st
+	return q.To_str( )
 }
 
 /*
 	Returns a json string that represents this queue. The information includes num, priority,
-	bandwidh, id and external reference string.
+	bandwidh, ceiling, burst, id and external reference string.
 */
 func (q *Queue) To_json( ) ( string ) {
 	if q == nil {
 		return ""
 	}
 
-	st := fmt.Sprintf( `{ "num": %d, "pri": %d, "bandw": %d, "id": %q, "eref": %q }`, q.qnum, q.pri, q.bandwidth, *q.Id, *q.exref )
+	st := fmt.Sprintf( `{ "num": %d, "pri": %d, "bandw": %d, "ceiling": %d, "burst": %d, "id": %q, "eref": %q }`, q.qnum, q.pri, q.bandwidth, q.bandwidth + q.headroom, q.burst, *q.Id, *q.exref )
 
 	return st
 }
@@ -43,12 +43,18 @@
 					oneway bandwidth reserations with a function that checks outbound capacity
 					on all switch links.
 				10 Sep 2015 - Allow finding attached 'hosts' based on uuid.
+				19 Oct 2026 - Administratively excluded links are not followed. Added Cpath_to to
+					find the lowest cost path which satisfies path constraints.
+				19 Oct 2026 - Added site and attributes (rich topology). Fixed json when a switch has no links.
+				19 Oct 2026 - Added Get_hosts.
 */
 
 package gizmos
 
 import (
+	"container/heap"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/att/tegu"
@@ -65,6 +71,8 @@ type Switch struct {
 	hosts		map[string] bool	// hosts that are attched to this switch
 	hvmid		map[string]*string	// vmids of attached hosts
 	hport		map[string] int		// the port that the host (string) attaches to
+	site		string				// site/location from the topology file
+	attrs		map[string]string	// free form attributes from the topology file
 
 									// these are for path finding and are needed externally
 	Prev		*Switch				// previous low cost switch
@@ -166,6 +174,24 @@ func (s *Switch) Has_host( host *string ) (bool) {
 	return s.hosts[*host]
 }
 
+/*
+	Returns the names of the hosts attached to the switch, sorted.
+*/
+func (s *Switch) Get_hosts( ) ( hosts []string ) {
+	if s == nil {
+		return nil
+	}
+
+	hosts = make( []string, 0, len( s.hosts ) )
+	for h, attached := range s.hosts {
+		if attached {
+			hosts = append( hosts, h )
+		}
+	}
+	sort.Strings( hosts )
+	return
+}
+
 /*
 	Return the ID that has been associated with this switch. Likely this is the DPID.
 */
@@ -177,6 +203,36 @@ func (s *Switch) Get_id( ) ( *string ) {
 	return s.id
 }
 
+/*
+	Set the site and attributes that were described for the switch in the topology file.
+*/
+func (s *Switch) Set_meta( site string, attrs map[string]string ) {
+	if s != nil {
+		s.site = site
+		s.attrs = attrs
+	}
+}
+
+/*
+	Returns the switch's site; empty if not known.
+*/
+func (s *Switch) Get_site( ) ( string ) {
+	if s == nil {
+		return ""
+	}
+	return s.site
+}
+
+/*
+	Returns the value of the named attribute; empty if not set.
+*/
+func (s *Switch) Get_attr( name string ) ( string ) {
+	if s == nil || s.attrs == nil {
+		return ""
+	}
+	return s.attrs[name]
+}
+
 /*
 	Return the ith link in our index or nil if i is out of range.
 	Allows the user programme to loop through the list if needed. Yes,
@@ -228,6 +284,10 @@ func (s *Switch) probe_neighbours( target *string, commence, conclude, inc_cap i
 
 	//fmt.Printf( "\n\nsearching neighbours of (%s) for %s\n", s.To_str(), *target )
 	for i := 0; i < s.lidx; i++ {
+		if s.links[i].Is_admin_excluded() {
+			continue
+		}
+
 		if s != fsw  {
   			has_room, err := s.links[i].Has_capacity( commence, conclude, inc_cap, usr, usr_max )
 			if has_room {
@@ -320,6 +380,10 @@ func (s *Switch) Path_to( target *string, commence, conclude, inc_cap int64, usr
 		
 		if sw.Flags & tegu.SWFL_VISITED == 0 {				// possible that it was pushed multiple times and already had it's neighbours queued
 			for i := 0; i < sw.lidx; i++ {
+				if sw.links[i].Is_admin_excluded() {
+					continue
+				}
+
 				has_room, err := sw.links[i].Has_capacity( commence, conclude, inc_cap, usr, usr_max )
 				if has_room {
 					if sw.links[i].forward.Flags & tegu.SWFL_VISITED == 0 {
@@ -346,6 +410,202 @@ func (s *Switch) Path_to( target *string, commence, conclude, inc_cap int64, usr
 	return
 }
 
+// -------------------- constrained path -----------------------------------------------
+
+const max_cp_labels int = 64		// max non-dominated labels kept for any one switch
+
+/*
+	A label is a partial path from the source to a switch along with the accumulated
+	cost, latency and hop count.  Labels reference the label they were extended from
+	so that the path can be recovered.
+*/
+type cp_label struct {
+	sw		*Switch
+	cost	int
+	lat		int64
+	hops	int
+	prev	*cp_label
+	plink	int					// index of the link on prev.sw used to reach sw
+	dead	bool				// dominated after it was queued
+}
+
+/*
+	Priority queue of labels ordered by cost (container/heap interface).
+*/
+type cp_queue []*cp_label
+
+func (q cp_queue) Len( ) int { return len( q ) }
+func (q cp_queue) Less( i, j int ) bool { return q[i].cost < q[j].cost }
+func (q cp_queue) Swap( i, j int ) { q[i], q[j] = q[j], q[i] }
+func (q *cp_queue) Push( x interface{} ) { *q = append( *q, x.( *cp_label ) ) }
+func (q *cp_queue) Pop( ) interface{} {
+	old := *q
+	n := len( old )
+	x := old[n-1]
+	*q = old[:n-1]
+	return x
+}
+
+/*
+	Returns true if the label passes through the switch.
+*/
+func (l *cp_label) has_switch( sw *Switch ) ( bool ) {
+	for ; l != nil; l = l.prev {
+		if l.sw == sw {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+	Returns true if the label a is no better than b in every respect.
+*/
+func (a *cp_label) dominated_by( b *cp_label ) ( bool ) {
+	return b.cost <= a.cost && b.lat <= a.lat && b.hops <= a.hops
+}
+
+/*
+	Finds the lowest cost path from the switch to the target (host or switch id) which
+	satisfies the constraints in pc.  Because a lower cost partial path might violate a
+	hop or latency limit that a higher cost partial path would not, each switch keeps a
+	set of labels (partial paths) which are not dominated by another label; a label is
+	dominated when another is not worse in cost, latency and hops.  Labels are expanded
+	in order of cost so the first label to reach the target is the lowest cost path that
+	satisfies the constraints.
+
+	On success the Prev, Plink and Cost fields of the switches on the path are set in the
+	same manner as Path_to, so the path can be collected by walking backwards from the
+	switch returned. When no path is found, err describes why links were not followed
+	(constraints, exclusion, capacity) and cap_trip is set if capacity was a reason.
+*/
+func (s *Switch) Cpath_to( target *string, commence, conclude, inc_cap int64, usr *string, usr_max int64, pc *Path_constraints ) ( found *Switch, cap_trip bool, err error ) {
+	var (
+		n_excl	int			// counts of links not followed for each reason
+		n_srlg	int
+		n_avoid	int
+		n_hops	int
+		n_lat	int
+		n_cap	int
+		n_limit	int
+	)
+
+	if s == nil {
+		return nil, false, fmt.Errorf( "no source switch" )
+	}
+	if pc == nil {
+		pc = &Path_constraints{ }
+	}
+
+	obj_sheep.Baa( 2, "switch:Cpath_to: looking for path to %s constraints: %s", *target, pc )
+	labels := make( map[*Switch][]*cp_label )
+	q := &cp_queue{ }
+	heap.Push( q, &cp_label{ sw: s, plink: -1 } )
+
+	for q.Len() > 0 {
+		lbl := heap.Pop( q ).( *cp_label )
+		if lbl.dead {
+			continue
+		}
+
+		sw := lbl.sw
+		if lbl.prev != nil && (sw.Has_host( target ) || *sw.id == *target) {
+			for l := lbl; l != nil; l = l.prev {			// set the switch fields so the caller can walk the path
+				l.sw.Cost = l.cost
+				l.sw.Plink = l.plink
+				if l.prev != nil {
+					l.sw.Prev = l.prev.sw
+				} else {
+					l.sw.Prev = nil
+				}
+			}
+
+			obj_sheep.Baa( 2, "switch:Cpath_to: found target on %s cost=%d latency=%dus hops=%d", sw, lbl.cost, lbl.lat, lbl.hops )
+			return sw, n_cap > 0, nil
+		}
+
+		for i := 0; i < sw.lidx; i++ {
+			lnk := sw.links[i]
+			fsw := lnk.forward
+			if fsw == nil || lbl.has_switch( fsw ) {
+				continue
+			}
+
+			if lnk.Is_admin_excluded() {
+				n_excl++
+				continue
+			}
+			if pc.Avoids_link( lnk ) != "" {
+				n_srlg++
+				continue
+			}
+			if pc.Avoids_switch( fsw ) {
+				n_avoid++
+				continue
+			}
+
+			nl := &cp_label{ sw: fsw, cost: lbl.cost + lnk.Cost, lat: lbl.lat + lnk.latency, hops: lbl.hops + 1, prev: lbl, plink: i }
+			if pc.Max_hops > 0 && nl.hops > pc.Max_hops {
+				n_hops++
+				continue
+			}
+			if pc.Max_latency > 0 && nl.lat > pc.Max_latency {
+				n_lat++
+				continue
+			}
+
+			if has_room, cerr := lnk.Has_capacity( commence, conclude, inc_cap, usr, usr_max ); ! has_room {
+				obj_sheep.Baa( 2, "switch:Cpath_to: no capacity on link: %s", cerr )
+				n_cap++
+				continue
+			}
+
+			keep := true
+			live := labels[fsw][:0]
+			for _, el := range labels[fsw] {
+				if nl.dominated_by( el ) {
+					keep = false
+				}
+				if keep && el.dominated_by( nl ) {
+					el.dead = true
+				} else {
+					live = append( live, el )
+				}
+			}
+			labels[fsw] = live
+
+			if keep {
+				if len( live ) >= max_cp_labels {
+					n_limit++
+					continue
+				}
+				labels[fsw] = append( labels[fsw], nl )
+				heap.Push( q, nl )
+			}
+		}
+	}
+
+	reasons := make( []string, 0, 7 )
+	for _, r := range []struct { n int; what string } {
+		{ n_excl, "administratively excluded" },
+		{ n_srlg, "in an avoided srlg" },
+		{ n_avoid, "to an avoided switch" },
+		{ n_hops, "beyond max hops" },
+		{ n_lat, "beyond max latency" },
+		{ n_cap, "without capacity" },
+		{ n_limit, "dropped at the search limit" },
+	} {
+		if r.n > 0 {
+			reasons = append( reasons, fmt.Sprintf( "%d link(s) %s", r.n, r.what ) )
+		}
+	}
+
+	if len( reasons ) == 0 {
+		return nil, false, fmt.Errorf( "no path to %s", *target )
+	}
+	return nil, n_cap > 0, fmt.Errorf( "no path to %s satisfies the constraints: %s", *target, strings.Join( reasons, ", " ) )
+}
+
 // -------------------- find all paths ------------------------------------------------
 
 /*
@@ -377,6 +637,10 @@ func (s *Switch) ap_search_neighbours( target *string, clinks []*Link, clidx int
 		obj_sheep.Baa( 3, "search_neighbours: testing switch: %s  has %d links", *s.id, s.lidx )
 
 		for i := 0; i < s.lidx; i++ {				// for each link to a neighbour
+			if s.links[i].Is_admin_excluded() {
+				continue
+			}
+
 			sn := s.links[i].Get_forward_sw()
 			if (sn.Flags & tegu.SWFL_VISITED) == 0  {
 				obj_sheep.Baa( 3, "search_neighbours: advancing over link %d switch: %s", i, *sn.id )
@@ -521,7 +785,20 @@ func (s *Switch) To_json( ) ( jstr string ) {
 		}
 		jstr += " ]"
 	} else {
-		jstr = fmt.Sprintf( `{ "id": %q }`, *s.id )
+		jstr = fmt.Sprintf( `{ "id": %q`, *s.id )
+	}
+
+	if s.site != "" {
+		jstr += fmt.Sprintf( `, "site": %q`, s.site )
+	}
+	if len( s.attrs ) > 0 {
+		jstr += `, "attrs": { `
+		sep = ""
+		for k, v := range s.attrs {
+			jstr += fmt.Sprintf( `%s%q: %q`, sep, k, v )
+			sep = ", "
+		}
+		jstr += " }"
 	}
 
 
@@ -47,6 +47,7 @@
 					greater than zero.
 				18 Jun 2015 - Allow a queue to be added only if the amount is positive.
 				22 Jun 2015 - Added check for nil qid pointer on add.
+				19 Oct 2026 - Added Set_queue_limits (queue headroom and burst).
 */
 
 package gizmos
@@ -283,6 +284,22 @@ func (ts *Time_slice) Add_queue( qnum int, id *string, swdata *string, amt int64
 	}
 }
 
+/*
+	Adjust the headroom (amount above the guaranteed bandwidth) of the queue by delta and, if
+	burst is not negative, set its burst. The slice's amount is not changed; headroom is not
+	reserved capacity. No action if the queue is not known.
+*/
+func (ts *Time_slice) Set_queue_limits( id *string, delta int64, burst int64 ) {
+	if ts == nil || id == nil {
+		return
+	}
+
+	if q := ts.queues[*id]; q != nil {
+		q.Inc_headroom( delta )
+		q.Set_burst( burst )
+	}
+}
+
 /*
 	Increases the amount consumed by the user during this timeslice. The usr in this
 	case is a fence containing default values should we need to create a new fence for
@@ -0,0 +1,294 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	topo
+	Abstract:	Support for the rich static topology file. The legacy static graph is a list of
+				floodlight style links which carry only switch names and ports; every link gets
+				the capacity from the configuration. The rich file is a json object which
+				describes the switches (with site and free form attributes), each link's
+				capacity, headroom, mlag membership, latency, cost, shared risk groups and
+				exclusion state, and the switch/port that static hosts are attached to:
+
+				{
+					"version": 1,
+					"switches": [ { "id": "sw1", "site": "dc-east", "attrs": { "rack": "r12" } }, ... ],
+					"links": [ { "src": "sw1", "src_port": 1, "dst": "sw2", "dst_port": 4,
+						"capacity": 40000000000, "headroom": 5, "mlag": "m1", "latency": 120,
+						"cost": 1, "srlg": [ "conduit-a" ], "excluded": false, "oneway": false }, ... ],
+					"hosts": [ { "mac": "fa:16:3e:00:00:01", "ip4": "10.0.0.5", "switch": "sw1", "port": 9 }, ... ]
+				}
+
+				The file is validated before it is used; unknown fields, references to switches
+				that are not described, duplicate links and out of range values are errors.
+				Links and hosts are converted to the floodlight structs so that the network
+				graph is built by the same code regardless of the source.
+
+	Date:		19 Oct 2026
+*/
+
+package gizmos
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+const (
+	TOPO_VERSION	int = 1			// current (only) version of the topology file
+	LATE_BIND_PORT	int = -128		// port value that indicates the port is bound late (tegu-lite)
+)
+
+type Topo_switch struct {
+	Id		string				`json:"id"`
+	Site	string				`json:"site"`
+	Attrs	map[string]string	`json:"attrs"`
+}
+
+type Topo_link struct {
+	Src			string		`json:"src"`
+	Src_port	int			`json:"src_port"`
+	Dst			string		`json:"dst"`
+	Dst_port	int			`json:"dst_port"`
+	Capacity	int64		`json:"capacity"`		// bits/sec; 0 == configured link_max_cap
+	Headroom	*int		`json:"headroom"`		// percentage; nil == configured link_headroom
+	Mlag		string		`json:"mlag"`
+	Latency		int64		`json:"latency"`		// microseconds
+	Cost		int			`json:"cost"`
+	Srlg		[]string	`json:"srlg"`
+	Excluded	bool		`json:"excluded"`
+	Oneway		bool		`json:"oneway"`		// only src->dst; links are bidirectional by default
+}
+
+type Topo_host struct {
+	Mac		string		`json:"mac"`
+	Ip4		string		`json:"ip4"`
+	Ip6		string		`json:"ip6"`
+	Switch	string		`json:"switch"`
+	Port	int			`json:"port"`
+}
+
+type Topology struct {
+	Version		int				`json:"version"`
+	Switches	[]Topo_switch	`json:"switches"`
+	Links		[]Topo_link		`json:"links"`
+	Hosts		[]Topo_host		`json:"hosts"`
+}
+
+/*
+	Returns true if the file appears to be a rich topology file (a json object) rather than
+	the legacy list of links (a json array).
+*/
+func Is_topology( fname string ) ( bool ) {
+	f, err := os.Open( fname )
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	br := bufio.NewReader( f )
+	for {
+		r, _, err := br.ReadRune()
+		if err != nil {
+			return false
+		}
+		if ! strings.ContainsRune( " \t\r\n", r ) {
+			return r == '{'
+		}
+	}
+}
+
+/*
+	Reads and validates the topology file.  The topology is returned only if it is valid.
+*/
+func Read_topology( fname string ) ( t *Topology, err error ) {
+	f, err := os.Open( fname )
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	t = &Topology{ }
+	jdecoder := json.NewDecoder( f )
+	jdecoder.DisallowUnknownFields()
+	if err = jdecoder.Decode( t ); err != nil {
+		return nil, fmt.Errorf( "topology %s: %s", fname, err )
+	}
+
+	if err = t.Validate(); err != nil {
+		return nil, fmt.Errorf( "topology %s: %s", fname, err )
+	}
+
+	return t, nil
+}
+
+/*
+	Returns true if the port is acceptable: non-negative or the late binding value.
+*/
+func topo_port_ok( p int ) ( bool ) {
+	return p >= 0 || p == LATE_BIND_PORT
+}
+
+/*
+	Checks the topology and returns an error which lists all of the problems found, or nil.
+*/
+func (t *Topology) Validate( ) ( error ) {
+	if t == nil {
+		return fmt.Errorf( "no topology" )
+	}
+
+	probs := make( []string, 0 )
+	if t.Version != TOPO_VERSION {
+		probs = append( probs, fmt.Sprintf( "version %d is not supported (expected %d)", t.Version, TOPO_VERSION ) )
+	}
+
+	sw := make( map[string]bool, len( t.Switches ) )
+	for i, s := range t.Switches {
+		switch {
+			case s.Id == "":
+				probs = append( probs, fmt.Sprintf( "switch[%d]: missing id", i ) )
+			case strings.ContainsAny( s.Id, " -" ):
+				probs = append( probs, fmt.Sprintf( "switch[%d]: id may not contain blanks or dashes: %s", i, s.Id ) )
+			case sw[s.Id]:
+				probs = append( probs, fmt.Sprintf( "switch[%d]: duplicate id: %s", i, s.Id ) )
+		}
+		sw[s.Id] = true
+	}
+
+	seen := make( map[string]bool, len( t.Links ) * 2 )
+	for i, l := range t.Links {
+		lid := fmt.Sprintf( "link[%d] %s-%s", i, l.Src, l.Dst )
+		if ! sw[l.Src] || ! sw[l.Dst] {
+			probs = append( probs, fmt.Sprintf( "%s: references an undescribed switch", lid ) )
+		}
+		if l.Src == l.Dst {
+			probs = append( probs, fmt.Sprintf( "%s: source and destination are the same switch", lid ) )
+		}
+		if ! topo_port_ok( l.Src_port ) || ! topo_port_ok( l.Dst_port ) {
+			probs = append( probs, fmt.Sprintf( "%s: invalid port (%d/%d)", lid, l.Src_port, l.Dst_port ) )
+		}
+		if l.Capacity < 0 {
+			probs = append( probs, fmt.Sprintf( "%s: capacity may not be negative", lid ) )
+		}
+		if l.Headroom != nil && (*l.Headroom < 0 || *l.Headroom > 99) {
+			probs = append( probs, fmt.Sprintf( "%s: headroom must be 0-99: %d", lid, *l.Headroom ) )
+		}
+		if l.Latency < 0 || l.Cost < 0 {
+			probs = append( probs, fmt.Sprintf( "%s: latency and cost may not be negative", lid ) )
+		}
+
+		dirs := []string{ l.Src + "-" + l.Dst }
+		if ! l.Oneway {
+			dirs = append( dirs, l.Dst + "-" + l.Src )
+		}
+		for _, d := range dirs {
+			if seen[d] {
+				probs = append( probs, fmt.Sprintf( "%s: duplicates the link %s", lid, d ) )
+				break
+			}
+		}
+		for _, d := range dirs {
+			seen[d] = true
+		}
+	}
+
+	for i, h := range t.Hosts {
+		if _, err := net.ParseMAC( h.Mac ); err != nil {
+			probs = append( probs, fmt.Sprintf( "host[%d]: invalid mac: %q", i, h.Mac ) )
+		}
+		if h.Ip4 != "" {
+			if ip := net.ParseIP( h.Ip4 ); ip == nil || ip.To4() == nil {
+				probs = append( probs, fmt.Sprintf( "host[%d]: invalid ip4: %s", i, h.Ip4 ) )
+			}
+		}
+		if h.Ip6 != "" {
+			if ip := net.ParseIP( h.Ip6 ); ip == nil || ip.To4() != nil {
+				probs = append( probs, fmt.Sprintf( "host[%d]: invalid ip6: %s", i, h.Ip6 ) )
+			}
+		}
+		if ! sw[h.Switch] {
+			probs = append( probs, fmt.Sprintf( "host[%d]: attached to an undescribed switch: %q", i, h.Switch ) )
+		}
+		if ! topo_port_ok( h.Port ) {
+			probs = append( probs, fmt.Sprintf( "host[%d]: invalid port: %d", i, h.Port ) )
+		}
+	}
+
+	if len( probs ) > 0 {
+		return fmt.Errorf( "%d problem(s): %s", len( probs ), strings.Join( probs, "; " ) )
+	}
+	return nil
+}
+
+/*
+	Returns the links as floodlight link structs with the topology extensions filled in.
+*/
+func (t *Topology) Fl_links( ) ( links []FL_link_json ) {
+	if t == nil {
+		return nil
+	}
+
+	links = make( []FL_link_json, len( t.Links ) )
+	for i, l := range t.Links {
+		links[i] = FL_link_json {
+			Src_switch:	l.Src,
+			Src_port:	l.Src_port,
+			Dst_switch:	l.Dst,
+			Dst_port:	l.Dst_port,
+			Type:		"internal",
+			Direction:	"bidirectional",
+			Capacity:	l.Capacity,
+			Headroom:	l.Headroom,
+			Latency:	l.Latency,
+			Cost:		l.Cost,
+			Srlg:		l.Srlg,
+			Excluded:	l.Excluded,
+		}
+
+		if l.Oneway {
+			links[i].Direction = "unidirectional"
+		}
+		if l.Mlag != "" {
+			mlag := l.Mlag
+			links[i].Mlag = &mlag
+		}
+	}
+
+	return
+}
+
+/*
+	Returns the statically attached hosts as floodlight host structs.
+*/
+func (t *Topology) Fl_hosts( ) ( hosts []FL_host_json ) {
+	if t == nil {
+		return nil
+	}
+
+	hosts = make( []FL_host_json, len( t.Hosts ) )
+	for i, h := range t.Hosts {
+		hosts[i] = FL_mk_host( h.Ip4, h.Ip6, strings.ToLower( h.Mac ), h.Switch, h.Port )
+	}
+
+	return
+}
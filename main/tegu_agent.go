@@ -25,6 +25,13 @@
 
 				Command line flags:
 					-h host:port -- tegu host an port (default localhost:29055)
+					-iq          -- set queues on intermediate bridges
+					-ovsdb target-- manage queues via ovsdb (unix:path or tcp:%s:6640; %s is the host)
+					-outward list-- ports that get queues for -128 queue data (qosirl*)
+					-of target   -- push reservation flow-mods via openflow (unix:path or tcp:%s:port; %b is the bridge)
+					-ofverify    -- dump flows after a native install to verify them
+					-ledger file -- file where the expiry of flow-mods installed without a hard timeout is kept
+					-sweep sec   -- how often expired flow-mods (tegu didn't delete) are removed (default 0, off)
 					-i id	     -- ID number for this agent
 					-k key	     -- ssh key file for the ssh broker
 					-l directory -- logfile directory
@@ -62,6 +69,30 @@
 				12 Nov 2015 : Updated to return stdout/stderr for do_mirrorwiz()
 				26 Jan 2016 : Added support for passthrough reservations (bandwidth)
 				10 Mar 2017	: Prevent map_mac2phost from running if a setup intermed is in progress.
+				18 Oct 2026 : Added TLS connection to tegu (-cert, -key, -ca, -sn) and registration
+					(agent name, version, capabilities and host list) after connecting.
+				18 Oct 2026 : Flow-mod responses report failure when the command could not be submitted
+					or timed out so that tegu can retry.
+				18 Oct 2026 : Queues can be managed directly through ovsdb (-ovsdb) rather than by scripts.
+				18 Oct 2026 : Reservation flow-mods (bw, bwow, passthru) can be pushed via openflow (-of)
+					as a bundle rather than by scripts.
+				18 Oct 2026 : Added dump_state, del_fmods and purge_queues actions used by tegu to reconcile
+					installed flows and queues with the reservations it holds.
+				19 Oct 2026 : Native flow-mods are verified by their actions as well as priority and macs.
+				19 Oct 2026 : Flow-mods installed without a hard timeout are recorded in an expiry ledger
+					(-ledger) and a sweeper (-sweep) removes them if tegu fails to delete them.
+				19 Oct 2026 : Flows are recorded in the expiry ledger only when they were installed.
+				19 Oct 2026 : Added del_res_fmods action which removes only the flows of one expired reservation
+					(strict deletes built from its parms); the sweeper does the same and is off by default.
+				19 Oct 2026 : Added qpolicy_caps action; setqueues applies the queue policy (qos type per bridge, or
+					openflow meters) sent by tegu.
+				19 Oct 2026 : Bandwidth reservations split across paths install a select group (-of) ahead of
+					their flow-mods; the group is removed with the flows.
+				19 Oct 2026 : Split bandwidth requests fail when the group cannot be installed, and bucket ports
+					are checked against br-int; qpolicy_caps reports split where groups can be installed.
+				19 Oct 2026 : Added lldp_neighbours action (lldpctl and interface speeds on each host) for
+					topology discovery.
+				19 Oct 2026 : Added mbox_health action (state of the ovs interfaces of steering middleboxes).
 
 	NOTE:		There are three types of generic error/warning messages which have
 				the same message IDs (007, 008, 009) and thus are generated through
@@ -72,11 +103,16 @@ package main
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"math/rand"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/att/gopkgs/bleater"
@@ -84,6 +120,7 @@ import (
 	"github.com/att/gopkgs/jsontools"
 	"github.com/att/gopkgs/ssh_broker"
 	"github.com/att/gopkgs/token"
+	"github.com/att/tegu/gizmos"
 )
 
 // globals
@@ -94,6 +131,22 @@ var (
 
 	running_sim	bool = false	// prevent queueing more if one is running (set up intermediate)
 	running_map bool = false	// map phost
+
+	agent_name	string			// name sent to tegu at registration
+	agent_hosts	[]string		// hosts we can reach (sent at registration); empty means all
+	registered	bool = false	// tegu has accepted our registration
+
+								// action types we support; sent to tegu at registration
+	agent_caps	[]string = []string{ "setqueues", "flowmod", "map_mac2phost", "intermed_queues", "mirrorwiz", "bw_fmod", "bwow_fmod", "passthru",
+					"dump_state", "del_fmods", "del_res_fmods", "purge_queues", "qpolicy_caps", "lldp_neighbours",
+					"mbox_health" }
+
+	ovsdb_target string = ""	// when set queues are managed via ovsdb rather than scripts; %s is replaced with the host name
+	outward_ports []string		// port names (trailing * allowed) which get queues for port -128 data
+	imed_queues	bool = false	// set queues on intermediate bridges
+
+	of_target	string = ""		// when set reservation flow-mods are pushed via openflow; %s is the host, %b the bridge
+	of_verify	bool = false	// dump flows after installing to verify
 )
 
 
@@ -127,6 +180,30 @@ type agent_msg struct {
 	State	int				// if an ack/nack some state information
 	Vinfo	string			// agent version info for debugging
 	Rid		uint32			// original request id
+	Agent_id string			// registration: our name
+	Caps	[]string		// registration: action types supported
+	Hosts	[]string		// registration: hosts we can reach
+}
+
+/*
+	The things we need from a session manager; implemented by connman.Cmgr and
+	by tls_conn.
+*/
+type tegu_conn interface {
+	Connect( host_port string, id string, data_chan chan *connman.Sess_data ) ( error )
+	Write( id string, buf []byte )
+}
+
+/*
+	A single TLS session to tegu.
+*/
+type tls_conn struct {
+	mu			sync.Mutex
+	conn		*tls.Conn
+	cert_fname	string
+	key_fname	string
+	ca_fname	string
+	server_name	string
 }
 //--- generic message functions ---------------------------------------------------------------------
 
@@ -138,8 +215,8 @@ func msg_007( host string, cmd string, err error ) {
 	sheep.Baa( 0, "ERR: unable to submit command: on %s: %s: %s	[TGUAGN007]", host, cmd, err )
 }
 
-func msg_008( count int ) {
-	sheep.Baa( 1, "WRN: timeout waiting for mac2phost responses; %d replies not received   [TGUAGN008]", count )
+func msg_008( what string, count int ) {
+	sheep.Baa( 1, "WRN: timeout waiting for %s responses; %d replies not received   [TGUAGN008]", what, count )
 }
 
 func msg_009( cname string, host string ) {
@@ -148,11 +225,114 @@ func msg_009( cname string, host string ) {
 
 //----------------------------------------------------------------------------------------------------
 
+/*
+	Build the tls configuration. The files are read on each connection so that
+	replaced certificates are used when the session to tegu is reestablished.
+*/
+func (tc *tls_conn) config( ) ( cfg *tls.Config, err error ) {
+	cfg = &tls.Config {
+		MinVersion:	tls.VersionTLS12,
+		ServerName:	tc.server_name,
+	}
+
+	if tc.cert_fname != "" {
+		cert, err := tls.LoadX509KeyPair( tc.cert_fname, tc.key_fname )
+		if err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{ cert }
+	}
+
+	if tc.ca_fname != "" {
+		pem, err := ioutil.ReadFile( tc.ca_fname )
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if ! cfg.RootCAs.AppendCertsFromPEM( pem ) {
+			return nil, fmt.Errorf( "no certificates found in CA bundle: %s", tc.ca_fname )
+		}
+	}
+
+	return cfg, nil
+}
+
+/*
+	Connect to tegu and start a reader which sends data and disconnect notifications
+	to the data channel in the same manner as connman.
+*/
+func (tc *tls_conn) Connect( host_port string, id string, data_chan chan *connman.Sess_data ) ( error ) {
+	cfg, err := tc.config( )
+	if err != nil {
+		return err
+	}
+
+	conn, err := tls.Dial( "tcp", host_port, cfg )
+	if err != nil {
+		return err
+	}
+
+	tc.mu.Lock()
+	tc.conn = conn
+	tc.mu.Unlock()
+
+	go func( ) {
+		for {
+			buf := make( []byte, 4096 )
+			n, err := conn.Read( buf )
+			if n > 0 {
+				data_chan <- &connman.Sess_data{ Id: id, State: connman.ST_DATA, Buf: buf[0:n] }
+			}
+			if err != nil {
+				conn.Close( )
+				data_chan <- &connman.Sess_data{ Id: id, State: connman.ST_DISC }
+				return
+			}
+		}
+	}( )
+
+	return nil
+}
+
+func (tc *tls_conn) Write( id string, buf []byte ) {
+	tc.mu.Lock()
+	conn := tc.conn
+	tc.mu.Unlock()
+
+	if conn != nil {
+		conn.Write( buf )
+	}
+}
+
+/*
+	Send our registration to tegu. Tegu sends nothing to us until it has accepted
+	the registration.
+*/
+func send_registration( smgr tegu_conn ) {
+	msg := &agent_msg {
+		Ctype:		"register",
+		Vinfo:		version,
+		Agent_id:	agent_name,
+		Caps:		agent_caps,
+		Hosts:		agent_hosts,
+	}
+
+	jmsg, err := json.Marshal( msg )
+	if err != nil {
+		sheep.Baa( 0, "ERR: unable to build registration message: %s  [TGUAGN010]", err )
+		return
+	}
+
+	registered = false
+	smgr.Write( "c0", jmsg )
+	sheep.Baa( 1, "registration sent to tegu: name=%s hosts=%d", agent_name, len( agent_hosts ) )
+}
+
 /*
 	Establishes a connection with tegu. This blocks until a connection is established
-	and tries every few seconds until successful.
+	and tries every few seconds until successful. Once connected our registration is sent.
 */
-func connect2tegu( smgr *connman.Cmgr, host_port *string, data_chan chan *connman.Sess_data ) {
+func connect2tegu( smgr tegu_conn, host_port *string, data_chan chan *connman.Sess_data ) {
 
 	burble := 0		// limit our complaining to once a minute or so
 
@@ -160,6 +340,7 @@ func connect2tegu( smgr *connman.Cmgr, host_port *string, data_chan chan *connma
 		err := smgr.Connect( *host_port, "c0", data_chan )
 		if err == nil {
 			sheep.Baa( 1, "connection with tegu established: %s", *host_port )
+			send_registration( smgr )
 			return
 		}
 
@@ -258,6 +439,130 @@ func build_opt( value string, opt string ) ( parm string ) {
 	return
 }
 
+/*
+	Return the openflow target for the host and bridge: %s in the -of value is replaced with
+	the host name and %b with the bridge.
+*/
+func of_target4( host string, bridge string ) ( string ) {
+	return strings.Replace( strings.Replace( of_target, "%s", host, -1 ), "%b", bridge, -1 )
+}
+
+/*
+	Check that each flow installed is in the dumped set (same priority and macs) with the
+	same actions (queue, dscp, meter, resubmit or group).
+*/
+func of_verify_flows( flows []*gizmos.Of_flow, stats []*gizmos.Of_flow_stats ) ( error ) {
+	for _, f := range flows {
+		var found *gizmos.Of_flow_stats
+		for _, s := range stats {
+			if s.Priority == f.Priority && s.Match != nil && strings.EqualFold( s.Match.Eth_src, f.Match.Eth_src ) && strings.EqualFold( s.Match.Eth_dst, f.Match.Eth_dst ) {
+				found = s
+				if f.Same_insts( s.Insts ) {
+					break
+				}
+			}
+		}
+		if found == nil {
+			return fmt.Errorf( "flow with priority %d src=%s dst=%s not found in flow table", f.Priority, f.Match.Eth_src, f.Match.Eth_dst )
+		}
+		if ! f.Same_insts( found.Insts ) {
+			return fmt.Errorf( "flow with priority %d src=%s dst=%s installed with different actions than expected: %s", f.Priority, f.Match.Eth_src, f.Match.Eth_dst, f )
+		}
+	}
+
+	return nil
+}
+
+/*
+	Build the reservation flow-mods from the action's parms and push them to br-int on the
+	host as a single bundle, rather than running the script. Done is false if the parms
+	cannot be expressed natively (e.g. passthru given an endpoint uuid) and the caller should
+	fall back to the script. The response is the same as the script based functions build.
+*/
+func (act *json_action ) do_native_fmod( cmd_type string, build func( map[string]string ) ( []*gizmos.Of_flow, error ), timeout time.Duration ) ( jout []byte, err error, done bool ) {
+	flows, err := build( act.Data )
+	if err != nil {
+		sheep.Baa( 1, "%s: cannot be done natively, using script: %s", cmd_type, err )
+		return nil, nil, false
+	}
+
+	msg := agent_msg{}				// build response to send back
+	msg.Ctype = "response"
+	msg.Rtype = cmd_type
+	msg.Rid = act.Aid				// response id so tegu can map back to requestor
+	msg.Vinfo = version
+	msg.State = 0					// assume success
+
+	target := of_target4( act.Hosts[0], gizmos.OF_RES_BRIDGE )
+	sheep.Baa( 1, "%s: installing %d flow-mods via openflow: %s", cmd_type, len( flows ), target )
+
+	oc, err := gizmos.Mk_ofconn( target )
+	if err == nil {
+		oc.Timeout = timeout * time.Second
+		err = oc.Bundle( flows... )
+		if err == nil && of_verify {
+			stats, derr := oc.Dump_flows( gizmos.OFPTT_ALL, flows[0].Cookie, 0xffffffffffffffff )
+			if derr == nil {
+				derr = of_verify_flows( flows, stats )
+			}
+			if derr != nil {
+				sheep.Baa( 0, "WRN: %s: flow-mods not verified on %s: %s  [TGUAGN015]", cmd_type, act.Hosts[0], derr )
+				err = derr
+			}
+		}
+		oc.Close( )
+	}
+
+	if err != nil {
+		msg.State = 1								// tegu will retry
+		msg.Edata = []string{ err.Error() }
+		sheep.Baa( 0, "ERR: %s unable to install flow-mods on %s: %s	[TGUAGN014]", cmd_type, act.Hosts[0], err )
+	} else {
+		sheep.Baa( 1, "%s: %d flow-mods installed on %s", cmd_type, len( flows ), act.Hosts[0] )
+	}
+
+	jout, err = json.Marshal( msg )
+	return jout, err, true
+}
+
+/*
+	Install (or update) the select group needed by a bandwidth reservation that is split across
+	paths. The group must exist before the flow-mods which reference it are added. The bucket
+	ports must be ports of the reservation bridge on the host (checked via ovsdb).
+*/
+func (act *json_action ) set_bw_group( timeout time.Duration ) ( err error ) {
+	g, err := gizmos.Of_bw_group( act.Data )
+	if err != nil || g == nil {
+		return err
+	}
+
+	o, err := gizmos.Mk_ovsdb( ovsdb_target4( act.Hosts[0] ) )
+	if err != nil {
+		return err
+	}
+	ports, err := o.Ports( )
+	o.Close( )
+	if err == nil {
+		err = gizmos.Of_bw_group_ports( act.Data["group"], ports )
+	}
+	if err != nil {
+		return err
+	}
+
+	oc, err := gizmos.Mk_ofconn( of_target4( act.Hosts[0], gizmos.OF_RES_BRIDGE ) )
+	if err != nil {
+		return err
+	}
+	oc.Timeout = timeout * time.Second
+	err = oc.Set_group( g )
+	oc.Close( )
+
+	if err == nil {
+		sheep.Baa( 1, "bw_fmod: group set on %s: %s", act.Hosts[0], g )
+	}
+	return err
+}
+
 /*
 	Bandwidth flow-mod generation rolls the creation of a set of flow-mods into a single script which
 	eliminates the need for Tegu to understand/know things like command line parms, bridge names and
@@ -268,6 +573,29 @@ func (act *json_action ) do_bw_fmod( cmd_type string, broker *ssh_broker.Broker,
 		cmd_str string
     )
 
+	if act.Data["group"] != "" {						// split across paths; only possible natively
+		switch {
+			case of_target == "":
+				err = fmt.Errorf( "split reservations need openflow (-of)" )
+			case ovsdb_target == "":
+				err = fmt.Errorf( "split reservations need ovsdb (-ovsdb) to check the group's ports" )
+			default:
+				err = act.set_bw_group( timeout )
+		}
+		if err != nil {										// the shares are only right on their paths; fail rather than install on one
+			sheep.Baa( 0, "ERR: %s: split across paths not installed on %s: %s  [TGUAGN020]", cmd_type, act.Hosts[0], err )
+			msg := agent_msg{ Ctype: "response", Rtype: cmd_type, Rid: act.Aid, Vinfo: version, State: 1, Edata: []string{ err.Error() } }
+			jout, err = json.Marshal( msg )
+			return jout, err
+		}
+	}
+
+	if of_target != "" {
+		if jout, err, done := act.do_native_fmod( cmd_type, gizmos.Of_bw_flows, timeout ); done {
+			return jout, err
+		}
+	}
+
 	pstr := ""
 	if path != nil {
 		pstr = fmt.Sprintf( "PATH=%s:$PATH ", *path )		// path to add if needed
@@ -307,7 +635,8 @@ func (act *json_action ) do_bw_fmod( cmd_type string, broker *ssh_broker.Broker,
 	err = broker.NBRun_cmd( act.Hosts[0], cmd_str, 0, ssh_rch )			// for now, there will only ever be one host for these commands
 	if err != nil {
 		sheep.Baa( 1, "WRN: error submitting bandwidth command  to %s: %s", act.Hosts[0], err )
-		jout, _ = json.Marshal( msg )
+		msg.State = 1
+		jout, err = json.Marshal( msg )				// failure response must still go back to tegu
 		return
 	}
 
@@ -321,6 +650,7 @@ func (act *json_action ) do_bw_fmod( cmd_type string, broker *ssh_broker.Broker,
 			case <- time.After( timeout * time.Second ):		// timeout if we don't get something back soonish
 				sheep.Baa( 1, "WRN: timeout waiting for response from %s; cmd: %s", act.Hosts[0], cmd_str )
 				timer_pop = true
+				msg.State = 1								// no answer is a failure; tegu will retry
 
 			case resp := <- ssh_rch:					// response from broker
 				wait4--
@@ -363,6 +693,12 @@ func (act *json_action ) do_bwow_fmod( cmd_type string, broker *ssh_broker.Broke
 		cmd_str string
     )
 
+	if of_target != "" {
+		if jout, err, done := act.do_native_fmod( cmd_type, gizmos.Of_bwow_flows, timeout ); done {
+			return jout, err
+		}
+	}
+
 	pstr := ""
 	if path != nil {
 		pstr = fmt.Sprintf( "PATH=%s:$PATH ", *path )		// path to add if needed
@@ -396,7 +732,8 @@ func (act *json_action ) do_bwow_fmod( cmd_type string, broker *ssh_broker.Broke
 	err = broker.NBRun_cmd( act.Hosts[0], cmd_str, 0, ssh_rch )			// oneway fmods are only ever applied to one host so [0] is ok
 	if err != nil {
 		sheep.Baa( 1, "WRN: error submitting bwow command  to %s: %s", act.Hosts[0], err )
-		jout, _ = json.Marshal( msg )
+		msg.State = 1
+		jout, err = json.Marshal( msg )				// failure response must still go back to tegu
 		return
 	}
 
@@ -411,6 +748,7 @@ func (act *json_action ) do_bwow_fmod( cmd_type string, broker *ssh_broker.Broke
 			case <- time.After( timeout * time.Second ):		// timeout if we don't get something back soonish
 				sheep.Baa( 1, "WRN: timeout waiting for response from %s; cmd: %s", act.Hosts[0], cmd_str )
 				timer_pop = true
+				msg.State = 1								// no answer is a failure; tegu will retry
 
 			case resp := <- ssh_rch:					// response from broker
 				wait4--
@@ -452,6 +790,12 @@ func (act *json_action ) do_pass_fmod( cmd_type string, broker *ssh_broker.Broke
 		cmd_str string
     )
 
+	if of_target != "" {
+		if jout, err, done := act.do_native_fmod( cmd_type, gizmos.Of_pt_flows, timeout ); done {
+			return jout, err
+		}
+	}
+
 	pstr := ""
 	if path != nil {
 		pstr = fmt.Sprintf( "PATH=%s:$PATH ", *path )		// path to add if needed
@@ -478,7 +822,8 @@ func (act *json_action ) do_pass_fmod( cmd_type string, broker *ssh_broker.Broke
 	err = broker.NBRun_cmd( act.Hosts[0], cmd_str, 0, ssh_rch )			// oneway fmods are only ever applied to one host so [0] is ok
 	if err != nil {
 		sheep.Baa( 1, "WRN: error submitting passthru command  to %s: %s", act.Hosts[0], err )
-		jout, _ = json.Marshal( msg )
+		msg.State = 1
+		jout, err = json.Marshal( msg )				// failure response must still go back to tegu
 		return
 	}
 
@@ -493,6 +838,7 @@ func (act *json_action ) do_pass_fmod( cmd_type string, broker *ssh_broker.Broke
 			case <- time.After( timeout * time.Second ):		// timeout if we don't get something back soonish
 				sheep.Baa( 1, "WRN: timeout waiting for response from %s; cmd: %s", act.Hosts[0], cmd_str )
 				timer_pop = true
+				msg.State = 1								// no answer is a failure; tegu will retry
 
 			case resp := <- ssh_rch:					// response from broker
 				wait4--
@@ -569,7 +915,7 @@ func do_map_mac2phost( req json_action, broker *ssh_broker.Broker, path *string,
 	for wait4 > 0 && !timer_pop {			// wait for responses back on the channel or the timer to pop
 		select {
 			case <- time.After( timeout * time.Second ):		// timeout after 15 seconds
-				msg_008( wait4 )
+				msg_008( "mac2phost", wait4 )
 				timer_pop = true
 
 			case resp := <- ssh_rch:					// response from broker
@@ -611,12 +957,28 @@ func do_intermedq( req json_action, broker *ssh_broker.Broker, path *string, tim
 	running_sim = true										// prevent queuing another of these
 	sheep.Baa( 1, "running intermediate switch queue/fmod setup on all hosts (broker)" )
 
+	bflag := ""
+	if imed_queues {
+		if ovsdb_target != "" {									// queues are set here; the script sets just flow-mods etc.
+			ovsdb_on_hosts( "setup-intermed", req.Hosts, timeout, func( host string, o *gizmos.Ovsdb ) ( error ) {
+				ports, err := o.Ports( )
+				if err != nil {
+					return err
+				}
+				return o.Set_qos( gizmos.Ovs_intermed_spec( ports, []string{ "br-rl", "br-ex" }, 500 * 1024, gizmos.OVS_MAX_RATE ), gizmos.OVS_OWN_IMED )
+			} )
+			bflag = "-Q "										// flow-mods on the bridges, but leave the queues alone
+		} else {
+			bflag = "-B "
+		}
+	}
+
 	ssh_rch := make( chan *ssh_broker.Broker_msg, len( req.Hosts ) )		// channel for ssh results; with the potential to buffer all responses
 																			// do NOT close the channel here; only senders should close
 
 	wait4 := 0																// number of responses to wait for
 	for i := range req.Hosts {
-		cmd_str := fmt.Sprintf( `PATH=%s:$PATH setup_ovs_intermed -d "%s"`, *path, req.Dscps )
+		cmd_str := fmt.Sprintf( `PATH=%s:$PATH setup_ovs_intermed %s-d "%s"`, *path, bflag, req.Dscps )
     	sheep.Baa( 1, "via broker on %s: %s", req.Hosts[i], cmd_str )
 
 		err := broker.NBRun_cmd( req.Hosts[i], cmd_str, wait4, ssh_rch )
@@ -632,7 +994,7 @@ func do_intermedq( req json_action, broker *ssh_broker.Broker, path *string, tim
 	for wait4 > 0 && !timer_pop {							// collect responses logging any errors
 		select {
 			case <- time.After( timeout * time.Second ):		// timeout
-				msg_008( wait4 )
+				msg_008( "setup-intermed", wait4 )
 				timer_pop = true
 
 			case resp := <- ssh_rch:							// response back from the broker
@@ -655,6 +1017,139 @@ func do_intermedq( req json_action, broker *ssh_broker.Broker, path *string, tim
 	running_sim = false
 }
 
+/*
+	Return the ovsdb target for the host: %s in the -ovsdb value is replaced with the host name.
+*/
+func ovsdb_target4( host string ) ( string ) {
+	if strings.Contains( ovsdb_target, "%s" ) {
+		return strings.Replace( ovsdb_target, "%s", host, -1 )
+	}
+	return ovsdb_target
+}
+
+/*
+	Connect to ovsdb on each host, in parallel, and run fn. Errors are logged. Returns the number
+	of hosts which failed or did not finish before the timeout.
+*/
+func ovsdb_on_hosts( what string, hosts []string, timeout time.Duration, fn func( host string, o *gizmos.Ovsdb ) ( error ) ) ( errcount int ) {
+	type result struct {
+		host	string
+		err		error
+	}
+
+	startt := time.Now().Unix()
+	rch := make( chan *result, len( hosts ) )				// buffered so that late finishers do not block after a timeout
+	for _, h := range hosts {
+		go func( host string ) {
+			target := ovsdb_target4( host )
+			o, err := gizmos.Mk_ovsdb( target )
+			if err == nil {
+				err = fn( host, o )
+				o.Close( )
+			}
+			rch <- &result{ host: host, err: err }
+		}( h )
+	}
+
+	wait4 := len( hosts )
+	timer := time.After( timeout * time.Second )
+	for wait4 > 0 {
+		select {
+			case <- timer:
+				msg_008( what, wait4 )
+				errcount += wait4
+				wait4 = 0
+
+			case r := <- rch:
+				wait4--
+				if r.err != nil {
+					sheep.Baa( 0, "ERR: %s: ovsdb update failed on %s: %s  [TGUAGN012]", what, r.host, r.err )
+					errcount++
+				} else {
+					sheep.Baa( 1, "%s: queues set via ovsdb on: %s", what, r.host )
+				}
+		}
+	}
+
+	sheep.Baa( 1, "%s: %ds elapsed %d hosts %d errors (ovsdb)", what, time.Now().Unix() - startt, len( hosts ), errcount )
+	return errcount
+}
+
+/*
+	Return the queue policy sent with the request; htb when none was sent or it cannot be parsed.
+*/
+func req_qpolicy( req json_action ) ( *gizmos.Qpolicy ) {
+	qp, err := gizmos.Mk_qpolicy( req.Data["qpolicy"] )
+	if err != nil {
+		sheep.Baa( 0, "WRN: queue policy from tegu ignored, htb used: %s  [TGUAGN019]", err )
+		qp, _ = gizmos.Mk_qpolicy( "" )
+	}
+	return qp
+}
+
+/*
+	Set the meters for each bridge which uses the meter policy. Bridges named in the policy
+	with no queues still get an (empty) list so that meters no longer needed are removed.
+*/
+func set_meters( host string, qp *gizmos.Qpolicy, meters map[string][]*gizmos.Of_meter ) ( error ) {
+	for b, m := range qp.Bridges {
+		if _, ok := meters[b]; !ok && m == gizmos.QP_METER {
+			meters[b] = nil
+		}
+	}
+	if len( meters ) == 0 {
+		return nil
+	}
+
+	if of_target == "" {
+		return fmt.Errorf( "queue policy uses meters but there is no openflow target (-of)" )
+	}
+
+	for b, ml := range meters {
+		oc, err := gizmos.Mk_ofconn( of_target4( host, b ) )
+		if err != nil {
+			return err
+		}
+		err = oc.Set_meters( ml, gizmos.QP_METER_MAX )
+		oc.Close( )
+		if err != nil {
+			return fmt.Errorf( "%s: %s", b, err )
+		}
+		sheep.Baa( 2, "create-q: %d meters set on %s/%s", len( ml ), host, b )
+	}
+
+	return nil
+}
+
+/*
+	Set queues using ovsdb on each host rather than running create_ovs_queues. The queue data
+	is converted to QoS/Queue rows for the ports on each host and applied in a single transaction
+	per host; reservation queues on ports no longer listed are removed. The queue policy sent
+	with the request selects the QoS type for each bridge, or meters in place of queues.
+*/
+func do_setqueues_ovsdb( req json_action, timeout time.Duration ) {
+	sheep.Baa( 1, "create-q: setting %d queue items on %d hosts via ovsdb", len( req.Qdata ), len( req.Hosts ) )
+	qp := req_qpolicy( req )
+
+	ovsdb_on_hosts( "create-q", req.Hosts, timeout, func( host string, o *gizmos.Ovsdb ) ( error ) {
+		ports, err := o.Ports( )
+		if err != nil {
+			return err
+		}
+
+		spec, errs := gizmos.Ovs_parse_qdata( req.Qdata, host, ports, outward_ports, 0 )
+		for _, e := range errs {
+			sheep.Baa( 1, "WRN: create-q: %s: %s  [TGUAGN013]", host, e )
+		}
+
+		meters := gizmos.Qp_apply( qp, spec, ports )
+		if err = o.Set_qos( spec, gizmos.OVS_OWN_RES ); err != nil {
+			return err
+		}
+		return set_meters( host, qp, meters )
+	} )
+}
+
 /*
 	Execute a create_ovs_queues for each host in the list. The create queues script is unique inasmuch
 	as it expects an input file that is supplied either as a filename as $1, or on stdin if $1 is omitted.
@@ -671,6 +1166,15 @@ func do_setqueues( req json_action, broker *ssh_broker.Broker, path *string, tim
         err error
     )
 
+	if ovsdb_target != "" {
+		do_setqueues_ovsdb( req, timeout )
+		return
+	}
+
+	if qp := req_qpolicy( req ); len( qp.Mechs() ) != 1 || qp.Mechs()[0] != gizmos.QP_HTB {
+		sheep.Baa( 0, "WRN: create-q: queue policy %s needs -ovsdb; create_ovs_queues sets htb  [TGUAGN019]", qp )
+	}
+
 	startt := time.Now().Unix()
 
     fname := fmt.Sprintf( "/tmp/tegu_setq_%d_%x_%02d.data", os.Getpid(), time.Now().Unix(), rand.Intn( 10 ) )
@@ -715,7 +1219,7 @@ func do_setqueues( req json_action, broker *ssh_broker.Broker, path *string, tim
 	for wait4 > 0 && !timer_pop {							// collect responses logging any errors
 		select {
 			case <- time.After( timeout * time.Second ):		// timeout
-				msg_008( wait4 )
+				msg_008( "setqueues", wait4 )
 				timer_pop = true
 
 			case resp := <- ssh_rch:							// response back from the broker
@@ -778,7 +1282,7 @@ func do_fmod( req json_action, broker *ssh_broker.Broker, path *string, timeout
 		for wait4 > 0 && !timer_pop {							// collect responses logging any errors
 			select {
 				case <- time.After( timeout * time.Second ):		// timeout
-					msg_008( wait4 )
+					msg_008( "flowmod", wait4 )
 					timer_pop = true
 
 				case resp := <- ssh_rch:							// response back from the broker
@@ -859,51 +1363,780 @@ func do_mirrorwiz( req json_action, broker *ssh_broker.Broker, path *string ) (
 }
 
 /*
-	Unpacks the json blob into the generic json request structure and validates that the ctype
-	is one of the expected types.  The only supported ctype at the moment is action_list; this
-	function will then split out the actions and invoke the proper do_* function to
-	execute the action.
-
-	Returns a list of responses that should be written back to tegu, or nil if none of the
-	requests produced responses.
+	Parse a line of ovs-ofctl dump-flows output; ok is false if the line is not a flow or
+	the cookie is not one we were asked for.
 */
-func handle_blob( jblob []byte, broker *ssh_broker.Broker, path *string ) ( resp [][]byte ) {
-	var (
-		req	json_request		// unpacked request struct
-		ridx int = 0
-	)
-
-	resp = make( [][]byte, 128 )
+func parse_ofctl_flow( line string, cookies map[uint64]bool ) ( cookie uint64, pri int, src string, dst string, ok bool ) {
+	pri = 32768														// ovs default when not shown
+	for _, tok := range strings.FieldsFunc( line, func( c rune ) bool { return c == ',' || c == ' ' } ) {
+		kv := strings.SplitN( tok, "=", 2 )
+		if len( kv ) != 2 {
+			continue
+		}
+		switch kv[0] {
+			case "cookie":
+				if _, err := fmt.Sscanf( kv[1], "0x%x", &cookie ); err != nil {
+					return 0, 0, "", "", false
+				}
+				ok = cookies[cookie]
 
-    err := json.Unmarshal( jblob, &req )           // unpack the json
-	if err != nil {
-		sheep.Baa( 0, "ERR: unable to unpack request: %s	[TGUAGN006]", err )
-		sheep.Baa( 0, "got: %s", jblob )
-		return
+			case "priority":	fmt.Sscanf( kv[1], "%d", &pri )
+			case "dl_src", "eth_src":	src = kv[1]
+			case "dl_dst", "eth_dst":	dst = kv[1]
+			case "actions":		return
+		}
 	}
 
-	if req.Ctype != "action_list" {
-		sheep.Baa( 0, "unknown request type received from tegu: %s", req.Ctype )
-		return
+	return
+}
+
+/*
+	Collect the reservation flows (those with one of the cookies) and the number of reservation
+	queues on a host. Flows are dumped natively when -of was given, else ovs-ofctl is run via
+	the broker. Queues can only be counted when -ovsdb is given (count is -1 otherwise).
+*/
+func host_state( host string, cookies map[uint64]bool, broker *ssh_broker.Broker ) ( lines []string, err error ) {
+	lines = make( []string, 0, 64 )
+	add := func( cookie uint64, pri int, src string, dst string ) {
+		lines = append( lines, fmt.Sprintf( "flow host=%s cookie=0x%x priority=%d src=%s dst=%s", host, cookie, pri, strings.ToLower( src ), strings.ToLower( dst ) ) )
 	}
 
-	for i := range req.Actions {
-		switch( req.Actions[i].Atype ) {
-			case "setqueues":								// set queues
-					do_setqueues( req.Actions[i], broker, path, 30 )
+	if of_target != "" {
+		oc, err := gizmos.Mk_ofconn( of_target4( host, gizmos.OF_RES_BRIDGE ) )
+		if err != nil {
+			return nil, err
+		}
+		defer oc.Close( )
 
-			case "flowmod":									// set a flow mod
-					do_fmod( req.Actions[i], broker, path, 30 )
+		for c := range cookies {
+			stats, err := oc.Dump_flows( gizmos.OFPTT_ALL, c, 0xffffffffffffffff )
+			if err != nil {
+				return nil, err
+			}
+			for _, s := range stats {
+				add( s.Cookie, int( s.Priority ), s.Match.Eth_src, s.Match.Eth_dst )
+			}
+		}
+	} else {
+		stdout, stderr, err := broker.Run_cmd( host, "sudo ovs-ofctl dump-flows " + gizmos.OF_RES_BRIDGE )
+		if err != nil {
+			if stderr != nil {
+				dump_stderr( *stderr, "dump_state " + host )
+			}
+			return nil, err
+		}
+		for _, line := range strings.Split( stdout.String(), "\n" ) {
+			if cookie, pri, src, dst, ok := parse_ofctl_flow( line, cookies ); ok {
+				add( cookie, pri, src, dst )
+			}
+		}
+	}
 
-			case "map_mac2phost":							// run script to generate mac to physical host mappings
-					if ! running_sim {												// it's not good to start overlapping setup scripts
-						p, err := do_map_mac2phost( req.Actions[i], broker, path, 30 )
-						if err == nil {
-							resp[ridx] = p
-							ridx++
+	nqueues := -1
+	if ovsdb_target != "" {
+		o, err := gizmos.Mk_ovsdb( ovsdb_target4( host ) )
+		if err != nil {
+			return nil, err
+		}
+		_, nqueues, err = o.Qos_count( gizmos.OVS_OWN_RES )
+		o.Close( )
+		if err != nil {
+			return nil, err
+		}
+
+		if of_target != "" {								// meters stand in for queues on a bridge using the meter policy
+			if oc, err := gizmos.Mk_ofconn( of_target4( host, gizmos.OF_RES_BRIDGE ) ); err == nil {
+				if ml, err := oc.Dump_meters( ); err == nil {
+					for _, m := range ml {
+						if m.Id <= gizmos.QP_METER_MAX {
+							nqueues++
 						}
-					} else {
-						sheep.Baa( 1, "handle blob: mac2phost periodic run blocked: setqueues still running" )
+					}
+				}
+				oc.Close( )
+			}
+		}
+	}
+	lines = append( lines, fmt.Sprintf( "queues host=%s count=%d", host, nqueues ) )
+	lines = append( lines, fmt.Sprintf( "state host=%s flows=%d", host, len( lines ) - 1 ) )
+
+	return lines, nil
+}
+
+/*
+	Report the reservation flows and queues which are actually installed on each host so that
+	tegu can reconcile them against what should be there. Hosts are queried in parallel; hosts
+	which fail, or do not finish before the timeout, are reported with an error line so that
+	tegu does not mistake them for hosts with nothing installed.
+*/
+func do_dump_state( req json_action, broker *ssh_broker.Broker, timeout time.Duration ) ( jout []byte, err error ) {
+	type result struct {
+		host	string
+		lines	[]string
+		err		error
+	}
+
+	cookies := make( map[uint64]bool )
+	for _, cs := range strings.Fields( req.Data["cookies"] ) {
+		var c uint64
+		if _, err := fmt.Sscanf( cs, "0x%x", &c ); err == nil {
+			cookies[c] = true
+		}
+	}
+
+	startt := time.Now().Unix()
+	rch := make( chan *result, len( req.Hosts ) )				// buffered so late finishers do not block
+	for _, h := range req.Hosts {
+		go func( host string ) {
+			lines, err := host_state( host, cookies, broker )
+			rch <- &result{ host: host, lines: lines, err: err }
+		}( h )
+	}
+
+	msg := agent_msg{ Ctype: "response", Rtype: req.Atype, Rid: req.Aid, Vinfo: version, State: 0 }
+	msg.Rdata = make( []string, 0, 128 )
+
+	done := make( map[string]bool )
+	timer := time.After( timeout * time.Second )
+	for len( done ) < len( req.Hosts ) {
+		select {
+			case <- timer:
+				msg_008( "dump_state", len( req.Hosts ) - len( done ) )
+				for _, h := range req.Hosts {
+					if ! done[h] {
+						msg.Rdata = append( msg.Rdata, fmt.Sprintf( "error host=%s timeout", h ) )
+						done[h] = true
+					}
+				}
+
+			case r := <- rch:
+				if ! done[r.host] {
+					done[r.host] = true
+					if r.err != nil {
+						sheep.Baa( 0, "ERR: dump_state: unable to collect state from %s: %s  [TGUAGN016]", r.host, r.err )
+						msg.Rdata = append( msg.Rdata, fmt.Sprintf( "error host=%s %s", r.host, r.err ) )
+					} else {
+						msg.Rdata = append( msg.Rdata, r.lines... )
+					}
+				}
+		}
+	}
+
+	sheep.Baa( 1, "dump_state: %ds elapsed %d hosts %d lines", time.Now().Unix() - startt, len( req.Hosts ), len( msg.Rdata ) )
+	jout, err = json.Marshal( msg )
+	return
+}
+
+/*
+	Remove the reservation flows with the cookie and macs from the host. Either mac may be
+	empty to match any. The id of a split reservation's group is not known here so the group
+	is left; it sends nothing once the flows are gone and is replaced if the id is used again.
+*/
+func del_flows( host string, cookie uint64, smac string, dmac string, broker *ssh_broker.Broker ) ( err error ) {
+	if of_target != "" {
+		var oc *gizmos.Of_conn
+		if oc, err = gizmos.Mk_ofconn( of_target4( host, gizmos.OF_RES_BRIDGE ) ); err == nil {
+			m := gizmos.Mk_of_match()
+			m.Eth_src = smac
+			m.Eth_dst = dmac
+			err = oc.Delete_flows( gizmos.OFPTT_ALL, cookie, 0xffffffffffffffff, m )
+			oc.Close( )
+		}
+	} else {
+		match := fmt.Sprintf( "cookie=0x%x/-1", cookie )
+		if smac != "" {
+			match += ",dl_src=" + smac
+		}
+		if dmac != "" {
+			match += ",dl_dst=" + dmac
+		}
+		cstr := fmt.Sprintf( "sudo ovs-ofctl del-flows %s %s", gizmos.OF_RES_BRIDGE, match )
+		sheep.Baa( 1, "via broker on %s: %s", host, cstr )
+		_, _, err = broker.Run_cmd( host, cstr )
+	}
+
+	return
+}
+
+/*
+	Remove the reservation flows with the cookie and macs from the host (orphans found by
+	tegu's reconciler).
+*/
+func do_del_fmods( req json_action, broker *ssh_broker.Broker ) ( jout []byte, err error ) {
+	msg := agent_msg{ Ctype: "response", Rtype: req.Atype, Rid: req.Aid, Vinfo: version, State: 0 }
+
+	var cookie uint64
+	_, err = fmt.Sscanf( req.Data["cookie"], "0x%x", &cookie )
+	if err == nil && len( req.Hosts ) > 0 {
+		err = del_flows( req.Hosts[0], cookie, req.Data["smac"], req.Data["dmac"], broker )
+		if err == nil {
+			exp_ledger.drop( req.Hosts[0], cookie, req.Data["smac"], req.Data["dmac"] )
+		}
+	} else {
+		if err == nil {
+			err = fmt.Errorf( "no host" )
+		}
+	}
+
+	if err != nil {
+		msg.State = 1
+		msg.Edata = []string{ err.Error() }
+		sheep.Baa( 0, "ERR: del_fmods: unable to remove flow-mods cookie=%s smac=%s dmac=%s: %s  [TGUAGN017]", req.Data["cookie"], req.Data["smac"], req.Data["dmac"], err )
+	}
+
+	jout, err = json.Marshal( msg )
+	return
+}
+
+/*
+	Build the flows of a reservation from the parms of the action (bw_fmod, bwow_fmod or
+	passthru) that installed them.
+*/
+func res_flows( atype string, parms map[string]string ) ( []*gizmos.Of_flow, error ) {
+	switch atype {
+		case "bw_fmod":
+			return gizmos.Of_bw_flows( parms )
+
+		case "bwow_fmod":
+			return gizmos.Of_bwow_flows( parms )
+
+		case "passthru":
+			return gizmos.Of_pt_flows( parms )
+	}
+
+	return nil, fmt.Errorf( "not a reservation action: %s", atype )
+}
+
+/*
+	Remove the flows of one reservation from the host. The flows are built again from the
+	parms that installed them and each is removed with a strict delete (table, priority,
+	cookie and match) so that the flows of other reservations between the same endpoints
+	are left in place. A split reservation's group is removed once its flows are gone.
+*/
+func del_res_flows( host string, atype string, parms map[string]string, broker *ssh_broker.Broker ) ( err error ) {
+	flows, err := res_flows( atype, parms )
+	if err != nil {
+		return err
+	}
+	dels := gizmos.Of_strict_deletes( flows )
+
+	if of_target != "" {
+		var oc *gizmos.Of_conn
+		if oc, err = gizmos.Mk_ofconn( of_target4( host, gizmos.OF_RES_BRIDGE ) ); err == nil {
+			err = oc.Add_flows( dels... )
+			if err == nil && parms["group"] != "" {
+				var gid uint32
+				if gid, err = gizmos.Of_bw_parm_gid( parms ); err == nil {
+					err = oc.Delete_group( gid )
+				}
+			}
+			oc.Close( )
+		}
+		return err
+	}
+
+	cmds := make( []string, len( dels ) )
+	for i, d := range dels {
+		cmds[i] = fmt.Sprintf( "sudo ovs-ofctl --strict del-flows %s '%s'", gizmos.OF_RES_BRIDGE, gizmos.Of_strict_del_str( d ) )
+	}
+	cstr := strings.Join( cmds, " && " )
+	sheep.Baa( 1, "via broker on %s: %s", host, cstr )
+	_, _, err = broker.Run_cmd( host, cstr )
+
+	return err
+}
+
+/*
+	Remove the flows of an expired reservation that were installed without a hard timeout.
+	The data is the parms of the action that installed them with rtype set to that action's
+	type.
+*/
+func do_del_res_fmods( req json_action, broker *ssh_broker.Broker ) ( jout []byte, err error ) {
+	msg := agent_msg{ Ctype: "response", Rtype: req.Atype, Rid: req.Aid, Vinfo: version, State: 0 }
+
+	rtype := req.Data["rtype"]
+	parms := make( map[string]string, len( req.Data ) )
+	for k, v := range req.Data {
+		if k != "rtype" {
+			parms[k] = v
+		}
+	}
+
+	if len( req.Hosts ) > 0 {
+		err = del_res_flows( req.Hosts[0], rtype, parms, broker )
+		if err == nil {
+			exp_ledger.drop_res( req.Hosts[0], rtype, parms )
+		}
+	} else {
+		err = fmt.Errorf( "no host" )
+	}
+
+	if err != nil {
+		msg.State = 1
+		msg.Edata = []string{ err.Error() }
+		sheep.Baa( 0, "ERR: del_res_fmods: unable to remove %s flow-mods smac=%s dmac=%s: %s  [TGUAGN023]", rtype, parms["smac"], parms["dmac"], err )
+	}
+
+	jout, err = json.Marshal( msg )
+	return
+}
+
+//--- expiry ledger ---------------------------------------------------------------------------------
+
+/*
+	Flow-mods that tegu installs without a hard timeout are deleted by tegu when the
+	reservation expires. The ledger records the expiry of each such set of flows along with
+	the action (type and parms) that installed them so that the sweeper can remove exactly
+	those flows if tegu does not (tegu down or the connection lost at the time). The ledger
+	is kept in memory unless a file is given; only a file survives an agent restart.
+*/
+type ledger_ent struct {
+	Host	string
+	Atype	string					// action that installed the flows
+	Parms	map[string]string		// its parms; the flows are built from them again to delete them
+	Expiry	int64
+	key		string					// not saved; rebuilt from the parms on load
+}
+
+type ledger struct {
+	mu		sync.Mutex
+	fname	string					// file the ledger is saved to; empty for memory only
+	ents	map[string]*ledger_ent
+}
+
+var exp_ledger *ledger = &ledger{ ents: make( map[string]*ledger_ent ) }
+
+/*
+	Build the key of the flows installed on the host by the action: the strict deletes that
+	remove them. Reservations whose flows are the same (same match and priority) share the
+	flows and thus the key.
+*/
+func ledger_key( host string, atype string, parms map[string]string ) ( string, error ) {
+	flows, err := res_flows( atype, parms )
+	if err != nil {
+		return "", err
+	}
+
+	k := host
+	for _, d := range gizmos.Of_strict_deletes( flows ) {
+		k += " " + gizmos.Of_strict_del_str( d )
+	}
+	return k, nil
+}
+
+/*
+	Returns true if the entry's flows carry the cookie and macs of a deletion. An empty mac
+	in the deletion matches any; bandwidth flows are set in both directions.
+*/
+func (e *ledger_ent) covered( cookie uint64, smac string, dmac string ) ( bool ) {
+	var ecookie uint64
+	switch e.Atype {
+		case "bw_fmod":		ecookie = gizmos.OF_COOKIE_BW
+		case "bwow_fmod":	ecookie = gizmos.OF_COOKIE_BWOW
+		case "passthru":	ecookie = gizmos.OF_COOKIE_PT
+	}
+	if ecookie != cookie {
+		return false
+	}
+
+	match := func( s string, d string ) ( bool ) {
+		return (smac == "" || smac == s) && (dmac == "" || dmac == d)
+	}
+	return match( e.Parms["smac"], e.Parms["dmac"] ) || (e.Atype == "bw_fmod" && match( e.Parms["dmac"], e.Parms["smac"] ))
+}
+
+/*
+	Load the ledger from the file; a missing file is not an error.
+*/
+func (l *ledger) load( fname string ) ( err error ) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.fname = fname
+	buf, err := ioutil.ReadFile( fname )
+	if err != nil {
+		if os.IsNotExist( err ) {
+			return nil
+		}
+		return err
+	}
+
+	elist := make( []*ledger_ent, 0 )
+	if err = json.Unmarshal( buf, &elist ); err != nil {
+		return err
+	}
+	for _, e := range elist {
+		if e.key, err = ledger_key( e.Host, e.Atype, e.Parms ); err != nil {
+			sheep.Baa( 0, "WRN: flow-mod expiry ledger entry for %s discarded: %s  [TGUAGN018]", e.Host, err )
+			continue
+		}
+		l.ents[e.key] = e
+	}
+
+	return nil
+}
+
+/*
+	Write the ledger to the file (if there is one). Caller must hold the lock.
+*/
+func (l *ledger) save( ) {
+	if l.fname == "" {
+		return
+	}
+
+	elist := make( []*ledger_ent, 0, len( l.ents ) )
+	for _, e := range l.ents {
+		elist = append( elist, e )
+	}
+	buf, err := json.Marshal( elist )
+	if err == nil {
+		tname := l.fname + ".new"
+		if err = ioutil.WriteFile( tname, buf, 0644 ); err == nil {
+			err = os.Rename( tname, l.fname )
+		}
+	}
+	if err != nil {
+		sheep.Baa( 0, "WRN: unable to save flow-mod expiry ledger: %s: %s  [TGUAGN018]", l.fname, err )
+	}
+}
+
+/*
+	Returns true if the response built by one of the do_ functions reports success.
+*/
+func resp_ok( jout []byte ) ( bool ) {
+	msg := agent_msg{}
+	if err := json.Unmarshal( jout, &msg ); err != nil {
+		return false
+	}
+	return msg.State == 0
+}
+
+/*
+	Record the flows installed by a bw_fmod, bwow_fmod or passthru action when they were
+	installed without a hard timeout (timeout 0 with an expiry).
+*/
+func (l *ledger) note( act *json_action ) {
+	if act.Data["timeout"] != "0" || act.Data["expiry"] == "" || len( act.Hosts ) == 0 {
+		return
+	}
+
+	var expiry int64
+	if _, err := fmt.Sscanf( act.Data["expiry"], "%d", &expiry ); err != nil {
+		return
+	}
+
+	k, err := ledger_key( act.Hosts[0], act.Atype, act.Data )
+	if err != nil {												// e.g. passthru from an endpoint uuid; the flows carry a mac we don't know
+		sheep.Baa( 2, "%s flow-mods on %s cannot be swept: %s", act.Atype, act.Hosts[0], err )
+		return
+	}
+
+	parms := make( map[string]string, len( act.Data ) )
+	for pk, v := range act.Data {
+		parms[pk] = v
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if le := l.ents[k]; le == nil || le.Expiry < expiry {		// flows shared by reservations with the same match; keep the latest
+		l.ents[k] = &ledger_ent{ Host: act.Hosts[0], Atype: act.Atype, Parms: parms, Expiry: expiry, key: k }
+	}
+	l.save()
+}
+
+/*
+	Drop the entries whose flows were removed by a cookie and mac deletion.
+*/
+func (l *ledger) drop( host string, cookie uint64, smac string, dmac string ) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := 0
+	for k, e := range l.ents {
+		if e.Host == host && e.covered( cookie, smac, dmac ) {
+			delete( l.ents, k )
+			n++
+		}
+	}
+	if n > 0 {
+		l.save()
+	}
+}
+
+/*
+	Drop the entry for the flows of one reservation which were deleted.
+*/
+func (l *ledger) drop_res( host string, atype string, parms map[string]string ) {
+	k, err := ledger_key( host, atype, parms )
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.ents[k] != nil {
+		delete( l.ents, k )
+		l.save()
+	}
+}
+
+/*
+	Return the entries whose expiry is more than grace seconds in the past.
+*/
+func (l *ledger) expired( grace int64 ) ( elist []*ledger_ent ) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now().Unix()
+	for _, e := range l.ents {
+		if e.Expiry + grace < now {
+			elist = append( elist, e )
+		}
+	}
+
+	return elist
+}
+
+/*
+	Safety sweeper: every freq seconds remove the flows in the ledger that tegu should have
+	deleted (expired more than grace seconds ago) but did not. Only the flows of the expired
+	reservation are removed. An entry is dropped only after the flows are removed; it is
+	tried again on the next sweep otherwise.
+*/
+func sweep_ledger( l *ledger, broker *ssh_broker.Broker, freq int, grace int64 ) {
+	for {
+		time.Sleep( time.Duration( freq ) * time.Second )
+
+		for _, e := range l.expired( grace ) {
+			sheep.Baa( 1, "sweeper: removing orphaned %s flow-mods on %s: smac=%s dmac=%s expired=%d", e.Atype, e.Host, e.Parms["smac"], e.Parms["dmac"], e.Expiry )
+			if err := del_res_flows( e.Host, e.Atype, e.Parms, broker ); err != nil {
+				sheep.Baa( 0, "WRN: sweeper: unable to remove expired %s flow-mods on %s smac=%s dmac=%s: %s  [TGUAGN018]", e.Atype, e.Host, e.Parms["smac"], e.Parms["dmac"], err )
+			} else {
+				l.mu.Lock()
+				if l.ents[e.key] == e {						// not replaced by a later install while deleting
+					delete( l.ents, e.key )
+					l.save()
+				}
+				l.mu.Unlock()
+			}
+		}
+	}
+}
+
+/*
+	Remove all reservation queues from each host. Supported only when queues are managed
+	through ovsdb (the scripts cannot tell which queues tegu created).
+*/
+func do_purge_queues( req json_action, timeout time.Duration ) ( jout []byte, err error ) {
+	msg := agent_msg{ Ctype: "response", Rtype: req.Atype, Rid: req.Aid, Vinfo: version, State: 0 }
+
+	if ovsdb_target == "" {
+		msg.State = 1
+		msg.Edata = []string{ "purge_queues requires -ovsdb" }
+		sheep.Baa( 1, "WRN: purge_queues request ignored: queues are not managed via ovsdb" )
+	} else {
+		if ovsdb_on_hosts( "purge-q", req.Hosts, timeout, func( host string, o *gizmos.Ovsdb ) ( error ) { return o.Purge_qos( gizmos.OVS_OWN_RES ) } ) > 0 {
+			msg.State = 1
+		}
+	}
+
+	jout, err = json.Marshal( msg )
+	return
+}
+
+/*
+	Report the queue policy mechanisms that each host supports: one line per host, the host
+	name followed by the mechanisms. Only htb is possible with create_ovs_queues; with ovsdb
+	any QoS type can be set, and meters are possible when flow-mods are pushed via openflow
+	and the switch has meters. Split is added when the select groups of reservations split
+	across paths can be installed (openflow and ovsdb).
+*/
+func do_qpolicy_caps( req json_action ) ( jout []byte, err error ) {
+	msg := agent_msg{ Ctype: "response", Rtype: req.Atype, Rid: req.Aid, Vinfo: version, State: 0 }
+	msg.Rdata = make( []string, 0, len( req.Hosts ) )
+
+	for _, h := range req.Hosts {
+		mechs := gizmos.QP_HTB
+		if ovsdb_target != "" {
+			mechs += " " + gizmos.QP_HFSC + " " + gizmos.QP_NOOP
+
+			if of_target != "" {
+				if oc, err := gizmos.Mk_ofconn( of_target4( h, gizmos.OF_RES_BRIDGE ) ); err == nil {
+					if max, err := oc.Meter_features( ); err == nil && max > 0 {
+						mechs += " " + gizmos.QP_METER
+					}
+					mechs += " " + gizmos.OF_CAP_SPLIT
+					oc.Close( )
+				} else {
+					sheep.Baa( 1, "qpolicy_caps: unable to connect to %s: %s", h, err )
+				}
+			}
+		}
+
+		msg.Rdata = append( msg.Rdata, h + " " + mechs )
+		sheep.Baa( 2, "qpolicy_caps: %s %s", h, mechs )
+	}
+
+	jout, err = json.Marshal( msg )
+	return
+}
+
+/*
+	Collect the lldp neighbours seen by each host. Lldpctl (key/value output) is run on each host
+	along with a read of the interface speeds; the commands are submitted to the broker for all
+	hosts and the results collected as they arrive (up to timeout seconds). One record per
+	neighbour is returned (see gizmos/lldp.go). Hosts which fail are reported in the log and
+	omitted so tegu keeps what it last learned for them.
+*/
+func do_lldp_neighbours( req json_action, broker *ssh_broker.Broker, timeout time.Duration ) ( jout []byte, err error ) {
+	cmd_str := `lldpctl -f keyvalue 2>/dev/null; for f in /sys/class/net/*/speed; do i=${f%/speed}; echo "speed.${i##*/}=$(cat $f 2>/dev/null)"; done`
+
+	ssh_rch := make( chan *ssh_broker.Broker_msg, len( req.Hosts ) )
+	wait4 := 0
+	for _, h := range req.Hosts {
+		if err := broker.NBRun_cmd( h, cmd_str, wait4, ssh_rch ); err != nil {
+			msg_007( h, "lldpctl", err )
+		} else {
+			wait4++
+		}
+	}
+
+	msg := agent_msg{ Ctype: "response", Rtype: req.Atype, Rid: req.Aid, Vinfo: version, State: 0 }
+	msg.Rdata = make( []string, 0, len( req.Hosts ) * 2 )
+
+	timer := time.After( timeout * time.Second )			// one deadline for all hosts; not reset by each reply
+	for timer_pop := false; wait4 > 0 && ! timer_pop; {
+		select {
+			case <- timer:
+				sheep.Baa( 1, "WRN: timeout waiting for lldp neighbour responses; %d replies not received  [TGUAGN021]", wait4 )
+				timer_pop = true
+
+			case resp := <- ssh_rch:
+				wait4--
+				stdout, stderr, _, err := resp.Get_results()
+				host, _, _ := resp.Get_info()
+				if err != nil {
+					msg_009( "lldpctl", host )
+					dump_stderr( stderr, "lldp_neighbours " + host )
+					continue
+				}
+
+				lines := make( []string, bytes.Count( stdout.Bytes(), []byte( "\n" ) ) )		// sized to the output; buf_into_array drops what does not fit
+				n := buf_into_array( stdout, lines, 0 )
+				nbrs := gizmos.Lldp_parse( host, lines[0:n] )
+				for _, nb := range nbrs {
+					msg.Rdata = append( msg.Rdata, nb.String() )
+				}
+				sheep.Baa( 2, "lldp_neighbours: %s reported %d neighbour(s)", host, len( nbrs ) )
+		}
+	}
+
+	jout, err = json.Marshal( msg )
+	return
+}
+
+/*
+	Report the state of the middleboxes (macs in Qdata) attached to the host (one host per
+	request). A box is up if its interface is up and has an openflow port; tegu removes boxes
+	which are not from their pools.
+*/
+func do_mbox_health( req json_action, broker *ssh_broker.Broker, timeout time.Duration ) ( jout []byte, err error ) {
+	msg := agent_msg{ Ctype: "response", Rtype: req.Atype, Rid: req.Aid, Vinfo: version, State: 0 }
+	if len( req.Hosts ) != 1 || len( req.Qdata ) == 0 {
+		sheep.Baa( 1, "mbox_health: request ignored: expected one host and at least one mac" )
+		return nil, fmt.Errorf( "bad mbox_health request" )
+	}
+
+	cmd_str := `$( (( $(id -u) )) && echo sudo ) ovs-vsctl --format=csv --data=bare --no-headings --columns=external_ids,link_state,admin_state,ofport list interface`
+	ssh_rch := make( chan *ssh_broker.Broker_msg, 1 )
+	if err = broker.NBRun_cmd( req.Hosts[0], cmd_str, 0, ssh_rch ); err != nil {
+		msg_007( req.Hosts[0], "ovs-vsctl", err )
+		return nil, err
+	}
+
+	select {
+		case <- time.After( timeout * time.Second ):
+			sheep.Baa( 1, "WRN: timeout waiting for middlebox health from %s  [TGUAGN022]", req.Hosts[0] )
+			return nil, fmt.Errorf( "timeout" )
+
+		case resp := <- ssh_rch:
+			stdout, stderr, _, rerr := resp.Get_results()
+			if rerr != nil {
+				msg_009( "ovs-vsctl", req.Hosts[0] )
+				dump_stderr( stderr, "mbox_health " + req.Hosts[0] )
+				return nil, rerr			// no response; a host we cannot reach says nothing about the boxes
+			}
+
+			lines := make( []string, 8192 )
+			n := buf_into_array( stdout, lines, 0 )
+			msg.Rdata = gizmos.Mbox_health_parse( req.Hosts[0], req.Qdata, lines[0:n] )
+			sheep.Baa( 2, "mbox_health: %s: %v", req.Hosts[0], msg.Rdata )
+	}
+
+	jout, err = json.Marshal( msg )
+	return
+}
+
+/*
+	Unpacks the json blob into the generic json request structure and validates that the ctype
+	is one of the expected types.  The only supported ctype at the moment is action_list; this
+	function will then split out the actions and invoke the proper do_* function to
+	execute the action.
+
+	Returns a list of responses that should be written back to tegu, or nil if none of the
+	requests produced responses.
+*/
+func handle_blob( jblob []byte, broker *ssh_broker.Broker, path *string ) ( resp [][]byte ) {
+	var (
+		req	json_request		// unpacked request struct
+		ridx int = 0
+	)
+
+	resp = make( [][]byte, 128 )
+
+    err := json.Unmarshal( jblob, &req )           // unpack the json
+	if err != nil {
+		sheep.Baa( 0, "ERR: unable to unpack request: %s	[TGUAGN006]", err )
+		sheep.Baa( 0, "got: %s", jblob )
+		return
+	}
+
+	switch req.Ctype {
+		case "action_list":			// handled below
+
+		case "reg_ack":
+			registered = true
+			sheep.Baa( 1, "registration accepted by tegu" )
+			return
+
+		case "reg_nack":
+			sheep.Baa( 0, "ERR: registration rejected by tegu; check tegu log for details  [TGUAGN011]" )
+			return
+
+		default:
+			sheep.Baa( 0, "unknown request type received from tegu: %s", req.Ctype )
+			return
+	}
+
+	for i := range req.Actions {
+		switch( req.Actions[i].Atype ) {
+			case "setqueues":								// set queues
+					do_setqueues( req.Actions[i], broker, path, 30 )
+
+			case "flowmod":									// set a flow mod
+					do_fmod( req.Actions[i], broker, path, 30 )
+
+			case "map_mac2phost":							// run script to generate mac to physical host mappings
+					if ! running_sim {												// it's not good to start overlapping setup scripts
+						p, err := do_map_mac2phost( req.Actions[i], broker, path, 30 )
+						if err == nil {
+							resp[ridx] = p
+							ridx++
+						}
+					} else {
+						sheep.Baa( 1, "handle blob: mac2phost periodic run blocked: setqueues still running" )
 					}
 
 			case "intermed_queues":													// setup intermediate queues
@@ -923,6 +2156,9 @@ func handle_blob( jblob []byte, broker *ssh_broker.Broker, path *string ) ( resp
 			case "bw_fmod":									// new bandwidth flow-mod
 					p, err := req.Actions[i].do_bw_fmod( req.Actions[i].Atype, broker, path, 15 )
 					if err == nil {
+						if resp_ok( p ) {						// only flows that were installed need deleting at expiry
+							exp_ledger.note( &req.Actions[i] )
+						}
 						resp[ridx] = p
 						ridx++
 					}
@@ -930,12 +2166,67 @@ func handle_blob( jblob []byte, broker *ssh_broker.Broker, path *string ) ( resp
 			case "bwow_fmod":									// generate oneway bandwidth flow-mods
 					p, err := req.Actions[i].do_bwow_fmod( req.Actions[i].Atype, broker, path, 15 )
 					if err == nil {
+						if resp_ok( p ) {						// only flows that were installed need deleting at expiry
+							exp_ledger.note( &req.Actions[i] )
+						}
 						resp[ridx] = p
 						ridx++
 					}
 
 			case "passthru":									// generate flow-mods for a passthrough reservation
 					p, err := req.Actions[i].do_pass_fmod( req.Actions[i].Atype, broker, path, 15 )
+					if err == nil {
+						if resp_ok( p ) {						// only flows that were installed need deleting at expiry
+							exp_ledger.note( &req.Actions[i] )
+						}
+						resp[ridx] = p
+						ridx++
+					}
+
+			case "dump_state":									// report installed reservation flows/queues for reconciliation
+					p, err := do_dump_state( req.Actions[i], broker, 30 )
+					if err == nil {
+						resp[ridx] = p
+						ridx++
+					}
+
+			case "del_fmods":									// remove orphaned reservation flow-mods
+					p, err := do_del_fmods( req.Actions[i], broker )
+					if err == nil {
+						resp[ridx] = p
+						ridx++
+					}
+
+			case "del_res_fmods":								// remove the flow-mods of an expired reservation
+					p, err := do_del_res_fmods( req.Actions[i], broker )
+					if err == nil {
+						resp[ridx] = p
+						ridx++
+					}
+
+			case "purge_queues":								// remove orphaned reservation queues
+					p, err := do_purge_queues( req.Actions[i], 15 )
+					if err == nil {
+						resp[ridx] = p
+						ridx++
+					}
+
+			case "qpolicy_caps":								// report queue policy mechanisms supported
+					p, err := do_qpolicy_caps( req.Actions[i] )
+					if err == nil {
+						resp[ridx] = p
+						ridx++
+					}
+
+			case "lldp_neighbours":								// topology discovery
+					p, err := do_lldp_neighbours( req.Actions[i], broker, 30 )
+					if err == nil {
+						resp[ridx] = p
+						ridx++
+					}
+
+			case "mbox_health":									// steering middlebox pool member state
+					p, err := do_mbox_health( req.Actions[i], broker, 15 )
 					if err == nil {
 						resp[ridx] = p
 						ridx++
@@ -960,6 +2251,8 @@ func handle_blob( jblob []byte, broker *ssh_broker.Broker, path *string ) ( resp
 func usage( version string ) {
 	fmt.Fprintf( os.Stdout, "tegu_agent %s\n", version )
 	fmt.Fprintf( os.Stdout, "usage: tegu_agent -i id [-h host:port] [-l log-dir] [-p n] [-v | -V level] [-k key] [-no-rsync] [-rdir dir] [-rlist list] [-u user]\n" )
+	fmt.Fprintf( os.Stdout, "       [-n name] [-hosts host-list] [-cert cert-file -key key-file] [-ca ca-file] [-sn server-name]\n" )
+	fmt.Fprintf( os.Stdout, "       [-ovsdb target] [-outward port-list] [-iq] [-of target [-ofverify]] [-ledger file] [-sweep sec]\n" )
 }
 
 func main() {
@@ -989,9 +2282,24 @@ func main() {
 	}
 	def_key := home + "/.ssh/id_rsa," + home + "/.ssh/id_dsa"		// default ssh key to use
 
+	def_name, _ := os.Hostname()
+
 	needs_help := flag.Bool( "?", false, "show usage" )				// define recognised command line options
 	id := flag.Int( "i", 0, "id" )
+	ca_file := flag.String( "ca", "", "CA bundle used to verify tegu (enables TLS)" )
+	cert_file := flag.String( "cert", "", "certificate presented to tegu (enables TLS)" )
+	host_list := flag.String( "hosts", "", "hosts this agent can reach (default all)" )
+	iq_flag := flag.Bool( "iq", false, "set queues on intermediate bridges" )
+	tls_key := flag.String( "key", "", "key for -cert" )
+	name := flag.String( "n", def_name, "name given to tegu at registration" )
+	of_flag := flag.String( "of", "", "openflow target for reservation flow-mods e.g. unix:/var/run/openvswitch/%b.mgmt (default use scripts)" )
+	of_verify_flag := flag.Bool( "ofverify", false, "verify flow-mods installed via openflow" )
+	ovsdb := flag.String( "ovsdb", "", "ovsdb target used to set queues e.g. tcp:%s:6640 (default use scripts)" )
+	outward := flag.String( "outward", "qosirl*", "ports which get queues for -128 queue data" )
+	server_name := flag.String( "sn", "", "name expected in tegu's certificate" )
+	sweep := flag.Int( "sweep", 0, "seconds between sweeps for expired flow-mods tegu did not delete (default off)" )
 	key_files := flag.String( "k", def_key, "ssh-key file(s) for broker" )
+	ledger_file := flag.String( "ledger", "", "file where the expiry ledger is kept (default memory only)" )
 	log_dir := flag.String( "l", "stderr", "log_dir" )
 	parallel := flag.Int( "p", 10, "parallel ssh commands" )
 	no_rsync := flag.Bool( "no-rsync", false, "turn off rsync" )
@@ -1039,9 +2347,33 @@ func main() {
 	sheep.Baa( 1, "tegu_agent %s started", version )
 	sheep.Baa( 1, "will contact tegu on port: %s", *tegu_host )
 
+	agent_name = *name
+	if agent_name == "" {
+		agent_name = fmt.Sprintf( "agent-%d", *id )
+	}
+	_, agent_hosts = token.Tokenise_populated( *host_list, " ," )
+
+	ovsdb_target = *ovsdb
+	_, outward_ports = token.Tokenise_populated( *outward, " ," )
+	imed_queues = *iq_flag
+	if ovsdb_target != "" {
+		sheep.Baa( 1, "queues will be managed via ovsdb: %s", ovsdb_target )
+	}
+	of_target = *of_flag
+	of_verify = *of_verify_flag
+	if of_target != "" {
+		sheep.Baa( 1, "reservation flow-mods will be pushed via openflow: %s verify=%v", of_target, of_verify )
+	}
+
 	jc := jsontools.Mk_jsoncache( )							// create json cache to buffer tegu datagram input
 	sess_mgr := make( chan *connman.Sess_data, 1024 )		// session management to create tegu connections with and drive the session listener(s)
-	smgr := connman.NewManager( "", sess_mgr );				// get a manager, but no listen port opened
+	var smgr tegu_conn
+	if *cert_file != "" || *ca_file != "" {
+		sheep.Baa( 1, "connection to tegu will use TLS" )
+		smgr = &tls_conn{ cert_fname: *cert_file, key_fname: *tls_key, ca_fname: *ca_file, server_name: *server_name }
+	} else {
+		smgr = connman.NewManager( "", sess_mgr );			// get a manager, but no listen port opened
+	}
 
 	connect2tegu( smgr, tegu_host, sess_mgr )				// establish initial connection
 
@@ -1066,6 +2398,19 @@ func main() {
 	sheep.Baa( 1, "successfully created ssh_broker for user: %s, command path: %s", *user, *rdir )
 	broker.Start_initiators( *parallel )
 
+	if *ledger_file != "" {
+		if err := exp_ledger.load( *ledger_file ); err != nil {
+			sheep.Baa( 0, "WRN: unable to load flow-mod expiry ledger: %s: %s  [TGUAGN018]", *ledger_file, err )
+		}
+	}
+	if *sweep > 0 {
+		sheep.Baa( 1, "flow-mods without a hard timeout that tegu fails to delete will be swept every %ds", *sweep )
+		if *ledger_file == "" {
+			sheep.Baa( 1, "WRN: no -ledger file: flow-mods installed before an agent restart will not be swept  [TGUAGN018]" )
+		}
+		go sweep_ledger( exp_ledger, broker, *sweep, int64( *sweep ) )
+	}
+
 
 	for {
 		select {									// wait on input from any channel -- just one now, but who knows
@@ -1078,6 +2423,7 @@ func main() {
 
 					case connman.ST_DISC:
 						sheep.Baa( 1, "session to tegu was lost" )
+						registered = false
 						connect2tegu( smgr, tegu_host, sess_mgr )			// blocks until connected and reports on the conn_ch channel when done
 						broker.Reset( )				// reset the broker each time we pick up a new tegu connection
 
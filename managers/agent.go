@@ -37,11 +37,26 @@
 					100 bytes.
 				17 Jun 2105 : Added oneway reservation support.
 				16 Nov 2105 : Handle response from remote mirror agents
+				18 Oct 2026 : Added TLS listener and agent registration; commands are sent only
+					to registered agents and data from unregistered agents is rejected.
+				19 Oct 2026 : A TLS listener requires client_ca; registration and match_id default on only
+					with TLS so plain agents which predate registration still work.
+				18 Oct 2026 : Route actions to agents based on registered hosts and capabilities
+					(see agent_route.go).
+				18 Oct 2026 : Track actions associated with reservations until the agent responds
+					and resend on failure/timeout (see agent_track.go).
+				18 Oct 2026 : REQ_MAC2PHOST and REQ_INTERMEDQ accept a host list from the southbound agent driver.
+				18 Oct 2026 : State (dump_state) responses are passed to fq_mgr for reconciliation.
+				19 Oct 2026 : Queue policy capability (qpolicy_caps) responses are passed to fq_mgr.
+				19 Oct 2026 : Queue policy capability responses are also passed to network (split groups).
+				19 Oct 2026 : Periodic lldp_neighbours request (lldp_refresh); responses are passed to network.
+				19 Oct 2026 : Middlebox health (mbox_health) responses are passed to res_mgr.
 */
 
 package managers
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -64,6 +79,8 @@ type action struct {			// specific action
 	Dscps	string				// space separated list of dscp values
 	Fdata	[]string			// flowmod command data
 	Qdata	[]string			// queue parms
+	Rname	string				// reservation the action was generated for (tracked until acknowledged)
+	Pgen	uint32				// push generation of the reservation; returned to res_mgr with the result
 }
 
 type agent_cmd struct {			// overall command
@@ -77,12 +94,24 @@ type agent_cmd struct {			// overall command
 type agent struct {
 	id		string
 	jcache	*jsontools.Jsoncache				// buffered input resulting in 'records' that are complete json blobs
+	registered bool								// agent has sent a valid registration message
+	agent_id string								// id the agent supplied at registration
+	vinfo	string								// agent version from registration
+	caps	[]string							// action types the agent claims to support
+	hosts	[]string							// hosts the agent claims it can reach (empty == all)
 }
 
 type agent_data struct {
 	agents	map[string]*agent					// hash for direct index (based on ID string given to the session)
 	agent_list []*agent							// sequential index into map that allows easier round robin access for sendone
 	aidx	int									// next spot in index for round robin sends
+	need_reg bool								// agents must register before they are sent anything
+	match_id bool								// registered id must match a name in the agent's certificate
+	held	[]*held_action						// actions waiting for an agent that can handle them
+	outstanding map[uint32]*outstanding			// actions waiting on a response, by action id
+	next_aid uint32								// last action id assigned
+	ack_timeout int64							// seconds to wait for a response before resending
+	ack_retries int								// number of resends before an action fails
 }
 
 /*
@@ -96,19 +125,24 @@ type agent_msg struct {
 	State	int				// if an ack/nack some state information
 	Vinfo	string			// agent version (debugging mostly)
 	Rid		uint32			// original request id
+	Agent_id string			// registration: the agent's id
+	Caps	[]string		// registration: action types supported
+	Hosts	[]string		// registration: hosts the agent can reach
 }
 
 /*
 	Build the agent list from the map. The agent list is a 'sequential' list of all currently
-	connected agents which affords us an easy means to roundrobin through them.
+	connected agents which affords us an easy means to roundrobin through them. If agents
+	must register, only those that have registered are placed into the list.
 */
 func (ad *agent_data) build_list( ) {
-	ad.agent_list = make( []*agent, len( ad.agents ) )
-	i := 0
+	ad.agent_list = make( []*agent, 0, len( ad.agents ) )
 	for _, a := range ad.agents {
-		ad.agent_list[i] = a
-		i++
+		if a.registered || ! ad.need_reg {
+			ad.agent_list = append( ad.agent_list, a )
+		}
 	}
+	i := len( ad.agent_list )
 
 	if ad.aidx >= i {			// wrap if list shrank and we point beyond it
 		ad.aidx = 0
@@ -134,8 +168,8 @@ func (ad *agent_data) Mk_agent( aid string ) ( na *agent ) {
 	Send the message to one agent. The agent is selected using the current
 	index in the agent_data so that it effectively does a round robin.
 */
-func (ad *agent_data) send2one( smgr *connman.Cmgr,  msg string ) {
-	l := len( ad.agents )
+func (ad *agent_data) send2one( smgr agent_smgr,  msg string ) {
+	l := len( ad.agent_list )
 	if l <= 0 {
 		return
 	}
@@ -155,8 +189,8 @@ func (ad *agent_data) send2one( smgr *connman.Cmgr,  msg string ) {
 	Send the message to one agent. The agent is selected using the current
 	index in the agent_data so that it effectively does a round robin.
 */
-func (ad *agent_data) sendbytes2one( smgr *connman.Cmgr,  msg []byte ) {
-	l := len( ad.agents )
+func (ad *agent_data) sendbytes2one( smgr agent_smgr,  msg []byte ) {
+	l := len( ad.agent_list )
 	if l <= 0 {
 		return
 	}
@@ -176,8 +210,8 @@ func (ad *agent_data) sendbytes2one( smgr *connman.Cmgr,  msg []byte ) {
 	agent that has been designated to handle all long running tasks
 	that are not time sensitive (such as intermediate queue setup/checking).
 */
-func (ad *agent_data) sendbytes2lra( smgr *connman.Cmgr,  msg []byte ) {
-	l := len( ad.agents )
+func (ad *agent_data) sendbytes2lra( smgr agent_smgr,  msg []byte ) {
+	l := len( ad.agent_list )
 	if l <= 0 {
 		return
 	}
@@ -190,8 +224,8 @@ func (ad *agent_data) sendbytes2lra( smgr *connman.Cmgr,  msg []byte ) {
 	agent that has been designated to handle all long running tasks
 	that are not time sensitive (such as intermediate queue setup/checking).
 */
-func (ad *agent_data) send2lra( smgr *connman.Cmgr,  msg string ) {
-	l := len( ad.agents )
+func (ad *agent_data) send2lra( smgr agent_smgr,  msg string ) {
+	l := len( ad.agent_list )
 	if l <= 0 {
 		return
 	}
@@ -202,10 +236,10 @@ func (ad *agent_data) send2lra( smgr *connman.Cmgr,  msg string ) {
 /*
 	Send the message to all agents.
 */
-func (ad *agent_data) send2all( smgr *connman.Cmgr,  msg string ) {
+func (ad *agent_data) send2all( smgr agent_smgr,  msg string ) {
 	am_sheep.Baa( 2, "sending %d bytes", len( msg ) )
-	for id := range ad.agents {
-		smgr.Write( id, []byte( msg ) )
+	for _, a := range ad.agent_list {
+		smgr.Write( a.id, []byte( msg ) )
 	}
 }
 
@@ -215,8 +249,12 @@ func (ad *agent_data) send2all( smgr *connman.Cmgr,  msg string ) {
 	from the cache. If the blob is pulled, then we act on it, else we
 	assume another buffer or more will be coming to complete the blob
 	and we'll do it next time round.
+
+	Until the agent has registered the only message accepted is a registration
+	message; anything else causes the session to be closed when registration is
+	required. Returns true if the agent registered during this call.
 */
-func ( a *agent ) process_input( buf []byte ) {
+func ( a *agent ) process_input( buf []byte, ad *agent_data, smgr agent_smgr ) ( new_reg bool ) {
 	var (
 		req	agent_msg		// unpacked message struct
 	)
@@ -232,8 +270,24 @@ func ( a *agent ) process_input( buf []byte ) {
 		} else {
 			am_sheep.Baa( 1, "%s/%s received from agent", req.Ctype, req.Rtype )
 
+			if ! a.registered && ad.need_reg && req.Ctype != "register" {
+				am_sheep.Baa( 0, "ERR: %s message from unregistered agent session %s rejected; session closed  [TGUAGT009]", req.Ctype, a.id )
+				smgr.Close( a.id )
+				return
+			}
+
 			switch( req.Ctype ) {					// "command type"
+				case "register":					// agent introducing itself
+					if ad.register( a, &req, smgr ) {
+						ad.build_list( )
+						new_reg = true
+					} else {
+						smgr.Close( a.id )
+						return
+					}
+
 				case "response":					// response to a request
+					ad.ack( smgr, req.Rid, req.State == 0 )			// resolve the outstanding action (if tracked)
 					if req.State == 0 {
 						switch( req.Rtype ) {
 							case "map_mac2phost":
@@ -244,6 +298,24 @@ func ( a *agent ) process_input( buf []byte ) {
 								// Stuff the response back in the mirror object - quick and dirty and probably not "right"
 								save_mirror_response( req.Rdata, req.Edata )
 
+							case "dump_state":					// installed flows/queues; fq_mgr reconciles
+								msg := ipc.Mk_chmsg( )
+								msg.Send_req( fq_ch, nil, REQ_RECONCILE, req.Rdata, nil )
+
+							case "qpolicy_caps":				// queue policy mechanisms each host supports
+								msg := ipc.Mk_chmsg( )
+								msg.Send_req( fq_ch, nil, REQ_QPCAPS, req.Rdata, nil )
+								nmsg := ipc.Mk_chmsg( )
+								nmsg.Send_req( nw_ch, nil, REQ_QPCAPS, req.Rdata, nil )
+
+							case "lldp_neighbours":				// topology discovery
+								msg := ipc.Mk_chmsg( )
+								msg.Send_req( nw_ch, nil, REQ_LLDP, req.Rdata, nil )
+
+							case "mbox_health":					// state of middlebox pool members; res_mgr adjusts the pools
+								msg := ipc.Mk_chmsg( )
+								msg.Send_req( rmgr_ch, nil, REQ_MBOX_HEALTH, req.Rdata, nil )
+
 							default:
 								am_sheep.Baa( 2, "WRN:  success response data from agent was ignored for: %s  [TGUAGT001]", req.Rtype )
 								if am_sheep.Would_baa( 2 ) {
@@ -280,12 +352,71 @@ func ( a *agent ) process_input( buf []byte ) {
 	return
 }
 
+/*
+	Process a registration message from the agent. The agent id must be supplied and,
+	if configured and the session is TLS with a verified certificate, must match one
+	of the names in the certificate. An ack (reg_ack) or nack (reg_nack) is sent to the
+	agent. Returns true if the registration was accepted.
+*/
+func (ad *agent_data) register( a *agent, req *agent_msg, smgr agent_smgr ) ( bool ) {
+	reason := ""
+
+	if req.Agent_id == "" {
+		reason = "no agent id supplied"
+	} else {
+		if ad.match_id {
+			reason = "agent id does not match certificate"
+			if tsm, ok := smgr.( *tls_smgr ); ok {
+				for _, n := range tsm.Peer_names( a.id ) {
+					if n == req.Agent_id {
+						reason = ""
+						break
+					}
+				}
+			}
+		}
+	}
+
+	if reason != "" {
+		am_sheep.Baa( 0, "ERR: registration from agent session %s (%s) rejected: %s  [TGUAGT010]", a.id, req.Agent_id, reason )
+		ad.send_reg_reply( smgr, a, "reg_nack" )
+		return false
+	}
+
+	for _, oa := range ad.agents {
+		if oa != a && oa.registered && oa.agent_id == req.Agent_id {
+			am_sheep.Baa( 1, "WRN: agent %s registered on session %s is also registered on session %s  [TGUAGT011]", req.Agent_id, a.id, oa.id )
+		}
+	}
+
+	a.agent_id = req.Agent_id
+	a.vinfo = req.Vinfo
+	a.caps = req.Caps
+	a.hosts = req.Hosts
+	a.registered = true
+
+	am_sheep.Baa( 1, "agent registered: session=%s id=%s version=%s caps=%s hosts=%d", a.id, a.agent_id, a.vinfo, strings.Join( a.caps, "," ), len( a.hosts ) )
+	ad.send_reg_reply( smgr, a, "reg_ack" )
+	return true
+}
+
 //-------- request builders -----------------------------------------------------------------------------------------
 
+/*
+	Send the reply to a registration request (reg_ack or reg_nack).
+*/
+func (ad *agent_data) send_reg_reply( smgr agent_smgr, a *agent, ctype string ) {
+	msg := &agent_cmd{ Ctype: ctype }
+	jmsg, err := json.Marshal( msg )
+	if err == nil {
+		smgr.Write( a.id, jmsg )
+	}
+}
+
 /*
 	Build a request to have the agent generate a mac to phost list and send it to one agent.
 */
-func (ad *agent_data) send_mac2phost( smgr *connman.Cmgr, hlist *string ) {
+func (ad *agent_data) send_mac2phost( smgr agent_smgr, hlist *string ) {
 	if hlist == nil || *hlist == "" {
 		am_sheep.Baa( 2, "no host list, cannot request mac2phost" )
 		return
@@ -303,43 +434,46 @@ func (ad *agent_data) send_mac2phost( smgr *connman.Cmgr, hlist *string ) {
 	req_str += ` ] } ] }`
 */
 
-	msg := &agent_cmd{ Ctype: "action_list" }				// create command struct then convert to json
+	msg := &agent_cmd{ Ctype: "action_list" }				// create command struct; converted to json when routed
 	msg.Actions = make( []action, 1 )
 	msg.Actions[0].Atype = "map_mac2phost"
 	msg.Actions[0].Hosts = strings.Split( *hlist, " " )
-	jmsg, err := json.Marshal( msg )			// bundle into a json string
 
-	if err == nil {
-		am_sheep.Baa( 3, "sending mac2phost request: %s", jmsg )
-		ad.sendbytes2lra( smgr, jmsg )						// send as a long running request
-	} else {
-		am_sheep.Baa( 1, "WRN: unable to bundle mac2phost request into json: %s  [TGUAGT004]", err )
-		am_sheep.Baa( 2, "offending json: %s", jmsg )
+	am_sheep.Baa( 3, "sending mac2phost request: hosts=%s", *hlist )
+	ad.route( smgr, msg, true )							// send as a long running request to the agent(s) covering the hosts
+}
+
+/*
+	Build a request to have the agent(s) collect the lldp neighbours seen by each host.
+*/
+func (ad *agent_data) send_lldp( smgr agent_smgr, hlist *string ) {
+	if hlist == nil || *hlist == "" {
+		return
 	}
+
+	msg := &agent_cmd{ Ctype: "action_list" }
+	msg.Actions = []action{ { Atype: "lldp_neighbours", Hosts: strings.Fields( *hlist ) } }
+
+	am_sheep.Baa( 2, "sending lldp neighbour request: hosts=%s", *hlist )
+	ad.route( smgr, msg, true )							// long running; the agent contacts every host
 }
 
 /*
 	Build a request to cause the agent to drive the setting of queues and fmods on intermediate bridges.
 */
-func (ad *agent_data) send_intermedq( smgr *connman.Cmgr, hlist *string, dscp *string ) {
+func (ad *agent_data) send_intermedq( smgr agent_smgr, hlist *string, dscp *string ) {
 	if hlist == nil || *hlist == "" {
 		return
 	}
 
-	msg := &agent_cmd{ Ctype: "action_list" }				// create command struct then convert to json
+	msg := &agent_cmd{ Ctype: "action_list" }				// create command struct; converted to json when routed
 	msg.Actions = make( []action, 1 )
 	msg.Actions[0].Atype = "intermed_queues"
 	msg.Actions[0].Hosts = strings.Split( *hlist, " " )
 	msg.Actions[0].Dscps = *dscp
 
-	jmsg, err := json.Marshal( msg )			// bundle into a json string
-
-	if err == nil {
-		am_sheep.Baa( 1, "sending intermediate queue setup request: hosts=%s dscp=%s", *hlist, *dscp )
-		ad.sendbytes2lra( smgr, jmsg )						// send as a long running request
-	} else {
-		am_sheep.Baa( 0, "WRN: creating json intermedq command failed: %s  [TGUAGT005]", err )
-	}
+	am_sheep.Baa( 1, "sending intermediate queue setup request: hosts=%s dscp=%s", *hlist, *dscp )
+	ad.route( smgr, msg, true )							// send as a long running request to the agent(s) covering the hosts
 }
 
 // ---------------- utility ------------------------------------------------------------------------
@@ -363,6 +497,20 @@ func shift_values( list string ) ( new_list string ) {
 	return
 }
 
+/*
+	Return the registration and certificate id match settings given whether the agent listener
+	uses TLS and the register and match_id values from the config (empty if not given). With
+	TLS agent certificates are verified, so both default on. Plain agents predate registration
+	so it is required only when asked for, and there is never a certificate to match.
+*/
+func reg_defaults( is_tls bool, reg_cfg string, match_cfg string ) ( need_reg bool, match_id bool ) {
+	if is_tls {
+		return reg_cfg != "false", match_cfg != "false"
+	}
+
+	return reg_cfg == "true", false
+}
+
 // ---------------- main agent goroutine -----------------------------------------------------------
 
 func Agent_mgr( ach chan *ipc.Chmsg ) {
@@ -373,10 +521,22 @@ func Agent_mgr( ach chan *ipc.Chmsg ) {
 		dscp_list string = "46 26 18"				// list of dscp values that are used to promote a packet to the pri queue in intermed switches
 		refresh int64 = 60
 		iqrefresh int64 = 1800							// intermediate queue refresh (this can take a long time, keep from clogging the works)
+		cert_fname string = ""							// our certificate and key; if both given the listener uses TLS
+		key_fname string = ""
+		client_ca string = ""							// CA bundle(s) used to verify agent certificates
+		cert_refresh int = 60
+		reg_timeout int64 = 15							// seconds an agent has to register before being dropped
+		reg_cfg string = ""								// register/match_id from the config; defaults depend on TLS
+		match_cfg string = ""
+		lldp_refresh int64 = 0							// seconds between lldp neighbour requests; 0 == no discovery
+		smgr	agent_smgr
 	)
 
 	adata = &agent_data{}
 	adata.agents = make( map[string]*agent )
+	adata.outstanding = make( map[uint32]*outstanding )
+	adata.ack_timeout = DEF_ACK_TIMEOUT
+	adata.ack_retries = DEF_ACK_RETRIES
 
 	am_sheep = bleater.Mk_bleater( 0, os.Stderr )		// allocate our bleater and attach it to the master
 	am_sheep.Set_prefix( "agentmgr" )
@@ -400,6 +560,42 @@ func Agent_mgr( ach chan *ipc.Chmsg ) {
 				iqrefresh = 1800
 			}
 		}
+		if p := cfg_data["agent"]["cert"]; p != nil {
+			cert_fname = *p
+		}
+		if p := cfg_data["agent"]["key"]; p != nil {
+			key_fname = *p
+		}
+		if p := cfg_data["agent"]["client_ca"]; p != nil {
+			client_ca = *p
+		}
+		if p := cfg_data["agent"]["cert_refresh"]; p != nil {
+			cert_refresh = clike.Atoi( *p )
+		}
+		if p := cfg_data["agent"]["register"]; p != nil {
+			reg_cfg = *p
+		}
+		if p := cfg_data["agent"]["match_id"]; p != nil {
+			match_cfg = *p
+		}
+		if p := cfg_data["agent"]["ack_timeout"]; p != nil {
+			adata.ack_timeout = int64( clike.Atoi( *p ) )
+			if adata.ack_timeout < 5 {
+				adata.ack_timeout = 5
+			}
+		}
+		if p := cfg_data["agent"]["ack_retries"]; p != nil {
+			adata.ack_retries = clike.Atoi( *p )
+		}
+		if p := cfg_data["agent"]["lldp_refresh"]; p != nil {
+			lldp_refresh = int64( clike.Atoi( *p ) )
+		}
+		if p := cfg_data["agent"]["reg_timeout"]; p != nil {
+			reg_timeout = int64( clike.Atoi( *p ) )
+			if reg_timeout < 1 {
+				reg_timeout = 1
+			}
+		}
 	}
 	if cfg_data["default"] != nil {						// we pick some things from the default section too
 		if p := cfg_data["default"]["pri_dscp"]; p != nil {			// list of dscp (diffserv) values that match for priority promotion
@@ -419,9 +615,49 @@ func Agent_mgr( ach chan *ipc.Chmsg ) {
 	tklr.Add_spot( 10, ach, REQ_INTERMEDQ, nil, 1 );		  			// tickle once, very soon, to start an intermediate refresh asap
 	tklr.Add_spot( refresh, ach, REQ_MAC2PHOST, nil, ipc.FOREVER );  	// reocurring tickle to get host mapping
 	tklr.Add_spot( iqrefresh, ach, REQ_INTERMEDQ, nil, ipc.FOREVER );  	// reocurring tickle to ensure intermediate switches are properly set
+	tklr.Add_spot( 5, ach, REQ_AGENT_ACKCHK, nil, ipc.FOREVER );  		// resend actions that were not acknowledged in time
+	if lldp_refresh > 0 {
+		tklr.Add_spot( 20, ach, REQ_LLDP, nil, 1 );						// soon after start (once hosts are known), then periodically
+		tklr.Add_spot( lldp_refresh, ach, REQ_LLDP, nil, ipc.FOREVER );
+	}
 
 	sess_chan := make( chan *connman.Sess_data, 1024 )					// channel for comm from agents (buffers, disconns, etc)
-	smgr := connman.NewManager( port, sess_chan );
+	if cert_fname != "" && key_fname != "" {
+		client_auth := "require"				// agents are only trusted if their certificate is verified
+		if client_ca == "" {
+			am_sheep.Baa( 0, "CRI: agent listener is TLS, but no client_ca was given; agent certificates cannot be verified  [TGUAGT013]" )
+			os.Exit( 1 )
+		}
+
+		adata.need_reg, adata.match_id = reg_defaults( true, reg_cfg, match_cfg )
+
+		ts, err := mk_tls_store( cert_fname, key_fname, client_ca )
+		var tcfg *tls.Config
+		if err == nil {
+			ts.sheep = am_sheep
+			tcfg, err = ts.Server_config( client_auth )
+		}
+		if err == nil {
+			smgr, err = mk_tls_smgr( port, tcfg, sess_chan )
+		}
+		if err != nil {
+			am_sheep.Baa( 0, "CRI: unable to start TLS listener for agents: %s  [TGUAGT014]", err )
+			os.Exit( 1 )
+		}
+
+		go ts.watch( cert_refresh )
+		am_sheep.Baa( 1, "agent connections use TLS; client certificates %s", client_auth )
+	} else {
+		adata.need_reg, adata.match_id = reg_defaults( false, reg_cfg, match_cfg )
+		if match_cfg == "true" {
+			am_sheep.Baa( 0, "WRN: match_id ignored; agent listener is not TLS so there is no certificate to match  [TGUAGT020]" )
+		}
+		am_sheep.Baa( 1, "WRN: agent connections are not encrypted or authenticated; configure cert, key and client_ca to secure them  [TGUAGT021]" )
+		smgr = connman.NewManager( port, sess_chan );
+	}
+	if adata.need_reg {
+		am_sheep.Baa( 1, "agents must register within %d seconds of connecting", reg_timeout )
+	}
 
 
 	for {
@@ -439,19 +675,28 @@ func Agent_mgr( ach chan *ipc.Chmsg ) {
 							adata.send2all( smgr,  req.Req_data.( string ) )
 						}
 
-					case REQ_SENDLONG:					// send a long request to one agent
+					case REQ_SENDLONG:					// send a long request to the agent(s) able to handle it
 						if req.Req_data != nil {
-							adata.send2one( smgr,  req.Req_data.( string ) )
+							adata.route_json( smgr,  req.Req_data.( string ), true )
 						}
 
-					case REQ_SENDSHORT:					// send a short request to one agent (round robin)
+					case REQ_SENDSHORT:					// send a short request to the agent(s) able to handle it (round robin when several can)
 						if req.Req_data != nil {
-							adata.send2one( smgr,  req.Req_data.( string ) )
+							adata.route_json( smgr,  req.Req_data.( string ), false )
 						}
 
 					case REQ_MAC2PHOST:					// send a request for agent to generate  mac to phost map
+						if hl, ok := req.Req_data.( *string ); ok && hl != nil {		// southbound driver asked for specific hosts
+							adata.send_mac2phost( smgr, hl )
+						} else {
+							if host_list != "" {
+								adata.send_mac2phost( smgr, &host_list )
+							}
+						}
+
+					case REQ_LLDP:						// request lldp neighbours for topology discovery
 						if host_list != "" {
-							adata.send_mac2phost( smgr, &host_list )
+							adata.send_lldp( smgr, &host_list )
 						}
 
 					case REQ_CHOSTLIST:					// a host list from fq-manager
@@ -461,8 +706,25 @@ func Agent_mgr( ach chan *ipc.Chmsg ) {
 
 					case REQ_INTERMEDQ:
 						req.Response_ch = nil
-						if host_list != "" {
-							adata.send_intermedq( smgr, &host_list, &dscp_list )
+						if hl, ok := req.Req_data.( *string ); ok && hl != nil {
+							adata.send_intermedq( smgr, hl, &dscp_list )
+						} else {
+							if host_list != "" {
+								adata.send_intermedq( smgr, &host_list, &dscp_list )
+							}
+						}
+
+					case REQ_AGENT_ACKCHK:
+						req.Response_ch = nil
+						adata.check_timeouts( smgr )
+
+					case REQ_AGENT_REGCHK:				// tickle after a connection; drop the agent if it has not registered
+						req.Response_ch = nil
+						if id, ok := req.Req_data.( string ); ok {
+							if a := adata.agents[id]; a != nil && ! a.registered {
+								am_sheep.Baa( 0, "ERR: agent session %s did not register within %d seconds; session closed  [TGUAGT012]", id, reg_timeout )
+								smgr.Close( id )
+							}
 						}
 
 				}
@@ -480,19 +742,25 @@ func Agent_mgr( ach chan *ipc.Chmsg ) {
 					case connman.ST_NEW:			// new connection
 						a := adata.Mk_agent( sreq.Id )
 						am_sheep.Baa( 1, "new agent: %s [%s]", a.id, sreq.Data )
-						if host_list != "" {											// immediate request for this
-							adata.send_mac2phost( smgr, &host_list )
-							adata.send_intermedq( smgr, &host_list, &dscp_list )
+						if adata.need_reg {
+							tklr.Add_spot( reg_timeout, ach, REQ_AGENT_REGCHK, sreq.Id, 1 )		// nothing sent until it registers
+						} else {
+							if host_list != "" {											// immediate request for this
+								adata.send_mac2phost( smgr, &host_list )
+								adata.send_intermedq( smgr, &host_list, &dscp_list )
+							}
 						}
 
 					case connman.ST_DISC:
 						am_sheep.Baa( 1, "agent dropped: %s", sreq.Id )
-						if _, not_nil := adata.agents[sreq.Id]; not_nil {
+						if a, not_nil := adata.agents[sreq.Id]; not_nil {
 							delete( adata.agents, sreq.Id )
+							adata.build_list()			// rebuild the list to drop the agent; its hosts fail over to any other agent covering them
+							adata.agent_lost( smgr, a )	// resend anything it had not acknowledged
 						} else {
 							am_sheep.Baa( 1, "did not find an agent with the id: %s", sreq.Id )
+							adata.build_list()
 						}
-						adata.build_list()			// rebuild the list to drop the agent
 
 					case connman.ST_DATA:
 						if _, not_nil := adata.agents[sreq.Id]; not_nil {
@@ -501,7 +769,13 @@ func Agent_mgr( ach chan *ipc.Chmsg ) {
 								cval = len( sreq.Buf )
 							}
 							am_sheep.Baa( 2, "data: [%s]  %d bytes received:  first 100b: %s", sreq.Id, len( sreq.Buf ), sreq.Buf[0:cval] )
-							adata.agents[sreq.Id].process_input( sreq.Buf )
+							if adata.agents[sreq.Id].process_input( sreq.Buf, adata, smgr ) {		// newly registered
+								adata.release_held( smgr )
+								if host_list != "" {										// immediate requests
+									adata.send_mac2phost( smgr, &host_list )
+									adata.send_intermedq( smgr, &host_list, &dscp_list )
+								}
+							}
 						} else {
 							am_sheep.Baa( 1, "data from unknown agent: [%s]  %d bytes ignored:  %s", sreq.Id, len( sreq.Buf ), sreq.Buf )
 						}
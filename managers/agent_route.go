@@ -0,0 +1,388 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	agent_route
+	Abstract:	Functions which route agent actions to the agent(s) able to execute them.
+				At registration each agent supplies the action types it supports and the
+				physical hosts it can reach (an empty list means all hosts; entries may be
+				shell style patterns such as site1-*). Each action is split by host and the
+				pieces sent to an agent which covers the host. Agents that list a host
+				explicitly are preferred over agents that cover everything.
+
+				Because routing is done against the current list of registered agents, a
+				host covered by more than one agent fails over to the remaining agent(s) when
+				one disconnects.  Actions that cannot be placed are held and routed again when
+				the next agent registers. Flow-mod timeouts in a held action are relative to
+				when it was built, so they are reduced by the time held before the action is
+				routed again, and actions whose flow-mods would already have expired are dropped.
+
+	Date:		18 Oct 2026
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/att/gopkgs/clike"
+)
+
+const (
+	MAX_HELD	int = 1024			// max actions held waiting for an agent that can handle them
+)
+
+/*
+	An action that could not be given to any agent.
+*/
+type held_action struct {
+	act		action
+	long	bool
+	key		string					// json of the action; used to prevent holding duplicates
+	when	int64					// time the action was held
+}
+
+var held_to_re = regexp.MustCompile( `(^|\s)-t\s+([0-9]+)` )		// flow-mod timeout option in action fdata
+
+/*
+	Return the host name without any domain.
+*/
+func short_host( host string ) ( string ) {
+	if i := strings.Index( host, "." ); i > 0 {
+		return host[0:i]
+	}
+
+	return host
+}
+
+/*
+	Returns true if the agent claims to reach the host. An agent that registered no
+	hosts covers every host.
+*/
+func (a *agent) covers( host string ) ( bool ) {
+	if len( a.hosts ) == 0 {
+		return true
+	}
+
+	sh := short_host( host )
+	for _, h := range a.hosts {
+		if h == host || h == sh {
+			return true
+		}
+		if m, err := path.Match( h, host ); err == nil && m {
+			return true
+		}
+		if m, err := path.Match( h, sh ); err == nil && m {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+	Returns true if the agent supports the action type. An agent that did not
+	register capabilities (registration disabled) is assumed to support everything.
+*/
+func (a *agent) supports( atype string ) ( bool ) {
+	if len( a.caps ) == 0 {
+		return true
+	}
+
+	for _, c := range a.caps {
+		if c == atype {
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+	Select an agent to handle the action type for the host (host may be empty). Agents
+	which list the host explicitly are preferred to those which cover all hosts. If any
+	agent in prev is a candidate it is used so that a multi-host action is split across as
+	few agents as possible. Long requests go to the long running agent if it is a candidate;
+	short requests are round robined over the candidates skipping the long running agent if
+	there are others. Agents whose session id is in skip (may be nil) are not considered.
+	Returns nil if no agent can handle the action.
+*/
+func (ad *agent_data) select_agent( atype string, host string, prev []*agent, long bool, skip map[string]bool ) ( *agent ) {
+	var (
+		specific	[]*agent
+		general		[]*agent
+	)
+
+	for _, a := range ad.agent_list {
+		if ! a.supports( atype ) || skip[a.id] {
+			continue
+		}
+
+		if host == "" || len( a.hosts ) == 0 {
+			general = append( general, a )
+		} else {
+			if a.covers( host ) {
+				specific = append( specific, a )
+			}
+		}
+	}
+
+	cands := specific
+	if len( cands ) == 0 {
+		cands = general
+	}
+	if len( cands ) == 0 {
+		return nil
+	}
+
+	for _, p := range prev {
+		for _, c := range cands {
+			if c == p {
+				return p
+			}
+		}
+	}
+
+	lra := ad.agent_list[0]
+	if long {
+		for _, c := range cands {
+			if c == lra {
+				return lra
+			}
+		}
+	} else {
+		if len( cands ) > 1 {
+			others := make( []*agent, 0, len( cands ) )
+			for _, c := range cands {
+				if c != lra {
+					others = append( others, c )
+				}
+			}
+			cands = others
+		}
+	}
+
+	a := cands[ad.aidx % len( cands )]
+	ad.aidx++
+	if ad.aidx < 0 {
+		ad.aidx = 0
+	}
+	return a
+}
+
+/*
+	Hold an action until an agent which can handle it registers. Duplicates of an action
+	already held are dropped, and when the list is full the oldest action is discarded.
+*/
+func (ad *agent_data) hold( act action, long bool ) {
+	jact, _ := json.Marshal( act )
+	key := string( jact )
+	for i := range ad.held {
+		if ad.held[i].key == key {
+			return
+		}
+	}
+
+	am_sheep.Baa( 1, "WRN: no connected agent can handle %s for hosts: %s; held until an agent registers  [TGUAGT015]", act.Atype, strings.Join( act.Hosts, " " ) )
+	if len( ad.held ) >= MAX_HELD {
+		am_sheep.Baa( 1, "WRN: too many held agent actions; oldest (%s) discarded  [TGUAGT016]", ad.held[0].act.Atype )
+		ad.held = ad.held[1:]
+	}
+
+	ad.held = append( ad.held, &held_action{ act: act, long: long, key: key, when: time.Now().Unix() } )
+}
+
+/*
+	Return a copy of the held action with its flow-mod timeouts reduced by the number of
+	seconds it was held. False is returned if the action is stale: a timeout would be used
+	up, or the expiry of flow-mods without a hard timeout has passed. Fdata commands which
+	are stale are dropped from the action; the action is stale if none are left. A timeout
+	of 0 (never) is left alone.
+*/
+func held_refresh( act action, secs int64 ) ( action, bool ) {
+	if act.Data != nil {
+		if e := clike.Atoi64( act.Data["expiry"] ); e > 0 && e <= time.Now().Unix() {
+			return act, false
+		}
+
+		if t := clike.Atoi64( act.Data["timeout"] ); t > 0 {
+			if t -= secs; t <= 0 {
+				return act, false
+			}
+
+			nd := make( map[string]string, len( act.Data ) )
+			for k, v := range act.Data {
+				nd[k] = v
+			}
+			nd["timeout"] = fmt.Sprintf( "%d", t )
+			act.Data = nd
+		}
+	}
+
+	if len( act.Fdata ) > 0 {
+		nf := make( []string, 0, len( act.Fdata ) )
+		for _, f := range act.Fdata {
+			stale := false
+			f = held_to_re.ReplaceAllStringFunc( f, func( m string ) ( string ) {
+				sm := held_to_re.FindStringSubmatch( m )
+				t := clike.Atoi64( sm[2] )
+				if t == 0 {
+					return m
+				}
+				if t -= secs; t <= 0 {
+					stale = true
+					return m
+				}
+				return fmt.Sprintf( "%s-t %d", sm[1], t )
+			} )
+
+			if ! stale {
+				nf = append( nf, f )
+			}
+		}
+
+		if len( nf ) == 0 {
+			return act, false
+		}
+		act.Fdata = nf
+	}
+
+	return act, true
+}
+
+/*
+	Route all held actions again; called after an agent registers. Timeouts are adjusted
+	for the time each action was held, and actions which have gone stale are discarded.
+	Those that still cannot be placed are held again.
+*/
+func (ad *agent_data) release_held( smgr agent_smgr ) {
+	if len( ad.held ) == 0 {
+		return
+	}
+
+	hlist := ad.held
+	ad.held = nil
+	am_sheep.Baa( 1, "routing %d held agent actions", len( hlist ) )
+	now := time.Now().Unix()
+	for _, h := range hlist {
+		act, ok := held_refresh( h.act, now - h.when )
+		if ! ok {
+			am_sheep.Baa( 1, "held %s action for hosts %s expired while waiting for an agent; discarded", h.act.Atype, strings.Join( h.act.Hosts, " " ) )
+			continue
+		}
+
+		ad.route( smgr, &agent_cmd{ Ctype: "action_list", Actions: []action{ act } }, h.long )
+	}
+}
+
+/*
+	Send each action in the command to the agent(s) able to handle it. Actions with
+	hosts are split by host; actions without hosts go to any agent supporting the action
+	type. All of the pieces destined for the same agent are sent as one command. Actions
+	associated with a reservation are added to the outstanding table (agent_track.go).
+*/
+func (ad *agent_data) route( smgr agent_smgr, cmd *agent_cmd, long bool ) {
+	per_agent := make( map[*agent]*agent_cmd )
+	order := make( []*agent, 0, 4 )							// preserve the order agents were selected
+
+	add := func( a *agent, act action ) {
+		if act.Rname != "" {
+			act.Aid = ad.track( a, act, long )
+		}
+		if per_agent[a] == nil {
+			per_agent[a] = &agent_cmd{ Ctype: cmd.Ctype }
+			order = append( order, a )
+		}
+		per_agent[a].Actions = append( per_agent[a].Actions, act )
+	}
+
+	for _, act := range cmd.Actions {
+		if len( act.Hosts ) == 0 {
+			if a := ad.select_agent( act.Atype, "", nil, long, nil ); a != nil {
+				add( a, act )
+			} else {
+				ad.hold( act, long )
+			}
+			continue
+		}
+
+		split := make( map[*agent][]string )
+		chosen := make( []*agent, 0, 4 )
+		unplaced := make( []string, 0 )
+		for _, h := range act.Hosts {
+			a := ad.select_agent( act.Atype, h, chosen, long, nil )
+			if a == nil {
+				unplaced = append( unplaced, h )
+				continue
+			}
+
+			if _, ok := split[a]; ! ok {
+				chosen = append( chosen, a )
+			}
+			split[a] = append( split[a], h )
+		}
+
+		for _, a := range chosen {
+			na := act
+			na.Hosts = split[a]
+			add( a, na )
+		}
+		if len( unplaced ) > 0 {
+			na := act
+			na.Hosts = unplaced
+			ad.hold( na, long )
+		}
+	}
+
+	for _, a := range order {
+		jmsg, err := json.Marshal( per_agent[a] )
+		if err != nil {
+			am_sheep.Baa( 0, "ERR: unable to build json for agent %s: %s  [TGUAGT017]", a.agent_id, err )
+			continue
+		}
+
+		am_sheep.Baa( 2, "sending %d action(s) to agent %s (%s)", len( per_agent[a].Actions ), a.id, a.agent_id )
+		smgr.Write( a.id, jmsg )
+	}
+}
+
+/*
+	Route a json command string which was built by another manager. If the string cannot
+	be unpacked as an action list it is sent, as is, to one agent.
+*/
+func (ad *agent_data) route_json( smgr agent_smgr, msg string, long bool ) {
+	cmd := &agent_cmd{}
+	err := json.Unmarshal( []byte( msg ), cmd )
+	if err != nil || cmd.Ctype != "action_list" {
+		am_sheep.Baa( 2, "agent command could not be routed, sent to one agent: %s", msg )
+		if long {
+			ad.send2lra( smgr, msg )
+		} else {
+			ad.send2one( smgr, msg )
+		}
+		return
+	}
+
+	ad.route( smgr, cmd, long )
+}
@@ -0,0 +1,274 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	agent_test
+	Abstract:	Tests for the agent manager: registration defaults, the handling of
+				registration requests, and routing (including the replay of held actions).
+				A fake session manager records what would have been written to, or closed
+				on, each session.
+	Date:		19 Oct 2026
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/att/gopkgs/bleater"
+)
+
+/*
+	Session manager which records writes and closes rather than sending anything.
+*/
+type fake_smgr struct {
+	writes	map[string][]string
+	closed	map[string]bool
+}
+
+func mk_fake_smgr( ) ( *fake_smgr ) {
+	return &fake_smgr{ writes: make( map[string][]string ), closed: make( map[string]bool ) }
+}
+
+func (fs *fake_smgr) Write( id string, buf []byte ) {
+	fs.writes[id] = append( fs.writes[id], string( buf ) )
+}
+
+func (fs *fake_smgr) Close( id string ) {
+	fs.closed[id] = true
+}
+
+/*
+	Build agent data as Agent_mgr does.
+*/
+func mk_test_adata( need_reg bool, match_id bool ) ( *agent_data ) {
+	if am_sheep == nil {
+		am_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	}
+
+	ad := &agent_data{ need_reg: need_reg, match_id: match_id }
+	ad.agents = make( map[string]*agent )
+	return ad
+}
+
+func Test_reg_defaults( t *testing.T ) {
+	type rd_test struct {
+		tls		bool
+		reg		string
+		match	string
+		ereg	bool
+		ematch	bool
+	}
+
+	fmt.Fprintf( os.Stderr, "\n------- agent registration defaults ----\n" )
+	tests := []rd_test {
+		{ true, "", "", true, true },				// tls: both on unless turned off
+		{ true, "false", "", false, true },
+		{ true, "", "false", true, false },
+		{ false, "", "", false, false },			// plain: registration only when asked; never a certificate to match
+		{ false, "true", "", true, false },
+		{ false, "true", "true", true, false },
+		{ false, "false", "false", false, false },
+	}
+
+	for _, rt := range tests {
+		reg, match := reg_defaults( rt.tls, rt.reg, rt.match )
+		if reg != rt.ereg || match != rt.ematch {
+			fmt.Fprintf( os.Stderr, "FAIL: tls=%v register=%q match_id=%q gave need_reg=%v match_id=%v; expected %v %v\n", rt.tls, rt.reg, rt.match, reg, match, rt.ereg, rt.ematch )
+			t.Fail()
+		}
+	}
+}
+
+func Test_register( t *testing.T ) {
+	fmt.Fprintf( os.Stderr, "\n------- agent registration -------------\n" )
+	sm := mk_fake_smgr()
+
+	ad := mk_test_adata( true, false )
+	a := ad.Mk_agent( "s1" )
+	if len( ad.agent_list ) != 0 {
+		fmt.Fprintf( os.Stderr, "FAIL: unregistered agent is in the agent list\n" )
+		t.Fail()
+	}
+
+	if ad.register( a, &agent_msg{ Ctype: "register" }, sm ) {
+		fmt.Fprintf( os.Stderr, "FAIL: registration without an agent id accepted\n" )
+		t.Fail()
+	}
+	if a.registered || len( sm.writes["s1"] ) != 1 || ! strings.Contains( sm.writes["s1"][0], "reg_nack" ) {
+		fmt.Fprintf( os.Stderr, "FAIL: rejected registration not nacked: %v\n", sm.writes["s1"] )
+		t.Fail()
+	}
+
+	req := &agent_msg{ Ctype: "register", Agent_id: "agent-1", Vinfo: "v2", Caps: []string{ "bw_fmod", "setqueues" }, Hosts: []string{ "cn1", "cn2" } }
+	if ! ad.register( a, req, sm ) {
+		fmt.Fprintf( os.Stderr, "FAIL: registration with an agent id rejected\n" )
+		t.FailNow()
+	}
+	ad.build_list()
+	if ! a.registered || a.agent_id != "agent-1" || len( a.caps ) != 2 || len( a.hosts ) != 2 || len( ad.agent_list ) != 1 {
+		fmt.Fprintf( os.Stderr, "FAIL: registration details not recorded: %+v\n", a )
+		t.Fail()
+	}
+	if n := len( sm.writes["s1"] ); n != 2 || ! strings.Contains( sm.writes["s1"][1], "reg_ack" ) {
+		fmt.Fprintf( os.Stderr, "FAIL: accepted registration not acked: %v\n", sm.writes["s1"] )
+		t.Fail()
+	}
+
+	ad = mk_test_adata( true, true )				// id must match the certificate; a plain session has none
+	a = ad.Mk_agent( "s2" )
+	if ad.register( a, req, sm ) || a.registered {
+		fmt.Fprintf( os.Stderr, "FAIL: registration accepted without a certificate to match the id\n" )
+		t.Fail()
+	}
+}
+
+/*
+	Add a registered agent with the capabilities and hosts given.
+*/
+func add_test_agent( ad *agent_data, id string, caps []string, hosts []string ) ( *agent ) {
+	a := ad.Mk_agent( id )
+	a.agent_id = id
+	a.caps = caps
+	a.hosts = hosts
+	a.registered = true
+	ad.build_list()
+	return a
+}
+
+/*
+	Unpack everything written to the session and return the actions.
+*/
+func sent_actions( fs *fake_smgr, id string ) ( al []action ) {
+	for _, w := range fs.writes[id] {
+		cmd := &agent_cmd{}
+		if json.Unmarshal( []byte( w ), cmd ) == nil {
+			al = append( al, cmd.Actions... )
+		}
+	}
+	return al
+}
+
+func Test_route( t *testing.T ) {
+	fmt.Fprintf( os.Stderr, "\n------- agent action routing -----------\n" )
+	sm := mk_fake_smgr()
+	ad := mk_test_adata( true, false )
+	a1 := add_test_agent( ad, "s1", []string{ "bw_fmod" }, []string{ "cn1", "site2-*" } )
+
+	if ! a1.covers( "cn1.example.com" ) || ! a1.covers( "site2-cn9" ) || a1.covers( "cn2" ) {
+		fmt.Fprintf( os.Stderr, "FAIL: host coverage by name or pattern is wrong\n" )
+		t.Fail()
+	}
+	if ! a1.supports( "bw_fmod" ) || a1.supports( "setqueues" ) {
+		fmt.Fprintf( os.Stderr, "FAIL: capabilities not honoured\n" )
+		t.Fail()
+	}
+
+	act := action{ Atype: "bw_fmod", Hosts: []string{ "cn1", "cn2", "site2-a" }, Data: map[string]string{ "timeout": "600" } }
+	ad.route( sm, &agent_cmd{ Ctype: "action_list", Actions: []action{ act } }, false )
+	al := sent_actions( sm, "s1" )
+	if len( al ) != 1 || strings.Join( al[0].Hosts, " " ) != "cn1 site2-a" {
+		fmt.Fprintf( os.Stderr, "FAIL: covered hosts were not sent to the agent as one action: %v\n", al )
+		t.Fail()
+	}
+	if len( ad.held ) != 1 || strings.Join( ad.held[0].act.Hosts, " " ) != "cn2" {
+		fmt.Fprintf( os.Stderr, "FAIL: uncovered host was not held\n" )
+		t.FailNow()
+	}
+
+	ad.route( sm, &agent_cmd{ Ctype: "action_list", Actions: []action{ act } }, false )
+	if len( ad.held ) != 1 {
+		fmt.Fprintf( os.Stderr, "FAIL: duplicate action held twice\n" )
+		t.Fail()
+	}
+
+	a2 := add_test_agent( ad, "s2", nil, []string{ "cn2" } )			// no caps: supports everything
+	ad.release_held( sm )
+	al = sent_actions( sm, a2.id )
+	if len( al ) != 1 || al[0].Hosts[0] != "cn2" || len( ad.held ) != 0 {
+		fmt.Fprintf( os.Stderr, "FAIL: held action not routed to the new agent: %v held=%d\n", al, len( ad.held ) )
+		t.Fail()
+	}
+}
+
+func Test_held_replay( t *testing.T ) {
+	fmt.Fprintf( os.Stderr, "\n------- held action replay -------------\n" )
+	sm := mk_fake_smgr()
+	ad := mk_test_adata( true, false )
+
+	acts := []action {
+		{ Atype: "bw_fmod", Hosts: []string{ "cn1" }, Data: map[string]string{ "timeout": "600", "id": "keep" } },
+		{ Atype: "bw_fmod", Hosts: []string{ "cn1" }, Data: map[string]string{ "timeout": "60", "id": "short" } },
+		{ Atype: "bw_fmod", Hosts: []string{ "cn1" }, Data: map[string]string{ "timeout": "0", "expiry": "1", "id": "expired" } },
+		{ Atype: "bw_fmod", Hosts: []string{ "cn1" }, Data: map[string]string{ "timeout": "0", "id": "forever" } },
+		{ Atype: "flowmod", Hosts: []string{ "cn1" }, Fdata: []string{ "-T 90 -t 300 -p 400 --match -s 1.2.3.4 add 0xe5d cn1", "-t 30 -p 1 add 0xe5d cn1" } },
+	}
+	ad.route( sm, &agent_cmd{ Ctype: "action_list", Actions: acts }, false )
+	if len( ad.held ) != len( acts ) {
+		fmt.Fprintf( os.Stderr, "FAIL: expected %d held actions, have %d\n", len( acts ), len( ad.held ) )
+		t.FailNow()
+	}
+	for _, h := range ad.held {
+		h.when -= 100											// as if held for 100 seconds
+	}
+
+	add_test_agent( ad, "s1", nil, nil )
+	ad.release_held( sm )
+
+	ids := make( map[string]action )
+	var fmod *action
+	for _, a := range sent_actions( sm, "s1" ) {
+		if a.Atype == "flowmod" {
+			na := a
+			fmod = &na
+		} else {
+			ids[a.Data["id"]] = a
+		}
+	}
+
+	if a, ok := ids["keep"]; ! ok || a.Data["timeout"] != "500" {
+		fmt.Fprintf( os.Stderr, "FAIL: timeout of replayed action not reduced by time held: %v\n", a.Data )
+		t.Fail()
+	}
+	if a, ok := ids["forever"]; ! ok || a.Data["timeout"] != "0" {
+		fmt.Fprintf( os.Stderr, "FAIL: action without a timeout changed or dropped: %v\n", a.Data )
+		t.Fail()
+	}
+	if _, ok := ids["short"]; ok {
+		fmt.Fprintf( os.Stderr, "FAIL: action whose timeout passed while held was replayed\n" )
+		t.Fail()
+	}
+	if _, ok := ids["expired"]; ok {
+		fmt.Fprintf( os.Stderr, "FAIL: action whose expiry passed while held was replayed\n" )
+		t.Fail()
+	}
+	if fmod == nil || len( fmod.Fdata ) != 1 || ! strings.HasPrefix( fmod.Fdata[0], "-T 90 -t 200 -p 400 " ) {
+		fmt.Fprintf( os.Stderr, "FAIL: flow-mod commands not adjusted or stale command kept: %v\n", fmod )
+		t.Fail()
+	}
+
+	if acts[0].Data["timeout"] != "600" {
+		fmt.Fprintf( os.Stderr, "FAIL: replay changed the original action data\n" )
+		t.Fail()
+	}
+}
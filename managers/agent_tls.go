@@ -0,0 +1,212 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	agent_tls
+	Abstract:	A small session manager which accepts TLS connections from agents. It
+				mimics the parts of connman that the agent manager uses: session events
+				(new, data, disconnect) are pushed onto the same channel as connman
+				sessions would be, and Write()/Close() operate on a session id. This
+				allows the agent manager to use either a plain connman listener or a
+				TLS listener without caring which.
+
+				The listener always requires verified client certificates; the names
+				(CN and SANs) from the certificate are kept with the session and are
+				available to the agent manager via Peer_names().
+
+	Date:		18 Oct 2026
+*/
+
+package managers
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/att/gopkgs/connman"
+)
+
+/*
+	The interface that the agent manager needs from a session manager. Both
+	connman.Cmgr and tls_smgr satisfy it.
+*/
+type agent_smgr interface {
+	Write( id string, buf []byte )
+	Close( id string )
+}
+
+const (
+	TLS_HS_TIMEOUT time.Duration = 10 * time.Second		// time a peer has to complete the handshake
+)
+
+type tls_sess struct {
+	conn	*tls.Conn
+	names	[]string				// names from the peer's verified certificate
+}
+
+type tls_smgr struct {
+	mu			sync.Mutex
+	sessions	map[string]*tls_sess
+	sess_ch		chan *connman.Sess_data
+	lsnr		net.Listener
+	nsess		int							// used to generate session ids
+}
+
+/*
+	Create a session manager listening on the given port (or host:port) and start
+	the goroutine which accepts connections.
+*/
+func mk_tls_smgr( port string, cfg *tls.Config, sess_ch chan *connman.Sess_data ) ( sm *tls_smgr, err error ) {
+	addr := port
+	if ! strings.Contains( addr, ":" ) {
+		addr = ":" + port
+	}
+
+	sm = &tls_smgr {
+		sessions:	make( map[string]*tls_sess ),
+		sess_ch:	sess_ch,
+	}
+
+	sm.lsnr, err = tls.Listen( "tcp", addr, cfg )
+	if err != nil {
+		return nil, err
+	}
+
+	go sm.listen( )
+	return sm, nil
+}
+
+/*
+	Accept connections, starting a reader for each, until the listener is closed or
+	fails with a permanent error. Temporary errors (e.g. out of file descriptors)
+	are retried after a short pause.
+*/
+func (sm *tls_smgr) listen( ) {
+	for {
+		conn, err := sm.lsnr.Accept( )
+		if err != nil {
+			if ne, ok := err.( net.Error ); ok && ne.Temporary() {
+				am_sheep.Baa( 1, "WRN: agent tls listener: accept failed, will retry: %s  [TGUAGT007]", err )
+				time.Sleep( 100 * time.Millisecond )
+				continue
+			}
+
+			am_sheep.Baa( 0, "ERR: agent tls listener: accept failed, listener stopped: %s  [TGUAGT007]", err )
+			return
+		}
+
+		sm.mu.Lock()
+		sm.nsess++
+		id := fmt.Sprintf( "t%d", sm.nsess )
+		sm.mu.Unlock()
+
+		go sm.reader( id, conn.( *tls.Conn ) )
+	}
+}
+
+/*
+	Complete the handshake, then read from the session sending each buffer to the
+	session channel until the session is closed. A peer which does not complete the
+	handshake within TLS_HS_TIMEOUT is dropped.
+*/
+func (sm *tls_smgr) reader( id string, conn *tls.Conn ) {
+	conn.SetDeadline( time.Now().Add( TLS_HS_TIMEOUT ) )
+	if err := conn.Handshake( ); err != nil {
+		am_sheep.Baa( 1, "WRN: agent tls handshake failed from %s: %s  [TGUAGT008]", conn.RemoteAddr(), err )
+		conn.Close( )
+		return
+	}
+	conn.SetDeadline( time.Time{} )						// no deadline once established
+
+	s := &tls_sess{ conn: conn }
+	cs := conn.ConnectionState()
+	if len( cs.VerifiedChains ) > 0 {
+		leaf := cs.VerifiedChains[0][0]
+		s.names = append( []string{ leaf.Subject.CommonName }, leaf.DNSNames... )
+	}
+
+	sm.mu.Lock()
+	sm.sessions[id] = s
+	sm.mu.Unlock()
+
+	sm.sess_ch <- &connman.Sess_data{ Id: id, State: connman.ST_NEW, Data: conn.RemoteAddr().String() }
+
+	for {
+		buf := make( []byte, 4096 )
+		n, err := conn.Read( buf )
+		if n > 0 {
+			sm.sess_ch <- &connman.Sess_data{ Id: id, State: connman.ST_DATA, Buf: buf[0:n] }
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	sm.mu.Lock()
+	delete( sm.sessions, id )
+	sm.mu.Unlock()
+	conn.Close( )
+
+	sm.sess_ch <- &connman.Sess_data{ Id: id, State: connman.ST_DISC }
+}
+
+/*
+	Write the buffer to the session. Errors are ignored; the reader will notice
+	a broken session and report the disconnect.
+*/
+func (sm *tls_smgr) Write( id string, buf []byte ) {
+	sm.mu.Lock()
+	s := sm.sessions[id]
+	sm.mu.Unlock()
+
+	if s != nil {
+		s.conn.Write( buf )
+	}
+}
+
+/*
+	Close the session. The reader will send the disconnect event.
+*/
+func (sm *tls_smgr) Close( id string ) {
+	sm.mu.Lock()
+	s := sm.sessions[id]
+	sm.mu.Unlock()
+
+	if s != nil {
+		s.conn.Close( )
+	}
+}
+
+/*
+	Return the names from the peer's verified certificate, or nil if the peer
+	did not present one.
+*/
+func (sm *tls_smgr) Peer_names( id string ) ( []string ) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if s := sm.sessions[id]; s != nil {
+		return s.names
+	}
+	return nil
+}
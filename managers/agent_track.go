@@ -0,0 +1,201 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	agent_track
+	Abstract:	Tracking of outstanding agent actions. Actions which are associated with a
+				reservation (Rname is set; bandwidth, oneway and passthru flow-mods) are given
+				a unique action id (Aid) and kept in the outstanding table until the agent
+				responds. A failure response, a timeout, or the loss of the agent causes the
+				action to be resent, to a different agent if one covers the host, until the
+				retry limit is reached.
+
+				The final result for each action is sent to res_mgr (REQ_PUSH_ACK) which uses
+				them to decide when the pledge has really been pushed, or that it must be
+				pushed again. Each result carries the push generation given to the request
+				by res_mgr so that a late result from an earlier push is not counted
+				against the current one. Fq_mgr uses the same message to acknowledge
+				requests which are not sent to an agent (see sb_push).
+
+	Date:		18 Oct 2026
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/att/gopkgs/ipc"
+)
+
+const (
+	DEF_ACK_TIMEOUT	int64 = 45		// seconds we wait on a response from an agent before resending
+	DEF_ACK_RETRIES	int = 2			// number of times an action is resent before failing it
+)
+
+/*
+	An action sent to an agent for which we expect a response.
+*/
+type outstanding struct {
+	act			action				// the action as sent (Aid set)
+	long		bool
+	agent		*agent				// the agent it was last sent to
+	tried		map[string]bool		// session ids of agents that have been tried
+	tries		int					// number of resends
+	deadline	int64				// time we give up waiting on the current agent
+}
+
+/*
+	Final result for an action sent to res_mgr.
+*/
+type push_ack struct {
+	id		*string					// reservation name
+	host	string
+	gen		uint32					// push generation the action was sent for
+	ok		bool
+	local	bool					// result determined by fq_mgr without reaching an agent; a failure waits for the next push cycle
+}
+
+/*
+	Assign an action id to the action and add it to the outstanding table. Returns
+	the action id that should be placed into the action sent to the agent.
+*/
+func (ad *agent_data) track( a *agent, act action, long bool ) ( uint32 ) {
+	ad.next_aid++
+	if ad.next_aid == 0 {						// zero means untracked; skip it on wrap
+		ad.next_aid++
+	}
+	act.Aid = ad.next_aid
+
+	ad.outstanding[act.Aid] = &outstanding {
+		act:		act,
+		long:		long,
+		agent:		a,
+		tried:		map[string]bool{ a.id: true },
+		deadline:	time.Now().Unix() + ad.ack_timeout,
+	}
+
+	return act.Aid
+}
+
+/*
+	Send the result of an action to res_mgr.
+*/
+func send_push_ack( o *outstanding, ok bool ) {
+	name := o.act.Rname
+	host := ""
+	if len( o.act.Hosts ) > 0 {
+		host = o.act.Hosts[0]
+	}
+
+	msg := ipc.Mk_chmsg( )
+	msg.Send_req( rmgr_ch, nil, REQ_PUSH_ACK, &push_ack{ id: &name, host: host, gen: o.act.Pgen, ok: ok }, nil )
+}
+
+/*
+	Resend the action, preferring an agent which has not yet been tried, or fail it
+	if the retry limit has been reached or there is no agent able to take it.
+*/
+func (ad *agent_data) resend( smgr agent_smgr, o *outstanding, why string ) {
+	host := ""
+	if len( o.act.Hosts ) > 0 {
+		host = o.act.Hosts[0]
+	}
+
+	if o.tries >= ad.ack_retries {
+		am_sheep.Baa( 0, "ERR: %s action %d for %s on %s failed after %d attempts (%s)  [TGUAGT018]", o.act.Atype, o.act.Aid, o.act.Rname, host, o.tries + 1, why )
+		delete( ad.outstanding, o.act.Aid )
+		send_push_ack( o, false )
+		return
+	}
+
+	a := ad.select_agent( o.act.Atype, host, nil, o.long, o.tried )
+	if a == nil {
+		a = ad.select_agent( o.act.Atype, host, nil, o.long, nil )			// no untried agent; try any that can take it again
+	}
+	if a == nil {
+		am_sheep.Baa( 0, "ERR: %s action %d for %s on %s failed; no agent can handle a resend (%s)  [TGUAGT019]", o.act.Atype, o.act.Aid, o.act.Rname, host, why )
+		delete( ad.outstanding, o.act.Aid )
+		send_push_ack( o, false )
+		return
+	}
+
+	jmsg, err := json.Marshal( &agent_cmd{ Ctype: "action_list", Actions: []action{ o.act } } )
+	if err != nil {
+		delete( ad.outstanding, o.act.Aid )
+		send_push_ack( o, false )
+		return
+	}
+
+	o.tries++
+	o.agent = a
+	o.tried[a.id] = true
+	o.deadline = time.Now().Unix() + ad.ack_timeout
+
+	am_sheep.Baa( 1, "resending %s action %d for %s to agent %s (%s), attempt %d: %s", o.act.Atype, o.act.Aid, o.act.Rname, a.id, a.agent_id, o.tries + 1, why )
+	smgr.Write( a.id, jmsg )
+}
+
+/*
+	Process the response to an action. Responses for actions that are not outstanding
+	(untracked, or arriving after a resend was completed elsewhere) are ignored.
+*/
+func (ad *agent_data) ack( smgr agent_smgr, aid uint32, ok bool ) {
+	if aid == 0 {
+		return
+	}
+
+	o := ad.outstanding[aid]
+	if o == nil {
+		return
+	}
+
+	if ok {
+		am_sheep.Baa( 2, "%s action %d for %s acknowledged", o.act.Atype, aid, o.act.Rname )
+		delete( ad.outstanding, aid )
+		send_push_ack( o, true )
+		return
+	}
+
+	ad.resend( smgr, o, "agent reported failure" )
+}
+
+/*
+	Resend any outstanding actions whose deadline has passed.
+*/
+func (ad *agent_data) check_timeouts( smgr agent_smgr ) {
+	now := time.Now().Unix()
+	for _, o := range ad.outstanding {
+		if o.deadline < now {
+			ad.resend( smgr, o, "timeout" )
+		}
+	}
+}
+
+/*
+	Resend any outstanding actions that were sent to an agent that has disconnected.
+*/
+func (ad *agent_data) agent_lost( smgr agent_smgr, a *agent ) {
+	for _, o := range ad.outstanding {
+		if o.agent == a {
+			ad.resend( smgr, o, "agent disconnected" )
+		}
+	}
+}
@@ -0,0 +1,278 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	fq_explain
+	Abstract:	Support for the explain request which shows, without sending anything, the
+				southbound operations that would be emitted for a reservation. Res_mgr builds
+				the fq requests exactly as it does when pushing (bw_fqreqs etc.) and fetches
+				the queue map from network; fq_mgr then renders each request as it would be
+				sent: the agent action and its parameters (the Fq_req maps) and the flow-mods
+				(match, actions, priority, cookie and timeout) that the parameters produce.
+				The flow-mods are built from those parameters by the same functions the agent
+				uses to install them natively, so they carry the queue (or meter) the scripts
+				are given and show what is installed on either path.
+				Operations are grouped by physical host, in the order they would be sent, and
+				each host lists the queue settings (from the queue map) that apply to it.
+
+	Date:		19 Oct 2026
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	A single southbound operation: the kind (SB_*) and the request.
+*/
+type sb_op struct {
+	kind	int
+	req		*Fq_req
+}
+
+/*
+	Built by res_mgr and passed (via the http manager) to fq_mgr to render.
+*/
+type explain_req struct {
+	id		string
+	hypo	bool					// pledge is not in the inventory (nothing was allocated)
+	at		int64					// time used to select queues
+	ops		[]*sb_op
+	qlist	[]string				// queue map from network (host/port,res-id,queue,min,max,pri)
+}
+
+// ---- rendered output (json) -----------------------------------------------------------
+
+type explain_fmod struct {
+	Kind	string				`json:"kind"`
+	Action	string				`json:"action"`				// agent action that carries the parms
+	Parms	map[string]string	`json:"parms"`
+	Flows	[]string			`json:"flows"`					// flow-mods in ovs-ofctl syntax
+	Error	string				`json:"error,omitempty"`
+}
+
+type explain_host struct {
+	Host	string				`json:"host"`
+	Driver	string				`json:"driver"`
+	Queues	[]string			`json:"queues"`
+	Qpolicy	string				`json:"qpolicy"`
+	Fmods	[]*explain_fmod		`json:"flowmods"`
+}
+
+type explain_rpt struct {
+	Id		string				`json:"id"`
+	Hypo	bool				`json:"hypothetical"`
+	At		int64				`json:"at"`
+	Hosts	[]*explain_host		`json:"hosts"`
+	Notes	[]string			`json:"notes,omitempty"`
+}
+
+/*
+	Build the explain request for a pledge. Now is the time at which the requests are built;
+	for a reservation that has not started the commence time is used so that the queues that
+	will be in effect are selected. Queue map is fetched from network (qgen is the res_mgr
+	queue generation request type).
+*/
+func explain_pledge( p *gizmos.Pledge, hypo bool, to_limit int64, pref_v6 bool, qgen int ) ( er *explain_req, err error ) {
+	if p == nil {
+		return nil, fmt.Errorf( "no reservation" )
+	}
+
+	rname := (*p).Get_id()
+	at := time.Now().Unix()
+	if c, _ := (*p).Get_window(); c > at {
+		at = c
+	}
+
+	er = &explain_req{ id: *rname, hypo: hypo, at: at }
+	switch pt := (*p).(type) {
+		case *gizmos.Pledge_bw:
+			for _, fr := range bw_fqreqs( pt, rname, at, to_limit, pref_v6 ) {
+				er.ops = append( er.ops, &sb_op{ kind: SB_BW, req: fr } )
+			}
+
+		case *gizmos.Pledge_bwow:
+			for _, fr := range bwow_fqreqs( pt, rname, at, to_limit, pref_v6 ) {
+				er.ops = append( er.ops, &sb_op{ kind: SB_BWOW, req: fr } )
+			}
+
+		case *gizmos.Pledge_pass:
+			if fr := pass_fqreq( pt, rname, at, to_limit ); fr != nil {
+				er.ops = append( er.ops, &sb_op{ kind: SB_PASS, req: fr } )
+			}
+
+		default:
+			return nil, fmt.Errorf( "explain is supported only for bandwidth, oneway and passthru reservations" )
+	}
+
+	if len( er.ops ) == 0 {
+		return nil, fmt.Errorf( "no flow-mods would be generated: unable to map the reservation hosts to addresses" )
+	}
+
+	ch := make( chan *ipc.Chmsg )
+	defer close( ch )
+	msg := ipc.Mk_chmsg( )
+	msg.Send_req( nw_ch, ch, qgen, at, nil )
+	msg = <- ch
+	if msg.State == nil && msg.Response_data != nil {
+		er.qlist = msg.Response_data.( []string )
+	}
+
+	return er, nil
+}
+
+/*
+	Render the request as a json report. The requests are cloned so that the mac
+	conversions done here (the same as the send_* functions do) do not touch the
+	caller's data.
+*/
+func (er *explain_req) render( sbt *sb_table, env *sb_env ) ( string, error ) {
+	rpt := &explain_rpt{ Id: er.id, Hypo: er.hypo, At: er.at }
+	hosts := make( map[string]*explain_host )
+
+	for _, op := range er.ops {
+		h := sb_host( op.req )
+		host := h
+		if env.phost_suffix != nil && h != "" {
+			host = *add_phost_suffix( &h, env.phost_suffix )
+		}
+
+		eh := hosts[host]
+		if eh == nil {
+			eh = &explain_host{ Host: host, Driver: sbt.for_flow( op.kind, h ).Name(), Fmods: make( []*explain_fmod, 0, 2 ) }
+			eh.Qpolicy = env.host_qpolicy( host ).String()
+			eh.Queues = explain_queues( er.qlist, h, host )
+			hosts[host] = eh
+			rpt.Hosts = append( rpt.Hosts, eh )
+		}
+
+		ef := explain_op( op, env, host )
+		if eh.Driver != "agent" && ef.Error == "" {
+			ef.Error = fmt.Sprintf( "the %s southbound driver is used for this host; the agent action and flow-mods shown are not sent", eh.Driver )
+		}
+		eh.Fmods = append( eh.Fmods, ef )
+	}
+
+	if er.hypo {
+		rpt.Notes = append( rpt.Notes, "hypothetical: nothing was allocated; queues for this reservation are not assigned and queue numbers are not final" )
+	}
+	rpt.Notes = append( rpt.Notes, "timeouts are relative to the time of this request" )
+
+	jb, err := json.Marshal( rpt )
+	if err != nil {
+		return "", err
+	}
+	return string( jb ), nil
+}
+
+/*
+	Render one operation. Host is the suffixed host name used to select the queue policy;
+	bandwidth flow-mods reference a meter when the host's reservation bridge uses meters.
+	The parms are built exactly as the agent driver builds them (mac conversion and meter
+	selection included) and the flows are rendered from the parms, not from the request,
+	so the output matches what the agent receives.
+*/
+func explain_op( op *sb_op, env *sb_env, host string ) ( ef *explain_fmod ) {
+	var (
+		flows	[]*gizmos.Of_flow
+		err		error
+	)
+
+	ef = &explain_fmod{ Kind: sb_kind2str( op.kind ), Flows: make( []string, 0, 2 ) }
+	data := op.req.Clone()
+	ip2mac := env.ip2mac
+	if op.kind == SB_BW || op.kind == SB_BWOW {
+		data.Meter = env.host_meter( host, data )
+	}
+
+	mac := func( ip *string ) ( *string ) {
+		if ip == nil {
+			return nil
+		}
+		return ip2mac[*ip]
+	}
+
+	switch op.kind {
+		case SB_BW:
+			data.Match.Smac = mac( data.Match.Ip1 )
+			data.Match.Dmac = mac( data.Match.Ip2 )
+			ef.Action = "bw_fmod"
+			ef.Parms = data.To_bw_map()
+			flows, err = gizmos.Of_bw_flows( ef.Parms )
+			g, gerr := gizmos.Of_bw_group( ef.Parms )					// split reservation: group is installed ahead of the flows
+			if g != nil {
+				ef.Flows = append( ef.Flows, g.String() )
+			}
+			if err == nil {
+				err = gerr
+			}
+
+		case SB_BWOW:
+			data.Match.Smac = mac( data.Match.Ip1 )
+			data.Match.Dmac = mac( data.Match.Ip2 )
+			ef.Action = "bwow_fmod"
+			ef.Parms = data.To_bwow_map()
+			flows, err = gizmos.Of_bwow_flows( ef.Parms )
+
+		case SB_PASS:
+			if m := mac( data.Match.Smac ); m != nil {
+				data.Match.Smac = m
+			}
+			ef.Action = "passthru"
+			ef.Parms = data.To_pt_map()
+			flows, err = gizmos.Of_pt_flows( ef.Parms )
+	}
+
+	if sb_host( op.req ) == "" {
+		ef.Error = "no switch/host for the request; it would not be sent"
+	} else {
+		if err != nil {
+			ef.Error = fmt.Sprintf( "%s", err )
+		}
+	}
+
+	for _, f := range flows {
+		ef.Flows = append( ef.Flows, f.String() )
+	}
+
+	return ef
+}
+
+/*
+	Return the queue map entries for the host (with or without the suffix).
+*/
+func explain_queues( qlist []string, h string, host string ) ( ql []string ) {
+	ql = make( []string, 0, 4 )
+	for _, q := range qlist {
+		toks := strings.SplitN( q, "/", 2 )
+		if len( toks ) == 2 && (toks[0] == h || toks[0] == host) {
+			ql = append( ql, q )
+		}
+	}
+
+	return ql
+}
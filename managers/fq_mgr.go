@@ -30,6 +30,9 @@
 					fqmgr:queue_check - the frequency (seconds) between checks to see if queues need to be reset (5)
 					fqmgr:host_check  - the frequency (seconds) between checks to see  what _real_ hosts open stack reports (180)
 					fqmgr:switch_hosts- A space sep list of hosts to set switch queues on; if given then openstack is _not_ queried (no list)
+					fqmgr:southbound  - driver name, or list of host-pattern:driver pairs, used to push flow-mods (agent; ie flow-mods to skoogi if sdn_host)
+					fqmgr:sb_record   - file to which the noop southbound driver records requests (log only)
+					fqmgr:reconcile, reconcile_fix, reconcile_grace - see fq_reconcile.go
 					default:sdn_host  - the host name where skoogi (sdn controller) is running
 					
 	Date:		29 December 2013
@@ -60,6 +63,13 @@
 				01 Feb 2015 - Corrected bug itroduced when host name removed from fmod parmss (agent w/ ssh-broker changes).
 				19 Feb 2015 - Change in adjust_queues_agent to allow create queues to be driven from agent without -h on command line.
 				21 Mar 2015 - Changes to support new bandwith endpoint flow-mod agent script.
+				18 Oct 2026 - Reservation name added to bw/bwow flow-mod actions so that agent manager can track them.
+				19 Oct 2026 - Bandwidth, oneway and passthru pushes acknowledge res_mgr (as failed) when they cannot be sent.
+				18 Oct 2026 - Flow-mods and queue settings are pushed through southbound drivers (fq_south.go) selected per host.
+				18 Oct 2026 - Desired flows and queues are reconciled with what is installed on each host (fq_reconcile.go).
+				19 Oct 2026 - Added explain support (fq_explain.go): renders what would be sent for a reservation.
+				19 Oct 2026 - Added flow-mod delete request (REQ_FLOW_DEL) for reservations pushed without a hard timeout.
+				19 Oct 2026 - Added queue policy (queue_policy config) sent with queue settings, and host capability tracking.
 */
 
 package managers
@@ -188,14 +198,20 @@ func adjust_queues( qlist []string, cmd_base *string, hlist *string ) {
 	the script's view of host name might not have the suffix that we are supplied
 	with.  To prevent the script from not recognising an entry, we must now
 	put an entry for both the host name and hostname+suffix into the list.
+
+	Each host's request carries the queue policy for the host (the configured policy less
+	the mechanisms the host did not report support for) which tells the agent how to
+	implement the queues on each bridge.
 */
-func adjust_queues_agent( qlist []string, hlist *string, phsuffix *string ) {
+func adjust_queues_agent( qlist []string, hlist *string, env *sb_env ) {
 	var (
 		qjson	string						// final full json blob
 		qjson_pfx	string					// static prefix
 		sep = ""
 	)
 
+	phsuffix := env.phost_suffix
+
 	target_hosts := make( map[string]bool )					// hosts that are actually affected by the queue list
 	if phsuffix != nil {									// need to convert the host names in the list to have suffix
 		nql := make( []string, len( qlist ) * 2 )			// need one for each possible host name
@@ -242,7 +258,7 @@ func adjust_queues_agent( qlist []string, hlist *string, phsuffix *string ) {
 		qjson = qjson_pfx					// seed the next request with the constant prefix
 		qjson += fmt.Sprintf( "%s%q", sep, h )
 
-		qjson += ` ] } ] }`
+		qjson += fmt.Sprintf( ` ], "data": { "qpolicy": %q } } ] }`, env.host_qpolicy( h ).String() )
 	
 		fq_sheep.Baa( 2, "queue update: host=%s %s", h, qjson )
 		tmsg := ipc.Mk_chmsg( )
@@ -264,12 +280,12 @@ func adjust_queues_agent( qlist []string, hlist *string, phsuffix *string ) {
 	info is local to fq-mgr b/c in the original Tegu it came straight
 	in from skoogi and it was fq-mgr's job to interface with skoogi.)
 */
-func send_bw_fmods( data *Fq_req, ip2mac map[string]*string, phost_suffix *string ) {
+func send_bw_fmods( data *Fq_req, ip2mac map[string]*string, phost_suffix *string ) ( error ) {
 
 
 	if data.Espq.Switch == "" {									// we must have a switch name to set bandwidth fmods
 		fq_sheep.Baa( 1, "unable to send bw-fmods request to agent: no switch defined in input data" )
-		return
+		return fmt.Errorf( "no switch defined for bandwidth flow-mods" )
 	}
 
 	host := &data.Espq.Switch 									// Espq.Switch has real name (host) of switch
@@ -286,17 +302,22 @@ func send_bw_fmods( data *Fq_req, ip2mac map[string]*string, phost_suffix *strin
 	msg.Actions[0].Hosts = make( []string, 1 )					// bw endpoint flow-mods created on just one host
 	msg.Actions[0].Hosts[0] = *host
 	msg.Actions[0].Data = data.To_bw_map()						// convert useful data from caller into parms for agent
+	if data.Id != nil {
+		msg.Actions[0].Rname = *data.Id							// agent manager tracks the action and reports the result to res_mgr
+		msg.Actions[0].Pgen = data.Pgen
+	}
 
 	json, err := json.Marshal( msg )						// bundle into a json string
 	if err != nil {
 		fq_sheep.Baa( 0, "unable to build json to set flow mod" )
-	} else {
-		tmsg := ipc.Mk_chmsg( )
-		tmsg.Send_req( am_ch, nil, REQ_SENDSHORT, string( json ), nil )		// send as a short request to one agent
+		return err
 	}
 
+	tmsg := ipc.Mk_chmsg( )
+	tmsg.Send_req( am_ch, nil, REQ_SENDSHORT, string( json ), nil )		// send as a short request to one agent
+
 	fq_sheep.Baa( 2, "bandwidth endpoint flow-mod request sent to agent manager: %s", json )
-	
+	return nil
 }
 
 /*
@@ -309,15 +330,15 @@ func send_bw_fmods( data *Fq_req, ip2mac map[string]*string, phost_suffix *strin
 	Yes, this probably _could_ be pushed up into the reservation manager;
 	see comments above.
 */
-func send_bwow_fmods( data *Fq_req, ip2mac map[string]*string, phost_suffix *string ) {
+func send_bwow_fmods( data *Fq_req, ip2mac map[string]*string, phost_suffix *string ) ( error ) {
 	if data == nil {
 		fq_sheep.Baa( 1, "fq_req: internal mishap: unable to send bwow-fmods data to bwow function was nil" )
-		return
+		return fmt.Errorf( "no data for oneway flow-mods" )
 	}
 
 	if data.Espq == nil || data.Espq.Switch == "" {									// we must have a switch name to set bandwidth fmods
 		fq_sheep.Baa( 1, "unable to send bwow-fmods request to agent: no switch defined in input data" )
-		return
+		return fmt.Errorf( "no switch defined for oneway flow-mods" )
 	}
 
 	host := &data.Espq.Switch 									// Espq.Switch has real name (host) of switch
@@ -338,16 +359,22 @@ func send_bwow_fmods( data *Fq_req, ip2mac map[string]*string, phost_suffix *str
 	msg.Actions[0].Hosts = make( []string, 1 )					// oneway flow-mods created on just one host
 	msg.Actions[0].Hosts[0] = *host
 	msg.Actions[0].Data = data.To_bwow_map()					// convert useful data from caller into parms for agent
+	if data.Id != nil {
+		msg.Actions[0].Rname = *data.Id							// agent manager tracks the action and reports the result to res_mgr
+		msg.Actions[0].Pgen = data.Pgen
+	}
 
 	json, err := json.Marshal( msg )						// bundle into a json string
 	if err != nil {
 		fq_sheep.Baa( 0, "unable to build json to set bwow flow mod" )
-	} else {
-		tmsg := ipc.Mk_chmsg( )
-		tmsg.Send_req( am_ch, nil, REQ_SENDSHORT, string( json ), nil )		// send as a short request to one agent
+		return err
 	}
 
+	tmsg := ipc.Mk_chmsg( )
+	tmsg.Send_req( am_ch, nil, REQ_SENDSHORT, string( json ), nil )		// send as a short request to one agent
+
 	fq_sheep.Baa( 2, "oneway bandwidth flow-mod request sent to agent manager: %s", json )
+	return nil
 }
 
 /*
@@ -635,6 +662,15 @@ func Fq_mgr( my_chan chan *ipc.Chmsg, sdn_host *string ) {
 		alt_table	int = DEF_ALT_TABLE		// meta data marking table
 		phost_suffix *string = nil			// physical host suffix added to each host name in the list from openstack (config)
 		set_queues	bool = false			// queues need to be set only when using HTB
+		sb_cfg		string = ""				// southbound driver selection (config)
+		sb_record	*string					// file the noop driver records requests to (config)
+		env			*sb_env					// info shared with the southbound drivers
+		sbt			*sb_table				// southbound drivers by host
+		rc			*reconciler				// desired vs installed flow/queue reconciliation
+		rc_freq		int64 = DEF_RC_FREQ
+		rc_fix		bool = false			// drift is only reported unless the config asks for it to be corrected
+		rc_grace	int64 = DEF_RC_GRACE
+		qpolicy		*gizmos.Qpolicy			// queue policy (mechanism by bridge)
 
 		//max_link_used	int64 = 0			// the current maximum link utilisation
 	)
@@ -701,6 +737,35 @@ func Fq_mgr( my_chan chan *ipc.Chmsg, sdn_host *string ) {
 			fq_sheep.Set_level(  uint( clike.Atoi( *p ) ) )
 		}
 
+		if p := cfg_data["fqmgr"]["southbound"]; p != nil {		// driver, or pattern:driver list, used to push flow-mods and queues
+			sb_cfg = *p
+		}
+
+		if p := cfg_data["fqmgr"]["sb_record"]; p != nil {
+			sb_record = p
+		}
+
+		if p := cfg_data["fqmgr"]["reconcile"]; p != nil {			// seconds between reconciliation passes; 0 turns it off
+			rc_freq = clike.Atoi64( *p )
+			if rc_freq > 0 && rc_freq < 60 {
+				rc_freq = 60
+			}
+		}
+		if p := cfg_data["fqmgr"]["reconcile_fix"]; p != nil {
+			rc_fix = *p == "true"
+		}
+		if p := cfg_data["fqmgr"]["reconcile_grace"]; p != nil {
+			rc_grace = clike.Atoi64( *p )
+		}
+
+		if p := cfg_data["fqmgr"]["queue_policy"]; p != nil {		// mechanism (htb, hfsc, noop, meter) used for queues; bridge:mech overrides
+			if qp, err := gizmos.Mk_qpolicy( *p ); err == nil {
+				qpolicy = qp
+			} else {
+				fq_sheep.Baa( 0, "WRN: queue_policy in config ignored, htb used: %s  [TGUFQM018]", err )
+			}
+		}
+
 		if p := cfg_data["fqmgr"]["phost_suffix"]; p != nil {		// suffix added to physical host strings for agent commands
 			if *p != "" {
 				phost_suffix = p
@@ -725,6 +790,31 @@ func Fq_mgr( my_chan chan *ipc.Chmsg, sdn_host *string ) {
 		uri_prefix = fmt.Sprintf( "http://%s", *sdn_host )
 	}
 
+	env = &sb_env{
+		host_list:		host_list,
+		phost_suffix:	phost_suffix,
+		alt_table:		alt_table,
+		send_all:		send_all,
+		uri_prefix:		uri_prefix,
+		record:			sb_record,
+		qpolicy:		qpolicy,
+		qcaps:			make( map[string][]string ),
+		meters:			make( map[string]*sb_meter ),
+	}
+	fq_sheep.Baa( 1, "queue policy: %s", qpolicy.String() )
+	ie_drv := ""
+	if uri_prefix != "" {
+		ie_drv = "skoogi"												// only ie flow-mods ever went to skoogi
+	}
+	sbt = mk_sb_table( sb_cfg, "agent", ie_drv, env )
+	fq_sheep.Baa( 1, "southbound default driver: %s (ie: %s), %d host specific pattern(s)", sbt.def.Name(), sbt.for_flow( SB_IE, "" ).Name(), len( sbt.pats ) )
+
+	rc = mk_reconciler( phost_suffix, rc_fix, rc_grace, set_queues )
+	if rc_freq > 0 {
+		tklr.Add_spot( rc_freq, my_chan, REQ_RECONCILE, nil, ipc.FOREVER )		// first pass after a full interval so that reservations have been pushed
+		fq_sheep.Baa( 1, "flows and queues will be reconciled every %ds fix=%v", rc_freq, rc_fix )
+	}
+
 	fq_sheep.Baa( 1, "flowmod-queue manager is running, sdn host: %s", *sdn_host )
 	for {
 		msg = <- my_chan					// wait for next message
@@ -735,84 +825,34 @@ func Fq_mgr( my_chan chan *ipc.Chmsg, sdn_host *string ) {
 			case REQ_GEN_FMOD:							// generic fmod; just pass it along w/o any special handling
 				if msg.Req_data != nil {
 					fdata = msg.Req_data.( *Fq_req ); 		// pointer at struct with all of our expected goodies
-					send_gfmod_agent( fdata,  ip2mac, host_list, phost_suffix )
+					msg.State = sbt.for_host( sb_host( fdata ) ).Install_flow( SB_GENERIC, fdata )
 				}
 
 			case REQ_BWOW_RESERVE:						// oneway bandwidth flow-mod generation
 				msg.Response_ch = nil					// nothing goes back from this
 				fdata = msg.Req_data.( *Fq_req ); 		// pointer at struct with all of the expected goodies
-				send_bwow_fmods( fdata, ip2mac, phost_suffix )
+				if sb_push( sbt, SB_BWOW, fdata ) == nil {
+					rc.add( SB_BWOW, fdata )
+				}
 
 			case REQ_BW_RESERVE:						// bandwidth endpoint flow-mod creation; single agent script creates all needed fmods
 				fdata = msg.Req_data.( *Fq_req ); 		// pointer at struct with all of the expected goodies
-				send_bw_fmods( fdata, ip2mac, phost_suffix )
+				if sb_push( sbt, SB_BW, fdata ) == nil {
+					rc.add( SB_BW, fdata )
+				}
 				msg.Response_ch = nil					// nothing goes back from this
 
 			case REQ_PT_RESERVE:						// DSCP passthru flow-mods need to be generated
 				fdata = msg.Req_data.( *Fq_req );
-				send_pt_fmods( fdata, ip2mac, phost_suffix )
+				if sb_push( sbt, SB_PASS, fdata ) == nil {
+					rc.add( SB_PASS, fdata )
+				}
 				msg.Response_ch = nil
 
-			case REQ_IE_RESERVE:						// proactive ingress/egress reservation flowmod  (this is likely deprecated as of 3/21/2015 -- resmgr invokes the bw_fmods script via agent)
+			case REQ_IE_RESERVE:						// proactive ingress/egress reservation flowmod
 				fdata = msg.Req_data.( *Fq_req ); 		// user view of what the flow-mod should be
-
-				if uri_prefix != "" {						// an sdn controller -- skoogi -- is enabled
-					msg.State = gizmos.SK_ie_flowmod( &uri_prefix, *fdata.Match.Ip1, *fdata.Match.Ip2, fdata.Expiry, fdata.Espq.Queuenum, fdata.Espq.Switch, fdata.Espq.Port )
-
-					if msg.State == nil {					// no error, no response to requestor
-						fq_sheep.Baa( 2,  "proactive reserve successfully sent: uri=%s h1=%s h2=%s exp=%d qnum=%d swid=%s port=%d dscp=%d",
-									uri_prefix, fdata.Match.Ip1, fdata.Match.Ip2, fdata.Expiry, fdata.Espq.Queuenum, fdata.Espq.Switch, fdata.Espq.Port )
-						msg.Response_ch = nil
-					} else {
-						// do we need to suss out the id and mark it failed, or set a timer on it,  so as not to flood reqmgr with errors?
-						fq_sheep.Baa( 1,  "ERR: proactive reserve failed: uri=%s h1=%s h2=%s exp=%d qnum=%d swid=%s port=%d  [TGUFQM008]",
-									uri_prefix, fdata.Match.Ip1, fdata.Match.Ip2, fdata.Expiry, fdata.Espq.Queuenum, fdata.Espq.Switch, fdata.Espq.Port )
-					}
-				} else {
-																// q-lite now generates one flowmod  in each direction because of the ITONS requirements
-					if send_all || fdata.Espq.Queuenum > 1 {	// if sending all fmods, or this has a non-intermediate queue
-						cdata := fdata.Clone()					// copy so we can alter w/o affecting sender's copy
-						if cdata.Espq.Port == -128 {			// we'll assume in this case that the switch given is the host name and we need to set the switch to br-int
-							swid := "br-int"
-							cdata.Swid = &swid
-						}
-
-						if cdata.Resub == nil {
-							resub_list := ""						 // resub to alternate table to set a meta mark, then to table 0 to hit openstack junk
-							if cdata.Single_switch || fdata.Dir_in {					// must use the base table for inbound traffic OR same switch traffic (bug 2015/1/26)
-								resub_list = fmt.Sprintf( "%d 0", alt_table )			// base alt_table is for 'local' traffic (trafic that doesn't go through br-rl
-							} else {
-								resub_list = fmt.Sprintf( "%d 0", alt_table + 1 )		// base+1 is for OUTBOUND only traffic that must go through the rate limiting bridge
-							}
-							cdata.Resub = &resub_list
-						}
-				
-						meta := "0x00/0x07"						// match-value/mask; match only when meta neither of our two bits, nor the agent bit (0x04) are set
-						cdata.Match.Meta = &meta
-
-						if fdata.Dir_in  {						// inbound to this switch we need to revert dscp from our settings to the 'origianal' settings
-							if cdata.Single_switch {
-								cdata.Match.Dscp =  -1				// there is no match if both on same switch
-								send_gfmod_agent( cdata,  ip2mac, host_list, phost_suffix )
-							} else {
-								cdata.Match.Dscp = cdata.Dscp						// match the dscp that was added on ingress
-								if ! cdata.Dscp_koe {								// dropping the value on exit
-									cdata.Action.Dscp = 0							// set action to turn it off, otherwise we let it ride (no overt action)
-								}
-
-								send_gfmod_agent( cdata,  ip2mac, host_list, phost_suffix )
-							}
-						} else {													// outbound from this switch set the dscp value specified on the reservation
-							cdata.Match.Dscp =  -1									// on outbound there is no dscp match, ensure this is off
-							if cdata.Single_switch {
-								send_gfmod_agent( cdata,  ip2mac, host_list, phost_suffix )		// in single switch mode there is no dscp value needed
-							} else {
-								cdata.Action.Dscp = cdata.Dscp						// otherwise set the value and send
-								send_gfmod_agent( cdata,  ip2mac, host_list, phost_suffix )
-							}
-						}
-					}
-
+				msg.State = sb_install( sbt, SB_IE, fdata )
+				if msg.State == nil {					// no error, no response to requestor
 					msg.Response_ch = nil
 				}
 
@@ -820,10 +860,8 @@ func Fq_mgr( my_chan chan *ipc.Chmsg, sdn_host *string ) {
 				msg.Response_ch = nil						// for now, nothing goes back
 				if msg.Req_data != nil {
 					fq_data := msg.Req_data.( *Fq_req ); 			// request data
-					if uri_prefix != "" {							// an sdn controller -- skoogi -- is enabled (not supported)
-						fq_sheep.Baa( 0, "ERR: steering reservations are not supported with skoogi (SDNC); no flow-mods pushed" )
-					} else {
-						send_stfmod_agent( fq_data, ip2mac, host_list )	
+					if err := sb_install( sbt, SB_STEER, fq_data ); err != nil {
+						fq_sheep.Baa( 0, "ERR: steering flow-mods not pushed: %s", err )
 					}
 				} else {
 					fq_sheep.Baa( 0, "CRI: missing data on st-reserve request to fq-mgr" )
@@ -841,10 +879,15 @@ func Fq_mgr( my_chan chan *ipc.Chmsg, sdn_host *string ) {
 			case REQ_SETQUEUES:								// request from reservation manager which indicates something changed and queues need to be reset
 				if set_queues {
 					qlist := msg.Req_data.( []interface{} )[0].( []string )
+					rc.set_queues( qlist )
 					if ssq_cmd != nil {
 						adjust_queues( qlist, ssq_cmd, host_list ) 					// if writing to a file and driving a local script
 					} else {
-						adjust_queues_agent( qlist, host_list, phost_suffix )		// if sending json to an agent
+						for drv, dql := range sbt.split_queues( qlist ) {			// each driver gets the queues for the hosts it manages
+							if err := drv.Set_queues( dql, host_list ); err != nil {
+								fq_sheep.Baa( 1, "WRN: %s southbound driver: unable to set queues: %s  [TGUFQM013]", drv.Name(), err )
+							}
+						}
 					}
 				}
 
@@ -861,7 +904,7 @@ func Fq_mgr( my_chan chan *ipc.Chmsg, sdn_host *string ) {
 								fq_sheep.Baa( 2, "host list from osif before suffix added: %s", *host_list )
 								host_list = add_phost_suffix( host_list, phost_suffix )		// in some cases ostack sends foo, but we really need to use foo-suffix (sigh)
 							}
-							send_hlist_agent( host_list )							// send to agent_manager
+							sb_hosts( sbt, env, host_list )							// send to agent_manager and/or other drivers
 							fq_sheep.Baa( 2, "host list received from osif: %s", *host_list )
 						} else {
 							fq_sheep.Baa( 1, "host list received from osif was discarded: ()" )
@@ -873,11 +916,61 @@ func Fq_mgr( my_chan chan *ipc.Chmsg, sdn_host *string ) {
 					req_hosts( my_chan, fq_sheep )					// send requests to osif for data
 				}
 
+			case REQ_RECONCILE:								// tickle, desired state from res_mgr (response), or host state from the agent manager
+				if msg.Response_data != nil {								// res_mgr's desired state; now ask for the installed state
+					msg.Response_ch = nil
+					if wl, ok := msg.Response_data.( []*rc_want ); ok {
+						rc.set_want( wl, ip2mac )
+						rc.request( sbt, host_list )
+					}
+				} else {
+					msg.Response_ch = nil
+					if rdata, ok := msg.Req_data.( []string ); ok {
+						rc.process( sbt, rdata )
+					} else {
+						tmsg := ipc.Mk_chmsg( )
+						tmsg.Send_req( rmgr_ch, my_chan, REQ_RECONCILE, nil, nil )		// desired state comes back as a response
+					}
+				}
+
+			case REQ_DRIFT:									// drift report for the api
+				msg.Response_data = rc.to_json( )
+
+			case REQ_EXPLAIN:								// render what would be sent for a reservation; nothing is sent
+				if er, ok := msg.Req_data.( *explain_req ); ok && er != nil {
+					msg.Response_data, msg.State = er.render( sbt, env )
+				} else {
+					msg.State = fmt.Errorf( "no data to explain" )
+				}
+
+			case REQ_FLOW_DEL:								// delete the flow-mods of an expired reservation (no hard timeout)
+				if ops, ok := msg.Req_data.( []*sb_op ); ok {
+					for _, op := range ops {
+						h := sb_host( op.req )
+						if err := sbt.for_flow( op.kind, h ).Remove_flow( op.kind, op.req ); err != nil {
+							fq_sheep.Baa( 1, "WRN: unable to remove %s flow-mods for %s on %s: %s  [TGUFQM017]", sb_kind2str( op.kind ), *op.req.Id, h, err )
+						}
+					}
+				}
+
+			case REQ_QPCAPS:								// queue policy mechanisms supported by hosts (agent response)
+				msg.Response_ch = nil
+				if rdata, ok := msg.Req_data.( []string ); ok {
+					for _, l := range rdata {					// host mech [mech...]
+						toks := strings.Fields( l )
+						if len( toks ) > 0 {
+							env.qcaps[toks[0]] = toks[1:]
+							fq_sheep.Baa( 2, "queue policy mechanisms supported by %s: %s", toks[0], strings.Join( toks[1:], " " ) )
+						}
+					}
+				}
+
 			case REQ_IP2MACMAP:								// a new map from osif
 				if  msg.Req_data != nil {
 					newmap := msg.Req_data.( map[string]*string )
 					if len( newmap ) > 0  {
 						ip2mac = newmap										// safe to replace
+						env.ip2mac = ip2mac
 						fq_sheep.Baa( 2, "ip2mac translation received from osif: %d elements", len( ip2mac ) )
 					}else {
 						if ip2mac != nil {
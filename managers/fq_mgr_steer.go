@@ -29,6 +29,8 @@
 
 	Mods:		27 Feb 2015 - changes to deal with lazy update and to correct l* bug.
 				15 Jun 2015 - Cleaned up commented out lines a bit.
+				19 Oct 2026 - Next hop may be a select group (middlebox pool).
+				19 Oct 2026 - Added send_stgroup_del to delete the select group of a pool.
 */
 
 package managers
@@ -74,6 +76,8 @@ func send_meta_fm( hlist []string, table int, cookie int, pattern string ) {
 	applied depending on where they are found.
 	Data expected in the fq_req:
 		Nxt_mac - the mac address that is to be set on the action as dest
+		Nxt_group - the select group (id,policy,mac/weight...) for a middlebox pool; each
+					bucket sets one member as the dest (replaces Nxt_mac)
 		Expiry  - the timeout for the fmod(s)
 		Ip1/2	- The src/dest IP addresses for match (one must be supplied)
 		Meta	- The meta value to set/match (both optional)
@@ -197,8 +201,12 @@ func send_stfmod_agent( data *Fq_req, ip2mac map[string]*string, hlist *string )
 		action_opts += " -s " + *data.Action.Smac
 	}
 
-	if data.Nxt_mac != nil {
-		action_opts += " -d " + *data.Nxt_mac			// add next hop if supplied -- last mbox won't have a next hop, but needs to exist to skip p100 fmod
+	if data.Nxt_group != nil {
+		action_opts += " -G " + *data.Nxt_group			// next hop is a pool; the script builds the group and the buckets set the dest
+	} else {
+		if data.Nxt_mac != nil {
+			action_opts += " -d " + *data.Nxt_mac			// add next hop if supplied -- last mbox won't have a next hop, but needs to exist to skip p100 fmod
+		}
 	}
 
 	if data.Action.Meta != nil {						// CAUTION: ovs barfs on the command if write metadata isn't last
@@ -239,3 +247,40 @@ func send_stfmod_agent( data *Fq_req, ip2mac map[string]*string, hlist *string )
 		tmsg.Send_req( am_ch, nil, REQ_SENDSHORT, string( json ), nil )		// send as a short request to one agent
 	}
 }
+
+/*
+	Delete the select group named in Nxt_group (id,policy,...) from the switch(es) of the
+	steering request; ovs removes the flow-mods which send to the group along with it.
+*/
+func send_stgroup_del( data *Fq_req, hlist *string ) {
+	var hosts []string
+
+	if data.Nxt_group == nil {
+		return
+	}
+	if data.Swid == nil {									// no switch id, then the group was written to all hosts
+		if hlist == nil {
+			return
+		}
+		hosts = strings.Split( *hlist, " " )
+	} else {
+		hosts = strings.Split( *data.Swid, " " )
+	}
+
+	gid := strings.SplitN( *data.Nxt_group, ",", 2 )[0]
+	msg := &agent_cmd{ Ctype: "action_list" }				// create an agent message
+	msg.Actions = make( []action, 1 )
+	msg.Actions[0].Atype = "flowmod"
+	msg.Actions[0].Hosts = hosts
+	msg.Actions[0].Fdata = make( []string, 1 )
+	msg.Actions[0].Fdata[0] = fmt.Sprintf( `--action -G %s del 0xedde br-int`, gid )
+
+	json, err := json.Marshal( msg )						// bundle into a json string
+	if err != nil {
+		fq_sheep.Baa( 0, "steer: unable to build json to delete group %s", gid )
+	} else {
+		fq_sheep.Baa( 2, "stgroup del json: %s", json )
+		tmsg := ipc.Mk_chmsg( )
+		tmsg.Send_req( am_ch, nil, REQ_SENDSHORT, string( json ), nil )		// send as a short request to one agent
+	}
+}
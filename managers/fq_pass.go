@@ -26,12 +26,15 @@
 	Author:		E. Scott Daniels
 
 	Mods:
+				18 Oct 2026 - Reservation name added to the action so that agent manager can track it.
+				19 Oct 2026 - Returns an error when the request is not sent; push generation added to the action.
 */
 
 package managers
 
 import (
 	"encoding/json"
+	"fmt"
 
 	"github.com/att/gopkgs/ipc"
 )
@@ -55,12 +58,12 @@ import (
 	info is local to fq-mgr b/c in the original Tegu it came straight
 	in from skoogi and it was fq-mgr's job to interface with skoogi.)
 */
-func send_pt_fmods( data *Fq_req, ip2mac map[string]*string, phost_suffix *string ) {
+func send_pt_fmods( data *Fq_req, ip2mac map[string]*string, phost_suffix *string ) ( error ) {
 
 
-	if *data.Swid == "" {									// we must have a switch name to set bandwidth fmods
+	if data.Swid == nil || *data.Swid == "" {				// we must have a switch name to set bandwidth fmods
 		fq_sheep.Baa( 1, "unable to send passthrough fmod request to agent: no switch defined in input data" )
-		return
+		return fmt.Errorf( "no switch defined for passthru flow-mods" )
 	}
 
 	host := data.Swid
@@ -80,14 +83,20 @@ func send_pt_fmods( data *Fq_req, ip2mac map[string]*string, phost_suffix *strin
 	msg.Actions[0].Hosts = make( []string, 1 )					// passthrough flow-mods created on just one host
 	msg.Actions[0].Hosts[0] = *host
 	msg.Actions[0].Data = data.To_pt_map()						// convert useful data from caller into parms for agent
+	if data.Id != nil {
+		msg.Actions[0].Rname = *data.Id							// agent manager tracks the action and reports the result to res_mgr
+		msg.Actions[0].Pgen = data.Pgen
+	}
 
 	json, err := json.Marshal( msg )							// bundle into a json string
 	if err != nil {
 		fq_sheep.Baa( 0, "unable to build json to set passthrough flow-mods" )
-	} else {
-		tmsg := ipc.Mk_chmsg( )
-		tmsg.Send_req( am_ch, nil, REQ_SENDSHORT, string( json ), nil )		// send as a short request to one agent
+		return err
 	}
 
+	tmsg := ipc.Mk_chmsg( )
+	tmsg.Send_req( am_ch, nil, REQ_SENDSHORT, string( json ), nil )		// send as a short request to one agent
+
 	fq_sheep.Baa( 2, "passthru flow-mod request sent to agent manager: %s", json )
+	return nil
 }
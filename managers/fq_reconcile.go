@@ -0,0 +1,514 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	fq_reconcile
+	Abstract:	Reconciles the reservation flow-mods and queues which should exist on each
+				physical host (desired) with those which are actually installed. At each pass
+				fq_mgr asks res_mgr for the desired state: the bandwidth, oneway and passthrough
+				flow-mod requests of every active pledge that is not paused, built from the
+				live pledges just as they are when pushed. The last queue list sent to each host
+				is the desired queue state. Once the desired state is known the southbound
+				drivers are asked for the current state of their hosts; the agent driver returns
+				the flows carrying the reservation cookies and the number of reservation queues
+				(when the agent manages queues via ovsdb).
+
+				When the state for a host arrives it is compared with the desired set:
+					- desired flows which are missing are reinstalled unless the pledge is still
+					  waiting on push acknowledgements or was pushed within the grace period
+					- flows with a reservation cookie which match nothing desired are removed,
+					  unless something was pushed to the host after the desired state was built
+					- queues which are missing are set again, and queues on hosts which should
+					  have none are purged.
+				Flows are compared by cookie and source/dest mac. Passthrough requests which name
+				an endpoint uuid rather than a mac cannot be compared, so passthrough orphans are
+				not removed from hosts with such requests.
+
+				Drift counts for each host are kept and returned by the drift API request.
+
+	Config:		fqmgr:reconcile      - seconds between reconciliation passes (300; 0 disables)
+				fqmgr:reconcile_fix  - true to correct drift rather than only report it (false)
+				fqmgr:reconcile_grace- seconds after a request is pushed before a missing flow is counted (60)
+
+	Date:		18 Oct 2026
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/att/tegu/gizmos"
+)
+
+const (
+	DEF_RC_FREQ		int64 = 300
+	DEF_RC_GRACE	int64 = 60
+)
+
+/*
+	Flow signature used for comparison.
+*/
+type rc_sig struct {
+	cookie	uint64
+	src		string
+	dst		string
+}
+
+/*
+	A flow-mod request which should be installed (built by res_mgr from a live pledge).
+*/
+type rc_want struct {
+	kind	int
+	data	*Fq_req
+	added	int64						// time the request was last pushed by fq_mgr (0 if not since start)
+	settled	bool						// the pledge's push has been acknowledged
+}
+
+/*
+	Drift information for a host (exported for json).
+*/
+type Rc_stats struct {
+	Host		string
+	Last		int64				// time state was last received
+	Flows		int					// reservation flows reported by the host
+	Desired		int					// flow-mod requests that should be installed
+	Missing		int					// requests with flows missing (last pass)
+	Orphans		int					// flows matching nothing desired (last pass)
+	Queues		int					// reservation queues reported (-1 unknown)
+	Qdrift		string				// "", missing or orphaned (last pass)
+	Reinstalled	int					// total requests reinstalled
+	Removed		int					// total orphans removed
+	Error		string				// error reported collecting the state (last pass)
+}
+
+type reconciler struct {
+	want	map[string]map[string]*rc_want		// desired flow-mod requests by host then key
+	pushed	map[string]int64					// time each request (by key) was last pushed
+	hpushed	map[string]int64					// time a request was last pushed to each host
+	wanted	int64								// time the desired state was received from res_mgr
+	qwant	map[string][]string					// last queue entries for each host
+	stats	map[string]*Rc_stats
+	suffix	*string								// physical host suffix
+	fix		bool								// false == report only
+	grace	int64
+	queues	bool								// queues are being set by tegu
+	last	int64								// last time state was requested
+}
+
+func mk_reconciler( suffix *string, fix bool, grace int64, queues bool ) ( *reconciler ) {
+	return &reconciler {
+		want:	make( map[string]map[string]*rc_want ),
+		pushed:	make( map[string]int64 ),
+		hpushed: make( map[string]int64 ),
+		qwant:	make( map[string][]string ),
+		stats:	make( map[string]*Rc_stats ),
+		suffix:	suffix,
+		fix:	fix,
+		grace:	grace,
+		queues:	queues,
+	}
+}
+
+/*
+	Safe dereference.
+*/
+func rc_str( s *string ) ( string ) {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+/*
+	Return the host name as the agent knows it.
+*/
+func (rc *reconciler) host4( host string ) ( string ) {
+	if rc.suffix == nil {
+		return host
+	}
+	return *add_phost_suffix( &host, rc.suffix )
+}
+
+/*
+	Build the key for a request: the kind, reservation, addresses and transport ports identify
+	the request regardless of whether the macs were filled in.
+*/
+func rc_key( kind int, data *Fq_req ) ( string ) {
+	return fmt.Sprintf( "%s %s %s %s %s %s %s", sb_kind2str( kind ), rc_str( data.Id ), rc_str( data.Match.Ip1 ), rc_str( data.Match.Ip2 ),
+				rc_str( data.Tptype ), rc_str( data.Match.Tpsport ), rc_str( data.Match.Tpdport ) )
+}
+
+/*
+	Record the time a flow-mod request was pushed. A newly pushed request is given the grace
+	period before its flows are counted as missing, and orphans are not removed from a host
+	which was pushed to after the desired state was built as that state cannot include it.
+*/
+func (rc *reconciler) add( kind int, data *Fq_req ) {
+	if rc == nil || data == nil {
+		return
+	}
+	switch kind {
+		case SB_BW, SB_BWOW, SB_PASS:
+
+		default:
+			return
+	}
+
+	host := sb_host( data )
+	if host == "" {
+		return
+	}
+	host = rc.host4( host )
+
+	now := time.Now().Unix()
+	rc.pushed[rc_key( kind, data )] = now
+	rc.hpushed[host] = now
+}
+
+/*
+	Replace the desired flow-mod requests with the list built by res_mgr from its live pledges.
+	Res_mgr thinks in IP addresses, so the macs that the flows match are filled in from the
+	ip2mac map as they are when the requests are pushed. Push times of requests which are no
+	longer desired are dropped.
+*/
+func (rc *reconciler) set_want( wl []*rc_want, ip2mac map[string]*string ) {
+	if rc == nil {
+		return
+	}
+
+	rc.want = make( map[string]map[string]*rc_want )
+	rc.wanted = time.Now().Unix()
+	keys := make( map[string]bool )
+	for _, w := range wl {
+		if w == nil || w.data == nil || w.data.Match == nil {
+			continue
+		}
+
+		d := w.data
+		switch w.kind {
+			case SB_BW, SB_BWOW:
+				d.Match.Smac = nil
+				d.Match.Dmac = nil
+				if d.Match.Ip1 != nil {
+					d.Match.Smac = ip2mac[*d.Match.Ip1]
+				}
+				if d.Match.Ip2 != nil {
+					d.Match.Dmac = ip2mac[*d.Match.Ip2]
+				}
+
+			case SB_PASS:
+				if d.Match.Smac != nil && ip2mac[*d.Match.Smac] != nil {
+					d.Match.Smac = ip2mac[*d.Match.Smac]
+				}
+
+			default:
+				continue
+		}
+
+		host := sb_host( d )
+		if host == "" {
+			continue
+		}
+		host = rc.host4( host )
+
+		key := rc_key( w.kind, d )
+		keys[key] = true
+		w.added = rc.pushed[key]
+		if rc.want[host] == nil {
+			rc.want[host] = make( map[string]*rc_want )
+		}
+		rc.want[host][key] = w
+	}
+
+	for k := range rc.pushed {
+		if ! keys[k] {
+			delete( rc.pushed, k )
+		}
+	}
+}
+
+/*
+	Save the queue entries (host/queue-data) by host.
+*/
+func (rc *reconciler) set_queues( qlist []string ) {
+	if rc == nil {
+		return
+	}
+
+	rc.qwant = make( map[string][]string )
+	for _, q := range qlist {
+		toks := strings.SplitN( q, "/", 2 )
+		if len( toks ) == 2 {
+			h := rc.host4( toks[0] )
+			rc.qwant[h] = append( rc.qwant[h], q )
+		}
+	}
+}
+
+/*
+	Return the signatures of the flows that the request generates. Uncertain is true when the
+	flows cannot be determined (passthrough with an endpoint uuid).
+*/
+func (w *rc_want) sigs( ) ( sl []rc_sig, uncertain bool ) {
+	smac := strings.ToLower( rc_str( w.data.Match.Smac ) )
+	dmac := strings.ToLower( rc_str( w.data.Match.Dmac ) )
+
+	switch w.kind {
+		case SB_BW:
+			if smac == "" || dmac == "" {
+				return nil, true
+			}
+			sl = append( sl, rc_sig{ gizmos.OF_COOKIE_BW, smac, dmac } )
+			if ! w.data.Single_switch {
+				sl = append( sl, rc_sig{ gizmos.OF_COOKIE_BW, dmac, smac } )
+			}
+
+		case SB_BWOW:
+			if smac == "" {
+				return nil, true
+			}
+			sl = append( sl, rc_sig{ gizmos.OF_COOKIE_BWOW, smac, dmac } )
+
+		case SB_PASS:
+			if strings.Count( smac, ":" ) != 5 {
+				return nil, true
+			}
+			sl = append( sl, rc_sig{ gizmos.OF_COOKIE_PT, smac, "" } )
+	}
+
+	return sl, false
+}
+
+/*
+	Ask each driver for the state of the hosts it manages. Called once the desired state
+	has been received from res_mgr.
+*/
+func (rc *reconciler) request( sbt *sb_table, hlist *string ) {
+	if rc == nil || hlist == nil {
+		return
+	}
+
+	rc.last = time.Now().Unix()
+	for drv, hl := range sbt.split_hosts( hlist ) {
+		if err := drv.Request_state( hl ); err != nil {
+			fq_sheep.Baa( 2, "%s southbound driver: state not requested: %s", drv.Name(), err )
+		}
+	}
+}
+
+/*
+	Parse key=value tokens from a state line.
+*/
+func rc_kv( toks []string ) ( map[string]string ) {
+	m := make( map[string]string )
+	for _, t := range toks {
+		if kv := strings.SplitN( t, "=", 2 ); len( kv ) == 2 {
+			m[kv[0]] = kv[1]
+		}
+	}
+	return m
+}
+
+/*
+	Process the state returned by the agent (lines of flow, queues, state and error records;
+	see tegu_agent do_dump_state) and repair any drift.
+*/
+func (rc *reconciler) process( sbt *sb_table, rdata []string ) {
+	if rc == nil {
+		return
+	}
+
+	type hstate struct {
+		flows	map[rc_sig]bool
+		queues	int
+		done	bool
+		err		string
+	}
+
+	hosts := make( map[string]*hstate )
+	get := func( h string ) ( *hstate ) {
+		if hosts[h] == nil {
+			hosts[h] = &hstate{ flows: make( map[rc_sig]bool ), queues: -1 }
+		}
+		return hosts[h]
+	}
+
+	for _, line := range rdata {
+		toks := strings.Fields( line )
+		if len( toks ) < 2 {
+			continue
+		}
+		kv := rc_kv( toks[1:] )
+		h := kv["host"]
+		if h == "" {
+			continue
+		}
+
+		switch toks[0] {
+			case "flow":
+				var cookie uint64
+				if _, err := fmt.Sscanf( kv["cookie"], "0x%x", &cookie ); err == nil {
+					get( h ).flows[rc_sig{ cookie, kv["src"], kv["dst"] }] = true
+				}
+
+			case "queues":
+				fmt.Sscanf( kv["count"], "%d", &get( h ).queues )
+
+			case "state":
+				get( h ).done = true
+
+			case "error":
+				get( h ).err = strings.Join( toks[2:], " " )
+		}
+	}
+
+	now := time.Now().Unix()
+	for h, hs := range hosts {
+		st := rc.stats[h]
+		if st == nil {
+			st = &Rc_stats{ Host: h }
+			rc.stats[h] = st
+		}
+		st.Last = now
+		st.Error = hs.err
+		if ! hs.done {
+			continue									// errors or partial data; nothing is changed
+		}
+
+		drv := sbt.for_host( h )
+		desired := make( map[rc_sig]bool )
+		uncertain := make( map[uint64]bool )
+		st.Missing = 0
+		st.Orphans = 0
+		st.Qdrift = ""
+
+		for k, w := range rc.want[h] {
+			if w.data.Expiry <= now {
+				delete( rc.want[h], k )
+				continue
+			}
+
+			sl, unsure := w.sigs()
+			if unsure {
+				uncertain[gizmos.OF_COOKIE_PT] = true
+				if w.kind != SB_PASS {
+					uncertain[gizmos.OF_COOKIE_BW] = true		// mac translation not yet known; be safe
+					uncertain[gizmos.OF_COOKIE_BWOW] = true
+				}
+			}
+
+			missing := false
+			for _, s := range sl {
+				desired[s] = true
+				if ! hs.flows[s] {
+					missing = true
+				}
+			}
+
+			if missing && w.settled && w.added + rc.grace <= now && w.data.Expiry - now > SB_REMOVE_DELAY {		// acknowledged, not just pushed and not being removed
+				st.Missing++
+				if rc.fix {
+					if sb_install( sbt, w.kind, w.data.Clone() ) == nil {
+						st.Reinstalled++
+					}
+				}
+			}
+		}
+
+		recent := rc.hpushed[h] >= rc.wanted			// pushed after the desired state was built; flows may be newer than it
+		for s := range hs.flows {
+			if desired[s] || uncertain[s.cookie] || recent {
+				continue
+			}
+			st.Orphans++
+			if rc.fix {
+				if err := drv.Remove_flows( h, s.cookie, s.src, s.dst ); err == nil {
+					st.Removed++
+				} else {
+					fq_sheep.Baa( 1, "WRN: %s southbound driver: unable to remove orphaned flows on %s: %s  [TGUFQM016]", drv.Name(), h, err )
+				}
+			}
+		}
+
+		st.Flows = len( hs.flows )
+		st.Desired = len( rc.want[h] )
+		st.Queues = hs.queues
+		if rc.queues && hs.queues >= 0 {
+			switch {
+				case len( rc.qwant[h] ) > 0 && hs.queues == 0:
+					st.Qdrift = "missing"
+					if rc.fix {
+						if err := drv.Set_queues( rc.qwant[h], nil ); err != nil {
+							fq_sheep.Baa( 1, "WRN: %s southbound driver: unable to reset queues on %s: %s  [TGUFQM016]", drv.Name(), h, err )
+						}
+					}
+
+				case len( rc.qwant[h] ) == 0 && hs.queues > 0:
+					st.Qdrift = "orphaned"
+					if rc.fix {
+						if err := drv.Purge_queues( h ); err != nil {
+							fq_sheep.Baa( 1, "WRN: %s southbound driver: unable to purge queues on %s: %s  [TGUFQM016]", drv.Name(), h, err )
+						}
+					}
+			}
+		}
+
+		if st.Missing > 0 || st.Orphans > 0 || st.Qdrift != "" {
+			fq_sheep.Baa( 1, "reconcile: %s: %d flows, %d desired, %d missing, %d orphaned, queues %s fix=%v", h, st.Flows, st.Desired, st.Missing, st.Orphans, st.Qdrift, rc.fix )
+		} else {
+			fq_sheep.Baa( 2, "reconcile: %s: %d flows, %d desired, no drift", h, st.Flows, st.Desired )
+		}
+	}
+}
+
+/*
+	Generate the json drift report (hosts sorted by name).
+*/
+func (rc *reconciler) to_json( ) ( string ) {
+	type report struct {
+		Fix			bool
+		Requested	int64
+		Hosts		[]*Rc_stats
+	}
+
+	r := &report{ Hosts: make( []*Rc_stats, 0 ) }
+	if rc != nil {
+		r.Fix = rc.fix
+		r.Requested = rc.last
+		names := make( []string, 0, len( rc.stats ) )
+		for h := range rc.stats {
+			names = append( names, h )
+		}
+		sort.Strings( names )
+		for _, h := range names {
+			r.Hosts = append( r.Hosts, rc.stats[h] )
+		}
+	}
+
+	j, err := json.Marshal( r )
+	if err != nil {
+		return "{}"
+	}
+	return string( j )
+}
@@ -0,0 +1,230 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	fq_reconcile_test
+	Abstract:	Tests for the reconciler: drift between the desired state (as res_mgr
+				would supply it) and the state reported for a host is detected, and is
+				repaired only when fixing is enabled. A fake southbound driver records
+				what the reconciler asked it to do.
+	Date:		19 Oct 2026
+*/
+
+package managers
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/att/gopkgs/bleater"
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Southbound driver which records requests rather than acting on them.
+*/
+type fake_south struct {
+	installed	[]*Fq_req
+	removed		[]*Fq_req
+	flows_rm	[]string					// host cookie smac dmac of each Remove_flows call
+	queues		[][]string
+	purged		[]string
+}
+
+func (fs *fake_south) Name( ) ( string ) { return "fake" }
+func (fs *fake_south) Map_mac2phost( hlist *string ) ( error ) { return nil }
+func (fs *fake_south) Intermed_queues( hlist *string ) ( error ) { return nil }
+func (fs *fake_south) Request_state( hlist *string ) ( error ) { return nil }
+
+func (fs *fake_south) Install_flow( kind int, data *Fq_req ) ( error ) {
+	fs.installed = append( fs.installed, data )
+	return nil
+}
+
+func (fs *fake_south) Remove_flow( kind int, data *Fq_req ) ( error ) {
+	fs.removed = append( fs.removed, data )
+	return nil
+}
+
+func (fs *fake_south) Set_queues( qlist []string, hlist *string ) ( error ) {
+	fs.queues = append( fs.queues, qlist )
+	return nil
+}
+
+func (fs *fake_south) Remove_flows( host string, cookie uint64, smac string, dmac string ) ( error ) {
+	fs.flows_rm = append( fs.flows_rm, fmt.Sprintf( "%s 0x%x %s %s", host, cookie, smac, dmac ) )
+	return nil
+}
+
+func (fs *fake_south) Purge_queues( host string ) ( error ) {
+	fs.purged = append( fs.purged, host )
+	return nil
+}
+
+/*
+	Driver table with the fake as the only driver.
+*/
+func mk_fake_sbt( ) ( *sb_table, *fake_south ) {
+	if fq_sheep == nil {
+		fq_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	}
+
+	fs := &fake_south{}
+	return &sb_table{ def: fs, all: []southbound{ fs }, prev: make( map[southbound]string ) }, fs
+}
+
+var rc_ip2mac = map[string]*string {
+	"10.0.0.1":	str_ptr( "fa:16:3e:00:00:01" ),
+	"10.0.0.2":	str_ptr( "fa:16:3e:00:00:02" ),
+}
+
+func str_ptr( s string ) ( *string ) {
+	return &s
+}
+
+/*
+	Build a desired bandwidth request between 10.0.0.1 and 10.0.0.2 on host cn1 as res_mgr would.
+*/
+func rc_bw_want( rname string, settled bool ) ( *rc_want ) {
+	fr := Mk_fqreq( str_ptr( rname ) )
+	fr.Espq = gizmos.Mk_spq( "cn1", 2, 3 )
+	fr.Match.Ip1 = str_ptr( "10.0.0.1" )
+	fr.Match.Ip2 = str_ptr( "10.0.0.2" )
+	fr.Tptype = str_ptr( "tcp" )
+	fr.Extip = &empty_str
+	fr.Expiry = time.Now().Unix() + 3600
+
+	return &rc_want{ kind: SB_BW, data: fr, settled: settled }
+}
+
+/*
+	Host state as the agent reports it: the forward flow of the reservation (the reverse flow
+	is missing), an orphaned flow, and no queues.
+*/
+func rc_state( ) ( []string ) {
+	return []string {
+		fmt.Sprintf( "flow host=cn1 cookie=0x%x src=fa:16:3e:00:00:01 dst=fa:16:3e:00:00:02", gizmos.OF_COOKIE_BW ),
+		fmt.Sprintf( "flow host=cn1 cookie=0x%x src=fa:16:3e:00:00:09 dst=fa:16:3e:00:00:02", gizmos.OF_COOKIE_BW ),
+		"queues host=cn1 count=0",
+		"state host=cn1",
+	}
+}
+
+func Test_reconcile_drift( t *testing.T ) {
+	fmt.Fprintf( os.Stderr, "\n------- reconcile drift report ---------\n" )
+	sbt, fs := mk_fake_sbt()
+
+	rc := mk_reconciler( nil, false, 60, true )
+	rc.set_queues( []string{ "cn1/2,r1,3,1000,2000,100" } )
+	rc.set_want( []*rc_want{ rc_bw_want( "r1", true ) }, rc_ip2mac )
+	rc.process( sbt, rc_state() )
+
+	st := rc.stats["cn1"]
+	if st == nil {
+		fmt.Fprintf( os.Stderr, "FAIL: no stats for the host\n" )
+		t.FailNow()
+	}
+	if st.Missing != 1 || st.Orphans != 1 || st.Qdrift != "missing" || st.Desired != 1 || st.Flows != 2 {
+		fmt.Fprintf( os.Stderr, "FAIL: drift not detected: %+v\n", st )
+		t.Fail()
+	}
+	if len( fs.installed ) + len( fs.flows_rm ) + len( fs.queues ) + len( fs.purged ) > 0 {
+		fmt.Fprintf( os.Stderr, "FAIL: report only reconciler changed something\n" )
+		t.Fail()
+	}
+	if j := rc.to_json(); ! strings.Contains( j, `"Host":"cn1"` ) || ! strings.Contains( j, `"Fix":false` ) {
+		fmt.Fprintf( os.Stderr, "FAIL: drift report is missing the host: %s\n", j )
+		t.Fail()
+	}
+
+	rc.set_want( nil, rc_ip2mac )									// nothing desired: both flows are orphans and queues are orphaned
+	rc.set_queues( nil )
+	rc.process( sbt, []string{ rc_state()[0], "queues host=cn1 count=4", "state host=cn1" } )
+	if st.Missing != 0 || st.Orphans != 1 || st.Qdrift != "orphaned" {
+		fmt.Fprintf( os.Stderr, "FAIL: orphans not detected with nothing desired: %+v\n", st )
+		t.Fail()
+	}
+
+	rc.process( sbt, []string{ "error host=cn1 ovs-ofctl failed" } )	// incomplete state changes nothing
+	if st.Error == "" || st.Orphans != 1 {
+		fmt.Fprintf( os.Stderr, "FAIL: error state not recorded or counted as drift: %+v\n", st )
+		t.Fail()
+	}
+}
+
+func Test_reconcile_repair( t *testing.T ) {
+	fmt.Fprintf( os.Stderr, "\n------- reconcile repair ---------------\n" )
+	sbt, fs := mk_fake_sbt()
+
+	rc := mk_reconciler( nil, true, 60, true )
+	rc.set_queues( []string{ "cn1/2,r1,3,1000,2000,100" } )
+	rc.set_want( []*rc_want{ rc_bw_want( "r1", true ) }, rc_ip2mac )
+	rc.process( sbt, rc_state() )
+
+	st := rc.stats["cn1"]
+	if len( fs.installed ) != 1 || st.Reinstalled != 1 {
+		fmt.Fprintf( os.Stderr, "FAIL: missing flows not reinstalled: %d %+v\n", len( fs.installed ), st )
+		t.Fail()
+	} else {
+		if d := fs.installed[0]; *d.Id != "r1" || d.Match.Smac == nil || *d.Match.Smac != "fa:16:3e:00:00:01" {
+			fmt.Fprintf( os.Stderr, "FAIL: wrong request reinstalled: %s\n", fq2str( d ) )
+			t.Fail()
+		}
+	}
+	if len( fs.flows_rm ) != 1 || fs.flows_rm[0] != fmt.Sprintf( "cn1 0x%x fa:16:3e:00:00:09 fa:16:3e:00:00:02", gizmos.OF_COOKIE_BW ) || st.Removed != 1 {
+		fmt.Fprintf( os.Stderr, "FAIL: orphaned flow not removed: %v\n", fs.flows_rm )
+		t.Fail()
+	}
+	if len( fs.queues ) != 1 {
+		fmt.Fprintf( os.Stderr, "FAIL: missing queues not set again\n" )
+		t.Fail()
+	}
+
+	fs.installed = nil											// push not yet acknowledged: missing flows are left alone
+	rc.set_want( []*rc_want{ rc_bw_want( "r1", false ) }, rc_ip2mac )
+	rc.process( sbt, rc_state() )
+	if len( fs.installed ) != 0 || st.Missing != 0 {
+		fmt.Fprintf( os.Stderr, "FAIL: flows of an unacknowledged push were reinstalled\n" )
+		t.Fail()
+	}
+
+	rc.add( SB_BW, rc_bw_want( "r1", true ).data )				// just pushed: within the grace period
+	rc.set_want( []*rc_want{ rc_bw_want( "r1", true ) }, rc_ip2mac )
+	rc.process( sbt, rc_state() )
+	if len( fs.installed ) != 0 {
+		fmt.Fprintf( os.Stderr, "FAIL: flows pushed within the grace period were reinstalled\n" )
+		t.Fail()
+	}
+
+	fs.flows_rm = nil											// host pushed to after the desired state was built
+	rc.set_want( nil, rc_ip2mac )
+	rc.add( SB_BW, rc_bw_want( "r2", true ).data )
+	rc.process( sbt, rc_state() )
+	if len( fs.flows_rm ) != 0 {
+		fmt.Fprintf( os.Stderr, "FAIL: flows removed from a host pushed to after the desired state was built: %v\n", fs.flows_rm )
+		t.Fail()
+	}
+	if len( rc.pushed ) != 1 {
+		fmt.Fprintf( os.Stderr, "FAIL: push times of requests no longer desired were kept: %d\n", len( rc.pushed ) )
+		t.Fail()
+	}
+}
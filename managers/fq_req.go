@@ -29,6 +29,9 @@
 				20 Apr 2015 : Correct bug - not passing direction of external IP address to agent.
 				01 Sep 2015 : Changed bleat level for bwow debugging message.
 				04 Feg 2015 : Tweak to allow udp:0 and tcp:0 to be passed to agent.
+				19 Oct 2026 : Timeout of 0 plus expiry when the request has no hard timeout.
+				19 Oct 2026 : Meter id passed in bw/bwow maps for the meter queue policy.
+				19 Oct 2026 : Split (per path port/queue/share) and its group id passed in the bw map.
 */
 
 package managers
@@ -36,6 +39,7 @@ package managers
 import (
 	"fmt"
 	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/att/tegu/gizmos"
@@ -96,6 +100,10 @@ func ( src *Fq_req ) Clone( ) ( nr *Fq_req ) {
 	}
 
 	nr.Espq = nespq
+	if src.Split != nil {
+		nr.Split = make( []string, len( src.Split ) )
+		copy( nr.Split, src.Split )
+	}
 	nr.Match = nmatch			// must reset pointers in new to copies of match and action
 	nr.Action = naction
 
@@ -163,7 +171,14 @@ func ( fq *Fq_req ) To_bw_map( ) ( fmap map[string]string ) {
 	fmap["queue"] =  fmt.Sprintf( "%d", fq.Espq.Queuenum )
 	fmap["dscp"] =  fmt.Sprintf( "%d", fq.Dscp << 2 )						// shift left 2 bits to match what OVS wants
 	fmap["ipv6"] =  fmt.Sprintf( "%v", fq.Ipv6 )							// force ipv6 fmods is on
-	fmap["timeout"] =  fmt.Sprintf( "%d", fq.Expiry - time.Now().Unix() )
+	fq.set_timeout( fmap )
+	if fq.Meter > 0 {
+		fmap["meter"] = fmt.Sprintf( "%d", fq.Meter )						// meter queue policy; agent meters rather than queues
+	}
+	if len( fq.Split ) > 1 {
+		fmap["group"] = strings.Join( fq.Split, " " )						// split across paths; agent builds a select group
+		fmap["group_id"] = fmt.Sprintf( "0x%x", fq.Group )
+	}
 	//fmap["mtbase"] =  fmt.Sprintf( "%d", fq.Mtbase )
 	fmap["oneswitch"] = fmt.Sprintf( "%v", fq.Single_switch )
 	fmap["koe"] = fmt.Sprintf( "%v", fq.Dscp_koe )
@@ -231,7 +246,10 @@ func ( fq *Fq_req ) To_bwow_map( ) ( fmap map[string]string ) {
 	fmap["queue"] =  fmt.Sprintf( "%d", fq.Espq.Queuenum )
 	fmap["dscp"] =  fmt.Sprintf( "%d", fq.Dscp << 2 )						// shift left 2 bits to match what OVS wants
 	fmap["ipv6"] =  fmt.Sprintf( "%v", fq.Ipv6 )							// force ipv6 fmods is on
-	fmap["timeout"] =  fmt.Sprintf( "%d", fq.Expiry - time.Now().Unix() )
+	fq.set_timeout( fmap )
+	if fq.Meter > 0 {
+		fmap["meter"] = fmt.Sprintf( "%d", fq.Meter )						// meter queue policy; agent meters rather than queues
+	}
 	if fq.Tptype != nil && *fq.Tptype != "none" && *fq.Tptype != "" {					// if transport prototype defined, turn it on
 		if fq.Match.Tpsport != nil 	{													// set src and dest ports if they are defined too
 			fmap["sproto"] = fmt.Sprintf( "%s:%s", *fq.Tptype, *fq.Match.Tpsport )
@@ -269,7 +287,7 @@ func ( fq *Fq_req ) To_pt_map( ) ( fmap map[string]string ) {
 		fmap["smac"] = ""						// agent likely to barf on this
 	}
 
-	fmap["timeout"] =  fmt.Sprintf( "%d", fq.Expiry - time.Now().Unix() )
+	fq.set_timeout( fmap )
 	fmap["sip"] = *fq.Match.Ip1								// will be [{udp|tcp}:]address[:port]
 
 	if fq_sheep.Would_baa( 3 ) {
@@ -280,3 +298,17 @@ func ( fq *Fq_req ) To_pt_map( ) ( fmap map[string]string ) {
 
 	return
 }
+
+/*
+	Set the timeout parameter in an agent parm map. When the request is flagged for no hard
+	timeout the timeout is 0 (the flow-mod never expires on its own) and the expiry time is
+	added so that the agent can remove the flow-mods itself if tegu never gets round to it.
+*/
+func ( fq *Fq_req ) set_timeout( fmap map[string]string ) {
+	if fq.No_hto {
+		fmap["timeout"] = "0"
+		fmap["expiry"] = fmt.Sprintf( "%d", fq.Expiry )
+	} else {
+		fmap["timeout"] =  fmt.Sprintf( "%d", fq.Expiry - time.Now().Unix() )
+	}
+}
@@ -0,0 +1,314 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	fq_sb_agent
+	Abstract:	The agent southbound driver. Requests are converted to agent actions and
+				passed to the agent manager which routes them to the agent(s) covering
+				the target host; the agent then runs the appropriate script on the host.
+				This is a thin wrapper round the send_* functions that fq_mgr has always
+				used.
+
+	Date:		18 Oct 2026
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+type agent_south struct {
+	env		*sb_env
+}
+
+func (as *agent_south) Name( ) ( string ) {
+	return "agent"
+}
+
+/*
+	Generate the flow-mod(s) for the request and pass them to the agent manager.
+*/
+func (as *agent_south) Install_flow( kind int, data *Fq_req ) ( error ) {
+	if data == nil {
+		return fmt.Errorf( "agent southbound driver: no data for %s flow-mod", sb_kind2str( kind ) )
+	}
+
+	switch kind {
+		case SB_BW:
+			return send_bw_fmods( as.metered( data ), as.env.ip2mac, as.env.phost_suffix )
+
+		case SB_BWOW:
+			return send_bwow_fmods( as.metered( data ), as.env.ip2mac, as.env.phost_suffix )
+
+		case SB_PASS:
+			return send_pt_fmods( data, as.env.ip2mac, as.env.phost_suffix )
+
+		case SB_GENERIC:
+			send_gfmod_agent( data, as.env.ip2mac, as.env.host_list, as.env.phost_suffix )
+
+		case SB_IE:
+			as.ie_fmods( data )
+
+		case SB_STEER:
+			send_stfmod_agent( data, as.env.ip2mac, as.env.host_list )
+
+		default:
+			return fmt.Errorf( "agent southbound driver: unknown flow-mod kind: %d", kind )
+	}
+
+	return nil
+}
+
+/*
+	Bandwidth, oneway and passthru flow-mods are deleted on the host by the agent which
+	builds the reservation's flows from the same parms used to install them and removes
+	each with a strict delete (priority, cookie and the full match: macs, ports, protocol,
+	vlan, external address). Flows of other reservations between the same endpoints are
+	left alone. A steering flow-mod which sends to a select group is removed by deleting
+	the group (which takes the flow-mods that reference it with it). Other kinds are
+	reinstalled with a short hard timeout which forces them out (the same approach used
+	when pausing).
+*/
+func (as *agent_south) Remove_flow( kind int, data *Fq_req ) ( error ) {
+	if data == nil {
+		return nil
+	}
+
+	if kind == SB_STEER {										// steering may target all hosts and its expiry is a duration
+		if data.Nxt_group != nil {
+			send_stgroup_del( data, as.env.host_list )
+			return nil
+		}
+		cdata := data.Clone()
+		cdata.Expiry = SB_REMOVE_DELAY
+		return as.Install_flow( kind, cdata )
+	}
+
+	h := sb_host( data )
+	if h == "" {
+		return fmt.Errorf( "agent southbound driver: no host for %s flow-mod removal", sb_kind2str( kind ) )
+	}
+	host := &h
+	if as.env.phost_suffix != nil {
+		host = add_phost_suffix( host, as.env.phost_suffix )
+	}
+
+	mac := func( ip *string ) ( *string ) {
+		if ip != nil {
+			return as.env.ip2mac[*ip]
+		}
+		return nil
+	}
+
+	cdata := data.Clone()										// macs are filled in as for the install; caller's request is not changed
+	var rtype string
+	var parms map[string]string
+	switch kind {
+		case SB_BW:
+			cdata.Match.Smac = mac( data.Match.Ip1 )
+			cdata.Match.Dmac = mac( data.Match.Ip2 )
+			if cdata.Match.Smac == nil || cdata.Match.Dmac == nil {
+				return fmt.Errorf( "agent southbound driver: unable to map bandwidth endpoints to mac addresses for flow-mod removal on %s", *host )
+			}
+			rtype = "bw_fmod"
+			parms = cdata.To_bw_map()
+
+		case SB_BWOW:
+			cdata.Match.Smac = mac( data.Match.Ip1 )
+			cdata.Match.Dmac = mac( data.Match.Ip2 )
+			if cdata.Match.Smac == nil {
+				return fmt.Errorf( "agent southbound driver: unable to map oneway source to a mac address for flow-mod removal on %s", *host )
+			}
+			rtype = "bwow_fmod"
+			parms = cdata.To_bwow_map()
+
+		case SB_PASS:
+			if m := mac( data.Match.Smac ); m != nil {
+				cdata.Match.Smac = m
+			}
+			if cdata.Match.Smac == nil {
+				return fmt.Errorf( "agent southbound driver: no passthru host for flow-mod removal on %s", *host )
+			}
+			rtype = "passthru"
+			parms = cdata.To_pt_map()
+
+		default:
+			cdata.Expiry = time.Now().Unix() + SB_REMOVE_DELAY
+			cdata.No_hto = false
+			return as.Install_flow( kind, cdata )
+	}
+
+	parms["rtype"] = rtype
+	return send_agent_action( action{ Atype: "del_res_fmods", Hosts: []string{ *host }, Data: parms }, false )
+}
+
+/*
+	Return the request with the meter set when the target host uses meters for reservation
+	bandwidth; the caller's request is not changed.
+*/
+func (as *agent_south) metered( data *Fq_req ) ( *Fq_req ) {
+	h := sb_host( data )
+	if h == "" {
+		return data
+	}
+	host := &h
+	if as.env.phost_suffix != nil {
+		host = add_phost_suffix( host, as.env.phost_suffix )
+	}
+
+	if m := as.env.host_meter( *host, data ); m > 0 {
+		data = data.Clone()
+		data.Meter = m
+	}
+	return data
+}
+
+func (as *agent_south) Set_queues( qlist []string, hlist *string ) ( error ) {
+	adjust_queues_agent( as.env.meter_queues( qlist ), hlist, as.env )
+	return nil
+}
+
+/*
+	Ask the agent(s) which queue policy mechanisms the hosts support. The reply is passed
+	from the agent manager to fq_mgr as a REQ_QPCAPS.
+*/
+func (as *agent_south) request_qcaps( hlist *string ) {
+	hosts := strings.Fields( *hlist )
+	if as.env.phost_suffix != nil {
+		for i := range hosts {
+			hosts[i] = *add_phost_suffix( &hosts[i], as.env.phost_suffix )
+		}
+	}
+
+	if err := send_agent_action( action{ Atype: "qpolicy_caps", Hosts: hosts }, true ); err != nil {
+		fq_sheep.Baa( 1, "WRN: unable to request queue policy capabilities: %s  [TGUFQM019]", err )
+	}
+}
+
+/*
+	Ask the agent manager to map the hosts now; it continues to refresh the map for
+	the hosts it was given by fq_mgr.
+*/
+func (as *agent_south) Map_mac2phost( hlist *string ) ( error ) {
+	tmsg := ipc.Mk_chmsg( )
+	tmsg.Send_req( am_ch, nil, REQ_MAC2PHOST, hlist, nil )
+	return nil
+}
+
+func (as *agent_south) Intermed_queues( hlist *string ) ( error ) {
+	tmsg := ipc.Mk_chmsg( )
+	tmsg.Send_req( am_ch, nil, REQ_INTERMEDQ, hlist, nil )
+	return nil
+}
+
+/*
+	Send an action, built for the agent, to the agent manager for routing.
+*/
+func send_agent_action( act action, long bool ) ( error ) {
+	msg := &agent_cmd{ Ctype: "action_list", Actions: []action{ act } }
+	jmsg, err := json.Marshal( msg )
+	if err != nil {
+		return fmt.Errorf( "unable to build json for %s action: %s", act.Atype, err )
+	}
+
+	mtype := REQ_SENDSHORT
+	if long {
+		mtype = REQ_SENDLONG
+	}
+	tmsg := ipc.Mk_chmsg( )
+	tmsg.Send_req( am_ch, nil, mtype, string( jmsg ), nil )
+	return nil
+}
+
+/*
+	Ask the agent(s) for the reservation flows and queues installed on the hosts. The reply
+	is passed from the agent manager to fq_mgr as a REQ_RECONCILE.
+*/
+func (as *agent_south) Request_state( hlist *string ) ( error ) {
+	if hlist == nil || *hlist == "" {
+		return nil
+	}
+
+	cookies := fmt.Sprintf( "0x%x 0x%x 0x%x", gizmos.OF_COOKIE_BW, gizmos.OF_COOKIE_BWOW, gizmos.OF_COOKIE_PT )
+	return send_agent_action( action{ Atype: "dump_state", Hosts: strings.Fields( *hlist ), Data: map[string]string{ "cookies": cookies } }, true )
+}
+
+func (as *agent_south) Remove_flows( host string, cookie uint64, smac string, dmac string ) ( error ) {
+	data := map[string]string{ "cookie": fmt.Sprintf( "0x%x", cookie ), "smac": smac, "dmac": dmac }
+	return send_agent_action( action{ Atype: "del_fmods", Hosts: []string{ host }, Data: data }, false )
+}
+
+func (as *agent_south) Purge_queues( host string ) ( error ) {
+	return send_agent_action( action{ Atype: "purge_queues", Hosts: []string{ host } }, false )
+}
+
+/*
+	Proactive ingress/egress reservation flowmod. Q-lite generates one flowmod in each
+	direction because of the ITONS requirements. (This is likely deprecated as of 3/21/2015;
+	resmgr invokes the bw_fmods script via agent.)
+*/
+func (as *agent_south) ie_fmods( fdata *Fq_req ) {
+	if ! as.env.send_all && fdata.Espq.Queuenum <= 1 {		// only when sending all fmods, or this has a non-intermediate queue
+		return
+	}
+
+	cdata := fdata.Clone()					// copy so we can alter w/o affecting sender's copy
+	if cdata.Espq.Port == -128 {			// we'll assume in this case that the switch given is the host name and we need to set the switch to br-int
+		swid := "br-int"
+		cdata.Swid = &swid
+	}
+
+	if cdata.Resub == nil {
+		resub_list := ""						 // resub to alternate table to set a meta mark, then to table 0 to hit openstack junk
+		if cdata.Single_switch || fdata.Dir_in {					// must use the base table for inbound traffic OR same switch traffic (bug 2015/1/26)
+			resub_list = fmt.Sprintf( "%d 0", as.env.alt_table )			// base alt_table is for 'local' traffic (trafic that doesn't go through br-rl
+		} else {
+			resub_list = fmt.Sprintf( "%d 0", as.env.alt_table + 1 )		// base+1 is for OUTBOUND only traffic that must go through the rate limiting bridge
+		}
+		cdata.Resub = &resub_list
+	}
+
+	meta := "0x00/0x07"						// match-value/mask; match only when meta neither of our two bits, nor the agent bit (0x04) are set
+	cdata.Match.Meta = &meta
+
+	if fdata.Dir_in  {						// inbound to this switch we need to revert dscp from our settings to the 'origianal' settings
+		if cdata.Single_switch {
+			cdata.Match.Dscp =  -1				// there is no match if both on same switch
+		} else {
+			cdata.Match.Dscp = cdata.Dscp						// match the dscp that was added on ingress
+			if ! cdata.Dscp_koe {								// dropping the value on exit
+				cdata.Action.Dscp = 0							// set action to turn it off, otherwise we let it ride (no overt action)
+			}
+		}
+	} else {													// outbound from this switch set the dscp value specified on the reservation
+		cdata.Match.Dscp =  -1									// on outbound there is no dscp match, ensure this is off
+		if ! cdata.Single_switch {
+			cdata.Action.Dscp = cdata.Dscp						// in single switch mode there is no dscp value needed
+		}
+	}
+
+	send_gfmod_agent( cdata,  as.env.ip2mac, as.env.host_list, as.env.phost_suffix )
+}
@@ -0,0 +1,157 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	fq_sb_agent_test
+	Abstract:	Tests for the agent southbound driver: the removal of a reservation's
+				flow-mods names only that reservation's flows, and each direction of a
+				reservation is given its own meter. The agent manager channel is replaced
+				with a buffered channel so that the actions sent can be read.
+	Date:		19 Oct 2026
+*/
+
+package managers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Read the actions sent to the agent manager.
+*/
+func am_actions( ch chan *ipc.Chmsg ) ( al []action ) {
+	for {
+		select {
+			case m := <- ch:
+				cmd := &agent_cmd{}
+				if s, ok := m.Req_data.( string ); ok && json.Unmarshal( []byte( s ), cmd ) == nil {
+					al = append( al, cmd.Actions... )
+				}
+
+			default:
+				return al
+		}
+	}
+}
+
+func Test_agent_remove_flow( t *testing.T ) {
+	fmt.Fprintf( os.Stderr, "\n------- agent reservation removal ------\n" )
+	mk_fake_sbt()														// sets up the sheep
+	save_ch := am_ch
+	am_ch = make( chan *ipc.Chmsg, 16 )
+	defer func() { am_ch = save_ch }()
+
+	as := &agent_south{ env: &sb_env{ ip2mac: rc_ip2mac } }
+
+	r1 := rc_bw_want( "r1", true ).data
+	r1.Match.Tpdport = str_ptr( "80" )
+	r2 := rc_bw_want( "r2", true ).data
+	r2.Match.Tpdport = str_ptr( "443" )
+	for _, r := range []*Fq_req{ r1, r2 } {
+		if err := as.Remove_flow( SB_BW, r ); err != nil {
+			fmt.Fprintf( os.Stderr, "FAIL: remove of %s failed: %s\n", *r.Id, err )
+			t.FailNow()
+		}
+	}
+
+	al := am_actions( am_ch )
+	if len( al ) != 2 {
+		fmt.Fprintf( os.Stderr, "FAIL: expected one action for each reservation, have %d\n", len( al ) )
+		t.FailNow()
+	}
+	for i, port := range []string{ "80", "443" } {
+		a := al[i]
+		if a.Atype != "del_res_fmods" || a.Data["rtype"] != "bw_fmod" || a.Hosts[0] != "cn1" || a.Data["dproto"] != "tcp:" + port ||
+			a.Data["smac"] != "fa:16:3e:00:00:01" || a.Data["dmac"] != "fa:16:3e:00:00:02" {
+			fmt.Fprintf( os.Stderr, "FAIL: removal action does not name the reservation's flows: %s %v\n", a.Atype, a.Data )
+			t.Fail()
+		}
+	}
+	if r1.Match.Smac != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: removal changed the caller's request\n" )
+		t.Fail()
+	}
+
+	d1, _ := gizmos.Of_bw_flows( al[0].Data )							// what the agent deletes for r1 must not match r2's flows
+	d2, _ := gizmos.Of_bw_flows( al[1].Data )
+	if len( d1 ) != 2 || len( d2 ) != 2 {
+		fmt.Fprintf( os.Stderr, "FAIL: flows not built from the removal parms: %d %d\n", len( d1 ), len( d2 ) )
+		t.FailNow()
+	}
+	for i := range d1 {
+		if gizmos.Of_strict_del_str( d1[i] ) == gizmos.Of_strict_del_str( d2[i] ) {
+			fmt.Fprintf( os.Stderr, "FAIL: strict delete for r1 also matches r2: %s\n", gizmos.Of_strict_del_str( d1[i] ) )
+			t.Fail()
+		}
+	}
+
+	r3 := rc_bw_want( "r3", true ).data
+	r3.Match.Ip2 = str_ptr( "10.9.9.9" )								// no mac: nothing sent rather than a wildcarded delete
+	if err := as.Remove_flow( SB_BW, r3 ); err == nil || len( am_actions( am_ch ) ) != 0 {
+		fmt.Fprintf( os.Stderr, "FAIL: removal with an unmapped endpoint was sent\n" )
+		t.Fail()
+	}
+}
+
+func Test_agent_meter_per_direction( t *testing.T ) {
+	fmt.Fprintf( os.Stderr, "\n------- meter for each direction -------\n" )
+	mk_fake_sbt()
+	qp, err := gizmos.Mk_qpolicy( "htb " + gizmos.OF_RES_BRIDGE + ":meter" )
+	if err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: unable to make queue policy: %s\n", err )
+		t.FailNow()
+	}
+	env := &sb_env{ ip2mac: rc_ip2mac, qpolicy: qp }
+
+	mql := env.meter_queues( []string{								// both hosts on cn1; late binding ports are the source macs
+		"cn1/fa:16:3e:00:00:01,r1,2,2000000,2000000,200",
+		"cn1/fa:16:3e:00:00:02,r1,2,1000000,1000000,200",
+		"cn1/7,r2,2,1000000,1000000,200",
+	} )
+	ids := make( []string, len( mql ) )
+	for i, q := range mql {
+		toks := strings.Split( q, "," )
+		ids[i] = toks[len( toks )-1]
+	}
+	if ids[0] == ids[1] || ids[0] == ids[2] || ids[1] == ids[2] {
+		fmt.Fprintf( os.Stderr, "FAIL: directions of a reservation share a meter: %v\n", mql )
+		t.Fail()
+	}
+
+	out := rc_bw_want( "r1", true ).data
+	out.Qport = "cn1/fa:16:3e:00:00:01"
+	in := rc_bw_want( "r1", true ).data
+	in.Match.Ip1, in.Match.Ip2 = in.Match.Ip2, in.Match.Ip1
+	in.Qport = "cn1/fa:16:3e:00:00:02"
+	other := rc_bw_want( "r2", true ).data
+	other.Espq = gizmos.Mk_spq( "cn1", 7, 1 )							// no queue port: request's own switch/port used
+	for i, r := range []*Fq_req{ out, in, other } {
+		if m := env.host_meter( "cn1", r ); fmt.Sprintf( "%d", m ) != ids[i] {
+			fmt.Fprintf( os.Stderr, "FAIL: request %d does not use the meter of its queue: %d, queue has %s\n", i, m, ids[i] )
+			t.Fail()
+		}
+	}
+}
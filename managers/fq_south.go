@@ -0,0 +1,681 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	fq_south
+	Abstract:	The southbound interface used by fq_mgr to get flow-mods and queue settings
+				onto the physical hosts/switches. Fq_mgr no longer knows whether it is talking
+				to agents (which drive the ksh scripts on each host), to skoogi/floodlight,
+				or to nothing at all; it selects a driver for the host named in the request
+				and calls it.
+
+				Drivers:
+					agent	- the agent manager and the agent scripts (fq_sb_agent.go)
+					skoogi	- the legacy sdn controller interface; needs default:sdn_host
+					noop	- drops every request, but records it to the log and, if
+							  fqmgr:sb_record is set, appends a line to that file. Useful
+							  for testing and for sites that are managed by hand.
+
+				Selection is by the fqmgr:southbound config value which is a space separated
+				list of driver names, or pattern:driver pairs. A bare driver name sets the
+				default; a pattern (shell style, e.g. site1-*) is matched against the target
+				host name (with and without domain). The first matching pattern wins. When
+				no default is given it is agent. If an sdn host is configured, ingress/egress
+				(ie) flow-mods for hosts not matched by a pattern go to skoogi while everything
+				else goes to the agent, which is how fq_mgr split the work before drivers.
+
+	Date:		18 Oct 2026
+*/
+
+package managers
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+const (
+	SB_BW		int = iota		// bandwidth endpoint flow-mods
+	SB_BWOW						// oneway bandwidth flow-mods
+	SB_PASS						// passthrough flow-mods
+	SB_GENERIC					// generic flow-mod (meta marking etc.)
+	SB_IE						// proactive ingress/egress flow-mod
+	SB_STEER					// steering flow-mods
+
+	SB_REMOVE_DELAY int64 = 15	// seconds; flows which cannot be deleted are removed by reinstalling them with a short hard timeout
+)
+
+/*
+	Flow and queue operations that every southbound driver must provide. Install and remove
+	accept one of the SB_* kinds. A driver that cannot support an operation returns an error.
+	Request_state asks for the installed reservation flows and queues; the state arrives
+	later on the fq_mgr channel (REQ_RECONCILE). Remove_flows and Purge_queues are used by
+	the reconciler to remove things that no reservation accounts for.
+*/
+type southbound interface {
+	Name( ) ( string )
+	Install_flow( kind int, data *Fq_req ) ( error )
+	Remove_flow( kind int, data *Fq_req ) ( error )
+	Set_queues( qlist []string, hlist *string ) ( error )
+	Map_mac2phost( hlist *string ) ( error )
+	Intermed_queues( hlist *string ) ( error )
+	Request_state( hlist *string ) ( error )
+	Remove_flows( host string, cookie uint64, smac string, dmac string ) ( error )
+	Purge_queues( host string ) ( error )
+}
+
+/*
+	Information, maintained by fq_mgr, which the drivers need. Drivers hold a pointer so
+	they always see the current values.
+*/
+type sb_env struct {
+	ip2mac			map[string]*string
+	host_list		*string
+	phost_suffix	*string
+	alt_table		int
+	send_all		bool
+	uri_prefix		string				// skoogi uri (http://host:port)
+	record			*string				// file that the noop driver records to (nil == log only)
+	qpolicy			*gizmos.Qpolicy		// queue policy (mechanism by bridge) from the config
+	qcaps			map[string][]string	// queue policy mechanisms each host (suffixed name) reported
+	meters			map[string]*sb_meter	// meter ids allocated by reservation id and queue port (meter policy)
+}
+
+/*
+	A meter id allocated to a reservation queue. The id is held until the reservation has
+	expired and its queues are no longer in the queue list.
+*/
+type sb_meter struct {
+	id		int
+	expiry	int64
+}
+
+/*
+	Return the queue policy for the host: the configured policy with any mechanism that the
+	host reported it does not support replaced by htb. Host is the name with any suffix.
+*/
+func (env *sb_env) host_qpolicy( host string ) ( *gizmos.Qpolicy ) {
+	qp, dropped := env.qpolicy.Restrict( env.qcaps[host] )
+	if len( dropped ) > 0 {
+		fq_sheep.Baa( 2, "queue policy mechanism(s) not supported on %s, htb used: %s", host, strings.Join( dropped, " " ) )
+	}
+	return qp
+}
+
+/*
+	Build the meter key for a reservation's queue: the reservation id and the switch/port of
+	the queue as it appears in the queue list. Both directions of a reservation between two
+	hosts on the same switch leave by different ports, so each is given its own meter rather
+	than policing the sum of the two at one rate.
+*/
+func meter_key( rid string, qport string ) ( string ) {
+	return rid + "," + qport
+}
+
+/*
+	Return the meter id allocated to the key (meter_key), allocating the lowest free id if it
+	has none. Meters are per bridge, but ids are unique across all reservations so that two
+	reservations never share a meter no matter which ports their queues land on. Returns 0
+	if all ids are in use.
+*/
+func (env *sb_env) res_meter( key string, expiry int64 ) ( int ) {
+	if env.meters == nil {
+		env.meters = make( map[string]*sb_meter )
+	}
+
+	if m := env.meters[key]; m != nil {
+		if expiry > m.expiry {
+			m.expiry = expiry
+		}
+		return m.id
+	}
+
+	used := make( map[int]bool, len( env.meters ) )
+	for _, m := range env.meters {
+		used[m.id] = true
+	}
+	for id := 1; id <= int( gizmos.QP_METER_MAX ); id++ {
+		if ! used[id] {
+			env.meters[key] = &sb_meter{ id: id, expiry: expiry }
+			return id
+		}
+	}
+
+	fq_sheep.Baa( 0, "WRN: no free meter id for reservation queue %s; queue used  [TGUFQM020]", key )
+	return 0
+}
+
+/*
+	Add the meter id of the reservation's queue to each queue entry (host/port,res-id,queue,min,max,pri[,burst])
+	as a trailing field, and release the ids of reservations that have expired and no longer
+	have queues. The agent uses the id in place of the queue number when the bridge uses meters.
+*/
+func (env *sb_env) meter_queues( qlist []string ) ( mql []string ) {
+	now := time.Now().Unix()
+	seen := make( map[string]bool )
+
+	mql = make( []string, 0, len( qlist ) )
+	for _, q := range qlist {
+		toks := strings.Split( q, "," )
+		if len( toks ) < 6 || toks[2] == "0" {
+			mql = append( mql, q )
+			continue
+		}
+
+		key := meter_key( toks[1], toks[0] )
+		seen[key] = true
+		m := env.res_meter( key, now )
+		if len( toks ) < 7 {
+			toks = append( toks, "" )			// empty burst
+		}
+		mql = append( mql, fmt.Sprintf( "%s,%d", strings.Join( toks[0:7], "," ), m ) )
+	}
+
+	for key, m := range env.meters {
+		if ! seen[key] && m.expiry < now {
+			delete( env.meters, key )
+		}
+	}
+
+	return mql
+}
+
+/*
+	Return the meter id to use for a request on the host: the id of the meter for the request's
+	queue when the host's reservation bridge uses the meter policy, 0 otherwise (and for
+	requests split across paths). A request without a queue port falls back to its own
+	switch/port.
+*/
+func (env *sb_env) host_meter( host string, data *Fq_req ) ( int ) {
+	if data == nil || data.Espq == nil || data.Espq.Queuenum < 1 || data.Id == nil {
+		return 0
+	}
+	if len( data.Split ) > 1 {				// split across paths: one meter would cap the aggregate at a single share
+		return 0
+	}
+	if env.host_qpolicy( host ).For_bridge( gizmos.OF_RES_BRIDGE ) != gizmos.QP_METER {
+		return 0
+	}
+
+	qport := data.Qport
+	if qport == "" {
+		qport = fmt.Sprintf( "%s/%d", data.Espq.Switch, data.Espq.Port )
+	}
+	return env.res_meter( meter_key( *data.Id, qport ), data.Expiry )
+}
+
+/*
+	Map of host patterns to the driver that handles them.
+*/
+type sb_table struct {
+	pats	[]string
+	drvs	[]southbound
+	def		southbound
+	ie_def	southbound					// default for ie flow-mods when it is not def (nil == def)
+	all		[]southbound				// each driver once, for broadcast style operations
+	prev	map[southbound]string		// last host list given to each driver
+}
+
+/*
+	Return a string describing the kind of flow.
+*/
+func sb_kind2str( kind int ) ( string ) {
+	switch kind {
+		case SB_BW:		return "bw"
+		case SB_BWOW:	return "bwow"
+		case SB_PASS:	return "passthru"
+		case SB_GENERIC: return "generic"
+		case SB_IE:		return "ie"
+		case SB_STEER:	return "steer"
+	}
+
+	return fmt.Sprintf( "unknown(%d)", kind )
+}
+
+/*
+	Return the host that the request targets, or "" if the request is not host specific
+	(e.g. a generic flow-mod sent to all hosts).
+*/
+func sb_host( data *Fq_req ) ( string ) {
+	if data == nil {
+		return ""
+	}
+
+	if data.Espq != nil && data.Espq.Switch != "" {
+		return data.Espq.Switch
+	}
+	if data.Swid != nil {
+		return *data.Swid
+	}
+
+	return ""
+}
+
+/*
+	Create the driver for the name. Returns nil if the name is not known.
+*/
+func mk_southbound( name string, env *sb_env ) ( southbound ) {
+	switch name {
+		case "agent":
+			return &agent_south{ env: env }
+
+		case "skoogi":
+			return &skoogi_south{ env: env }
+
+		case "noop", "record":
+			return &noop_south{ env: env }
+	}
+
+	return nil
+}
+
+/*
+	Build the driver table from the config string (see header). Drivers are created once
+	and shared by all patterns naming them. Unknown driver names are logged and ignored.
+	If the config does not name a default, def_name is used, and ie_name (if not empty)
+	becomes the default for ie flow-mods.
+*/
+func mk_sb_table( cfg string, def_name string, ie_name string, env *sb_env ) ( st *sb_table ) {
+	st = &sb_table{ prev: make( map[southbound]string ) }
+	drivers := make( map[string]southbound )
+
+	get := func( name string ) ( southbound ) {
+		if d := drivers[name]; d != nil {
+			return d
+		}
+
+		d := mk_southbound( name, env )
+		if d == nil {
+			fq_sheep.Baa( 0, "ERR: unknown southbound driver in config ignored: %s  [TGUFQM011]", name )
+			return nil
+		}
+
+		drivers[name] = d
+		st.all = append( st.all, d )
+		return d
+	}
+
+	for _, tok := range strings.Fields( cfg ) {
+		if i := strings.LastIndex( tok, ":" ); i > 0 {
+			if d := get( tok[i+1:] ); d != nil {
+				st.pats = append( st.pats, tok[0:i] )
+				st.drvs = append( st.drvs, d )
+			}
+		} else {
+			if d := get( tok ); d != nil {
+				st.def = d
+			}
+		}
+	}
+
+	if st.def == nil {
+		st.def = get( def_name )
+		if ie_name != "" && ie_name != def_name {
+			st.ie_def = get( ie_name )
+		}
+	}
+
+	return st
+}
+
+/*
+	Return the driver whose pattern matches the host, or nil if none do.
+*/
+func (st *sb_table) match( host string ) ( southbound ) {
+	if host != "" {
+		sh := short_host( host )
+		for i, p := range st.pats {
+			if m, err := path.Match( p, host ); err == nil && m {
+				return st.drvs[i]
+			}
+			if m, err := path.Match( p, sh ); err == nil && m {
+				return st.drvs[i]
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+	Return the driver that handles the host.  Host may be empty in which case the default
+	driver is returned.
+*/
+func (st *sb_table) for_host( host string ) ( southbound ) {
+	if d := st.match( host ); d != nil {
+		return d
+	}
+
+	return st.def
+}
+
+/*
+	Return the driver that handles flow-mods of the kind for the host. This is the driver
+	for the host except that ie flow-mods use the ie default, if there is one, when no
+	pattern matches.
+*/
+func (st *sb_table) for_flow( kind int, host string ) ( southbound ) {
+	if d := st.match( host ); d != nil {
+		return d
+	}
+
+	if kind == SB_IE && st.ie_def != nil {
+		return st.ie_def
+	}
+	return st.def
+}
+
+/*
+	Split a space separated host list by the driver that handles each host.  Drivers
+	which have no hosts are not in the map.
+*/
+func (st *sb_table) split_hosts( hlist *string ) ( map[southbound]*string ) {
+	m := make( map[southbound]*string )
+	if hlist == nil {
+		return m
+	}
+
+	for _, h := range strings.Fields( *hlist ) {
+		d := st.for_host( h )
+		if m[d] == nil {
+			s := h
+			m[d] = &s
+		} else {
+			s := *m[d] + " " + h
+			m[d] = &s
+		}
+	}
+
+	return m
+}
+
+/*
+	Split a queue list (entries are host/queue-info) by the driver that handles each host.
+*/
+func (st *sb_table) split_queues( qlist []string ) ( map[southbound][]string ) {
+	m := make( map[southbound][]string )
+	for _, q := range qlist {
+		toks := strings.SplitN( q, "/", 2 )
+		d := st.for_host( toks[0] )
+		m[d] = append( m[d], q )
+	}
+
+	return m
+}
+
+/*
+	Install the flow using the driver for the request's target host, logging any error.
+*/
+func sb_install( st *sb_table, kind int, data *Fq_req ) ( err error ) {
+	drv := st.for_flow( kind, sb_host( data ) )
+	err = drv.Install_flow( kind, data )
+	if err != nil {
+		fq_sheep.Baa( 1, "WRN: %s southbound driver: unable to install %s flow-mods for %s: %s  [TGUFQM014]", drv.Name(), sb_kind2str( kind ), sb_host( data ), err )
+	}
+
+	return err
+}
+
+/*
+	Install the flows for a reservation push. Res_mgr counts each push request toward the
+	acknowledgements the pledge waits on before it is considered pushed. The agent manager
+	reports the result of requests which reach an agent; for drivers which do not report
+	results, and for requests which could not be handed to the driver, res_mgr is
+	acknowledged here so that the pledge is not left pending (and pushed again) forever.
+	A request the driver failed to install is acknowledged as failed so that res_mgr
+	resets the pledge and pushes it again on its next push cycle.
+*/
+func sb_push( st *sb_table, kind int, data *Fq_req ) ( err error ) {
+	err = sb_install( st, kind, data )
+	if data == nil || data.Id == nil {
+		return err
+	}
+
+	if err != nil || st.for_flow( kind, sb_host( data ) ).Name() != "agent" {
+		msg := ipc.Mk_chmsg( )
+		msg.Send_req( rmgr_ch, nil, REQ_PUSH_ACK, &push_ack{ id: data.Id, host: sb_host( data ), gen: data.Pgen, ok: err == nil, local: true }, nil )
+	}
+
+	return err
+}
+
+/*
+	Accept a new host list. The list is split by driver; the agent manager is always given the
+	hosts that the agent driver handles (it refreshes mac maps and intermediate queues on its own
+	schedule) and each driver whose list changed is asked to map the hosts and set intermediate
+	queues.
+*/
+func sb_hosts( st *sb_table, env *sb_env, hlist *string ) {
+	env.host_list = hlist
+	split := st.split_hosts( hlist )
+
+	for _, drv := range st.all {
+		hl := split[drv]
+		if hl == nil {
+			hl = &empty_str
+		}
+
+		if drv.Name() == "agent" {
+			send_hlist_agent( hl )
+		}
+
+		if as, ok := drv.(*agent_south); ok && *hl != st.prev[drv] && *hl != "" {
+			as.request_qcaps( hl )
+		}
+
+		if *hl != st.prev[drv] {
+			st.prev[drv] = *hl
+			if *hl != "" {
+				fq_sheep.Baa( 2, "%s southbound driver host list changed: %s", drv.Name(), *hl )
+				if err := drv.Map_mac2phost( hl ); err != nil {
+					fq_sheep.Baa( 1, "WRN: %s southbound driver: unable to map mac addresses: %s  [TGUFQM015]", drv.Name(), err )
+				}
+				if err := drv.Intermed_queues( hl ); err != nil {
+					fq_sheep.Baa( 1, "WRN: %s southbound driver: unable to set intermediate queues: %s  [TGUFQM015]", drv.Name(), err )
+				}
+			}
+		}
+	}
+}
+
+// ---------------- skoogi ---------------------------------------------------------------
+
+/*
+	Legacy driver which sends ingress/egress reservations to skoogi. Skoogi owns the
+	topology and the queues so the other operations are either no-ops or unsupported.
+*/
+type skoogi_south struct {
+	env		*sb_env
+}
+
+func (sk *skoogi_south) Name( ) ( string ) {
+	return "skoogi"
+}
+
+/*
+	Ensure that skoogi can act on the request: an sdn host is defined, the kind is one that
+	skoogi supports, and the request has the endpoints and the switch/port.
+*/
+func (sk *skoogi_south) check_req( kind int, data *Fq_req ) ( error ) {
+	if sk.env.uri_prefix == "" {
+		return fmt.Errorf( "skoogi southbound driver: no sdn host defined" )
+	}
+	if kind != SB_IE && kind != SB_BW {
+		return fmt.Errorf( "%s flow-mods are not supported with skoogi (SDNC)", sb_kind2str( kind ) )
+	}
+	if data == nil || data.Espq == nil || data.Match == nil || data.Match.Ip1 == nil || data.Match.Ip2 == nil {
+		return fmt.Errorf( "skoogi southbound driver: %s flow-mod missing endpoint or queue data", sb_kind2str( kind ) )
+	}
+
+	return nil
+}
+
+func (sk *skoogi_south) Install_flow( kind int, data *Fq_req ) ( err error ) {
+	if err = sk.check_req( kind, data ); err != nil {
+		return err
+	}
+
+	err = gizmos.SK_ie_flowmod( &sk.env.uri_prefix, *data.Match.Ip1, *data.Match.Ip2, data.Expiry, data.Espq.Queuenum, data.Espq.Switch, data.Espq.Port )
+	if err == nil {
+		fq_sheep.Baa( 2,  "proactive reserve successfully sent: uri=%s h1=%s h2=%s exp=%d qnum=%d swid=%s port=%d",
+					sk.env.uri_prefix, *data.Match.Ip1, *data.Match.Ip2, data.Expiry, data.Espq.Queuenum, data.Espq.Switch, data.Espq.Port )
+	} else {
+		fq_sheep.Baa( 1,  "ERR: proactive reserve failed: uri=%s h1=%s h2=%s exp=%d qnum=%d swid=%s port=%d  [TGUFQM008]",
+					sk.env.uri_prefix, *data.Match.Ip1, *data.Match.Ip2, data.Expiry, data.Espq.Queuenum, data.Espq.Switch, data.Espq.Port )
+	}
+	return err
+}
+
+/*
+	Ask skoogi to delete the ingress/egress flow-mod for the host pair on the switch/port.
+*/
+func (sk *skoogi_south) Remove_flow( kind int, data *Fq_req ) ( err error ) {
+	if err = sk.check_req( kind, data ); err != nil {
+		return err
+	}
+
+	err = gizmos.SK_ie_flowmod_del( &sk.env.uri_prefix, *data.Match.Ip1, *data.Match.Ip2, data.Espq.Switch, data.Espq.Port )
+	if err == nil {
+		fq_sheep.Baa( 2,  "flow-mod delete sent: uri=%s h1=%s h2=%s swid=%s port=%d", sk.env.uri_prefix, *data.Match.Ip1, *data.Match.Ip2, data.Espq.Switch, data.Espq.Port )
+	} else {
+		fq_sheep.Baa( 1,  "ERR: flow-mod delete failed: uri=%s h1=%s h2=%s swid=%s port=%d: %s  [TGUFQM021]", sk.env.uri_prefix, *data.Match.Ip1, *data.Match.Ip2, data.Espq.Switch, data.Espq.Port, err )
+	}
+	return err
+}
+
+func (sk *skoogi_south) Set_queues( qlist []string, hlist *string ) ( error ) {
+	return fmt.Errorf( "queue setting is not supported with skoogi (SDNC)" )
+}
+
+func (sk *skoogi_south) Map_mac2phost( hlist *string ) ( error ) {
+	return nil										// skoogi knows the topology
+}
+
+func (sk *skoogi_south) Intermed_queues( hlist *string ) ( error ) {
+	return nil
+}
+
+func (sk *skoogi_south) Request_state( hlist *string ) ( error ) {
+	return fmt.Errorf( "state reconciliation is not supported with skoogi (SDNC)" )
+}
+
+func (sk *skoogi_south) Remove_flows( host string, cookie uint64, smac string, dmac string ) ( error ) {
+	return fmt.Errorf( "flow removal by cookie is not supported with skoogi (SDNC)" )
+}
+
+func (sk *skoogi_south) Purge_queues( host string ) ( error ) {
+	return fmt.Errorf( "queue setting is not supported with skoogi (SDNC)" )
+}
+
+// ---------------- noop/recording -------------------------------------------------------
+
+/*
+	Driver which does nothing other than record each request.
+*/
+type noop_south struct {
+	env		*sb_env
+}
+
+/*
+	Record the operation to the log and to the record file if one is configured.
+*/
+func (ns *noop_south) record( op string, what string ) {
+	fq_sheep.Baa( 1, "southbound noop: %s %s", op, what )
+
+	if ns.env.record == nil || *ns.env.record == "" {
+		return
+	}
+
+	f, err := os.OpenFile( *ns.env.record, os.O_WRONLY | os.O_APPEND | os.O_CREATE, 0644 )
+	if err != nil {
+		fq_sheep.Baa( 1, "WRN: unable to open southbound record file %s: %s  [TGUFQM012]", *ns.env.record, err )
+		return
+	}
+	fmt.Fprintf( f, "%d %s %s\n", time.Now().Unix(), op, what )
+	f.Close( )
+}
+
+/*
+	Return the json form of the request, or a placeholder if it cannot be converted.
+*/
+func fq2str( data *Fq_req ) ( string ) {
+	if data == nil {
+		return "{}"
+	}
+	if js, err := data.To_json(); err == nil && js != nil {
+		return *js
+	}
+	return "{}"
+}
+
+func (ns *noop_south) Name( ) ( string ) {
+	return "noop"
+}
+
+func (ns *noop_south) Install_flow( kind int, data *Fq_req ) ( error ) {
+	ns.record( "install_" + sb_kind2str( kind ), fq2str( data ) )
+	return nil
+}
+
+func (ns *noop_south) Remove_flow( kind int, data *Fq_req ) ( error ) {
+	ns.record( "remove_" + sb_kind2str( kind ), fq2str( data ) )
+	return nil
+}
+
+func (ns *noop_south) Set_queues( qlist []string, hlist *string ) ( error ) {
+	ns.record( "set_queues", strings.Join( qlist, " " ) )
+	return nil
+}
+
+func (ns *noop_south) Map_mac2phost( hlist *string ) ( error ) {
+	if hlist != nil {
+		ns.record( "map_mac2phost", *hlist )
+	}
+	return nil
+}
+
+func (ns *noop_south) Intermed_queues( hlist *string ) ( error ) {
+	if hlist != nil {
+		ns.record( "intermed_queues", *hlist )
+	}
+	return nil
+}
+
+/*
+	Nothing is installed, so there is no state to reconcile.
+*/
+func (ns *noop_south) Request_state( hlist *string ) ( error ) {
+	return fmt.Errorf( "noop driver has no state" )
+}
+
+func (ns *noop_south) Remove_flows( host string, cookie uint64, smac string, dmac string ) ( error ) {
+	ns.record( "remove_flows", fmt.Sprintf( "%s cookie=0x%x smac=%s dmac=%s", host, cookie, smac, dmac ) )
+	return nil
+}
+
+func (ns *noop_south) Purge_queues( host string ) ( error ) {
+	ns.record( "purge_queues", host )
+	return nil
+}
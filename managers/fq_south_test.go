@@ -0,0 +1,95 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	fq_south_test
+	Abstract:	Tests for the skoogi southbound driver: requests without match data are
+				refused rather than dereferenced, and removal asks skoogi to delete the
+				flow-mod rather than adding it again with a short expiry. Skoogi is
+				replaced with a local http server which records the request uris.
+	Date:		19 Oct 2026
+*/
+
+package managers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/att/gopkgs/bleater"
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Build an ingress/egress request between 10.0.0.1 and 10.0.0.2 on host cn1.
+*/
+func sk_ie_req( rname string ) ( *Fq_req ) {
+	ip1 := "10.0.0.1"
+	ip2 := "10.0.0.2"
+	fr := Mk_fqreq( &rname )
+	fr.Espq = gizmos.Mk_spq( "cn1", 2, 3 )
+	fr.Match.Ip1 = &ip1
+	fr.Match.Ip2 = &ip2
+	fr.Expiry = time.Now().Unix() + 3600
+
+	return fr
+}
+
+func Test_skoogi_remove( t *testing.T ) {
+	fmt.Fprintf( os.Stderr, "\n------- skoogi flow-mod removal --------\n" )
+	if fq_sheep == nil {
+		fq_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	}
+
+	uris := make( []string, 0 )
+	sk_sim := httptest.NewServer( http.HandlerFunc( func( w http.ResponseWriter, r *http.Request ) {
+		uris = append( uris, r.URL.RawQuery )
+		fmt.Fprintf( w, "ok\n" )
+	} ) )
+	defer sk_sim.Close()
+
+	sk := &skoogi_south{ env: &sb_env{ uri_prefix: sk_sim.URL } }
+
+	nomatch := sk_ie_req( "r1" )
+	nomatch.Match = nil
+	if err := sk.Install_flow( SB_IE, nomatch ); err == nil || len( uris ) != 0 {
+		fmt.Fprintf( os.Stderr, "FAIL: request without match data was not refused: err=%v sent=%d\n", err, len( uris ) )
+		t.Fail()
+	}
+
+	r := sk_ie_req( "r1" )
+	if err := sk.Remove_flow( SB_IE, r ); err != nil || len( uris ) != 1 {
+		fmt.Fprintf( os.Stderr, "FAIL: removal not sent: err=%v sent=%d\n", err, len( uris ) )
+		t.FailNow()
+	}
+	if ! strings.Contains( uris[0], "action=iefmdel" ) || ! strings.Contains( uris[0], "srchost=10.0.0.1&desthost=10.0.0.2" ) || strings.Contains( uris[0], "expiry" ) {
+		fmt.Fprintf( os.Stderr, "FAIL: removal is not a delete of the reservation's flow-mod: %s\n", uris[0] )
+		t.Fail()
+	}
+
+	if err := sk.Remove_flow( SB_PASS, r ); err == nil || len( uris ) != 1 {
+		fmt.Fprintf( os.Stderr, "FAIL: removal of a kind skoogi does not support was sent\n" )
+		t.Fail()
+	}
+}
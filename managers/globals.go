@@ -45,6 +45,21 @@
 				21 Sep 2015 - Added REQ_GET_PHOST_FROM_PORTUUID
 				12 Nov 2015 - Pulled in httplogger from steering branch.
 				06 Mar 2016 - Added consts for new res mgr lookup channel
+				18 Oct 2026 - Added project based reservation access globals.
+				18 Oct 2026 - Added REQ_AGENT_REGCHK.
+				18 Oct 2026 - Added REQ_AGENT_ACKCHK and REQ_PUSH_ACK.
+				18 Oct 2026 - Added REQ_RECONCILE and REQ_DRIFT.
+				19 Oct 2026 - Added REQ_EXPLAIN.
+				19 Oct 2026 - Added REQ_FLOW_DEL and the no hard timeout flag to Fq_req.
+				19 Oct 2026 - Added REQ_QPCAPS and the meter id and queue port to Fq_req.
+				19 Oct 2026 - Added the split path list to Fq_req.
+				19 Oct 2026 - Added REQ_TOPOCHK.
+				19 Oct 2026 - Added REQ_LLDP.
+				19 Oct 2026 - Added REQ_TOPOCHG and REQ_REPATH.
+				19 Oct 2026 - Added REQ_DRAIN, REQ_UNDRAIN and REQ_LISTDRAINS.
+				19 Oct 2026 - Added REQ_MIRROR_RESERVE.
+				19 Oct 2026 - Added REQ_MIRROR_UPDATE.
+				19 Oct 2026 - Added REQ_MBOX_HEALTH and Nxt_group (steering through middlebox pools).
 */
 
 /*
@@ -165,6 +180,24 @@ const (
 	REQ_GENPLAN					// (re)generate a steering plan for a new/modified chain request
 	REQ_PT_RESERVE				// passthru reservation
 	REQ_VET_RETRY				// run the reservation retry queue if it has size
+	REQ_AGENT_REGCHK			// agent manager: drop an agent session if it has not registered
+	REQ_AGENT_ACKCHK			// agent manager: resend actions that were not acknowledged in time
+	REQ_PUSH_ACK				// res_mgr: final result of a flow-mod action sent for a reservation
+	REQ_RECONCILE				// fq_mgr: tickle, or host state from the agent, to reconcile; res_mgr: desired flow-mods of live pledges
+	REQ_DRIFT					// fq_mgr: return the reconciliation drift report (json)
+	REQ_EXPLAIN					// res_mgr: build the southbound operations for a pledge; fq_mgr: render them (json)
+	REQ_FLOW_DEL				// fq_mgr: delete the flow-mods for a list of southbound operations (expired reservation)
+	REQ_QPCAPS					// fq_mgr: queue policy mechanisms supported by hosts (from agent); network: hosts that can install split groups
+	REQ_TOPOCHK					// network: rebuild the graph if the static topology file changed
+	REQ_LLDP					// agent: request lldp neighbours from hosts; network: neighbours discovered (from agent)
+	REQ_TOPOCHG					// res_mgr: links lost from the network graph (re-path pledges using them)
+	REQ_REPATH					// network: move pledges off of links no longer in the graph
+	REQ_DRAIN					// res_mgr/network: add a maintenance window (drain) to links, a switch or a host
+	REQ_UNDRAIN					// res_mgr/network: cancel a maintenance window
+	REQ_LISTDRAINS				// res_mgr: list maintenance windows and the reservations they affect
+	REQ_MIRROR_RESERVE			// network: reserve the bandwidth for a mirror toward its output
+	REQ_MIRROR_UPDATE			// res_mgr: extend a mirror or add/remove its ports
+	REQ_MBOX_HEALTH				// res_mgr: check middlebox pool members (tickle) or apply the agent's results
 )
 
 const (
@@ -172,6 +205,12 @@ const (
 
 								// defaults
 	DEF_ALT_TABLE	int = 90	// alternate table in OVS for metadata marking
+
+	ALL_PROJECTS	string = "*"	// project 'name' passed to res mgr when the caller is admin and may see every reservation
+
+								// reservation access modes (httpmgr:res_access)
+	RA_COOKIE		string = "cookie"	// legacy: the user cookie (or super cookie) controls access
+	RA_PROJECT		string = "project"	// access limited to the project that created the reservation (admin sees all)
 )
 
 
@@ -237,6 +276,7 @@ var (
 	pid int = 0							// process id for use in generating reservation names unique across invocations
 	res_nmseed	int = 0					// reservation name sequential value
 	res_paused	bool = false			// set to true if reservations are paused
+	flow_delete	bool = false			// set when reservation flow-mods are pushed without a hard timeout and deleted at expiry
 
 	super_cookie	*string; 			// the 'admin cookie' that the super user can use to manipulate a reservation
 
@@ -262,6 +302,9 @@ var (
 	accept_requests bool = false		// until main says we can, we don't accept requests
 	tclass2dscp map[string]int			// traffic class string (voice, video, af...) to a value
 	isSSL bool							// mirroring flag to know if ssl is on
+	res_access string = RA_PROJECT		// how reservation visibility/ownership is determined (cookie or project)
+	user_roles *string					// roles which identify an ordinary (project member) user
+	cert_role_map map[string]string		// client certificate subject name to role list
 )
 
 //-- fq-manager data passing structs ---------------------------------------------------------------------------------------
@@ -309,10 +352,17 @@ type Fq_req struct {
 	Ipv6	bool				// set to true to force ipv6 packet matching
 
 	Nxt_mac	*string				// mac of next hop (steering)
+	Nxt_group	*string			// select group for the next hop when it is a middlebox pool (steering; send_ovs_fmod -G parm)
 	Lbmac	*string				// late binding mac
 	Swid	*string				// switch ID (either a dpid or host name for ovs)
 	Espq	*gizmos.Spq			// a collection of switch, port, queue information (might replace spq and swid)
 	Single_switch bool			// indicates that only one switch is involved (dscp handling is different)
+	Pgen	uint32				// push generation of the reservation (res_mgr pending push acks)
+	No_hto	bool				// no hard timeout on the flow-mods; they are deleted (by cookie) at expiry
+	Meter	int					// meter id used in place of the queue (meter queue policy); 0 == none
+	Qport	string				// switch/port of the reservation's queue as it appears in the queue list (meter key)
+	Split	[]string			// port/queue/share for each path when the reservation is split across paths
+	Group	uint32				// select group of a split reservation (allocated by res_mgr)
 
 	Match	*Fq_parms			// things to match on
 	Action	*Fq_parms			// things to set in action
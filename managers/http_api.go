@@ -33,13 +33,16 @@
 				These requests are supported:
 					POST:
 						chkpt	(limited)
+						drain	(limited)
 						graph	(limited)
 						listconns
+						listdrains	(limited)
 						listhosts	(limited)
 						listres
 						pause (limited)
 						reserve
 						resume (limited)
+						undrain (limited)
 						verbose (limited)
 
 					DELETE:
@@ -101,12 +104,25 @@
 				04 Feb 2016 : Add support for direct protocol type rather than assuming both udp and tcp.
 								Corrected typo in passthru sussing out protocol setting. Added additional
 								error checking to host name in validate hosts function.
+				18 Oct 2026 : Reservations are tied to the project/user of the creator. listres, listconns
+								and cancel are limited to the caller's project unless the caller is admin. Cookie
+								based access is retained when res_access is set to cookie.
+				18 Oct 2026 : Added client certificate (mutual TLS) support, cert subject to role mapping,
+								modern key types for generated certs and certificate hot reload.
+				18 Oct 2026 : Added drift request to report flow/queue drift found by reconciliation.
+				19 Oct 2026 : Added explain request, and explain=true option on reserve, ow_reserve and passthru.
+				19 Oct 2026 : Added ceiling= and burst= options on reserve (bandwidth is the guarantee).
+				19 Oct 2026 : Added path constraint options (maxhops=, maxlatency=, avoid=, avoidsrlg=) on reserve.
+				19 Oct 2026 : Added drain, undrain and listdrains (maintenance windows).
+				19 Oct 2026 : Graph accepts format=dot|graphml|d3, ts= and res= to export with link utilisation.
+				19 Oct 2026 : Steering hops may be middlebox pools (mb1@w+mb2@w) with balance=hash|weighted.
 */
 
 package managers
 
 import (
 	//"bufio"
+	"crypto/tls"
 	//"encoding/json"
 	//"flag"
 	"fmt"
@@ -123,7 +139,6 @@ import (
 	"github.com/att/gopkgs/http_logger"
 	"github.com/att/gopkgs/ipc"
 	"github.com/att/gopkgs/ostack"
-	"github.com/att/gopkgs/security"
 	"github.com/att/gopkgs/token"
 
 	"github.com/att/tegu/gizmos"
@@ -326,6 +341,9 @@ func token_has_osroles_with_UserProject( token *string, roles string ) ( string
 	(e.g. admin,tegu_admin).  If 'none' is indicated in the config file, then we always return
 	true without doing any validation.
 
+	If the data is prefixed with CERT_AUTH_PFX, then the remainder is the list of roles that were
+	mapped from the verified client certificate and are treated as if they were listed on a token.
+
 	Returns true if the command can be allowed; false if not.
 */
 func validate_auth( data *string, is_token bool, valid_roles *string ) ( allowed bool ) {
@@ -333,6 +351,19 @@ func validate_auth( data *string, is_token bool, valid_roles *string ) ( allowed
 		return true
 	}
 
+	if ! is_token && strings.HasPrefix( *data, CERT_AUTH_PFX ) {
+		if *priv_auth == "none" {
+			return true
+		}
+		if valid_roles == nil {
+			http_sheep.Baa( 1, "internal mishap: validate auth called with nil role list" )
+			return false
+		}
+		state := roles_intersect( (*data)[len( CERT_AUTH_PFX ):], *valid_roles )
+		http_sheep.Baa( 2, "validating client certificate roles with role list: %s: allow=%v", *valid_roles, state )
+		return state
+	}
+
 	switch *priv_auth {
 		case "none":
 			http_sheep.Baa( 2, "priv_auth set to none, request always allowed" )
@@ -358,6 +389,92 @@ func validate_auth( data *string, is_token bool, valid_roles *string ) ( allowed
 	return false
 }
 
+/*
+	Determine the user and project associated with the token supplied by the caller. Empty
+	strings are returned if the auth data isn't a token, or the token doesn't validate for
+	any of the user or admin roles.
+*/
+func caller_identity( auth_data *string, is_token bool ) ( user string, project string ) {
+	if ! is_token || auth_data == nil || *auth_data == "" {
+		return "", ""
+	}
+
+	uproj := token_has_osroles_with_UserProject( auth_data, *user_roles + "," + *admin_roles )
+	if uproj != "" {
+		parts := strings.Split( uproj, "," )
+		if len( parts ) > 1 {
+			return parts[0], parts[1]
+		}
+	}
+
+	return "", ""
+}
+
+/*
+	Returns true if the caller presented a token, or a verified client certificate, which
+	carries one of the admin roles. Unlike validate_auth() the priv_auth setting is not
+	considered; a local or unauthenticated caller is never an admin here.
+*/
+func is_admin_caller( auth_data *string, is_token bool ) ( bool ) {
+	if auth_data == nil || *auth_data == "" || admin_roles == nil {
+		return false
+	}
+
+	if is_token {
+		return token_has_osroles( auth_data, *admin_roles )
+	}
+
+	if strings.HasPrefix( *auth_data, CERT_AUTH_PFX ) {
+		return roles_intersect( (*auth_data)[len( CERT_AUTH_PFX ):], *admin_roles )
+	}
+
+	return false
+}
+
+/*
+	Returns the project used to scope reservation access for the caller which is passed to res
+	mgr on get, delete and list requests. When access is cookie based (legacy), or the caller
+	did not send a token, nil is returned and res mgr will validate the user cookie. Callers
+	whose token or certificate carries an admin role get the all projects indicator. If the
+	caller sent a token whose project cannot be determined a pointer to an empty string is
+	returned which matches no reservation.
+*/
+func access_scope( auth_data *string, is_token bool ) ( *string ) {
+	if res_access == RA_COOKIE {
+		return nil
+	}
+
+	if is_admin_caller( auth_data, is_token ) {
+		ap := ALL_PROJECTS
+		return &ap
+	}
+
+	if ! is_token || auth_data == nil || *auth_data == "" {		// no token; the cookie is all the caller has
+		return nil
+	}
+
+	_, project := caller_identity( auth_data, is_token )
+	return &project
+}
+
+/*
+	Determine the owner (user and project) that should be recorded on a new pledge. If the
+	caller sent a token, the user and project come from it; otherwise the project is taken
+	from the validated host name (project-id/host) if it has one. Unvalidated names (!proj/host)
+	do not establish ownership.
+*/
+func pledge_owner( auth_data *string, is_token bool, host *string ) ( *string, *string ) {
+	user, project := caller_identity( auth_data, is_token )
+	if project == "" && host != nil {
+		toks := strings.SplitN( *host, "/", 2 )
+		if len( toks ) == 2 && toks[0] != "" && toks[0][0:1] != "!" {
+			project = toks[0]
+		}
+	}
+
+	return &user, &project
+}
+
 // --- generic utility ----------------------------------------------------------------------------------
 
 /*
@@ -630,6 +747,130 @@ func finalise_pt_res( res *gizmos.Pledge_pass, res_paused bool ) ( reason string
 	return
 }
 
+/*
+	Send the explain request (existing reservation name/cookie/scope, or a hypothetical pledge)
+	to res mgr to build the fq requests, and pass the result to fq mgr to render. Returns the
+	json report.
+*/
+func render_explain( data interface{} ) ( string, error ) {
+	my_ch := make( chan *ipc.Chmsg )
+	defer close( my_ch )
+
+	req := ipc.Mk_chmsg( )
+	req.Send_req( rmgr_ch, my_ch, REQ_EXPLAIN, data, nil )
+	req = <- my_ch
+	if req.State != nil {
+		return "", req.State
+	}
+
+	req.Send_req( fq_ch, my_ch, REQ_EXPLAIN, req.Response_data, nil )
+	req = <- my_ch
+	if req.State != nil {
+		return "", req.State
+	}
+
+	return req.Response_data.( string ), nil
+}
+
+/*
+	Build the request for a graph export from the options on the graph command. If res= is
+	given the reservation is fetched from res_mgr and the links on its paths are highlighted.
+	Returns nil and the reason if there is an error.
+*/
+func mk_graph_req( tmap map[string]*string, auth_data *string, is_token bool ) ( gr *graph_req, reason string ) {
+	if ! gizmos.Is_graph_format( *tmap["format"] ) {
+		return nil, fmt.Sprintf( "unknown graph format: %s; must be one of: dot, graphml, d3", *tmap["format"] )
+	}
+
+	gr = &graph_req{ format: *tmap["format"], ts: time.Now().Unix() }
+	if tmap["ts"] != nil {
+		gr.ts = clike.Atoll( *tmap["ts"] )
+	}
+
+	if tmap["res"] != nil {
+		cookie := &empty_str
+		if tmap["cookie"] != nil {
+			cookie = tmap["cookie"]
+		}
+
+		my_ch := make( chan *ipc.Chmsg )
+		defer close( my_ch )
+		req := ipc.Mk_chmsg( )
+		req.Send_req( rmgr_ch, my_ch, REQ_GET, []*string{ tmap["res"], cookie, access_scope( auth_data, is_token ) }, nil )
+		req = <- my_ch
+		if req.State != nil {
+			return nil, fmt.Sprintf( "%s", req.State )
+		}
+
+		p, ok := (*req.Response_data.( *gizmos.Pledge )).( *gizmos.Pledge_bw )
+		if ! ok {
+			return nil, fmt.Sprintf( "only bandwidth reservations have paths to highlight: %s", *tmap["res"] )
+		}
+
+		gr.hlname = *tmap["res"]
+		gr.hl = make( map[string]bool )
+		for _, pth := range p.Get_path_list() {
+			for _, l := range pth.Get_links() {
+				gr.hl[*l.Get_id()] = true
+			}
+		}
+	}
+
+	return gr, ""
+}
+
+/*
+	Explain a reservation that has not been made (reserve, ow_reserve or passthru with explain=true).
+	Network is asked only whether there is capacity (path or gate) so nothing is allocated and the
+	pledge is not added to the inventory.
+*/
+func explain_res( gp *gizmos.Pledge ) ( reason string, jreason string, nerrors int ) {
+	my_ch := make( chan *ipc.Chmsg )
+	defer close( my_ch )
+
+	req := ipc.Mk_chmsg( )
+	switch p := (*gp).(type) {
+		case *gizmos.Pledge_bw:
+			req.Send_req( nw_ch, my_ch, REQ_HASCAP, p, nil )
+			req = <- my_ch
+			if req.Response_data == nil {
+				return fmt.Sprintf( "reservation would be rejected: %s", req.State ), "", 1
+			}
+			p.Set_path_list( req.Response_data.( []*gizmos.Path ) )
+
+		case *gizmos.Pledge_bwow:
+			req.Send_req( nw_ch, my_ch, REQ_HASCAP, p, nil )
+			req = <- my_ch
+			if req.Response_data == nil {
+				return fmt.Sprintf( "one way reservation would be rejected: %s", req.State ), "", 1
+			}
+			p.Set_gate( req.Response_data.( *gizmos.Gate ) )
+
+		case *gizmos.Pledge_pass:
+			host, _ := p.Get_hosts()
+			req.Send_req( nw_ch, my_ch, REQ_GETPHOST, host, nil )
+			req = <- my_ch
+			if req.Response_data == nil {
+				return fmt.Sprintf( "passthru reservation would be rejected: %s", req.State ), "", 1
+			}
+			p.Set_phost( req.Response_data.( *string ) )
+	}
+
+	jreason, err := render_explain( gp )
+	if err != nil {
+		return fmt.Sprintf( "unable to explain reservation: %s", err ), "", 1
+	}
+
+	return "", jreason, 0
+}
+
+/*
+	True if the explain=true option was given on a reservation request.
+*/
+func want_explain( tmap map[string]*string ) ( bool ) {
+	return tmap["explain"] != nil && *tmap["explain"] == "true"
+}
+
 
 // ---- main parsers ------------------------------------------------------------------------------------
 /*
@@ -641,10 +882,13 @@ func finalise_pt_res( res *gizmos.Pledge_pass, res_paused bool ) ( reason string
 		listulcaps
 		listres
 		listconns
-		reserve <bandwidth[K|M|G][,outbandwidth[K|M|G]> [<start>-]<end> <host1>[-<host2] [cookie]
-		graph
+		reserve [ceiling=<bandwidth>[,<outbandwidth>]] [burst=<size>] [maxhops=<n>] [maxlatency=<n>[us|ms]] [avoid=<sw>[,<sw>]] [avoidsrlg=<group>[,<group>]] <bandwidth[K|M|G][,outbandwidth[K|M|G]> [<start>-]<end> <host1>[-<host2] [cookie]
+		graph [format={dot|graphml|d3}] [ts=timestamp] [res=res-id [cookie=cookie]]
 		ping
 		listconns <hostname|hostip>
+		drain [pct=<n>] [repath=true] [id=<name>] {link|switch|host} <target> [<start>-]<end>
+		undrain <id>
+		listdrains
 
 
 	Because this is driven from within the go http support library, we expect a few globals
@@ -711,7 +955,7 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 			switch tokens[0] {
 
 				case "cancelres":												// cancel reservation
-					err := delete_reservation( tokens )
+					err := delete_reservation( tokens, access_scope( &auth_data, is_token ) )
 					if err != nil {
 						reason = fmt.Sprintf( "%s", err )
 					} else {
@@ -728,6 +972,81 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 						reason = "checkpoint was requested"
 					}
 
+				case "drain":									// maintenance window: drain [pct=n] [repath=true] [id=name] {link|switch|host} target [start-]end
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						key_list := "kind target window"
+						tmap := gizmos.Mixtoks2map( tokens[1:], key_list )
+						if ok, mlist := gizmos.Map_has_all( tmap, key_list ); ! ok {
+							reason = fmt.Sprintf( "missing parameters: (%s); usage: drain [pct=n] [repath=true] [id=name] {link|switch|host} <target> [<start>-]<end>", mlist )
+							break
+						}
+
+						pct := 100
+						if tmap["pct"] != nil {
+							pct = clike.Atoi( strings.TrimSuffix( *tmap["pct"], "%" ) )
+						}
+						id := ""
+						if tmap["id"] != nil {
+							id = *tmap["id"]
+						} else {
+							id = "drain" + mk_resname()[3:]
+						}
+
+						startt, endt = gizmos.Str2start_end( *tmap["window"] )
+						d, err := gizmos.Mk_drain( id, *tmap["kind"], *tmap["target"], startt, endt, pct )
+						if err != nil {
+							reason = fmt.Sprintf( "drain not scheduled: %s", err )
+							break
+						}
+
+						req = ipc.Mk_chmsg( )
+						req.Send_req( rmgr_ch, my_ch, REQ_DRAIN, &drain_req{ d: d, repath: tmap["repath"] != nil && *tmap["repath"] == "true" }, nil )
+						req = <- my_ch
+						if req.State == nil {
+							state = "OK"
+							jreason = req.Response_data.( string )
+							reason = ""
+						} else {
+							reason = fmt.Sprintf( "drain not scheduled: %s", req.State )
+						}
+					}
+
+				case "drift":									// flow/queue drift found by reconciliation; 'drift now' also starts a pass
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						if ntokens > 1 && tokens[1] == "now" {
+							req = ipc.Mk_chmsg( )
+							req.Send_req( fq_ch, nil, REQ_RECONCILE, nil, nil )
+						}
+						req = ipc.Mk_chmsg( )
+						req.Send_req( fq_ch, my_ch, REQ_DRIFT, nil, nil )
+						req = <- my_ch
+						if req.State == nil && req.Response_data != nil {
+							state = "OK"
+							jreason = req.Response_data.( string )
+							reason = ""
+						} else {
+							reason = fmt.Sprintf( "unable to get drift report: %v", req.State )
+						}
+					}
+
+				case "explain":									// explain reservation-id [cookie]: the southbound operations for the reservation (nothing is sent)
+					if ntokens < 2 || ntokens > 3 {
+						reason = fmt.Sprintf( "bad explain command: wanted 'explain res-ID [cookie]' received %d tokens", ntokens - 1 )
+						break
+					}
+
+					edata := []*string{ &tokens[1], &empty_str, access_scope( &auth_data, is_token ) }
+					if ntokens > 2 {
+						edata[1] = &tokens[2]
+					}
+					if jr, err := render_explain( edata ); err == nil {
+						state = "OK"
+						jreason = jr
+						reason = ""
+					} else {
+						reason = fmt.Sprintf( "unable to explain reservation: %s", err )
+					}
+
 				case "graph":
 					if validate_auth( &auth_data, is_token, sysproc_roles ) {
 						tmap := gizmos.Mixtoks2map( tokens[1:], "" )			// look for project=pname[,pname] on the request
@@ -745,19 +1064,43 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 							}
 						}
 
+						var gr *graph_req
+						if tmap["format"] != nil {											// export: format=dot|graphml|d3 [ts=timestamp] [res=res-id [cookie=c]]
+							if gr, reason = mk_graph_req( tmap, &auth_data, is_token ); gr == nil {
+								break
+							}
+						}
+
 						req = ipc.Mk_chmsg( )
 
-						req.Send_req( nw_ch, my_ch, REQ_NETGRAPH, nil, nil )	// request to net thread; it will create a json blob and attach to the request which it sends back
+						req.Send_req( nw_ch, my_ch, REQ_NETGRAPH, gr, nil )	// request to net thread; it will create a json blob and attach to the request which it sends back
 						req = <- my_ch											// hard wait for network thread response
 						if req.Response_data != nil {
 							state = "OK"
 							jreason = string( req.Response_data.(string) )
+							if gr != nil && gr.format != gizmos.GX_D3 {				// dot and graphml aren't json; send as a string
+								jreason = fmt.Sprintf( "%q", jreason )
+							}
 							reason = ""
 						} else {
-							reason = "no output from network thread"
+							if req.State != nil {
+								reason = fmt.Sprintf( "%s", req.State )
+							} else {
+								reason = "no output from network thread"
+							}
 						}
 					}
 
+				case "listdrains":											// list maintenance windows and the reservations they affect
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						req = ipc.Mk_chmsg( )
+						req.Send_req( rmgr_ch, my_ch, REQ_LISTDRAINS, nil, nil )
+						req = <- my_ch
+						state = "OK"
+						jreason = req.Response_data.( string )
+						reason = ""
+					}
+
 				case "listulcaps":											// list user link capacities known to network manager
 					if validate_auth( &auth_data, is_token, admin_roles ) {
 						req = ipc.Mk_chmsg( )
@@ -801,9 +1144,13 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 						}
 					}
 
-				case "listres":											// list reservations
+				case "listres":											// list reservations (limited to the caller's project unless admin or cookie mode)
+					scope := access_scope( &auth_data, is_token )
+					if scope == nil && res_access == RA_PROJECT {			// no token, so no project; there is no cookie to filter on so nothing is visible
+						scope = &empty_str
+					}
 					req = ipc.Mk_chmsg( )
-					req.Send_req( rmgr_ch, my_ch, REQ_LIST, nil, nil )
+					req.Send_req( rmgr_ch, my_ch, REQ_LIST, scope, nil )
 					req = <- my_ch
 					if req.State == nil {
 						state = "OK"
@@ -818,19 +1165,40 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 					if ntokens < 2 {
 						nerrors++
 						reason = fmt.Sprintf( "incorrect number of parameters supplied (%d) 1 expected: usage: attached2 hostname", ntokens-1 );
-					} else {
+						break
+					}
+
+					if scope := access_scope( &auth_data, is_token ); scope != nil && *scope != ALL_PROJECTS {	// project based access: host must be in the caller's project
+						htoks := strings.SplitN( tokens[1], "/", 2 )
+						if len( htoks ) < 2 || *scope == "" {
+							reason = fmt.Sprintf( "listconns requires a project/host name in the caller's project" )
+							break
+						}
+
+						pid := htoks[0]
 						req = ipc.Mk_chmsg( )
-						req.Send_req( nw_ch, my_ch, REQ_LISTCONNS, &tokens[1], nil )
+						req.Send_req( osif_ch, my_ch, REQ_PNAME2ID, &htoks[0], nil )		// project may be given as name or ID; we must compare ID
 						req = <- my_ch
-						if req.State == nil {
-							state = "OK"
-							jreason = string( req.Response_data.(string) )
-							reason = ""
-						} else {
-							reason = fmt.Sprintf( "%s", req.State )
+						if req.Response_data != nil && req.Response_data.( *string ) != nil {
+							pid = *(req.Response_data.( *string ))
+						}
+						if pid != *scope {
+							reason = fmt.Sprintf( "you are not authorised to list connections for hosts in project: %s", htoks[0] )
+							break
 						}
 					}
 
+					req = ipc.Mk_chmsg( )
+					req.Send_req( nw_ch, my_ch, REQ_LISTCONNS, &tokens[1], nil )
+					req = <- my_ch
+					if req.State == nil {
+						state = "OK"
+						jreason = string( req.Response_data.(string) )
+						reason = ""
+					} else {
+						reason = fmt.Sprintf( "%s", req.State )
+					}
+
 				case "pause":
 					if validate_auth( &auth_data, is_token, admin_roles ) {
 						if res_paused {							// already in a paused state, just say so and go on
@@ -1001,6 +1369,42 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 								res_name := mk_resname( )					// name used to track the reservation in the cache and given to queue setting commands for visual debugging
 								res, err = gizmos.Mk_bw_pledge( &h1, &h2, p1, p2, startt, endt, bandw_in, bandw_out, &res_name, tmap["cookie"], dscp, dscp_koe )
 							}
+
+							if err == nil && (tmap["ceiling"] != nil || tmap["burst"] != nil) {		// bandw is the guarantee; queues may borrow up to the ceiling
+								var ceil_in, ceil_out, burst int64
+								if tmap["ceiling"] != nil {
+									subtokens := strings.Split( *tmap["ceiling"], "," )			// inbound[,outbound] like bandw
+									ceil_in = int64( clike.Atof( subtokens[0] ) )
+									ceil_out = ceil_in
+									if len( subtokens ) > 1 {
+										ceil_out = int64( clike.Atof( subtokens[1] ) )
+									}
+								}
+								if tmap["burst"] != nil {
+									burst = int64( clike.Atof( *tmap["burst"] ) )
+								}
+								if err = res.Set_limits( ceil_in, ceil_out, burst ); err != nil {
+									res = nil
+								}
+							}
+
+							if err == nil {														// path constraints are passed through to the network manager
+								cspec := ""
+								for _, k := range []string{ "maxhops", "maxlatency", "avoid", "avoidsrlg" } {
+									if tmap[k] != nil {
+										cspec += fmt.Sprintf( "%s=%s ", k, *tmap[k] )
+									}
+								}
+
+								if cspec != "" {
+									var pc *gizmos.Path_constraints
+									if pc, err = gizmos.Mk_path_constraints( cspec ); err == nil {
+										res.Set_constraints( pc )
+									} else {
+										res = nil
+									}
+								}
+							}
 						}
 
 						if res != nil {															// able to make the reservation, continue and try to find a path with bandwidth
@@ -1010,11 +1414,17 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 							}
 
 							res.Set_vlan( v1, v2 )							// augment the rest of the reservation
+							res.Set_owner( pledge_owner( &auth_data, is_token, &h1 ) )
 							if tmap["ipv6"] != nil {
 								res.Set_matchv6( *tmap["ipv6"] == "true" )
 							}
 
-							reason, jreason, ecount = finalise_bw_res( res, res_paused )	// check for dup, allocate in network, and add to res manager inventory
+							if want_explain( tmap ) {
+								gp := gizmos.Pledge( res )
+								reason, jreason, ecount = explain_res( &gp )					// show what would be sent; nothing is reserved
+							} else {
+								reason, jreason, ecount = finalise_bw_res( res, res_paused )	// check for dup, allocate in network, and add to res manager inventory
+							}
 							if ecount == 0 {
 								state = "OK"
 							} else {
@@ -1081,11 +1491,17 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 						}
 
 						res.Set_vlan( v1 )													// augment the rest of the reservation
+						res.Set_owner( pledge_owner( &auth_data, is_token, &h1 ) )
 						if tmap["ipv6"] != nil {
 							res.Set_matchv6( *tmap["ipv6"] == "true" )
 						}
 
-						reason, jreason, ecount = finalise_bwow_res( res, res_paused )		// check for dup, allocate in network, and add to res manager inventory
+						if want_explain( tmap ) {
+							gp := gizmos.Pledge( res )
+							reason, jreason, ecount = explain_res( &gp )
+						} else {
+							reason, jreason, ecount = finalise_bwow_res( res, res_paused )		// check for dup, allocate in network, and add to res manager inventory
+						}
 						if ecount == 0 {
 							state = "OK"
 						} else {
@@ -1146,11 +1562,17 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 
 						if res != nil {												// able to make the reservation, continue and try to find a path with bandwidth
 							res.Set_vlan( vlan )									// augment the rest of the reservation
+							res.Set_owner( pledge_owner( &auth_data, is_token, &host ) )
 							if tmap["proto"] != nil {
 								res.Set_proto( tmap["proto"] )
 							}
 
-							reason, jreason, ecount = finalise_pt_res( res, res_paused )			// check for dup, ensure good ulcap, and add to res manager inventory if all ok
+							if want_explain( tmap ) {
+								gp := gizmos.Pledge( res )
+								reason, jreason, ecount = explain_res( &gp )
+							} else {
+								reason, jreason, ecount = finalise_pt_res( res, res_paused )			// check for dup, ensure good ulcap, and add to res manager inventory if all ok
+							}
 							if ecount == 0 {
 								state = "OK"
 							} else {
@@ -1168,7 +1590,7 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 
 					if ntokens < 5  {
 						nerrors++
-						reason = fmt.Sprintf( "incorrect number of parameters supplied: usage: steer [start-]end [token/]tenant ep1 ep2 mblist [cookie]; received: %s", recs[i] )
+						reason = fmt.Sprintf( "incorrect number of parameters supplied: usage: steer [balance=hash|weighted] [start-]end [token/]tenant ep1 ep2 mb[@w][+mb[@w]...][,mb...] [cookie]; received: %s", recs[i] )
 						break
 					}
 
@@ -1218,27 +1640,58 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 						nerrors++
 						break
 					}
+					res.Set_owner( pledge_owner( &auth_data, is_token, tmap["usrsp"] ) )		// user space was translated to project-id/ above
 
-					mbnames := strings.Split( *tmap["mblist"], "," )
-					for i := range mbnames {									// generate a mbox object for each
-						mbn := ""
-						if strings.Index( mbnames[i], "/" ) < 0 {				// add user space info out front
-							if tmap["usrsp"] != nil {
-								mbn = *tmap["usrsp"] + mbnames[i] 					// validation/translation adds a trailing /, so not needed here
+					bname := ""
+					if tmap["balance"] != nil {
+						bname = *tmap["balance"]
+					}
+					balance, err := gizmos.Mbp_policy( bname )						// how traffic is spread over the boxes of a pool
+					if err != nil {
+						reason = fmt.Sprintf( "unable to create a steering reservation: %s", err )
+						nerrors++
+						break
+					}
+
+					mbnames := strings.Split( *tmap["mblist"], "," )			// hops; a hop may be a pool: mb1[@weight]+mb2[@weight]...
+					for i := range mbnames {									// generate a pool of mbox objects for each
+						pool := gizmos.Mk_mbox_pool( &mbnames[i], balance )
+						members := strings.Split( mbnames[i], "+" )
+						for j := range members {
+							mname := members[j]
+							weight := 1
+							if k := strings.LastIndex( mname, "@" ); k > 0 {
+								weight = clike.Atoi( mname[k+1:] )
+								mname = mname[0:k]
+								if weight < 1 {
+									req.State = fmt.Errorf( "invalid middlebox weight: %s", members[j] )
+									break
+								}
 							}
-						} else {
-							mbn = mbnames[i]
-						}
 
-						update_graph( &mbn, true, true )							// this call will block until netmgr has updated the graph and osif has pushed updates into fqmgr
-						req.Send_req( nw_ch, my_ch, REQ_HOSTINFO, &mbn, nil )		// get host info string (mac, ip, switch)
-						req = <- my_ch
+							mbn := ""
+							if strings.Index( mname, "/" ) < 0 {				// add user space info out front
+								if tmap["usrsp"] != nil {
+									mbn = *tmap["usrsp"] + mname 					// validation/translation adds a trailing /, so not needed here
+								}
+							} else {
+								mbn = mname
+							}
+
+							update_graph( &mbn, true, true )							// this call will block until netmgr has updated the graph and osif has pushed updates into fqmgr
+							req.Send_req( nw_ch, my_ch, REQ_HOSTINFO, &mbn, nil )		// get host info string (mac, ip, switch)
+							req = <- my_ch
+							if req.State != nil {
+								break
+							}
+							htoks := strings.Split( req.Response_data.( string ), "," )					// results are: ip, mac, switch-id, switch-port; all strings
+							pool.Add_member( gizmos.Mk_mbox( &mname, &htoks[1], &htoks[2], clike.Atoi( htoks[3] ) ), weight )
+						}
 						if req.State != nil {
 							break
-						} else {
-							htoks := strings.Split( req.Response_data.( string ), "," )					// results are: ip, mac, switch-id, switch-port; all strings
-							res.Add_mbox( gizmos.Mk_mbox( &mbnames[i], &htoks[1], &htoks[2], clike.Atoi( htoks[3] ) ) )
 						}
+
+						res.Add_mbox_pool( pool )
 					}
 
 					if req.State == nil {											// all middle boxes were validated
@@ -1299,6 +1752,24 @@ func parse_post( out http.ResponseWriter, recs []string, sender string, xauth st
 						}
 					}
 
+				case "undrain":									// cancel a maintenance window
+					if validate_auth( &auth_data, is_token, admin_roles ) {
+						if ntokens != 2 {
+							reason = fmt.Sprintf( "bad undrain command: wanted 'undrain drain-id' received %d tokens", ntokens - 1 )
+							break
+						}
+
+						req = ipc.Mk_chmsg( )
+						req.Send_req( rmgr_ch, my_ch, REQ_UNDRAIN, &tokens[1], nil )
+						req = <- my_ch
+						if req.State == nil {
+							state = "OK"
+							reason = fmt.Sprintf( "drain cancelled: %s", tokens[1] )
+						} else {
+							reason = fmt.Sprintf( "%s", req.State )
+						}
+					}
+
 				case "verbose":									// verbose n [child-bleater]
 					if validate_auth( &auth_data, is_token, admin_roles ) {
 						if ntokens > 1 {
@@ -1412,9 +1883,11 @@ func parse_put( out http.ResponseWriter, recs []string, sender string, xauth str
 	Tokens are the tokens from the request. token[0] is assumed to be the request name and is ignored
 	as it could be different depending on the source of the call (POST vs DELETE).
 
+	Scope is the caller's project as returned by access_scope(); nil when access is cookie based.
+
 	err will be nil on success.
 */
-func delete_reservation( tokens []string ) ( err error ) {
+func delete_reservation( tokens []string, scope *string ) ( err error ) {
 
 	var (
 		my_ch		chan *ipc.Chmsg
@@ -1427,7 +1900,7 @@ func delete_reservation( tokens []string ) ( err error ) {
 	if ntokens < 2 || ntokens > 3  {
 		err = fmt.Errorf( "bad delete reservation command: wanted 'reservation res-ID [cookie]' received %d tokens", len( tokens ) - 1 )
 	} else {
-		del_data := make( []*string, 2, 2 )			// delete data is the reservation name and the cookie if supplied
+		del_data := make( []*string, 3, 3 )			// delete data is the reservation name, the cookie if supplied, and the project scope
 		del_data[0] = &tokens[1]
 		if ntokens < 3 {
 			del_data[1] = &empty_str
@@ -1435,6 +1908,7 @@ func delete_reservation( tokens []string ) ( err error ) {
 		} else {
 			del_data[1] = &tokens[2]
 		}
+		del_data[2] = scope
 
 		req := ipc.Mk_chmsg( )
 		req.Send_req( rmgr_ch, my_ch, REQ_DEL, del_data, nil )	// delete from the resmgr point of view		// res mgr sends delete on to network mgr (2014.07.07)
@@ -1472,6 +1946,8 @@ func parse_delete( out http.ResponseWriter, recs []string, sender string, xauth
 		nerrors		int = 0								// overall error count -- final status is error if non-zero
 		jdetails	string = ""							// result details in json
 		comment		string = ""							// comment about the state
+		auth_data	string								// data (token or sending address) sent for authorisation
+		is_token	bool								// flag when auth data is a token
 	)
 
 	fmt.Fprintf( out,  "\"reqstate\":[ " )				// wrap request output into an array
@@ -1485,6 +1961,23 @@ func parse_delete( out http.ResponseWriter, recs []string, sender string, xauth
 			continue
 		}
 
+		if len( tokens[0] ) > 5  && tokens[0][0:5] == "auth="	{		// same auth conventions as post
+			auth_data = tokens[0][5:]
+			tokens = tokens[1:]
+			ntokens--
+			is_token = true
+		} else {
+			auth_data = sender
+			is_token = false
+		}
+		if xauth != "" {
+			is_token = true
+			auth_data = xauth
+		}
+		if ntokens < 1 {
+			continue
+		}
+
 		req_count++
 		state = "ERROR"
 		jdetails = ""
@@ -1492,7 +1985,7 @@ func parse_delete( out http.ResponseWriter, recs []string, sender string, xauth
 		http_sheep.Baa( 2, "parse_delete for %s", tokens[0] )
 		switch tokens[0] {
 			case "reservation":									// expect:  reservation name(id) [cookie]
-				err := delete_reservation( tokens )
+				err := delete_reservation( tokens, access_scope( &auth_data, is_token ) )
 				if err == nil {
 					comment = "reservation successfully deleted"
 					state = "OK"
@@ -1574,18 +2067,23 @@ func api_deal_with( out http.ResponseWriter, in *http.Request ) {
 		auth = in.Header["X-Auth-Tegu"][0]
 	}
 
+	sender := in.RemoteAddr
+	if croles := cert2roles( in, cert_role_map ); croles != "" {		// verified client cert with mapped roles is used in place of the address
+		sender = CERT_AUTH_PFX + croles
+	}
+
 	switch in.Method {
 		case "PUT":
-			state, msg = parse_put( out, recs, in.RemoteAddr, auth )
+			state, msg = parse_put( out, recs, sender, auth )
 
 		case "POST":
-			state, msg = parse_post( out, recs, in.RemoteAddr, auth )
+			state, msg = parse_post( out, recs, sender, auth )
 
 		case "DELETE":
-			state, msg = parse_delete( out, recs, in.RemoteAddr, auth )
+			state, msg = parse_delete( out, recs, sender, auth )
 
 		case "GET":				// used for file transfer, so we must handle the return here and not let it go out the bottom
-			state, msg = parse_get( out, in.RequestURI, in.RemoteAddr, auth )
+			state, msg = parse_get( out, in.RequestURI, sender, auth )
 			http_sheep.Baa( 1, "get processing finished: %s, %s", state, msg )
 			return
 
@@ -1608,6 +2106,10 @@ func Http_api( api_port *string, nwch chan *ipc.Chmsg, rmch chan *ipc.Chmsg ) {
 		ssl_cert *string = nil
 		create_cert bool = false
 		err	error
+		client_ca	string = ""						// CA bundle(s) used to verify client certificates
+		client_auth	string = "none"					// none, request, require
+		key_type	string = DEF_KEY_TYPE			// type of key generated with create_cert
+		cert_refresh int = 60						// seconds between checks for changed certificate files
 	)
 
 	http_sheep = bleater.Mk_bleater( 0, os.Stderr )		// allocate our bleater and attach it to the master
@@ -1626,6 +2128,8 @@ func Http_api( api_port *string, nwch chan *ipc.Chmsg, rmch chan *ipc.Chmsg ) {
 	sysproc_roles = &ar_str
 	mr_str := "tegu_mirror"
 	mirror_roles =  &mr_str
+	ur_str := "_member_,Member,member"					// default roles that identify a project member making reservations
+	user_roles = &ur_str
 
 	tclass2dscp = make( map[string]int, 5 )			// TODO: these need to come from the config file
 	tclass2dscp["voice"] = 46
@@ -1652,6 +2156,27 @@ func Http_api( api_port *string, nwch chan *ipc.Chmsg, rmch chan *ipc.Chmsg ) {
 			create_cert = true
 		}
 
+		if p = cfg_data["httpmgr"]["key_type"]; p != nil {
+			key_type = *p
+		}
+
+		if p = cfg_data["httpmgr"]["client_ca"]; p != nil {
+			client_ca = *p
+			client_auth = "require"							// if CAs given, default to requiring a cert
+		}
+
+		if p = cfg_data["httpmgr"]["client_auth"]; p != nil {
+			client_auth = *p
+		}
+
+		if p = cfg_data["httpmgr"]["cert_roles"]; p != nil {
+			cert_role_map = parse_cert_roles( *p )
+		}
+
+		if p = cfg_data["httpmgr"]["cert_refresh"]; p != nil {
+			cert_refresh = clike.Atoi( *p )
+		}
+
 		p = cfg_data["httpmgr"]["priv_auth"]
 		if p != nil {
 			switch *p {
@@ -1681,6 +2206,22 @@ func Http_api( api_port *string, nwch chan *ipc.Chmsg, rmch chan *ipc.Chmsg ) {
 		if p != nil {
 			sysproc_roles = p
 		}
+
+		p = cfg_data["httpmgr"]["user_roles"]
+		if p != nil {
+			user_roles = p
+		}
+
+		p = cfg_data["httpmgr"]["res_access"]
+		if p != nil {
+			switch *p {
+				case RA_COOKIE, RA_PROJECT:
+					res_access = *p
+
+				default:
+					http_sheep.Baa( 0, `WRN: invalid reservation access type (%s), defaulting to "%s"  [TGUHTP003]`, *p, RA_PROJECT )
+			}
+		}
 	}
 
 	enable_mirroring := false										// off if section is missing all together
@@ -1704,6 +2245,8 @@ func Http_api( api_port *string, nwch chan *ipc.Chmsg, rmch chan *ipc.Chmsg ) {
 	http_sheep.Baa( 1, "admin roles: %s", *admin_roles )
 	http_sheep.Baa( 1, "sysproc roles: %s", *sysproc_roles )
 	http_sheep.Baa( 1, "mirror roles: %s", *mirror_roles )
+	http_sheep.Baa( 1, "user roles: %s", *user_roles )
+	http_sheep.Baa( 1, "reservation access: %s", res_access )
 
 	http.HandleFunc( "/tegu/api", api_deal_with )					// reserve/delete etc should eventually be removed from this
 	http.HandleFunc( "/tegu/bandwidth", api_deal_with )				// define bandwidth callback TODO: add a callback specifically for bandwidth things
@@ -1720,22 +2263,43 @@ func Http_api( api_port *string, nwch chan *ipc.Chmsg, rmch chan *ipc.Chmsg ) {
 	isSSL = (ssl_cert != nil && *ssl_cert != "" && ssl_key != nil && *ssl_key != "")
 	if isSSL {
 		if  create_cert {
-			http_sheep.Baa( 1, "creating SSL certificate and key: %s %s", *ssl_cert, *ssl_key )
+			http_sheep.Baa( 1, "creating SSL certificate and key (%s): %s %s", key_type, *ssl_cert, *ssl_key )
 			dns_list := make( []string, 3 )
 			dns_list[0] = "localhost"
 			this_host, _ := os.Hostname( )
 			tokens := strings.Split( this_host, "." )
 			dns_list[1] = this_host
 			dns_list[2] = tokens[0]
-			cert_name := "tegu_cert"
-			err = security.Mk_cert( 1024, &cert_name, dns_list, ssl_cert, ssl_key )
+			err = mk_cert( key_type, "tegu_cert", dns_list, *ssl_cert, *ssl_key )
     		if err != nil {
-				http_sheep.Baa( 0, "ERR: unable to create a certificate: %s %s: %s  [TGUHTP001]", ssl_cert, ssl_key, err )
+				http_sheep.Baa( 0, "ERR: unable to create a certificate: %s %s: %s  [TGUHTP001]", *ssl_cert, *ssl_key, err )
 			}
 		}
 
-		http_sheep.Baa( 1, "http interface running and listening for TLS connections on %s", *api_port )
-		err = http.ListenAndServeTLS( ":" + *api_port, *ssl_cert, *ssl_key,  nil )		// drive the bus
+		var (
+			ts		*tls_store
+			tcfg	*tls.Config
+		)
+
+		ts, err = mk_tls_store( *ssl_cert, *ssl_key, client_ca )
+		if err != nil {
+			http_sheep.Baa( 0, "ERR: unable to load TLS certificate or client CA: %s  [TGUHTP004]", err )
+			syscall.Exit( 1 )
+		}
+
+		tcfg, err = ts.Server_config( client_auth )
+		if err != nil {
+			http_sheep.Baa( 0, "ERR: unable to configure TLS: %s  [TGUHTP004]", err )
+			syscall.Exit( 1 )
+		}
+		go ts.watch( cert_refresh )											// reload certs/CAs when the files change
+
+		server := &http.Server {
+			Addr:		":" + *api_port,
+			TLSConfig:	tcfg,
+		}
+		http_sheep.Baa( 1, "http interface running and listening for TLS connections on %s (client certs: %s)", *api_port, client_auth )
+		err = server.ListenAndServeTLS( "", "" )				// certificate is supplied by the store
 	} else {
 		http_sheep.Baa( 1, "http interface running and listening for connections on %s", *api_port )
 		err = http.ListenAndServe( ":" + *api_port, nil )		// drive the bus
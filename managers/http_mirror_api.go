@@ -28,8 +28,9 @@
 
 				These requests are supported:
 					POST /tegu/mirrors/
+					PUT|PATCH /tegu/mirrors/<name>/[?cookie=cookie]
 					DELETE /tegu/mirrors/<name>/[?cookie=cookie]
-					GET /tegu/mirrors/
+					GET /tegu/mirrors/[?project=id&port=port&output=output&state=active|pending]
 					GET /tegu/mirrors/<name>/[?cookie=cookie]
 
 	Author:		Robert Eby
@@ -45,6 +46,19 @@
 				24 Nov 2015 - Add options
 				09 Jan 2016 - Add more options
 				06 Mar 2016 - Switched some res mgr requests to special lookup channel to prevent deadlock
+				18 Oct 2026 - Record owner on mirror pledges; project based access replaces the cookie check
+							unless res_access is cookie.
+				19 Oct 2026 - Added filter (direction, protocol, ports, cidrs, sampling) to the mirror request.
+				19 Oct 2026 - Added tunnel_type (gre, erspan2, erspan3, vxlan) and tunnel_id with an allow list
+							per tunnel type.
+				19 Oct 2026 - Added bandwidth (declared or estimated) which is reserved toward the output and
+							limits the mirror's traffic.
+				19 Oct 2026 - Reject a mirror without a bandwidth when port_bandwidth isn't configured; vlan
+							outputs are rate limited too.
+				19 Oct 2026 - Added PUT/PATCH (extend, add/remove ports) and GET list filters (project, port,
+							output, state).
+				19 Oct 2026 - PUT/PATCH checks the mirror's project only with project access; an estimated
+							bandwidth is estimated again when ports change.
 */
 
 package managers
@@ -60,6 +74,7 @@ import (
 	"strings"
 	"sync"
 	"time"
+	"github.com/att/gopkgs/clike"
 	"github.com/att/gopkgs/ipc"
 	"github.com/att/tegu/gizmos"
 )
@@ -176,14 +191,25 @@ func getNameAndCookie(in *http.Request) (name string, cookie string) {
 	return
 }
 
+/*
+ * Build the name/cookie[/project] data passed to res mgr for get and delete requests.
+ * The project is added only when access is project based.
+ */
+func mirrorReqData(name *string, cookie *string, projid *string) ([]*string) {
+	if res_access == RA_PROJECT {
+		return []*string { name, cookie, projid }
+	}
+	return []*string { name, cookie }
+}
+
 /*
  * Given a name, find the mirror that goes with the name.
  */
-func lookupMirror(name string, cookie string) (mirror *gizmos.Pledge_mirror) {
+func lookupMirror(name string, cookie string, projid string) (mirror *gizmos.Pledge_mirror) {
 	req := ipc.Mk_chmsg( )
 	my_ch := make( chan *ipc.Chmsg )					// allocate channel for responses to our requests
 	defer close( my_ch )
-	req.Send_req( rmgrlu_ch, my_ch, RMLU_GET, [] *string { &name, &cookie }, nil )
+	req.Send_req( rmgrlu_ch, my_ch, RMLU_GET, mirrorReqData( &name, &cookie, &projid ), nil )
 	req = <- my_ch
 	if req.State == nil {
 		mi := req.Response_data.( *gizmos.Pledge )    // assert to iface pointer
@@ -258,6 +284,16 @@ func convertToJSON(mirror *gizmos.Pledge_mirror, scheme string, host string) (st
 	if options != nil && *options != "" {
 		bs.WriteString(fmt.Sprintf("  \"options\": \"%s\",\n", *options))
 	}
+	if filter := mirror.Get_filter(); filter != nil {
+		bs.WriteString(fmt.Sprintf("  \"filter\": %s,\n", filter.To_json()))
+	}
+	if ttype, tunid := mirror.Get_tunnel(); ttype != gizmos.MT_GRE {
+		bs.WriteString(fmt.Sprintf("  \"tunnel_type\": \"%s\",\n", ttype))
+		bs.WriteString(fmt.Sprintf("  \"tunnel_id\": %d,\n", tunid))
+	}
+	if bw := mirror.Get_bandwidth(); bw > 0 {
+		bs.WriteString(fmt.Sprintf("  \"bandwidth\": %d,\n", bw))
+	}
 
 	stdout, stderr := mirror.Get_Output()
 	appendList(bs, stdout, "standard_output")
@@ -432,18 +468,28 @@ func validatePort(port *string, tenant_id *string) (vm *Net_vm, err error) {
 func cidrMatches(ip net.IP, cidr string) (bool) {
 	_, net, err := net.ParseCIDR(cidr)
 	if err != nil {
-		http_sheep.Baa( 1, "Invalid CIDR for allowed_gre_addr in the configuration file: %s", cidr )
+		http_sheep.Baa( 1, "Invalid CIDR for a mirror allowed address list in the configuration file: %s", cidr )
 		return false
 	}
 	return net.Contains(ip)
 }
 
-func validateAllowedOutputIP(port *string) (err error) {
-	oklist := cfg_data["mirror"]["allowed_gre_addr"]
+/*
+ * Validate the tunnel endpoint against the allow list for the tunnel type (allowed_<type>_addr
+ * where type is gre, erspan or vxlan).  If the list for erspan or vxlan isn't configured
+ * allowed_gre_addr applies.
+ */
+func validateAllowedOutputIP(port *string, ttype string) (err error) {
+	family := gizmos.Mirror_tunnel_family(ttype)
+	oklist := cfg_data["mirror"]["allowed_" + family + "_addr"]
+	if oklist == nil {
+		oklist = cfg_data["mirror"]["allowed_gre_addr"]
+	}
+	tname := strings.ToUpper(family)
 	if oklist != nil {
 		ip := net.ParseIP(*port)
 		if ip == nil {
-			err = fmt.Errorf("output GRE port %s is not a valid IP address.", *port)
+			err = fmt.Errorf("output %s port %s is not a valid IP address.", tname, *port)
 			return
 		}
 		for _, cidr := range strings.Split(*oklist, ",") {
@@ -451,12 +497,12 @@ func validateAllowedOutputIP(port *string) (err error) {
 				return
 			}
 		}
-		err = fmt.Errorf("output GRE port %s does not match any allowed CIDR in the configuration.", *port)
+		err = fmt.Errorf("output %s port %s does not match any allowed CIDR in the configuration.", tname, *port)
 	}
 	return
 }
 
-func validateOutputPort(port *string, tenant_id *string) (newport *string, err error) {
+func validateOutputPort(port *string, tenant_id *string, ttype string) (newport *string, err error) {
 	if port == nil {
 		err = fmt.Errorf("no output port specified.")
 		return
@@ -468,7 +514,7 @@ func validateOutputPort(port *string, tenant_id *string) (newport *string, err e
 		for k, v := range mirsect {
 			if k == label {
 				newport = v
-				err = validateAllowedOutputIP(newport)
+				err = validateAllowedOutputIP(newport, ttype)
 				return
 			}
 		}
@@ -478,7 +524,7 @@ func validateOutputPort(port *string, tenant_id *string) (newport *string, err e
 	if strings.Index(*port, "/") < 0 {
 		if net.ParseIP(*port) != nil {
 			// simple name or IP, assumed to be OK
-			err = validateAllowedOutputIP(port)
+			err = validateAllowedOutputIP(port, ttype)
 			if err == nil {
 				newport = port
 			}
@@ -486,7 +532,7 @@ func validateOutputPort(port *string, tenant_id *string) (newport *string, err e
 			// need to map DNS name to IP addr
 			addrs, err := net.LookupHost(*port)
 			if addrs != nil && err == nil {
-				err = validateAllowedOutputIP( &addrs[0] )
+				err = validateAllowedOutputIP( &addrs[0], ttype )
 				if err == nil {
 					newport = &addrs[0]
 				}
@@ -508,15 +554,148 @@ func validateOutputPort(port *string, tenant_id *string) (newport *string, err e
 }
 
 /*
- * Handle a PUT request (not supported currently).
+ * Handle a PUT or PATCH request: extend (or shorten) the end time, add or remove ports.
+ * Only the change is pushed to the agent; the mirror is not torn down.
  */
-func mirror_put( out http.ResponseWriter ) (code int, msg string) {
-	code = http.StatusMethodNotAllowed
-	msg = "PUT /tegu/mirrors/ requests are unsupported"
-	http_sheep.Baa( 1, msg )
+func mirror_put( in *http.Request, out http.ResponseWriter, projid string, data []byte ) (code int, msg string) {
+	http_sheep.Baa( 5, "Request data: " + string(data))
+
+	type req_type struct {
+		End_time	string	 `json:"end_time"`		// +n extends the current end time by n seconds
+		Port		[]string `json:"port"`			// replaces the list of ports
+		Add_port	[]string `json:"add_port"`
+		Del_port	[]string `json:"del_port"`
+	}
+	var req req_type
+	if err := json.Unmarshal(data, &req); err != nil {
+		code = http.StatusBadRequest
+		msg = "Bad JSON: " + err.Error()
+		return
+	}
+	if req.End_time == "" && req.Port == nil && len(req.Add_port) == 0 && len(req.Del_port) == 0 {
+		code = http.StatusBadRequest
+		msg = "Nothing to change: end_time, port, add_port or del_port must be given."
+		return
+	}
+
+	name, cookie := getNameAndCookie(in)
+	mirror := lookupMirror(name, cookie, projid)
+	if mirror == nil {
+		code = http.StatusNotFound
+		msg = "Not found."
+		return
+	}
+	if res_access == RA_COOKIE && ! mirror.Is_valid_cookie(&cookie) {
+		code = http.StatusUnauthorized
+		msg = "Unauthorized."
+		return
+	}
+	if res_access == RA_PROJECT && *mirror.Get_Tenant() != projid {
+		code = http.StatusUnauthorized
+		msg = "Unauthorized: you don't own this mirror."
+		return
+	}
+
+	// new end time: absolute, unbounded, or +n from the current end
+	u := &mirror_update { name: &name, cookie: &cookie }
+	if res_access == RA_PROJECT {
+		u.project = &projid
+	}
+	if req.End_time != "" {
+		_, e := mirror.Get_window()
+		var err error
+		switch {
+			case req.End_time == "unbounded":
+				u.expiry = gizmos.DEF_END_TS
+
+			case req.End_time[0:1] == "+":
+				u.expiry, err = strconv.ParseInt(req.End_time[1:], 0, 64)
+				u.expiry += e
+
+			default:
+				u.expiry, err = strconv.ParseInt(req.End_time, 0, 64)
+		}
+		if err != nil || u.expiry <= 0 {
+			code = http.StatusBadRequest
+			msg = "Invalid end_time: " + req.End_time
+			return
+		}
+	}
+
+	// ports to add must be on the mirror's physical host; a port list replaces the ports
+	add := req.Add_port
+	if req.Port != nil {
+		add = append( add, req.Port... )
+	}
+	if len(add) > 0 {
+		plist, err := validatePorts(add, name, &projid)
+		if err != nil {
+			code = http.StatusBadRequest
+			msg = err.Error()
+			return
+		}
+		for phost, mi := range *plist {
+			if phost != *mirror.Get_qid() {
+				code = http.StatusBadRequest
+				msg = fmt.Sprintf("Port(s) %s are not on the mirror's physical host (%s); create another mirror for them.", strings.Join(mi.ports, ","), *mirror.Get_qid())
+				return
+			}
+			u.add = append( u.add, mi.ports... )
+		}
+	}
+	for _, p := range req.Del_port {
+		u.del = append( u.del, mirrorPortKey( p, &projid ) )
+	}
+	if req.Port != nil {									// everything not in the new list is removed
+		keep := make( map[string]bool )
+		for _, p := range u.add {
+			keep[p] = true
+		}
+		for _, p := range mirror.Get_ports() {
+			if ! keep[p] {
+				u.del = append( u.del, p )
+			}
+		}
+	}
+
+	my_ch := make( chan *ipc.Chmsg )						// allocate channel for responses to our requests
+	defer close( my_ch )									// close it on return
+	msgreq := ipc.Mk_chmsg( )
+	msgreq.Send_req( rmgr_ch, my_ch, REQ_MIRROR_UPDATE, u, nil )	// res_mgr makes the change and pushes the delta
+	msgreq = <- my_ch
+	if msgreq.State != nil {
+		code = http.StatusBadRequest
+		msg = msgreq.State.Error()
+		return
+	}
+
+	ckptreq := ipc.Mk_chmsg( )
+	ckptreq.Send_req( rmgr_ch, nil, REQ_CHKPT, nil, nil )	// request a chkpt now, but don't wait on it
+
+	scheme := "http"
+	if (isSSL) {
+		scheme = "https"
+	}
+	code = http.StatusOK
+	msg = convertToJSON(mirror, scheme, in.Host)
 	return
 }
 
+/*
+ *	Convert a port given by the user to the form kept in the mirror (MAC, or neutron UUID).
+ *	If the port cannot be looked up, it is returned as given (less any mac: prefix).
+ */
+func mirrorPortKey( port string, tenant_id *string ) ( string ) {
+	port = strings.TrimPrefix( port, "mac:" )
+	if gizmos.IsMAC(port) || gizmos.IsUUID(port) {
+		return port
+	}
+	if vm, err := validatePort(&port, tenant_id); err == nil && vm != nil && vm.mac != nil {
+		return *vm.mac
+	}
+	return port
+}
+
 /*
  *	Parse and react to a POST to /tegu/mirrors/. We expect JSON describing the mirror request, to wit:
  *		{
@@ -527,6 +706,19 @@ func mirror_put( out http.ResponseWriter ) (code int, msg string) {
  *			"vlan": "vlan",                      // optional
  *			"cookie": "value",                   // optional
  *			"name": "mirrorname",                // optional
+ *			"options": "opt1,opt2",              // optional
+ *			"tunnel_type": "gre|erspan2|erspan3|vxlan", // optional; when output is an address (default gre)
+ *			"tunnel_id": n,                      // optional; erspan session id or vxlan vni (allocated if omitted)
+ *			"bandwidth": "n[K|M|G]",             // optional; reserved toward the output and limits it (estimated if omitted)
+ *			"filter": {                          // optional; forces a flowmod based mirror (GRE output only)
+ *				"direction": "in|out|both",
+ *				"protocol": "tcp|udp|sctp|icmp|n",
+ *				"src_port": "n[-m]",
+ *				"dst_port": "n[-m]",
+ *				"src_cidr": "cidr",
+ *				"dst_cidr": "cidr",
+ *				"sample": n                      // mirror 1 of every n flows
+ *			}
  *		}
  *
  *	Because multiple mirrors may be created as a result, we return an array of JSON results, one for each mirror:
@@ -539,7 +731,7 @@ func mirror_put( out http.ResponseWriter ) (code int, msg string) {
  *		  ....
  *		]
  */
-func mirror_post( in *http.Request, out http.ResponseWriter, projid string, data []byte ) (code int, msg string) {
+func mirror_post( in *http.Request, out http.ResponseWriter, userid string, projid string, data []byte ) (code int, msg string) {
 	http_sheep.Baa( 5, "Request data: " + string(data))
 	code = http.StatusOK
 
@@ -553,6 +745,18 @@ func mirror_post( in *http.Request, out http.ResponseWriter, projid string, data
 		Cookie 		string	 `json:"cookie"`
 		Name 		string	 `json:"name"`
 		Options		string	 `json:"options"`
+		Tunnel_type	string	 `json:"tunnel_type"`
+		Tunnel_id	int		 `json:"tunnel_id"`
+		Bandwidth	string	 `json:"bandwidth"`		// cap on mirrored traffic (e.g. 200M); estimated if missing
+		Filter		*struct {
+			Direction	string	`json:"direction"`
+			Protocol	string	`json:"protocol"`
+			Src_port	string	`json:"src_port"`
+			Dst_port	string	`json:"dst_port"`
+			Src_cidr	string	`json:"src_cidr"`
+			Dst_cidr	string	`json:"dst_cidr"`
+			Sample		int		`json:"sample"`
+		}	`json:"filter"`
 	}
 	var req req_type
 	if err := json.Unmarshal(data, &req); err != nil {
@@ -598,14 +802,39 @@ func mirror_post( in *http.Request, out http.ResponseWriter, projid string, data
 		return
 	}
 
-	// 5. Validate output port
-	newport, err := validateOutputPort(&req.Output, &projid)
+	// 5. Validate output port and tunnel type
+	tmax := gizmos.Mirror_tunnel_max(req.Tunnel_type)
+	if tmax < 0 {
+		code = http.StatusBadRequest
+		msg = "Invalid tunnel_type: " + req.Tunnel_type + "; must be one of gre, erspan2, erspan3, vxlan"
+		return
+	}
+	if req.Tunnel_id < 0 || req.Tunnel_id > tmax {
+		code = http.StatusBadRequest
+		if tmax == 0 {
+			msg = "tunnel_id may not be given for a GRE output."
+		} else {
+			msg = fmt.Sprintf("tunnel_id for %s must be between 1 and %d.", req.Tunnel_type, tmax)
+		}
+		return
+	}
+	newport, err := validateOutputPort(&req.Output, &projid, req.Tunnel_type)
 	if err != nil {
 		code = http.StatusBadRequest
 		msg = err.Error()
 		return
 	}
+	if newport == nil {
+		code = http.StatusBadRequest
+		msg = "Unable to resolve output: " + req.Output
+		return
+	}
 	req.Output = *newport
+	if tmax > 0 && net.ParseIP(req.Output) == nil {
+		code = http.StatusBadRequest
+		msg = "A " + req.Tunnel_type + " output must be an IP address, DNS name or label."
+		return
+	}
 
 	// 6. Validate options, if present
 	if req.Options != "" {
@@ -618,6 +847,53 @@ func mirror_post( in *http.Request, out http.ResponseWriter, projid string, data
 		}
 	}
 
+	// 6a. Validate the filter; filtering is only possible with a flowmod based mirror which needs a GRE output
+	var filter *gizmos.Mirror_filter
+	if req.Filter != nil {
+		f := req.Filter
+		filter, err = gizmos.Mk_mirror_filter( f.Direction, f.Protocol, f.Src_port, f.Dst_port, f.Src_cidr, f.Dst_cidr, f.Sample )
+		if err != nil {
+			code = http.StatusBadRequest
+			msg = err.Error()
+			return
+		}
+		if net.ParseIP( req.Output ) == nil {
+			code = http.StatusBadRequest
+			msg = "A mirror filter requires the output to be a tunnel (IP address)."
+			return
+		}
+
+		if req.Options == "" {
+			req.Options = "flowmod"
+		} else if ! strings.Contains( ","+req.Options+",", ",flowmod," ) {
+			req.Options += ",flowmod"
+		}
+	}
+
+	// 6b. Validate the bandwidth; tunnel and vlan outputs are rate limited with flowmods
+	bandw := int64( -1 )											// estimate per mirror
+	if req.Bandwidth != "" {
+		bandw = int64( clike.Atof( req.Bandwidth ) )
+		if bandw <= 0 {
+			code = http.StatusBadRequest
+			msg = "Invalid bandwidth: " + req.Bandwidth
+			return
+		}
+	} else {
+		if mirror_port_bw() <= 0 {									// nothing to estimate from; the mirror would escape admission control
+			code = http.StatusBadRequest
+			msg = "A bandwidth is required: give bandwidth in the request or configure port_bandwidth in the mirror section"
+			return
+		}
+	}
+	if net.ParseIP( req.Output ) != nil || strings.HasPrefix( req.Output, "vlan:" ) {
+		if req.Options == "" {
+			req.Options = "flowmod"
+		} else if ! strings.Contains( ","+req.Options+",", ",flowmod," ) {
+			req.Options += ",flowmod"
+		}
+	}
+
 	// 7. Make one pledge per mirror, send to reservation mgr, build JSON return string
 	scheme := "http"
 	if (isSSL) {
@@ -633,6 +909,15 @@ func mirror_post( in *http.Request, out http.ResponseWriter, projid string, data
 			nam   := mirror.name
 			res, err := gizmos.Mk_mirror_pledge( mirror.ports, &req.Output, stime, etime, &nam, &req.Cookie, &phost, &req.Vlan, &projid, &req.Options )
 			if res != nil {
+				res.Set_owner( &userid, &projid )
+				res.( *gizmos.Pledge_mirror ).Set_filter( filter )
+				res.( *gizmos.Pledge_mirror ).Set_tunnel( req.Tunnel_type, req.Tunnel_id )		// id of 0 is allocated by res_mgr
+				if bandw > 0 {
+					res.( *gizmos.Pledge_mirror ).Set_bandwidth( bandw )
+				} else {
+					res.( *gizmos.Pledge_mirror ).Set_bandwidth( mirror_estimate( len( mirror.ports ), filter ) )
+					res.( *gizmos.Pledge_mirror ).Set_bw_estimated( true )
+				}
 				req := ipc.Mk_chmsg( )
 				my_ch := make( chan *ipc.Chmsg )					// allocate channel for responses to our requests
 				defer close( my_ch )								// close it on return
@@ -648,13 +933,24 @@ func mirror_post( in *http.Request, out http.ResponseWriter, projid string, data
 					}
 				} else {
 					req = ipc.Mk_chmsg( )
-					ip := gizmos.Pledge( res )							// must pass an interface pointer to resmgr
-					req.Send_req( rmgr_ch, my_ch, REQ_ADD, &ip, nil )	// network OK'd it, so add it to the inventory
-					req = <- my_ch										// wait for completion
+					req.Send_req( nw_ch, my_ch, REQ_MIRROR_RESERVE, res, nil )	// admission control: reserve bandwidth toward the output
+					req = <- my_ch
 
 					if req.State == nil {
-						ckptreq := ipc.Mk_chmsg( )
-						ckptreq.Send_req( rmgr_ch, nil, REQ_CHKPT, nil, nil )	// request a chkpt now, but don't wait on it
+						req = ipc.Mk_chmsg( )
+						ip := gizmos.Pledge( res )							// must pass an interface pointer to resmgr
+						req.Send_req( rmgr_ch, my_ch, REQ_ADD, &ip, nil )	// network OK'd it, so add it to the inventory
+						req = <- my_ch										// wait for completion
+
+						if req.State == nil {
+							ckptreq := ipc.Mk_chmsg( )
+							ckptreq.Send_req( rmgr_ch, nil, REQ_CHKPT, nil, nil )	// request a chkpt now, but don't wait on it
+						} else {
+							err = fmt.Errorf( "%s", req.State )
+							req = ipc.Mk_chmsg( )
+							req.Send_req( nw_ch, my_ch, REQ_DEL, res, nil )		// not added; give back the bandwidth
+							<- my_ch
+						}
 					} else {
 						err = fmt.Errorf( "%s", req.State )
 					}
@@ -696,18 +992,47 @@ func mirror_post( in *http.Request, out http.ResponseWriter, projid string, data
 	return
 }
 
+/*
+ *	Returns the bandwidth assumed for each mirrored port when the request doesn't give one
+ *	(mirror section port_bandwidth; 0 if not configured).
+ */
+func mirror_port_bw( ) ( int64 ) {
+	if p := cfg_data["mirror"]["port_bandwidth"]; p != nil {
+		return int64( clike.Atof( *p ) )
+	}
+	return 0
+}
+
+/*
+ *	Estimate the bandwidth of a mirror which didn't declare one: the configured bandwidth
+ *	for each port, halved if only one direction is mirrored, and reduced by the sampling ratio.
+ */
+func mirror_estimate( nports int, filter *gizmos.Mirror_filter ) ( int64 ) {
+	bw := mirror_port_bw() * int64( nports )
+	if filter.Get_direction() != gizmos.MF_BOTH {
+		bw /= 2
+	}
+	if n := filter.Get_sample(); n > 1 {
+		bw /= int64( n )
+	}
+	if bw < 1 {
+		bw = 1			// never let an estimate drop the mirror out of admission control
+	}
+	return bw
+}
+
 /*
  * Handle a DELETE /tegu/mirrors/<name>/[?cookie=<cookie>] request.
  */
 func mirror_delete( in *http.Request, out http.ResponseWriter, projid string ) (code int, msg string) {
 	name, cookie := getNameAndCookie(in)
-	mirror := lookupMirror(name, cookie)
+	mirror := lookupMirror(name, cookie, projid)
 	if mirror == nil {
 		code = http.StatusNotFound
 		msg = "Not found."
 		return
 	}
-	if ! mirror.Is_valid_cookie(&cookie) {
+	if res_access == RA_COOKIE && ! mirror.Is_valid_cookie(&cookie) {
 		code = http.StatusUnauthorized
 		msg = "Unauthorized."
 		return
@@ -721,8 +1046,7 @@ func mirror_delete( in *http.Request, out http.ResponseWriter, projid string ) (
 	req := ipc.Mk_chmsg( )
 	my_ch := make( chan *ipc.Chmsg )					// allocate channel for responses to our requests
 	defer close( my_ch )								// close it on return
-	namepluscookie := []*string { &name, &cookie }
-	req.Send_req( rmgr_ch, my_ch, REQ_DEL, namepluscookie, nil )	// remove the reservation
+	req.Send_req( rmgr_ch, my_ch, REQ_DEL, mirrorReqData( &name, &cookie, &projid ), nil )	// remove the reservation
 	req = <- my_ch										// wait for completion
 
 	if req.State == nil {
@@ -739,21 +1063,53 @@ func mirror_delete( in *http.Request, out http.ResponseWriter, projid string ) (
  * Handle a GET /tegu/mirrors/ or GET /tegu/mirrors/<name>/[?cookie=<cookie>] request.
  * The first form lists all mirrors, the second form list details of one mirror.
  */
-func mirror_get( in *http.Request, out http.ResponseWriter, projid string ) (code int, msg string) {
+func mirror_get( in *http.Request, out http.ResponseWriter, projid string, admin bool ) (code int, msg string) {
 	name, cookie := getNameAndCookie(in)
 	scheme := "http"
 	if (isSSL) {
 		scheme = "https"
 	}
 	if name == "" {
-		// List all mirrors
+		// List all mirrors, optionally filtered by project (admin), port, output and state
+		v := in.URL.Query()
+		fproj := v.Get("project")
+		fport := v.Get("port")
+		fout := v.Get("output")
+		fstate := v.Get("state")
+		if fstate != "" && fstate != "active" && fstate != "pending" {
+			code = http.StatusBadRequest
+			msg = "Invalid state: " + fstate + "; must be active or pending"
+			return
+		}
+
+		lcookie := cookie
+		lproj := projid
+		if fproj == "" {
+			fproj = projid
+		} else if fproj != projid {
+			if ! admin {
+				code = http.StatusUnauthorized
+				msg = "Unauthorized: an admin role is required to list mirrors of another project."
+				return
+			}
+			lcookie = *super_cookie
+			lproj = ALL_PROJECTS
+		}
+		if fport != "" {
+			ptenant := projid
+			if fproj != ALL_PROJECTS {
+				ptenant = fproj
+			}
+			fport = mirrorPortKey( fport, &ptenant )
+		}
+
 		list := getMirrors()
 		sep := "\n"
 		bs := bytes.NewBufferString("[")
 		for _, s := range list {
 			if s != "" {
-				mirror := lookupMirror(s, cookie)
-				if mirror != nil && *mirror.Get_Tenant() == projid{
+				mirror := lookupMirror(s, lcookie, lproj)
+				if mirror != nil && (fproj == ALL_PROJECTS || *mirror.Get_Tenant() == fproj) && mirrorMatches(mirror, fport, fout, fstate) {
 					bs.WriteString(fmt.Sprintf(`%s { "name": "%s", "url": "%s://%s/tegu/mirrors/%s/" }`, sep, s, scheme, in.Host, s))
 					sep = ",\n"
 				}
@@ -763,13 +1119,13 @@ func mirror_get( in *http.Request, out http.ResponseWriter, projid string ) (cod
 		code = http.StatusOK
 		msg = bs.String()
 	} else {
-		mirror := lookupMirror(name, cookie)
+		mirror := lookupMirror(name, cookie, projid)
 		if mirror == nil {
 			code = http.StatusNotFound
 			msg = "Not found."
 			return
 		}
-		if ! mirror.Is_valid_cookie(&cookie) {
+		if res_access == RA_COOKIE && ! mirror.Is_valid_cookie(&cookie) {
 			code = http.StatusUnauthorized
 			msg = "Unauthorized: cookie not valid."
 			return
@@ -788,11 +1144,44 @@ func mirror_get( in *http.Request, out http.ResponseWriter, projid string ) (cod
 /*
  *  All requests to the /tegu/mirrors/ URL subtree are funneled here for handling.
  */
+/*
+ *	Returns true if the mirror matches the port, output and state given ("" matches anything).
+ */
+func mirrorMatches( mirror *gizmos.Pledge_mirror, port string, output string, state string ) ( bool ) {
+	if port != "" {
+		found := false
+		for _, p := range mirror.Get_ports() {
+			if strings.EqualFold( p, port ) {
+				found = true
+				break
+			}
+		}
+		if ! found {
+			return false
+		}
+	}
+	if output != "" {
+		if _, out, _, _, _, _, _, _ := mirror.Get_values(); out == nil || *out != output {
+			return false
+		}
+	}
+	switch state {
+		case "active":
+			return mirror.Is_active()
+
+		case "pending":
+			return mirror.Is_pending()
+	}
+
+	return true
+}
+
 func mirror_handler( out http.ResponseWriter, in *http.Request ) {
 	code := http.StatusOK	// response code to return
 	msg  := ""				// data to go in response (assumed to be JSON, if code = StatusOK or StatusCreated)
 	userid := "-"
 	projid := ""
+	admin := false						// token has an admin role (GET may list other projects)
 
 	authorised := false 				// all mirror commands must have an authentication token
 	if accept_requests  {
@@ -807,6 +1196,9 @@ func mirror_handler( out http.ResponseWriter, in *http.Request ) {
 				userid = parts[0]
 				projid = parts[1]
 				authorised = true
+				if in.Method == "GET" && in.URL.Query().Get("project") != "" {
+					admin = token_has_osroles( &auth, *admin_roles )
+				}
 			} else {
 				code = http.StatusUnauthorized
 				msg = "A valid token with a tegu_admin role is required to execute group commands"
@@ -826,17 +1218,17 @@ func mirror_handler( out http.ResponseWriter, in *http.Request ) {
 		} else {
 			http_sheep.Baa( 1, "Request from %s: %s %s", in.RemoteAddr, in.Method, in.RequestURI )
 			switch in.Method {
-				case "PUT":
-					code, msg = mirror_put( out )
+				case "PUT", "PATCH":
+					code, msg = mirror_put( in, out, projid, data )
 
 				case "POST":
-					code, msg = mirror_post( in, out, projid, data )
+					code, msg = mirror_post( in, out, userid, projid, data )
 
 				case "DELETE":
 					code, msg = mirror_delete( in, out, projid )
 
 				case "GET":
-					code, msg = mirror_get( in, out, projid )
+					code, msg = mirror_get( in, out, projid, admin )
 
 				default:
 					http_sheep.Baa( 1, "mirror_handler called for unrecognised method: %s", in.Method )
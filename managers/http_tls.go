@@ -0,0 +1,428 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	http_tls
+	Abstract:	TLS support for the http api (and anything else that needs a server or client
+				side TLS configuration). A tls_store holds the current certificate/key pair and
+				the pool of CAs used to verify peer certificates.  The files are checked now and
+				then and reloaded when they change so that certificates can be rotated without
+				restarting tegu.
+
+				Client certificate subjects (common name or any DNS/email SAN) can be mapped to
+				openstack style role names which are then used by validate_auth() in the same way
+				that roles listed on a token are used.
+
+				Certificates generated by tegu (create_cert) are created here rather than with
+				the gopkgs security package so that modern key sizes and curves can be used.
+
+	Date:		18 Oct 2026
+*/
+
+package managers
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/att/gopkgs/bleater"
+)
+
+const (
+	CERT_AUTH_PFX	string = "cert:"		// prefix added to role list when auth data comes from a client certificate
+
+	DEF_KEY_TYPE	string = "p256"			// default key type used when generating a certificate
+)
+
+/*
+	Manages the certificate, key and CA pool for a TLS endpoint.
+*/
+type tls_store struct {
+	mu			sync.RWMutex
+	cert_fname	string
+	key_fname	string
+	ca_fnames	[]string				// one or more CA bundles used to verify peers
+	cert		*tls.Certificate		// current certificate
+	ca_pool		*x509.CertPool			// current CA pool; nil if no CAs were given
+	mtimes		map[string]time.Time	// modification times of the files when last loaded
+	sheep		*bleater.Bleater		// where reload messages are written (the owner's bleater)
+}
+
+// ---- private -------------------------------------------------------------------------------------
+
+/*
+	Generate a private key of the indicated type. Type is one of rsa2048, rsa3072, rsa4096,
+	p256, p384 or p521.
+*/
+func mk_key( ktype string ) ( key crypto.Signer, err error ) {
+	switch strings.ToLower( ktype ) {
+		case "rsa2048":
+			return rsa.GenerateKey( rand.Reader, 2048 )
+
+		case "rsa3072":
+			return rsa.GenerateKey( rand.Reader, 3072 )
+
+		case "rsa4096":
+			return rsa.GenerateKey( rand.Reader, 4096 )
+
+		case "p256", "":
+			return ecdsa.GenerateKey( elliptic.P256(), rand.Reader )
+
+		case "p384":
+			return ecdsa.GenerateKey( elliptic.P384(), rand.Reader )
+
+		case "p521":
+			return ecdsa.GenerateKey( elliptic.P521(), rand.Reader )
+	}
+
+	return nil, fmt.Errorf( "unsupported key type: %s (expected rsa2048, rsa3072, rsa4096, p256, p384 or p521)", ktype )
+}
+
+/*
+	Create a self signed certificate and private key and write them to the named files. If
+	the same file name is given for both, the key is appended to the certificate.
+*/
+func mk_cert( ktype string, name string, dns_list []string, cert_fname string, key_fname string ) ( err error ) {
+	key, err := mk_key( ktype )
+	if err != nil {
+		return
+	}
+
+	serial, err := rand.Int( rand.Reader, new( big.Int ).Lsh( big.NewInt( 1 ), 128 ) )
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate {
+		SerialNumber:	serial,
+		Subject:		pkix.Name{ CommonName: name, Organization: []string{ "tegu" } },
+		NotBefore:		now.Add( -1 * time.Hour ),
+		NotAfter:		now.Add( 365 * 24 * time.Hour ),
+		KeyUsage:		x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:	[]x509.ExtKeyUsage{ x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth },
+		DNSNames:		dns_list,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate( rand.Reader, tmpl, tmpl, key.Public(), key )
+	if err != nil {
+		return
+	}
+
+	kder, err := x509.MarshalPKCS8PrivateKey( key )
+	if err != nil {
+		return
+	}
+
+	cpem := pem.EncodeToMemory( &pem.Block{ Type: "CERTIFICATE", Bytes: der } )
+	kpem := pem.EncodeToMemory( &pem.Block{ Type: "PRIVATE KEY", Bytes: kder } )
+
+	if cert_fname == key_fname {
+		return ioutil.WriteFile( cert_fname, append( cpem, kpem... ), 0600 )
+	}
+
+	err = ioutil.WriteFile( cert_fname, cpem, 0644 )
+	if err == nil {
+		err = ioutil.WriteFile( key_fname, kpem, 0600 )
+	}
+	return
+}
+
+/*
+	Returns true if any of the files has a modification time different than what was
+	recorded at the last load.
+*/
+func (ts *tls_store) changed( ) ( bool ) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	for _, fn := range append( []string{ ts.cert_fname, ts.key_fname }, ts.ca_fnames... ) {
+		if fn == "" {
+			continue
+		}
+		if fi, err := os.Stat( fn ); err == nil {
+			if ! fi.ModTime().Equal( ts.mtimes[fn] ) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+/*
+	Loop forever checking the files every delay seconds and reloading when something changed.
+	A failed reload leaves the previous certificate in place.
+*/
+func (ts *tls_store) watch( delay int ) {
+	if delay < 5 {
+		delay = 5
+	}
+
+	for {
+		time.Sleep( time.Duration( delay ) * time.Second )
+		if ts.changed( ) {
+			if err := ts.load( ); err != nil {
+				ts.sheep.Baa( 0, "WRN: certificate reload failed, continuing with previous certificate: %s  [TGUHTP005]", err )
+			} else {
+				ts.sheep.Baa( 1, "certificate/CA files changed and were reloaded: %s", ts.cert_fname )
+			}
+		}
+	}
+}
+
+// ---- public --------------------------------------------------------------------------------------
+
+/*
+	Create a store. Ca_list is a comma (or space) separated list of CA bundle files which
+	may be empty. The files are loaded and an error returned if they could not be.
+*/
+func mk_tls_store( cert_fname string, key_fname string, ca_list string ) ( ts *tls_store, err error ) {
+	ts = &tls_store {
+		cert_fname:	cert_fname,
+		key_fname:	key_fname,
+		mtimes:		make( map[string]time.Time ),
+		sheep:		http_sheep,
+	}
+
+	for _, f := range strings.FieldsFunc( ca_list, func( r rune ) bool { return r == ',' || r == ' ' } ) {
+		ts.ca_fnames = append( ts.ca_fnames, f )
+	}
+
+	err = ts.load( )
+	return
+}
+
+/*
+	(Re)load the certificate, key and CA bundles. The new values replace the current
+	ones only if everything loads successfully.
+*/
+func (ts *tls_store) load( ) ( err error ) {
+	var (
+		cert	*tls.Certificate
+		pool	*x509.CertPool
+	)
+
+	mtimes := make( map[string]time.Time )
+
+	if ts.cert_fname != "" {
+		c, err := tls.LoadX509KeyPair( ts.cert_fname, ts.key_fname )
+		if err != nil {
+			return fmt.Errorf( "unable to load certificate/key %s %s: %s", ts.cert_fname, ts.key_fname, err )
+		}
+		cert = &c
+
+		for _, fn := range []string{ ts.cert_fname, ts.key_fname } {
+			if fi, err := os.Stat( fn ); err == nil {
+				mtimes[fn] = fi.ModTime()
+			}
+		}
+	}
+
+	if len( ts.ca_fnames ) > 0 {
+		pool = x509.NewCertPool()
+		for _, fn := range ts.ca_fnames {
+			pem, err := ioutil.ReadFile( fn )
+			if err != nil {
+				return fmt.Errorf( "unable to read CA bundle %s: %s", fn, err )
+			}
+			if ! pool.AppendCertsFromPEM( pem ) {
+				return fmt.Errorf( "no certificates found in CA bundle: %s", fn )
+			}
+			if fi, err := os.Stat( fn ); err == nil {
+				mtimes[fn] = fi.ModTime()
+			}
+		}
+	}
+
+	ts.mu.Lock()
+	ts.cert = cert
+	ts.ca_pool = pool
+	ts.mtimes = mtimes
+	ts.mu.Unlock()
+
+	return nil
+}
+
+/*
+	Return the current certificate; suitable for use as tls.Config.GetCertificate and
+	GetClientCertificate (via a small wrapper).
+*/
+func (ts *tls_store) Get_cert( ) ( *tls.Certificate ) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.cert
+}
+
+/*
+	Return the current CA pool (nil if none were configured).
+*/
+func (ts *tls_store) Get_ca_pool( ) ( *x509.CertPool ) {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+	return ts.ca_pool
+}
+
+/*
+	Build a server configuration. Client_auth is one of none, request (verify if given)
+	or require; anything other than none requires that a CA bundle was supplied. The
+	configuration always references the current certificate and CA pool so that reloads
+	take effect on the next handshake.
+*/
+func (ts *tls_store) Server_config( client_auth string ) ( cfg *tls.Config, err error ) {
+	cfg = &tls.Config {
+		MinVersion:	tls.VersionTLS12,
+	}
+
+	switch client_auth {
+		case "", "none":
+			cfg.ClientAuth = tls.NoClientCert
+
+		case "request", "verify":
+			cfg.ClientAuth = tls.VerifyClientCertIfGiven
+
+		case "require":
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+
+		default:
+			return nil, fmt.Errorf( "invalid client auth setting: %s (expected none, request or require)", client_auth )
+	}
+
+	if cfg.ClientAuth != tls.NoClientCert && ts.Get_ca_pool() == nil {
+		return nil, fmt.Errorf( "client certificate verification requires a client CA bundle" )
+	}
+
+	cfg.GetCertificate = func( *tls.ClientHelloInfo ) ( *tls.Certificate, error ) {
+		return ts.Get_cert(), nil
+	}
+
+	base := cfg
+	cfg.GetConfigForClient = func( *tls.ClientHelloInfo ) ( *tls.Config, error ) {	// pick up the current CA pool on each connection
+		c := base.Clone()
+		c.GetConfigForClient = nil
+		c.ClientCAs = ts.Get_ca_pool()
+		return c, nil
+	}
+
+	return cfg, nil
+}
+
+/*
+	Build a client configuration which presents our certificate and verifies the server
+	using the CA pool (system roots if no CAs were given).  Server_name is used for
+	verification and may be empty if the address used to connect is the name in the
+	certificate.
+*/
+func (ts *tls_store) Client_config( server_name string ) ( *tls.Config ) {
+	return &tls.Config {
+		MinVersion:	tls.VersionTLS12,
+		ServerName:	server_name,
+		RootCAs:	ts.Get_ca_pool(),
+		GetClientCertificate: func( *tls.CertificateRequestInfo ) ( *tls.Certificate, error ) {
+			if c := ts.Get_cert(); c != nil {
+				return c, nil
+			}
+			return &tls.Certificate{}, nil
+		},
+	}
+}
+
+/*
+	Parse the cert_roles configuration value which is a space separated list of
+	name:role[,role...] pairs. The name is matched against the common name and the
+	DNS/email subject alternate names of a verified client certificate.
+*/
+func parse_cert_roles( cfg string ) ( map[string]string ) {
+	m := make( map[string]string )
+	for _, pair := range strings.Fields( cfg ) {
+		toks := strings.SplitN( pair, ":", 2 )
+		if len( toks ) == 2 && toks[0] != "" && toks[1] != "" {
+			m[toks[0]] = toks[1]
+		} else {
+			http_sheep.Baa( 0, "WRN: ignored bad cert_roles entry, expected name:role[,role]: %s  [TGUHTP006]", pair )
+		}
+	}
+
+	return m
+}
+
+/*
+	Given the request, return the list of roles (comma separated) mapped to the subject of
+	the verified client certificate. An empty string is returned if there is no verified
+	certificate or no roles are mapped.
+*/
+func cert2roles( in *http.Request, role_map map[string]string ) ( string ) {
+	if in == nil || in.TLS == nil || len( in.TLS.VerifiedChains ) == 0 || len( role_map ) == 0 {
+		return ""
+	}
+
+	leaf := in.TLS.VerifiedChains[0][0]
+	names := append( []string{ leaf.Subject.CommonName }, leaf.DNSNames... )
+	names = append( names, leaf.EmailAddresses... )
+
+	roles := ""
+	sep := ""
+	for _, n := range names {
+		if r, ok := role_map[n]; ok {
+			roles += sep + r
+			sep = ","
+		}
+	}
+
+	if roles != "" {
+		http_sheep.Baa( 2, "client certificate %s mapped to roles: %s", leaf.Subject.CommonName, roles )
+	}
+	return roles
+}
+
+/*
+	Returns true if any role in the comma separated have list is in the comma separated
+	want list.
+*/
+func roles_intersect( have string, want string ) ( bool ) {
+	for _, h := range strings.Split( have, "," ) {
+		h = strings.TrimSpace( h )
+		if h == "" {
+			continue
+		}
+		for _, w := range strings.Split( want, "," ) {
+			if h == strings.TrimSpace( w ) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
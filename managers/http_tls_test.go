@@ -0,0 +1,232 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	http_tls_test
+	Abstract:	Tests for the TLS store: certificate generation, loading and reload
+				detection, server/client configurations and the mapping of client
+				certificate names to roles.
+	Date:		19 Oct 2026
+*/
+
+package managers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/att/gopkgs/bleater"
+)
+
+/*
+	Create a certificate/key pair in a scratch directory and return the file names.
+*/
+func tls_files( t *testing.T, ktype string ) ( dir string, cert string, key string ) {
+	if http_sheep == nil {
+		http_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	}
+
+	dir, err := ioutil.TempDir( "", "tegu_tls" )
+	if err != nil {
+		t.Fatalf( "unable to create scratch directory: %s", err )
+	}
+
+	cert = path.Join( dir, "cert.pem" )
+	key = path.Join( dir, "key.pem" )
+	if err = mk_cert( ktype, "tegu-test", []string{ "tegu-test" }, cert, key ); err != nil {
+		os.RemoveAll( dir )
+		t.Fatalf( "unable to create %s certificate: %s", ktype, err )
+	}
+
+	return dir, cert, key
+}
+
+func Test_mk_key( t *testing.T ) {
+	fmt.Fprintf( os.Stderr, "\n------- key generation -----------------\n" )
+	for _, kt := range []string{ "rsa2048", "p256", "P384", "p521", "" } {
+		if k, err := mk_key( kt ); err != nil || k == nil {
+			fmt.Fprintf( os.Stderr, "FAIL: key type %q was not generated: %v\n", kt, err )
+			t.Fail()
+		}
+	}
+
+	if _, err := mk_key( "dsa1024" ); err == nil {
+		fmt.Fprintf( os.Stderr, "FAIL: unsupported key type did not return an error\n" )
+		t.Fail()
+	}
+}
+
+func Test_tls_store( t *testing.T ) {
+	fmt.Fprintf( os.Stderr, "\n------- tls store load and reload ------\n" )
+	dir, cert, key := tls_files( t, "p256" )
+	defer os.RemoveAll( dir )
+
+	ts, err := mk_tls_store( cert, key, cert )					// self signed, so it is its own CA
+	if err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: store did not load: %s\n", err )
+		t.FailNow()
+	}
+	if ts.Get_cert() == nil || ts.Get_ca_pool() == nil {
+		fmt.Fprintf( os.Stderr, "FAIL: store loaded without a certificate or CA pool\n" )
+		t.Fail()
+	}
+
+	if ts.changed() {
+		fmt.Fprintf( os.Stderr, "FAIL: store reports a change immediately after loading\n" )
+		t.Fail()
+	}
+	later := time.Now().Add( time.Minute )
+	os.Chtimes( cert, later, later )
+	if ! ts.changed() {
+		fmt.Fprintf( os.Stderr, "FAIL: store did not notice the certificate was touched\n" )
+		t.Fail()
+	}
+	if err = ts.load(); err != nil || ts.changed() {
+		fmt.Fprintf( os.Stderr, "FAIL: reload failed or store still reports a change: %v\n", err )
+		t.Fail()
+	}
+
+	old := ts.Get_cert()
+	ioutil.WriteFile( key, []byte( "not a key" ), 0600 )
+	if err = ts.load(); err == nil {
+		fmt.Fprintf( os.Stderr, "FAIL: load of a bad key did not fail\n" )
+		t.Fail()
+	}
+	if ts.Get_cert() != old {
+		fmt.Fprintf( os.Stderr, "FAIL: failed reload replaced the previous certificate\n" )
+		t.Fail()
+	}
+
+	if _, err = mk_tls_store( cert, key, path.Join( dir, "missing.pem" ) ); err == nil {
+		fmt.Fprintf( os.Stderr, "FAIL: store with a missing CA bundle did not fail\n" )
+		t.Fail()
+	}
+}
+
+func Test_tls_configs( t *testing.T ) {
+	fmt.Fprintf( os.Stderr, "\n------- tls server/client configs ------\n" )
+	dir, cert, key := tls_files( t, "p256" )
+	defer os.RemoveAll( dir )
+
+	noca, err := mk_tls_store( cert, key, "" )
+	if err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: store without CA did not load: %s\n", err )
+		t.FailNow()
+	}
+	if _, err = noca.Server_config( "none" ); err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: client_auth none rejected without a CA: %s\n", err )
+		t.Fail()
+	}
+	for _, ca := range []string{ "request", "require" } {
+		if _, err = noca.Server_config( ca ); err == nil {
+			fmt.Fprintf( os.Stderr, "FAIL: client_auth %s accepted without a CA bundle\n", ca )
+			t.Fail()
+		}
+	}
+
+	ts, _ := mk_tls_store( cert, key, cert )
+	if _, err = ts.Server_config( "sometimes" ); err == nil {
+		fmt.Fprintf( os.Stderr, "FAIL: invalid client_auth value accepted\n" )
+		t.Fail()
+	}
+
+	scfg, err := ts.Server_config( "require" )
+	if err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: server config with CA was not built: %s\n", err )
+		t.FailNow()
+	}
+	if scfg.MinVersion < tls.VersionTLS12 {
+		fmt.Fprintf( os.Stderr, "FAIL: server config allows versions before TLS 1.2\n" )
+		t.Fail()
+	}
+
+	sc, cc := net.Pipe()
+	srv := tls.Server( sc, scfg )
+	cli := tls.Client( cc, ts.Client_config( "tegu-test" ) )
+	done := make( chan error, 1 )
+	go func() {
+		done <- srv.Handshake()
+	}()
+	if err = cli.Handshake(); err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: client handshake failed: %s\n", err )
+		t.Fail()
+	}
+	if err = <- done; err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: server handshake failed: %s\n", err )
+		t.Fail()
+	} else {
+		if st := srv.ConnectionState(); len( st.VerifiedChains ) == 0 {
+			fmt.Fprintf( os.Stderr, "FAIL: client certificate was not verified by the server\n" )
+			t.Fail()
+		}
+	}
+	cc.Close()										// close the pipe; a tls close would wait on the peer to read the alert
+	sc.Close()
+}
+
+func Test_cert_roles( t *testing.T ) {
+	fmt.Fprintf( os.Stderr, "\n------- certificate role mapping -------\n" )
+	if http_sheep == nil {
+		http_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	}
+
+	rmap := parse_cert_roles( "ops.example.com:tegu_admin,admin  agent-1:tegu_sysproc  bogus  :none" )
+	if len( rmap ) != 2 || rmap["ops.example.com"] != "tegu_admin,admin" || rmap["agent-1"] != "tegu_sysproc" {
+		fmt.Fprintf( os.Stderr, "FAIL: cert_roles parsed badly: %v\n", rmap )
+		t.Fail()
+	}
+
+	leaf := &x509.Certificate {
+		Subject:	pkix.Name{ CommonName: "ops.example.com" },
+		DNSNames:	[]string{ "agent-1", "other" },
+	}
+	req := &http.Request{ TLS: &tls.ConnectionState{ VerifiedChains: [][]*x509.Certificate{ { leaf } } } }
+	if r := cert2roles( req, rmap ); r != "tegu_admin,admin,tegu_sysproc" {
+		fmt.Fprintf( os.Stderr, "FAIL: verified certificate mapped to wrong roles: %q\n", r )
+		t.Fail()
+	}
+
+	req.TLS.VerifiedChains = nil												// presented but not verified
+	if r := cert2roles( req, rmap ); r != "" {
+		fmt.Fprintf( os.Stderr, "FAIL: unverified certificate mapped to roles: %q\n", r )
+		t.Fail()
+	}
+	if r := cert2roles( &http.Request{}, rmap ); r != "" {
+		fmt.Fprintf( os.Stderr, "FAIL: plain request mapped to roles: %q\n", r )
+		t.Fail()
+	}
+
+	if ! roles_intersect( "member, tegu_admin", "admin,tegu_admin" ) {
+		fmt.Fprintf( os.Stderr, "FAIL: common role not found\n" )
+		t.Fail()
+	}
+	if roles_intersect( "member,", "admin,tegu_admin" ) || roles_intersect( "", "" ) {
+		fmt.Fprintf( os.Stderr, "FAIL: role lists without a common role intersect\n" )
+		t.Fail()
+	}
+}
@@ -93,6 +93,23 @@
 				12 Apr 2016 - Additional error checking in PHOST processing to prevent stack dump.
 				20 May 2016 - Added discount support to one-way reservations.
 				20 Apr 2017 - Correct possible nil pointer reference.
+				19 Oct 2026 - Oneway gate building moved to bwow_gate; has-capacity accepts oneway pledges.
+				19 Oct 2026 - Bandwidth reservations set queue headroom (ceiling less guarantee) and burst on paths.
+				19 Oct 2026 - Added split_paths config; reservations may be split across paths.
+				19 Oct 2026 - Link attributes from the static topology; path constraints passed to path finding
+					and the reason reported when they cannot be met.
+				19 Oct 2026 - Build from the rich static topology file (per-link capacity/headroom, switch
+					metadata, static hosts); rebuild when the file changes. Link capacity follows the source.
+				19 Oct 2026 - Links discovered by LLDP (agent) are merged with the static topology; discrepancies
+					are listed with the graph. Neighbours of hosts which stop reporting are aged out.
+				19 Oct 2026 - Links lost when the graph is rebuilt are sent to res_mgr; bandwidth pledges using
+					them are re-pathed (REQ_REPATH, all pledges in one request). Reserve and release moved to
+					bw_reserve/bw_release.
+				19 Oct 2026 - Added maintenance windows (drains) which remove link capacity for a period (REQ_DRAIN,
+					REQ_UNDRAIN); re-path may be asked to avoid drained links.
+				19 Oct 2026 - Graph may be exported as DOT, GraphML or D3 json with link utilisation (REQ_NETGRAPH).
+				19 Oct 2026 - Mirror bandwidth is reserved toward the output (REQ_MIRROR_RESERVE) and released on delete.
+				19 Oct 2026 - Hosts which can install split groups are tracked from agent capabilities (REQ_QPCAPS).
 */
 
 package managers
@@ -100,7 +117,9 @@ package managers
 import (
 	"fmt"
 	"math/rand"
+	"net"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
@@ -138,6 +157,26 @@ type Network struct {
 	mlags		map[string]*gizmos.Mlag		// reference to each mlag link group by name
 	hupdate		bool						// set to true only if hosts is updated after gwmap has size (chkpt reload timing)
 	relaxed		bool						// if true, we're in relaxed mode which means we don't path find or do admission control.
+	split_max	int							// max paths a reservation may be split across when no single path has room (<2 == off)
+	split_hosts	map[string]bool				// hosts whose agents reported that split groups can be installed
+	lldp		map[string][]*gizmos.Lldp_neighbour	// neighbours discovered by LLDP, by reporting host
+	lldp_ts		map[string]int64			// time each host last reported its neighbours
+	lldp_age	int64						// seconds after which a host's neighbours are dropped if it has not reported
+	discrep		[]string					// differences between the static topology and what LLDP discovered
+	live		map[string]bool				// ids of the links in this graph which are not excluded
+	drains		map[string]*net_drain		// maintenance windows by id
+}
+
+/*
+	One pledge of a request (REQ_REPATH) to move pledges off of links which are lost or
+	drained. Network fills in paths, or err when the pledge could not be moved; both are nil
+	when the pledge's paths are live and avoid nothing.
+*/
+type repath_req struct {
+	p			*gizmos.Pledge_bw
+	avoid		map[string]bool						// ids of links the new paths must not use (drained links)
+	paths		[]*gizmos.Path						// new paths
+	err			error
 }
 
 
@@ -174,6 +213,16 @@ func (n *Network) Is_relaxed( ) ( bool ) {
 	return n.relaxed
 }
 
+/*
+	Set the maximum number of paths that a reservation may be split across. Values less than
+	2 disable splitting.
+*/
+func (n *Network) Set_split( max int ) {
+	if n != nil {
+		n.split_max = max
+	}
+}
+
 /*
 	Using the various vm2 and ip2 maps, build the host array as though it came from floodlight.
 */
@@ -672,8 +721,10 @@ func build( old_net *Network, flhost *string, max_capacity int64, link_headroom
 		links	[]gizmos.FL_link_json			// list of links from floodlight or simulated floodlight source
 		hlist	[]gizmos.FL_host_json			// list of hosts from floodlight or built from vm maps if not using fl
 		err		error
+		discrep	[]string					// static topology vs lldp discrepancies
 		hr_factor	int64 = 1
 		mlag_name	*string = nil
+		topo	*gizmos.Topology = nil		// rich static topology when the file is one
 	)
 
 	n = nil
@@ -689,14 +740,31 @@ func build( old_net *Network, flhost *string, max_capacity int64, link_headroom
 		hlist = gizmos.FL_hosts( flhost )					// get a current host list from floodlight
 	} else {
 		hlist = old_net.build_hlist()						// simulate output from floodlight by building the host list from openstack maps
-		links, err = gizmos.Read_json_links( *flhost )		// build links from the topo file; if empty/missing, we'll generate a dummy next
-		if err != nil || len( links ) <= 0 {
-			if host_list != nil {
-				net_sheep.Baa_some( "star", 500, 1, "generating a dummy star topology: json file empty, or non-existent: %s", *flhost )
-				links = gizmos.Gen_star_topo( *host_list )				// generate a dummy topo based on the host list
+		if gizmos.Is_topology( *flhost ) {
+			topo, err = gizmos.Read_topology( *flhost )		// validated; an invalid file is never partially applied
+			if err != nil {
+				net_sheep.Baa( 0, "ERR: unable to use static topology: %s  [TGUNET012]", err )
+				if old_net != nil {
+					return nil								// keep the current graph
+				}
+				links = nil									// first build; empty network
 			} else {
-				net_sheep.Baa( 0, "ERR: unable to read static links from %s: %s  [TGUNET004]", *flhost, err )
-				links = nil										// kicks us out later, but must at least create an empty network first
+				links = topo.Fl_links()
+				hlist = append( hlist, topo.Fl_hosts()... )		// statically attached hosts
+				links, discrep = old_net.merge_lldp( links )
+			}
+		} else {
+			links, err = gizmos.Read_json_links( *flhost )		// build links from the topo file; if empty/missing, we'll generate a dummy next
+			if err == nil && len( links ) > 0 {
+				links, discrep = old_net.merge_lldp( links )
+			} else {
+				if host_list != nil {										// discovered links have no switch to switch links; only merged into a real topology
+					net_sheep.Baa_some( "star", 500, 1, "generating a dummy star topology: json file empty, or non-existent: %s", *flhost )
+					links = gizmos.Gen_star_topo( *host_list )				// generate a dummy topo based on the host list
+				} else {
+					net_sheep.Baa( 0, "ERR: unable to read static links from %s: %s  [TGUNET004]", *flhost, err )
+					links = nil										// kicks us out later, but must at least create an empty network first
+				}
 			}
 		}
 	}
@@ -709,6 +777,25 @@ func build( old_net *Network, flhost *string, max_capacity int64, link_headroom
 		n.vlinks = old_net.vlinks
 		n.mlags = old_net.mlags
 		n.relaxed = old_net.relaxed
+		n.split_max = old_net.split_max
+		n.split_hosts = old_net.split_hosts
+		n.lldp = old_net.lldp
+		n.lldp_ts = old_net.lldp_ts
+		n.lldp_age = old_net.lldp_age
+		n.drains = old_net.drains
+	}
+
+	n.discrep = discrep
+	for _, d := range discrep {
+		known := false
+		if old_net != nil {
+			for _, od := range old_net.discrep {
+				known = known || od == d
+			}
+		}
+		if ! known {
+			net_sheep.Baa( 1, "WRN: topology discrepancy: %s  [TGUNET015]", d )		// log only when first seen
+		}
 	}
 
 	if links == nil {
@@ -719,10 +806,15 @@ func build( old_net *Network, flhost *string, max_capacity int64, link_headroom
 	}
 
 	if ! skip_lupdate {										// if we must update the links -- expensive
+		n.live = make( map[string]bool, len( links ) * 2 )
 		for i := range links {								// parse all links returned from the controller (build our graph of switches and links)
 			if links[i].Capacity <= 0 {
 				links[i].Capacity = max_capacity			// default if it didn't come from the source
 			}
+			lcap := (links[i].Capacity * hr_factor)/100
+			if links[i].Headroom != nil {					// per-link headroom from the topology file
+				lcap = (links[i].Capacity * int64( 100 - *links[i].Headroom ))/100
+			}
 
 			tokens := strings.SplitN( links[i].Src_switch, "@", 2 )	// if the 'id' is host@interface we need to drop interface so all are added to same switch
 			sswid := tokens[0]
@@ -742,12 +834,17 @@ func build( old_net *Network, flhost *string, max_capacity int64, link_headroom
 			}
 
 			// omitting the link (last parm) causes reuse of the link if it existed so that obligations are kept; links _are_ created with the interface name
-			lnk = old_net.find_link( links[i].Src_switch, links[i].Dst_switch, (links[i].Capacity * hr_factor)/100, link_alarm_thresh, links[i].Mlag )
+			lnk = old_net.find_link( links[i].Src_switch, links[i].Dst_switch, lcap, link_alarm_thresh, links[i].Mlag )
+			if lnk.Get_allotment().Get_max_capacity() != lcap {		// existing link (obligations kept) but the capacity changed
+				lnk.Mod_capacity( lcap )
+			}
 			lnk.Set_forward( dsw )
 			lnk.Set_backward( ssw )
 			lnk.Set_port( 1, links[i].Src_port )		// port on src to dest
 			lnk.Set_port( 2, links[i].Dst_port )		// port on dest to src
+			lnk.Set_attrs( links[i].Cost, links[i].Latency, links[i].Srlg, links[i].Excluded )
 			ssw.Add_link( lnk )
+			n.live[*lnk.Get_id()] = ! links[i].Excluded
 
 			if links[i].Direction == "bidirectional" { 			// add the backpath link
 				mlag_name = nil
@@ -755,18 +852,36 @@ func build( old_net *Network, flhost *string, max_capacity int64, link_headroom
 					mln := *links[i].Mlag + ".REV"				// differentiate the reverse links so we can adjust them with amount_in more easily
 					mlag_name = &mln
 				}
-				lnk = old_net.find_link( links[i].Dst_switch, links[i].Src_switch, (links[i].Capacity * hr_factor)/100, link_alarm_thresh, mlag_name )
+				lnk = old_net.find_link( links[i].Dst_switch, links[i].Src_switch, lcap, link_alarm_thresh, mlag_name )
+				if lnk.Get_allotment().Get_max_capacity() != lcap {
+					lnk.Mod_capacity( lcap )
+				}
 				lnk.Set_forward( ssw )
 				lnk.Set_backward( dsw )
 				lnk.Set_port( 1, links[i].Dst_port )		// port on dest to src
 				lnk.Set_port( 2, links[i].Src_port )		// port on src to dest
+				lnk.Set_attrs( links[i].Cost, links[i].Latency, links[i].Srlg, links[i].Excluded )
 				dsw.Add_link( lnk )
+				n.live[*lnk.Get_id()] = ! links[i].Excluded
 				net_sheep.Baa( 3, "build: addlink: src [%d] %s %s", i, links[i].Src_switch, n.switches[sswid].To_json() )
 				net_sheep.Baa( 3, "build: addlink: dst [%d] %s %s", i, links[i].Dst_switch, n.switches[dswid].To_json() )
 			}
 		}
+
+		if topo != nil {									// switch metadata; switches without links are still known
+			for i := range topo.Switches {
+				swid := topo.Switches[i].Id
+				sw := n.switches[swid]
+				if sw == nil {
+					sw = gizmos.Mk_switch( &swid )
+					n.switches[swid] = sw
+				}
+				sw.Set_meta( topo.Switches[i].Site, topo.Switches[i].Attrs )
+			}
+		}
 	} else {
 		n.switches = old_net.switches			// if not updating, we must copy over the old switch list rather than rebuilding it
+		n.live = old_net.live
 	}
 
 	if len( old_net.gwmap ) > 0 {			// if we build after gateway map has size, then gateways are in host table and checkpoints can be processed
@@ -831,6 +946,17 @@ func build( old_net *Network, flhost *string, max_capacity int64, link_headroom
 	return
 }
 
+/*
+	Returns the modification time of the file (unix nanoseconds); 0 if it cannot be stat'd.
+*/
+func file_mtime( fname string ) ( int64 ) {
+	fi, err := os.Stat( fname )
+	if err != nil {
+		return 0
+	}
+	return fi.ModTime().UnixNano()
+}
+
 /*
 	DEPRECATED
 	Given a project id, find the associated gateway.  Returns the whole project/ip string.
@@ -995,11 +1121,84 @@ func (n *Network) to_json( ) ( jstr string ) {
 		sep = ","
 	}
 
-	jstr += "] }"
+	jstr += "]"
 
+	if len( n.discrep ) > 0 {
+		jstr += `, "discrepancies": [ `
+		sep = ""
+		for _, d := range n.discrep {
+			jstr += fmt.Sprintf( "%s%q", sep, d )
+			sep = ", "
+		}
+		jstr += " ]"
+	}
+
+	jstr += " }"
 	return
 }
 
+/*
+	Request for an export of the graph (graph format=...).
+*/
+type graph_req struct {
+	format	string
+	ts		int64						// time the link allocations are taken from
+	hlname	string						// reservation whose links are highlighted (if any)
+	hl		map[string]bool				// ids of the links to highlight
+}
+
+/*
+	Generate the graph in one of the export formats. Every link known to the network is given
+	with the allocation at the requested time; links which are not live (administratively
+	excluded, or gone from the topology but still holding obligations) and links excluded
+	from path finding are marked excluded. Virtual links and the hosts attached to each
+	switch are included.
+*/
+func (n *Network) export( gr *graph_req ) ( string, error ) {
+	g := gizmos.Mk_graph_export( gr.ts )
+
+	for _, sw := range n.switches {
+		swid := *sw.Get_id()
+		g.Add_node( swid, gizmos.GX_SWITCH, sw.Get_site(), nil )
+		for _, h := range sw.Get_hosts() {
+			g.Add_node( h, gizmos.GX_HOST, sw.Get_site(), nil )
+			g.Add_edge( h + "@" + swid, gizmos.GX_ATTACH, h, swid, 0, 0, "", false )
+		}
+	}
+
+	ids := make( []string, 0, len( n.links ) )
+	for id := range n.links {
+		ids = append( ids, id )
+	}
+	sort.Strings( ids )
+	for _, id := range ids {
+		l := n.links[id]
+		sw1, sw2 := l.Get_sw_names()
+		mlag := ""
+		if m := l.Get_mlag(); m != nil {
+			mlag = *m
+		}
+		g.Add_edge( id, gizmos.GX_LINK, strings.SplitN( *sw1, "@", 2 )[0], strings.SplitN( *sw2, "@", 2 )[0], l.Get_allocation( gr.ts ), l.Get_allotment().Get_max_capacity(), mlag, ! n.live[id] || l.Is_excluded() )
+	}
+
+	ids = ids[:0]
+	for id := range n.vlinks {
+		ids = append( ids, id )
+	}
+	sort.Strings( ids )
+	for _, id := range ids {
+		l := n.vlinks[id]
+		sw1, sw2 := l.Get_sw_names()
+		g.Add_edge( id, gizmos.GX_VLINK, strings.SplitN( *sw1, "@", 2 )[0], strings.SplitN( *sw2, "@", 2 )[0], l.Get_allocation( gr.ts ), l.Get_allotment().Get_max_capacity(), "", false )
+	}
+
+	if gr.hl != nil {
+		g.Highlight( gr.hlname, gr.hl )
+	}
+
+	return g.Render( gr.format )
+}
+
 /*
 	Transfer maps from an old network graph to this one
 */
@@ -1021,6 +1220,435 @@ func (net *Network) xfer_maps( old_net *Network ) {
 
 // --------- public -------------------------------------------------------------------------------------------
 
+/*
+	Build the gate for a oneway pledge and verify that the source switch has capacity for it.
+	If add is true the queue is created on the gate (and utilisation increased); when false
+	nothing is allocated (has-capacity/explain). Discount is applied to the bandwidth before
+	the capacity check as is done for reservations.
+*/
+func (n *Network) bwow_gate( p *gizmos.Pledge_bwow, discount int64, add bool ) ( gate *gizmos.Gate, err error ) {
+	var ipd *string
+	var dh  *gizmos.Host
+
+	src, dest := p.Get_hosts( )									// we assume project/host-name
+	if src == nil || dest == nil {
+		net_sheep.Baa( 1, "owreserve: one/both host names were invalid" )
+		return nil, fmt.Errorf( "unable to create oneway reservation in network one or both host names invalid" )
+	}
+
+	net_sheep.Baa( 1,  "network: bwow reservation request received: %s -> %s", *src, *dest )
+
+	usr := "nobody"											// default dummy user if not project/host
+	toks := strings.SplitN( *src, "/", 2 )					// suss out project name
+	if len( toks ) > 1 {
+		usr = toks[0]										// the 'user' for queue setting
+	}
+
+	ips, err := n.name2ip( src )
+	if err == nil {
+		ipd, _ = n.name2ip( dest )				// for an external dest, this can be nil which is not an error
+	}
+	if ips == nil {
+		net_sheep.Baa( 1, "cant map %s to ip", *src )
+		return nil, fmt.Errorf( "unable to create oneway reservation in network cannot map src (%s) to an IP address", *src )
+	}
+
+	sh := n.hosts[*ips]
+	if ipd != nil {
+		dh = n.hosts[*ipd]						// this will be nil for an external IP
+	}
+	ssw, _ := sh.Get_switch_port( 0 )
+	gate = gizmos.Mk_gate( sh, dh, ssw, p.Get_bandwidth(), usr )
+	if (*dest)[0:1] == "!" || dh == nil {			// indicate that dest IP cannot be converted to a MAC address
+		gate.Set_extip( dest )
+	}
+
+	c, e := p.Get_window( )														// commence/expiry times
+	fence := n.get_fence( &usr )
+	max := int64( -1 )
+	if fence != nil {
+		max = fence.Get_limit_max()
+	}
+
+	bw := p.Get_bandwidth()
+	suffix := "bps"							// suffix for bleat
+	if discount > 0 {
+		if discount < 101 {					// reduce by percentage of request
+			bw -=  ((bw * discount)/100)
+			suffix = "%"
+		} else {
+			bw -= discount					// reduce by a hard amount
+		}
+
+		if bw < 10 {						// add some sanity, and keep it from going too low
+			bw = 10
+		}
+
+		net_sheep.Baa( 1, "owbandwidth was reduced by a discount of %d%s: bw=%d", discount, suffix, bw )
+	}
+
+	if ! gate.Has_capacity( c, e, bw, &usr, max ) {						// finally, verify that there is room and let it go if there is
+		var name string
+
+		net_sheep.Baa( 1, "owreserve: switch does not have enough capacity for a oneway reservation of %d (disc=%d)", bw, discount  )
+		namep := gate.Get_sw_name()
+		if namep == nil {
+			name = "unknown (nil)"
+		} else {
+			name = *namep
+		}
+		return nil, fmt.Errorf( "unable to create oneway reservation for %d: no capacity on (v)switch: %s", p.Get_bandwidth(), name )
+	}
+
+	if add {
+		qid := p.Get_id()												// for now, the queue id is just the reservation id, so fetch
+		p.Set_qid( qid ) 												// and add the queue id to the pledge
+
+		if ! gate.Add_queue( c, e, p.Get_bandwidth(), qid, fence ) {		// create queue AND inc utilisation on the link
+			net_sheep.Baa( 1, "owreserve: internal mishap: unable to set queue for gate: %s", gate )
+			return nil, fmt.Errorf( "unable to create oneway reservation: unable to setup queue" )
+		}
+	}
+
+	return gate, nil
+}
+
+/*
+	Find path(s) for a bandwidth pledge and reserve the bandwidth (queues are set and link
+	utilisation increased). Discount is applied to the bandwidth before the paths are found.
+	Returns the list of paths (outbound paths followed by inbound paths) or an error which
+	describes why no path could be found.
+*/
+func (n *Network) bw_reserve( p *gizmos.Pledge_bw, discount int64, find_all_paths bool, mlag_paths bool ) ( path_list []*gizmos.Path, err error ) {
+	var ip2		*string = nil
+
+	h1, h2, _, _, commence, expiry, bandw_in, bandw_out := p.Get_values( )		// ports can be ignored
+	net_sheep.Baa( 1,  "network: bw reservation request received: %s -> %s  from %d to %d", *h1, *h2, commence, expiry )
+
+	suffix := "bps"
+	if discount > 0 {
+		if discount < 101 {
+			bandw_in -=  ((bandw_in * discount)/100)
+			bandw_out -=  ((bandw_out * discount)/100)
+			suffix = "%"
+		} else {
+			bandw_in -= discount
+			bandw_out -= discount
+		}
+
+		if bandw_out < 10 {			// add some sanity, and keep it from going too low
+			bandw_out = 10
+		}
+		if bandw_in < 10 {
+			bandw_in = 10
+		}
+		net_sheep.Baa( 1, "bandwidth was reduced by a discount of %d%s: in=%d out=%d", discount, suffix, bandw_in, bandw_out )
+	}
+
+	ip1, err := n.name2ip( h1 )
+	if err == nil {
+		ip2, err = n.name2ip( h2 )
+	}
+	if err != nil {
+		net_sheep.Baa( 0,  "network: unable to map to an IP address: %s",  err )
+		return nil, fmt.Errorf( "unable to map host name to a known IP address: %s", err )
+	}
+
+	net_sheep.Baa( 2,  "network: attempt to find path between  %s -> %s", *ip1, *ip2 )
+	pc := p.Get_constraints()
+	pcount_out, path_list_out, o_cap_trip, o_cerr := n.build_paths( ip1, ip2, commence, expiry, bandw_out, find_all_paths, false, pc ); 	// outbound path
+	pcount_in, path_list_in, i_cap_trip, i_cerr := n.build_paths( ip2, ip1, commence, expiry, bandw_in, find_all_paths, true, pc ); 		// inbound path
+
+	if pcount_out <= 0  ||  pcount_in <= 0  {
+		if o_cerr != nil || i_cerr != nil {
+			err = constraint_err( o_cerr, i_cerr )
+		} else if i_cap_trip {
+			err = fmt.Errorf( "unable to generate a path: no capacity (h1<-h2)" )		// tedious, but we'll break out direction
+		} else {
+			if o_cap_trip {
+				err = fmt.Errorf( "unable to generate a path: no capacity (h1->h2)" )
+			} else {
+				err = fmt.Errorf( "unable to generate a path:  no path" )
+			}
+		}
+		net_sheep.Baa( 0,  "no paths in list: %s  cap=%v/%v", err, i_cap_trip, o_cap_trip )
+		return nil, err
+	}
+
+	net_sheep.Baa( 1,  "network: %d acceptable path(s) found icap=%v ocap=%v", pcount_out + pcount_in, i_cap_trip, o_cap_trip )
+
+	ceil_in, ceil_out := p.Get_ceiling()							// only the guarantee was reserved; queues may borrow up to the ceiling
+	path_list = make( []*gizmos.Path, pcount_out + pcount_in )		// combine the lists
+	pcount := 0
+	for j := 0; j < pcount_out; j++ {
+		path_list_out[j].Set_limits( ceil_out - p.Get_bandw_out(), p.Get_burst() )
+		path_list[pcount] = path_list_out[j]
+		pcount++
+	}
+	for j := 0; j < pcount_in; j++ {	
+		path_list_in[j].Set_limits( ceil_in - p.Get_bandw_in(), p.Get_burst() )
+		path_list[pcount] = path_list_in[j]
+		pcount++
+	}
+
+	p.Set_shares( path_shares( path_list_in[:pcount_in] ), path_shares( path_list_out[:pcount_out] ) )	// nil unless split across paths
+
+	qid := p.Get_id()											// for now, the queue id is just the reservation id, so fetch
+	p.Set_qid( qid )											// and add the queue id to the pledge
+
+	for i := 0; i < pcount; i++ {								// set the queues for each path in the list (multiple paths if network is disjoint)
+		fence := n.get_fence( path_list[i].Get_usr() )
+		net_sheep.Baa( 2,  "\tpath_list[%d]: %s -> %s  (%s)", i, *h1, *h2, path_list[i].To_str( ) )
+		path_list[i].Set_queue( qid, commence, expiry, path_list[i].Get_bandwidth(), fence )		// create queue AND inc utilisation on the link
+		if mlag_paths {
+			net_sheep.Baa( 1, "increasing usage for mlag members" )
+			path_list[i].Inc_mlag( commence, expiry, path_list[i].Get_bandwidth(), fence, n.mlags )
+		}
+	}
+
+	return path_list, nil
+}
+
+/*
+	Remove the utilisation for the paths of a bandwidth pledge (queues are reduced on each
+	link). If restore is true, the utilisation is added back instead; used when an attempt
+	to re-path the pledge fails and the original paths must be kept.
+*/
+func (n *Network) bw_release( p *gizmos.Pledge_bw, restore bool ) {
+	commence, expiry := p.Get_window( )
+	path_list := p.Get_path_list( )
+
+	qid := p.Get_qid()							// get the queue ID associated with the pledge
+	for i := range path_list {
+		fence := n.get_fence( path_list[i].Get_usr() )
+		bw := -path_list[i].Get_bandwidth()
+		if restore {
+			bw = -bw
+		}
+		net_sheep.Baa( 1,  "network: adjusting path %d associated with usr=%s by %d", i, *fence.Name, bw )
+		path_list[i].Set_queue( qid, commence, expiry, bw, fence )		// reduce (or restore) queues on the path as needed
+	}
+}
+
+/*
+	Find a host (vm) which is on the physical host; the mirrored traffic leaves the physical host
+	from the same switch, so the host is used as the source of the mirror's path or gate.
+	Returns nil if no host on the physical host is known in the graph.
+*/
+func (n *Network) phost2host( phost string ) ( *gizmos.Host, *string ) {
+	vmids := make( []string, 0, len( n.vmid2phost ) )
+	for vmid, ph := range n.vmid2phost {
+		if ph != nil && *ph == phost {
+			vmids = append( vmids, vmid )
+		}
+	}
+	sort.Strings( vmids )									// same choice each time
+
+	for _, vmid := range vmids {
+		if ip := n.vmid2ip[vmid]; ip != nil && n.hosts[*ip] != nil {
+			return n.hosts[*ip], ip
+		}
+	}
+
+	return nil, nil
+}
+
+/*
+	Reserve the bandwidth of a mirror. The mirrored traffic is one way: from the physical host where
+	the ports live to the output. If the output is a host in the graph, a path is found from the physical
+	host to it and the bandwidth allocated on each link (like the outbound side of a bandwidth reservation).
+	If the output is outside of the graph (collector), or a vlan, the bandwidth is allocated on the links
+	leaving the physical host using a gate (like a oneway reservation). A mirror to a local port uses no
+	link capacity; any other mirror without bandwidth is rejected. The path list or gate is set in the pledge.
+*/
+func (n *Network) mirror_reserve( p *gizmos.Pledge_mirror, find_all_paths bool ) ( err error ) {
+	bw := p.Get_bandwidth()
+	_, out, _, _, commence, expiry, _, _ := p.Get_values()
+	phost := p.Get_qid()
+	if n.relaxed {
+		return nil
+	}
+
+	if out == nil || phost == nil {
+		return fmt.Errorf( "unable to reserve mirror bandwidth: output or physical host missing" )
+	}
+	net_sheep.Baa( 1, "network: mirror reservation request received: %s on %s -> %s bw=%d", *p.Get_id(), *phost, *out, bw )
+
+	ip := net.ParseIP( *out )
+	if ip == nil && ! strings.HasPrefix( *out, "vlan:" ) {					// output is a port on the physical host
+		net_sheep.Baa( 2, "mirror %s output is local; no link capacity needed", *p.Get_id() )
+		return nil
+	}
+	if bw <= 0 {
+		return fmt.Errorf( "unable to reserve mirror bandwidth: no bandwidth given for output %s", *out )
+	}
+
+	sh, sip := n.phost2host( *phost )
+	if sh == nil {
+		return fmt.Errorf( "unable to reserve mirror bandwidth: no known host on physical host %s", *phost )
+	}
+
+	usr := "nobody"
+	if t := p.Get_Tenant(); t != nil && *t != "" {
+		usr = *t
+	}
+	fence := n.get_fence( &usr )
+	qid := p.Get_id()
+
+	if ip != nil && n.hosts[*out] != nil {									// output is in the graph; find a path to it
+		pcount, path_list, cap_trip, cerr := n.build_paths( sip, out, commence, expiry, bw, find_all_paths, false, nil )
+		if pcount <= 0 {
+			switch {
+				case cerr != nil:
+					return cerr
+
+				case cap_trip:
+					return fmt.Errorf( "unable to reserve mirror bandwidth: no capacity (%s -> %s)", *phost, *out )
+			}
+			return fmt.Errorf( "unable to reserve mirror bandwidth: no path (%s -> %s)", *phost, *out )
+		}
+
+		for i := 0; i < pcount; i++ {
+			path_list[i].Set_queue( qid, commence, expiry, path_list[i].Get_bandwidth(), n.get_fence( path_list[i].Get_usr() ) )
+		}
+		p.Set_path_list( path_list[:pcount] )
+		net_sheep.Baa( 1, "network: mirror %s: %d path(s) reserved to %s", *qid, pcount, *out )
+		return nil
+	}
+
+	ssw, _ := sh.Get_switch_port( 0 )										// output outside of the graph; gate on the links leaving the physical host
+	gate := gizmos.Mk_gate( sh, nil, ssw, bw, usr )
+	if ip != nil {
+		gate.Set_extip( out )
+	}
+	max := int64( -1 )
+	if fence != nil {
+		max = fence.Get_limit_max()
+	}
+	if ! gate.Has_capacity( commence, expiry, bw, &usr, max ) {
+		return fmt.Errorf( "unable to reserve mirror bandwidth of %d: no capacity leaving physical host %s", bw, *phost )
+	}
+	if ! gate.Add_queue( commence, expiry, bw, qid, fence ) {
+		net_sheep.Baa( 1, "mirror reserve: internal mishap: unable to set queue for gate: %s", gate )
+		return fmt.Errorf( "unable to reserve mirror bandwidth: unable to setup queue" )
+	}
+	p.Set_gate( gate )
+	net_sheep.Baa( 1, "network: mirror %s: %d reserved leaving %s", *qid, bw, *phost )
+
+	return nil
+}
+
+/*
+	Release the bandwidth reserved for a mirror.
+*/
+func (n *Network) mirror_release( p *gizmos.Pledge_mirror ) {
+	commence, expiry := p.Get_window( )
+	qid := p.Get_id()
+
+	for _, pth := range p.Get_path_list() {
+		pth.Set_queue( qid, commence, expiry, -pth.Get_bandwidth(), n.get_fence( pth.Get_usr() ) )
+	}
+	p.Set_path_list( nil )
+
+	if gate := p.Get_gate(); gate != nil {
+		gate.Set_queue( qid, commence, expiry, -gate.Get_bandw(), n.get_fence( gate.Get_usr() ) )
+		p.Set_gate( nil )
+	}
+}
+
+/*
+	Returns true if all links on the path are in the current graph and are not excluded.
+*/
+func (n *Network) path_live( pth *gizmos.Path ) ( bool ) {
+	for _, l := range pth.Get_links() {
+		if l != nil && ! n.live[*l.Get_id()] {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+	Returns the ids of links which were in the old graph but are not in this one (or are now
+	excluded). The list is sorted.
+*/
+func (n *Network) lost_links( old_net *Network ) ( lost []string ) {
+	lost = make( []string, 0 )
+	if old_net == nil {
+		return
+	}
+
+	for id := range old_net.live {
+		if ! n.live[id] {
+			lost = append( lost, id )
+		}
+	}
+	sort.Strings( lost )
+
+	return
+}
+
+/*
+	Called after the graph is replaced; if links were lost reservation manager is sent the
+	list so that reservations using them can be moved to other paths.
+*/
+func (n *Network) note_lost_links( old_net *Network ) {
+	lost := n.lost_links( old_net )
+	if len( lost ) > 0 {
+		net_sheep.Baa( 1, "%d link(s) are no longer in the network graph: %s", len( lost ), strings.Join( lost, " " ) )
+		msg := ipc.Mk_chmsg( )
+		msg.Send_req( rmgr_ch, nil, REQ_TOPOCHG, lost, nil )
+	}
+}
+
+/*
+	Move a bandwidth pledge whose paths use links which are no longer live, or use a link
+	in the avoid map (drained links), to new paths. The existing utilisation is released
+	and new paths, which do not use the avoided links, are found for the pledge's window;
+	if none can be found the original utilisation is restored and an error returned. If
+	all of the pledge's paths are live and avoid nothing, nothing is done and a nil list is
+	returned.
+*/
+func (n *Network) bw_repath( p *gizmos.Pledge_bw, avoid map[string]bool, discount int64, find_all_paths bool, mlag_paths bool ) ( path_list []*gizmos.Path, err error ) {
+	stale := false
+	for _, pth := range p.Get_path_list() {
+		stale = stale || ! n.path_live( pth )
+	}
+	if ! stale && ! p.Uses_links( avoid ) {
+		return nil, nil
+	}
+
+	n.bw_release( p, false )
+	shares_in, shares_out := p.Get_shares()
+	for id := range avoid {
+		n.links[id].Set_excluded( true )			// nil safe
+	}
+	path_list, err = n.bw_reserve( p, discount, find_all_paths, mlag_paths )
+	for id := range avoid {
+		n.links[id].Set_excluded( false )
+	}
+	if err != nil {
+		n.bw_release( p, true )							// keep what it had; flow-mods remain in place
+		p.Set_shares( shares_in, shares_out )
+		return nil, err
+	}
+
+	return path_list, nil
+}
+
+/*
+	Move each pledge of a re-path request (see bw_repath) filling in its new paths or the
+	reason it could not be moved.
+*/
+func (n *Network) bw_repath_list( rl []*repath_req, discount int64, find_all_paths bool, mlag_paths bool ) {
+	for _, rr := range rl {
+		if rr != nil && rr.p != nil {
+			rr.paths, rr.err = n.bw_repath( rr.p, rr.avoid, discount, find_all_paths, mlag_paths )
+		}
+	}
+}
+
 /*
 	to be executed as a go routine.
 	nch is the channel we are expected to listen on for api requests etc.
@@ -1041,8 +1669,12 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 		phost_suffix 	*string = nil
 		discount 		int64 = 0					// bandwidth discount value (pct if between 1 and 100 inclusive; hard value otherwise
 		relaxed			bool = false				// set with relaxed = true in config
+		split_paths		int = 0						// max paths a reservation may be split across (split_paths in config)
+		lldp_refresh	int64 = 0					// seconds between lldp neighbour requests (agent section); sets neighbour age
 		hlist			*string = &empty_str		// host list we'll give to build should we need to build a dummy star topo
 		next_netbuild	int64 = 0					// prevent rebuilds too closely spaced
+		topo_check		int = 30					// seconds between checks of the static topology file for changes
+		topo_mtime		int64 = 0					// modification time of the static topology file when last built
 	)
 
 	if *sdn_host  == "" {
@@ -1120,6 +1752,18 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 			}
 		}
 
+		if p := cfg_data["network"]["topo_check"]; p != nil {
+			topo_check = clike.Atoi( *p )								// 0 disables reloading the static topology on change
+		}
+
+		if p := cfg_data["network"]["split_paths"]; p != nil {
+			split_paths = clike.Atoi( *p )								// more than one allows a reservation to be split across paths
+		}
+
+		if p := cfg_data["agent"]["lldp_refresh"]; p != nil {
+			lldp_refresh = int64( clike.Atoi( *p ) )					// neighbours are aged out after missing a few of these
+		}
+
 		if p := cfg_data["network"]["link_headroom"]; p != nil {
 			link_headroom = clike.Atoi( *p )							// percentage that we should take all link capacities down by
 		}
@@ -1155,11 +1799,20 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 		net_sheep.Baa( 1, "initial network graph has been built" )
 		act_net.limits = limits
 		act_net.Set_relaxed( relaxed )
+		act_net.Set_split( split_paths )
+		if split_paths > 1 {
+			net_sheep.Baa( 1, "reservations may be split across as many as %d paths", split_paths )
+		}
+		act_net.lldp_age = lldp_refresh * LLDP_MAX_MISSED
 	}
 
 	tklr.Add_spot( 2, nch, REQ_CHOSTLIST, nil, 1 ) 		 							// tickle once, very soon after starting, to get a host list
 	tklr.Add_spot( int64( refresh * 2 ), nch, REQ_CHOSTLIST, nil, ipc.FOREVER )  	// get a host list from openstack now and again
 	tklr.Add_spot( int64( refresh ), nch, REQ_NETUPDATE, nil, ipc.FOREVER )			// add tickle spot to drive rebuild of network
+	if strings.Index( *sdn_host, ":" ) < 0 && topo_check > 0 {						// static topology; rebuild soon after it changes
+		topo_mtime = file_mtime( *sdn_host )
+		tklr.Add_spot( int64( topo_check ), nch, REQ_TOPOCHK, nil, ipc.FOREVER )
+	}
 
 	for {
 		select {					// assume we might have multiple channels in future
@@ -1181,13 +1834,14 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 
 						req.Response_data = state
 
-					case REQ_HASCAP:						// verify that there is capacity, and return the path, but don't allocate the path
+					case REQ_HASCAP:						// verify that there is capacity, and return the path (gate for oneway), but don't allocate the path
 						p, ok := req.Req_data.( *gizmos.Pledge_bw )
 						if ok {
 							h1, h2, _, _, commence, expiry, bandw_in, bandw_out := p.Get_values( )
 							net_sheep.Baa( 1,  "has-capacity request received on channel  %s -> %s", h1, h2 )
-							pcount_in, path_list_out, o_cap_trip := act_net.build_paths( h1, h2, commence, expiry,  bandw_out, find_all_paths, false );
-							pcount_out, path_list_in, i_cap_trip := act_net.build_paths( h2, h1, commence, expiry, bandw_in, find_all_paths, true ); 	// reverse path
+							pc := p.Get_constraints()
+							pcount_in, path_list_out, o_cap_trip, o_cerr := act_net.build_paths( h1, h2, commence, expiry,  bandw_out, find_all_paths, false, pc );
+							pcount_out, path_list_in, i_cap_trip, i_cerr := act_net.build_paths( h2, h1, commence, expiry, bandw_in, find_all_paths, true, pc ); 	// reverse path
 
 							if pcount_out > 0  && pcount_in > 0  {
 								path_list := make( []*gizmos.Path, pcount_out + pcount_in )		// combine the lists
@@ -1204,7 +1858,9 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 								req.State = nil
 							} else {
 								req.Response_data = nil
-								if i_cap_trip {
+								if o_cerr != nil || i_cerr != nil {
+									req.State = constraint_err( o_cerr, i_cerr )
+								} else if i_cap_trip {
 									req.State = fmt.Errorf( "unable to generate a path: no capacity (h1<-h2)" )		// tedious, but we'll break out direction
 								} else {
 									if o_cap_trip {
@@ -1214,6 +1870,13 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 									}
 								}
 							}
+						} else if op, ok := req.Req_data.( *gizmos.Pledge_bwow ); ok {			// oneway: gate is built and capacity checked, but no queue is added
+							req.Response_data = nil
+							if gate, err := act_net.bwow_gate( op, discount, false ); err == nil {
+								req.Response_data = gate
+							} else {
+								req.State = err
+							}
 						} else {
 							net_sheep.Baa( 1, "internal mishap: pledge passed to has capacity wasn't a bw pledge: %s", p )
 							req.State = fmt.Errorf( "unable to create reservation in network, internal data corruption." )
@@ -1221,189 +1884,65 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 
 					case REQ_BWOW_RESERVE:								// one way bandwidth reservation, nothing really to vet, return a gate block
 						// host names are expected to have been vetted (if needed) and translated to project-id/IPaddr if IDs are enabled
-						var ipd *string
-						var dh  *gizmos.Host
-
 						req.Response_data = nil
 						p, ok := req.Req_data.( *gizmos.Pledge_bwow )
 						if ok {
-							src, dest := p.Get_hosts( )									// we assume project/host-name
-
-							if src != nil && dest != nil {
-
-								net_sheep.Baa( 1,  "network: bwow reservation request received: %s -> %s", *src, *dest )
-
-								usr := "nobody"											// default dummy user if not project/host
-								toks := strings.SplitN( *src, "/", 2 )					// suss out project name
-								if len( toks ) > 1 {
-									usr = toks[0]										// the 'user' for queue setting
-								}
-
-								ips, err := act_net.name2ip( src )
-								if err == nil {
-									ipd, _ = act_net.name2ip( dest )				// for an external dest, this can be nil which is not an error
-								} 
-								if ips != nil {
-									sh := act_net.hosts[*ips]
-									if ipd != nil {
-										dh = act_net.hosts[*ipd]						// this will be nil for an external IP
-									}
-									ssw, _ := sh.Get_switch_port( 0 )
-									gate := gizmos.Mk_gate( sh, dh, ssw, p.Get_bandwidth(), usr )
-									if (*dest)[0:1] == "!" || dh == nil {			// indicate that dest IP cannot be converted to a MAC address
-										gate.Set_extip( dest )
-									}
-
-									c, e := p.Get_window( )														// commence/expiry times
-									fence := act_net.get_fence( &usr )
-									max := int64( -1 )
-									if fence != nil {
-										max = fence.Get_limit_max()
-									}
-
-									bw := p.Get_bandwidth()
-									suffix := "bps"							// suffix for bleat
-									if discount > 0 {
-										if discount < 101 {					// reduce by percentage of request
-											bw -=  ((bw * discount)/100)
-											suffix = "%"
-										} else {
-											bw -= discount					// reduce by a hard amount
-										}
-
-										if bw < 10 {						// add some sanity, and keep it from going too low
-											bw = 10
-										}
-										
-										net_sheep.Baa( 1, "owbandwidth was reduced by a discount of %d%s: bw=%d", discount, suffix, bw )
-									}
-
-									if gate.Has_capacity( c, e, bw, &usr, max ) {						// finally, verify that there is room and let it go if there is
-										qid := p.Get_id()												// for now, the queue id is just the reservation id, so fetch
-										p.Set_qid( qid ) 												// and add the queue id to the pledge
-
-										if gate.Add_queue( c, e, p.Get_bandwidth(), qid, fence ) {		// create queue AND inc utilisation on the link
-											req.Response_data = gate									// finally safe to set gate as the return data
-											req.State = nil												// and nil state to indicate OK
-										} else {
-											net_sheep.Baa( 1, "owreserve: internal mishap: unable to set queue for gate: %s", gate )
-											req.State = fmt.Errorf( "unable to create oneway reservation: unable to setup queue" )
-										}
-									} else {
-										var name string
-
-										net_sheep.Baa( 1, "owreserve: switch does not have enough capacity for a oneway reservation of %d (disc=%d)", bw, discount  )
-										namep := gate.Get_sw_name()
-										if namep == nil {
-											name = "unknown (nil)"
-										} else {
-											name = *namep
-										}
-										req.State = fmt.Errorf( "unable to create oneway reservation for %d: no capacity on (v)switch: %s", p.Get_bandwidth(), name ) 
-									}
-								} else {
-									net_sheep.Baa( 1, "cant map %s to ip: %s", src )
-									req.State = fmt.Errorf( "unable to create oneway reservation in network cannot map src (%s) to an IP address", src )
-								}
-							} else {
-								net_sheep.Baa( 1, "owreserve: one/both host names were invalid" )
-								req.State = fmt.Errorf( "unable to create oneway reservation in network one or both host names invalid" )
+							gate, err := act_net.bwow_gate( p, discount, true )
+							if err == nil {
+								req.Response_data = gate							// finally safe to set gate as the return data
 							}
+							req.State = err
 						} else {									// pledge wasn't a bw pledge
 							net_sheep.Baa( 1, "internal mishap: pledge passed to owreserve wasn't a bwow pledge: %s", p )
 							req.State = fmt.Errorf( "unable to create oneway reservation in network, internal data corruption." )
 						}
 
-					case REQ_BW_RESERVE:
-						var ip2		*string = nil					// tmp pointer for this block
+					case REQ_MIRROR_RESERVE:						// reserve mirror bandwidth; the path list or gate is set in the pledge
+						req.Response_data = nil
+						if p, ok := req.Req_data.( *gizmos.Pledge_mirror ); ok {
+							req.State = act_net.mirror_reserve( p, find_all_paths )
+						} else {
+							req.State = fmt.Errorf( "unable to reserve mirror bandwidth in network, internal data corruption." )
+						}
 
+					case REQ_BW_RESERVE:
 						// host names are expected to have been vetted (if needed) and translated to project-id/name if IDs are enabled
 						p, ok := req.Req_data.( *gizmos.Pledge_bw )
 						if ok {
-							h1, h2, _, _, commence, expiry, bandw_in, bandw_out := p.Get_values( )		// ports can be ignored
-							net_sheep.Baa( 1,  "network: bw reservation request received: %s -> %s  from %d to %d", *h1, *h2, commence, expiry )
-
-							suffix := "bps"
-							if discount > 0 {
-								if discount < 101 {
-									bandw_in -=  ((bandw_in * discount)/100)
-									bandw_out -=  ((bandw_out * discount)/100)
-									suffix = "%"
-								} else {
-									bandw_in -= discount
-									bandw_out -= discount
-								}
-
-								if bandw_out < 10 {			// add some sanity, and keep it from going too low
-									bandw_out = 10
-								}
-								if bandw_in < 10 {
-									bandw_in = 10
-								}
-								net_sheep.Baa( 1, "bandwidth was reduced by a discount of %d%s: in=%d out=%d", discount, suffix, bandw_in, bandw_out )
-							}
-
-							ip1, err := act_net.name2ip( h1 )
-							if err == nil {
-								ip2, err = act_net.name2ip( h2 )
-							}
-
-							if err == nil {
-								net_sheep.Baa( 2,  "network: attempt to find path between  %s -> %s", *ip1, *ip2 )
-								pcount_out, path_list_out, o_cap_trip := act_net.build_paths( ip1, ip2, commence, expiry, bandw_out, find_all_paths, false ); 	// outbound path
-								pcount_in, path_list_in, i_cap_trip := act_net.build_paths( ip2, ip1, commence, expiry, bandw_in, find_all_paths, true ); 		// inbound path
-
-								if pcount_out > 0  &&  pcount_in > 0  {
-									net_sheep.Baa( 1,  "network: %d acceptable path(s) found icap=%v ocap=%v", pcount_out + pcount_in, i_cap_trip, o_cap_trip )
-
-									path_list := make( []*gizmos.Path, pcount_out + pcount_in )		// combine the lists
-									pcount := 0
-									for j := 0; j < pcount_out; j++ {
-										path_list[pcount] = path_list_out[j]
-										pcount++
-									}
-									for j := 0; j < pcount_in; j++ {	
-										path_list[pcount] = path_list_in[j]
-										pcount++
-									}
-
-									qid := p.Get_id()											// for now, the queue id is just the reservation id, so fetch
-									p.Set_qid( qid )											// and add the queue id to the pledge
-
-									for i := 0; i < pcount; i++ {								// set the queues for each path in the list (multiple paths if network is disjoint)
-										fence := act_net.get_fence( path_list[i].Get_usr() )
-										net_sheep.Baa( 2,  "\tpath_list[%d]: %s -> %s  (%s)", i, *h1, *h2, path_list[i].To_str( ) )
-										path_list[i].Set_queue( qid, commence, expiry, path_list[i].Get_bandwidth(), fence )		// create queue AND inc utilisation on the link
-										if mlag_paths {
-											net_sheep.Baa( 1, "increasing usage for mlag members" )
-											path_list[i].Inc_mlag( commence, expiry, path_list[i].Get_bandwidth(), fence, act_net.mlags )
-										}
-									}
-
-									req.Response_data = path_list
-									req.State = nil
-								} else {
-									req.Response_data = nil
-									if i_cap_trip {
-										req.State = fmt.Errorf( "unable to generate a path: no capacity (h1<-h2)" )		// tedious, but we'll break out direction
-									} else {
-										if o_cap_trip {
-											req.State = fmt.Errorf( "unable to generate a path: no capacity (h1->h2)" )
-										} else {
-											req.State = fmt.Errorf( "unable to generate a path:  no path" )
-										}
-									}
-									net_sheep.Baa( 0,  "no paths in list: %s  cap=%v/%v", req.State, i_cap_trip, o_cap_trip )
-								}
-							} else {
-								net_sheep.Baa( 0,  "network: unable to map to an IP address: %s",  err )
-								req.State = fmt.Errorf( "unable to map host name to a known IP address: %s", err )
+							req.Response_data, req.State = act_net.bw_reserve( p, discount, find_all_paths, mlag_paths )
+							if req.State != nil {
+								req.Response_data = nil							// must be nil on error, not an empty list
 							}
 						} else {									// pledge wasn't a bw pledge
 							net_sheep.Baa( 1, "internal mishap: pledge passed to reserve wasn't a bw pledge: %s", p )
 							req.State = fmt.Errorf( "unable to create reservation in network, internal data corruption." )
 						}
 
+					case REQ_REPATH:								// move bw pledges off of links no longer in the graph (or drained links); one request for all
+						if rl, ok := req.Req_data.( []*repath_req ); ok {
+							act_net.bw_repath_list( rl, discount, find_all_paths, mlag_paths )
+							req.Response_data = rl
+						} else {
+							req.State = fmt.Errorf( "unable to re-path reservation in network, internal data corruption." )
+						}
+
+					case REQ_DRAIN:									// add (or change) a maintenance window; response is the list of links covered
+						if d, ok := req.Req_data.( *gizmos.Drain ); ok {
+							req.Response_data, req.State = act_net.add_drain( d )
+							if req.State != nil {
+								req.Response_data = nil
+							}
+						} else {
+							req.State = fmt.Errorf( "internal mishap: drain request did not contain a drain" )
+						}
+
+					case REQ_UNDRAIN:								// cancel a maintenance window
+						if id, ok := req.Req_data.( *string ); ok {
+							req.State = act_net.del_drain( *id )
+						} else {
+							req.State = fmt.Errorf( "internal mishap: undrain request did not contain an id" )
+						}
+
 					case REQ_PT_RESERVE:						// passthru reservations are allowed only in relaxed mode and only if user has link capacity set
 						req.Response_data = false				// assume bad
 						if req.Req_data != nil {
@@ -1426,15 +1965,7 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 						switch p := req.Req_data.( type ) {
 							case *gizmos.Pledge_bw:
 								net_sheep.Baa( 1,  "network: deleting bandwidth reservation: %s", *p.Get_id() )
-								commence, expiry := p.Get_window( )
-								path_list := p.Get_path_list( )
-		
-								qid := p.Get_qid()							// get the queue ID associated with the pledge
-								for i := range path_list {
-									fence := act_net.get_fence( path_list[i].Get_usr() )
-									net_sheep.Baa( 1,  "network: deleting path %d associated with usr=%s", i, *fence.Name )
-									path_list[i].Set_queue( qid, commence, expiry, -path_list[i].Get_bandwidth(), fence )		// reduce queues on the path as needed
-								}
+								act_net.bw_release( p, false )
 
 							case *gizmos.Pledge_bwow:
 								net_sheep.Baa( 1,  "network: deleting oneway reservation: %s", *p.Get_id() )
@@ -1443,6 +1974,10 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 								fence := act_net.get_fence( gate.Get_usr() )
 								gate.Set_queue( p.Get_qid(), commence, expiry, -p.Get_bandwidth(), fence )				// reduce queues
 
+							case *gizmos.Pledge_mirror:
+								net_sheep.Baa( 1,  "network: releasing mirror bandwidth: %s", *p.Get_id() )
+								act_net.mirror_release( p )
+
 							default:
 								net_sheep.Baa( 1, "internal mishap: req_del wasn't passed a bandwidth or oneway pledge; nothing done by network" )
 							
@@ -1605,6 +2140,21 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 						req.Response_data = nil;
 						req.State = nil;
 
+					case REQ_TOPOCHK:											// rebuild if the static topology file changed
+						if mt := file_mtime( *sdn_host ); mt != topo_mtime {
+							topo_mtime = mt											// even if the build fails, wait for the next change
+							net_sheep.Baa( 1, "static topology file changed; rebuilding network graph: %s", *sdn_host )
+							new_net := build( act_net, sdn_host, max_link_cap, link_headroom, link_alarm_thresh, hlist, false )
+							if new_net != nil {
+								new_net.xfer_maps( act_net )
+								new_net.note_lost_links( act_net )
+								act_net = new_net
+								act_net.apply_drains()
+							} else {
+								net_sheep.Baa( 0, "WRN: static topology not applied; the current network graph is kept  [TGUNET013]" )
+							}
+						}
+
 					case REQ_NETUPDATE:											// build a new network graph
 						then := time.Now().Unix()
 						if then >= next_netbuild {
@@ -1612,7 +2162,9 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 							new_net := build( act_net, sdn_host, max_link_cap, link_headroom, link_alarm_thresh, hlist, false )		// must force a switch graph rebuild here (expensive and will block for some seconds)
 							if new_net != nil {
 								new_net.xfer_maps( act_net )						// copy maps from old net to the new graph
+								new_net.note_lost_links( act_net )					// reservations using links that went away must move
 								act_net = new_net
+								act_net.apply_drains()								// new links covered by a drain
 	
 								net_sheep.Baa( 2, "network graph rebuild completed" )		// timing during debugging
 							} else {
@@ -1664,8 +2216,17 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 							net_sheep.Baa( 1, "user link capacity set: %s now %d%%", *data[0], f.Get_limit_max() )
 						}
 						
-					case REQ_NETGRAPH:							// dump the current network graph
-						req.Response_data = act_net.to_json()
+					case REQ_NETGRAPH:							// dump the current network graph; internal json unless an export format is requested
+						if gr, ok := req.Req_data.( *graph_req ); ok && gr != nil {
+							var jstr string
+							if jstr, req.State = act_net.export( gr ); req.State == nil {
+								req.Response_data = jstr
+							} else {
+								req.Response_data = nil
+							}
+						} else {
+							req.Response_data = act_net.to_json()
+						}
 
 					case REQ_LISTHOSTS:							// spew out a json list of hosts with name, ip, switch id and port
 						req.Response_data = act_net.host_list( )
@@ -1729,6 +2290,14 @@ func Network_mgr( nch chan *ipc.Chmsg, sdn_host *string ) {
 						req.Response_ch = nil			// we don't respond to these
 						act_net.update_mac2phost( req.Req_data.( []string ), phost_suffix )
 
+					case REQ_QPCAPS:					// host capabilities from the agent; split reservations need group support
+						req.Response_ch = nil
+						act_net.update_split_hosts( req.Req_data.( []string ), phost_suffix )
+
+					case REQ_LLDP:						// lldp neighbours from the agent; used on the next graph build
+						req.Response_ch = nil
+						act_net.update_lldp( req.Req_data.( []string ), phost_suffix )
+
 					default:
 						net_sheep.Baa( 1,  "unknown request received on channel: %d", req.Msg_type )
 				}
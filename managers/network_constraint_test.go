@@ -0,0 +1,82 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	network_constraint_test
+	Abstract:	Tests for reservations which supply path constraints where the network
+				cannot treat them as usual: constraints are refused in relaxed mode, a
+				constrained reservation is never split (the error says so), and an avoided
+				switch which both hosts are attached to prevents the path.
+	Date:		19 Oct 2026
+*/
+
+package managers
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Split topology (see network_split_test) with a third host on sw1.
+*/
+var constraint_topo = strings.Replace( split_topo,
+	`"hosts": [`,
+	`"hosts": [ { "mac": "fa:16:3e:00:00:03", "ip4": "10.0.0.3", "switch": "sw1", "port": 8 },`, 1 )
+
+func Test_constraint_modes( t *testing.T ) {
+	fmt.Fprintf( os.Stderr, "\n------- constraints where not usual ----\n" )
+	n := mk_topo_net( t, nil, constraint_topo, 4 )
+	n.Set_split( 4 )
+	n.update_split_hosts( []string{ "sw1 " + gizmos.OF_CAP_SPLIT }, nil )
+	h1 := "10.0.0.1"
+	h2 := "10.0.0.2"
+	h3 := "10.0.0.3"
+	now := time.Now().Unix()
+	pc, _ := gizmos.Mk_path_constraints( "maxhops=3" )
+
+	if pcount, _, _, cerr := n.find_paths( &h1, &h2, nil, now, now + 3600, 500, nil, &empty_str, false, pc ); pcount != 1 || cerr != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: constrained path not found: %d paths err=%v\n", pcount, cerr )
+		t.Fail()
+	}
+
+	pcount, _, _, cerr := n.find_paths( &h1, &h2, nil, now, now + 3600, 1000, nil, &empty_str, false, pc )		// only a split has room
+	if pcount != 0 || cerr == nil || ! strings.Contains( cerr.Error(), "not split" ) {
+		fmt.Fprintf( os.Stderr, "FAIL: constrained reservation split, or the error does not say why not: %d paths err=%v\n", pcount, cerr )
+		t.Fail()
+	}
+
+	pc, _ = gizmos.Mk_path_constraints( "avoid=sw1" )
+	if pcount, _, _, cerr = n.find_paths( &h1, &h3, nil, now, now + 3600, 100, nil, &empty_str, false, pc ); pcount != 0 || cerr == nil || ! strings.Contains( cerr.Error(), "both hosts" ) {
+		fmt.Fprintf( os.Stderr, "FAIL: path on an avoided switch accepted: %d paths err=%v\n", pcount, cerr )
+		t.Fail()
+	}
+
+	n.relaxed = true
+	pc, _ = gizmos.Mk_path_constraints( "maxhops=3" )
+	if pcount, _, _, cerr = n.find_paths( &h1, &h2, nil, now, now + 3600, 100, nil, &empty_str, false, pc ); pcount != 0 || cerr == nil || ! strings.Contains( cerr.Error(), "relaxed" ) {
+		fmt.Fprintf( os.Stderr, "FAIL: constraints not refused in relaxed mode: %d paths err=%v\n", pcount, cerr )
+		t.Fail()
+	}
+}
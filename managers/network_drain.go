@@ -0,0 +1,167 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+
+	Mnemonic:	network_drain
+	Abstract:	Functions that support the network manager with respect to maintenance windows
+				(drains). A drain removes a percentage of the capacity of the links it covers
+				for its window by adding that amount to the utilisation of each link's
+				obligation; path finding then rejects the links for reservations which need the
+				capacity. The amount added to each obligation is remembered so that exactly that
+				amount is removed when the drain is cancelled, even if the link's capacity has
+				since changed. Drains are carried from graph to graph and are applied to links
+				which appear after the drain was added when the graph is rebuilt.
+
+	Date:		19 Oct 2026
+*/
+
+package managers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/att/tegu/gizmos"
+)
+
+type net_drain struct {
+	d			*gizmos.Drain
+	commence	int64								// start of the window as applied (not in the past)
+	applied		map[*gizmos.Obligation]int64		// amount added to each obligation; bonded links share one
+}
+
+/*
+	Returns the live links in the graph which are covered by the drain, sorted by id.
+*/
+func (n *Network) drain_links( d *gizmos.Drain ) ( links []*gizmos.Link ) {
+	ids := make( []string, 0 )
+	for id, l := range n.links {
+		if n.live[id] {
+			sw1, sw2 := l.Get_sw_names()
+			if d.Covers_link( *sw1, *sw2 ) {
+				ids = append( ids, id )
+			}
+		}
+	}
+	sort.Strings( ids )
+
+	links = make( []*gizmos.Link, len( ids ) )
+	for i, id := range ids {
+		links[i] = n.links[id]
+	}
+
+	return
+}
+
+/*
+	Apply the drain to any covered link not yet drained. Returns the ids of all links that
+	the drain covers in the current graph.
+*/
+func (n *Network) apply_drain( nd *net_drain ) ( ids []string ) {
+	_, conclude := nd.d.Get_window()
+
+	links := n.drain_links( nd.d )
+	ids = make( []string, 0, len( links ) )
+	for _, l := range links {
+		ids = append( ids, *l.Get_id() )
+
+		ob := l.Get_allotment()
+		if _, ok := nd.applied[ob]; ! ok {
+			amt := (ob.Get_max_capacity() * int64( nd.d.Get_pct() )) / 100
+			ob.Inc_utilisation( nd.commence, conclude, amt, nil )
+			nd.applied[ob] = amt
+			net_sheep.Baa( 2, "drain %s: %d removed from link %s", nd.d.Get_id(), amt, *l.Get_id() )
+		}
+	}
+
+	return
+}
+
+/*
+	Add a drain and apply it to the links it covers. If a drain with the same id exists it
+	is removed first (the drain is being changed). An error is returned if no link in the
+	graph is covered. The ids of the covered links are returned.
+*/
+func (n *Network) add_drain( d *gizmos.Drain ) ( ids []string, err error ) {
+	if d == nil {
+		return nil, fmt.Errorf( "no drain supplied" )
+	}
+	if d.Is_expired() {
+		return nil, fmt.Errorf( "drain window has passed: %s", d.Get_id() )
+	}
+	if len( n.drain_links( d ) ) == 0 {
+		return nil, fmt.Errorf( "no links in the network graph are covered by %s %s", d.Get_kind(), d.Get_target() )
+	}
+
+	if n.drains == nil {
+		n.drains = make( map[string]*net_drain )
+	}
+	if od := n.drains[d.Get_id()]; od != nil {
+		if od.d == d {											// same drain (listing, or checkpoint reload); nothing to undo
+			return n.apply_drain( od ), nil
+		}
+		n.del_drain( d.Get_id() )
+	}
+
+	commence, _ := d.Get_window()
+	if now := time.Now().Unix(); commence < now {
+		commence = now
+	}
+	nd := &net_drain{ d: d, commence: commence, applied: make( map[*gizmos.Obligation]int64 ) }
+	n.drains[d.Get_id()] = nd
+
+	ids = n.apply_drain( nd )
+	net_sheep.Baa( 1, "%s applied to %d link(s)", d, len( ids ) )
+	return ids, nil
+}
+
+/*
+	Remove the drain returning the capacity to the links.
+*/
+func (n *Network) del_drain( id string ) ( err error ) {
+	nd := n.drains[id]
+	if nd == nil {
+		return fmt.Errorf( "no such drain: %s", id )
+	}
+
+	_, conclude := nd.d.Get_window()
+	for ob, amt := range nd.applied {
+		ob.Dec_utilisation( nd.commence, conclude, amt, nil )
+	}
+	delete( n.drains, id )
+
+	net_sheep.Baa( 1, "drain removed: %s", nd.d )
+	return nil
+}
+
+/*
+	Called after the graph is rebuilt: drains whose window has passed are dropped and the
+	others are applied to links which have appeared since they were added.
+*/
+func (n *Network) apply_drains( ) {
+	for id, nd := range n.drains {
+		if nd.d.Is_expired() {
+			delete( n.drains, id )
+		} else {
+			n.apply_drain( nd )
+		}
+	}
+}
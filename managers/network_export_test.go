@@ -0,0 +1,71 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	network_export_test
+	Abstract:	Tests for the graph export: every link known to the network is exported, and
+				links which are administratively excluded, gone from the topology, or excluded
+				from path finding are marked.
+	Date:		19 Oct 2026
+*/
+
+package managers
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/att/tegu/gizmos"
+)
+
+func Test_export_excluded( t *testing.T ) {
+	fmt.Fprintf( os.Stderr, "\n------- graph export exclusions --------\n" )
+	old := mk_topo_net( t, nil, split_topo, 4 )
+
+	topo := strings.Replace( split_topo, `{ "src": "sw3", "src_port": 2, "dst": "sw2", "dst_port": 3, "capacity": 1000, "headroom": 0 },`, "", 1 )		// link lost
+	topo = strings.Replace( topo, `"dst_port": 1, "capacity": 600, "headroom": 0 }`, `"dst_port": 1, "capacity": 600, "headroom": 0, "excluded": true }`, 1 )	// sw1-sw2 excluded by the admin
+	n := mk_topo_net( t, old, topo, 4 )
+	n.links["sw2-sw4"].Set_excluded( true )						// avoided while pledges are moved
+
+	gstr, err := n.export( &graph_req{ format: gizmos.GX_DOT } )
+	if err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: export failed: %s\n", err )
+		t.FailNow()
+	}
+
+	expect := map[string]bool{ "sw1-sw2": true, "sw1-sw3": false, "sw3-sw2": true, "sw2-sw4": true }
+	for id, excl := range expect {
+		found := false
+		for _, line := range strings.Split( gstr, "\n" ) {
+			if strings.Contains( line, fmt.Sprintf( "id=%q", id ) ) {
+				found = true
+				if strings.Contains( line, "style=dashed" ) != excl {
+					fmt.Fprintf( os.Stderr, "FAIL: link %s exported with excluded != %v: %s\n", id, excl, line )
+					t.Fail()
+				}
+			}
+		}
+		if ! found {
+			fmt.Fprintf( os.Stderr, "FAIL: link %s not exported\n", id )
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,214 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+
+/*
+
+	Mnemonic:	network_lldp
+	Abstract:	Functions that support the network manager with respect to topology discovered
+				with LLDP. The agent reports the neighbours seen by each physical host; the
+				reports are kept by host and merged into the links read from the static
+				topology when the graph is built. Discovered links which are not in the static
+				topology are added, capacity missing from the static topology is taken from the
+				discovered interface speed, and any differences between the two are recorded
+				as discrepancies (listed with the graph and logged when first seen). Discovered
+				links are only merged into a real topology; on their own they have no switch to
+				switch links and the dummy star topology is used instead. The neighbours of a host
+				that misses LLDP_MAX_MISSED refreshes are dropped.
+
+	Date:		19 Oct 2026
+*/
+
+package managers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/att/tegu/gizmos"
+)
+
+const (
+	LLDP_MAX_MISSED	int64 = 3				// refreshes a host may miss before its neighbours are dropped
+)
+
+/*
+	Returns the switch id with any @interface suffix dropped (build does the same).
+*/
+func lldp_swid( id string ) ( string ) {
+	return strings.SplitN( id, "@", 2 )[0]
+}
+
+/*
+	Returns a key for the link between two switches which is the same in either direction.
+*/
+func lldp_pair( sw1 string, sw2 string ) ( string ) {
+	sw1 = lldp_swid( sw1 )
+	sw2 = lldp_swid( sw2 )
+	if sw1 > sw2 {
+		return sw2 + " " + sw1
+	}
+	return sw1 + " " + sw2
+}
+
+/*
+	Accepts the records returned by the agent (one neighbour per record) and replaces the
+	neighbours saved for each host that reported. The phost suffix, if the agent's host names
+	carry one, is removed so that hosts match the names in the graph.
+*/
+func (n *Network) update_lldp( recs []string, phost_suffix *string ) {
+	if n == nil {
+		return
+	}
+	if n.lldp == nil {
+		n.lldp = make( map[string][]*gizmos.Lldp_neighbour )
+	}
+	if n.lldp_ts == nil {
+		n.lldp_ts = make( map[string]int64 )
+	}
+
+	reported := make( map[string][]*gizmos.Lldp_neighbour )
+	for _, rec := range recs {
+		nb, err := gizmos.Mk_lldp_neighbour( rec )
+		if err != nil {
+			net_sheep.Baa( 1, "WRN: lldp record ignored: %s  [TGUNET014]", err )
+			continue
+		}
+
+		if phost_suffix != nil {
+			nb.Host = strings.TrimSuffix( nb.Host, *phost_suffix )
+		}
+		reported[nb.Host] = append( reported[nb.Host], nb )
+	}
+
+	now := time.Now().Unix()
+	for h, nbrs := range reported {
+		n.lldp[h] = nbrs
+		n.lldp_ts[h] = now
+	}
+	n.age_lldp( now )
+	net_sheep.Baa( 1, "lldp: neighbours received for %d host(s); %d host(s) known", len( reported ), len( n.lldp ) )
+}
+
+/*
+	Drop the neighbours of hosts which have not reported within the age limit so that links to a
+	host which has gone away (or whose agent has) do not linger. No limit (0) keeps everything.
+*/
+func (n *Network) age_lldp( now int64 ) {
+	if n == nil || n.lldp_age <= 0 {
+		return
+	}
+
+	for h := range n.lldp {
+		if now - n.lldp_ts[h] > n.lldp_age {
+			net_sheep.Baa( 1, "lldp: neighbours of %s dropped; no report in %ds", h, now - n.lldp_ts[h] )
+			delete( n.lldp, h )
+			delete( n.lldp_ts, h )
+		}
+	}
+}
+
+/*
+	Returns the links for all discovered neighbours.
+*/
+func (n *Network) lldp_links( ) ( links []gizmos.FL_link_json ) {
+	hosts := make( []string, 0, len( n.lldp ) )
+	for h := range n.lldp {
+		hosts = append( hosts, h )
+	}
+	sort.Strings( hosts )
+
+	links = make( []gizmos.FL_link_json, 0 )
+	for _, h := range hosts {
+		for _, nb := range n.lldp[h] {
+			links = append( links, nb.Fl_link() )
+		}
+	}
+
+	return
+}
+
+/*
+	Merge the discovered links with those from the static topology. Returns the merged list and
+	the discrepancies between the two:
+		- a discovered link which isn't in the topology (it is added)
+		- a link with different capacities (the topology wins; a missing capacity is filled in)
+		- a topology link to a host that reported neighbours, but not over that link
+*/
+func (n *Network) merge_lldp( links []gizmos.FL_link_json ) ( merged []gizmos.FL_link_json, discrep []string ) {
+	discrep = make( []string, 0 )
+	if n == nil {
+		return links, discrep
+	}
+	n.age_lldp( time.Now().Unix() )							// hosts whose agent stopped reporting too
+	if len( n.lldp ) == 0 {
+		return links, discrep
+	}
+
+	lidx := make( map[string][]int, len( links ) )			// indexes into links by switch pair (a pair may be listed in each direction)
+	for i := range links {
+		key := lldp_pair( links[i].Src_switch, links[i].Dst_switch )
+		lidx[key] = append( lidx[key], i )
+	}
+
+	merged = links
+	seen := make( map[string]bool )
+	for _, dl := range n.lldp_links() {
+		key := lldp_pair( dl.Src_switch, dl.Dst_switch )
+		seen[key] = true
+
+		if il, ok := lidx[key]; ok {
+			for _, i := range il {
+				switch {
+					case dl.Capacity <= 0:
+						// speed not known, nothing to compare
+
+					case merged[i].Capacity <= 0:
+						merged[i].Capacity = dl.Capacity
+
+					case merged[i].Capacity != dl.Capacity:
+						discrep = append( discrep, fmt.Sprintf( "link %s-%s: capacity in topology is %d, discovered %d", lldp_swid( merged[i].Src_switch ), lldp_swid( merged[i].Dst_switch ), merged[i].Capacity, dl.Capacity ) )
+				}
+			}
+		} else {
+			discrep = append( discrep, fmt.Sprintf( "link %s-%s: discovered, but not in the topology", lldp_swid( dl.Src_switch ), dl.Dst_switch ) )
+			lidx[key] = []int{ len( merged ) }
+			merged = append( merged, dl )
+		}
+	}
+
+	for i := range links {
+		key := lldp_pair( links[i].Src_switch, links[i].Dst_switch )
+		if seen[key] {
+			continue
+		}
+		seen[key] = true										// report a pair once
+
+		for _, sw := range []string{ links[i].Src_switch, links[i].Dst_switch } {
+			if n.lldp[lldp_swid( sw )] != nil {
+				discrep = append( discrep, fmt.Sprintf( "link %s-%s: in the topology, but not discovered by %s", lldp_swid( links[i].Src_switch ), lldp_swid( links[i].Dst_switch ), lldp_swid( sw ) ) )
+				break
+			}
+		}
+	}
+
+	return
+}
@@ -29,6 +29,10 @@
 
 	Mods:		23 May 2016 - Make ingress rate check in relaxed mode consistent between 
 					regular and one-way reservations.
+				19 Oct 2026 - Split a reservation across paths when no single path has room.
+				19 Oct 2026 - Constrained path finding (max hops/latency, avoided switches and srlgs).
+				19 Oct 2026 - Reservations are split only where the agent can install the group and each
+					path leaves the switch on a known port.
 */
 
 package managers
@@ -206,7 +210,6 @@ func (n *Network) find_endpoints( h1ip *string, h2ip *string ) ( pair_list []hos
 	setting of inital cost, etc.
 */
 func (n *Network) find_shortest_path( ssw *gizmos.Switch, h1 *gizmos.Host, h2 *gizmos.Host, usr *string, commence int64, conclude int64, inc_cap int64, usr_max int64 ) ( path *gizmos.Path, cap_trip bool ) {
-	h1nm := h1.Get_mac()
 	h2nm := h2.Get_mac()
 	path = nil
 
@@ -219,6 +222,19 @@ func (n *Network) find_shortest_path( ssw *gizmos.Switch, h1 *gizmos.Host, h2 *g
 
 	ssw.Cost = 0														// seed the cost in the source switch
 	tsw, cap_trip := ssw.Path_to( h2nm, commence, conclude, inc_cap, usr, usr_max )		// discover the shortest path to terminating switch that has enough bandwidth
+	path = n.walk_path( tsw, h1, h2, inc_cap )
+
+	return
+}
+
+/*
+	Builds the path structure by walking backwards from the terminating switch (tsw) using the
+	Prev/Plink information left by the path finding function. Returns nil if tsw is nil.
+*/
+func (n *Network) walk_path( tsw *gizmos.Switch, h1 *gizmos.Host, h2 *gizmos.Host, inc_cap int64 ) ( path *gizmos.Path ) {
+	h1nm := h1.Get_mac()
+	h2nm := h2.Get_mac()
+
 	if tsw != nil {												// must walk from the term switch backwards collecting the links to set the path
 		path = gizmos.Mk_path( h1, h2 )
 		path.Set_reverse( true )								// indicate that the path is saved in reverse order
@@ -254,6 +270,34 @@ func (n *Network) find_shortest_path( ssw *gizmos.Switch, h1 *gizmos.Host, h2 *g
 	return
 }
 
+/*
+	A helper function for find_paths which is used when the reservation supplied path constraints.
+	The lowest cost path that satisfies the constraints and has capacity is found and its path
+	structure built. If no path is found, err explains which constraints (or capacity) prevented
+	links from being used.
+
+	This function makes the same assumptions about switch initialisation as find_shortest_path.
+*/
+func (n *Network) find_constrained_path( ssw *gizmos.Switch, h1 *gizmos.Host, h2 *gizmos.Host, usr *string, commence int64, conclude int64, inc_cap int64, usr_max int64, pc *gizmos.Path_constraints ) ( path *gizmos.Path, cap_trip bool, err error ) {
+	if usr_max <= 0 {
+		return nil, false, fmt.Errorf( "user link capacity set to 0" )
+	}
+
+	if pc.Avoids_switch( ssw ) {
+		return nil, false, fmt.Errorf( "switch %s is to be avoided, but %s is attached to it", *(ssw.Get_id()), *(h1.Get_mac()) )
+	}
+
+	ssw.Cost = 0
+	tsw, cap_trip, err := ssw.Cpath_to( h2.Get_mac(), commence, conclude, inc_cap, usr, usr_max, pc )
+	if err != nil {
+		net_sheep.Baa( 1, "find_cpath: %s", err )
+		return nil, cap_trip, err
+	}
+
+	path = n.walk_path( tsw, h1, h2, inc_cap )
+	return
+}
+
 /*
 	This is a helper function for find_paths(). It is used to find all possible paths between h1 and h2 starting at ssw.
 	The resulting path is a "scramble" meaning that the set of links is a unique set of links that are traversed by
@@ -298,6 +342,182 @@ func (n *Network) find_all_paths( ssw *gizmos.Switch, h1 *gizmos.Host, h2 *gizmo
 	return
 }
 
+/*
+	A helper function for find_paths() used when no single path has the capacity for the reservation
+	and splitting is enabled (split_paths in the config). The split is made only on the first switch
+	(the host) where a select group spreads the flows over the links leaving the switch; beyond the
+	first hop the traffic follows the network's normal route. So a path is found for each link out
+	of the switch, the shortest path when all of the other links out of the switch are excluded,
+	and up to split_max of those with the most capacity available are used. Inc_cap is divided
+	between them in proportion to the capacity available on each. As paths may come together
+	after the first hop, each link must have the capacity for the sum of the shares of the paths
+	which use it. The paths returned are marked as split and carry their share as their bandwidth.
+	Nil is returned if fewer than two paths are found or if together they cannot carry the amount.
+
+	Nil is also returned if the host's agent has not reported that it can install the group, or
+	if a path leaves the switch on a port that is not known (late binding).
+
+	This function assumes the same switch initialisation as find_shortest_path and resets the
+	switches before each search. Links out of the switch which are already excluded (drained)
+	are not used and are left excluded.
+*/
+func (n *Network) find_split_paths( ssw *gizmos.Switch, h1 *gizmos.Host, h2 *gizmos.Host, usr *string, commence int64, conclude int64, inc_cap int64, usr_max int64 ) ( plist []*gizmos.Path ) {
+	if ! n.split_hosts[*ssw.Get_id()] {
+		net_sheep.Baa( 1, "find_split: %s cannot install split groups; not split", *ssw.Get_id() )
+		return nil
+	}
+
+	first := make( []*gizmos.Link, 0, 8 )						// links out of the switch that the group can choose between
+	for i := 0; ssw.Get_link( i ) != nil; i++ {
+		if l := ssw.Get_link( i ); ! l.Is_excluded() && ! l.Is_admin_excluded() {
+			first = append( first, l )
+		}
+	}
+
+	found := make( []*gizmos.Path, 0, len( first ) )
+	avail := make( []int64, 0, len( first ) )
+	for _, fl := range first {
+		for _, l := range first {
+			l.Set_excluded( l != fl )								// only this link may be used to leave the switch
+		}
+		for sname := range n.switches {
+			n.switches[sname].Cost = 2147483647
+			n.switches[sname].Prev = nil
+			n.switches[sname].Flags &= ^tegu.SWFL_VISITED
+		}
+
+		path, _ := n.find_shortest_path( ssw, h1, h2, usr, commence, conclude, 1, usr_max )		// any path with some room
+		if path == nil {
+			continue
+		}
+
+		a := path.Get_available( commence, conclude, usr_max )
+		i := len( found )
+		found = append( found, path )
+		avail = append( avail, a )
+		for ; i > 0 && avail[i-1] < a; i-- {						// keep in order of most available first
+			found[i], avail[i] = found[i-1], avail[i-1]
+		}
+		found[i], avail[i] = path, a
+	}
+	for _, l := range first {
+		l.Set_excluded( false )
+	}
+
+	if len( found ) > n.split_max {
+		found = found[:n.split_max]
+		avail = avail[:n.split_max]
+	}
+	if len( found ) < 2 {
+		net_sheep.Baa( 1, "find_split: only %d path(s) leave %s between %s and %s", len( found ), *ssw.Get_id(), *(h1.Get_mac()), *(h2.Get_mac()) )
+		return nil
+	}
+
+	for i := range found {
+		if spq := found[i].Get_ilink_spq( &empty_str, commence ); spq == nil || spq.Port <= 0 {		// group buckets output on this port
+			net_sheep.Baa( 1, "find_split: path %d does not leave %s on a known port; not split: %s", i, *ssw.Get_id(), found[i].To_str() )
+			return nil
+		}
+	}
+
+	shares, err := gizmos.Split_shares( inc_cap, avail )
+	if err != nil {
+		net_sheep.Baa( 1, "find_split: %d paths between %s and %s: %s", len( found ), *(h1.Get_mac()), *(h2.Get_mac()), err )
+		return nil
+	}
+
+	need := make( map[*gizmos.Link]int64 )						// amount each link carries; more than one share where paths join
+	for i := range found {
+		if shares[i] > 0 {
+			for _, l := range found[i].Get_links() {
+				need[l] += shares[i]
+			}
+		}
+	}
+	for l, amt := range need {
+		if ok, err := l.Has_capacity( commence, conclude, amt, usr, usr_max ); ! ok {		// user limits are checked with the real amount
+			net_sheep.Baa( 1, "find_split: link %s cannot carry the %d of the paths using it: %s", *l.Get_id(), amt, err )
+			return nil
+		}
+	}
+
+	plist = make( []*gizmos.Path, 0, len( found ) )
+	for i := range found {
+		if shares[i] <= 0 {
+			continue
+		}
+
+		found[i].Set_bandwidth( shares[i] )
+		found[i].Set_split( true )
+		plist = append( plist, found[i] )
+	}
+
+	if len( plist ) == 1 {										// all on one path; not really split
+		plist[0].Set_split( false )
+	}
+
+	net_sheep.Baa( 1, "find_split: %d split across %d paths between %s and %s: %v", inc_cap, len( plist ), *(h1.Get_mac()), *(h2.Get_mac()), shares )
+	return plist
+}
+
+/*
+	Accepts the capability records returned by the agent (host mechanism...) and replaces the
+	split state of each host that reported. The phost suffix is removed so that hosts match the
+	switch names in the graph.
+*/
+func (n *Network) update_split_hosts( recs []string, phost_suffix *string ) {
+	if n == nil {
+		return
+	}
+	if n.split_hosts == nil {
+		n.split_hosts = make( map[string]bool )
+	}
+
+	for _, rec := range recs {
+		toks := strings.Fields( rec )
+		if len( toks ) < 1 {
+			continue
+		}
+
+		h := toks[0]
+		if phost_suffix != nil {
+			h = strings.TrimSuffix( h, *phost_suffix )
+		}
+		n.split_hosts[h] = false
+		for _, t := range toks[1:] {
+			if t == gizmos.OF_CAP_SPLIT {
+				n.split_hosts[h] = true
+			}
+		}
+	}
+}
+
+/*
+	Return the bandwidth carried by each path in the list if the list contains paths split from
+	a single reservation; nil otherwise.
+*/
+func path_shares( plist []*gizmos.Path ) ( shares []int64 ) {
+	for _, p := range plist {
+		if p.Is_split() {
+			shares = append( shares, p.Get_bandwidth() )
+		}
+	}
+
+	return shares
+}
+
+/*
+	Build the error returned to the requestor when path constraints prevented a path (outbound
+	h1->h2, inbound h1<-h2) from being found.  Either error may be nil.
+*/
+func constraint_err( out_err error, in_err error ) ( error ) {
+	if out_err != nil {
+		return fmt.Errorf( "unable to generate a path: constraints not met (h1->h2): %s", out_err )
+	}
+
+	return fmt.Errorf( "unable to generate a path: constraints not met (h1<-h2): %s", in_err )
+}
+
 /*
 	A helper function for find_paths() that is used when running in 'relaxed' mode. In relaxed mode we don't
 	actually find a path between the endpoints as we aren't doign admission control, but need to simulate
@@ -357,8 +577,13 @@ func (n *Network) find_relaxed_path( sw1 *gizmos.Switch, h1 *gizmos.Host, sw2 *g
 
 	If find_all is set, and mlog_paths is false, then we will suss out all possible paths between h1 and h2 and not
 	just the shortest path.
+
+	If pc is not empty, the lowest cost path that satisfies the constraints is found; a constrained request
+	always gets a single path (find_all and splitting are not applied), and constrained requests are refused
+	in relaxed mode as the virtual paths cannot honour them. When the constraints prevent a path from being
+	found cerr describes why.
 */
-func (n *Network) find_paths( h1nm *string, h2nm *string, usr *string, commence int64, conclude int64, inc_cap int64, extip *string, ext_flag *string, find_all bool ) ( pcount int, path_list []*gizmos.Path, cap_trip bool ) {
+func (n *Network) find_paths( h1nm *string, h2nm *string, usr *string, commence int64, conclude int64, inc_cap int64, extip *string, ext_flag *string, find_all bool, pc *gizmos.Path_constraints ) ( pcount int, path_list []*gizmos.Path, cap_trip bool, cerr error ) {
 	var (
 		path	*gizmos.Path
 		ssw 	*gizmos.Switch		// starting switch
@@ -373,7 +598,7 @@ func (n *Network) find_paths( h1nm *string, h2nm *string, usr *string, commence
 
 	if h1nm == nil || h2nm == nil {
 		net_sheep.Baa( 1, "IER:	find_paths: one/both names is/are nil  h1 nil=%v  h2 nil=%v", h1nm == nil, h2nm == nil )
-		return 0, nil, false
+		return 0, nil, false, nil
 	}
 
 	h1 = n.hosts[*h1nm]
@@ -399,6 +624,12 @@ func (n *Network) find_paths( h1nm *string, h2nm *string, usr *string, commence
 		return
 	}
 
+	if n.relaxed && ! pc.Is_empty() {		// relaxed paths are virtual; there are no links to hold to the constraints
+		cerr = fmt.Errorf( "path constraints are not supported in relaxed mode: %s", pc )
+		net_sheep.Baa( 1, "find_paths: %s", cerr )
+		return
+	}
+
 	path_list = make( []*gizmos.Path, len( n.links ) )		// we cannot have more in our path than the number of links (needs to be changed as this isn't good in the long run)
 	pcount = 0
 
@@ -421,6 +652,12 @@ func (n *Network) find_paths( h1nm *string, h2nm *string, usr *string, commence
 
 		fence := n.get_fence( usr )
 		if ssw.Has_host( h1nm )  &&  ssw.Has_host( h2nm ) {			// if both hosts are on the same switch, there's no path if they both have the same port (both external to our view)
+			if pc.Avoids_switch( ssw ) {								// the only switch the path could use is to be avoided
+				cerr = fmt.Errorf( "switch %s is to be avoided, but both hosts are attached to it", *(ssw.Get_id()) )
+				swidx++
+				continue
+			}
+
 			p1 := h1.Get_port( ssw )
 			p2 := h2.Get_port( ssw )
 			if p1 < 0 || p1 != p2 {									// when ports differ we'll create/find the vlink between them	(in Tegu-lite port == -128 is legit and will dup)
@@ -477,7 +714,18 @@ func (n *Network) find_paths( h1nm *string, h2nm *string, usr *string, commence
 					net_sheep.Baa( 1, "find_paths: find_relaxed failed: %s", err )
 				}
 			} else {
-				if find_all {																		// find all possible paths not just shortest
+				if ! pc.Is_empty() {																// constraints take precedence over find all and splitting
+					path, cap_trip, err = n.find_constrained_path( ssw, h1, h2, usr, commence, conclude, inc_cap, fence.Get_limit_max(), pc )
+					if cap_trip {
+						lcap_trip = true
+					}
+					if err != nil {
+						if find_all || n.split_max > 1 {
+							err = fmt.Errorf( "%s (a constrained reservation uses a single path; it is not split or spread across all paths)", err )
+						}
+						cerr = err
+					}
+				} else if find_all {																// find all possible paths not just shortest
 					path, err = n.find_all_paths( ssw, h1, h2, usr, commence, conclude, inc_cap, fence.Get_limit_max() )		// find a 'scramble' path
 					if err != nil {
 						net_sheep.Baa( 1, "find_paths: find_all failed: %s", err )
@@ -486,6 +734,16 @@ func (n *Network) find_paths( h1nm *string, h2nm *string, usr *string, commence
 					path, cap_trip = n.find_shortest_path( ssw, h1, h2, usr, commence, conclude, inc_cap, fence.Get_limit_max() )
 					if cap_trip {
 						lcap_trip = true
+
+						if path == nil && n.split_max > 1 {										// no single path has room; try dividing it
+							for _, sp := range n.find_split_paths( ssw, h1, h2, usr, commence, conclude, inc_cap, fence.Get_limit_max() ) {
+								if plidx < len( path_list ) {
+									sp.Set_extip( extip, ext_flag )
+									path_list[plidx] = sp
+									plidx++
+								}
+							}
+						}
 					}
 				}
 			}
@@ -524,8 +782,11 @@ func (n *Network) find_paths( h1nm *string, h2nm *string, usr *string, commence
 
 	rpath is true if this function is called to build the reverse path.  It is necessary in order to
 	properly set the external ip address flag (src/dest).
+
+	Pc are the path constraints supplied with the reservation (nil if none). If a path could not be found
+	because of the constraints, cerr describes the reason.
 */
-func (n *Network) build_paths( h1nm *string, h2nm *string, commence int64, conclude int64, inc_cap int64, find_all bool, rpath bool ) ( pcount int, path_list []*gizmos.Path, cap_trip bool ) {
+func (n *Network) build_paths( h1nm *string, h2nm *string, commence int64, conclude int64, inc_cap int64, find_all bool, rpath bool, pc *gizmos.Path_constraints ) ( pcount int, path_list []*gizmos.Path, cap_trip bool, cerr error ) {
 	var (
 		num int = 0				// must declare num as := assignment doesnt work when ipath[n] is in the list
 		src_flag string = "-S"	// flags that indicate which direction the external address is
@@ -556,7 +817,7 @@ func (n *Network) build_paths( h1nm *string, h2nm *string, commence int64, concl
 		ext_flag = &dst_flag
 	}
 	for i := range pair_list {
-		num, ipaths[i], cap_trip = n.find_paths( pair_list[i].h1, pair_list[i].h2, pair_list[i].usr, commence, conclude, inc_cap, pair_list[i].fip, ext_flag, find_all )	
+		num, ipaths[i], cap_trip, err = n.find_paths( pair_list[i].h1, pair_list[i].h2, pair_list[i].usr, commence, conclude, inc_cap, pair_list[i].fip, ext_flag, find_all, pc )
 		if num > 0 {
 			total_paths += num
 			ok_count++
@@ -574,6 +835,9 @@ func (n *Network) build_paths( h1nm *string, h2nm *string, commence int64, concl
 			if cap_trip {
 				lcap_trip = true
 			}
+			if err != nil {
+				cerr = err
+			}
 		}
 
 		if rpath {													// flip the src/dest flag for the second side of the path if two components
@@ -0,0 +1,221 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	network_split_test
+	Abstract:	Tests for reservations split across paths: the paths differ only in the link
+				which leaves the host (the only hop the select group chooses), links where the
+				paths join must hold the sum of the shares, and each split direction is given
+				a select group id which no other live reservation uses. The network is built
+				from a static topology written to a scratch directory.
+	Date:		19 Oct 2026
+*/
+
+package managers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/att/gopkgs/bleater"
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Two links leave sw1; the path through sw3 joins the path through sw2 at sw2, so both use
+	the link from sw2 to sw4.
+*/
+const split_topo = `{
+	"version": 1,
+	"switches": [ { "id": "sw1" }, { "id": "sw2" }, { "id": "sw3" }, { "id": "sw4" } ],
+	"links": [
+		{ "src": "sw1", "src_port": 1, "dst": "sw2", "dst_port": 1, "capacity": 600, "headroom": 0 },
+		{ "src": "sw1", "src_port": 2, "dst": "sw3", "dst_port": 1, "capacity": 600, "headroom": 0 },
+		{ "src": "sw3", "src_port": 2, "dst": "sw2", "dst_port": 3, "capacity": 1000, "headroom": 0 },
+		{ "src": "sw2", "src_port": 2, "dst": "sw4", "dst_port": 1, "capacity": 1000, "headroom": 0 }
+	],
+	"hosts": [
+		{ "mac": "fa:16:3e:00:00:01", "ip4": "10.0.0.1", "switch": "sw1", "port": 9 },
+		{ "mac": "fa:16:3e:00:00:02", "ip4": "10.0.0.2", "switch": "sw4", "port": 9 }
+	]
+}`
+
+/*
+	Build a network from the topology (json) written to a scratch file. If old is given the
+	new graph is a rebuild of it (links which remain keep their obligations).
+*/
+func mk_topo_net( t *testing.T, old *Network, topo string, nsw int ) ( *Network ) {
+	if net_sheep == nil {
+		net_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	}
+
+	dir, err := ioutil.TempDir( "", "tegu_net" )
+	if err != nil {
+		t.Fatalf( "unable to create scratch directory: %s", err )
+	}
+	defer os.RemoveAll( dir )
+
+	fname := path.Join( dir, "topo.json" )
+	if err = ioutil.WriteFile( fname, []byte( topo ), 0644 ); err != nil {
+		t.Fatalf( "unable to write topology: %s", err )
+	}
+
+	n := build( old, &fname, 1000, 0, 0, nil, false )
+	if n == nil || len( n.switches ) != nsw {
+		t.Fatalf( "network was not built from the topology" )
+	}
+	n.limits = make( map[string]*gizmos.Fence )
+	return n
+}
+
+/*
+	Build the network from the split topology with splitting enabled on sw1.
+*/
+func mk_split_net( t *testing.T ) ( *Network ) {
+	n := mk_topo_net( t, nil, split_topo, 4 )
+	n.Set_split( 4 )
+	n.update_split_hosts( []string{ "sw1 " + gizmos.OF_CAP_SPLIT }, nil )
+	return n
+}
+
+func Test_split_first_hop( t *testing.T ) {
+	fmt.Fprintf( os.Stderr, "\n------- split paths differ at first hop -\n" )
+	n := mk_split_net( t )
+	h1 := "10.0.0.1"
+	h2 := "10.0.0.2"
+	now := time.Now().Unix()
+
+	pcount, plist, _, _ := n.find_paths( &h1, &h2, nil, now, now + 3600, 1000, nil, nil, false, nil )
+	if pcount != 2 {
+		fmt.Fprintf( os.Stderr, "FAIL: expected the reservation to be split across two paths, have %d\n", pcount )
+		t.FailNow()
+	}
+
+	first := make( map[int]bool )
+	for _, p := range plist[:pcount] {
+		if ! p.Is_split() || p.Get_bandwidth() != 500 {
+			fmt.Fprintf( os.Stderr, "FAIL: path not split evenly: split=%v bw=%d %s\n", p.Is_split(), p.Get_bandwidth(), p.To_str() )
+			t.Fail()
+			continue
+		}
+		first[p.Get_ilink_spq( &empty_str, now ).Port] = true			// port the path leaves sw1 on
+		joined := false
+		for _, l := range p.Get_links() {
+			joined = joined || *l.Get_id() == "sw2-sw4"
+		}
+		if ! joined {
+			fmt.Fprintf( os.Stderr, "FAIL: path does not follow the network beyond the first hop: %s\n", p.To_str() )
+			t.Fail()
+		}
+	}
+	if len( first ) != 2 {
+		fmt.Fprintf( os.Stderr, "FAIL: split paths do not leave the host on different links: %v\n", first )
+		t.Fail()
+	}
+
+	if pcount, _, _, _ = n.find_paths( &h1, &h2, nil, now, now + 3600, 1100, nil, nil, false, nil ); pcount != 0 {	// shares fit their first hops, not the joined link
+		fmt.Fprintf( os.Stderr, "FAIL: split accepted with more than the joined link can carry: %d paths\n", pcount )
+		t.Fail()
+	}
+
+	n.links["sw1-sw3"].Set_excluded( true )							// drained: not a first hop choice, and left excluded
+	if pcount, _, _, _ = n.find_paths( &h1, &h2, nil, now, now + 3600, 1000, nil, nil, false, nil ); pcount != 0 {
+		fmt.Fprintf( os.Stderr, "FAIL: split used an excluded first hop: %d paths\n", pcount )
+		t.Fail()
+	}
+	if ! n.links["sw1-sw3"].Is_excluded() {
+		fmt.Fprintf( os.Stderr, "FAIL: exclusion of a drained link was cleared by the split search\n" )
+		t.Fail()
+	}
+}
+
+func Test_split_groups( t *testing.T ) {
+	fmt.Fprintf( os.Stderr, "\n------- split group allocation ---------\n" )
+	if rm_sheep == nil {
+		rm_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	}
+	n := mk_split_net( t )
+	h1 := "10.0.0.1"
+	h2 := "10.0.0.2"
+	now := time.Now().Unix()
+
+	inv := &Inventory{ cache: make( map[string]*gizmos.Pledge ) }
+	mk_split := func( name string ) ( *gizmos.Pledge_bw ) {
+		p, _ := gizmos.Mk_bw_pledge( &h1, &h2, &zero_string, &zero_string, now, now + 3600, 1000, 1000, &name, str_ptr( "cookie" ), 0, false )
+		pcount, plist, _, _ := n.find_paths( &h1, &h2, nil, now, now + 3600, 1000, nil, &empty_str, false, nil )		// split; nothing is reserved
+		p.Set_path_list( plist[:pcount] )
+		var gp gizmos.Pledge = p
+		inv.cache[name] = &gp
+		return p
+	}
+
+	key := "fa:16:3e:00:00:01"
+	p1 := mk_split( "r1" )
+	p1.Set_group( key, gizmos.Of_bw_group_id( "r2", key ) )			// holds the id that r2 would prefer
+
+	p2 := mk_split( "r2" )
+	if err := inv.alloc_bw_groups( p2, "r2" ); err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: split group not allocated: %s\n", err )
+		t.FailNow()
+	}
+	gid := p2.Get_group( key )
+	if gid == 0 || gid == p1.Get_group( key ) || gid != gizmos.Of_bw_group_next( gizmos.Of_bw_group_id( "r2", key ) ) {
+		fmt.Fprintf( os.Stderr, "FAIL: split group in use by another reservation not skipped: 0x%x\n", gid )
+		t.Fail()
+	}
+	if gid & ^gizmos.OF_GROUP_MASK != gizmos.OF_GROUP_BW {
+		fmt.Fprintf( os.Stderr, "FAIL: split group id is not in the split group range: 0x%x\n", gid )
+		t.Fail()
+	}
+
+	if inv.alloc_bw_groups( p2, "r2" ); p2.Get_group( key ) != gid {	// already allocated: kept
+		fmt.Fprintf( os.Stderr, "FAIL: allocated split group changed when allocated again\n" )
+		t.Fail()
+	}
+
+	save_ch := nw_ch
+	ch := make( chan *ipc.Chmsg, 4 )
+	nw_ch = ch
+	defer func() {
+		close( ch )
+		nw_ch = save_ch
+	}()
+	go func() {												// network manager stand in: the hosts are already addresses
+		for m := range ch {
+			m.Response_data = m.Req_data
+			m.Response_ch <- m
+		}
+	}()
+
+	frl := bw_fqreqs( p2, str_ptr( "r2" ), now, 0, false )
+	if len( frl ) == 0 || frl[0].Group != gid || len( frl[0].Split ) != 2 {
+		fmt.Fprintf( os.Stderr, "FAIL: split request does not carry the allocated group\n" )
+		t.Fail()
+	} else {
+		if m := frl[0].To_bw_map(); m["group_id"] != fmt.Sprintf( "0x%x", gid ) {
+			fmt.Fprintf( os.Stderr, "FAIL: group id not passed in the bw map: %q\n", m["group_id"] )
+			t.Fail()
+		}
+	}
+}
@@ -46,6 +46,10 @@
 
 					resmgr:res_refresh - The rate (seconds) that reservations are refreshed if hto-limit is non-zero.
 
+					resmgr:flow_expiry - Either timeout (default) or delete. When delete, flow-mods are pushed
+									without a hard timeout and are deleted (by cookie) when the reservation
+									expires; hto_limit and res_refresh are then ignored.
+
 
 	TODO:		need a way to detect when skoogie/controller has been reset meaning that all
 				pushed reservations need to be pushed again.
@@ -111,6 +115,24 @@
 						later attempt will be successful.
 				12 Apr 2016 : Added support to detect when a duplicate reservaiton should be allowed, and the previous
 						one cancelled, due to a host move.	
+				18 Oct 2026 : Added project based access to get/delete/list. Requests may carry the caller's
+						project which, when present, replaces the cookie check with an ownership check.
+				18 Oct 2026 : Pledges are marked pushed only after agent manager reports that all flow-mods were installed; failures and unacknowledged pushes are pushed again.
+				19 Oct 2026 : Added explain request.
+				19 Oct 2026 : Added resmgr:flow_expiry; when 'delete' flow-mods are pushed without a hard timeout and
+						deleted when the reservation expires (no periodic refresh).
+				19 Oct 2026 : Flow-mods of expired pledges are deleted when the push was pending as well as pushed.
+				19 Oct 2026 : Select groups of split bandwidth reservations are allocated before a push.
+				19 Oct 2026 : Bandwidth reservations using links lost from the network graph are re-pathed (REQ_TOPOCHG);
+						those which cannot be are marked degraded and retried with the vet retry tickle.
+				19 Oct 2026 : Added maintenance windows (drains); kept in the checkpoint and applied by network.
+				19 Oct 2026 : Mirror tunnel ids (erspan/vxlan) are allocated or checked for collisions when added.
+				19 Oct 2026 : Mirror bandwidth is released in the network when the mirror is deleted.
+				19 Oct 2026 : Added REQ_MIRROR_UPDATE (extend a mirror, add/remove ports).
+				19 Oct 2026 : Added resmgr:mbox_health; members of steering middlebox pools are checked by the agent
+						and those which fail are removed from the pool (REQ_MBOX_HEALTH).
+				19 Oct 2026 : Steering select groups are allocated before a push and deleted at expiry; a cancelled
+						steering reservation is expired.
 */
 
 package managers
@@ -140,15 +162,42 @@ type Inventory struct {
 	cache		map[string]*gizmos.Pledge		// cache of pledges
 	retry		map[string]*gizmos.Pledge		// pledges loaded from datacache that have not vetted
 	ulcap_cache	map[string]int					// cache of user link capacity values (max value)
+	drains		map[string]*gizmos.Drain		// maintenance windows by id
+	pend_drains	map[string]bool					// drains restored from the checkpoint which network has not yet applied
 	chkpt		*chkpt.Chkpt
 }
 
 // --- Private --------------------------------------------------------------------------
 
 /*
-	Encapsulate all of the current reservations into a single json blob.
+	Returns true if the caller is allowed to access the pledge. If project is nil the
+	legacy cookie based test is used: the cookie must match the cookie on the pledge or
+	be the super cookie.  If project is given, then access is based on ownership: the
+	pledge must have been created by the project, or project is ALL_PROJECTS (admin).
+	The super cookie is always honoured.
+*/
+func res_access_ok( p *gizmos.Pledge, cookie *string, project *string ) ( bool ) {
+	if p == nil {
+		return false
+	}
+
+	if cookie != nil && super_cookie != nil && *cookie == *super_cookie {
+		return true
+	}
+
+	if project == nil {
+		return (*p).Is_valid_cookie( cookie )
+	}
+
+	return *project == ALL_PROJECTS || (*p).Is_owned_by( project )
+}
+
+/*
+	Encapsulate all of the current reservations into a single json blob. If project is
+	not nil, only reservations owned by the project are included (unless it is the
+	all projects indicator).
 */
-func ( i *Inventory ) res2json( ) (json string, err error) {
+func ( i *Inventory ) res2json( project *string ) (json string, err error) {
 	var (
 		sep 	string = ""
 	)
@@ -157,6 +206,10 @@ func ( i *Inventory ) res2json( ) (json string, err error) {
 	json = `{ "reservations": [ `
 
 	for _, p := range i.cache {
+		if project != nil && *project != ALL_PROJECTS && ! (*p).Is_owned_by( project ) {
+			continue
+		}
+
 		if ! (*p).Is_expired( ) {
 			json += fmt.Sprintf( "%s%s", sep, (*p).To_json( ) )
 			sep = ","
@@ -237,6 +290,91 @@ func (i *Inventory) failed_push( msg *ipc.Chmsg ) {
 	}
 }
 
+/*
+	Handles the final result of a flow-mod action that agent manager sent for a pledge. When all
+	acknowledgements have been received the pledge is marked pushed; a failure resets the pledge
+	so that it is pushed again. Results for an earlier push of the pledge are ignored. Returns
+	true if the pledge needs to be pushed again.
+*/
+func (i *Inventory) push_acked( pa *push_ack ) ( bool ) {
+	if pa == nil || pa.id == nil {
+		return false
+	}
+
+	p := i.cache[*pa.id]
+	if p == nil {
+		rm_sheep.Baa( 2, "push acknowledgement for unknown reservation ignored: %s", *pa.id )
+		return false
+	}
+
+	if (*p).Push_ack( pa.gen, pa.ok ) {
+		if pa.ok {
+			rm_sheep.Baa( 1, "all flow-mods acknowledged; reservation marked pushed: %s", *pa.id )
+		} else {
+			rm_sheep.Baa( 0, "WRN: flow-mods for reservation could not be installed on %s; reservation will be pushed again: %s  [TGURMG005]", pa.host, *pa.id )
+			return true
+		}
+	}
+
+	return false
+}
+
+/*
+	Reset any pledge whose push has been waiting on acknowledgements for more than
+	secs seconds so that it is pushed again. Returns the number reset.
+*/
+func (i *Inventory) reset_stale_pushes( secs int64 ) ( n int ) {
+	for rname, p := range i.cache {
+		if p != nil && (*p).Is_push_stale( secs ) {
+			rm_sheep.Baa( 0, "WRN: flow-mods for reservation were not acknowledged in %ds; reservation will be pushed again: %s  [TGURMG006]", secs, rname )
+			(*p).Reset_pushed()
+			n++
+		}
+	}
+
+	return n
+}
+
+/*
+	Build the flow-mod requests which should be installed now; fq_mgr compares them with what
+	is installed on each host (fq_reconcile.go). Requests are built for each active bandwidth,
+	oneway and passthrough pledge which is not paused, in the same way as they are built when
+	the pledge is pushed. Requests for a pledge whose push has not been acknowledged are
+	flagged as unsettled so that its flows are kept but are not yet counted as missing.
+*/
+func (i *Inventory) rc_wants( to_limit int64, pref_v6 bool ) ( wl []*rc_want ) {
+	now := time.Now().Unix()
+	wl = make( []*rc_want, 0, len( i.cache ) )
+
+	for rname, gp := range i.cache {
+		if gp == nil || ! (*gp).Is_active() || (*gp).Is_paused() {
+			continue
+		}
+
+		name := rname
+		settled := (*gp).Is_pushed()
+		switch p := (*gp).( type ) {
+			case *gizmos.Pledge_bw:
+				for _, fr := range bw_fqreqs( p, &name, now, to_limit, pref_v6 ) {
+					wl = append( wl, &rc_want{ kind: SB_BW, data: fr, settled: settled } )
+				}
+
+			case *gizmos.Pledge_bwow:
+				for _, fr := range bwow_fqreqs( p, &name, now, to_limit, pref_v6 ) {
+					wl = append( wl, &rc_want{ kind: SB_BWOW, data: fr, settled: settled } )
+				}
+
+			case *gizmos.Pledge_pass:
+				if fr := pass_fqreq( p, &name, now, to_limit ); fr != nil {
+					wl = append( wl, &rc_want{ kind: SB_PASS, data: fr, settled: settled } )
+				}
+		}
+	}
+
+	rm_sheep.Baa( 2, "reconcile: %d flow-mod requests should be installed", len( wl ) )
+	return wl
+}
+
 /*
 	Checks to see if any reservations expired in the recent past (seconds). Returns true if there were.
 */
@@ -348,28 +486,50 @@ func (i *Inventory) push_reservations( ch chan *ipc.Chmsg, alt_table int, hto_li
 	for rname, p := range i.cache {							// run all pledges that are in the cache
 		if p != nil {
 			if (*p).Is_expired() {								// some reservations need to be explicitly undone at expiry
-				if (*p).Is_pushed() {							// no need if not pushed
+				if (*p).Is_pushed() || (*p).Is_push_pending() {	// no need if nothing was sent; pending flows may have been installed
 					switch (*p).(type) {
 						case *gizmos.Pledge_mirror: 				// mirror requests need to be undone when they become inactive
 							undo_mirror_reservation( p, rname, ch )
+
+						case *gizmos.Pledge_steer:					// select groups of middlebox pools have no timeout
+							del_steer_groups( (*p).( *gizmos.Pledge_steer ), &rname )
+
+						case *gizmos.Pledge_bw, *gizmos.Pledge_bwow, *gizmos.Pledge_pass:
+							if flow_delete {						// no hard timeout on the flow-mods; they must be deleted
+								if del_res_flows( p, &rname, pref_v6 ) > 0 {
+									i.repush_shared( rname, p )
+								}
+							}
 					}
 
 					(*p).Reset_pushed()
 				}
 			} else {
-				if ! (*p).Is_pushed() && ((*p).Is_active() || (*p).Is_active_soon( 15 )) {			// not pushed, and became active while we napped, or will activate in the next 15 seconds
+				if ! (*p).Is_pushed() && ! (*p).Is_push_pending() && ((*p).Is_active() || (*p).Is_active_soon( 15 )) {			// not pushed (or waiting on acks), and became active while we napped, or will activate in the next 15 seconds
 					switch (*p).(type) {
 						case *gizmos.Pledge_bwow:
 							bwow_push_res( p, &rname, ch, hto_limit, pref_v6 )
-							(*p).Set_pushed( )
+							if ! (*p).Is_push_pending() {
+								(*p).Set_pushed( )					// prevent looping if nothing could be sent
+							}
 
 						case *gizmos.Pledge_bw:
 							bw_push_count++
-							bw_push_res( p, &rname, ch, hto_limit, alt_table, pref_v6 )
+							if err := i.alloc_bw_groups( (*p).( *gizmos.Pledge_bw ), rname ); err != nil {
+								rm_sheep.Baa( 0, "ERR: split reservation not pushed: %s  [TGURMG013]", err )
+								(*p).Set_pushed( )					// prevent looping
+							} else {
+								bw_push_res( p, &rname, ch, hto_limit, alt_table, pref_v6 )
+							}
 
 						case *gizmos.Pledge_steer:
 							st_push_count++
-							push_st_reservation( p, rname, ch, hto_limit )
+							if err := i.alloc_steer_groups( (*p).( *gizmos.Pledge_steer ), rname ); err != nil {
+								rm_sheep.Baa( 0, "ERR: steering reservation not pushed: %s  [TGURMG012]", err )
+								(*p).Set_pushed( )					// prevent looping; tried again if a member's state changes
+							} else {
+								push_st_reservation( p, rname, ch, hto_limit )
+							}
 
 						case *gizmos.Pledge_mirror:
 							push_mirror_reservation( p, rname, ch )
@@ -393,6 +553,88 @@ func (i *Inventory) push_reservations( ch chan *ipc.Chmsg, alt_table int, hto_li
 	return pushed_count
 }
 
+/*
+	Send the requests to fq-mgr that delete the flow-mods of an expired bandwidth, oneway or
+	passthru pledge. Used only when flow-mods are pushed without a hard timeout. The requests
+	are built as they were when pushed so that they are directed to the same hosts and carry
+	the same endpoints. Returns the number of requests sent.
+*/
+func del_res_flows( gp *gizmos.Pledge, rname *string, pref_v6 bool ) ( int ) {
+	now := time.Now().Unix()
+	ops := make( []*sb_op, 0, 4 )
+
+	switch p := (*gp).(type) {
+		case *gizmos.Pledge_bw:
+			for _, fr := range bw_fqreqs( p, rname, now, 0, pref_v6 ) {
+				ops = append( ops, &sb_op{ kind: SB_BW, req: fr } )
+			}
+
+		case *gizmos.Pledge_bwow:
+			for _, fr := range bwow_fqreqs( p, rname, now, 0, pref_v6 ) {
+				ops = append( ops, &sb_op{ kind: SB_BWOW, req: fr } )
+			}
+
+		case *gizmos.Pledge_pass:
+			if fr := pass_fqreq( p, rname, now, 0 ); fr != nil {
+				ops = append( ops, &sb_op{ kind: SB_PASS, req: fr } )
+			}
+	}
+
+	if len( ops ) > 0 {
+		rm_sheep.Baa( 1, "deleting flow-mods for expired reservation: %s (%d requests)", *rname, len( ops ) )
+		msg := ipc.Mk_chmsg()
+		msg.Send_req( fq_ch, nil, REQ_FLOW_DEL, ops, nil )
+	} else {
+		rm_sheep.Baa( 1, "WRN: unable to build flow-mod delete requests for expired reservation: %s  [TGURMG008]", *rname )
+	}
+
+	return len( ops )
+}
+
+/*
+	Return the flow-mod kind and the endpoints of a bandwidth, oneway or passthru pledge. Kind is -1
+	for any other type.
+*/
+func flow_endpoints( gp *gizmos.Pledge ) ( kind int, h1 string, h2 string ) {
+	switch p := (*gp).(type) {
+		case *gizmos.Pledge_bw:
+			a1, a2, _, _, _, _, _, _ := p.Get_values( )
+			return SB_BW, *a1, *a2
+
+		case *gizmos.Pledge_bwow:
+			a1, a2, _, _, _, _ := p.Get_values( )
+			return SB_BWOW, *a1, *a2
+
+		case *gizmos.Pledge_pass:
+			a1, _, _, _, _ := p.Get_values( )
+			return SB_PASS, *a1, ""
+	}
+
+	return -1, "", ""
+}
+
+/*
+	Flow-mods are deleted by cookie and mac address(es) so deleting those for an expired pledge also
+	removes the flow-mods of any other pledge of the same type between the same endpoints. The pushed
+	flag is reset on those that are still live so that they are pushed again.
+*/
+func (i *Inventory) repush_shared( rname string, gp *gizmos.Pledge ) {
+	kind, a1, a2 := flow_endpoints( gp )
+	if kind < 0 {
+		return
+	}
+
+	for name, p := range i.cache {
+		if name != rname && p != nil && ! (*p).Is_expired() && ((*p).Is_pushed() || (*p).Is_push_pending()) {
+			k, b1, b2 := flow_endpoints( p )
+			if k == kind && ((a1 == b1 && a2 == b2) || (a1 == b2 && a2 == b1)) {
+				rm_sheep.Baa( 2, "reservation %s shares endpoints with expired reservation %s; it will be pushed again", name, rname )
+				(*p).Reset_pushed()
+			}
+		}
+	}
+}
+
 /*
 	Turn pause mode on for all current reservations and reset their push flag so that they all get pushed again.
 */
@@ -478,6 +720,14 @@ func (i *Inventory) write_chkpt( last int64 ) ( retry bool, timestamp int64 ) {
 		}
 	}
 
+	for id, d := range i.drains {								// after the reservations so that they are vetted before capacity is drained
+		if d.Is_expired() {
+			delete( i.drains, id )
+		} else {
+			fmt.Fprintf( i.chkpt, "%s\n", d.To_chkpt() )
+		}
+	}
+
 	ckpt_name, err := i.chkpt.Close( )
 	if err != nil {
 		rm_sheep.Baa( 0, "CRI: resmgr: checkpoint write failed: %s: %s  [TGURMG004]", ckpt_name, err )
@@ -551,6 +801,8 @@ func Mk_inventory( ) (inv *Inventory) {
 	inv.cache = make( map[string]*gizmos.Pledge, 4096 )		// initial size is not a limit but a hint
 	inv.retry = make( map[string]*gizmos.Pledge, 2048 )
 	inv.ulcap_cache = make( map[string]int, 64 )
+	inv.drains = make( map[string]*gizmos.Drain )
+	inv.pend_drains = make( map[string]bool )
 
 	return
 }
@@ -587,6 +839,13 @@ func (inv *Inventory) Add_res( pi interface{} ) (err error) {
 		return
 	}
 
+	if pm, ok := (*p).( *gizmos.Pledge_mirror ); ok {
+		if err = inv.mirror_tunid( pm ); err != nil {				// erspan session ids and vxlan vnis must be unique per collector
+			rm_sheep.Baa( 1, "reservation not added to inventory: %s: %s", *id, err )
+			return
+		}
+	}
+
 	inv.cache[*id] = p
 
 	rm_sheep.Baa( 1, "resgmgr: added reservation: %s", (*p).To_chkpt() )
@@ -599,8 +858,11 @@ func (inv *Inventory) Add_res( pi interface{} ) (err error) {
 	the user supplied when the reservation was created, or may be the 'super cookie' admin
 	'root' as you will, which allows access to all reservations. The return will be nil,nil
 	if it's not found; nil,state indicates an error.
+
+	If project is not nil, then the reservation must be owned by the project (project based
+	access) and the user cookie is ignored.
 */
-func (inv *Inventory) Get_res( name *string, cookie *string ) (p *gizmos.Pledge, state error) {
+func (inv *Inventory) Get_res( name *string, cookie *string, project *string ) (p *gizmos.Pledge, state error) {
 
 	state = nil
 	p = inv.cache[*name]
@@ -609,8 +871,8 @@ func (inv *Inventory) Get_res( name *string, cookie *string ) (p *gizmos.Pledge,
 		return
 	}
 
-	if ! (*p).Is_valid_cookie( cookie ) &&  *cookie != *super_cookie {
-		rm_sheep.Baa( 2, "resgmgr: denied fetch of reservation: cookie supplied (%s) didn't match that on pledge %s", *cookie, *name )
+	if ! res_access_ok( p, cookie, project ) {
+		rm_sheep.Baa( 2, "resgmgr: denied fetch of reservation: cookie/project supplied didn't match that on pledge %s", *name )
 		p = nil
 		state = fmt.Errorf( "not authorised to access or delete reservation: %s", *name )
 		return
@@ -622,9 +884,9 @@ func (inv *Inventory) Get_res( name *string, cookie *string ) (p *gizmos.Pledge,
 
 /*
 	Search the retry cache for the reservation and return if it is found and the given
-	cookie matches, or the super cookie is given.
+	cookie matches, or the super cookie is given. Project is treated as it is by Get_res().
 */
-func (inv *Inventory) Get_retry_res( name *string, cookie *string ) (p *gizmos.Pledge, state error) {
+func (inv *Inventory) Get_retry_res( name *string, cookie *string, project *string ) (p *gizmos.Pledge, state error) {
 
 	state = nil
 	p = inv.retry[*name]
@@ -633,8 +895,8 @@ func (inv *Inventory) Get_retry_res( name *string, cookie *string ) (p *gizmos.P
 		return
 	}
 
-	if ! (*p).Is_valid_cookie( cookie ) &&  *cookie != *super_cookie {
-		rm_sheep.Baa( 2, "resgmgr: denied fetch of reservation: cookie supplied (%s) didn't match that on pledge %s", *cookie, *name )
+	if ! res_access_ok( p, cookie, project ) {
+		rm_sheep.Baa( 2, "resgmgr: denied fetch of reservation: cookie/project supplied didn't match that on pledge %s", *name )
 		p = nil
 		state = fmt.Errorf( "not authorised to access or delete reservation: %s", *name )
 		return
@@ -826,16 +1088,21 @@ func (inv *Inventory) Get_mirrorlist() ( string ) {
 	the network perspective BEFORE the expiry time is reset.  If it is reset first then
 	the network splits timeslices based on the new expiry and queues end up dangling.
 */
-func (inv *Inventory) Del_res( name *string, cookie *string ) (state error) {
+func (inv *Inventory) Del_res( name *string, cookie *string, project *string ) (state error) {
 
-	gp, state := inv.Get_res( name, cookie )
+	gp, state := inv.Get_res( name, cookie, project )
 
 	if gp != nil {
 		rm_sheep.Baa( 2, "resgmgr: deleted reservation: %s", (*gp).To_str() )
 		state = nil
+		sent := (*gp).Is_pushed() || (*gp).Is_push_pending()		// flow-mods might be installed
 
 		switch p := (*gp).(type) {
 			case *gizmos.Pledge_mirror:
+				ch := make( chan *ipc.Chmsg )						// do not close -- senders close channels
+				req := ipc.Mk_chmsg( )
+				req.Send_req( nw_ch, ch, REQ_DEL, p, nil )			// release any bandwidth reserved for the mirror
+				<- ch
 				p.Set_expiry( time.Now().Unix() )					// expire the mirror NOW
 				p.Set_pushed()						// need this to force undo to occur
 
@@ -851,10 +1118,24 @@ func (inv *Inventory) Del_res( name *string, cookie *string ) (state error) {
 			case *gizmos.Pledge_pass:
 				p.Set_expiry( time.Now().Unix() + 15 )				// set the expiry to 15s from now which will force it out
 				(*gp).Reset_pushed()								// force push of flow-mods that reset the expiry
+
+			case *gizmos.Pledge_steer:
+				p.Set_expiry( time.Now().Unix() + 15 )				// flow-mods are pushed with a short timeout; groups deleted at expiry
+				(*gp).Reset_pushed()
+		}
+
+		if flow_delete {											// flow-mods have no hard timeout; expire now and let push delete them
+			switch (*gp).(type) {
+				case *gizmos.Pledge_bw, *gizmos.Pledge_bwow, *gizmos.Pledge_pass:
+					(*gp).Set_expiry( time.Now().Unix() )
+					if sent {
+						(*gp).Set_pushed()							// even if acks are outstanding something may have been installed
+					}
+			}
 		}
 	} else {
 		if state == nil {
-			gp, state = inv.Get_retry_res( name, cookie )		// see if it's in the retry cache and cookie was valid for it
+			gp, state = inv.Get_retry_res( name, cookie, project )		// see if it's in the retry cache and cookie was valid for it
 			if gp != nil {
 				// FIXME????
 				// do we need to mark and continue to retry this and after it passes vetting then let it delete by pusshing out
@@ -874,9 +1155,10 @@ func (inv *Inventory) Del_res( name *string, cookie *string ) (state error) {
 
 /*
 	delete all of the reservations provided that the cookie is the super cookie. If cookie
-	is a user cookie, then deletes all reservations that match the cookie.
+	is a user cookie, then deletes all reservations that match the cookie. If project is
+	given, then all reservations owned by the project are deleted.
 */
-func (inv *Inventory) Del_all_res( cookie *string ) ( ndel int ) {
+func (inv *Inventory) Del_all_res( cookie *string, project *string ) ( ndel int ) {
 	var	(
 		plist	[]*string			// we'll create a list to avoid deletion issues with range
 		i		int
@@ -895,7 +1177,7 @@ func (inv *Inventory) Del_all_res( cookie *string ) ( ndel int ) {
 
 	for _, pname := range plist {
 		rm_sheep.Baa( 2, "delete all attempt to delete: %s", *pname )
-		err := inv.Del_res( pname,  cookie )
+		err := inv.Del_res( pname,  cookie, project )
 		if err == nil {
 			ndel++
 			rm_sheep.Baa( 1, "delete all deleted reservation %s", *pname )
@@ -961,6 +1243,19 @@ func (inv *Inventory) yank_res( name *string ) ( p *gizmos.Pledge, state error)
 	return
 }
 
+/*
+	Get/delete requests carry an array of string pointers: name, cookie and, when access is
+	project based, the project of the caller. This returns the project, or nil if it was
+	not supplied.
+*/
+func req_project( data []*string ) ( *string ) {
+	if len( data ) > 2 {
+		return data[2]
+	}
+
+	return nil
+}
+
 /*
 	Wait and respond to RMLU_ requests received on the channel.
 	This interface is provided because agent manager wants to look up reservations
@@ -976,9 +1271,9 @@ func rm_lookup( my_chan chan *ipc.Chmsg, inv *Inventory ) {
 				t := inv.Get_mirrorlist()
 				msg.Response_data = &t;
 
-			case RMLU_GET:											// user initiated get -- requires cookie
-				data := msg.Req_data.( []*string )					// assume pointers to name and cookie
-				msg.Response_data, msg.State = inv.Get_res( data[0], data[1] )
+			case RMLU_GET:											// user initiated get -- requires cookie or project
+				data := msg.Req_data.( []*string )					// assume pointers to name, cookie and optionally project
+				msg.Response_data, msg.State = inv.Get_res( data[0], data[1], req_project( data ) )
 
 			default:
 				rm_sheep.Baa( 1, "invalid request received by rm_lookup: %d", msg.Msg_type )
@@ -1011,6 +1306,8 @@ func Res_manager( my_chan chan *ipc.Chmsg, cookie *string ) {
 		res_refresh	int64 = 0			// next time when we must force all reservations to refresh flow-mods (hto_limit nonzero)
 		rr_rate		int = 3600			// refresh rate (1 hour)
 		favour_v6 bool = true			// favour ipv6 addresses if a host has both defined.
+		push_timeout int64 = 300		// seconds a push may wait on flow-mod acknowledgements before it is pushed again
+		mbox_health int = 30			// seconds between health checks of middlebox pool members; 0 disables
 	)
 
 	super_cookie = cookie				// global for all methods
@@ -1069,6 +1366,33 @@ func Res_manager( my_chan chan *ipc.Chmsg, cookie *string ) {
 			hto_limit = clike.Atoi( *p )
 		}
 
+		p = cfg_data["resmgr"]["push_timeout"]				// max wait for flow-mod acknowledgements from agents
+		if p != nil {
+			push_timeout = int64( clike.Atoi( *p ) )
+			if push_timeout < 60 {
+				push_timeout = 60
+			}
+		}
+
+		p = cfg_data["resmgr"]["flow_expiry"]				// timeout (hard timeouts, refreshed) or delete (no timeout, deleted at expiry)
+		if p != nil {
+			switch *p {
+				case "delete":
+					flow_delete = true
+
+				case "timeout":
+					flow_delete = false
+
+				default:
+					rm_sheep.Baa( 0, "WRN: unrecognised flow_expiry value in config (%s); timeout assumed  [TGURMG007]", *p )
+			}
+		}
+
+		p = cfg_data["resmgr"]["mbox_health"]				// rate that members of middlebox pools are checked
+		if p != nil {
+			mbox_health = clike.Atoi( *p )
+		}
+
 		p = cfg_data["resmgr"]["res_refresh"]				// rate that reservations are refreshed if hto_limit is non-zero
 		if p != nil {
 			rr_rate = clike.Atoi( *p )
@@ -1086,6 +1410,10 @@ func Res_manager( my_chan chan *ipc.Chmsg, cookie *string ) {
 	send_meta_counter := 200;										// send meta f-mods only now and again
 	rm_sheep.Baa( 1, "ovs table number %d used for metadata marking", alt_table )
 
+	if flow_delete {
+		rm_sheep.Baa( 1, "reservation flow-mods are pushed without a hard timeout and deleted at expiry" )
+		hto_limit = 0												// no cap and thus no periodic refresh
+	}
 	res_refresh = time.Now().Unix() + int64( rr_rate )				// set first refresh in an hour (ignored if hto_limit not set
 	inv = Mk_inventory( )
 	inv.chkpt = chkpt.Mk_chkpt( ckptd, 10, 90 )
@@ -1097,6 +1425,9 @@ func Res_manager( my_chan chan *ipc.Chmsg, cookie *string ) {
 	tklr.Add_spot( 1, tkl_ch, REQ_SETQUEUES, nil, ipc.FOREVER )			// drives us to see if queues need to be adjusted
 	tklr.Add_spot( 5, tkl_ch, REQ_RTRY_CHKPT, nil, ipc.FOREVER )		// ensures that we retried any missed checkpoints
 	tklr.Add_spot( 60, tkl_ch, REQ_VET_RETRY, nil, ipc.FOREVER )		// run the retry queue if it has size
+	if mbox_health > 0 {
+		tklr.Add_spot( int64( mbox_health ), tkl_ch, REQ_MBOX_HEALTH, nil, ipc.FOREVER )	// check middlebox pool members
+	}
 
 	go rm_lookup( rmgrlu_ch, inv )
 
@@ -1136,29 +1467,64 @@ func Res_manager( my_chan chan *ipc.Chmsg, cookie *string ) {
 							retry_chkpt, last_chkpt = inv.write_chkpt( last_chkpt )
 						}
 
-					case REQ_DEL:											// user initiated delete -- requires cookie
-						data := msg.Req_data.( []*string )					// assume pointers to name and cookie
+					case REQ_DEL:											// user initiated delete -- requires cookie or project
+						data := msg.Req_data.( []*string )					// assume pointers to name, cookie and optionally project
 						if data[0] != nil  &&  *data[0] == "all" {
-							inv.Del_all_res( data[1] )
+							inv.Del_all_res( data[1], req_project( data ) )
 							msg.State = nil
 						} else {
-							msg.State = inv.Del_res( data[0], data[1] )
+							msg.State = inv.Del_res( data[0], data[1], req_project( data ) )
 						}
 
 						inv.push_reservations( my_chan, alt_table, int64( hto_limit ), favour_v6 )			// must force a push to push augmented (shortened) reservations
 						msg.Response_data = nil
 
+					case REQ_MIRROR_UPDATE:									// user initiated change to a mirror -- requires cookie or project
+						msg.Response_data = nil
+						if u, ok := msg.Req_data.( *mirror_update ); ok {
+							if gp, err := inv.update_mirror( u ); err == nil {
+								msg.Response_data = gp
+							} else {
+								msg.State = err
+							}
+						} else {
+							msg.State = fmt.Errorf( "internal mishap: mirror update request did not contain an update" )
+						}
+
 					case REQ_DUPCHECK:
 						if msg.Req_data != nil {
 							msg.Response_data, msg.State = inv.dup_check(  msg.Req_data.( *gizmos.Pledge ) )
 						}
 
-					case REQ_GET:											// user initiated get -- requires cookie
-						data := msg.Req_data.( []*string )					// assume pointers to name and cookie
-						msg.Response_data, msg.State = inv.Get_res( data[0], data[1] )
+					case REQ_GET:											// user initiated get -- requires cookie or project
+						data := msg.Req_data.( []*string )					// assume pointers to name, cookie and optionally project
+						msg.Response_data, msg.State = inv.Get_res( data[0], data[1], req_project( data ) )
+
+					case REQ_EXPLAIN:										// build, but don't send, the fq requests for a pledge
+						var p *gizmos.Pledge
+
+						hypo := false
+						switch data := msg.Req_data.( type ) {
+							case []*string:										// existing reservation: name, cookie and optionally project
+								p, msg.State = inv.Get_res( data[0], data[1], req_project( data ) )
 
-					case REQ_LIST:											// list reservations	(for a client)
-						msg.Response_data, msg.State = inv.res2json( )
+							case *gizmos.Pledge:								// hypothetical; not in the inventory
+								p = data
+								hypo = true
+						}
+						if msg.State == nil {
+							msg.Response_data, msg.State = explain_pledge( p, hypo, int64( hto_limit ), favour_v6, queue_gen_type )
+						}
+
+					case REQ_LIST:											// list reservations	(for a client); optional project limits the list
+						var project *string
+						if msg.Req_data != nil {
+							project = msg.Req_data.( *string )
+						}
+						msg.Response_data, msg.State = inv.res2json( project )
+
+					case REQ_RECONCILE:										// fq_mgr wants the flow-mods that should be installed now
+						msg.Response_data = inv.rc_wants( int64( hto_limit ), favour_v6 )
 
 					case REQ_LOAD:								// load from a checkpoint file
 						data := msg.Req_data.( *string )		// assume pointers to name and cookie
@@ -1190,6 +1556,10 @@ func Res_manager( my_chan chan *ipc.Chmsg, cookie *string ) {
 						last_qcheck = now
 
 					case REQ_PUSH:								// driven every few seconds to check for need to refresh because of switch max timeout setting
+						if inv.reset_stale_pushes( push_timeout ) > 0 {
+							inv.push_reservations( my_chan, alt_table, int64( hto_limit ), favour_v6 )			// retry those that were never acknowledged
+						}
+
 						if hto_limit > 0 {						// if reservation flow-mods are capped with a hard timeout limit
 							now := time.Now().Unix()
 							if now > res_refresh {
@@ -1215,6 +1585,13 @@ func Res_manager( my_chan chan *ipc.Chmsg, cookie *string ) {
 						msg.Response_ch = nil					// immediately disable to prevent loop
 						inv.failed_push( msg )					// suss out the pledge and mark it unpushed
 
+					case REQ_PUSH_ACK:							// agent or fq manager reporting the final state of a flow-mod action
+						msg.Response_ch = nil
+						pa := msg.Req_data.( *push_ack )
+						if inv.push_acked( pa ) && ! pa.local {
+							inv.push_reservations( my_chan, alt_table, int64( hto_limit ), favour_v6 )			// failed; push it again now
+						}															// local failures are left for the next push cycle rather than spinning on a broken driver
+
 					case REQ_GEN_QMAP:							// response caries the queue map that now should be sent to fq-mgr to drive a queue update
 						fallthrough
 
@@ -1241,6 +1618,54 @@ func Res_manager( my_chan chan *ipc.Chmsg, cookie *string ) {
 						if inv != nil && len( inv.retry ) > 0 {
 							inv.vet_retries( )
 						}
+						inv.apply_pend_drains( )							// after the retries so restored pledges have the capacity first
+						if inv.repath_bw( nil ) > 0 {						// only degraded pledges are tried
+							tmsg := ipc.Mk_chmsg( )
+							tmsg.Send_req( nw_ch, my_chan, queue_gen_type, time.Now().Unix(), nil )		// new queues; flow-mods pushed when the map arrives
+						}
+
+					case REQ_TOPOCHG:										// network lost links; move pledges using them
+						msg.Response_ch = nil
+						lost := msg.Req_data.( []string )
+						if n := inv.repath_bw( lost ); n > 0 {
+							rm_sheep.Baa( 1, "%d reservation(s) moved after the loss of %d link(s)", n, len( lost ) )
+							tmsg := ipc.Mk_chmsg( )
+							tmsg.Send_req( nw_ch, my_chan, queue_gen_type, time.Now().Unix(), nil )
+						}
+
+					case REQ_DRAIN:											// add a maintenance window; response is the report of affected reservations
+						dr := msg.Req_data.( *drain_req )
+						lids, err := inv.add_drain( dr.d )
+						msg.State = err
+						if err == nil {
+							rm_sheep.Baa( 1, "%s scheduled; %d link(s) covered", dr.d, len( lids ) )
+							r, moved := inv.drain_report( dr.d, lids, dr.repath )
+							msg.Response_data = r
+							if moved > 0 {
+								tmsg := ipc.Mk_chmsg( )
+								tmsg.Send_req( nw_ch, my_chan, queue_gen_type, time.Now().Unix(), nil )		// new queues; flow-mods pushed when the map arrives
+							}
+							retry_chkpt, last_chkpt = inv.write_chkpt( last_chkpt )
+						}
+
+					case REQ_UNDRAIN:
+						msg.State = inv.del_drain( *(msg.Req_data.( *string )) )
+						if msg.State == nil {
+							retry_chkpt, last_chkpt = inv.write_chkpt( last_chkpt )
+						}
+
+					case REQ_LISTDRAINS:
+						msg.Response_data = inv.drain_list( )
+
+					case REQ_MBOX_HEALTH:									// tickle to check pool members, or the results from the agent
+						msg.Response_ch = nil
+						if msg.Req_data == nil {
+							inv.mbox_health_check( )
+						} else {
+							if n := inv.mbox_health( msg.Req_data.( []string ) ); n > 0 {
+								rm_sheep.Baa( 1, "middlebox pool membership changed in %d steering reservation(s)", n )
+							}
+						}
 
 					case REQ_YANK_RES:										// yank a reservation from the inventory returning the pledge and allowing flow-mods to purge
 						if msg.Response_ch != nil {
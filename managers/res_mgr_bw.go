@@ -35,11 +35,20 @@
 						a reservation.
 				06 Mar 2016 - Don't send channel to fq-mgr as it only ever responded to requests
 						sent to skoogi.
+				18 Oct 2026 - Pledges are marked push pending until the agent acknowledges each flow-mod request.
+				19 Oct 2026 - Requests carry the pledge's push generation.
+				19 Oct 2026 - Split flow-mod request building from the push functions so that reconcile and explain can use it.
+				19 Oct 2026 - Requests are flagged for no hard timeout when flow-mods are deleted at expiry.
+				19 Oct 2026 - Requests carry the switch/port of their queue so that each direction is metered apart.
+				19 Oct 2026 - Paths of a split reservation are combined into one request with a split list
+					and the group allocated to the split (alloc_bw_groups).
+				19 Oct 2026 - Added repath_bw to move pledges off of links lost from the network graph.
 */
 
 package managers
 
 import (
+	"fmt"
 	"strings"
 	"time"
 
@@ -74,12 +83,6 @@ import (
 	If pref_ip6 is true, then if a host has both v4 and v6 addresses we will use the v6 address.
 */
 func bw_push_res( gp *gizmos.Pledge, rname *string, ch chan *ipc.Chmsg, to_limit int64, alt_table int, pref_v6 bool ) {
-	var (
-		msg		*ipc.Chmsg
-	)
-
-	now := time.Now().Unix()
-
 	p, ok :=  (*gp).( *gizmos.Pledge_bw )		// generic pledge better be a bw pledge!
 	if ! ok {
 		rm_sheep.Baa( 1, "internal error in push_bw_reservation: pledge isn't a bandwidth pledge" )
@@ -87,92 +90,195 @@ func bw_push_res( gp *gizmos.Pledge, rname *string, ch chan *ipc.Chmsg, to_limit
 		return
 	}
 
+	h1, h2, _, _, _, expiry, _, _ := p.Get_values( )
+	frlist := bw_fqreqs( p, rname, time.Now().Unix(), to_limit, pref_v6 )
+	if frlist == nil {
+		return
+	}
+
+	gen := p.Set_push_pending( len( frlist ) )		// pushed only after each request is acknowledged
+	for i, cfreq := range frlist {
+		cfreq.Pgen = gen
+		rm_sheep.Baa( 1, "res_mgr/push_rea: forward endpoint flow-mods for path %d: %s flag=%s tptyp=%s VMs=%s,%s dir=%s->%s tpsport=%s  tpdport=%s  spq=%s/%d/%d ext=%s exp/fm_exp=%d/%d",
+			i, *rname, *cfreq.Exttyp, *cfreq.Tptype, *h1, *h2, *cfreq.Match.Ip1, *cfreq.Match.Ip2, *cfreq.Match.Tpsport, *cfreq.Match.Tpdport,
+			cfreq.Espq.Switch, cfreq.Espq.Port, cfreq.Espq.Queuenum, *cfreq.Extip, expiry, cfreq.Expiry )
+
+		msg := ipc.Mk_chmsg()
+		msg.Send_req( fq_ch, nil, REQ_BW_RESERVE, cfreq, nil )					// queue work with fq-manger to send cmds for bandwidth f-mod setup
+
+		// WARNING:  this is q-lite only -- there is no attempt to set up intermediate switches!
+	}
+}
+
+/*
+	Return the key of the split group for the path: the mac of the host where the path starts.
+	Both paths of a split direction start at the same host and the two directions differ.
+*/
+func split_key( pth *gizmos.Path ) ( string ) {
+	if m := pth.Get_h1().Get_mac(); m != nil {
+		return *m
+	}
+	return ""
+}
+
+/*
+	Allocate a select group for each split direction of the bandwidth pledge which doesn't have
+	one. The preferred id is a hash of the reservation name and direction; if another live
+	reservation already uses it the next free id is taken. Returns an error if the split group
+	range is exhausted.
+*/
+func (inv *Inventory) alloc_bw_groups( p *gizmos.Pledge_bw, rname string ) ( err error ) {
+	need := make( []string, 0, 2 )
+	for _, pth := range p.Get_path_list() {
+		if pth.Is_split() && p.Get_group( split_key( pth ) ) == 0 {
+			need = append( need, split_key( pth ) )
+		}
+	}
+	if len( need ) == 0 {
+		return nil
+	}
+
+	used := make( map[uint32]bool )
+	for _, gp := range inv.cache {
+		bp, ok := (*gp).( *gizmos.Pledge_bw )
+		if ! ok || bp.Is_expired() {
+			continue
+		}
+		for _, gid := range bp.Get_groups() {
+			used[gid] = true
+		}
+	}
+
+	for _, key := range need {
+		if p.Get_group( key ) != 0 {								// both paths of a direction have the same key
+			continue
+		}
+
+		gid := gizmos.Of_bw_group_id( rname, key )
+		for n := uint32( 0 ); used[gid]; n++ {
+			if n > gizmos.OF_GROUP_MASK {
+				return fmt.Errorf( "no free split group ids for reservation %s", rname )
+			}
+			gid = gizmos.Of_bw_group_next( gid )
+		}
+		used[gid] = true
+		p.Set_group( key, gid )
+		rm_sheep.Baa( 2, "split reservation %s: group 0x%x assigned to paths from %s", rname, gid, key )
+	}
+
+	return nil
+}
+
+/*
+	Build the fq-mgr requests needed to push a bandwidth pledge: one per path and transport protocol.
+	The paths of a reservation split across paths (same hosts, each with a share of the bandwidth)
+	are combined into one request which lists the port, queue and share of each, and carries the
+	select group allocated to them.
+	Used to push the reservation, to reconcile what is installed and to explain it, so nothing is
+	sent from here. Now is the time used to select queues and cap the expiry (the current time
+	unless explaining a reservation that has not started). Returns nil if either host cannot be
+	mapped to an IP address.
+*/
+func bw_fqreqs( p *gizmos.Pledge_bw, rname *string, now int64, to_limit int64, pref_v6 bool ) ( frlist []*Fq_req ) {
 	h1, h2, p1, p2, _, expiry, _, _ := p.Get_values( )		// hosts, transport (tcp/udp) ports and expiry are all we need
 	v1, v2 := p.Get_vlan( )									// vlan match criteria for one/both endpoints
 
 	ip1 := name2ip( h1 )
 	ip2 := name2ip( h2 )
 
-	if ip1 != nil  &&  ip2 != nil {				// good ip addresses so we're good to go
-		plist := p.Get_path_list( )				// each path that is a part of the reservation
+	if ip1 == nil  ||  ip2 == nil {
+		return nil
+	}
 
-		timestamp := time.Now().Unix() + 16					// assume this will fall within the first few seconds of the reservation as we use it to find queue in timeslice
+	frlist = make( []*Fq_req, 0, 4 )
+	plist := p.Get_path_list( )							// each path that is a part of the reservation
 
-		for i := range plist { 								// for each path, send fmgr requests for each endpoint
-			freq := Mk_fqreq( rname )						// default flow mod request with empty match/actions (for bw requests, we don't need priority or such things)
+	timestamp := now + 16								// assume this will fall within the first few seconds of the reservation as we use it to find queue in timeslice
 
-			freq.Ipv6 = p.Get_matchv6()						// should we force a match on IPv6 rather than IPv4?
-			freq.Cookie =	0xffff							// should be ignored, if we see this out there we've got problems
-			freq.Single_switch = false						// path involves multiple switches by default
-			freq.Dscp, freq.Dscp_koe = p.Get_dscp()			// reservation supplied dscp value that we're to match and maybe preserve on exit
+	for i := 0; i < len( plist ); i++ { 				// for each path, build fmgr requests for each endpoint
+		freq := Mk_fqreq( rname )						// default flow mod request with empty match/actions (for bw requests, we don't need priority or such things)
 
-			if (*p).Is_paused( ) {
-				freq.Expiry = time.Now().Unix( ) +  15		// if reservation shows paused, then we set the expiration to 15s from now  which should force the flow-mods out
-			} else {
-				if to_limit > 0 && expiry > now + to_limit {
-					freq.Expiry = now + to_limit			// expiry must be capped so as not to overflow virtual switch variable size
-				} else {
-					freq.Expiry = expiry
-				}
-			}
-			freq.Id = rname
+		freq.Ipv6 = p.Get_matchv6()						// should we force a match on IPv6 rather than IPv4?
+		freq.Cookie =	0xffff							// should be ignored, if we see this out there we've got problems
+		freq.Single_switch = false						// path involves multiple switches by default
+		freq.Dscp, freq.Dscp_koe = p.Get_dscp()			// reservation supplied dscp value that we're to match and maybe preserve on exit
 
-			extip := plist[i].Get_extip()					// if an external IP address is necessary on the freq get it
-			if extip != nil {
-				freq.Extip = extip
+		if (*p).Is_paused( ) {
+			freq.Expiry = time.Now().Unix( ) +  15		// if reservation shows paused, then we set the expiration to 15s from now  which should force the flow-mods out
+		} else {
+			freq.No_hto = flow_delete						// flow-mods are deleted at expiry rather than timing out
+			if ! flow_delete && to_limit > 0 && expiry > now + to_limit {
+				freq.Expiry = now + to_limit			// expiry must be capped so as not to overflow virtual switch variable size
 			} else {
-				freq.Extip = &empty_str
+				freq.Expiry = expiry
 			}
+		}
+		freq.Id = rname
 
-			espq1, _ := plist[i].Get_endpoint_spq( rname, timestamp )		// end point switch, port, queue information; ep1 nil if single switch
-			if espq1 == nil {												// if single switch ep1 will be nil
-				freq.Single_switch = true
-			}
+		extip := plist[i].Get_extip()					// if an external IP address is necessary on the freq get it
+		if extip != nil {
+			freq.Extip = extip
+		} else {
+			freq.Extip = &empty_str
+		}
 
-			freq.Match.Ip1 = plist[i].Get_h1().Get_address( pref_v6 )		// must use path h1/h2 as this could be the reverse with respect to the overall pledge and thus reverse of pledge
-			freq.Match.Ip2 = plist[i].Get_h2().Get_address( pref_v6 )
-			freq.Espq = plist[i].Get_ilink_spq( rname, timestamp )			// spq info comes from the first link off of the switch, not the endpoint link back to the VM
-			if freq.Single_switch {
-				freq.Espq.Queuenum = 1										// same switch always over br-rl queue 1
-			}
-			freq.Exttyp = plist[i].Get_extflag()		// indicates whether the external IP is the source or dest along this path
+		espq1, _ := plist[i].Get_endpoint_spq( rname, timestamp )		// end point switch, port, queue information; ep1 nil if single switch
+		if espq1 == nil {												// if single switch ep1 will be nil
+			freq.Single_switch = true
+		}
 
-			tptype_list := p.Get_proto()								// pick up protocol supplied on the reservation
-			if (*p1 != "0" || *p2 != "0") && *tptype_list == "" {		// if either port is specified, and no specific proto on reservation
-				tpl := "udp tcp"										// if port supplied, generate f-mods for both udp and tcp matches on the port
-				tptype_list = &tpl
+		freq.Match.Ip1 = plist[i].Get_h1().Get_address( pref_v6 )		// must use path h1/h2 as this could be the reverse with respect to the overall pledge and thus reverse of pledge
+		freq.Match.Ip2 = plist[i].Get_h2().Get_address( pref_v6 )
+		freq.Espq = plist[i].Get_ilink_spq( rname, timestamp )			// spq info comes from the first link off of the switch, not the endpoint link back to the VM
+		freq.Qport = plist[i].Get_ilink_qport( )						// the queue's switch/port; each direction has its own meter
+		if plist[i].Is_split() {										// combine this and following paths with the same hosts
+			freq.Split = make( []string, 0, 4 )
+			freq.Group = p.Get_group( split_key( plist[i] ) )			// allocated when pushed (alloc_bw_groups)
+			var big int64 = 0
+			j := i
+			for ; j < len( plist ) && plist[j].Is_split() && plist[j].Get_h1() == plist[i].Get_h1() && plist[j].Get_h2() == plist[i].Get_h2(); j++ {
+				spq := plist[j].Get_ilink_spq( rname, timestamp )
+				freq.Split = append( freq.Split, fmt.Sprintf( "%d/%d/%d", spq.Port, spq.Queuenum, plist[j].Get_bandwidth() ) )
+				if plist[j].Get_bandwidth() > big {
+					big = plist[j].Get_bandwidth()
+					freq.Espq = spq											// largest share's switch/queue identify the request
+					freq.Qport = plist[j].Get_ilink_qport( )
+				}
 			}
-			tptype_toks := strings.Split( *tptype_list, " " )
-
-			for tidx := range( tptype_toks ) {				// must have a req for each transport proto type, clone base, add the proto specific changes, & send to fqmgr
-				cfreq := freq.Clone()						// since we send this off for asynch processing we must make a copy
+			i = j - 1
+		}
+		if freq.Single_switch {
+			freq.Espq.Queuenum = 1										// same switch always over br-rl queue 1
+		}
+		freq.Exttyp = plist[i].Get_extflag()		// indicates whether the external IP is the source or dest along this path
 
-				cfreq.Tptype = &tptype_toks[tidx]			// transport type (tcp, udp or none)
+		tptype_list := p.Get_proto()								// pick up protocol supplied on the reservation
+		if (*p1 != "0" || *p2 != "0") && *tptype_list == "" {		// if either port is specified, and no specific proto on reservation
+			tpl := "udp tcp"										// if port supplied, generate f-mods for both udp and tcp matches on the port
+			tptype_list = &tpl
+		}
+		tptype_toks := strings.Split( *tptype_list, " " )
 
-				if *cfreq.Exttyp == "-S" {					// indicates that this is a 'reverse' path (h2 sending) and we must invert the Tp port numbers and vland ids
-					cfreq.Match.Tpsport= p2
-					cfreq.Match.Tpdport= p1
-					cfreq.Match.Vlan_id= v2
-				} else {
-					cfreq.Match.Tpsport= p1
-					cfreq.Match.Tpdport= p2
-					cfreq.Match.Vlan_id= v1
-				}
+		for tidx := range( tptype_toks ) {				// must have a req for each transport proto type, clone base, add the proto specific changes
+			cfreq := freq.Clone()						// since it is sent off for asynch processing we must make a copy
 
-				rm_sheep.Baa( 1, "res_mgr/push_rea: forward endpoint flow-mods for path %d: %s flag=%s tptyp=%s VMs=%s,%s dir=%s->%s tpsport=%s  tpdport=%s  spq=%s/%d/%d ext=%s exp/fm_exp=%d/%d",
-					i, *rname, *cfreq.Exttyp, tptype_toks[tidx], *h1, *h2, *cfreq.Match.Ip1, *cfreq.Match.Ip2, *cfreq.Match.Tpsport, *cfreq.Match.Tpdport,
-					cfreq.Espq.Switch, cfreq.Espq.Port, cfreq.Espq.Queuenum, *cfreq.Extip, expiry, cfreq.Expiry )
+			cfreq.Tptype = &tptype_toks[tidx]			// transport type (tcp, udp or none)
 
-				msg = ipc.Mk_chmsg()
-				msg.Send_req( fq_ch, nil, REQ_BW_RESERVE, cfreq, nil )					// queue work with fq-manger to send cmds for bandwidth f-mod setup
-				
-	
-				// WARNING:  this is q-lite only -- there is no attempt to set up intermediate switches!
+			if *cfreq.Exttyp == "-S" {					// indicates that this is a 'reverse' path (h2 sending) and we must invert the Tp port numbers and vland ids
+				cfreq.Match.Tpsport= p2
+				cfreq.Match.Tpdport= p1
+				cfreq.Match.Vlan_id= v2
+			} else {
+				cfreq.Match.Tpsport= p1
+				cfreq.Match.Tpdport= p2
+				cfreq.Match.Vlan_id= v1
 			}
-		}
 
-		p.Set_pushed()				// safe to mark the pledge as having been pushed.
+			frlist = append( frlist, cfreq )
+		}
 	}
+
+	return frlist
 }
 
 
@@ -190,11 +296,6 @@ func bw_push_res( gp *gizmos.Pledge, rname *string, ch chan *ipc.Chmsg, to_limit
 		from the switch.
 */
 func bwow_push_res( gp *gizmos.Pledge, rname *string, ch chan *ipc.Chmsg, to_limit int64, pref_v6 bool ) {
-	var (
-		msg		*ipc.Chmsg
-	)
-
-	now := time.Now().Unix()
 	p, ok :=  (*gp).( *gizmos.Pledge_bwow )		// generic pledge better be a bw oneway pledge!
 	if ! ok {
 		rm_sheep.Baa( 1, "internal mishap in push_bwow_res: pledge isn't a oneway pledge" )
@@ -202,72 +303,172 @@ func bwow_push_res( gp *gizmos.Pledge, rname *string, ch chan *ipc.Chmsg, to_lim
 		return
 	}
 
+	src, dest, _, _, _, expiry  := p.Get_values( )
+	frlist := bwow_fqreqs( p, rname, time.Now().Unix(), to_limit, pref_v6 )
+	if frlist == nil {
+		rm_sheep.Baa( 1, "oneway not pushed: could not map one/both hosts to an IP address" )
+		return
+	}
+
+	gen := p.Set_push_pending( len( frlist ) )		// pushed only after each request is acknowledged
+	for _, cfreq := range frlist {
+		cfreq.Pgen = gen
+		ip2_str := ""
+		if cfreq.Match.Ip2 != nil {
+			ip2_str = *cfreq.Match.Ip2
+		}
+		rm_sheep.Baa( 1, "res_mgr/push_bwow: flag=%s tptyp=%s VMs=%s,%s dir=%s->%s tpsport=%s  tpdport=%s  spq=%s/%d/%d exp/fm_exp=%d/%d",
+			*rname, *cfreq.Tptype, *src, *dest, *cfreq.Match.Ip1, ip2_str, *cfreq.Match.Tpsport, *cfreq.Match.Tpdport,
+			cfreq.Espq.Switch, cfreq.Espq.Port, cfreq.Espq.Queuenum, expiry, cfreq.Expiry )
+
+		msg := ipc.Mk_chmsg()
+		msg.Send_req( fq_ch, nil, REQ_BWOW_RESERVE, cfreq, nil )					// queue work with fq-manger to send cmds for bandwidth f-mod setup
+	}
+}
+
+/*
+	Build the fq-mgr requests for a oneway pledge (one per transport protocol); see bw_fqreqs.
+	Returns nil if the hosts cannot be mapped. The list is empty if the pledge has no gate.
+*/
+func bwow_fqreqs( p *gizmos.Pledge_bwow, rname *string, now int64, to_limit int64, pref_v6 bool ) ( frlist []*Fq_req ) {
 	src, dest, src_tpport, dest_tpport, _, expiry  := p.Get_values( )		// hosts, transport ports, and expiry time
 	vlan := p.Get_vlan( )													// vlan match criteria for source
 
 	ip_src := name2ip( src )
 	ip_dest := name2ip( dest )
 
-	if ip_src != nil  &&  ip_dest != nil {				// good ip addresses so we're good to go
-		gate := p.Get_gate( )							// get the gate information that is applied for the oneway
-		if gate != nil {								// be parinoid
-			//timestamp := time.Now().Unix() + 16				// assume this will fall within the first few seconds of the reservation as we use it to find queue in timeslice
-			freq := Mk_fqreq( rname )						// default flow mod request no match/actions
-
-			freq.Ipv6 = p.Get_matchv6()						// should we force a match on IPv6 rather than IPv4?
-			freq.Cookie =	0xffff							// should be ignored, if we see this out there we've got problems
-			freq.Single_switch = true						// implied with a oneway, but set it anyway
-			freq.Dscp = p.Get_dscp()						// reservation supplied dscp value that we're to match (koe is meaningless in one way)
-			freq.Dscp_koe = false							// meaningless for oneway, but ensure it's false so flag isn't accidently set later
+	if ip_src == nil  ||  ip_dest == nil {
+		return nil
+	}
 
-			if (*p).Is_paused( ) {
-				freq.Expiry = time.Now().Unix( ) +  15		// if reservation shows paused, then we set the expiration to 15s from now  which should force existing flow-mods out
+	frlist = make( []*Fq_req, 0, 2 )
+	gate := p.Get_gate( )							// get the gate information that is applied for the oneway
+	if gate != nil {								// be parinoid
+		freq := Mk_fqreq( rname )						// default flow mod request no match/actions
+
+		freq.Ipv6 = p.Get_matchv6()						// should we force a match on IPv6 rather than IPv4?
+		freq.Cookie =	0xffff							// should be ignored, if we see this out there we've got problems
+		freq.Single_switch = true						// implied with a oneway, but set it anyway
+		freq.Dscp = p.Get_dscp()						// reservation supplied dscp value that we're to match (koe is meaningless in one way)
+		freq.Dscp_koe = false							// meaningless for oneway, but ensure it's false so flag isn't accidently set later
+
+		if (*p).Is_paused( ) {
+			freq.Expiry = time.Now().Unix( ) +  15		// if reservation shows paused, then we set the expiration to 15s from now  which should force existing flow-mods out
+		} else {
+			freq.No_hto = flow_delete						// flow-mods are deleted at expiry rather than timing out
+			if ! flow_delete && to_limit > 0 && expiry > now + to_limit {
+				freq.Expiry = now + to_limit			// expiry must be capped so as not to overflow virtual switch variable size
 			} else {
-				if to_limit > 0 && expiry > now + to_limit {
-					freq.Expiry = now + to_limit			// expiry must be capped so as not to overflow virtual switch variable size
-				} else {
-					freq.Expiry = expiry
-				}
+				freq.Expiry = expiry
 			}
-			freq.Id = rname
+		}
+		freq.Id = rname
+
+		freq.Match.Ip1 = gate.Get_src().Get_address( pref_v6 )		// should match pledge, but gate is the ultimate authority
+		freq.Match.Ip2 = gate.Get_dest().Get_address( pref_v6 )
+		freq.Espq = gate.Get_spq( rname, now + 16 )					// switch port queue
+		freq.Qport = gate.Get_qport( )
+		freq.Extip = gate.Get_extip( )								// returns nil if not an external and that's what we need
+
+		tptype_list := p.Get_proto()											// pick up protocol supplied on the reservation
+		if (*src_tpport != "0" || *dest_tpport != "0") && *tptype_list == ""  {	// if port supplied we must set proto; default to both if
+			tpl := "udp tcp"												// user didn't supply one
+			tptype_list = &tpl
+		}
+		tptype_toks := strings.Split( *tptype_list, " " )
 
-			freq.Match.Ip1 = gate.Get_src().Get_address( pref_v6 )		// should match pledge, but gate is the ultimate authority
-			freq.Match.Ip2 = gate.Get_dest().Get_address( pref_v6 )
-			freq.Espq = gate.Get_spq( rname, now + 16 )					// switch port queue
-			freq.Extip = gate.Get_extip( )								// returns nil if not an external and that's what we need
+		for tidx := range( tptype_toks ) {				// must have a req for each transport proto type, clone base, add the proto specific changes
+			cfreq := freq.Clone()						// since it is sent off for asynch processing we must make a copy
 
-			tptype_list := p.Get_proto()											// pick up protocol supplied on the reservation
-			if (*src_tpport != "0" || *dest_tpport != "0") && *tptype_list == ""  {	// if port supplied we must set proto; default to both if
-				tpl := "udp tcp"												// user didn't supply one
-				tptype_list = &tpl
-			}
-			tptype_toks := strings.Split( *tptype_list, " " )
+			cfreq.Tptype = &tptype_toks[tidx]			// transport type (tcp, udp or none)
 
-			for tidx := range( tptype_toks ) {				// must have a req for each transport proto type, clone base, add the proto specific changes, & send to fqmgr
-				cfreq := freq.Clone()						// since we send this off for asynch processing we must make a copy
+			cfreq.Match.Tpsport= src_tpport
+			cfreq.Match.Tpdport= dest_tpport
+			cfreq.Match.Vlan_id= vlan
 
-				cfreq.Tptype = &tptype_toks[tidx]			// transport type (tcp, udp or none)
+			frlist = append( frlist, cfreq )
+		}
+	}
 
-				cfreq.Match.Tpsport= src_tpport
-				cfreq.Match.Tpdport= dest_tpport
-				cfreq.Match.Vlan_id= vlan
+	return frlist
+}
 
-				ip2_str := ""
-				if cfreq.Match.Ip2 != nil {
-					ip2_str = *cfreq.Match.Ip2
-				}
-				rm_sheep.Baa( 1, "res_mgr/push_bwow: flag=%s tptyp=%s VMs=%s,%s dir=%s->%s tpsport=%s  tpdport=%s  spq=%s/%d/%d exp/fm_exp=%d/%d",
-					*rname, tptype_toks[tidx], *src, *dest, *cfreq.Match.Ip1, ip2_str, *cfreq.Match.Tpsport, *cfreq.Match.Tpdport,
-					cfreq.Espq.Switch, cfreq.Espq.Port, cfreq.Espq.Queuenum, expiry, cfreq.Expiry )
+/*
+	Send the re-path requests to network manager in a single request and wait for it to fill
+	in the results. An error is returned only if network could not process the request.
+*/
+func repath_send( rl []*repath_req ) ( error ) {
+	if len( rl ) == 0 {
+		return nil
+	}
 
-				msg = ipc.Mk_chmsg()
-				msg.Send_req( fq_ch, nil, REQ_BWOW_RESERVE, cfreq, nil )					// queue work with fq-manger to send cmds for bandwidth f-mod setup
-				
-			}
+	my_ch := make( chan *ipc.Chmsg )						// do not close -- senders close channels
+	req := ipc.Mk_chmsg( )
+	req.Send_req( nw_ch, my_ch, REQ_REPATH, rl, nil )
+	req = <- my_ch
+
+	return req.State
+}
+
+/*
+	Move bandwidth pledges off of links that are no longer in the network graph. Pledges whose
+	paths use a link in the lost list, and any pledge already marked degraded, are sent to network
+	manager (all in one request) which releases the current paths and finds new ones for each
+	pledge's window. A pledge which is moved is marked unpushed so that its flow-mods are sent again
+	(with the queues of the new paths). A pledge which cannot be moved keeps its paths (flow-mods
+	are left in place) and is marked degraded; it is tried again on each call. Returns the number
+	of pledges moved.
+*/
+func (inv *Inventory) repath_bw( lost []string ) ( moved int ) {
+	ids := make( map[string]bool, len( lost ) )
+	for _, id := range lost {
+		ids[id] = true
+	}
+
+	names := make( []string, 0 )
+	rl := make( []*repath_req, 0 )
+	for rname, gp := range inv.cache {
+		p, ok := (*gp).( *gizmos.Pledge_bw )
+		if ! ok || p.Is_expired() {
+			continue
+		}
+		if p.Get_degraded() == "" && ! p.Uses_links( ids ) {
+			continue
 		}
 
-		p.Set_pushed()				// safe to mark the pledge as having been pushed.
-	} else {
-		rm_sheep.Baa( 1, "oneway not pushed: could not map one/both hosts to an IP address" )
+		names = append( names, rname )
+		rl = append( rl, &repath_req{ p: p } )
+	}
+
+	if err := repath_send( rl ); err != nil {
+		rm_sheep.Baa( 1, "unable to re-path %d reservation(s): %s", len( rl ), err )
+		return 0
 	}
+
+	for i, rr := range rl {
+		p := rr.p
+		rname := names[i]
+		switch {
+			case rr.err != nil:
+				if p.Get_degraded() == "" {					// announce only when it first becomes degraded
+					rm_sheep.Baa( 0, "WRN: reservation uses links no longer in the network and could not be moved; marked degraded: %s: %s  [TGURMG009]", rname, rr.err )
+				}
+				p.Set_degraded( rr.err.Error() )
+
+			case rr.paths != nil:
+				p.Set_path_list( rr.paths )
+				p.Set_degraded( "" )
+				p.Reset_pushed( )							// push again with the new queues
+				moved++
+				rm_sheep.Baa( 1, "reservation moved to new path(s) following a topology change: %s", rname )
+
+			default:										// network has the original paths back
+				if p.Get_degraded() != "" {
+					rm_sheep.Baa( 1, "links used by degraded reservation have returned; no longer degraded: %s", rname )
+					p.Set_degraded( "" )
+				}
+		}
+	}
+
+	return moved
 }
@@ -0,0 +1,241 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+
+	Mnemonic:	res_mgr_drain
+	Abstract:	Reservation manager functions that support maintenance windows (drains). The
+				reservation manager keeps the drains so that they are written to, and restored
+				from, the checkpoint; network manager applies them to the graph. When a drain is
+				added a report of the reservations whose window overlaps the drain and which use
+				the drained links (oneway reservations whose gate is on a drained switch or host)
+				is generated. Bandwidth reservations may optionally be moved to paths which do
+				not use the drained links.
+
+	Date:		19 Oct 2026
+*/
+
+package managers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	Request (from http manager) to add a drain.
+*/
+type drain_req struct {
+	d		*gizmos.Drain
+	repath	bool				// move affected bandwidth reservations off of the drained links
+}
+
+/*
+	Pass the drain to network manager to apply and save it if network accepted it. Returns
+	the ids of the links covered.
+*/
+func (inv *Inventory) add_drain( d *gizmos.Drain ) ( ids []string, err error ) {
+	my_ch := make( chan *ipc.Chmsg )						// do not close -- senders close channels
+	req := ipc.Mk_chmsg( )
+	req.Send_req( nw_ch, my_ch, REQ_DRAIN, d, nil )
+	req = <- my_ch
+
+	if req.State != nil {
+		return nil, req.State
+	}
+
+	inv.drains[d.Get_id()] = d
+	delete( inv.pend_drains, d.Get_id() )
+	return req.Response_data.( []string ), nil
+}
+
+/*
+	Pass the drains restored from the checkpoint to network manager. Called once the restored
+	pledges have been vetted (a drain applied first would take capacity that the pledges held
+	when the checkpoint was written). A drain that network does not accept (the graph might
+	not yet be built, or does not yet have the drained links) is kept and tried again the next
+	time; one whose window has passed is dropped.
+*/
+func (inv *Inventory) apply_pend_drains( ) {
+	for id := range inv.pend_drains {
+		d := inv.drains[id]
+		if d == nil || d.Is_expired() {
+			delete( inv.drains, id )
+			delete( inv.pend_drains, id )
+			continue
+		}
+
+		if lids, err := inv.add_drain( d ); err == nil {
+			rm_sheep.Baa( 1, "drain from checkpoint applied: %s; %d link(s) covered", d, len( lids ) )
+		} else {
+			rm_sheep.Baa( 2, "drain from checkpoint not yet applied: %s", err )
+		}
+	}
+}
+
+/*
+	Cancel the drain returning the capacity to the links.
+*/
+func (inv *Inventory) del_drain( id string ) ( err error ) {
+	if inv.drains[id] == nil {
+		return fmt.Errorf( "no such drain: %s", id )
+	}
+	if inv.pend_drains[id] {							// never given to network
+		delete( inv.pend_drains, id )
+		delete( inv.drains, id )
+		return nil
+	}
+
+	my_ch := make( chan *ipc.Chmsg )
+	req := ipc.Mk_chmsg( )
+	req.Send_req( nw_ch, my_ch, REQ_UNDRAIN, &id, nil )
+	req = <- my_ch
+
+	delete( inv.drains, id )
+	return req.State
+}
+
+/*
+	Generate the json report of the reservations affected by the drain. Ids are the links
+	that the drain covers. If repath is true, affected bandwidth reservations are moved to
+	paths which avoid the drained links when possible (network is sent one request for all of
+	them); the action taken is given for each. Returns the report and the number of reservations moved.
+*/
+func (inv *Inventory) drain_report( d *gizmos.Drain, ids []string, repath bool ) ( jstr string, moved int ) {
+	lids := make( map[string]bool, len( ids ) )
+	for _, id := range ids {
+		lids[id] = true
+	}
+
+	names := make( []string, 0, len( inv.cache ) )
+	for name := range inv.cache {
+		names = append( names, name )
+	}
+	sort.Strings( names )
+
+	jlinks := make( []string, len( ids ) )
+	for i, id := range ids {
+		jlinks[i] = fmt.Sprintf( "%q", id )
+	}
+
+	affected := make( []string, 0 )							// names of affected reservations, their type and the re-path request if moving
+	ptypes := make( map[string]string )
+	rreqs := make( map[string]*repath_req )
+	rl := make( []*repath_req, 0 )
+	for _, name := range names {
+		gp := inv.cache[name]
+		if gp == nil || (*gp).Is_expired() || ! d.Overlaps( (*gp).Get_window() ) {
+			continue
+		}
+
+		switch p := (*gp).( type ) {
+			case *gizmos.Pledge_bw:
+				if ! p.Uses_links( lids ) {
+					continue
+				}
+				ptypes[name] = "bandwidth"
+				if repath {
+					rreqs[name] = &repath_req{ p: p, avoid: lids }
+					rl = append( rl, rreqs[name] )
+				}
+
+			case *gizmos.Pledge_bwow:
+				gate := p.Get_gate()
+				if gate == nil || gate.Get_sw_name() == nil || ! d.Covers_switch( *gate.Get_sw_name() ) {
+					continue
+				}
+				ptypes[name] = "oneway"
+
+			default:
+				continue
+		}
+		affected = append( affected, name )
+	}
+
+	serr := repath_send( rl )									// one request to move all of them
+	sep := ""
+	jstr = fmt.Sprintf( `{ "drain": %s, "links": [ %s ], "affected": [ `, d.To_json(), strings.Join( jlinks, ", " ) )
+	for _, name := range affected {
+		gp := inv.cache[name]
+		action := "none"
+		if rr := rreqs[name]; rr != nil {
+			switch {
+				case serr != nil:
+					action = fmt.Sprintf( "not moved: %s", serr )
+
+				case rr.err != nil:
+					action = fmt.Sprintf( "not moved: %s", rr.err )
+
+				case rr.paths != nil:
+					rr.p.Set_path_list( rr.paths )
+					rr.p.Reset_pushed( )
+					action = "moved"
+					moved++
+					rm_sheep.Baa( 1, "reservation moved to avoid drain %s: %s", d.Get_id(), name )
+			}
+		} else if repath && ptypes[name] == "oneway" {
+			action = "not moved: oneway reservations are enforced on the endpoint"
+		}
+
+		commence, conclude := (*gp).Get_window()
+		jstr += fmt.Sprintf( `%s{ "id": %q, "type": %q, "commence": %d, "conclude": %d, "action": %q }`, sep, name, ptypes[name], commence, conclude, action )
+		sep = ", "
+	}
+	jstr += " ] }"
+
+	return
+}
+
+/*
+	Generate a json list of all drains which have not passed along with the reservations
+	each affects. Drains which have passed are dropped.
+*/
+func (inv *Inventory) drain_list( ) ( jstr string ) {
+	ids := make( []string, 0, len( inv.drains ) )
+	for id, d := range inv.drains {
+		if d.Is_expired() {
+			delete( inv.drains, id )
+		} else {
+			ids = append( ids, id )
+		}
+	}
+	sort.Strings( ids )
+
+	sep := ""
+	jstr = "[ "
+	for _, id := range ids {
+		d := inv.drains[id]
+		lids := []string{ }
+		if ! inv.pend_drains[id] {								// pending drains are applied only after the pledges are restored
+			if l, err := inv.add_drain( d ); err == nil {		// same drain: network just returns the links now covered
+				lids = l
+			}
+		}
+		r, _ := inv.drain_report( d, lids, false )
+		jstr += sep + r
+		sep = ", "
+	}
+	jstr += " ]"
+
+	return
+}
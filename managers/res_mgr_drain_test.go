@@ -0,0 +1,107 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	res_mgr_drain_test
+	Abstract:	Tests for maintenance windows restored from a checkpoint: the drain is
+				kept even when network cannot apply it, is not applied while restored
+				pledges wait on the retry list, and is applied once network accepts it.
+				The network manager channel is replaced with a stand in which records
+				the drain requests and accepts them only when told the graph is built.
+	Date:		19 Oct 2026
+*/
+
+package managers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/att/gopkgs/bleater"
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+func Test_drain_restore( t *testing.T ) {
+	fmt.Fprintf( os.Stderr, "\n------- drain restored from checkpoint -\n" )
+	if rm_sheep == nil {
+		rm_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	}
+
+	now := time.Now().Unix()
+	d, _ := gizmos.Mk_drain( "mw1", gizmos.DRAIN_LINK, "sw1,sw2", now, now + 3600, 50 )
+	dir, err := ioutil.TempDir( "", "tegu_drain" )
+	if err != nil {
+		t.Fatalf( "unable to create scratch directory: %s", err )
+	}
+	defer os.RemoveAll( dir )
+	fname := path.Join( dir, "chkpt" )
+	if err = ioutil.WriteFile( fname, []byte( d.To_chkpt() + "\n" ), 0644 ); err != nil {
+		t.Fatalf( "unable to write checkpoint: %s", err )
+	}
+
+	built := false
+	sent := 0
+	save_ch := nw_ch
+	ch := make( chan *ipc.Chmsg, 4 )
+	nw_ch = ch
+	defer func() {
+		close( ch )
+		nw_ch = save_ch
+	}()
+	go func() {													// network manager stand in
+		for m := range ch {
+			if m.Msg_type == REQ_DRAIN {
+				sent++
+				if built {
+					m.Response_data = []string{ "sw1-sw2" }
+				} else {
+					m.State = fmt.Errorf( "no links in the network graph are covered" )
+				}
+			}
+			m.Response_ch <- m
+		}
+	}()
+
+	inv := Mk_inventory( )
+	var rp gizmos.Pledge = &gizmos.Pledge_bw{ }
+	inv.retry["r1"] = &rp											// a pledge still waiting to be vetted
+	if err = inv.load_chkpt( &fname ); err != nil || inv.drains["mw1"] == nil || ! inv.pend_drains["mw1"] || sent != 0 {
+		fmt.Fprintf( os.Stderr, "FAIL: drain not kept, or applied before the pledges were restored: err=%v sent=%d\n", err, sent )
+		t.FailNow()
+	}
+
+	delete( inv.retry, "r1" )
+	inv.apply_pend_drains( )										// graph not built: network refuses it
+	if sent != 1 || inv.drains["mw1"] == nil || ! inv.pend_drains["mw1"] {
+		fmt.Fprintf( os.Stderr, "FAIL: drain refused by network was not kept for another try: sent=%d\n", sent )
+		t.Fail()
+	}
+
+	built = true
+	inv.apply_pend_drains( )
+	if sent != 2 || inv.drains["mw1"] == nil || inv.pend_drains["mw1"] {
+		fmt.Fprintf( os.Stderr, "FAIL: drain not applied once network accepted it: sent=%d pending=%v\n", sent, inv.pend_drains["mw1"] )
+		t.Fail()
+	}
+}
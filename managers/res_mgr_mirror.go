@@ -28,6 +28,13 @@
 				26 May 2015 - Changes to support pledge as an interface.
 				16 Nov 2015 - Add save_mirror_response()
 				24 Nov 2015 - Add options
+				18 Oct 2026 - Pass all projects indicator on internal mirror lookup.
+				19 Oct 2026 - Pass the mirror filter to tegu_add_mirror.
+				19 Oct 2026 - Added erspan/vxlan tunnel output; tunnel ids are tracked to avoid collisions.
+				19 Oct 2026 - Pass the mirror bandwidth (rate limit) to tegu_add_mirror.
+				19 Oct 2026 - Added update_mirror (extend, add/remove ports); only the changed ports are pushed.
+				19 Oct 2026 - update_mirror estimates the bandwidth again, and reserves it, when ports change.
+				19 Oct 2026 - update_mirror cancels the mirror if its old reservation cannot be restored.
 */
 
 package managers
@@ -36,6 +43,7 @@ import (
 	"fmt"
 	"regexp"
 	"strings"
+	"time"
 	"github.com/att/gopkgs/ipc"
 	"github.com/att/tegu/gizmos"
 )
@@ -52,15 +60,36 @@ func push_mirror_reservation( gp *gizmos.Pledge, rname string, ch chan *ipc.Chms
 		return
 	}
 
-	ports, out, _, _, _, _, _, _ := p.Get_values( )
-	ports2 := strings.Replace(*ports, " ", ",", -1)	// ports must be comma separated
+	ports, _, _, _, _, _, _, _ := p.Get_values( )
+	send_mirror_add( p, strings.Replace(*ports, " ", ",", -1), false )	// ports must be comma separated
+	p.Set_pushed()
+}
+
+/*
+ *	Send the add mirror request for the ports (comma separated, vlan list last) to the agent.
+ *	If append is set the ports are added to the existing mirror.
+ */
+func send_mirror_add( p *gizmos.Pledge_mirror, ports2 string, append bool ) {
+	_, out, _, _, _, _, _, _ := p.Get_values( )
 
 	// This is somewhat of a hack, but as long as the code in tegu_agent:do_mirrorwiz doesn't change, it should work
 	id := p.Get_id( )
 	arg := *id
+	if f := p.Get_filter(); f != nil {
+		arg = f.To_args() + " " + *id						// filter flags (-d -s -m) precede the name
+	}
+	if ttype, tunid := p.Get_tunnel(); ttype != gizmos.MT_GRE {
+		arg = fmt.Sprintf( "-t%s:%d %s", ttype, tunid, arg )
+	}
+	if bw := p.Get_bandwidth(); bw > 0 {
+		arg = fmt.Sprintf( "-b%d %s", bw, arg )				// rate limit for tunnel and vlan outputs
+	}
 	opts := p.Get_Options()
 	if opts != nil && *opts != "" {
-		arg = fmt.Sprintf("-o%s %s", *opts, *id)
+		arg = fmt.Sprintf("-o%s %s", *opts, arg)
+	}
+	if append {
+		arg = "-a " + arg
 	}
 
 	host := p.Get_qid( )
@@ -82,7 +111,6 @@ func push_mirror_reservation( gp *gizmos.Pledge, rname string, ch chan *ipc.Chms
 	rm_sheep.Baa( 2, " JSON -> %s", json )
 	msg := ipc.Mk_chmsg( )
 	msg.Send_req( am_ch, nil, REQ_SENDSHORT, json, nil )		// send this as a short request to one agent	
-	p.Set_pushed()
 }
 
 /*
@@ -97,12 +125,24 @@ func undo_mirror_reservation( gp *gizmos.Pledge, rname string, ch chan *ipc.Chms
 		return
 	}
 
+	send_mirror_del( p, nil )
+	p.Set_pushed()
+}
+
+/*
+ *	Send the delete mirror request to the agent. If ports is not empty only those ports are
+ *	removed from the mirror.
+ */
+func send_mirror_del( p *gizmos.Pledge_mirror, ports []string ) {
 	id := p.Get_id( )
 	// This is somewhat of a hack, but as long as the code in tegu_agent:do_mirrorwiz doesn't change, it should work
 	arg := *id
+	if len( ports ) > 0 {
+		arg = "-p" + strings.Join( ports, "," ) + " " + arg
+	}
 	opts := p.Get_Options()
 	if opts != nil && *opts != "" {
-		arg = fmt.Sprintf("-o%s %s", *opts, *id)
+		arg = fmt.Sprintf("-o%s %s", *opts, arg)
 	}
 
 	host := p.Get_qid( )
@@ -115,7 +155,6 @@ func undo_mirror_reservation( gp *gizmos.Pledge, rname string, ch chan *ipc.Chms
 	rm_sheep.Baa( 2, " JSON -> %s", json )
 	msg := ipc.Mk_chmsg( )
 	msg.Send_req( am_ch, nil, REQ_SENDSHORT, json, nil )		// send this as a short request to one agent	
-	p.Set_pushed()
 }
 
 /*
@@ -130,7 +169,7 @@ func save_mirror_response( stdout []string, stderr []string ) {
 		name := re.FindString(s)
 		if name != "" {
 			// Fetch the mirror and save the stdout/err
-			m := lookupMirror( name, *super_cookie )
+			m := lookupMirror( name, *super_cookie, ALL_PROJECTS )
 			if m != nil {
 				rm_sheep.Baa( 1, "Saving output for mirror %s", name )
 				m.Set_Output( stdout, stderr )
@@ -140,3 +179,191 @@ func save_mirror_response( stdout []string, stderr []string ) {
 	}
 	rm_sheep.Baa( 1, "save_mirror_response: could not find the mirror name" )
 }
+
+/*
+	Ensure that the tunnel id (erspan session id or vxlan vni) of the mirror is not used by
+	another mirror sending to the same collector (output address) with a tunnel of the
+	same family during an overlapping window. If the mirror has no id the lowest free id
+	is assigned. Gre tunnels have no id and are not checked.
+*/
+func (inv *Inventory) mirror_tunid( p *gizmos.Pledge_mirror ) ( err error ) {
+	ttype, tunid := p.Get_tunnel()
+	max := gizmos.Mirror_tunnel_max( ttype )
+	if max <= 0 {
+		return nil
+	}
+
+	family := gizmos.Mirror_tunnel_family( ttype )
+	_, out, _, _, commence, conclude, _, _ := p.Get_values()
+	used := make( map[int]bool )
+	for _, gp := range inv.cache {
+		m, ok := (*gp).( *gizmos.Pledge_mirror )
+		if ! ok || m == p || m.Is_expired() {
+			continue
+		}
+
+		mtype, mid := m.Get_tunnel()
+		_, mout, _, _, _, _, _, _ := m.Get_values()
+		c, e := m.Get_window()
+		if gizmos.Mirror_tunnel_family( mtype ) == family && *mout == *out && c <= conclude && e >= commence {
+			used[mid] = true
+		}
+	}
+
+	if tunid > 0 {
+		if used[tunid] {
+			return fmt.Errorf( "%s id %d is already in use by another mirror to %s", family, tunid, *out )
+		}
+		return nil
+	}
+
+	for tunid = 1; tunid <= max; tunid++ {
+		if ! used[tunid] {
+			p.Set_tunnel( ttype, tunid )
+			rm_sheep.Baa( 2, "mirror %s: %s id %d assigned for %s", *p.Get_id(), family, tunid, *out )
+			return nil
+		}
+	}
+
+	return fmt.Errorf( "no free %s ids for mirrors to %s", family, *out )
+}
+
+/*
+	Changes requested to an existing mirror: a new expiry (0 leaves it alone) and ports to add
+	or remove. Name, cookie and project are used to fetch the mirror as for a delete.
+*/
+type mirror_update struct {
+	name	*string
+	cookie	*string
+	project	*string
+	expiry	int64
+	add		[]string
+	del		[]string
+}
+
+/*
+	Apply an update to a mirror. A change of expiry, or of the ports of a mirror whose bandwidth
+	was estimated (the estimate follows the number of ports), has the mirror's bandwidth reserved
+	again; if that fails the mirror is left as it was, and if its old reservation cannot be made
+	again either the mirror is cancelled (as with a delete). Port changes are made to the pledge and, if
+	the mirror has been pushed, only the ports added or removed are sent to the agent (all of the
+	ports when the bandwidth changed so that the agent resets the limit).
+*/
+func (inv *Inventory) update_mirror( u *mirror_update ) ( gp *gizmos.Pledge, err error ) {
+	gp, err = inv.Get_res( u.name, u.cookie, u.project )
+	if gp == nil {
+		if err == nil {
+			err = fmt.Errorf( "cannot find mirror: %s", *u.name )
+		}
+		return nil, err
+	}
+	p, ok := (*gp).( *gizmos.Pledge_mirror )
+	if ! ok || p.Is_expired() {
+		return nil, fmt.Errorf( "not an active or pending mirror: %s", *u.name )
+	}
+
+	ports := p.Get_ports()
+	have := make( map[string]bool, len( ports ) )
+	for _, port := range ports {
+		have[port] = true
+	}
+	added := make( []string, 0, len( u.add ) )
+	for _, port := range u.add {
+		if ! have[port] {
+			have[port] = true
+			added = append( added, port )
+		}
+	}
+	removed := make( []string, 0, len( u.del ) )
+	for _, port := range u.del {
+		if have[port] {
+			delete( have, port )
+			removed = append( removed, port )
+		}
+	}
+	if len( have ) == 0 {
+		return nil, fmt.Errorf( "mirror %s would have no ports; delete the mirror instead", *u.name )
+	}
+
+	c, e := p.Get_window()
+	expiry := e
+	if u.expiry > 0 && u.expiry != e {
+		if u.expiry <= c || u.expiry <= time.Now().Unix() {
+			return nil, fmt.Errorf( "end time (%d) must be after the start time (%d) and now", u.expiry, c )
+		}
+		expiry = u.expiry
+	}
+	obw := p.Get_bandwidth()
+	bw := obw
+	if p.Is_bw_estimated() && (len( added ) > 0 || len( removed ) > 0) {
+		bw = mirror_estimate( len( have ), p.Get_filter() )
+	}
+
+	if expiry != e || bw != obw {
+		if obw > 0 || bw > 0 {
+			ch := make( chan *ipc.Chmsg )								// do not close -- senders close channels
+			req := ipc.Mk_chmsg( )
+			req.Send_req( nw_ch, ch, REQ_DEL, p, nil )					// release for the old window and bandwidth
+			<- ch
+			p.Set_expiry( expiry )
+			p.Set_bandwidth( bw )
+			req = ipc.Mk_chmsg( )
+			req.Send_req( nw_ch, ch, REQ_MIRROR_RESERVE, p, nil )
+			req = <- ch
+			if req.State != nil {
+				err = req.State
+				p.Set_expiry( e )										// put it back the way it was
+				p.Set_bandwidth( obw )
+				req = ipc.Mk_chmsg( )
+				req.Send_req( nw_ch, ch, REQ_MIRROR_RESERVE, p, nil )
+				req = <- ch
+				if req.State != nil {									// the old reservation is gone too; the mirror cannot run unreserved
+					rm_sheep.Baa( 0, "ERR: mirror %s: unable to restore the bandwidth reservation; mirror cancelled: %s  [TGURMG014]", *u.name, req.State )
+					p.Set_expiry( time.Now().Unix() )					// expire now; undo removes it from the agent
+					p.Set_pushed()
+					return nil, fmt.Errorf( "%s; the previous reservation could not be restored and the mirror was cancelled", err )
+				}
+				return nil, err
+			}
+		} else {
+			p.Set_expiry( expiry )
+		}
+		if expiry != e {
+			rm_sheep.Baa( 1, "mirror %s: expiry changed from %d to %d", *u.name, e, expiry )
+		}
+		if bw != obw {
+			rm_sheep.Baa( 1, "mirror %s: estimated bandwidth changed from %d to %d", *u.name, obw, bw )
+		}
+	}
+
+	if len( added ) == 0 && len( removed ) == 0 {
+		return gp, nil
+	}
+
+	nports := make( []string, 0, len( have ) )
+	for _, port := range append( ports, added... ) {			// keep the original order
+		if have[port] {
+			nports = append( nports, port )
+		}
+	}
+	p.Set_ports( nports )
+	rm_sheep.Baa( 1, "mirror %s: %d port(s) added, %d removed", *u.name, len( added ), len( removed ) )
+
+	if p.Is_pushed() && ! p.Is_paused() {							// already on the host; send just the delta
+		if len( removed ) > 0 {
+			send_mirror_del( p, removed )
+		}
+		if bw != obw {
+			added = nports											// resend all ports so the agent resets the limit
+		}
+		if len( added ) > 0 {
+			ports2 := strings.Join( added, "," )
+			if vlan := p.Get_vlan(); vlan != "" {
+				ports2 += ",vlan:" + vlan
+			}
+			send_mirror_add( p, ports2, true )
+		}
+	}
+
+	return gp, nil
+}
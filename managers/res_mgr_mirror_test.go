@@ -0,0 +1,100 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	res_mgr_mirror_test
+	Abstract:	Tests for mirror updates: when the new bandwidth reservation fails the old one
+				is made again, and when that also fails the mirror is cancelled.
+	Date:		19 Oct 2026
+*/
+
+package managers
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/att/gopkgs/bleater"
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+func Test_mirror_update_rollback( t *testing.T ) {
+	fmt.Fprintf( os.Stderr, "\n------- mirror update rollback ---------\n" )
+	if rm_sheep == nil {
+		rm_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	}
+
+	now := time.Now().Unix()
+	name := "mir1"
+	cookie := "cookie"
+	out := "10.0.0.9"
+	phost := "host1"
+	gp, err := gizmos.Mk_mirror_pledge( []string{ "fa:16:3e:00:00:01" }, &out, now, now + 3600, &name, &cookie, &phost, nil, nil, nil )
+	if err != nil {
+		fmt.Fprintf( os.Stderr, "FAIL: unable to make mirror pledge: %s\n", err )
+		t.FailNow()
+	}
+	p := gp.( *gizmos.Pledge_mirror )
+	p.Set_bandwidth( 1000 )
+	inv := Mk_inventory()
+	inv.cache[name] = &gp
+
+	save_ch := nw_ch
+	ch := make( chan *ipc.Chmsg, 4 )
+	nw_ch = ch
+	defer func() {
+		close( ch )
+		nw_ch = save_ch
+	}()
+	restore := true													// network manager stand in: only the old window can be reserved
+	go func() {
+		for m := range ch {
+			if m.Msg_type == REQ_MIRROR_RESERVE {
+				if _, e := p.Get_window(); e != now + 3600 || ! restore {
+					m.State = fmt.Errorf( "no capacity" )
+				}
+			}
+			m.Response_ch <- m
+		}
+	}()
+
+	_, err = inv.update_mirror( &mirror_update{ name: &name, cookie: &cookie, expiry: now + 7200 } )
+	if err == nil {
+		fmt.Fprintf( os.Stderr, "FAIL: update accepted without a reservation\n" )
+		t.Fail()
+	}
+	if _, e := p.Get_window(); e != now + 3600 || p.Is_expired() {
+		fmt.Fprintf( os.Stderr, "FAIL: mirror not left as it was when the update failed: expiry=%d\n", e )
+		t.Fail()
+	}
+
+	restore = false
+	_, err = inv.update_mirror( &mirror_update{ name: &name, cookie: &cookie, expiry: now + 7200 } )
+	if err == nil {
+		fmt.Fprintf( os.Stderr, "FAIL: update accepted without a reservation\n" )
+		t.Fail()
+	}
+	if _, e := p.Get_window(); e > time.Now().Unix() || ! p.Is_pushed() {
+		fmt.Fprintf( os.Stderr, "FAIL: mirror without a reservation was not cancelled: expiry=%d pushed=%v\n", e, p.Is_pushed() )
+		t.Fail()
+	}
+}
@@ -26,7 +26,10 @@
 	Date:		26 January 2016
 	Author:		E. Scott Daniels
 
-	Mods:		
+	Mods:		18 Oct 2026 - Pledge is marked push pending until the agent acknowledges the flow-mods.
+				19 Oct 2026 - Request carries the pledge's push generation.
+				19 Oct 2026 - Request building split out (pass_fqreq) for use by reconcile and explain.
+				19 Oct 2026 - Request is flagged for no hard timeout when flow-mods are deleted at expiry.
 */
 
 package managers
@@ -61,8 +64,6 @@ func pass_push_res( gp *gizmos.Pledge, rname *string, ch chan *ipc.Chmsg, to_lim
 		msg		*ipc.Chmsg
 	)
 
-	now := time.Now().Unix()
-
 	p, ok :=  (*gp).( *gizmos.Pledge_pass )		// generic pledge better be a passthrough pledge!
 	if ! ok {
 		rm_sheep.Baa( 1, "internal error in pass_push_reservation: pledge isn't a passthrough pledge" )
@@ -70,41 +71,53 @@ func pass_push_res( gp *gizmos.Pledge, rname *string, ch chan *ipc.Chmsg, to_lim
 		return
 	}
 
+	freq := pass_fqreq( p, rname, time.Now().Unix(), to_limit )
+	if freq != nil {
+		rm_sheep.Baa( 1, "pushing passthru reservation: %s", p )
+		freq.Pgen = p.Set_push_pending( 1 )		// pushed only after the request is acknowledged
+		msg = ipc.Mk_chmsg()
+		msg.Send_req( fq_ch, ch, REQ_PT_RESERVE, freq, nil )					// queue work with fq-manger to read the struct and send cmd(s) to agent to get it done
+	}
+}
+
+/*
+	Build the fq-mgr request for a passthrough pledge; nil if the host cannot be mapped to an
+	IP address. Used to push, reconcile and explain the reservation; now is as for bw_fqreqs.
+*/
+func pass_fqreq( p *gizmos.Pledge_pass, rname *string, now int64, to_limit int64 ) ( *Fq_req ) {
 	host, _,  _, expiry, proto := p.Get_values( )			// reservation info that we need
 
 	ip := name2ip( host )
+	if ip == nil {
+		return nil
+	}
 
-	if ip != nil {											// good ip addresses so we're good to go
-		freq := Mk_fqreq( rname )						// default flow mod request with empty match/actions (for bw requests, we don't need priority or such things)
-		freq.Match.Smac = ip							// fq_mgr has conversion map to convert to mac
-		freq.Swid = p.Get_phost()						// the phyiscal host where the VM lives and where fmods need to be deposited
+	freq := Mk_fqreq( rname )						// default flow mod request with empty match/actions (for bw requests, we don't need priority or such things)
+	freq.Match.Smac = ip							// fq_mgr has conversion map to convert to mac
+	freq.Swid = p.Get_phost()						// the phyiscal host where the VM lives and where fmods need to be deposited
 
-		freq.Cookie = 0xffff							// should be ignored, if we see this out there we've got problems
+	freq.Cookie = 0xffff							// should be ignored, if we see this out there we've got problems
 
-		if (*p).Is_paused( ) {
-			freq.Expiry = time.Now().Unix( ) +  15		// if reservation shows paused, then we set the expiration to 15s from now  which should force the flow-mods out
+	if (*p).Is_paused( ) {
+		freq.Expiry = time.Now().Unix( ) +  15		// if reservation shows paused, then we set the expiration to 15s from now  which should force the flow-mods out
+	} else {
+		freq.No_hto = flow_delete						// flow-mods are deleted at expiry rather than timing out
+		if ! flow_delete && to_limit > 0 && expiry > now + to_limit {
+			freq.Expiry = now + to_limit			// expiry must be capped so as not to overflow virtual switch variable size
 		} else {
-			if to_limit > 0 && expiry > now + to_limit {
-				freq.Expiry = now + to_limit			// expiry must be capped so as not to overflow virtual switch variable size
-			} else {
-				freq.Expiry = expiry
-			}
+			freq.Expiry = expiry
 		}
-		freq.Id = rname
-
-		freq.Extip = &empty_str
+	}
+	freq.Id = rname
 
-														// this will change when ported to endpoint branch as the endpoint allows address and port 'in line'
-		freq.Match.Ip1 = proto							// the proto on the reservation should be [{udp|tcp:}]address[:port]
-		freq.Match.Ip2 = nil
-		freq.Espq =   nil
-		dup_str := ""
-		freq.Exttyp = &dup_str
+	freq.Extip = &empty_str
 
-		rm_sheep.Baa( 1, "pushing passthru reservation: %s", p )
-		msg = ipc.Mk_chmsg()
-		msg.Send_req( fq_ch, ch, REQ_PT_RESERVE, freq, nil )					// queue work with fq-manger to read the struct and send cmd(s) to agent to get it done
+													// this will change when ported to endpoint branch as the endpoint allows address and port 'in line'
+	freq.Match.Ip1 = proto							// the proto on the reservation should be [{udp|tcp:}]address[:port]
+	freq.Match.Ip2 = nil
+	freq.Espq =   nil
+	dup_str := ""
+	freq.Exttyp = &dup_str
 
-		p.Set_pushed()				// safe to mark the pledge as having been pushed.
-	}
+	return freq
 }
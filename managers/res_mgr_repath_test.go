@@ -0,0 +1,174 @@
+// vi: sw=4 ts=4:
+/*
+ ---------------------------------------------------------------------------
+   Copyright (c) 2013-2015 AT&T Intellectual Property
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at:
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+ ---------------------------------------------------------------------------
+*/
+
+/*
+	Mnemonic:	res_mgr_repath_test
+	Abstract:	Tests for moving bandwidth reservations when links are lost from a rebuilt
+				graph: the lost links are found, the pledges using them are moved (all in one
+				request to network), a pledge with no other path is marked degraded and keeps
+				the mark in the checkpoint, and the mark is cleared when the links return.
+				The network manager channel is replaced with a stand in which re-paths the
+				pledges against the current graph.
+	Date:		19 Oct 2026
+*/
+
+package managers
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/att/gopkgs/bleater"
+	"github.com/att/gopkgs/ipc"
+	"github.com/att/tegu/gizmos"
+)
+
+/*
+	sw1 and sw2 are joined directly and through sw3; the hosts are on sw1 and sw2. The
+	placeholders are replaced to drop links.
+*/
+const repath_topo = `{
+	"version": 1,
+	"switches": [ { "id": "sw1" }, { "id": "sw2" }, { "id": "sw3" } ],
+	"links": [
+		DIRECT
+		{ "src": "sw1", "src_port": 2, "dst": "sw3", "dst_port": 1, "capacity": 1000, "headroom": 0 },
+		{ "src": "sw3", "src_port": 2, "dst": "sw2", "dst_port": 2, "capacity": 1000, "headroom": 0 }
+	],
+	"hosts": [
+		{ "mac": "fa:16:3e:00:00:01", "ip4": "10.0.0.1", "switch": "sw1", "port": 9 },
+		{ "mac": "fa:16:3e:00:00:02", "ip4": "10.0.0.2", "switch": "sw2", "port": 9 }
+	]
+}`
+
+func repath_topo_with( direct bool, via bool ) ( string ) {
+	topo := repath_topo
+	if direct {
+		topo = strings.Replace( topo, "DIRECT", `{ "src": "sw1", "src_port": 1, "dst": "sw2", "dst_port": 1, "capacity": 1000, "headroom": 0 },`, 1 )
+	} else {
+		topo = strings.Replace( topo, "DIRECT", "", 1 )
+	}
+	if ! via {
+		topo = strings.Replace( topo, `"dst": "sw2", "dst_port": 2, "capacity": 1000`, `"dst": "sw2", "dst_port": 2, "capacity": 1000, "excluded": true`, 1 )
+	}
+	return topo
+}
+
+func Test_repath_lost_links( t *testing.T ) {
+	fmt.Fprintf( os.Stderr, "\n------- repath after link loss ---------\n" )
+	if rm_sheep == nil {
+		rm_sheep = bleater.Mk_bleater( 0, os.Stderr )
+	}
+	h1 := "10.0.0.1"
+	h2 := "10.0.0.2"
+	now := time.Now().Unix()
+
+	net := mk_topo_net( t, nil, repath_topo_with( true, true ), 3 )
+	inv := Mk_inventory( )
+	plist := make( []*gizmos.Pledge_bw, 0 )
+	for _, name := range []string{ "r1", "r2" } {
+		rname := name
+		p, _ := gizmos.Mk_bw_pledge( &h1, &h2, &zero_string, &zero_string, now, now + 3600, 100, 100, &rname, str_ptr( "cookie" ), 0, false )
+		p.Set_qid( &rname )
+		pl, err := net.bw_reserve( p, 0, false, false )
+		if err != nil {
+			fmt.Fprintf( os.Stderr, "FAIL: unable to reserve %s: %s\n", rname, err )
+			t.FailNow()
+		}
+		p.Set_path_list( pl )
+		p.Set_pushed( )
+		var gp gizmos.Pledge = p
+		inv.cache[rname] = &gp
+		plist = append( plist, p )
+	}
+
+	sent := 0
+	save_ch := nw_ch
+	ch := make( chan *ipc.Chmsg, 4 )
+	nw_ch = ch
+	defer func() {
+		close( ch )
+		nw_ch = save_ch
+	}()
+	go func() {													// network manager stand in using the current graph
+		for m := range ch {
+			if m.Msg_type == REQ_REPATH {
+				sent++
+				rl := m.Req_data.( []*repath_req )
+				net.bw_repath_list( rl, 0, false, false )
+				m.Response_data = rl
+			}
+			m.Response_ch <- m
+		}
+	}()
+
+	old := net
+	net = mk_topo_net( t, old, repath_topo_with( false, true ), 3 )		// direct link lost
+	lost := net.lost_links( old )
+	if len( lost ) == 0 {
+		fmt.Fprintf( os.Stderr, "FAIL: lost link was not noticed\n" )
+		t.FailNow()
+	}
+	if moved := inv.repath_bw( lost ); moved != 2 || sent != 1 {
+		fmt.Fprintf( os.Stderr, "FAIL: expected both reservations moved in one request: moved=%d requests=%d\n", moved, sent )
+		t.Fail()
+	}
+	for _, p := range plist {
+		for _, pth := range p.Get_path_list() {
+			if ! net.path_live( pth ) {
+				fmt.Fprintf( os.Stderr, "FAIL: moved reservation still uses a lost link: %s\n", pth.To_str() )
+				t.Fail()
+			}
+		}
+		if p.Get_degraded() != "" || p.Is_pushed() {
+			fmt.Fprintf( os.Stderr, "FAIL: moved reservation degraded or not marked to push again\n" )
+			t.Fail()
+		}
+	}
+
+	old = net
+	net = mk_topo_net( t, old, repath_topo_with( false, false ), 3 )		// no path remains
+	sent = 0
+	if moved := inv.repath_bw( net.lost_links( old ) ); moved != 0 || sent != 1 {
+		fmt.Fprintf( os.Stderr, "FAIL: reservation moved with no path: moved=%d requests=%d\n", moved, sent )
+		t.Fail()
+	}
+	p := plist[0]
+	if p.Get_degraded() == "" {
+		fmt.Fprintf( os.Stderr, "FAIL: reservation without a path not marked degraded\n" )
+		t.FailNow()
+	}
+
+	cstr := p.To_chkpt()											// degraded survives a restart
+	if rp, err := gizmos.Json2pledge( &cstr ); err != nil || (*rp).( *gizmos.Pledge_bw ).Get_degraded() != p.Get_degraded() {
+		fmt.Fprintf( os.Stderr, "FAIL: degraded reason not kept in the checkpoint: %s\n", cstr )
+		t.Fail()
+	}
+
+	old = net
+	net = mk_topo_net( t, old, repath_topo_with( false, true ), 3 )		// the links of its paths return
+	inv.repath_bw( nil )
+	if p.Get_degraded() != "" {
+		fmt.Fprintf( os.Stderr, "FAIL: degraded reservation not cleared when its links returned: %s\n", p.Get_degraded() )
+		t.Fail()
+	}
+}
@@ -31,13 +31,17 @@
 				27 Feb 2015 - Changes to work with lazy updates, long duration reservations
 					and e*->l* fixes.
 				26 May 2015 - Changes to support pledge as an interface.
+				19 Oct 2026 - Hops may be middlebox pools; traffic to a pool is sent to a select group
+					and members which fail the health check are dropped from it (REQ_MBOX_HEALTH).
+				19 Oct 2026 - Select group ids are allocated uniquely and the groups deleted when the
+					reservation expires or is cancelled; flow-mods from a failed member are removed.
 */
 
 package managers
 
 import (
 	//"encoding/json"
-	//"fmt"
+	"fmt"
 	//"os"
 	"strings"
 	"time"
@@ -75,34 +79,61 @@ func set_proto_port( fq_data *Fq_req, proto *string, forward bool ) {
 
 
 /*
-	Generate flow-mod requests to the fq-manager for a given src,dest pair and list of
-	middleboxes.  This assumes that the middlebox list has been reversed if necessary.
-	Either source (ep1) or dest (ep2) may be nil which indicates a "to any" or "from any"
-	intention.
+	Set the next hop on the request: the mac of the middlebox, or the select group (gid) which
+	spreads the traffic over the members of a pool.
+*/
+func set_next_hop( fq_data *Fq_req, mp *gizmos.Mbox_pool, gid uint32 ) {
+	if mp.Is_pool() && gid != 0 {
+		g := mp.Group_parm( gid )
+		fq_data.Nxt_group = &g
+		fq_data.Nxt_mac = nil
+	} else {
+		fq_data.Nxt_mac = mp.Get_mbox().Get_mac( )
+	}
+}
+
+/*
+	Build the flow-mod requests for a given src,dest pair and list of middlebox pools (hops).
+	This assumes that the list has been reversed if necessary. Either source (ep1) or dest (ep2)
+	may be nil which indicates a "to any" or "from any" intention. Gids is the select group of
+	each hop (parallel to pools; 0 for a single middlebox).
+
+	A hop with more than one middlebox is sent to with a select group (see set_next_hop), and
+	the rules which match traffic coming back from the hop are set for each member which is in
+	service. If failed is true only the rules which match traffic coming back from members that
+	have failed are built, without a next hop, so that they can be removed.
 
 	DANGER:  We generate the flowmods in reverse order which _should_ generate the highest
 			priority f-mods first. This is absolutely necessary to prevent packet loops
 			on the switches which can happen if a higher priority rule isn't in place
 			that would cause the lower priority rule to be skipped over.
 */
-func steer_fmods( ep1 *string, ep2 *string, mblist []*gizmos.Mbox, expiry int64, rname *string, proto *string, forward bool ) {
+func steer_fqreqs( ep1 *string, ep2 *string, pools []*gizmos.Mbox_pool, gids []uint32, expiry int64, rname *string, proto *string, forward bool, failed bool ) ( fqrs []*Fq_req ) {
 	var (
 		fq_data *Fq_req
 		fq_match *Fq_parms
 		fq_action *Fq_parms
-		mb	*gizmos.Mbox							// current middle box being worked with (must span various blocks)
 	)
 
+	fqrs = make( []*Fq_req, 0, 8 )
 	if expiry < 5 {									// refuse if too short
 		return
 	}
 
+	members := func( mp *gizmos.Mbox_pool ) ( []*gizmos.Mbox ) {		// sources of the rules matching traffic back from a hop
+		if failed {
+			return mp.Get_failed_members( )
+		}
+		mbl, _ := mp.Get_members( )
+		return mbl
+	}
+
 	mstr := "0x00/0x01"								// meta data match string; match if mask 0x01 is not set
 	mstr_2xx := "0x00/0x04"							// pri 200 rules match if 0x04 is not set
-	nmb := len( mblist )
+	nmb := len( pools )
 	for i := 0; i < nmb; i++ {						// check value of each in list and bail if any are nil
-		if mblist[i] == nil {
-			rm_sheep.Baa( 1, "IER: steer_fmods: unexpected nil mb i=%d nmb=%d", i,  nmb )
+		if pools[i] == nil || pools[i].Get_mbox() == nil {
+			rm_sheep.Baa( 1, "IER: steer_fqreqs: unexpected nil mb i=%d nmb=%d", i,  nmb )
 			return
 		}
 	}
@@ -120,7 +151,6 @@ func steer_fmods( ep1 *string, ep2 *string, mblist []*gizmos.Mbox, expiry int64,
 			fq_data.Pri = 300
 			fq_data.Expiry = expiry
 
-			mb = mblist[i]
 			fq_match.Ip1 = ep1
 			fq_match.Meta = &mstr
 
@@ -128,27 +158,26 @@ func steer_fmods( ep1 *string, ep2 *string, mblist []*gizmos.Mbox, expiry int64,
 
 			set_proto_port( fq_data, proto, forward ) 		// set the protocol match port dest in forward direction, src in reverse
 
-			if ep1 != nil {									// if source is a specific address, then we need only one 300 rule
-				rm_sheep.Baa( 2, "specific endpoint, 300 fmod goes to the MB switch only" )
-				fq_data.Match.Ip1 = nil									// there is no source to match at this point
-				fq_data.Match.Smac = nil
-				fq_data.Match.Ip2 = ep2
-				fq_data.Swid, fq_data.Match.Swport = mb.Get_sw_port( )	// specific switch and input port needed for this fmod
-				fq_data.Lbmac = mb.Get_mac()							// fqmgr will need the mac if the port is late binding
-			} else {													// if no specific src, the 100 rule lives on each switch, so we must put a 300 on each too
-				rm_sheep.Baa( 2, "no specific endpoint, 300 fmod goes to all switches" )
-				fq_data.Swid = nil										// force to all switches
-				fq_data.Match.Smac = mb.Get_mac()						// src for 300 is the last mbox
-			}
-
 			if ep1 == nil && ep2 == nil {
 				rm_sheep.Baa( 1, "300 fmod not set -- src and dst were nil" )
 			} else {
-				jstr, _ := fq_data.To_json( )
-				rm_sheep.Baa( 1, "write 300 fmod: %s", *jstr )
-
-				msg := ipc.Mk_chmsg()
-				msg.Send_req( fq_ch, nil, REQ_ST_RESERVE, fq_data, nil )			// final flow-mod from the last middlebox out
+				for _, mb := range members( pools[i] ) {		// one for each member of the last hop
+					fq_300 := fq_data.Clone()
+					if ep1 != nil {									// if source is a specific address, then we need only one 300 rule per box
+						rm_sheep.Baa( 2, "specific endpoint, 300 fmod goes to the MB switch only" )
+						fq_300.Match.Ip1 = nil									// there is no source to match at this point
+						fq_300.Match.Smac = nil
+						fq_300.Match.Ip2 = ep2
+						fq_300.Swid, fq_300.Match.Swport = mb.Get_sw_port( )	// specific switch and input port needed for this fmod
+						fq_300.Lbmac = mb.Get_mac()								// fqmgr will need the mac if the port is late binding
+					} else {													// if no specific src, the 100 rule lives on each switch, so we must put a 300 on each too
+						rm_sheep.Baa( 2, "no specific endpoint, 300 fmod goes to all switches" )
+						fq_300.Swid = nil										// force to all switches
+						fq_300.Match.Smac = mb.Get_mac()						// src for 300 is the last mbox
+					}
+
+					fqrs = append( fqrs, fq_300 )							// final flow-mod from the last middlebox out
+				}
 			}
 		}
 
@@ -165,9 +194,11 @@ func steer_fmods( ep1 *string, ep2 *string, mblist []*gizmos.Mbox, expiry int64,
 		set_proto_port( fq_data, proto, forward ) 		// set the protocol match port dest in forward direction, src in reverse
 
 		if i == 0 {										// push the ingress rule (possibly to all switches)
+			if failed {
+				continue								// not specific to a member
+			}
 			fq_data.Pri = 100
 
-			mb = mblist[i]
 			if ep1 != nil {
 				rm_sheep.Baa( 1, "specific endpoint, 100 fmod goes to single switch: %s", *ep1 )
 				_, fq_data.Match.Smac, fq_data.Swid, _ = get_hostinfo( ep1 )						// if a specific src host supplied, get it's switch and we'll land only one flow-mod on it
@@ -178,17 +209,9 @@ func steer_fmods( ep1 *string, ep2 *string, mblist []*gizmos.Mbox, expiry int64,
 			}
 
 			fq_data.Match.Ip1 = nil												// for 100 rules we only want to match src based on mac in case both endpoint VMs live on same phys host
-			fq_data.Nxt_mac = mb.Get_mac( )
-			jstr, _ := fq_data.To_json( )
-			rm_sheep.Baa( 1, "write ingress fmod: %s", *jstr )
-
-			msg := ipc.Mk_chmsg()
-			msg.Send_req( fq_ch, nil, REQ_ST_RESERVE, fq_data, nil )			// no response right now -- eventually we want an asynch error
+			set_next_hop( fq_data, pools[i], gids[i] )
+			fqrs = append( fqrs, fq_data )
 		} else {																// push fmod on the switch that connects the previous mbox matching packets from it and directing to next mbox
-
-			mb = mblist[i-1] 													// pull previous middlebox which will be the source and define the swtich and port for this rule
-			fq_data.Swid, fq_data.Match.Swport = mb.Get_sw_port( )	 			// specific switch and input port needed for this fmod
-			fq_data.Lbmac = mb.Get_mac()										// fqmgr will need the mac if the port is late binding (-128)
 			fq_match.Meta = &mstr_2xx											// pri 2xx marks and avoids 0x04 so that they hit even if a 300 rule matched
 			fq_data.Match.Smac = nil											// we match based on input port and dest mac, so no need for this
 			if ep2 == nil {
@@ -196,40 +219,144 @@ func steer_fmods( ep1 *string, ep2 *string, mblist []*gizmos.Mbox, expiry int64,
 			}
 			fq_action.Resub = &resub_2xx
 
-			if fq_data.Match.Dmac == nil && fq_data.Match.Ip2 == nil {			// for l* there won't be a destination endpoint inbound; need a lower priority in this case and an additional 2xx rule
-				rm_sheep.Baa( 1, "adding 210 rule to match reverse" )
-				fq_210 := fq_data.Clone()										// need to lay in a 210 f-mod first if there's no end point
+			add_210 := fq_data.Match.Dmac == nil && fq_data.Match.Ip2 == nil	// for l* there won't be a destination endpoint inbound; need a lower priority in this case and an additional 2xx rule
+			if add_210 {
+				fq_data.Pri = 200
+			} else {
+				fq_data.Pri = 210												// ensure rule with a dest matches before a 2xx rule without dest
+			}
+			if ! failed {
+				set_next_hop( fq_data, pools[i], gids[i] )						// next middlebox (or pool) in the list
+			}
+
+			for _, mb := range members( pools[i-1] ) {							// previous middlebox(es) are the source and define the switch and port for the rule
+				fq_mb := fq_data.Clone()
+				fq_mb.Swid, fq_mb.Match.Swport = mb.Get_sw_port( )	 			// specific switch and input port needed for this fmod
+				fq_mb.Lbmac = mb.Get_mac()										// fqmgr will need the mac if the port is late binding (-128)
+
+				if add_210 {
+					rm_sheep.Baa( 1, "adding 210 rule to match reverse" )
+					fq_210 := fq_mb.Clone()										// need to lay in a 210 f-mod first if there's no end point
+					fq_210.Nxt_mac = nil
+					fq_210.Nxt_group = nil
+					fq_210.Match.Ip2 = ep1										// the 210 rule will match the reverse (ip2 is the dest which we need to match on the fmod)
+					fq_210.Pri = 210
+
+					fqrs = append( fqrs, fq_210 )
+				}
 
-				//clonedif ep2 == nil {
-				//	fq_210.Match.Ip1 = nil										// for L* there isn't and endpoint and as such we need to prevent match on IP in fmod
-				//}
-				// clonedfq_210.Match.Smac = nil											// smac is nil since we want to match on the source IP
+				fqrs = append( fqrs, fq_mb )									// flow mod for each intermediate link in backwards direction
+			}
+		}
+	}
 
-				//clonedfq_210.Swid, fq_210.Match.Swport = mb.Get_sw_port( ) 			// specific switch and input port needed for this fmod
-				//clonedfq_210.Lbmac = mb.Get_mac()										// fqmgr will need the mac if the port is late binding (-128)
-				//clonedfq_210.Action.Resub = &resub_2xx
+	return fqrs
+}
 
-				fq_210.Match.Ip2 = ep1											// the 210 rule will match the reverse (ip2 is the dest which we need to match on the fmod)
-				fq_210.Pri = 210
+/*
+	Build the flow-mod requests for both directions of a steering reservation. The select group
+	of each pool hop must have been allocated (see alloc_steer_groups). If failed is true only
+	the requests needed to remove the rules for failed pool members are built.
+*/
+func st_fqreqs( p *gizmos.Pledge_steer, rname *string, expiry int64, failed bool ) ( []*Fq_req ) {
+	ep1, ep2, _, _, _, _, _, _ := p.Get_values( )
+	ep1 = name2ip( ep1 )										// we work only with IP addresses; sets to nil if "" (L*)
+	ep2 = name2ip( ep2 )
 
-				msg := ipc.Mk_chmsg()
-				msg.Send_req( fq_ch, nil, REQ_ST_RESERVE, fq_210, nil )			// no response right now -- eventually we want an asynch error
+	nmb := p.Get_mbox_count()
+	pools := make( []*gizmos.Mbox_pool, nmb )
+	gids := make( []uint32, nmb )
+	for i := range pools {
+		pools[i] = p.Get_mbox_pool( i )
+		gids[i] = p.Get_group( i, true )
+	}
+	fqrs := steer_fqreqs( ep1, ep2, pools, gids, expiry, rname, p.Get_proto(), true, failed )			// forward fmods
 
-				fq_data.Pri = 200
-			} else {
-				fq_data.Pri = 210												// ensure rule with a dest matches before a 2xx rule without dest
+	for i := range pools {											// build middlebox list in reverse
+		pools[nmb-1-i] = p.Get_mbox_pool( i )
+		gids[nmb-1-i] = p.Get_group( nmb-1-i, false )
+	}
+	return append( fqrs, steer_fqreqs( ep2, ep1, pools, gids, expiry, rname, p.Get_proto(), false, failed )... )	// backward fmods
+}
+
+/*
+	Allocate a select group for each pool hop, in each direction, of the steering reservation
+	which doesn't have one. The preferred id is a hash of the reservation name, direction and hop;
+	if another live reservation (or another hop of this one) already uses it, the next free id is
+	taken. Returns an error if the steering group range is exhausted.
+*/
+func (inv *Inventory) alloc_steer_groups( p *gizmos.Pledge_steer, rname string ) ( err error ) {
+	used := make( map[uint32]bool )
+	for _, gp := range inv.cache {
+		sp, ok := (*gp).( *gizmos.Pledge_steer )
+		if ! ok || sp.Is_expired() {
+			continue
+		}
+		for _, gid := range sp.Get_groups() {
+			used[gid] = true
+		}
+	}
+
+	nmb := p.Get_mbox_count()
+	for _, forward := range []bool{ true, false } {
+		for hop := 0; hop < nmb; hop++ {
+			pi := hop
+			if ! forward {
+				pi = nmb - 1 - hop											// hops are counted in the direction of travel
 			}
+			if ! p.Get_mbox_pool( pi ).Is_pool() || p.Get_group( hop, forward ) != 0 {
+				continue
+			}
+
+			gid := gizmos.Mbox_group_id( rname, forward, hop )
+			for n := uint32( 0 ); used[gid]; n++ {
+				if n > gizmos.OF_GROUP_MASK {
+					return fmt.Errorf( "no free steering group ids for reservation %s", rname )
+				}
+				gid = gizmos.Mbox_group_next( gid )
+			}
+			used[gid] = true
+			p.Set_group( hop, forward, gid )
+			rm_sheep.Baa( 2, "steering reservation %s: group 0x%x assigned to hop %d forward=%v", rname, gid, hop, forward )
+		}
+	}
 
+	return nil
+}
 
-			mb = mblist[i]	 													// now safe to get next middlebox in the list
-			fq_data.Nxt_mac = mb.Get_mac( )
-			jstr, _ := fq_data.To_json( )
-			rm_sheep.Baa( 1, "write intermed fmod: %s", *jstr )
+/*
+	Send the requests to fq-mgr that delete the select groups of an expired (or cancelled)
+	steering reservation; deleting a group also removes the flow-mods which send to it. The
+	ids are released so that other reservations may use them.
+*/
+func del_steer_groups( p *gizmos.Pledge_steer, rname *string ) {
+	if len( p.Get_groups() ) == 0 {
+		return
+	}
 
-			msg := ipc.Mk_chmsg()
-			msg.Send_req( fq_ch, nil, REQ_ST_RESERVE, fq_data, nil )			// flow mod for each intermediate link in backwards direction
+	ops := make( []*sb_op, 0, 4 )
+	seen := make( map[string]bool )
+	for _, fr := range st_fqreqs( p, rname, SB_REMOVE_DELAY, false ) {
+		if fr.Nxt_group != nil {
+			key := strings.SplitN( *fr.Nxt_group, ",", 2 )[0] + "@" + sb_host( fr )		// one delete per group and switch
+			if ! seen[key] {
+				seen[key] = true
+				ops = append( ops, &sb_op{ kind: SB_STEER, req: fr } )
+			}
 		}
 	}
+
+	if len( ops ) > 0 {
+		rm_sheep.Baa( 1, "deleting select groups for expired steering reservation: %s (%d requests)", *rname, len( ops ) )
+		msg := ipc.Mk_chmsg()
+		msg.Send_req( fq_ch, nil, REQ_FLOW_DEL, ops, nil )
+	}
+
+	nmb := p.Get_mbox_count()
+	for hop := 0; hop < nmb; hop++ {
+		p.Set_group( hop, true, 0 )
+		p.Set_group( hop, false, 0 )
+	}
 }
 
 
@@ -262,21 +389,98 @@ func push_st_reservation( gp *gizmos.Pledge, rname string, ch chan *ipc.Chmsg, h
 		return
 	}
 
-	ep1 = name2ip( ep1 )										// we work only with IP addresses; sets to nil if "" (L*)
-	ep2 = name2ip( ep2 )
+	for _, fr := range st_fqreqs( p, &rname, duration, false ) {
+		jstr, _ := fr.To_json( )
+		rm_sheep.Baa( 1, "write steering fmod: %s", *jstr )
 
-	nmb := p.Get_mbox_count()
-	mblist := make( []*gizmos.Mbox, nmb )
-	for i := range mblist {
-		mblist[i] = p.Get_mbox( i )
+		msg := ipc.Mk_chmsg()
+		msg.Send_req( fq_ch, nil, REQ_ST_RESERVE, fr, nil )			// no response right now -- eventually we want an asynch error
+	}
+
+	p.Set_pushed()
+}
+
+/*
+	Ask the agent(s) to check the middleboxes which are members of a pool in a steering
+	reservation that has not expired. One request is sent for each host with the macs of the
+	members attached to it; the replies come back as a REQ_MBOX_HEALTH with data.
+*/
+func (inv *Inventory) mbox_health_check( ) {
+	hmacs := make( map[string][]string )
+	for _, gp := range inv.cache {
+		p, ok := (*gp).( *gizmos.Pledge_steer )
+		if ! ok || p.Is_expired() {
+			continue
+		}
+
+		for _, mb := range p.Get_pool_members() {
+			swid, _ := mb.Get_sw_port()
+			if swid != nil && mb.Get_mac() != nil {
+				hmacs[*swid] = append( hmacs[*swid], *mb.Get_mac() )
+			}
+		}
 	}
-	steer_fmods( ep1, ep2, mblist, duration, &rname, p.Get_proto(), true )			// set forward fmods
 
-	nmb--
-	for i := range mblist {											// build middlebox list in reverse
-		mblist[nmb-i] = p.Get_mbox( i )
+	for h, macs := range hmacs {
+		if err := send_agent_action( action{ Atype: "mbox_health", Hosts: []string{ h }, Qdata: macs }, false ); err != nil {
+			rm_sheep.Baa( 1, "unable to send middlebox health check to %s: %s", h, err )
+		}
 	}
-	steer_fmods( ep2, ep1, mblist, duration, &rname, p.Get_proto(), false )			// set backward fmods
+}
 
-	p.Set_pushed()
+/*
+	Apply the health check results (records of the form: host mac up|down) to the pools of the
+	steering reservations. A reservation with a pool that changed is pushed again which replaces
+	the group(s) with the members in service; the reservation itself is not affected. The rules
+	which match traffic coming back from a member that failed (2xx and 300) are removed. Returns
+	the number of reservations which changed.
+*/
+func (inv *Inventory) mbox_health( recs []string ) ( n int ) {
+	for rname, gp := range inv.cache {
+		p, ok := (*gp).( *gizmos.Pledge_steer )
+		if ! ok || p.Is_expired() {
+			continue
+		}
+
+		changed := false
+		down := false
+		for _, r := range recs {
+			toks := strings.Fields( r )
+			if len( toks ) != 3 {
+				continue
+			}
+
+			if p.Set_mbox_state( toks[1], toks[2] == "up" ) {
+				if toks[2] == "up" {
+					rm_sheep.Baa( 1, "middlebox %s on %s is back in service; restored to its pool in reservation %s", toks[1], toks[0], rname )
+				} else {
+					rm_sheep.Baa( 0, "WRN: middlebox %s on %s failed health check; removed from its pool in reservation %s  [TGURMG011]", toks[1], toks[0], rname )
+					down = true
+				}
+				changed = true
+			}
+		}
+
+		if changed {
+			n++
+			if p.Is_pushed() {
+				p.Reset_pushed()									// next push tickle reinstalls with the members in service
+
+				if down {
+					rn := rname
+					ops := make( []*sb_op, 0, 4 )
+					for _, fr := range st_fqreqs( p, &rn, SB_REMOVE_DELAY, true ) {
+						ops = append( ops, &sb_op{ kind: SB_STEER, req: fr } )
+					}
+					if len( ops ) > 0 {
+						rm_sheep.Baa( 1, "removing flow-mods from failed middlebox(es) in reservation %s (%d requests)", rname, len( ops ) )
+						msg := ipc.Mk_chmsg()
+						msg.Send_req( fq_ch, nil, REQ_FLOW_DEL, ops, nil )
+					}
+				}
+			}
+		}
+	}
+
+	return n
 }
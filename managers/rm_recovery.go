@@ -31,6 +31,9 @@
 						Corrected bad bleat message.
 						Correct potential nil ptr exeeption in vet.
 				20 Apr 2017 - Prevent core dump if chkpt file has blank line.
+				19 Oct 2026 - Restore maintenance windows (mwin records); they are applied after the
+					pledges have been restored.
+				19 Oct 2026 - Reserve mirror bandwidth when a mirror is restored.
 */
 
 package managers
@@ -68,7 +71,16 @@ func vet_pledge( p *gizmos.Pledge ) ( disposition int ) {
 	} else {
 		switch sp := (*p).(type) {									// work on specific pledge type, but pass the Pledge interface to add()
 			case *gizmos.Pledge_mirror:
-				//err = i.Add_res( p )								// assume we can just add it back in as is
+				if sp.Get_bandwidth() > 0 {							// admission control: bandwidth must be reserved again
+					my_ch = make( chan *ipc.Chmsg )
+					req := ipc.Mk_chmsg( )
+					req.Send_req( nw_ch, my_ch, REQ_MIRROR_RESERVE, sp, nil )
+					req = <- my_ch
+					if req.State != nil {
+						rm_sheep.Baa( 0, "WRN: pledge_vet: unable to reserve bandwidth for mirror: %s: %s	[TGURMG010]", (*p).To_str(), req.State )
+						return DS_RETRY
+					}
+				}
 
 			case *gizmos.Pledge_steer:
 				rm_sheep.Baa( 0, "did not restore steering reservation from checkpoint; not implemented" )
@@ -243,6 +255,16 @@ func (inv *Inventory) load_chkpt( fname *string ) ( err error ) {
 						inv.add_ulcap( &toks[1], &toks[2] )
 					}
 
+				case "mwin:":										// maintenance window; kept, but applied only once the pledges are restored
+					if d, derr := gizmos.Chkpt2drain( rec ); derr == nil {
+						if ! d.Is_expired() {
+							inv.drains[d.Get_id()] = d
+							inv.pend_drains[d.Get_id()] = true
+						}
+					} else {
+						rm_sheep.Baa( 1, "drain from checkpoint not restored: %s", derr )
+					}
+
 				default:
 					p, err = gizmos.Json2pledge( &rec )			// convert any type of json pledge to Pledge
 					if err == nil {
@@ -274,6 +296,9 @@ func (inv *Inventory) load_chkpt( fname *string ) ( err error ) {
 	}
 
 	rm_sheep.Baa( 1, "read %d records from checkpoint file: %s:  %d adds; %d queued for retry; %d dropped", nrecs, *fname, added, queued, failed )
+	if len( inv.retry ) == 0 {
+		inv.apply_pend_drains( )						// otherwise once the retries have been vetted
+	}
 	return
 }
 
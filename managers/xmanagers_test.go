@@ -19,7 +19,7 @@
 
 
 	
-package managers_test
+package managers
 
 import "testing"
 import "fmt"
@@ -27,8 +27,12 @@ import "os"
 
 
 func TestMan_util( t *testing.T ) {
-	str = "udp:42"
-	pv, port = managers.proto2val_port( &str )
-	fmt.Fprintf( os.Stderr, "%d %d\n", pv, port )
+	str := "udp:42"
+	fq := Mk_fqreq( nil )
+	set_proto_port( fq, &str, true )
+	fmt.Fprintf( os.Stderr, "%s %s\n", *fq.Protocol, *fq.Match.Tpdport )
+	if *fq.Protocol != "udp" || *fq.Match.Tpdport != "42" {
+		fmt.Fprintf( os.Stderr, "FAIL: udp:42 did not set protocol and destination port\n" )
+		t.Fail()
+	}
 }
-